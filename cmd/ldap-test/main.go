@@ -1,29 +1,72 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"ldap-automated-actions/internal/config"
+	"ldap-automated-actions/internal/history"
 	"ldap-automated-actions/internal/logger"
 	"ldap-automated-actions/internal/tests"
+	"ldap-automated-actions/internal/version"
 
 	"github.com/spf13/pflag"
 )
 
-const version = "1.0.0"
+// commands are the optional subcommands accepted as the first argument
+var commands = []struct {
+	name  string
+	usage string
+}{
+	{"snapshot", "snapshot <file>        Export the subtree under --snapshot-base (default: base DN) to LDIF"},
+	{"restore", "restore <file>         Re-create the entries of an LDIF snapshot"},
+	{"cleanup", "cleanup                Delete the entries of --from-manifest <file|run-id> or --from-tracked <file>"},
+	{"history", "history                Show pass-rate and latency trends per operation from --history-db"},
+	{"report", "report diff <a> <b>    Compare two JSON reports: status changes, new failures and latency deltas"},
+}
 
 func main() {
+	// An optional command may precede the flags (e.g. "ldap-test snapshot out.ldif")
+	command := ""
+	args := os.Args[1:]
+	if len(args) > 0 {
+		for _, c := range commands {
+			if args[0] == c.name {
+				command = c.name
+				args = args[1:]
+				break
+			}
+		}
+	}
+
 	// Define CLI flags
 	configFile := pflag.StringP("config", "c", "./configs/ldap-test-config.yaml", "Config file path")
-	host := pflag.String("host", "", "LDAP server host")
+	host := pflag.String("host", "", "LDAP server host, or a comma-separated list of host[:port] tried in order")
 	port := pflag.Int("port", 389, "LDAP server port")
 	bindDN := pflag.String("bind-dn", "", "Bind DN for authentication")
-	bindPassword := pflag.String("bind-password", "", "Bind password")
+	bindPassword := pflag.String("bind-password", "", "Bind password, or - to read it from stdin")
+	bindPasswordFile := pflag.String("bind-password-file", "", "File containing bind password")
 	baseDN := pflag.String("base-dn", "", "Base DN for test operations")
 	useTLS := pflag.Bool("use-tls", false, "Use LDAPS (LDAP over TLS)")
 	startTLS := pflag.Bool("start-tls", false, "Use StartTLS")
 	timeout := pflag.Int("timeout", 30, "Connection timeout in seconds")
+	bindMethod := pflag.String("bind-method", "simple", "Bind method: simple, gssapi (Kerberos) or external (client certificate)")
+	followReferrals := pflag.Bool("follow-referrals", false, "Follow the referrals and continuation references of searches")
+	referralCredentials := pflag.String("referral-credentials", "anonymous", "Bind on a referred server: anonymous, or reuse to bind as configured")
+	kerberosRealm := pflag.String("kerberos-realm", "", "Kerberos realm of the keytab principal")
+	kerberosUser := pflag.String("kerberos-user", "", "Kerberos principal authenticating with the keytab, without realm")
+	kerberosKeytab := pflag.String("kerberos-keytab", "", "Kerberos keytab (default: use the credentials cache)")
+	kerberosCCache := pflag.String("kerberos-ccache", "", "Kerberos credentials cache (default: $KRB5CCNAME)")
+	kerberosConfig := pflag.String("kerberos-config", "", "krb5.conf path (default: $KRB5_CONFIG or /etc/krb5.conf)")
+	kerberosSPN := pflag.String("kerberos-spn", "", "Service principal of the LDAP server (default: ldap/<host>)")
 
 	trustStorePath := pflag.String("trust-store-path", "", "Path to PKCS12 trust store file (for custom certificates)")
 	trustStorePassword := pflag.String("trust-store-password", "", "Trust store password")
@@ -31,15 +74,79 @@ func main() {
 	tlsCertFile := pflag.String("tls-cert-file", "", "Path to PEM certificate file (alternative to PKCS12)")
 	tlsCAFile := pflag.String("tls-ca-file", "", "Path to PEM CA certificate file")
 	insecureSkipVerify := pflag.Bool("insecure-skip-verify", false, "Skip TLS certificate verification (not recommended)")
+	tlsPinnedCertSHA256 := pflag.String("tls-pinned-cert-sha256", "", "Only accept the server certificate (or SPKI) with this SHA-256 hash")
+	requireEncryptedAuth := pflag.Bool("require-encrypted-auth", false, "Fail if the server accepts simple binds over unencrypted LDAP")
+	requireReferentialIntegrity := pflag.Bool("require-referential-integrity", false, "Fail if deleting a group member leaves its DN in the group")
+	uniqueAttribute := pflag.String("unique-attribute", "", "Attribute the server must keep unique, e.g. mail (fail if a duplicate value is accepted)")
+	binaryAttribute := pflag.String("binary-attribute", "jpegPhoto", "Binary attribute the round-trip test writes: jpegPhoto or userCertificate;binary")
+	binaryAttributeSize := pflag.Int("binary-attribute-size", 64*1024, "Size in bytes of the value the binary round-trip test writes")
+	tlsClientCertFile := pflag.String("tls-client-cert-file", "", "PEM client certificate for mutual TLS and SASL EXTERNAL binds")
+	tlsClientKeyFile := pflag.String("tls-client-key-file", "", "PEM private key of the client certificate")
+	keyStorePath := pflag.String("key-store-path", "", "PKCS12 key store with the client certificate and key (alternative to PEM)")
+	keyStorePassword := pflag.String("key-store-password", "", "Key store password")
+	keyStorePasswordFile := pflag.String("key-store-password-file", "", "File containing key store password")
+	externalAuthzID := pflag.String("external-authz-id", "", "Identity the SASL EXTERNAL bind must map to (e.g. dn:cn=client,dc=example,dc=com)")
+	proxyAuthzID := pflag.String("proxy-authz-id", "", "Identity the proxied authorization search test assumes (e.g. dn:uid=alice,ou=people,dc=example,dc=com)")
+	proxyAuthzExpect := pflag.String("proxy-authz-expect", "", "Outcome the proxied authorization search test requires: allow or deny (default: either)")
 	tlsKeyLogFile := pflag.String("tls-key-log-file", "", "Path to TLS key log file for Wireshark decryption (debugging only)")
 
 	testPrefix := pflag.String("test-prefix", "ldap-test", "Prefix for test entries")
-	testSuite := pflag.String("test-suite", "all", "Test suite to run: all|bind|search|add|modify|compare|modifydn|delete|abandon")
-	concurrent := pflag.Int("concurrent", 1, "Number of concurrent test workers")
+	testOUTemplate := pflag.String("test-ou-template", config.DefaultTestOUTemplate, "Name of the test OU, a template over {{.Prefix}}, {{.RunID}}, {{.Hostname}} and {{.Timestamp}}")
+	reuseTestOU := pflag.String("reuse-test-ou", "", "Run in this pre-created OU under the base DN instead of creating a timestamped one")
+	testSuite := pflag.String("test-suite", "all", "Test suite to run, or a comma-separated list (e.g. add,search): all|bind|schema|search|add|modify|compare|modifydn|group|groups|posix|unicode|escaping|delete|lifecycle|extended|ad|abandon|tls|starttls|notification|sync|referral|acl|unbind|ldif|fuzz|berfuzz|chaos|random|soak|loadtest (fuzz, chaos, random, soak and loadtest suites are opt-in, not part of all; ad is part of all against Active Directory only)")
+	runFilter := pflag.String("run", "", "Only run the tests whose name matches this regular expression, across all selected suites")
+	skipFilter := pflag.String("skip", "", "Leave out the tests whose name matches this regular expression")
+	ldifFile := pflag.String("ldif-file", "", "Load the add and modify records of this LDIF file into the test OU (the ldif suite, part of all when set)")
+	generate := pflag.Int("generate", 0, "Generate this many synthetic users, with their department OUs and groups, under the test OU before the tests")
+	generateWorkers := pflag.Int("generate-workers", 4, "Number of connections adding the generated entries at once")
+	validateSchema := pflag.Bool("validate-schema", false, "Check the test and generated entries against the server schema before adding them")
+	concurrent := pflag.Int("concurrent", 1, "Number of workers that each run their own copy of the selected suites at once")
 	dryRun := pflag.Bool("dry-run", false, "Preview operations without executing")
+	dryRunLDIF := pflag.String("dry-run-ldif", "", "With --dry-run, write the LDIF of the operations the run would perform to this file (- for stdout)")
+	readOnly := pflag.Bool("read-only", false, "Run only the tests that do not write to the directory (bind, search, compare, ...) and refuse the suites that do")
 	loop := pflag.Bool("loop", false, "Run tests continuously (Ctrl+C to stop)")
 	loopDelay := pflag.Int("loop-delay", 0, "Delay between loop iterations in seconds")
 	loopCount := pflag.Int("loop-count", 0, "Number of loop iterations (0 = infinite)")
+	loopJitter := pflag.Int("loop-jitter", 0, "Randomize the delay between loop iterations by up to this many seconds either way")
+	healthAddr := pflag.String("health-addr", "", "Serve /healthz and /last-run on this address in loop mode, e.g. :8080")
+	schedule := pflag.String("schedule", "", "Run as a daemon, starting an iteration each time this cron expression matches, e.g. \"*/5 * * * *\"")
+	runLogDir := pflag.String("run-log-dir", "", "In loop mode, also write the log of each iteration to a file of its own in this directory")
+	loopStatsFile := pflag.String("loop-stats-file", "", "In loop mode, append a JSON line of statistics (counts, per-operation latencies) to this file after each iteration")
+	statsWindow := pflag.String("stats-window", "24h", "Window of the rolling statistics printed after each scheduled run")
+	serve := pflag.String("serve", "", "Run in loop mode and serve Prometheus metrics on /metrics and the runs API on /runs (and /healthz, /last-run) at this address, e.g. :9090")
+
+	lock := pflag.Bool("lock", false, "Hold an advisory lock entry under the base DN while running, so concurrent runs cannot collide")
+	lockStaleAfter := pflag.String("lock-stale-after", "1h", "Age after which the lock of a crashed run is taken over")
+
+	randomSeed := pflag.Int64("random-seed", 0, "Seed of the random operation sequence (0 = new seed each run)")
+	randomDuration := pflag.String("random-duration", "1m", "How long the random suite generates operations, e.g. 10m")
+
+	soakConnections := pflag.Int("soak-connections", 3, "Number of long-lived connections kept bound by the soak suite")
+	soakDuration := pflag.String("soak-duration", "2h", "How long the soak suite keeps its connections open, e.g. 8h")
+	soakInterval := pflag.String("soak-interval", "5m", "Pause between heartbeat searches on each soak connection")
+
+	loadDuration := pflag.String("load-duration", "1m", "How long the loadtest suite generates load, e.g. 10m")
+	loadConcurrency := pflag.Int("load-concurrency", 4, "Number of connections the loadtest suite sends operations on at once")
+	loadRate := pflag.Float64("load-rate", 0, "Target operations per second of the loadtest suite over all connections (0 = as fast as possible)")
+	loadMix := pflag.StringToInt("load-mix", map[string]int{"search": 70, "modify": 15, "add": 10, "bind": 5}, "Relative weight of each loadtest operation, e.g. search=80,modify=10,add=5,bind=5")
+	loadMaxErrorRate := pflag.Float64("load-max-error-rate", 1, "Error percentage above which a loadtest operation fails")
+
+	auditDir := pflag.String("audit-dir", "", "Record every write operation in an LDIF audit trail per run in this directory")
+
+	resume := pflag.String("resume", "", "Resume an interrupted run by its run ID, re-using its test OU")
+	stateDir := pflag.String("state-dir", "./state", "Directory where run progress is saved for --resume, and the manifest of tracked entries")
+
+	maxRunDuration := pflag.String("max-run-duration", "", "Maximum duration of the whole run, e.g. 30m (remaining tests are skipped)")
+	suiteTimeouts := pflag.StringToString("suite-timeout", nil, "Per-suite time budgets, e.g. search=60s,add=30s")
+	retries := pflag.Int("retries", 0, "Repeat a test up to this many times while it fails with a transient result code (0 = never)")
+	retryBackoff := pflag.String("retry-backoff", "500ms", "Wait before the first retry of a test, doubled for each further one")
+	retryCodes := pflag.IntSlice("retry-codes", config.DefaultRetryCodes, "LDAP result codes retried as transient; only 51 (busy) and 52 (unavailable) are safe to retry")
+	thresholds := pflag.StringToString("threshold", nil, "Latency thresholds in milliseconds that fail the run, e.g. search_p95_ms=50,bind_max_ms=200")
+	baseline := pflag.String("baseline", "", "Compare latencies and result codes with this baseline file, recording it from the first passing run")
+	baselineUpdate := pflag.Bool("update-baseline", false, "Record the baseline from this run instead of comparing with it")
+	baselineTolerance := pflag.Float64("baseline-tolerance", 20, "Percent a test's latency may grow over the baseline")
+	baselineMinDelta := pflag.Float64("baseline-min-delta", 5, "Latency growth in ms below which a test never counts as regressed")
+	baselineFail := pflag.Bool("baseline-fail", false, "Fail the run when a test regressed from the baseline")
 
 	logLevel := pflag.String("log-level", "info", "Log level: error|warn|info|debug|trace")
 	logFile := pflag.String("log-file", "", "Log file path (default: ./logs/ldap-test-{timestamp}.log)")
@@ -47,18 +154,39 @@ func main() {
 
 	cleanup := pflag.Bool("cleanup", false, "Delete test data after run")
 	cleanupOnSuccess := pflag.Bool("cleanup-on-success", false, "Delete test data only if all tests pass")
+	cleanupMode := pflag.String("cleanup-mode", "", "What cleanup deletes: tracked (default) for the entries the run created, subtree for everything under the test OU")
 	listTestData := pflag.Bool("list-test-data", false, "List existing test data and exit")
-	cleanupOlderThan := pflag.String("cleanup-older-than", "", "Cleanup test data older than duration (e.g., 7d, 24h)")
+	cleanupOlderThan := pflag.String("cleanup-older-than", "", "Delete test OUs whose name-embedded timestamp is older than this (e.g., 7d, 24h, 30m) and exit")
+	cleanupLDIFDir := pflag.String("cleanup-ldif-dir", "./cleanup", "Directory where preserved test data is written as LDIF delete records (empty = disabled)")
+	exportTracked := pflag.String("export-tracked", "", "Export the tracked entries of preserved test data to this JSON file, for cleanup --from-tracked or other tooling")
+
+	applyLDIF := pflag.String("apply-ldif", "", "Apply and verify an LDIF changelog instead of running tests")
+	applyContinueOnError := pflag.Bool("apply-continue-on-error", false, "Continue applying LDIF records after a failure")
+
+	fromManifest := pflag.String("from-manifest", "", "Manifest of tracked entries (or run ID in --state-dir) whose entries the cleanup command deletes")
+	fromTracked := pflag.String("from-tracked", "", "File of tracked entries written by --export-tracked whose entries the cleanup command deletes")
+	snapshotBase := pflag.String("snapshot-base", "", "Base DN of the subtree exported by the snapshot command (default: base DN)")
 
-	reportFormat := pflag.String("report-format", "console", "Output format: console|json|xml")
+	reportFormat := pflag.String("report-format", "console", "Output format: console|json|junit|html (xml is an alias of junit)")
+	reportFile := pflag.String("report-file", "", "Write the json, junit or html report to this file instead of stdout")
+	csvOut := pflag.String("csv-out", "", "Append a row per test (run ID, timestamp, test, operation, status, duration, result code) to this CSV file")
+	streamJSON := pflag.String("stream-json", "", "Stream a JSON event per completed test to - (stdout), tcp://host:port or unix:///path")
+	pflag.Lookup("stream-json").NoOptDefVal = "-"
+	webhookURL := pflag.String("webhook-url", "", "POST a JSON summary of each run or loop iteration to this URL")
+	notifySlackWebhook := pflag.String("notify-slack-webhook", "", "Post a summary of each run or loop iteration to this Slack incoming webhook")
+	notifyOn := pflag.String("notify-on", "", "When to notify Slack: always or failure (default: always)")
+	historyDB := pflag.String("history-db", "", "Record every run and loop iteration in this SQLite database")
+	historySince := pflag.String("history-since", "168h", "How far back the history command looks")
+	historyPeriod := pflag.String("history-period", "24h", "Period the history command groups runs by")
+	historyOperation := pflag.String("history-operation", "", "Limit the history command to one operation (e.g., Search)")
 	showVersion := pflag.Bool("version", false, "Show version information")
 	showHelp := pflag.BoolP("help", "h", false, "Show help message")
 
-	pflag.Parse()
+	pflag.CommandLine.Parse(args)
 
 	// Show version
 	if *showVersion {
-		fmt.Printf("LDAP Operations Test Suite v%s\n", version)
+		fmt.Printf("LDAP Operations Test Suite v%s\n", version.Version)
 		os.Exit(0)
 	}
 
@@ -67,7 +195,11 @@ func main() {
 		fmt.Println("LDAP Operations Test Suite")
 		fmt.Println("\nA comprehensive testing application for validating LDAP operations.")
 		fmt.Println("\nUsage:")
-		fmt.Println("  ldap-test [flags]")
+		fmt.Println("  ldap-test [command] [flags]")
+		fmt.Println("\nCommands:")
+		for _, c := range commands {
+			fmt.Printf("  %s\n", c.usage)
+		}
 		fmt.Println("\nFlags:")
 		pflag.PrintDefaults()
 		os.Exit(0)
@@ -82,7 +214,12 @@ func main() {
 
 	// Override config with CLI flags (CLI flags take precedence)
 	if *host != "" {
-		cfg.Host = *host
+		hosts, err := config.ParseHostList(*host)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --host: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.Host = hosts
 	}
 	if pflag.Lookup("port").Changed {
 		cfg.Port = *port
@@ -90,8 +227,24 @@ func main() {
 	if *bindDN != "" {
 		cfg.BindDN = *bindDN
 	}
-	if *bindPassword != "" {
+	if *bindPassword != "" && *bindPasswordFile != "" {
+		fmt.Fprintf(os.Stderr, "Configuration error: cannot use both --bind-password and --bind-password-file\n")
+		os.Exit(1)
+	}
+	if *bindPassword == "-" {
+		password, err := readPassword(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration error: failed to read bind password from stdin: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.BindPassword = password
+		cfg.BindPasswordFile = ""
+	} else if *bindPassword != "" {
 		cfg.BindPassword = *bindPassword
+		cfg.BindPasswordFile = ""
+	}
+	if *bindPasswordFile != "" {
+		cfg.BindPasswordFile = *bindPasswordFile
 	}
 	if *baseDN != "" {
 		cfg.BaseDN = *baseDN
@@ -105,6 +258,33 @@ func main() {
 	if pflag.Lookup("timeout").Changed {
 		cfg.Timeout = *timeout
 	}
+	if pflag.Lookup("bind-method").Changed {
+		cfg.BindMethod = *bindMethod
+	}
+	if pflag.Lookup("follow-referrals").Changed {
+		cfg.FollowReferrals = *followReferrals
+	}
+	if pflag.Lookup("referral-credentials").Changed {
+		cfg.ReferralCredentials = *referralCredentials
+	}
+	if *kerberosRealm != "" {
+		cfg.KerberosRealm = *kerberosRealm
+	}
+	if *kerberosUser != "" {
+		cfg.KerberosUser = *kerberosUser
+	}
+	if *kerberosKeytab != "" {
+		cfg.KerberosKeytab = *kerberosKeytab
+	}
+	if *kerberosCCache != "" {
+		cfg.KerberosCCache = *kerberosCCache
+	}
+	if *kerberosConfig != "" {
+		cfg.KerberosConfig = *kerberosConfig
+	}
+	if *kerberosSPN != "" {
+		cfg.KerberosSPN = *kerberosSPN
+	}
 	if *trustStorePath != "" {
 		cfg.TrustStorePath = *trustStorePath
 	}
@@ -123,14 +303,80 @@ func main() {
 	if pflag.Lookup("insecure-skip-verify").Changed {
 		cfg.InsecureSkipVerify = *insecureSkipVerify
 	}
+	if *tlsPinnedCertSHA256 != "" {
+		cfg.TLSPinnedCertSHA256 = *tlsPinnedCertSHA256
+	}
+	if *tlsClientCertFile != "" {
+		cfg.TLSClientCertFile = *tlsClientCertFile
+	}
+	if *tlsClientKeyFile != "" {
+		cfg.TLSClientKeyFile = *tlsClientKeyFile
+	}
+	if *keyStorePath != "" {
+		cfg.KeyStorePath = *keyStorePath
+	}
+	if *keyStorePassword != "" {
+		cfg.KeyStorePassword = *keyStorePassword
+	}
+	if *keyStorePasswordFile != "" {
+		cfg.KeyStorePasswordFile = *keyStorePasswordFile
+	}
+	if *externalAuthzID != "" {
+		cfg.ExternalAuthzID = *externalAuthzID
+	}
+	if *proxyAuthzID != "" {
+		cfg.ProxyAuthzID = *proxyAuthzID
+	}
+	if *proxyAuthzExpect != "" {
+		cfg.ProxyAuthzExpect = *proxyAuthzExpect
+	}
+	if pflag.Lookup("require-encrypted-auth").Changed {
+		cfg.RequireEncryptedAuth = *requireEncryptedAuth
+	}
+	if pflag.Lookup("require-referential-integrity").Changed {
+		cfg.RequireReferentialIntegrity = *requireReferentialIntegrity
+	}
+	if *uniqueAttribute != "" {
+		cfg.UniqueAttribute = *uniqueAttribute
+	}
+	if pflag.Lookup("binary-attribute").Changed {
+		cfg.BinaryAttribute = *binaryAttribute
+	}
+	if pflag.Lookup("binary-attribute-size").Changed {
+		cfg.BinaryAttributeSize = *binaryAttributeSize
+	}
 	if *tlsKeyLogFile != "" {
 		cfg.TLSKeyLogFile = *tlsKeyLogFile
 	}
 	if *testPrefix != "" {
 		cfg.TestPrefix = *testPrefix
 	}
-	if *testSuite != "" {
-		cfg.TestSuite = *testSuite
+	if pflag.Lookup("test-ou-template").Changed {
+		cfg.TestOUTemplate = *testOUTemplate
+	}
+	if *reuseTestOU != "" {
+		cfg.ReuseTestOU = *reuseTestOU
+	}
+	if pflag.Lookup("test-suite").Changed {
+		cfg.TestSuite = config.SuiteList(*testSuite)
+	}
+	if *runFilter != "" {
+		cfg.RunFilter = *runFilter
+	}
+	if *skipFilter != "" {
+		cfg.SkipFilter = *skipFilter
+	}
+	if *ldifFile != "" {
+		cfg.LDIFFile = *ldifFile
+	}
+	if pflag.Lookup("generate").Changed {
+		cfg.Generate = *generate
+	}
+	if pflag.Lookup("generate-workers").Changed {
+		cfg.GenerateWorkers = *generateWorkers
+	}
+	if pflag.Lookup("validate-schema").Changed {
+		cfg.ValidateSchema = *validateSchema
 	}
 	if pflag.Lookup("concurrent").Changed {
 		cfg.Concurrent = *concurrent
@@ -138,6 +384,12 @@ func main() {
 	if pflag.Lookup("dry-run").Changed {
 		cfg.DryRun = *dryRun
 	}
+	if *dryRunLDIF != "" {
+		cfg.DryRunLDIF = *dryRunLDIF
+	}
+	if pflag.Lookup("read-only").Changed {
+		cfg.ReadOnly = *readOnly
+	}
 	if pflag.Lookup("loop").Changed {
 		cfg.Loop = *loop
 	}
@@ -147,6 +399,124 @@ func main() {
 	if pflag.Lookup("loop-count").Changed {
 		cfg.LoopCount = *loopCount
 	}
+	if pflag.Lookup("loop-jitter").Changed {
+		cfg.LoopJitter = *loopJitter
+	}
+	if *healthAddr != "" {
+		cfg.HealthAddr = *healthAddr
+	}
+	if *serve != "" {
+		cfg.Serve = *serve
+	}
+	if *schedule != "" {
+		cfg.Schedule = *schedule
+	}
+	if *runLogDir != "" {
+		cfg.RunLogDir = *runLogDir
+	}
+	if *loopStatsFile != "" {
+		cfg.LoopStatsFile = *loopStatsFile
+	}
+	if pflag.Lookup("stats-window").Changed {
+		cfg.StatsWindow = *statsWindow
+	}
+	// Serve and schedule modes keep the process alive, running the tests in a loop
+	if cfg.Serve != "" || cfg.Schedule != "" {
+		cfg.Loop = true
+	}
+	if pflag.Lookup("lock").Changed {
+		cfg.Lock = *lock
+	}
+	if pflag.Lookup("lock-stale-after").Changed {
+		cfg.LockStaleAfter = *lockStaleAfter
+	}
+	if pflag.Lookup("random-seed").Changed {
+		cfg.RandomSeed = *randomSeed
+	}
+	if pflag.Lookup("random-duration").Changed {
+		cfg.RandomDuration = *randomDuration
+	}
+	if pflag.Lookup("soak-connections").Changed {
+		cfg.SoakConnections = *soakConnections
+	}
+	if pflag.Lookup("soak-duration").Changed {
+		cfg.SoakDuration = *soakDuration
+	}
+	if pflag.Lookup("soak-interval").Changed {
+		cfg.SoakInterval = *soakInterval
+	}
+	if pflag.Lookup("load-duration").Changed {
+		cfg.LoadDuration = *loadDuration
+	}
+	if pflag.Lookup("load-concurrency").Changed {
+		cfg.LoadConcurrency = *loadConcurrency
+	}
+	if pflag.Lookup("load-rate").Changed {
+		cfg.LoadRate = *loadRate
+	}
+	if pflag.Lookup("load-mix").Changed {
+		cfg.LoadMix = *loadMix
+	}
+	if pflag.Lookup("load-max-error-rate").Changed {
+		cfg.LoadMaxErrorRate = *loadMaxErrorRate
+	}
+	if *auditDir != "" {
+		cfg.AuditDir = *auditDir
+	}
+	if *resume != "" {
+		cfg.Resume = *resume
+	}
+	if pflag.Lookup("state-dir").Changed {
+		cfg.StateDir = *stateDir
+	}
+	if *maxRunDuration != "" {
+		cfg.MaxRunDuration = *maxRunDuration
+	}
+	if len(*suiteTimeouts) > 0 {
+		if cfg.SuiteTimeouts == nil {
+			cfg.SuiteTimeouts = make(map[string]string)
+		}
+		for suite, timeout := range *suiteTimeouts {
+			cfg.SuiteTimeouts[suite] = timeout
+		}
+	}
+	if pflag.Lookup("retries").Changed {
+		cfg.Retries = *retries
+	}
+	if pflag.Lookup("retry-backoff").Changed {
+		cfg.RetryBackoff = *retryBackoff
+	}
+	if pflag.Lookup("retry-codes").Changed {
+		cfg.RetryCodes = *retryCodes
+	}
+	if len(*thresholds) > 0 {
+		if cfg.Thresholds == nil {
+			cfg.Thresholds = make(map[string]float64)
+		}
+		for key, value := range *thresholds {
+			limit, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid --threshold %s: %s is not a number of milliseconds\n", key, value)
+				os.Exit(1)
+			}
+			cfg.Thresholds[key] = limit
+		}
+	}
+	if *baseline != "" {
+		cfg.Baseline = *baseline
+	}
+	if *baselineUpdate {
+		cfg.BaselineUpdate = true
+	}
+	if pflag.Lookup("baseline-tolerance").Changed {
+		cfg.BaselineTolerance = *baselineTolerance
+	}
+	if pflag.Lookup("baseline-min-delta").Changed {
+		cfg.BaselineMinDeltaMS = *baselineMinDelta
+	}
+	if *baselineFail {
+		cfg.BaselineFail = true
+	}
 	if *logLevel != "" {
 		cfg.LogLevel = *logLevel
 	}
@@ -163,31 +533,79 @@ func main() {
 	if pflag.Lookup("cleanup-on-success").Changed {
 		cfg.CleanupOnSuccess = *cleanupOnSuccess
 	}
+	if *cleanupMode != "" {
+		cfg.CleanupMode = *cleanupMode
+	}
 	if pflag.Lookup("list-test-data").Changed {
 		cfg.ListTestData = *listTestData
 	}
 	if *cleanupOlderThan != "" {
 		cfg.CleanupOlderThan = *cleanupOlderThan
 	}
-	if *reportFormat != "" {
+	if pflag.Lookup("cleanup-ldif-dir").Changed {
+		cfg.CleanupLDIFDir = *cleanupLDIFDir
+	}
+	if *exportTracked != "" {
+		cfg.ExportTracked = *exportTracked
+	}
+	if *applyLDIF != "" {
+		cfg.ApplyLDIF = *applyLDIF
+	}
+	if pflag.Lookup("apply-continue-on-error").Changed {
+		cfg.ApplyContinueOnError = *applyContinueOnError
+	}
+	if pflag.Lookup("report-format").Changed {
 		cfg.ReportFormat = *reportFormat
 	}
+	if *reportFile != "" {
+		cfg.ReportFile = *reportFile
+	}
+	if *csvOut != "" {
+		cfg.CSVOut = *csvOut
+	}
+	if *streamJSON != "" {
+		cfg.StreamJSON = *streamJSON
+	}
+	if *webhookURL != "" {
+		cfg.WebhookURL = *webhookURL
+	}
+	if *notifySlackWebhook != "" {
+		cfg.Notify.Slack.Webhook = *notifySlackWebhook
+	}
+	if *notifyOn != "" {
+		cfg.Notify.On = *notifyOn
+	}
+	if *historyDB != "" {
+		cfg.HistoryDB = *historyDB
+	}
+
+	// The history and report commands only read local files, so they are
+	// dispatched before the LDAP settings are validated and the special modes run
+	switch command {
+	case "history":
+		handleHistory(cfg, *historySince, *historyPeriod, *historyOperation, initOutput(cfg))
+	case "report":
+		handleReport(cfg, initOutput(cfg))
+	}
 
 	// Validate configuration
-	if err := cfg.Validate(); err != nil {
+	if err := cfg.LoadBindPasswordFile(); err != nil {
 		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
-		fmt.Fprintf(os.Stderr, "\nRun with --help for usage information\n")
 		os.Exit(1)
 	}
-
-	// Initialize logger
-	if err := logger.Initialize(cfg.LogLevel, cfg.LogFile); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
+	if err := cfg.LoadSMTPPasswordFile(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "\nRun with --help for usage information\n")
 		os.Exit(1)
 	}
 
-	logger.Info("Main", "LDAP Operations Test Suite", "version", version)
-	logger.Info("Main", "Configuration loaded", "host", cfg.Host, "port", cfg.Port, "baseDN", cfg.BaseDN)
+	stdout := initOutput(cfg)
+	logger.Info("Main", "LDAP Operations Test Suite", "version", version.Version)
+	logger.Info("Main", "Configuration loaded", "host", cfg.Host.String(), "port", cfg.Port, "baseDN", cfg.BaseDN)
 
 	// Handle special modes
 	if cfg.ListTestData {
@@ -200,9 +618,55 @@ func main() {
 		os.Exit(0)
 	}
 
+	switch command {
+	case "snapshot":
+		handleSnapshot(cfg, *snapshotBase)
+	case "restore":
+		handleRestore(cfg, stdout)
+	case "cleanup":
+		handleCleanupRecorded(cfg, *fromManifest, *fromTracked)
+	}
+
+	if cfg.ApplyLDIF != "" {
+		runner := tests.NewRunner(cfg)
+		runner.SetReportOutput(stdout)
+		if err := runner.Apply(cfg.ApplyLDIF); err != nil {
+			logger.Error("Main", "LDIF apply failed", "error", err)
+			fmt.Fprintf(os.Stderr, "\nLDIF apply failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(runner.GetExitCode())
+	}
+
+	// Ctrl+C / SIGTERM cancel the in-flight operation; a second signal exits immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		logger.Info("Main", "Received interrupt signal, cancelling run (press Ctrl+C again to force exit)")
+	}()
+
 	// Run the test suite
 	runner := tests.NewRunner(cfg)
-	if err := runner.Run(); err != nil {
+	runner.SetReportOutput(stdout)
+	if cfg.Resume != "" {
+		if err := runner.Resume(cfg.Resume); err != nil {
+			logger.Error("Main", "Cannot resume run", "error", err)
+			fmt.Fprintf(os.Stderr, "\nCannot resume run: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.StreamJSON != "" {
+		stream, err := tests.OpenEventStream(cfg.StreamJSON, stdout)
+		if err != nil {
+			logger.Error("Main", "Failed to open event stream", "error", err)
+			fmt.Fprintf(os.Stderr, "\nFailed to open event stream: %v\n", err)
+			os.Exit(1)
+		}
+		runner.SetEventStream(stream)
+	}
+
+	if err := runner.Run(ctx); err != nil {
 		logger.Error("Main", "Test suite failed", "error", err)
 		fmt.Fprintf(os.Stderr, "\nTest suite failed: %v\n", err)
 		os.Exit(1)
@@ -214,6 +678,166 @@ func main() {
 	os.Exit(exitCode)
 }
 
+// initOutput initializes the logger and returns stdout, which is kept for the
+// event stream, report or planned LDIF while human-readable output goes to stderr
+func initOutput(cfg *config.Config) io.Writer {
+	stdout := os.Stdout
+	if cfg.StreamJSON == "-" || cfg.DryRunLDIF == "-" || (cfg.ReportFormat != "console" && cfg.ReportFile == "") {
+		os.Stdout = os.Stderr
+	}
+
+	if err := logger.Initialize(cfg.LogLevel, cfg.LogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	return stdout
+}
+
+// readPassword reads a password from the first line of r, so it can be piped
+// in without appearing in the process arguments
+func readPassword(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("no password on stdin")
+	}
+	return password, nil
+}
+
+func handleSnapshot(cfg *config.Config, baseDN string) {
+	if pflag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: ldap-test snapshot <file> [flags]\n")
+		os.Exit(1)
+	}
+	if baseDN == "" {
+		baseDN = cfg.BaseDN
+	}
+
+	runner := tests.NewRunner(cfg)
+	if err := runner.Snapshot(baseDN, pflag.Arg(0)); err != nil {
+		logger.Error("Main", "Snapshot failed", "error", err)
+		fmt.Fprintf(os.Stderr, "\nSnapshot failed: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func handleRestore(cfg *config.Config, stdout io.Writer) {
+	if pflag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: ldap-test restore <file> [flags]\n")
+		os.Exit(1)
+	}
+	if cfg.ReadOnly {
+		fmt.Fprintf(os.Stderr, "Configuration error: cannot restore a snapshot in read-only mode\n")
+		os.Exit(1)
+	}
+
+	runner := tests.NewRunner(cfg)
+	runner.SetReportOutput(stdout)
+	if err := runner.Restore(pflag.Arg(0)); err != nil {
+		logger.Error("Main", "Restore failed", "error", err)
+		fmt.Fprintf(os.Stderr, "\nRestore failed: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(runner.GetExitCode())
+}
+
+func handleCleanupRecorded(cfg *config.Config, manifest, trackedFile string) {
+	if (manifest == "") == (trackedFile == "") || pflag.NArg() != 0 {
+		fmt.Fprintf(os.Stderr, "Usage: ldap-test cleanup --from-manifest <file|run-id> | --from-tracked <file> [flags]\n")
+		os.Exit(1)
+	}
+	if cfg.ReadOnly {
+		fmt.Fprintf(os.Stderr, "Configuration error: cannot clean up recorded entries in read-only mode\n")
+		os.Exit(1)
+	}
+
+	runner := tests.NewRunner(cfg)
+	var err error
+	if manifest != "" {
+		err = runner.CleanupManifest(manifest)
+	} else {
+		err = runner.CleanupTracked(trackedFile)
+	}
+	if err != nil {
+		logger.Error("Main", "Cleanup failed", "error", err)
+		fmt.Fprintf(os.Stderr, "\nCleanup failed: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func handleHistory(cfg *config.Config, since, period, operation string, stdout io.Writer) {
+	if cfg.HistoryDB == "" {
+		fmt.Fprintf(os.Stderr, "Usage: ldap-test history --history-db <file> [flags]\n")
+		os.Exit(1)
+	}
+	sinceDuration, err := time.ParseDuration(since)
+	if err != nil || sinceDuration <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid --history-since: %s (e.g., 168h)\n", since)
+		os.Exit(1)
+	}
+	periodDuration, err := time.ParseDuration(period)
+	if err != nil || periodDuration < time.Minute {
+		fmt.Fprintf(os.Stderr, "Invalid --history-period: %s (e.g., 24h, at least 1m)\n", period)
+		os.Exit(1)
+	}
+
+	store, err := history.Open(cfg.HistoryDB)
+	if err != nil {
+		logger.Error("Main", "History failed", "error", err)
+		fmt.Fprintf(os.Stderr, "\nHistory failed: %v\n", err)
+		os.Exit(1)
+	}
+	trends, err := store.Trends(time.Now().Add(-sinceDuration), periodDuration, operation)
+	store.Close()
+	if err != nil {
+		logger.Error("Main", "History failed", "error", err)
+		fmt.Fprintf(os.Stderr, "\nHistory failed: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.ReportFormat == "json" {
+		if err := trends.WriteJSON(stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "\nFailed to write history: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		trends.WriteText(stdout)
+	}
+	os.Exit(0)
+}
+
+func handleReport(cfg *config.Config, stdout io.Writer) {
+	if pflag.NArg() != 3 || pflag.Arg(0) != "diff" {
+		fmt.Fprintf(os.Stderr, "Usage: ldap-test report diff <before.json> <after.json> [flags]\n")
+		os.Exit(1)
+	}
+
+	diff, err := tests.DiffReports(pflag.Arg(1), pflag.Arg(2))
+	if err != nil {
+		logger.Error("Main", "Report diff failed", "error", err)
+		fmt.Fprintf(os.Stderr, "\nReport diff failed: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.ReportFormat == "json" {
+		if err := diff.WriteJSON(stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "\nFailed to write report diff: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		diff.WriteText(stdout)
+	}
+
+	// New failures fail the comparison, as when validating an upgrade
+	if len(diff.NewFailures) > 0 {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
 func handleListTestData(cfg *config.Config) {
 	logger.Info("Main", "Listing existing test data")
 	fmt.Println("List test data functionality not yet implemented")
@@ -223,7 +847,11 @@ func handleListTestData(cfg *config.Config) {
 
 func handleCleanupOlder(cfg *config.Config) {
 	logger.Info("Main", "Cleaning up old test data", "olderThan", cfg.CleanupOlderThan)
-	fmt.Printf("Cleanup of data older than %s not yet implemented\n", cfg.CleanupOlderThan)
-	// TODO: Implement cleanup of old test data
-	// This would require parsing the duration and searching for old entries
+
+	runner := tests.NewRunner(cfg)
+	if err := runner.CleanupOlderThan(); err != nil {
+		logger.Error("Main", "Cleanup of old test data failed", "error", err)
+		fmt.Fprintf(os.Stderr, "\nCleanup of old test data failed: %v\n", err)
+		os.Exit(1)
+	}
 }
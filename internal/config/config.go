@@ -1,24 +1,51 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
+	"ldap-automated-actions/internal/schedule"
+
 	"gopkg.in/yaml.v3"
 )
 
 // Config holds all configuration for the LDAP test application
 type Config struct {
 	// LDAP Connection Settings
-	Host         string `yaml:"host"`
-	Port         int    `yaml:"port"`
-	BindDN       string `yaml:"bind_dn"`
-	BindPassword string `yaml:"bind_password"`
-	BaseDN       string `yaml:"base_dn"`
-	UseTLS       bool   `yaml:"use_tls"`
-	StartTLS     bool   `yaml:"start_tls"`
-	Timeout      int    `yaml:"timeout"` // seconds
+	Host             HostList `yaml:"host"` // One server, or a list tried in order until one accepts the connection and bind
+	Port             int      `yaml:"port"`
+	BindDN           string   `yaml:"bind_dn"`
+	BindPassword     string   `yaml:"bind_password"`
+	BindPasswordFile string   `yaml:"bind_password_file"` // File containing the bind password, read instead of bind_password
+	BaseDN           string   `yaml:"base_dn"`
+	UseTLS           bool     `yaml:"use_tls"`
+	StartTLS         bool     `yaml:"start_tls"`
+	Timeout          int      `yaml:"timeout"`     // seconds
+	BindMethod       string   `yaml:"bind_method"` // simple, gssapi for a Kerberos SASL bind or external for a client certificate SASL bind
+
+	// Referral Settings
+	FollowReferrals     bool   `yaml:"follow_referrals"`     // Follow the referrals and continuation references of searches
+	ReferralCredentials string `yaml:"referral_credentials"` // Bind on a referred server: anonymous, or reuse to bind as configured
+
+	// Kerberos Settings (bind_method: gssapi)
+	KerberosRealm  string `yaml:"kerberos_realm"`  // Realm of kerberos_user, e.g. EXAMPLE.COM
+	KerberosUser   string `yaml:"kerberos_user"`   // Principal authenticating with the keytab, without realm
+	KerberosKeytab string `yaml:"kerberos_keytab"` // Keytab of kerberos_user; without one the credentials cache is used
+	KerberosCCache string `yaml:"kerberos_ccache"` // Credentials cache (default: $KRB5CCNAME, or /tmp/krb5cc_<uid>)
+	KerberosConfig string `yaml:"kerberos_config"` // krb5.conf (default: $KRB5_CONFIG, or /etc/krb5.conf)
+	KerberosSPN    string `yaml:"kerberos_spn"`    // Service principal of the LDAP server (default: ldap/<host>)
 
 	// TLS/Certificate Settings
 	TrustStorePath         string `yaml:"trust_store_path"`          // Path to PKCS12 trust store file
@@ -28,47 +55,381 @@ type Config struct {
 	TLSCAFile              string `yaml:"tls_ca_file"`               // Path to PEM CA certificate file
 	InsecureSkipVerify     bool   `yaml:"insecure_skip_verify"`      // Skip certificate verification (not recommended for production)
 	TLSKeyLogFile          string `yaml:"tls_key_log_file"`          // Path to TLS key log file for Wireshark decryption (debugging only)
+	TLSPinnedCertSHA256    string `yaml:"tls_pinned_cert_sha256"`    // SHA-256 of the server certificate or its SPKI (hex, colons optional)
+	TLSClientCertFile      string `yaml:"tls_client_cert_file"`      // PEM client certificate presented in the TLS handshake (mTLS)
+	TLSClientKeyFile       string `yaml:"tls_client_key_file"`       // PEM private key of the client certificate
+	KeyStorePath           string `yaml:"key_store_path"`            // PKCS12 key store with the client certificate and key (alternative to PEM)
+	KeyStorePassword       string `yaml:"key_store_password"`        // Key store password
+	KeyStorePasswordFile   string `yaml:"key_store_password_file"`   // File containing key store password
+	ExternalAuthzID        string `yaml:"external_authz_id"`         // Identity a SASL EXTERNAL bind must map to, e.g. dn:cn=client,dc=example,dc=com
+	ProxyAuthzID           string `yaml:"proxy_authz_id"`            // Identity the proxied authorization search test assumes, e.g. dn:uid=alice,ou=people,dc=example,dc=com
+	ProxyAuthzExpect       string `yaml:"proxy_authz_expect"`        // Outcome that test requires: allow, deny or empty for either
 
 	// Test Settings
-	TestPrefix string `yaml:"test_prefix"`
-	Concurrent int    `yaml:"concurrent"`
-	TestSuite  string `yaml:"test_suite"`
-	DryRun     bool   `yaml:"dry_run"`
-	Loop       bool   `yaml:"loop"`        // Run tests continuously
-	LoopDelay  int    `yaml:"loop_delay"`  // Delay between loop iterations in seconds
-	LoopCount  int    `yaml:"loop_count"`  // Number of iterations (0 = infinite)
+	TestPrefix     string    `yaml:"test_prefix"`
+	TestOUTemplate string    `yaml:"test_ou_template"` // Name of the test OU, a Go template over Prefix, RunID, Hostname and Timestamp
+	ReuseTestOU    string    `yaml:"reuse_test_ou"`    // Name of a pre-created sandbox OU under the base DN to use instead of a timestamped one
+	Concurrent     int       `yaml:"concurrent"`       // Number of workers running their own copy of the suites
+	TestSuite      SuiteList `yaml:"test_suite"`       // One suite, or several separated by commas (a list in YAML)
+	RunFilter      string    `yaml:"run"`              // Only run the tests whose name matches this regular expression
+	SkipFilter     string    `yaml:"skip"`             // Leave out the tests whose name matches this regular expression
+	LDIFFile       string    `yaml:"ldif_file"`        // LDIF whose add and modify records the ldif suite loads into the test OU
+	DryRun         bool      `yaml:"dry_run"`
+	DryRunLDIF     string    `yaml:"dry_run_ldif"`    // Write the LDIF of the operations a dry run would perform to this file ("-" for stdout)
+	ReadOnly       bool      `yaml:"read_only"`       // Run only the tests that do not write to the directory, and refuse the suites that do
+	Loop           bool      `yaml:"loop"`            // Run tests continuously
+	LoopDelay      int       `yaml:"loop_delay"`      // Delay between loop iterations in seconds
+	LoopCount      int       `yaml:"loop_count"`      // Number of iterations (0 = infinite)
+	LoopJitter     int       `yaml:"loop_jitter"`     // Randomize the delay between loop iterations by up to this many seconds either way
+	HealthAddr     string    `yaml:"health_addr"`     // Address of the /healthz and /last-run endpoint in loop mode (e.g., ":8080")
+	Serve          string    `yaml:"serve"`           // Run in loop mode and serve Prometheus metrics and the runs API at this address (e.g., ":9090")
+	Schedule       string    `yaml:"schedule"`        // Cron expression the iterations start on as a daemon (e.g., "*/5 * * * *"); implies loop mode
+	RunLogDir      string    `yaml:"run_log_dir"`     // Directory each loop iteration also writes a log file of its own to
+	StatsWindow    string    `yaml:"stats_window"`    // Window of the rolling statistics of scheduled runs (e.g., "24h")
+	LoopStatsFile  string    `yaml:"loop_stats_file"` // JSON Lines file a line of statistics is appended to after each loop iteration
+
+	// Lock Settings
+	Lock           bool   `yaml:"lock"`             // Hold an advisory lock entry under the base DN for the duration of each run
+	LockStaleAfter string `yaml:"lock_stale_after"` // Age after which a lock of a crashed run is taken over (e.g., "1h")
+
+	// Audit Settings
+	AuditDir string `yaml:"audit_dir"` // Directory of the per-run LDIF audit trail of write operations (empty = disabled)
+
+	// Security Policy Settings
+	RequireEncryptedAuth bool `yaml:"require_encrypted_auth"` // Fail the bind suite if the server accepts simple binds without TLS
+
+	// Referential Integrity Settings
+	RequireReferentialIntegrity bool `yaml:"require_referential_integrity"` // Fail the group suite if deleting a member leaves its DN in the group
+
+	// Attribute Uniqueness Settings
+	UniqueAttribute string `yaml:"unique_attribute"` // Attribute the add suite requires the server to keep unique, e.g. mail (empty skips the test)
+
+	// Binary Attribute Settings
+	BinaryAttribute     string `yaml:"binary_attribute"`      // Binary attribute the round-trip test writes on the test user: jpegPhoto or userCertificate;binary
+	BinaryAttributeSize int    `yaml:"binary_attribute_size"` // Size in bytes of the value the round-trip test writes
+
+	// Resume Settings
+	Resume   string `yaml:"resume"`    // Run ID of an interrupted run to resume
+	StateDir string `yaml:"state_dir"` // Directory where run progress and the manifest of tracked entries are saved
+
+	// Time Budgets
+	MaxRunDuration string            `yaml:"max_run_duration"` // Maximum duration of the whole run (e.g., "30m")
+	SuiteTimeouts  map[string]string `yaml:"suite_timeouts"`   // Per-suite time budgets (e.g., search: "60s")
+
+	// Retry Settings
+	Retries      int    `yaml:"retries"`       // Times a test failing with one of retry_codes is repeated (0 = never)
+	RetryBackoff string `yaml:"retry_backoff"` // Wait before the first retry, doubled for each further one (e.g., "500ms")
+	RetryCodes   []int  `yaml:"retry_codes"`   // LDAP result codes that count as transient (default: 51 busy, 52 unavailable)
+
+	// Latency Thresholds
+	Thresholds map[string]float64 `yaml:"thresholds"` // Maximum latencies as <operation>_<statistic>_ms (e.g., search_p95_ms: 50)
+
+	// Baseline Settings
+	Baseline           string  `yaml:"baseline"`              // File of the reference latencies and result codes; recorded by the first passing run
+	BaselineUpdate     bool    `yaml:"baseline_update"`       // Record the baseline from this run instead of comparing with it
+	BaselineTolerance  float64 `yaml:"baseline_tolerance"`    // Percent a test's latency may grow over the baseline
+	BaselineMinDeltaMS float64 `yaml:"baseline_min_delta_ms"` // Growth in ms below which a latency never counts as a regression
+	BaselineFail       bool    `yaml:"baseline_fail"`         // Fail the run on a regression instead of only flagging it
 
 	// Logging Settings
-	LogLevel  string `yaml:"log_level"`
-	LogFile   string `yaml:"log_file"`
-	Verbose   bool   `yaml:"verbose"`
+	LogLevel string `yaml:"log_level"`
+	LogFile  string `yaml:"log_file"`
+	Verbose  bool   `yaml:"verbose"`
 
 	// Cleanup Settings
 	Cleanup          bool   `yaml:"cleanup"`
 	CleanupOnSuccess bool   `yaml:"cleanup_on_success"`
+	CleanupMode      string `yaml:"cleanup_mode"` // tracked deletes the entries the run created, subtree everything found under the test OU
 	ListTestData     bool   `yaml:"list_test_data"`
 	CleanupOlderThan string `yaml:"cleanup_older_than"`
+	CleanupLDIFDir   string `yaml:"cleanup_ldif_dir"` // Where preserved test data is written as LDIF delete records (empty = disabled)
+	ExportTracked    string `yaml:"export_tracked"`   // JSON file the entries of preserved test data are exported to (empty = disabled)
+
+	// LDIF Apply Settings
+	ApplyLDIF            string `yaml:"apply_ldif"`              // LDIF changelog to apply and verify instead of running tests
+	ApplyContinueOnError bool   `yaml:"apply_continue_on_error"` // Keep applying records after a failure
+
+	// Snapshot Settings
+	SnapshotExcludeAttributes []string `yaml:"snapshot_exclude_attributes"` // Extra attributes to leave out of snapshots
+
+	// Random Operations Settings
+	RandomSeed     int64  `yaml:"random_seed"`     // Seed of the random suite (0 = new seed each run)
+	RandomDuration string `yaml:"random_duration"` // How long the random suite generates operations (e.g., "5m")
+
+	// Soak Settings
+	SoakConnections int    `yaml:"soak_connections"` // Number of long-lived connections kept bound by the soak suite
+	SoakDuration    string `yaml:"soak_duration"`    // How long the soak suite keeps them open (e.g., "4h")
+	SoakInterval    string `yaml:"soak_interval"`    // Pause between heartbeats on each connection (e.g., "5m")
+
+	// Synthetic Data Settings
+	Generate        int `yaml:"generate"`         // Number of synthetic users generated under the test OU before the tests (0 = none)
+	GenerateWorkers int `yaml:"generate_workers"` // Number of connections adding the generated entries at once
+
+	// Entry Templates
+	EntryTemplates map[string]EntryTemplate `yaml:"entry_templates"` // Object classes and attributes of the user and group entries the add suite and the generator create
+
+	// Schema Validation Settings
+	ValidateSchema bool `yaml:"validate_schema"` // Check the entries to add against the server schema before the tests, reporting violations as results
+
+	// Load Test Settings
+	LoadDuration     string         `yaml:"load_duration"`       // How long the loadtest suite generates load (e.g., "5m")
+	LoadConcurrency  int            `yaml:"load_concurrency"`    // Number of connections sending operations at once
+	LoadRate         float64        `yaml:"load_rate"`           // Target operations per second over all connections (0 = as fast as possible)
+	LoadMix          map[string]int `yaml:"load_mix"`            // Relative weight of bind, search, add and modify operations
+	LoadMaxErrorRate float64        `yaml:"load_max_error_rate"` // Error percentage above which an operation fails
+
+	// ACL Verification Settings
+	ACLMatrix []ACLIdentity `yaml:"acl_matrix"` // Expected access per identity, verified by the acl suite
 
 	// Report Settings
 	ReportFormat string `yaml:"report_format"`
+	ReportFile   string `yaml:"report_file"` // File the json, junit or html report is written to instead of stdout
+	CSVOut       string `yaml:"csv_out"`     // CSV file a row per test is appended to after each run or loop iteration
+	StreamJSON   string `yaml:"stream_json"` // Stream NDJSON test events to "-" (stdout), tcp://host:port or unix:///path
+	WebhookURL   string `yaml:"webhook_url"` // URL a JSON summary is POSTed to after each run or loop iteration
+
+	// History Settings
+	HistoryDB string `yaml:"history_db"` // SQLite database every run and loop iteration is recorded in, read by the history command
+
+	// Notification Settings
+	Notify NotifyConfig `yaml:"notify"` // Chat notifications after each run or loop iteration
+}
+
+// NotifyConfig configures the notifiers told about finished runs
+type NotifyConfig struct {
+	On    string      `yaml:"on"` // always or failure (a test failed or the run could not execute)
+	Slack SlackConfig `yaml:"slack"`
+	Email EmailConfig `yaml:"email"`
+}
+
+// SlackConfig configures the Slack notifier
+type SlackConfig struct {
+	Webhook string `yaml:"webhook"` // Incoming webhook URL the summary is posted to
+}
+
+// EmailConfig configures the email notifier, which sends the report over SMTP
+type EmailConfig struct {
+	SMTPHost     string   `yaml:"smtp_host"`     // SMTP server; email is disabled if empty
+	SMTPPort     int      `yaml:"smtp_port"`     // 587, or 465 with smtp_security tls, if unset
+	SMTPSecurity string   `yaml:"smtp_security"` // starttls (default), tls for implicit TLS, or none
+	Username     string   `yaml:"username"`      // SMTP user; no authentication if empty
+	Password     string   `yaml:"password"`
+	PasswordFile string   `yaml:"password_file"` // File containing the SMTP password, read instead of password
+	From         string   `yaml:"from"`
+	To           []string `yaml:"to"`     // Recipients, e.g. a distribution list
+	Attach       string   `yaml:"attach"` // html to attach the HTML report to the console report in the body
+	On           string   `yaml:"on"`     // always or failure, overriding notify.on (default: failure)
+}
+
+// ACLIdentity is an identity of the access matrix and the access it is expected to have
+type ACLIdentity struct {
+	Identity     string           `yaml:"identity"`      // Bind DN, or "anonymous"
+	Password     string           `yaml:"password"`      // Bind password
+	PasswordFile string           `yaml:"password_file"` // File containing the bind password
+	Expectations []ACLExpectation `yaml:"expectations"`
+}
+
+// ACLExpectation is the expected access of an identity to an entry or attribute
+type ACLExpectation struct {
+	DN        string `yaml:"dn"`
+	Attribute string `yaml:"attribute"` // Empty for the entry itself (read or none only)
+	Access    string `yaml:"access"`    // read, write or none
+}
+
+// Server is an LDAP server of the host list
+type Server struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port,omitempty"`     // 0 uses the port setting
+	Priority int    `yaml:"priority,omitempty"` // lower values are tried first
+}
+
+// HostList is the host setting. In YAML it is a single host name, or a list
+// of servers as "host", "host:port" or a mapping with host, port and priority:
+//
+//	host:
+//	  - ldap1.example.com
+//	  - ldap2.example.com:1389
+//	  - {host: ldap-dr.example.com, priority: 10}
+type HostList []Server
+
+// ParseHostList parses a comma-separated list of "host" or "host:port" entries
+func ParseHostList(s string) (HostList, error) {
+	var hosts HostList
+	for _, entry := range strings.Split(s, ",") {
+		server, err := parseServer(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, server)
+	}
+	return hosts, nil
+}
+
+// parseServer parses a "host" or "host:port" entry; IPv6 addresses with a
+// port are written in brackets, as in "[::1]:389"
+func parseServer(entry string) (Server, error) {
+	if entry == "" {
+		return Server{}, fmt.Errorf("empty host")
+	}
+	host, port, err := net.SplitHostPort(entry)
+	if err != nil {
+		return Server{Host: strings.Trim(entry, "[]")}, nil // no port
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 || p > 65535 {
+		return Server{}, fmt.Errorf("invalid port in host %q", entry)
+	}
+	return Server{Host: host, Port: p}, nil
+}
+
+// SuiteList is the test_suite setting: a suite name, or several separated by
+// commas. In YAML it may also be a list of names.
+type SuiteList string
+
+// UnmarshalYAML accepts a suite name, a comma-separated list or a YAML list
+func (s *SuiteList) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*s = SuiteList(node.Value)
+		return nil
+	case yaml.SequenceNode:
+		names := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: test_suite entries must be suite names", item.Line)
+			}
+			names = append(names, item.Value)
+		}
+		*s = SuiteList(strings.Join(names, ","))
+		return nil
+	default:
+		return fmt.Errorf("line %d: test_suite must be a suite name or a list of them", node.Line)
+	}
+}
+
+// Names returns the selected suite names, in the order given
+func (s SuiteList) Names() []string {
+	names := strings.Split(string(s), ",")
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+	}
+	return names
+}
+
+// Has reports whether the suite is selected by name
+func (s SuiteList) Has(suite string) bool {
+	return slices.Contains(s.Names(), suite)
+}
+
+// UnmarshalYAML accepts a single host name or a list of servers
+func (h *HostList) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		server, err := parseServer(node.Value)
+		if err != nil {
+			return err
+		}
+		*h = HostList{server}
+		return nil
+	case yaml.SequenceNode:
+		hosts := make(HostList, 0, len(node.Content))
+		for _, item := range node.Content {
+			var server Server
+			if item.Kind == yaml.ScalarNode {
+				var err error
+				if server, err = parseServer(item.Value); err != nil {
+					return err
+				}
+			} else if err := item.Decode(&server); err != nil {
+				return err
+			}
+			hosts = append(hosts, server)
+		}
+		*h = hosts
+		return nil
+	default:
+		return fmt.Errorf("line %d: host must be a host name or a list of servers", node.Line)
+	}
+}
+
+// MarshalYAML writes a single server without port or priority as a plain
+// host name, so the config hash of single-server setups is unchanged
+func (h HostList) MarshalYAML() (interface{}, error) {
+	if len(h) == 1 && h[0].Port == 0 && h[0].Priority == 0 {
+		return h[0].Host, nil
+	}
+	return []Server(h), nil
+}
+
+// String returns the servers as a comma-separated list, for logging
+func (h HostList) String() string {
+	entries := make([]string, len(h))
+	for i, server := range h {
+		entries[i] = server.Host
+		if server.Port != 0 {
+			entries[i] = net.JoinHostPort(server.Host, strconv.Itoa(server.Port))
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+// DefaultTestOUTemplate is the test OU name used unless test_ou_template is set
+const DefaultTestOUTemplate = "{{.Prefix}}-{{.Timestamp}}-{{.ShortRunID}}"
+
+// TestOUNameData holds the fields available to test_ou_template
+type TestOUNameData struct {
+	Prefix     string // test_prefix
+	RunID      string // run ID of the invocation, shared by all loop iterations
+	ShortRunID string // first 8 characters of the run ID
+	Hostname   string // host the tool runs on
+	Timestamp  string // start of the run, e.g. 20251103-143045
+}
+
+// IsAnonymous reports whether the identity binds anonymously
+func (a ACLIdentity) IsAnonymous() bool {
+	return a.Identity == "" || strings.EqualFold(a.Identity, "anonymous")
 }
 
 // DefaultConfig returns a Config with sensible defaults
 func DefaultConfig() *Config {
 	return &Config{
-		Host:         "localhost",
-		Port:         389,
-		UseTLS:       false,
-		StartTLS:     false,
-		Timeout:      30,
-		TestPrefix:   "ldap-test",
-		Concurrent:   1,
-		TestSuite:    "all",
-		LogLevel:     "info",
-		LogFile:      fmt.Sprintf("./logs/ldap-test-%s.log", time.Now().Format("2006-01-02-15-04-05")),
-		Verbose:      false,
-		Cleanup:      false,
-		ReportFormat: "console",
+		Host:                HostList{{Host: "localhost"}},
+		Port:                389,
+		UseTLS:              false,
+		StartTLS:            false,
+		Timeout:             30,
+		BindMethod:          "simple",
+		ReferralCredentials: "anonymous",
+		TestPrefix:          "ldap-test",
+		TestOUTemplate:      DefaultTestOUTemplate,
+		Concurrent:          1,
+		TestSuite:           "all",
+		LogLevel:            "info",
+		LogFile:             fmt.Sprintf("./logs/ldap-test-%s.log", time.Now().Format("2006-01-02-15-04-05")),
+		Verbose:             false,
+		Cleanup:             false,
+		ReportFormat:        "console",
+		StateDir:            "./state",
+		CleanupLDIFDir:      "./cleanup",
+
+		RandomDuration:   "1m",
+		SoakConnections:  3,
+		SoakDuration:     "2h",
+		SoakInterval:     "5m",
+		GenerateWorkers:  4,
+		LoadDuration:     "1m",
+		LoadConcurrency:  4,
+		LoadMaxErrorRate: 1,
+		LockStaleAfter:   "1h",
+
+		RetryBackoff: "500ms",
+		RetryCodes:   slices.Clone(DefaultRetryCodes),
+
+		BaselineTolerance:  20,
+		BaselineMinDeltaMS: 5,
+
+		BinaryAttribute:     "jpegPhoto",
+		BinaryAttributeSize: 64 * 1024,
 	}
 }
 
@@ -94,24 +455,92 @@ func LoadFromFile(path string) (*Config, error) {
 
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
-	if c.Host == "" {
+	if len(c.Host) == 0 {
 		return fmt.Errorf("host is required")
 	}
+	for _, server := range c.Host {
+		if server.Host == "" {
+			return fmt.Errorf("host is required for every server of the host list")
+		}
+		if server.Port < 0 || server.Port > 65535 {
+			return fmt.Errorf("port of host %s must be between 1 and 65535", server.Host)
+		}
+	}
 	if c.Port <= 0 || c.Port > 65535 {
 		return fmt.Errorf("port must be between 1 and 65535")
 	}
-	if c.BindDN == "" {
-		return fmt.Errorf("bind DN is required")
-	}
-	if c.BindPassword == "" {
-		return fmt.Errorf("bind password is required")
-	}
 	if c.BaseDN == "" {
 		return fmt.Errorf("base DN is required")
 	}
+	if (c.TLSClientCertFile == "") != (c.TLSClientKeyFile == "") {
+		return fmt.Errorf("tls_client_cert_file and tls_client_key_file must be set together")
+	}
+	if c.TLSClientCertFile != "" && c.KeyStorePath != "" {
+		return fmt.Errorf("cannot use both tls_client_cert_file and key_store_path")
+	}
+	if c.HasClientCertificate() && !c.UseTLS && !c.StartTLS {
+		return fmt.Errorf("a client certificate requires TLS or StartTLS")
+	}
+	if c.ProxyAuthzID != "" && !strings.HasPrefix(c.ProxyAuthzID, "dn:") && !strings.HasPrefix(c.ProxyAuthzID, "u:") {
+		return fmt.Errorf("invalid proxy_authz_id: %q (must start with dn: or u:)", c.ProxyAuthzID)
+	}
+	switch c.ProxyAuthzExpect {
+	case "", "allow", "deny":
+	default:
+		return fmt.Errorf("invalid proxy_authz_expect: %s (must be allow or deny)", c.ProxyAuthzExpect)
+	}
+	if c.ProxyAuthzExpect != "" && c.ProxyAuthzID == "" {
+		return fmt.Errorf("proxy_authz_expect requires proxy_authz_id")
+	}
+	if c.BinaryAttribute == "" {
+		return fmt.Errorf("binary_attribute cannot be empty")
+	}
+	if c.BinaryAttributeSize < 1 {
+		return fmt.Errorf("binary attribute size must be at least 1 byte: %d", c.BinaryAttributeSize)
+	}
+	for _, attribute := range []string{"objectClass", "cn", "sn"} {
+		if strings.EqualFold(c.UniqueAttribute, attribute) {
+			return fmt.Errorf("invalid unique_attribute: %s is set by the uniqueness test itself", c.UniqueAttribute)
+		}
+	}
+	// Only a simple bind needs bind_dn and bind_password; Kerberos
+	// authenticates with a keytab or credentials cache, EXTERNAL with the
+	// client certificate
+	switch c.BindMethod {
+	case "simple":
+		if c.BindDN == "" {
+			return fmt.Errorf("bind DN is required")
+		}
+		if c.BindPassword == "" {
+			return fmt.Errorf("bind password is required")
+		}
+	case "gssapi":
+		if c.KerberosKeytab != "" && (c.KerberosUser == "" || c.KerberosRealm == "") {
+			return fmt.Errorf("kerberos_keytab requires kerberos_user and kerberos_realm")
+		}
+	case "external":
+		if !c.HasClientCertificate() {
+			return fmt.Errorf("bind method external requires a client certificate (tls_client_cert_file or key_store_path)")
+		}
+	default:
+		return fmt.Errorf("invalid bind method: %s (must be simple, gssapi or external)", c.BindMethod)
+	}
+	switch c.ReferralCredentials {
+	case "", "anonymous", "reuse":
+	default:
+		return fmt.Errorf("invalid referral_credentials: %s (must be anonymous or reuse)", c.ReferralCredentials)
+	}
 	if c.UseTLS && c.StartTLS {
 		return fmt.Errorf("cannot use both TLS and StartTLS")
 	}
+	if c.TLSPinnedCertSHA256 != "" {
+		if !c.UseTLS && !c.StartTLS {
+			return fmt.Errorf("certificate pinning requires TLS or StartTLS")
+		}
+		if pin, err := hex.DecodeString(c.PinnedCertSHA256()); err != nil || len(pin) != sha256.Size {
+			return fmt.Errorf("invalid pinned certificate hash: %s (must be a hex SHA-256)", c.TLSPinnedCertSHA256)
+		}
+	}
 
 	// Validate log level
 	validLogLevels := map[string]bool{
@@ -127,38 +556,739 @@ func (c *Config) Validate() error {
 
 	// Validate test suite
 	validTestSuites := map[string]bool{
-		"all":      true,
-		"bind":     true,
-		"search":   true,
-		"add":      true,
-		"modify":   true,
-		"compare":  true,
-		"modifydn": true,
-		"delete":   true,
-		"abandon":  true,
+		"all":          true,
+		"bind":         true,
+		"schema":       true,
+		"search":       true,
+		"add":          true,
+		"modify":       true,
+		"compare":      true,
+		"modifydn":     true,
+		"group":        true,
+		"groups":       true,
+		"posix":        true,
+		"unicode":      true,
+		"escaping":     true,
+		"delete":       true,
+		"lifecycle":    true,
+		"extended":     true,
+		"ad":           true,
+		"abandon":      true,
+		"notification": true,
+		"sync":         true,
+		"referral":     true,
+		"starttls":     true,
+		"tls":          true,
+		"acl":          true,
+		"unbind":       true,
+		"ldif":         true,
+		"fuzz":         true,
+		"berfuzz":      true,
+		"chaos":        true,
+		"random":       true,
+		"soak":         true,
+		"loadtest":     true,
+	}
+	seen := make(map[string]bool)
+	for _, suite := range c.TestSuite.Names() {
+		if !validTestSuites[suite] {
+			return fmt.Errorf("invalid test suite: %q", suite)
+		}
+		if seen[suite] {
+			return fmt.Errorf("test suite %s is selected twice", suite)
+		}
+		seen[suite] = true
+	}
+	if _, err := regexp.Compile(c.RunFilter); err != nil {
+		return fmt.Errorf("invalid run filter: %w", err)
+	}
+	if _, err := regexp.Compile(c.SkipFilter); err != nil {
+		return fmt.Errorf("invalid skip filter: %w", err)
+	}
+	if c.TestSuite.Has("ldif") && c.LDIFFile == "" {
+		return fmt.Errorf("the ldif suite requires ldif_file")
+	}
+	if c.LDIFFile != "" && !c.TestSuite.Has("all") && !c.TestSuite.Has("ldif") {
+		return fmt.Errorf("ldif_file is only loaded by the all and ldif suites, not %s", c.TestSuite)
+	}
+
+	if !isPlainRDNValue(c.ReuseTestOU) {
+		return fmt.Errorf("invalid reuse test OU: %s (must be a plain OU name, not a DN)", c.ReuseTestOU)
+	}
+	if c.ReuseTestOU == "" {
+		// Render two runs that differ in every field to catch names that would collide
+		first, err := c.TestOUName(TestOUNameData{RunID: "run-a", ShortRunID: "run-a", Hostname: "host-a", Timestamp: "20060102-150405"})
+		if err != nil {
+			return err
+		}
+		second, err := c.TestOUName(TestOUNameData{RunID: "run-a", ShortRunID: "run-a", Hostname: "host-a", Timestamp: "20060102-150406"})
+		if err != nil {
+			return err
+		}
+		if first == second && c.Loop && !c.Cleanup {
+			return fmt.Errorf("test OU template must include {{.Timestamp}} in loop mode without cleanup, or every iteration uses the same OU")
+		}
+	}
+
+	if c.HealthAddr != "" && !c.Loop {
+		return fmt.Errorf("health endpoint is only available in loop mode")
+	}
+	if c.Schedule != "" {
+		if _, err := schedule.Parse(c.Schedule); err != nil {
+			return err
+		}
+		if c.LoopDelay > 0 {
+			return fmt.Errorf("cannot use both schedule and loop_delay: the schedule sets when each iteration starts")
+		}
+		if c.LoopJitter > 0 {
+			return fmt.Errorf("cannot use both schedule and loop_jitter: the schedule sets when each iteration starts")
+		}
+	}
+	if c.LoopJitter < 0 {
+		return fmt.Errorf("loop jitter cannot be negative: %d", c.LoopJitter)
+	}
+	if c.StatsWindow != "" {
+		if d, err := time.ParseDuration(c.StatsWindow); err != nil || d <= 0 {
+			return fmt.Errorf("invalid stats window: %s", c.StatsWindow)
+		}
+	}
+	if c.RunLogDir != "" && !c.Loop {
+		return fmt.Errorf("run_log_dir is only available in loop mode")
+	}
+	if c.LoopStatsFile != "" && !c.Loop {
+		return fmt.Errorf("loop_stats_file is only available in loop mode")
+	}
+	if c.Serve != "" && c.HealthAddr != "" {
+		return fmt.Errorf("cannot use both serve and health_addr: serve mode also serves /healthz and /last-run")
+	}
+	if c.Resume != "" && c.Loop {
+		return fmt.Errorf("cannot resume a run in loop mode")
+	}
+	if c.DryRunLDIF != "" {
+		if !c.DryRun {
+			return fmt.Errorf("dry_run_ldif requires dry_run")
+		}
+		if c.Loop {
+			return fmt.Errorf("dry_run_ldif is not available in loop mode")
+		}
+		if c.DryRunLDIF == "-" && (c.StreamJSON == "-" || (c.ReportFormat != "console" && c.ReportFile == "")) {
+			return fmt.Errorf("dry_run_ldif and the event stream or report cannot both be written to stdout")
+		}
+	}
+
+	// Validate concurrency
+	if c.Concurrent < 1 {
+		return fmt.Errorf("concurrent must be at least 1: %d", c.Concurrent)
+	}
+	if c.Resume != "" && c.Concurrent > 1 {
+		return fmt.Errorf("cannot resume a run with concurrent workers")
+	}
+
+	if c.Generate < 0 {
+		return fmt.Errorf("generate cannot be negative: %d", c.Generate)
+	}
+	if c.GenerateWorkers < 1 {
+		return fmt.Errorf("generate workers must be at least 1: %d", c.GenerateWorkers)
+	}
+	if err := c.validateEntryTemplates(); err != nil {
+		return err
+	}
+
+	switch c.CleanupMode {
+	case "", "tracked", "subtree":
+	default:
+		return fmt.Errorf("invalid cleanup_mode: %s (must be tracked or subtree)", c.CleanupMode)
+	}
+
+	// Validate read-only mode, which must not send a single write
+	if c.ReadOnly {
+		for _, suite := range c.TestSuite.Names() {
+			if WritesToDirectory(suite) {
+				return fmt.Errorf("the %s suite writes to the directory and cannot run in read-only mode", suite)
+			}
+		}
+		switch {
+		case c.LDIFFile != "":
+			return fmt.Errorf("cannot load ldif_file in read-only mode")
+		case c.Generate > 0:
+			return fmt.Errorf("cannot generate synthetic data in read-only mode")
+		case c.Concurrent > 1:
+			return fmt.Errorf("cannot use concurrent workers in read-only mode: each worker creates an OU of its own")
+		case c.Lock:
+			return fmt.Errorf("cannot hold a lock in read-only mode: the lock is an entry under the base DN")
+		case c.ApplyLDIF != "":
+			return fmt.Errorf("cannot apply an LDIF changelog in read-only mode")
+		case c.CleanupOlderThan != "":
+			return fmt.Errorf("cannot remove old test OUs in read-only mode")
+		case c.CleanupMode == "subtree":
+			return fmt.Errorf("cannot use cleanup_mode subtree in read-only mode: the tests work under an existing entry")
+		}
+	}
+
+	// Validate time budgets
+	if c.MaxRunDuration != "" {
+		if _, err := time.ParseDuration(c.MaxRunDuration); err != nil {
+			return fmt.Errorf("invalid max run duration: %s", c.MaxRunDuration)
+		}
+	}
+	if c.Retries < 0 {
+		return fmt.Errorf("retries cannot be negative: %d", c.Retries)
+	}
+	if c.RetryBackoff != "" {
+		if d, err := time.ParseDuration(c.RetryBackoff); err != nil || d < 0 {
+			return fmt.Errorf("invalid retry backoff: %s", c.RetryBackoff)
+		}
+	}
+	for _, code := range c.RetryCodes {
+		if code <= 0 {
+			return fmt.Errorf("invalid retry code %d: must be an LDAP result code other than success", code)
+		}
+	}
+	if c.LockStaleAfter != "" {
+		if d, err := time.ParseDuration(c.LockStaleAfter); err != nil || d <= 0 {
+			return fmt.Errorf("invalid lock stale duration: %s", c.LockStaleAfter)
+		}
+	}
+	if c.CleanupOlderThan != "" {
+		if d, err := ParseAge(c.CleanupOlderThan); err != nil || d <= 0 {
+			return fmt.Errorf("invalid cleanup age: %s (use e.g. 7d, 24h or 30m)", c.CleanupOlderThan)
+		}
+		if c.TestPrefix == "" {
+			return fmt.Errorf("cleanup_older_than requires a test_prefix: only OUs named after it are removed")
+		}
+	}
+	if c.RandomDuration != "" {
+		if d, err := time.ParseDuration(c.RandomDuration); err != nil || d <= 0 {
+			return fmt.Errorf("invalid random duration: %s", c.RandomDuration)
+		}
+	}
+	if c.SoakConnections < 1 {
+		return fmt.Errorf("soak connections must be at least 1")
+	}
+	if c.SoakDuration != "" {
+		if d, err := time.ParseDuration(c.SoakDuration); err != nil || d <= 0 {
+			return fmt.Errorf("invalid soak duration: %s", c.SoakDuration)
+		}
 	}
-	if !validTestSuites[c.TestSuite] {
-		return fmt.Errorf("invalid test suite: %s", c.TestSuite)
+	if c.SoakInterval != "" {
+		if d, err := time.ParseDuration(c.SoakInterval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid soak interval: %s", c.SoakInterval)
+		}
+	}
+	if c.GetSoakInterval() > c.GetSoakDuration() {
+		return fmt.Errorf("soak interval %s is longer than the soak duration %s", c.SoakInterval, c.SoakDuration)
+	}
+	if c.LoadDuration != "" {
+		if d, err := time.ParseDuration(c.LoadDuration); err != nil || d <= 0 {
+			return fmt.Errorf("invalid load duration: %s", c.LoadDuration)
+		}
+	}
+	if c.LoadConcurrency < 1 {
+		return fmt.Errorf("load concurrency must be at least 1")
+	}
+	if c.LoadRate < 0 {
+		return fmt.Errorf("load rate cannot be negative: %g", c.LoadRate)
+	}
+	if c.LoadMaxErrorRate < 0 || c.LoadMaxErrorRate > 100 {
+		return fmt.Errorf("load max error rate must be between 0 and 100: %g", c.LoadMaxErrorRate)
+	}
+	if len(c.LoadMix) > 0 {
+		validLoadOperations := map[string]bool{
+			"bind":   true,
+			"search": true,
+			"add":    true,
+			"modify": true,
+		}
+		total := 0
+		for op, weight := range c.LoadMix {
+			if !validLoadOperations[op] {
+				return fmt.Errorf("invalid operation in load mix: %s (must be bind, search, add or modify)", op)
+			}
+			if weight < 0 {
+				return fmt.Errorf("invalid weight in load mix: %s=%d", op, weight)
+			}
+			total += weight
+		}
+		if total == 0 {
+			return fmt.Errorf("load mix has no operation with a weight above 0")
+		}
+	}
+	for suite, timeout := range c.SuiteTimeouts {
+		if !validTestSuites[suite] || suite == "all" {
+			return fmt.Errorf("invalid suite in suite timeouts: %s", suite)
+		}
+		if _, err := time.ParseDuration(timeout); err != nil {
+			return fmt.Errorf("invalid timeout for suite %s: %s", suite, timeout)
+		}
+	}
+	for key, limit := range c.Thresholds {
+		if _, _, err := ParseThreshold(key); err != nil {
+			return err
+		}
+		if limit <= 0 {
+			return fmt.Errorf("invalid threshold %s: %g (must be above 0)", key, limit)
+		}
+	}
+	if c.BaselineUpdate && c.Baseline == "" {
+		return fmt.Errorf("baseline_update requires a baseline file")
+	}
+	if c.BaselineTolerance < 0 {
+		return fmt.Errorf("baseline tolerance cannot be negative: %g", c.BaselineTolerance)
+	}
+	if c.BaselineMinDeltaMS < 0 {
+		return fmt.Errorf("baseline minimum delta cannot be negative: %g", c.BaselineMinDeltaMS)
+	}
+
+	// Validate access matrix
+	for _, identity := range c.ACLMatrix {
+		if !identity.IsAnonymous() && identity.Password == "" && identity.PasswordFile == "" {
+			return fmt.Errorf("acl matrix identity %s needs a password or password_file", identity.Identity)
+		}
+		for _, expectation := range identity.Expectations {
+			if expectation.DN == "" {
+				return fmt.Errorf("acl matrix expectation of %s is missing a dn", identity.Identity)
+			}
+			switch expectation.Access {
+			case "read", "none":
+			case "write":
+				if expectation.Attribute == "" {
+					return fmt.Errorf("acl matrix write expectation of %s on %s needs an attribute", identity.Identity, expectation.DN)
+				}
+			default:
+				return fmt.Errorf("invalid access in acl matrix: %s (must be read, write, or none)", expectation.Access)
+			}
+		}
 	}
 
 	// Validate report format
 	validReportFormats := map[string]bool{
 		"console": true,
 		"json":    true,
-		"xml":     true,
+		"junit":   true,
+		"xml":     true, // alias of junit
+		"html":    true,
 	}
 	if !validReportFormats[c.ReportFormat] {
-		return fmt.Errorf("invalid report format: %s (must be console, json, or xml)", c.ReportFormat)
+		return fmt.Errorf("invalid report format: %s (must be console, json, junit, xml, or html)", c.ReportFormat)
+	}
+	if c.ReportFile != "" && c.ReportFormat == "console" {
+		return fmt.Errorf("report file requires the json, junit or html report format")
+	}
+	if c.ReportFormat != "console" && c.ReportFile == "" && c.StreamJSON == "-" {
+		return fmt.Errorf("cannot write both the %s report and the event stream to stdout; set a report file", c.ReportFormat)
+	}
+
+	// Validate event stream target
+	if c.StreamJSON != "" && c.StreamJSON != "-" &&
+		!strings.HasPrefix(c.StreamJSON, "tcp://") && !strings.HasPrefix(c.StreamJSON, "unix://") {
+		return fmt.Errorf("invalid stream target: %s (must be -, tcp://host:port, or unix:///path)", c.StreamJSON)
+	}
+	if c.WebhookURL != "" && !validWebhookURL(c.WebhookURL) {
+		return fmt.Errorf("invalid webhook URL: must be an http:// or https:// URL")
+	}
+	if c.Notify.Slack.Webhook != "" && !validWebhookURL(c.Notify.Slack.Webhook) {
+		return fmt.Errorf("invalid Slack webhook: must be an http:// or https:// URL")
+	}
+	if c.Notify.On != "" && c.Notify.On != "always" && c.Notify.On != "failure" {
+		return fmt.Errorf("invalid notify.on: %s (must be always or failure)", c.Notify.On)
+	}
+	if email := c.Notify.Email; email.SMTPHost != "" {
+		if email.SMTPPort < 0 || email.SMTPPort > 65535 {
+			return fmt.Errorf("invalid SMTP port: %d", email.SMTPPort)
+		}
+		if email.SMTPSecurity != "" && email.SMTPSecurity != "starttls" && email.SMTPSecurity != "tls" && email.SMTPSecurity != "none" {
+			return fmt.Errorf("invalid SMTP security: %s (must be starttls, tls, or none)", email.SMTPSecurity)
+		}
+		if _, err := mail.ParseAddress(email.From); err != nil {
+			return fmt.Errorf("invalid email sender %q: %w", email.From, err)
+		}
+		if len(email.To) == 0 {
+			return fmt.Errorf("email notification requires at least one recipient (notify.email.to)")
+		}
+		for _, to := range email.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				return fmt.Errorf("invalid email recipient %q: %w", to, err)
+			}
+		}
+		if email.Attach != "" && email.Attach != "html" {
+			return fmt.Errorf("invalid email attachment: %s (must be html)", email.Attach)
+		}
+		if email.On != "" && email.On != "always" && email.On != "failure" {
+			return fmt.Errorf("invalid notify.email.on: %s (must be always or failure)", email.On)
+		}
+	}
+
+	return nil
+}
+
+// GetCleanupOlderThan returns the age of test OUs removed by cleanup_older_than
+func (c *Config) GetCleanupOlderThan() time.Duration {
+	d, _ := ParseAge(c.CleanupOlderThan)
+	return d
+}
+
+// ParseAge parses a duration that may start with a number of days, such as
+// "7d", "1d12h" or "24h"; anything after the days uses time.ParseDuration
+func ParseAge(s string) (time.Duration, error) {
+	days, rest, found := strings.Cut(s, "d")
+	if !found {
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.Atoi(days)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number of days in %q", s)
+	}
+	d := time.Duration(n) * 24 * time.Hour
+	if rest != "" {
+		r, err := time.ParseDuration(rest)
+		if err != nil {
+			return 0, err
+		}
+		d += r
+	}
+	return d, nil
+}
+
+// GetMaxRunDuration returns the run time budget (0 = unlimited)
+func (c *Config) GetMaxRunDuration() time.Duration {
+	d, _ := time.ParseDuration(c.MaxRunDuration)
+	return d
+}
+
+// TestOUName renders test_ou_template; data.Prefix defaults to test_prefix
+func (c *Config) TestOUName(data TestOUNameData) (string, error) {
+	text := c.TestOUTemplate
+	if text == "" {
+		text = DefaultTestOUTemplate
+	}
+	tmpl, err := template.New("test_ou_template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid test OU template: %w", err)
+	}
+
+	if data.Prefix == "" {
+		data.Prefix = c.TestPrefix
+	}
+	var name strings.Builder
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("invalid test OU template: %w", err)
+	}
+	if name.Len() == 0 || !isPlainRDNValue(name.String()) {
+		return "", fmt.Errorf("invalid test OU template: renders %q, which is not a plain OU name", name.String())
+	}
+	return name.String(), nil
+}
+
+// isPlainRDNValue reports whether value can be used as an RDN value without escaping
+func isPlainRDNValue(value string) bool {
+	return !strings.ContainsAny(value, ",=+<>#;\\\"")
+}
+
+// ReusedTestOUDN returns the DN of the sandbox OU set by reuse_test_ou, or ""
+func (c *Config) ReusedTestOUDN() string {
+	if c.ReuseTestOU == "" {
+		return ""
+	}
+	return fmt.Sprintf("ou=%s,%s", c.ReuseTestOU, c.BaseDN)
+}
+
+// GetRandomDuration returns how long the random suite generates operations
+func (c *Config) GetRandomDuration() time.Duration {
+	d, err := time.ParseDuration(c.RandomDuration)
+	if err != nil {
+		return time.Minute
+	}
+	return d
+}
+
+// GetSoakDuration returns how long the soak suite keeps its connections, 2h if unset
+func (c *Config) GetSoakDuration() time.Duration {
+	d, err := time.ParseDuration(c.SoakDuration)
+	if err != nil {
+		return 2 * time.Hour
+	}
+	return d
+}
+
+// GetSoakInterval returns the pause between soak heartbeats, 5m if unset
+func (c *Config) GetSoakInterval() time.Duration {
+	d, err := time.ParseDuration(c.SoakInterval)
+	if err != nil {
+		return 5 * time.Minute
+	}
+	return d
+}
+
+// GetLoadDuration returns how long the loadtest suite generates load, 1m if unset
+func (c *Config) GetLoadDuration() time.Duration {
+	d, err := time.ParseDuration(c.LoadDuration)
+	if err != nil {
+		return time.Minute
+	}
+	return d
+}
+
+// GetLoadMix returns the weights of the loadtest operations, mostly searches
+// if unset
+func (c *Config) GetLoadMix() map[string]int {
+	if len(c.LoadMix) == 0 {
+		return map[string]int{"search": 70, "modify": 15, "add": 10, "bind": 5}
+	}
+	return c.LoadMix
+}
+
+// GetLockStaleAfter returns the age after which a run lock is stale, 1h if unset
+func (c *Config) GetLockStaleAfter() time.Duration {
+	d, err := time.ParseDuration(c.LockStaleAfter)
+	if err != nil {
+		return time.Hour
+	}
+	return d
+}
+
+// GetStatsWindow returns the window of the rolling statistics of scheduled
+// runs, 24h if unset
+func (c *Config) GetStatsWindow() time.Duration {
+	d, err := time.ParseDuration(c.StatsWindow)
+	if err != nil {
+		return 24 * time.Hour
+	}
+	return d
+}
+
+// GetNotifyOn returns when the notifiers are told about a run, always if unset
+func (c *Config) GetNotifyOn() string {
+	if c.Notify.On == "" {
+		return "always"
+	}
+	return c.Notify.On
+}
+
+// GetEmailOn returns when the report is emailed: notify.email.on, else
+// notify.on, else failure so a loop does not flood the list
+func (c *Config) GetEmailOn() string {
+	if c.Notify.Email.On != "" {
+		return c.Notify.Email.On
+	}
+	if c.Notify.On != "" {
+		return c.Notify.On
+	}
+	return "failure"
+}
+
+// GetSMTPPort returns the port of the SMTP server: smtp_port, else 465 for
+// implicit TLS and 587 for submission with STARTTLS
+func (c *Config) GetSMTPPort() int {
+	switch {
+	case c.Notify.Email.SMTPPort != 0:
+		return c.Notify.Email.SMTPPort
+	case c.Notify.Email.SMTPSecurity == "tls":
+		return 465
+	default:
+		return 587
+	}
+}
+
+// GetSMTPSecurity returns how the SMTP connection is secured, starttls if unset
+func (c *Config) GetSMTPSecurity() string {
+	if c.Notify.Email.SMTPSecurity == "" {
+		return "starttls"
+	}
+	return c.Notify.Email.SMTPSecurity
+}
+
+// validWebhookURL reports whether rawURL is an http or https URL with a host.
+// Errors leave the URL out since it often embeds a token.
+func validWebhookURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// writingSuites are the suites that add, modify or delete entries
+var writingSuites = []string{"add", "ldif", "modify", "modifydn", "group", "groups", "posix", "unicode", "escaping", "delete", "lifecycle", "extended", "ad", "sync", "referral", "acl", "random", "loadtest"}
+
+// WritesToDirectory reports whether a suite writes to the directory, so
+// read-only mode leaves it out of "all" and refuses it when selected
+func WritesToDirectory(suite string) bool {
+	return slices.Contains(writingSuites, suite)
+}
+
+// DefaultRetryCodes are the result codes retried unless retry_codes is set:
+// busy and unavailable, the only ones after which the server did nothing and a
+// test can safely run again. A network error (200) is not among them: the test
+// would be repeated on the same closed connection, and a write that reached
+// the server before the connection dropped fails as entryAlreadyExists or
+// attributeOrValueExists when repeated.
+var DefaultRetryCodes = []int{51, 52}
+
+// GetRetryPolicy returns how often and after which result codes a failed test
+// is retried, and the wait before the first retry
+func (c *Config) GetRetryPolicy() (retries int, backoff time.Duration, codes []int) {
+	backoff, err := time.ParseDuration(c.RetryBackoff)
+	if err != nil {
+		backoff = 500 * time.Millisecond
+	}
+	return c.Retries, backoff, c.RetryCodes
+}
+
+// GetTestFilters returns the compiled run and skip filters, nil if unset
+func (c *Config) GetTestFilters() (run, skip *regexp.Regexp) {
+	if c.RunFilter != "" {
+		run, _ = regexp.Compile(c.RunFilter)
+	}
+	if c.SkipFilter != "" {
+		skip, _ = regexp.Compile(c.SkipFilter)
+	}
+	return run, skip
+}
+
+// GetSuiteTimeout returns the time budget for a suite (0 = unlimited)
+func (c *Config) GetSuiteTimeout(suite string) time.Duration {
+	d, _ := time.ParseDuration(c.SuiteTimeouts[suite])
+	return d
+}
+
+// ThresholdStatistics are the latency statistics a threshold can limit
+var ThresholdStatistics = []string{"avg", "p50", "p90", "p95", "p99", "max"}
+
+// ParseThreshold splits a threshold key such as search_p95_ms into the
+// operation (search) and the statistic (p95) it limits
+func ParseThreshold(key string) (operation, statistic string, err error) {
+	name, ok := strings.CutSuffix(key, "_ms")
+	i := strings.LastIndex(name, "_")
+	if !ok || i < 1 {
+		return "", "", fmt.Errorf("invalid threshold: %s (must be <operation>_<statistic>_ms, e.g. search_p95_ms)", key)
+	}
+	operation, statistic = name[:i], name[i+1:]
+	if !slices.Contains(ThresholdStatistics, statistic) {
+		return "", "", fmt.Errorf("invalid statistic in threshold %s: %s (must be one of %s)", key, statistic, strings.Join(ThresholdStatistics, ", "))
+	}
+	return operation, statistic, nil
+}
+
+// GetKerberosConfig returns the krb5.conf used for GSSAPI binds
+func (c *Config) GetKerberosConfig() string {
+	if c.KerberosConfig != "" {
+		return c.KerberosConfig
+	}
+	if path := os.Getenv("KRB5_CONFIG"); path != "" {
+		return path
+	}
+	return "/etc/krb5.conf"
+}
+
+// GetKerberosCCache returns the credentials cache used for GSSAPI binds
+// without a keytab, the one kinit writes by default if unset
+func (c *Config) GetKerberosCCache() string {
+	if c.KerberosCCache != "" {
+		return c.KerberosCCache
+	}
+	if name := os.Getenv("KRB5CCNAME"); name != "" {
+		return strings.TrimPrefix(name, "FILE:")
 	}
+	return fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+}
+
+// GetKerberosSPN returns the service principal of an LDAP server for GSSAPI
+// binds, ldap/<host> if unset
+func (c *Config) GetKerberosSPN(host string) string {
+	if c.KerberosSPN != "" {
+		return c.KerberosSPN
+	}
+	return "ldap/" + host
+}
+
+// Hash returns a SHA-256 fingerprint of the effective configuration with
+// secrets removed, so reports can show whether two runs used the same settings
+func (c *Config) Hash() string {
+	redacted := *c
+	redacted.BindPassword = ""
+	redacted.TrustStorePassword = ""
+	redacted.KeyStorePassword = ""
+	redacted.Notify.Email.Password = ""
+	redacted.ACLMatrix = make([]ACLIdentity, len(c.ACLMatrix))
+	for i, identity := range c.ACLMatrix {
+		identity.Password = ""
+		redacted.ACLMatrix[i] = identity
+	}
+	redacted.LogFile = "" // timestamped by default
+	redacted.Resume = ""  // differs between attempts of the same run
+
+	data, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
 
+// LoadBindPasswordFile replaces the bind password with the contents of
+// bind_password_file, if one is set
+func (c *Config) LoadBindPasswordFile() error {
+	if c.BindPasswordFile == "" {
+		return nil
+	}
+	password, err := os.ReadFile(c.BindPasswordFile)
+	if err != nil {
+		return fmt.Errorf("failed to read bind password file: %w", err)
+	}
+	c.BindPassword = strings.TrimSpace(string(password))
+	return nil
+}
+
+// LoadSMTPPasswordFile replaces the SMTP password with the contents of
+// notify.email.password_file, if one is set
+func (c *Config) LoadSMTPPasswordFile() error {
+	if c.Notify.Email.PasswordFile == "" {
+		return nil
+	}
+	password, err := os.ReadFile(c.Notify.Email.PasswordFile)
+	if err != nil {
+		return fmt.Errorf("failed to read SMTP password file: %w", err)
+	}
+	c.Notify.Email.Password = strings.TrimSpace(string(password))
 	return nil
 }
 
-// GetAddress returns the full LDAP server address
+// HasClientCertificate reports whether a client certificate is configured,
+// as PEM files or as a PKCS12 key store
+func (c *Config) HasClientCertificate() bool {
+	return c.TLSClientCertFile != "" || c.KeyStorePath != ""
+}
+
+// PinnedCertSHA256 returns the certificate pin as lowercase hex without colons
+func (c *Config) PinnedCertSHA256() string {
+	return strings.ToLower(strings.ReplaceAll(c.TLSPinnedCertSHA256, ":", ""))
+}
+
+// GetAddress returns the full LDAP address of the first server of the host list
 func (c *Config) GetAddress() string {
+	servers := c.GetServers()
+	if len(servers) == 0 {
+		return ""
+	}
+	return c.ServerAddress(servers[0])
+}
+
+// GetServers returns the servers of the host list in the order they are
+// tried: by priority, then as listed, each with its port filled in
+func (c *Config) GetServers() []Server {
+	servers := make([]Server, len(c.Host))
+	copy(servers, c.Host)
+	for i := range servers {
+		if servers[i].Port == 0 {
+			servers[i].Port = c.Port
+		}
+	}
+	sort.SliceStable(servers, func(i, j int) bool { return servers[i].Priority < servers[j].Priority })
+	return servers
+}
+
+// ServerAddress returns the full LDAP address of a server of GetServers
+func (c *Config) ServerAddress(server Server) string {
 	protocol := "ldap"
 	if c.UseTLS {
 		protocol = "ldaps"
 	}
-	return fmt.Sprintf("%s://%s:%d", protocol, c.Host, c.Port)
+	return fmt.Sprintf("%s://%s", protocol, net.JoinHostPort(server.Host, strconv.Itoa(server.Port)))
 }
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// EntryTemplate shapes the entries of a kind the tests create, for sites whose
+// schema needs more than the built-in inetOrgPerson and groupOfNames entries
+type EntryTemplate struct {
+	ObjectClasses []string            `yaml:"object_classes"` // Replace the built-in object classes if set
+	Attributes    map[string][]string `yaml:"attributes"`     // Values added or replacing the built-in ones, as Go templates; an empty list removes an attribute
+}
+
+// entryTemplateKinds are the kinds of entries entry_templates can shape
+var entryTemplateKinds = []string{"user", "group"}
+
+// EntryTemplateData holds the fields available to the attribute values of an
+// entry template
+type EntryTemplateData struct {
+	CN         string
+	UID        string // empty for the test user, which is named by cn
+	GivenName  string
+	Surname    string
+	Mail       string
+	Domain     string // mail domain
+	Department string // empty for the test user and group
+	Index      int    // number of a generated entry, 1 for the test user and group
+}
+
+// sampleEntryTemplateData is rendered to validate the templates
+var sampleEntryTemplateData = EntryTemplateData{
+	CN:         "Anna Smith",
+	UID:        "anna.smith.1",
+	GivenName:  "Anna",
+	Surname:    "Smith",
+	Mail:       "anna.smith.1@example.com",
+	Domain:     "example.com",
+	Department: "Engineering",
+	Index:      1,
+}
+
+// EntryTemplate returns the entry template of kind, empty if none is configured
+func (c *Config) EntryTemplate(kind string) EntryTemplate {
+	return c.EntryTemplates[kind]
+}
+
+// Apply returns the attributes of an entry: the built-in attributes with the
+// object classes and attribute values of the template. The naming attribute
+// keeps its built-in values. rng drives the random and pick functions.
+func (t EntryTemplate) Apply(builtIn map[string][]string, naming string, data EntryTemplateData, rng *rand.Rand) (map[string][]string, error) {
+	attributes := make(map[string][]string, len(builtIn)+len(t.Attributes))
+	for name, values := range builtIn {
+		attributes[name] = values
+	}
+	if len(t.ObjectClasses) > 0 {
+		attributes["objectClass"] = t.ObjectClasses
+	}
+
+	names := make([]string, 0, len(t.Attributes))
+	for name := range t.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if strings.EqualFold(name, naming) {
+			continue
+		}
+		for existing := range attributes {
+			if strings.EqualFold(existing, name) {
+				delete(attributes, existing)
+			}
+		}
+		if len(t.Attributes[name]) == 0 {
+			continue
+		}
+
+		values := make([]string, 0, len(t.Attributes[name]))
+		for _, text := range t.Attributes[name] {
+			value, err := renderEntryValue(name, text, data, rng)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		attributes[name] = values
+	}
+	return attributes, nil
+}
+
+// renderEntryValue renders the template of an attribute value
+func renderEntryValue(name, text string, data EntryTemplateData, rng *rand.Rand) (string, error) {
+	funcs := template.FuncMap{
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		// random returns n random digits
+		"random": func(n int) (string, error) {
+			if n < 1 || n > 64 {
+				return "", fmt.Errorf("random takes 1 to 64 digits, not %d", n)
+			}
+			digits := make([]byte, n)
+			for i := range digits {
+				digits[i] = byte('0' + rng.Intn(10))
+			}
+			return string(digits), nil
+		},
+		// pick returns one of its arguments at random
+		"pick": func(choices ...string) (string, error) {
+			if len(choices) == 0 {
+				return "", fmt.Errorf("pick needs at least one value")
+			}
+			return choices[rng.Intn(len(choices))], nil
+		},
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid entry template value of %s: %w", name, err)
+	}
+	var value strings.Builder
+	if err := tmpl.Execute(&value, data); err != nil {
+		return "", fmt.Errorf("invalid entry template value of %s: %w", name, err)
+	}
+	return value.String(), nil
+}
+
+// validateEntryTemplates checks the kinds of entry_templates and renders
+// each of their values once
+func (c *Config) validateEntryTemplates() error {
+	kinds := make([]string, 0, len(c.EntryTemplates))
+	for kind := range c.EntryTemplates {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		tmpl := c.EntryTemplates[kind]
+		known := false
+		for _, k := range entryTemplateKinds {
+			known = known || k == kind
+		}
+		if !known {
+			return fmt.Errorf("invalid entry_templates kind: %s (must be %s)", kind, strings.Join(entryTemplateKinds, " or "))
+		}
+		for name := range tmpl.Attributes {
+			if name == "" {
+				return fmt.Errorf("entry_templates %s: attribute name cannot be empty", kind)
+			}
+			if strings.EqualFold(name, "objectClass") {
+				return fmt.Errorf("entry_templates %s: set object classes with object_classes, not as an attribute", kind)
+			}
+		}
+		if _, err := tmpl.Apply(nil, "", sampleEntryTemplateData, rand.New(rand.NewSource(1))); err != nil {
+			return fmt.Errorf("entry_templates %s: %w", kind, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"ldap-automated-actions/internal/logger"
+)
+
+// Status describes the most recent loop iteration
+type Status struct {
+	RunID      string    `json:"run_id"`
+	Iteration  int       `json:"iteration"`
+	Healthy    bool      `json:"healthy"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	DurationMS int64     `json:"duration_ms"`
+	Total      int       `json:"total"`
+	Passed     int       `json:"passed"`
+	Failed     int       `json:"failed"`
+	Skipped    int       `json:"skipped"`
+	Error      string    `json:"error,omitempty"`
+	Telemetry  Telemetry `json:"telemetry"`
+}
+
+// Telemetry is the resource usage of the tool itself, so long-running loops
+// can be checked for leaks in the monitor rather than the server
+type Telemetry struct {
+	HeapAllocBytes  uint64  `json:"heap_alloc_bytes"` // live heap objects
+	SysBytes        uint64  `json:"sys_bytes"`        // memory obtained from the OS
+	Goroutines      int     `json:"goroutines"`
+	OpenConnections int64   `json:"open_connections"` // LDAP connections not yet closed
+	GCCycles        uint32  `json:"gc_cycles"`
+	GCPauseTotalMS  float64 `json:"gc_pause_total_ms"`
+	LastGCPauseMS   float64 `json:"last_gc_pause_ms"`
+}
+
+// ReadTelemetry samples the runtime statistics of the process
+func ReadTelemetry(openConnections int64) Telemetry {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	t := Telemetry{
+		HeapAllocBytes:  m.HeapAlloc,
+		SysBytes:        m.Sys,
+		Goroutines:      runtime.NumGoroutine(),
+		OpenConnections: openConnections,
+		GCCycles:        m.NumGC,
+		GCPauseTotalMS:  float64(m.PauseTotalNs) / 1e6,
+	}
+	if m.NumGC > 0 {
+		t.LastGCPauseMS = float64(m.PauseNs[(m.NumGC+255)%256]) / 1e6
+	}
+	return t
+}
+
+// Server exposes the status of the most recent loop iteration over HTTP, so
+// container healthchecks can monitor the monitor:
+//
+//	/healthz   200 if the last iteration passed (or none has finished yet), 503 if it failed
+//	/last-run  the Status of the last iteration, with the tool's own telemetry, as JSON (404 until one has finished)
+//	/metrics   the Metrics of all iterations in the Prometheus text format, when served with metrics
+//	/runs      the Runs API, when served with runs: POST /runs requests a run, GET /runs lists
+//	           the runs, GET /runs/{id} returns one and GET /runs/{id}/results its JSON report
+//
+// A nil server ignores updates, so callers need not check whether it is enabled.
+type Server struct {
+	mu      sync.Mutex
+	last    *Status
+	started time.Time
+	server  *http.Server
+	metrics *Metrics
+	runs    *Runs
+}
+
+// Start listens on addr and serves the health endpoints in the background,
+// plus /metrics and the runs API if metrics and runs are not nil
+func Start(addr string, metrics *Metrics, runs *Runs) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	s := &Server{started: time.Now(), metrics: metrics, runs: runs}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/last-run", s.handleLastRun)
+	if metrics != nil {
+		mux.HandleFunc("/metrics", s.handleMetrics)
+	}
+	if runs != nil {
+		mux.HandleFunc("POST /runs", s.handleRequestRun)
+		mux.HandleFunc("GET /runs", s.handleListRuns)
+		mux.HandleFunc("GET /runs/{id}", s.handleGetRun)
+		mux.HandleFunc("GET /runs/{id}/results", s.handleGetRunResults)
+	}
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Health", "Health endpoint stopped", "error", err)
+		}
+	}()
+
+	logger.Info("Health", "Serving health endpoint", "addr", listener.Addr().String())
+	return s, nil
+}
+
+// Update records the status of the iteration that just finished
+func (s *Server) Update(status Status) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = &status
+}
+
+// Close stops the HTTP server
+func (s *Server) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	last := s.last
+	s.mu.Unlock()
+
+	switch {
+	case last == nil:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "starting", "since": s.started.Format(time.RFC3339)})
+	case last.Healthy:
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "iteration": last.Iteration})
+	default:
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "failing", "iteration": last.Iteration})
+	}
+}
+
+func (s *Server) handleLastRun(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	last := s.last
+	s.mu.Unlock()
+
+	if last == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"status": "no iteration has finished yet"})
+		return
+	}
+	writeJSON(w, http.StatusOK, last)
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Debug("Health", "Failed to write response", "error", err)
+	}
+}
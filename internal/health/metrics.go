@@ -0,0 +1,195 @@
+package health
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ldap-automated-actions/internal/logger"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the operation latency
+// histograms: from a fast search on a local server to a bind hitting a timeout
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram counts observations at or below each of latencyBuckets
+type histogram struct {
+	buckets []uint64 // cumulative, like the le buckets of the exposition format
+	count   uint64
+	sum     float64
+}
+
+func (h *histogram) observe(seconds float64) {
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// testKey identifies a test counter
+type testKey struct {
+	operation string
+	status    string
+}
+
+// Metrics accumulates the outcome of the loop iterations in the Prometheus
+// text format served on /metrics. Counters start at zero when the process
+// starts, as Prometheus expects. A nil Metrics ignores observations, so
+// callers need not check whether it is enabled.
+type Metrics struct {
+	mu               sync.Mutex
+	runs             map[string]uint64 // by result: passed, failed or error
+	tests            map[testKey]uint64
+	latencies        map[string]*histogram // by operation
+	connectionErrors int64
+	last             *Status
+}
+
+// NewMetrics returns empty metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		runs:      make(map[string]uint64),
+		tests:     make(map[testKey]uint64),
+		latencies: make(map[string]*histogram),
+	}
+}
+
+// ObserveTest records a test of operation with its status (pass, fail or
+// skip); the latency of tests that executed goes into the operation's histogram
+func (m *Metrics) ObserveTest(operation, status string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tests[testKey{operation, status}]++
+	if status == "skip" {
+		return
+	}
+	h := m.latencies[operation]
+	if h == nil {
+		h = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+		m.latencies[operation] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// ObserveRun records the iteration that just finished, with the number of
+// failed connection attempts of the process so far
+func (m *Metrics) ObserveRun(status Status, connectionErrors int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case status.Error != "":
+		m.runs["error"]++
+	case status.Healthy:
+		m.runs["passed"]++
+	default:
+		m.runs["failed"]++
+	}
+	m.connectionErrors = connectionErrors
+	m.last = &status
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	writeHeader(&b, "ldap_test_runs_total", "counter", "Loop iterations by result: passed, failed (a test failed) or error (the iteration could not run)")
+	for _, result := range []string{"passed", "failed", "error"} {
+		fmt.Fprintf(&b, "ldap_test_runs_total{result=%q} %d\n", result, m.runs[result])
+	}
+
+	writeHeader(&b, "ldap_test_tests_total", "counter", "Tests by operation and status: pass, fail or skip")
+	keys := make([]testKey, 0, len(m.tests))
+	for key := range m.tests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].operation != keys[j].operation {
+			return keys[i].operation < keys[j].operation
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, key := range keys {
+		fmt.Fprintf(&b, "ldap_test_tests_total{operation=\"%s\",status=\"%s\"} %d\n", escapeLabel(key.operation), key.status, m.tests[key])
+	}
+
+	writeHeader(&b, "ldap_test_operation_duration_seconds", "histogram", "Latency of the executed tests by operation")
+	operations := make([]string, 0, len(m.latencies))
+	for operation := range m.latencies {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+	for _, operation := range operations {
+		h := m.latencies[operation]
+		label := escapeLabel(operation)
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(&b, "ldap_test_operation_duration_seconds_bucket{operation=\"%s\",le=\"%s\"} %d\n", label, formatFloat(bound), h.buckets[i])
+		}
+		fmt.Fprintf(&b, "ldap_test_operation_duration_seconds_bucket{operation=\"%s\",le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(&b, "ldap_test_operation_duration_seconds_sum{operation=\"%s\"} %s\n", label, formatFloat(h.sum))
+		fmt.Fprintf(&b, "ldap_test_operation_duration_seconds_count{operation=\"%s\"} %d\n", label, h.count)
+	}
+
+	writeHeader(&b, "ldap_test_connection_errors_total", "counter", "Failed attempts to connect to an LDAP server")
+	fmt.Fprintf(&b, "ldap_test_connection_errors_total %d\n", m.connectionErrors)
+
+	if m.last != nil {
+		writeHeader(&b, "ldap_test_last_run_timestamp_seconds", "gauge", "Unix time the last iteration finished")
+		fmt.Fprintf(&b, "ldap_test_last_run_timestamp_seconds %s\n", formatFloat(float64(m.last.EndTime.UnixMilli())/1000))
+		writeHeader(&b, "ldap_test_last_run_success", "gauge", "1 if the last iteration passed, 0 if it failed")
+		success := 0
+		if m.last.Healthy {
+			success = 1
+		}
+		fmt.Fprintf(&b, "ldap_test_last_run_success %d\n", success)
+		writeHeader(&b, "ldap_test_last_run_duration_seconds", "gauge", "Duration of the last iteration")
+		fmt.Fprintf(&b, "ldap_test_last_run_duration_seconds %s\n", formatFloat(float64(m.last.DurationMS)/1000))
+		writeHeader(&b, "ldap_test_open_connections", "gauge", "LDAP connections of the tool left open after the last iteration")
+		fmt.Fprintf(&b, "ldap_test_open_connections %d\n", m.last.Telemetry.OpenConnections)
+		writeHeader(&b, "ldap_test_heap_alloc_bytes", "gauge", "Live heap of the tool after the last iteration")
+		fmt.Fprintf(&b, "ldap_test_heap_alloc_bytes %d\n", m.last.Telemetry.HeapAllocBytes)
+		writeHeader(&b, "ldap_test_goroutines", "gauge", "Goroutines of the tool after the last iteration")
+		fmt.Fprintf(&b, "ldap_test_goroutines %d\n", m.last.Telemetry.Goroutines)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// escapeLabel escapes a label value as the exposition format requires
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := s.metrics.WriteTo(w); err != nil {
+		logger.Debug("Health", "Failed to write metrics", "error", err)
+	}
+}
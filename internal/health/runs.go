@@ -0,0 +1,288 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxRuns is the number of finished runs the runs API keeps, oldest first out
+const maxRuns = 100
+
+// maxPending is the number of requested runs that may wait for the loop; a
+// request beyond it is refused with ErrQueueFull
+const maxPending = 10
+
+// ErrQueueFull is returned by Request while maxPending runs are queued
+var ErrQueueFull = fmt.Errorf("%d runs are already queued", maxPending)
+
+// RunRecord is a loop iteration as reported by the runs API
+type RunRecord struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`               // queued, running, passed, failed or error
+	Trigger    string     `json:"trigger"`              // api, loop or schedule
+	TestSuite  string     `json:"test_suite,omitempty"` // empty while a run of the configured suite is queued
+	Iteration  int        `json:"iteration,omitempty"`
+	QueuedAt   time.Time  `json:"queued_at"`
+	StartTime  *time.Time `json:"start_time,omitempty"`
+	EndTime    *time.Time `json:"end_time,omitempty"`
+	DurationMS int64      `json:"duration_ms,omitempty"`
+	Total      int        `json:"total"`
+	Passed     int        `json:"passed"`
+	Failed     int        `json:"failed"`
+	Skipped    int        `json:"skipped"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// finished reports whether the run has its results
+func (r *RunRecord) finished() bool {
+	return r.EndTime != nil
+}
+
+// Runs keeps the runs of serve mode for the runs API, and the runs requested
+// through it until the loop picks them up. A nil Runs ignores updates.
+type Runs struct {
+	mu       sync.Mutex
+	records  map[string]*RunRecord
+	order    []string // IDs in the order the runs were queued or started
+	results  map[string][]byte
+	pending  []string
+	trigger  chan struct{}
+	validate func(testSuite string) error
+}
+
+// NewRuns returns an empty run list; validate checks the test suite of a
+// requested run before it is queued
+func NewRuns(validate func(testSuite string) error) *Runs {
+	return &Runs{
+		records:  make(map[string]*RunRecord),
+		results:  make(map[string][]byte),
+		trigger:  make(chan struct{}, 1),
+		validate: validate,
+	}
+}
+
+// Triggered returns a channel that receives when a run is requested, so the
+// loop can stop waiting for its next iteration. A nil Runs never triggers.
+func (r *Runs) Triggered() <-chan struct{} {
+	if r == nil {
+		return nil
+	}
+	return r.trigger
+}
+
+// Request queues a run of testSuite, returning its record
+func (r *Runs) Request(testSuite string) (RunRecord, error) {
+	if err := r.validate(testSuite); err != nil {
+		return RunRecord{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) >= maxPending {
+		return RunRecord{}, ErrQueueFull
+	}
+	record := r.add("api", testSuite)
+	r.pending = append(r.pending, record.ID)
+
+	select {
+	case r.trigger <- struct{}{}:
+	default: // the loop has yet to pick up an earlier trigger
+	}
+	return *record, nil
+}
+
+// Next returns the ID and test suite of the oldest requested run, if any
+func (r *Runs) Next() (id, testSuite string, ok bool) {
+	if r == nil {
+		return "", "", false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) == 0 {
+		return "", "", false
+	}
+	id, r.pending = r.pending[0], r.pending[1:]
+	if len(r.pending) == 0 {
+		// Picked up without waiting, so the trigger must not start another run
+		select {
+		case <-r.trigger:
+		default:
+		}
+	}
+	return id, r.records[id].TestSuite, true
+}
+
+// Begin records an iteration the loop started on its own, returning its ID
+func (r *Runs) Begin(trigger, testSuite string) string {
+	if r == nil {
+		return ""
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.add(trigger, testSuite).ID
+}
+
+// add records a queued run and forgets the oldest finished runs beyond maxRuns
+func (r *Runs) add(trigger, testSuite string) *RunRecord {
+	record := &RunRecord{
+		ID:        uuid.NewString(),
+		Status:    "queued",
+		Trigger:   trigger,
+		TestSuite: testSuite,
+		QueuedAt:  time.Now(),
+	}
+	r.records[record.ID] = record
+	r.order = append(r.order, record.ID)
+
+	finished := 0
+	for _, id := range r.order {
+		if r.records[id].finished() {
+			finished++
+		}
+	}
+	for i := 0; i < len(r.order) && finished > maxRuns; {
+		id := r.order[i]
+		if !r.records[id].finished() {
+			i++
+			continue
+		}
+		delete(r.records, id)
+		delete(r.results, id)
+		r.order = append(r.order[:i], r.order[i+1:]...)
+		finished--
+	}
+	return record
+}
+
+// Start marks a run as running testSuite as iteration
+func (r *Runs) Start(id, testSuite string, iteration int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	record := r.records[id]
+	record.Status = "running"
+	record.TestSuite = testSuite
+	record.Iteration = iteration
+	record.StartTime = &now
+}
+
+// Finish records the outcome of a run and its JSON report
+func (r *Runs) Finish(id string, status Status, results []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record := r.records[id]
+	end := status.EndTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+	record.EndTime = &end
+	record.DurationMS = status.DurationMS
+	record.Total, record.Passed, record.Failed, record.Skipped = status.Total, status.Passed, status.Failed, status.Skipped
+	record.Error = status.Error
+	switch {
+	case status.Error != "":
+		record.Status = "error"
+	case status.Healthy:
+		record.Status = "passed"
+	default:
+		record.Status = "failed"
+	}
+	r.results[id] = results
+}
+
+// list returns copies of the records, oldest first
+func (r *Runs) list() []RunRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records := make([]RunRecord, 0, len(r.order))
+	for _, id := range r.order {
+		records = append(records, *r.records[id])
+	}
+	return records
+}
+
+// get returns a copy of a record and its JSON report, nil until it finished
+func (r *Runs) get(id string) (RunRecord, []byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[id]
+	if !ok {
+		return RunRecord{}, nil, false
+	}
+	return *record, r.results[id], true
+}
+
+// runRequest is the optional body of POST /runs
+type runRequest struct {
+	TestSuite string `json:"test_suite"` // suite to run instead of the configured one
+}
+
+func (s *Server) handleRequestRun(w http.ResponseWriter, r *http.Request) {
+	var request runRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	record, err := s.runs.Request(request.TestSuite)
+	if errors.Is(err, ErrQueueFull) {
+		w.Header().Set("Retry-After", "60")
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Location", "/runs/"+record.ID)
+	writeJSON(w, http.StatusAccepted, record)
+}
+
+func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.runs.list())
+}
+
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	record, _, ok := s.runs.get(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no such run"})
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
+
+func (s *Server) handleGetRunResults(w http.ResponseWriter, r *http.Request) {
+	record, results, ok := s.runs.get(r.PathValue("id"))
+	switch {
+	case !ok:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no such run"})
+	case !record.finished():
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "run has not finished", "status": record.Status})
+	case results == nil:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "run has no results", "status": record.Status})
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(results)
+	}
+}
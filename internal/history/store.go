@@ -0,0 +1,152 @@
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the pure Go "sqlite" driver
+)
+
+// schema creates the tables of a new database; statements must stay
+// idempotent since they run on every open
+const schema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	run_id       TEXT    NOT NULL,
+	iteration    INTEGER NOT NULL, -- 0 outside loop mode
+	hostname     TEXT    NOT NULL,
+	server       TEXT    NOT NULL,
+	tool_version TEXT    NOT NULL,
+	config_hash  TEXT    NOT NULL,
+	test_suite   TEXT    NOT NULL,
+	status       TEXT    NOT NULL, -- pass, fail, or error if the run could not execute
+	error        TEXT    NOT NULL,
+	interrupted  INTEGER NOT NULL,
+	start_time   INTEGER NOT NULL, -- Unix milliseconds
+	end_time     INTEGER NOT NULL,
+	duration_ms  INTEGER NOT NULL,
+	total        INTEGER NOT NULL,
+	passed       INTEGER NOT NULL,
+	failed       INTEGER NOT NULL,
+	skipped      INTEGER NOT NULL,
+	not_executed INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS runs_start_time ON runs (start_time);
+
+CREATE TABLE IF NOT EXISTS results (
+	run         INTEGER NOT NULL REFERENCES runs (id) ON DELETE CASCADE,
+	name        TEXT    NOT NULL,
+	operation   TEXT    NOT NULL,
+	worker      INTEGER NOT NULL, -- 0 when sequential
+	status      TEXT    NOT NULL, -- pass, fail or skip
+	started     INTEGER NOT NULL, -- Unix milliseconds
+	duration_us INTEGER NOT NULL,
+	result_code INTEGER,          -- NULL if not known
+	error       TEXT    NOT NULL,
+	message     TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS results_run ON results (run);
+`
+
+// Run is a run or loop iteration as stored in the history
+type Run struct {
+	RunID       string
+	Iteration   int
+	Hostname    string
+	Server      string
+	ToolVersion string
+	ConfigHash  string
+	TestSuite   string
+	Status      string // pass, fail, or error if the run could not execute
+	Error       string
+	Interrupted bool
+	StartTime   time.Time
+	EndTime     time.Time
+	Duration    time.Duration
+	Total       int
+	Passed      int
+	Failed      int
+	Skipped     int
+	NotExecuted int
+	Results     []Result
+}
+
+// Result is a test of a stored run
+type Result struct {
+	Name       string
+	Operation  string
+	Worker     int
+	Status     string // pass, fail or skip
+	Started    time.Time
+	Duration   time.Duration
+	ResultCode *int // LDAP result code, nil if not known
+	Error      string
+	Message    string
+}
+
+// Store is a SQLite database of run history
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it and its tables if needed
+func Open(path string) (*Store, error) {
+	// A daemon records while the history command reads, so wait for the
+	// other's lock rather than failing with SQLITE_BUSY
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open history database %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record stores a run and its results in one transaction
+func (s *Store) Record(run Run) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO runs (run_id, iteration, hostname, server, tool_version, config_hash, test_suite,
+		status, error, interrupted, start_time, end_time, duration_ms, total, passed, failed, skipped, not_executed)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.RunID, run.Iteration, run.Hostname, run.Server, run.ToolVersion, run.ConfigHash, run.TestSuite,
+		run.Status, run.Error, run.Interrupted, run.StartTime.UnixMilli(), run.EndTime.UnixMilli(), run.Duration.Milliseconds(),
+		run.Total, run.Passed, run.Failed, run.Skipped, run.NotExecuted)
+	if err != nil {
+		return fmt.Errorf("failed to insert run: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO results (run, name, operation, worker, status, started, duration_us, result_code, error, message)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, result := range run.Results {
+		started := result.Started
+		if started.IsZero() {
+			started = run.StartTime
+		}
+		if _, err := stmt.Exec(id, result.Name, result.Operation, result.Worker, result.Status, started.UnixMilli(),
+			result.Duration.Microseconds(), result.ResultCode, result.Error, result.Message); err != nil {
+			return fmt.Errorf("failed to insert result: %w", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,271 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Period is the outcome of the runs, or the executed tests of an operation,
+// that started in one period of the trends
+type Period struct {
+	Start    time.Time `json:"start"`
+	Count    int       `json:"count"` // runs, or executed tests
+	Passed   int       `json:"passed"`
+	Failed   int       `json:"failed"`
+	Errors   int       `json:"errors,omitempty"` // runs that could not execute
+	PassRate float64   `json:"pass_rate"`        // percent of Count
+	AvgMS    float64   `json:"avg_ms"`           // run duration, or test latency
+	P95MS    float64   `json:"p95_ms"`
+	MaxMS    float64   `json:"max_ms"`
+
+	durations []float64
+}
+
+// add records a run or test that passed or not, and its duration in ms
+func (p *Period) add(passed bool, ms float64) {
+	p.Count++
+	if passed {
+		p.Passed++
+	} else {
+		p.Failed++
+	}
+	p.durations = append(p.durations, ms)
+}
+
+// finish computes the pass rate and duration statistics
+func (p *Period) finish() {
+	if p.Count == 0 {
+		return
+	}
+	p.PassRate = round(float64(p.Passed) * 100 / float64(p.Count))
+	sort.Float64s(p.durations)
+	var sum float64
+	for _, d := range p.durations {
+		sum += d
+	}
+	p.AvgMS = round(sum / float64(len(p.durations)))
+	p.P95MS = round(p.durations[int(math.Ceil(0.95*float64(len(p.durations))))-1])
+	p.MaxMS = round(p.durations[len(p.durations)-1])
+	p.durations = nil
+}
+
+func round(f float64) float64 {
+	return math.Round(f*10) / 10
+}
+
+// Trend is the history of the runs or of an operation, period by period
+type Trend struct {
+	Operation string   `json:"operation,omitempty"` // empty for the runs
+	Periods   []Period `json:"periods"`
+	Overall   Period   `json:"overall"`
+	// Change from the first to the last period, in percentage points and ms
+	PassRateChange float64 `json:"pass_rate_change"`
+	P95Change      float64 `json:"p95_ms_change"`
+}
+
+// Trends is the pass rate and latency history since a point in time
+type Trends struct {
+	Since      time.Time `json:"since"`
+	Period     string    `json:"period"`
+	Runs       Trend     `json:"runs"`
+	Operations []Trend   `json:"operations"`
+}
+
+// trendBuilder groups runs or tests into periods
+type trendBuilder struct {
+	period  time.Duration
+	periods map[int64]*Period
+	overall Period
+}
+
+func newTrendBuilder(period time.Duration) *trendBuilder {
+	return &trendBuilder{period: period, periods: make(map[int64]*Period)}
+}
+
+func (b *trendBuilder) add(start time.Time, passed bool, ms float64) *Period {
+	periodStart := start.Truncate(b.period)
+	p := b.periods[periodStart.UnixMilli()]
+	if p == nil {
+		p = &Period{Start: periodStart}
+		b.periods[periodStart.UnixMilli()] = p
+	}
+	p.add(passed, ms)
+	b.overall.add(passed, ms)
+	return p
+}
+
+// trend returns the periods in order; the overall period starts at since
+func (b *trendBuilder) trend(operation string, since time.Time) Trend {
+	t := Trend{Operation: operation, Periods: make([]Period, 0, len(b.periods))}
+	for _, p := range b.periods {
+		p.finish()
+		t.Periods = append(t.Periods, *p)
+	}
+	sort.Slice(t.Periods, func(i, j int) bool { return t.Periods[i].Start.Before(t.Periods[j].Start) })
+	b.overall.finish()
+	t.Overall = b.overall
+	t.Overall.Start = since
+	if n := len(t.Periods); n > 1 {
+		t.PassRateChange = round(t.Periods[n-1].PassRate - t.Periods[0].PassRate)
+		t.P95Change = round(t.Periods[n-1].P95MS - t.Periods[0].P95MS)
+	}
+	return t
+}
+
+// Trends returns the history of the runs that started since since, and of
+// the tests they executed by operation, grouped into periods of period. An
+// operation filter, if not empty, limits the operations to that one.
+func (s *Store) Trends(since time.Time, period time.Duration, operation string) (*Trends, error) {
+	trends := &Trends{Since: since, Period: formatPeriod(period)}
+
+	runs := newTrendBuilder(period)
+	rows, err := s.db.Query(`SELECT start_time, status, duration_ms FROM runs WHERE start_time >= ?`, since.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query runs: %w", err)
+	}
+	for rows.Next() {
+		var start, durationMS int64
+		var status string
+		if err := rows.Scan(&start, &status, &durationMS); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		p := runs.add(time.UnixMilli(start), status == "pass", float64(durationMS))
+		if status == "error" {
+			p.Errors++
+			runs.overall.Errors++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	trends.Runs = runs.trend("", since)
+
+	query := `SELECT r.start_time, res.operation, res.status, res.duration_us FROM results res
+		JOIN runs r ON r.id = res.run WHERE r.start_time >= ? AND res.status != 'skip'`
+	args := []any{since.UnixMilli()}
+	if operation != "" {
+		query += ` AND lower(res.operation) = lower(?)`
+		args = append(args, operation)
+	}
+	rows, err = s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query results: %w", err)
+	}
+	defer rows.Close()
+	operations := make(map[string]*trendBuilder)
+	for rows.Next() {
+		var start, durationUS int64
+		var op, status string
+		if err := rows.Scan(&start, &op, &status, &durationUS); err != nil {
+			return nil, err
+		}
+		b := operations[op]
+		if b == nil {
+			b = newTrendBuilder(period)
+			operations[op] = b
+		}
+		b.add(time.UnixMilli(start), status == "pass", float64(durationUS)/1000)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(operations))
+	for op := range operations {
+		names = append(names, op)
+	}
+	sort.Strings(names)
+	for _, op := range names {
+		trends.Operations = append(trends.Operations, operations[op].trend(op, since))
+	}
+	return trends, nil
+}
+
+// WriteJSON writes the trends as an indented JSON document
+func (t *Trends) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(t)
+}
+
+// WriteText writes the trends as console tables
+func (t *Trends) WriteText(w io.Writer) {
+	layout := "2006-01-02 15:04"
+	if period, _ := time.ParseDuration(t.Period); period%(24*time.Hour) == 0 {
+		layout = "2006-01-02"
+	}
+
+	fmt.Fprintln(w, "\n"+strings.Repeat("=", 80))
+	fmt.Fprintf(w, "RUN HISTORY SINCE %s (PER %s)\n", t.Since.Format(time.RFC3339), strings.ToUpper(t.Period))
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+	if t.Runs.Overall.Count == 0 {
+		fmt.Fprintln(w, "No runs recorded in this period.")
+		return
+	}
+
+	fmt.Fprintln(w, "\nRuns:")
+	fmt.Fprintf(w, "  %-16s  %6s  %6s  %6s  %9s  %10s  %10s\n", "Period", "Runs", "Failed", "Errors", "Pass Rate", "Avg", "Max")
+	writeRun := func(label string, p Period) {
+		fmt.Fprintf(w, "  %-16s  %6d  %6d  %6d  %8.1f%%  %10s  %10s\n", label, p.Count, p.Failed-p.Errors, p.Errors, p.PassRate,
+			formatMS(p.AvgMS), formatMS(p.MaxMS))
+	}
+	for _, p := range t.Runs.Periods {
+		writeRun(p.Start.Local().Format(layout), p)
+	}
+	writeRun("Overall", t.Runs.Overall)
+	writeChange(w, t.Runs)
+
+	for _, op := range t.Operations {
+		fmt.Fprintf(w, "\n%s:\n", op.Operation)
+		fmt.Fprintf(w, "  %-16s  %6s  %6s  %9s  %10s  %10s  %10s\n", "Period", "Tests", "Failed", "Pass Rate", "Avg", "p95", "Max")
+		writeTests := func(label string, p Period) {
+			fmt.Fprintf(w, "  %-16s  %6d  %6d  %8.1f%%  %10s  %10s  %10s\n", label, p.Count, p.Failed, p.PassRate,
+				formatMS(p.AvgMS), formatMS(p.P95MS), formatMS(p.MaxMS))
+		}
+		for _, p := range op.Periods {
+			writeTests(p.Start.Local().Format(layout), p)
+		}
+		writeTests("Overall", op.Overall)
+		writeChange(w, op)
+	}
+	fmt.Fprintln(w, "\n"+strings.Repeat("=", 80))
+}
+
+// writeChange writes the change from the first to the last period
+func writeChange(w io.Writer, t Trend) {
+	if len(t.Periods) < 2 {
+		return
+	}
+	if t.Operation == "" {
+		fmt.Fprintf(w, "  Trend: pass rate %+.1f pts\n", t.PassRateChange)
+		return
+	}
+	fmt.Fprintf(w, "  Trend: pass rate %+.1f pts, p95 %+.1fms\n", t.PassRateChange, t.P95Change)
+}
+
+// formatMS renders a duration in ms with a unit fitting its size
+func formatMS(ms float64) string {
+	if ms >= 1000 {
+		return fmt.Sprintf("%.2fs", ms/1000)
+	}
+	return fmt.Sprintf("%.1fms", ms)
+}
+
+// formatPeriod renders 24h0m0s as 24h and 30m0s as 30m
+func formatPeriod(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
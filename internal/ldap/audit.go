@@ -0,0 +1,291 @@
+package ldap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"ldap-automated-actions/internal/ldif"
+	"ldap-automated-actions/internal/logger"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// redactedAttributes are written to the audit trail without their values
+var redactedAttributes = map[string]bool{
+	"userpassword": true,
+	"unicodepwd":   true,
+}
+
+// AuditLog records every write operation as an LDIF change record, so the
+// changes made by a run can be reviewed, replayed or rolled back by hand.
+// Failed operations are written as comments only, since they changed nothing.
+// A nil audit log records nothing.
+type AuditLog struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	writer *ldif.Writer
+}
+
+// OpenAuditLog creates the audit file audit-<runID>.ldif in dir
+func OpenAuditLog(dir, runID string) (*AuditLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("audit-%s.ldif", runID))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit file: %w", err)
+	}
+
+	a := &AuditLog{path: path, file: file, writer: ldif.NewWriter(file)}
+	if info, err := file.Stat(); err == nil && info.Size() == 0 {
+		a.writer.WriteVersion()
+	}
+	a.writer.WriteComment(fmt.Sprintf("Run %s started %s", runID, time.Now().Format(time.RFC3339)))
+	if err := a.writer.Flush(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write audit file: %w", err)
+	}
+
+	logger.Info("Audit", "Recording write operations", "file", path)
+	return a, nil
+}
+
+// Path returns the path of the audit file
+func (a *AuditLog) Path() string {
+	if a == nil {
+		return ""
+	}
+	return a.path
+}
+
+// Close closes the audit file
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// record writes the change record of an operation and its outcome
+func (a *AuditLog) record(record ldif.Record, bindDN string, err error) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	record = redactRecord(record)
+	timestamp := time.Now().Format(time.RFC3339Nano)
+	if err != nil {
+		a.writer.WriteComment(fmt.Sprintf("%s FAILED %s %s as %s: %s", timestamp, record.ChangeType, record.DN, bindDN, singleLine(err.Error())))
+		if flushErr := a.writer.Flush(); flushErr != nil {
+			logger.Warn("Audit", "Failed to write audit record", "error", flushErr)
+		}
+		return
+	}
+
+	a.writer.WriteComment(fmt.Sprintf("%s %s as %s", timestamp, record.ChangeType, bindDN))
+	if writeErr := a.writer.WriteRecord(record); writeErr != nil {
+		logger.Warn("Audit", "Failed to write audit record", "error", writeErr)
+	}
+}
+
+func singleLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// redactRecord returns a copy of record with the values of redacted attributes replaced
+func redactRecord(record ldif.Record) ldif.Record {
+	attributes := make([]ldif.Attribute, len(record.Attributes))
+	for i, attr := range record.Attributes {
+		attributes[i] = ldif.Attribute{Name: attr.Name, Values: redact(attr.Name, attr.Values)}
+	}
+	record.Attributes = attributes
+
+	modifications := make([]ldif.Modification, len(record.Modifications))
+	for i, mod := range record.Modifications {
+		mod.Values = redact(mod.Attribute, mod.Values)
+		modifications[i] = mod
+	}
+	record.Modifications = modifications
+	return record
+}
+
+func redact(attribute string, values []string) []string {
+	if !redactedAttributes[strings.ToLower(attribute)] {
+		return values
+	}
+	redacted := make([]string, len(values))
+	for i := range values {
+		redacted[i] = "{REDACTED}"
+	}
+	return redacted
+}
+
+// SetAuditLog records the write operations of this connection in audit
+func (c *Connection) SetAuditLog(audit *AuditLog) {
+	c.audit = audit
+}
+
+// AuditLog returns the audit log of this connection, nil if none
+func (c *Connection) AuditLog() *AuditLog {
+	return c.audit
+}
+
+// Add performs an add request and records it in the audit log, or only
+// records it in the plan of a dry run
+func (c *Connection) Add(request *ldap.AddRequest) error {
+	record := ldif.Record{DN: request.DN, ChangeType: ldif.ChangeAdd}
+	for _, attr := range request.Attributes {
+		record.Attributes = append(record.Attributes, ldif.Attribute{Name: attr.Type, Values: attr.Vals})
+	}
+	if err := c.refuseWrite(record); err != nil {
+		return err
+	}
+	if c.plan != nil {
+		return c.plan.record(record)
+	}
+
+	err := c.conn.Add(request)
+	c.audit.record(record, c.config.BindDN, err)
+	return err
+}
+
+// Modify performs a modify request and records it in the audit log, or only
+// records it in the plan of a dry run
+func (c *Connection) Modify(request *ldap.ModifyRequest) error {
+	_, err := c.ModifyWithResult(request)
+	return err
+}
+
+// ModifyWithResult is Modify returning the controls of the response, such as
+// those of a Post-Read request. A dry run returns an empty result.
+func (c *Connection) ModifyWithResult(request *ldap.ModifyRequest) (*ldap.ModifyResult, error) {
+	record := ldif.Record{DN: request.DN, ChangeType: ldif.ChangeModify}
+	for _, change := range request.Changes {
+		op := "replace"
+		switch change.Operation {
+		case ldap.AddAttribute:
+			op = "add"
+		case ldap.DeleteAttribute:
+			op = "delete"
+		case ldap.IncrementAttribute:
+			op = "increment"
+		}
+		attr := change.Modification
+		record.Modifications = append(record.Modifications, ldif.Modification{Op: op, Attribute: attr.Type, Values: attr.Vals})
+	}
+	if err := c.refuseWrite(record); err != nil {
+		return nil, err
+	}
+	if c.plan != nil {
+		return &ldap.ModifyResult{}, c.plan.record(record)
+	}
+
+	result, err := c.conn.ModifyWithResult(request)
+	c.audit.record(record, c.config.BindDN, err)
+	return result, err
+}
+
+// ModifyDN performs a modify DN request and records it in the audit log, or
+// only records it in the plan of a dry run
+func (c *Connection) ModifyDN(request *ldap.ModifyDNRequest) error {
+	record := ldif.Record{
+		DN:           request.DN,
+		ChangeType:   ldif.ChangeModRDN,
+		NewRDN:       request.NewRDN,
+		DeleteOldRDN: request.DeleteOldRDN,
+		NewSuperior:  request.NewSuperior,
+	}
+	if err := c.refuseWrite(record); err != nil {
+		return err
+	}
+	if c.plan != nil {
+		return c.plan.record(record)
+	}
+
+	err := c.conn.ModifyDN(request)
+	c.audit.record(record, c.config.BindDN, err)
+	return err
+}
+
+// Del performs a delete request and records it in the audit log, or only
+// records it in the plan of a dry run
+func (c *Connection) Del(request *ldap.DelRequest) error {
+	record := ldif.Record{DN: request.DN, ChangeType: ldif.ChangeDelete}
+	if err := c.refuseWrite(record); err != nil {
+		return err
+	}
+	if c.plan != nil {
+		return c.plan.record(record)
+	}
+
+	err := c.conn.Del(request)
+	c.audit.record(record, c.config.BindDN, err)
+	return err
+}
+
+// OIDPasswordModify is the RFC 3062 Password Modify extended operation
+const OIDPasswordModify = "1.3.6.1.4.1.4203.1.11.1"
+
+// PasswordModify performs a Password Modify extended operation and records it
+// in the audit log as a replace of userPassword, or only records it in the
+// plan of a dry run. Without a user identity the request changes the password
+// of the bound user.
+func (c *Connection) PasswordModify(request *ldap.PasswordModifyRequest) (*ldap.PasswordModifyResult, error) {
+	dn := request.UserIdentity
+	if dn == "" {
+		dn = c.config.BindDN
+	}
+	record := ldif.Record{DN: dn, ChangeType: ldif.ChangeModify, Modifications: []ldif.Modification{
+		{Op: "replace", Attribute: "userPassword", Values: []string{request.NewPassword}},
+	}}
+	if err := c.refuseWrite(record); err != nil {
+		return nil, err
+	}
+	if c.plan != nil {
+		return &ldap.PasswordModifyResult{}, c.plan.record(record)
+	}
+
+	result, err := c.conn.PasswordModify(request)
+	c.audit.record(record, c.config.BindDN, err)
+	return result, err
+}
+
+// Upsert adds an entry, or brings an existing one to the requested state: a
+// leaf entry is deleted and added again, an entry with children keeps them and
+// has its attributes replaced (objectClass is left as is)
+func (c *Connection) Upsert(request *ldap.AddRequest) error {
+	err := c.Add(request)
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultEntryAlreadyExists) {
+		return err
+	}
+
+	logger.Debug("Connection", "Entry exists, replacing it", "dn", request.DN)
+	err = c.Del(ldap.NewDelRequest(request.DN, nil))
+	if err == nil {
+		return c.Add(request)
+	}
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultNotAllowedOnNonLeaf) {
+		return err
+	}
+
+	logger.Debug("Connection", "Entry has children, replacing its attributes", "dn", request.DN)
+	modifyRequest := ldap.NewModifyRequest(request.DN, nil)
+	for _, attr := range request.Attributes {
+		if strings.EqualFold(attr.Type, "objectClass") {
+			continue
+		}
+		modifyRequest.Replace(attr.Type, attr.Vals)
+	}
+	return c.Modify(modifyRequest)
+}
@@ -1,11 +1,18 @@
 package ldap
 
 import (
+	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"ldap-automated-actions/internal/config"
@@ -15,16 +22,74 @@ import (
 	"software.sslmate.com/src/go-pkcs12"
 )
 
+// openConnections counts the connections of this process that are not yet
+// closed, so long-running loops can spot connections the tool leaks
+var openConnections atomic.Int64
+
+// OpenConnections returns the number of LDAP connections opened and not yet closed
+func OpenConnections() int64 {
+	return openConnections.Load()
+}
+
+// connectionErrors counts the failed attempts of this process to connect to
+// a server, for the metrics of serve mode
+var connectionErrors atomic.Int64
+
+// ConnectionErrors returns the number of failed attempts to connect to a server
+func ConnectionErrors() int64 {
+	return connectionErrors.Load()
+}
+
 // Connection represents an LDAP connection wrapper
 type Connection struct {
-	conn   *ldap.Conn
-	config *config.Config
+	conn       *ldap.Conn
+	config     *config.Config
+	serverInfo ServerInfo
+	server     config.Server // server of the host list the connection was opened to
+	audit      *AuditLog     // records write operations, nil if disabled
+	plan       *Plan         // records write operations instead of sending them in a dry run, nil otherwise
+	closed     atomic.Bool   // Close was called; it may be called more than once
 }
 
-// buildTLSConfig creates a TLS configuration based on the provided config
-func buildTLSConfig(cfg *config.Config) (*tls.Config, error) {
+// ServerInfo describes the target server as reported by its root DSE
+type ServerInfo struct {
+	Address        string
+	Security       string // none, ldaps or starttls
+	VendorName     string
+	VendorVersion  string
+	Vendor         Vendor // product detected from the root DSE
+	LDAPVersions   []string
+	NamingContexts []string
+	Extensions     []string // supportedExtension OIDs
+	Controls       []string // supportedControl OIDs
+	SASLMechanisms []string // supportedSASLMechanisms
+}
+
+// SupportsExtension reports whether the root DSE advertises an extended operation
+func (s ServerInfo) SupportsExtension(oid string) bool {
+	for _, extension := range s.Extensions {
+		if extension == oid {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsControl reports whether the root DSE advertises a control
+func (s ServerInfo) SupportsControl(oid string) bool {
+	for _, control := range s.Controls {
+		if control == oid {
+			return true
+		}
+	}
+	return false
+}
+
+// buildTLSConfig creates a TLS configuration based on the provided config for
+// a connection to host
+func buildTLSConfig(cfg *config.Config, host string) (*tls.Config, error) {
 	tlsConfig := &tls.Config{
-		ServerName:         cfg.Host,
+		ServerName:         host,
 		InsecureSkipVerify: cfg.InsecureSkipVerify,
 	}
 
@@ -123,10 +188,36 @@ func buildTLSConfig(cfg *config.Config) (*tls.Config, error) {
 		}
 	}
 
+	// Present a client certificate for mutual TLS and SASL EXTERNAL binds
+	if cfg.HasClientCertificate() {
+		clientCert, err := loadClientCertificate(cfg)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
 	if cfg.InsecureSkipVerify {
 		logger.Warn("TLS", "Certificate verification is DISABLED - not recommended for production")
 	}
 
+	// Reject any certificate other than the pinned one, even if it chains to a trusted CA
+	if pin := cfg.PinnedCertSHA256(); pin != "" {
+		logger.Debug("TLS", "Server certificate is pinned", "sha256", pin)
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("server presented no certificate")
+			}
+			leaf := state.PeerCertificates[0]
+			if MatchPin(leaf, pin) == "" {
+				certHash, spkiHash := CertificateFingerprints(leaf)
+				logger.Error("TLS", "Server certificate does not match the pin", "subject", leaf.Subject.String(), "certSHA256", certHash, "spkiSHA256", spkiHash)
+				return fmt.Errorf("server certificate does not match pinned SHA-256 %s (certificate %s, SPKI %s)", pin, certHash, spkiHash)
+			}
+			return nil
+		}
+	}
+
 	// Enable TLS key logging for Wireshark decryption if configured
 	keyLogPath := cfg.TLSKeyLogFile
 	if keyLogPath == "" {
@@ -148,18 +239,134 @@ func buildTLSConfig(cfg *config.Config) (*tls.Config, error) {
 	return tlsConfig, nil
 }
 
-// NewConnection creates a new LDAP connection
+// loadClientCertificate loads the client certificate and its key from the PEM
+// files or, if none are configured, from the PKCS12 key store
+func loadClientCertificate(cfg *config.Config) (tls.Certificate, error) {
+	if cfg.TLSClientCertFile != "" {
+		logger.Debug("TLS", "Loading PEM client certificate", "cert", cfg.TLSClientCertFile, "key", cfg.TLSClientKeyFile)
+		clientCert, err := tls.LoadX509KeyPair(cfg.TLSClientCertFile, cfg.TLSClientKeyFile)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		clientCert.Leaf, _ = x509.ParseCertificate(clientCert.Certificate[0])
+		if clientCert.Leaf != nil {
+			logger.Info("TLS", "Loaded client certificate", "subject", clientCert.Leaf.Subject.String())
+		}
+		return clientCert, nil
+	}
+
+	logger.Debug("TLS", "Loading PKCS12 key store", "path", cfg.KeyStorePath)
+	password := cfg.KeyStorePassword
+	if cfg.KeyStorePasswordFile != "" {
+		logger.Debug("TLS", "Reading key store password from file", "file", cfg.KeyStorePasswordFile)
+		passwordBytes, err := os.ReadFile(cfg.KeyStorePasswordFile)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to read key store password file: %w", err)
+		}
+		password = strings.TrimSpace(string(passwordBytes))
+	}
+
+	p12Data, err := os.ReadFile(cfg.KeyStorePath)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to read key store file: %w", err)
+	}
+	key, leaf, chain, err := pkcs12.DecodeChain(p12Data, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to decode PKCS12 key store: %w", err)
+	}
+
+	// Send the intermediate certificates along, so the server can build the chain
+	clientCert := tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: key, Leaf: leaf}
+	for _, cert := range chain {
+		clientCert.Certificate = append(clientCert.Certificate, cert.Raw)
+	}
+	logger.Info("TLS", "Loaded client certificate from key store", "subject", leaf.Subject.String(), "chain", len(chain))
+	return clientCert, nil
+}
+
+// CertificateFingerprints returns the hex SHA-256 of a certificate and of its
+// SubjectPublicKeyInfo
+func CertificateFingerprints(cert *x509.Certificate) (certHash, spkiHash string) {
+	certSum := sha256.Sum256(cert.Raw)
+	spkiSum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(certSum[:]), hex.EncodeToString(spkiSum[:])
+}
+
+// MatchPin reports what the pin matches: "certificate", "spki", or "" when
+// it matches neither
+func MatchPin(cert *x509.Certificate, pin string) string {
+	certHash, spkiHash := CertificateFingerprints(cert)
+	switch pin {
+	case certHash:
+		return "certificate"
+	case spkiHash:
+		return "spki"
+	}
+	return ""
+}
+
+// NewConnection connects to the first server of the host list that accepts
+// the connection, failing over to the next one when dialing fails
 func NewConnection(cfg *config.Config) (*Connection, error) {
-	logger.Debug("Connection", "Attempting to connect to LDAP server", "address", cfg.GetAddress())
+	return connect(cfg, false)
+}
+
+// NewBoundConnection connects and binds to the first server of the host list
+// that accepts both, failing over to the next one when dial or bind fails
+func NewBoundConnection(cfg *config.Config) (*Connection, error) {
+	return connect(cfg, true)
+}
+
+// connect tries the servers of the host list in order, logging which one
+// ended up being used when there is more than one
+func connect(cfg *config.Config, bind bool) (*Connection, error) {
+	servers := cfg.GetServers()
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no LDAP server configured")
+	}
+
+	var lastErr error
+	for i, server := range servers {
+		conn, err := dialServer(cfg, server)
+		if err != nil {
+			connectionErrors.Add(1)
+		}
+		if err == nil && bind {
+			if err = conn.Bind(); err != nil {
+				conn.Close()
+			}
+		}
+		if err == nil {
+			if len(servers) > 1 {
+				logger.Info("Connection", "Using LDAP server", "address", cfg.ServerAddress(server), "candidate", fmt.Sprintf("%d of %d", i+1, len(servers)))
+			}
+			return conn, nil
+		}
+
+		lastErr = err
+		if i < len(servers)-1 {
+			logger.Warn("Connection", "LDAP server failed, failing over to the next server", "address", cfg.ServerAddress(server), "error", err)
+		}
+	}
+	if len(servers) > 1 {
+		return nil, fmt.Errorf("all %d LDAP servers failed, last error: %w", len(servers), lastErr)
+	}
+	return nil, lastErr
+}
+
+// dialServer connects to one server of the host list
+func dialServer(cfg *config.Config, server config.Server) (*Connection, error) {
+	logger.Debug("Connection", "Attempting to connect to LDAP server", "address", cfg.ServerAddress(server))
 
 	var conn *ldap.Conn
 	var err error
 
-	address := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	address := net.JoinHostPort(server.Host, strconv.Itoa(server.Port))
 
 	if cfg.UseTLS {
 		// Use LDAPS (LDAP over TLS)
-		tlsConfig, err := buildTLSConfig(cfg)
+		var tlsConfig *tls.Config
+		tlsConfig, err = buildTLSConfig(cfg, server.Host)
 		if err != nil {
 			logger.Error("Connection", "Failed to build TLS configuration", "error", err)
 			return nil, fmt.Errorf("failed to build TLS config: %w", err)
@@ -183,7 +390,7 @@ func NewConnection(cfg *config.Config) (*Connection, error) {
 
 	// Use StartTLS if configured
 	if cfg.StartTLS && !cfg.UseTLS {
-		tlsConfig, err := buildTLSConfig(cfg)
+		tlsConfig, err := buildTLSConfig(cfg, server.Host)
 		if err != nil {
 			conn.Close()
 			logger.Error("Connection", "Failed to build TLS configuration for StartTLS", "error", err)
@@ -198,16 +405,36 @@ func NewConnection(cfg *config.Config) (*Connection, error) {
 		logger.Debug("Connection", "StartTLS successful")
 	}
 
-	logger.Info("Connection", "Successfully connected to LDAP server", "address", cfg.GetAddress())
+	logger.Info("Connection", "Successfully connected to LDAP server", "address", cfg.ServerAddress(server))
+	openConnections.Add(1)
+
+	security := "none"
+	if cfg.UseTLS {
+		security = "ldaps"
+	} else if cfg.StartTLS {
+		security = "starttls"
+	}
 
 	return &Connection{
 		conn:   conn,
 		config: cfg,
+		server: server,
+		serverInfo: ServerInfo{
+			Address:  cfg.ServerAddress(server),
+			Security: security,
+		},
 	}, nil
 }
 
-// Bind authenticates with the LDAP server
+// Bind authenticates with the LDAP server using the configured bind method
 func (c *Connection) Bind() error {
+	switch c.config.BindMethod {
+	case "gssapi":
+		return c.GSSAPIBind()
+	case "external":
+		return c.ExternalBind()
+	}
+
 	logger.Debug("Bind", "Attempting bind", "dn", c.config.BindDN)
 
 	start := time.Now()
@@ -225,14 +452,46 @@ func (c *Connection) Bind() error {
 	return nil
 }
 
+// ExternalBind authenticates with a SASL EXTERNAL bind, which asks the server to
+// use the identity of the client certificate presented in the TLS handshake
+func (c *Connection) ExternalBind() error {
+	logger.Debug("Bind", "Attempting SASL EXTERNAL bind")
+
+	start := time.Now()
+	err := c.conn.ExternalBind()
+	duration := time.Since(start)
+
+	if err != nil {
+		logger.LogLDAPResult("Bind", "EXTERNAL Bind", false, -1, err.Error(), duration)
+		return fmt.Errorf("SASL EXTERNAL bind failed: %w", err)
+	}
+
+	logger.LogLDAPResult("Bind", "EXTERNAL Bind", true, 0, "Success", duration)
+	logger.Info("Bind", "Successfully authenticated with the client certificate")
+	return nil
+}
+
 // Close closes the LDAP connection
 func (c *Connection) Close() {
 	if c.conn != nil {
 		logger.Debug("Connection", "Closing LDAP connection")
 		c.conn.Close()
+		if c.closed.CompareAndSwap(false, true) {
+			openConnections.Add(-1)
+		}
 	}
 }
 
+// AbortOnCancel closes the connection when ctx is cancelled so that an
+// in-flight operation returns immediately. The returned function stops the watch
+// and reports whether it was still active.
+func (c *Connection) AbortOnCancel(ctx context.Context) func() bool {
+	return context.AfterFunc(ctx, func() {
+		logger.Warn("Connection", "Run cancelled, aborting in-flight LDAP operation")
+		c.Close()
+	})
+}
+
 // Unbind sends an unbind request and closes the connection
 func (c *Connection) Unbind() error {
 	if c.conn != nil {
@@ -265,7 +524,7 @@ func (c *Connection) HealthCheck() error {
 		0,
 		false,
 		"(objectClass=*)",
-		[]string{"namingContexts", "supportedLDAPVersion"},
+		append([]string{"namingContexts", "supportedLDAPVersion", "supportedExtension", "supportedControl", "supportedSASLMechanisms", "vendorName", "vendorVersion"}, rootDSEVendorAttributes...),
 		nil,
 	)
 
@@ -284,23 +543,75 @@ func (c *Connection) HealthCheck() error {
 		entry := result.Entries[0]
 		logger.Info("HealthCheck", "LDAP server is healthy", "entries", len(result.Entries))
 
-		// Log server capabilities
-		if namingContexts := entry.GetAttributeValues("namingContexts"); len(namingContexts) > 0 {
-			logger.Debug("HealthCheck", "Naming contexts available", "contexts", namingContexts)
+		// Record and log server capabilities
+		c.serverInfo.NamingContexts = entry.GetAttributeValues("namingContexts")
+		c.serverInfo.LDAPVersions = entry.GetAttributeValues("supportedLDAPVersion")
+		c.serverInfo.VendorName = entry.GetAttributeValue("vendorName")
+		c.serverInfo.VendorVersion = entry.GetAttributeValue("vendorVersion")
+		c.serverInfo.Extensions = entry.GetAttributeValues("supportedExtension")
+		c.serverInfo.Controls = entry.GetAttributeValues("supportedControl")
+		c.serverInfo.SASLMechanisms = entry.GetAttributeValues("supportedSASLMechanisms")
+		c.serverInfo.Vendor = detectVendor(entry)
+
+		if len(c.serverInfo.NamingContexts) > 0 {
+			logger.Debug("HealthCheck", "Naming contexts available", "contexts", c.serverInfo.NamingContexts)
 		}
-		if versions := entry.GetAttributeValues("supportedLDAPVersion"); len(versions) > 0 {
-			logger.Debug("HealthCheck", "Supported LDAP versions", "versions", versions)
+		if len(c.serverInfo.LDAPVersions) > 0 {
+			logger.Debug("HealthCheck", "Supported LDAP versions", "versions", c.serverInfo.LDAPVersions)
 		}
+		logger.Info("HealthCheck", "Server vendor detected", "vendor", c.serverInfo.Vendor, "vendorName", c.serverInfo.VendorName, "version", c.serverInfo.VendorVersion)
+		logger.Debug("HealthCheck", "Server capabilities", "controls", c.serverInfo.Controls, "extensions", c.serverInfo.Extensions, "saslMechanisms", c.serverInfo.SASLMechanisms)
+	}
+
+	return nil
+}
+
+// Ping checks that the connection still answers with a base search of the
+// root DSE that returns no attributes
+func (c *Connection) Ping() error {
+	if c.IsClosed() {
+		return errors.New("connection is closed")
 	}
 
+	searchRequest := ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+		"(objectClass=*)", []string{"1.1"}, nil)
+
+	start := time.Now()
+	if _, err := c.conn.Search(searchRequest); err != nil {
+		logger.LogLDAPResult("Ping", "Search", false, -1, err.Error(), time.Since(start))
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	logger.Trace("Connection", "Ping answered", "duration", time.Since(start))
 	return nil
 }
 
+// IsClosed reports whether the connection was closed, by Close or by the server
+func (c *Connection) IsClosed() bool {
+	return c.closed.Load() || c.conn == nil || c.conn.IsClosing()
+}
+
+// SetServerInfo records what is known about the server, for connections
+// opened after the health check of the first one
+func (c *Connection) SetServerInfo(info ServerInfo) {
+	c.serverInfo = info
+}
+
 // GetConnection returns the underlying LDAP connection
 func (c *Connection) GetConnection() *ldap.Conn {
 	return c.conn
 }
 
+// HostPort returns the host:port of the server the connection was opened to,
+// for tests that open further connections to the same server
+func (c *Connection) HostPort() string {
+	return net.JoinHostPort(c.server.Host, strconv.Itoa(c.server.Port))
+}
+
+// GetServerInfo returns what is known about the target server
+func (c *Connection) GetServerInfo() ServerInfo {
+	return c.serverInfo
+}
+
 // GetConfig returns the configuration
 func (c *Connection) GetConfig() *config.Config {
 	return c.config
@@ -0,0 +1,66 @@
+package ldap
+
+import (
+	"fmt"
+	"time"
+
+	"ldap-automated-actions/internal/config"
+	"ldap-automated-actions/internal/logger"
+
+	"github.com/go-ldap/ldap/v3/gssapi"
+)
+
+// newKerberosClient returns a Kerberos client that authenticates with the
+// configured keytab, or with the tickets of the credentials cache when no
+// keytab is set
+func newKerberosClient(cfg *config.Config) (*gssapi.Client, error) {
+	krb5conf := cfg.GetKerberosConfig()
+
+	if cfg.KerberosKeytab != "" {
+		logger.Debug("Kerberos", "Authenticating with keytab", "principal", cfg.KerberosUser, "realm", cfg.KerberosRealm, "keytab", cfg.KerberosKeytab)
+		client, err := gssapi.NewClientWithKeytab(cfg.KerberosUser, cfg.KerberosRealm, cfg.KerberosKeytab, krb5conf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load keytab: %w", err)
+		}
+		if err := client.Login(); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("kerberos login failed: %w", err)
+		}
+		return client, nil
+	}
+
+	ccache := cfg.GetKerberosCCache()
+	logger.Debug("Kerberos", "Authenticating with credentials cache", "ccache", ccache)
+	client, err := gssapi.NewClientFromCCache(ccache, krb5conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credentials cache %s: %w", ccache, err)
+	}
+	return client, nil
+}
+
+// GSSAPIBind authenticates with Kerberos through a SASL GSSAPI bind to the
+// service principal of the server the connection was opened to
+func (c *Connection) GSSAPIBind() error {
+	spn := c.config.GetKerberosSPN(c.server.Host)
+	logger.Debug("Bind", "Attempting GSSAPI bind", "spn", spn)
+
+	client, err := newKerberosClient(c.config)
+	if err != nil {
+		logger.Error("Bind", "Failed to obtain Kerberos credentials", "error", err)
+		return fmt.Errorf("GSSAPI bind failed: %w", err)
+	}
+	defer client.Close()
+
+	start := time.Now()
+	err = c.conn.GSSAPIBind(client, spn, "")
+	duration := time.Since(start)
+
+	if err != nil {
+		logger.LogLDAPResult("Bind", "GSSAPI Bind", false, -1, err.Error(), duration)
+		return fmt.Errorf("GSSAPI bind failed: %w", err)
+	}
+
+	logger.LogLDAPResult("Bind", "GSSAPI Bind", true, 0, "Success", duration)
+	logger.Info("Bind", "Successfully authenticated with Kerberos", "spn", spn)
+	return nil
+}
@@ -0,0 +1,79 @@
+package ldap
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"ldap-automated-actions/internal/ldif"
+	"ldap-automated-actions/internal/logger"
+)
+
+// Plan collects the write operations of a dry run as LDIF change records in
+// the order they would be sent, so they can be reviewed and applied by hand.
+// A connection with a plan records its writes instead of sending them and
+// reports them as successful; reads still go to the server.
+type Plan struct {
+	mu     sync.Mutex
+	writer *ldif.Writer
+	err    error // first write error, reported by Flush
+}
+
+// NewPlan writes the planned operations to w
+func NewPlan(w io.Writer) *Plan {
+	p := &Plan{writer: ldif.NewWriter(w)}
+	p.err = p.writer.WriteVersion()
+	return p
+}
+
+// SetPlan records the write operations of this connection in plan instead of
+// sending them
+func (c *Connection) SetPlan(plan *Plan) {
+	c.plan = plan
+}
+
+// Plan returns the plan of this connection, nil if its writes are sent
+func (c *Connection) Plan() *Plan {
+	return c.plan
+}
+
+// Comment writes a comment line, e.g. to mark the operations of a suite
+func (p *Plan) Comment(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.writer.WriteComment(text); err != nil && p.err == nil {
+		p.err = err
+	}
+}
+
+// record writes the change record of a planned operation
+func (p *Plan) record(record ldif.Record) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	logger.Debug("Plan", "DRY RUN: Planned operation", "changetype", record.ChangeType, "dn", record.DN)
+	if err := p.writer.WriteRecord(record); err != nil && p.err == nil {
+		p.err = err
+	}
+	return nil
+}
+
+// Records returns the number of planned operations
+func (p *Plan) Records() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.writer.Records()
+}
+
+// Flush writes out buffered records and returns the first write error
+func (p *Plan) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.writer.Flush(); err != nil && p.err == nil {
+		p.err = err
+	}
+	if p.err != nil {
+		return fmt.Errorf("failed to write planned operations: %w", p.err)
+	}
+	return nil
+}
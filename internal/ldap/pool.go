@@ -0,0 +1,142 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"ldap-automated-actions/internal/logger"
+)
+
+// ErrPoolClosed is returned by Get once the pool has been closed
+var ErrPoolClosed = errors.New("connection pool is closed")
+
+// Pool keeps a fixed number of bound connections that callers check out for
+// exclusive use and check back in when done. A connection is health checked
+// when it is checked out and replaced if it no longer answers, so a
+// connection aborted by a cancelled operation can simply be checked back in.
+type Pool struct {
+	open  func() (*Connection, error)
+	slots chan *Connection // idle connections; nil marks a slot to be re-opened
+	size  int
+
+	mu       sync.Mutex
+	closed   bool
+	replaced int
+}
+
+// NewPool opens size connections with open, which returns a bound connection
+func NewPool(size int, open func() (*Connection, error)) (*Pool, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("invalid pool size: %d", size)
+	}
+
+	p := &Pool{open: open, slots: make(chan *Connection, size), size: size}
+	for i := 0; i < size; i++ {
+		conn, err := open()
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("failed to open pooled connection %d of %d: %w", i+1, size, err)
+		}
+		p.slots <- conn
+	}
+
+	logger.Info("Pool", "Opened connection pool", "size", size)
+	return p, nil
+}
+
+// Get checks out a healthy connection, waiting for one to be checked in if
+// all are in use. It fails without waiting or connecting once ctx is done.
+func (p *Pool) Get(ctx context.Context) (*Connection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var conn *Connection
+	select {
+	case conn = <-p.slots:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, ErrPoolClosed
+	}
+
+	if conn != nil {
+		err := conn.Ping()
+		if err == nil {
+			return conn, nil
+		}
+		logger.Warn("Pool", "Pooled connection failed its health check, replacing it", "error", err)
+		conn.Close()
+	}
+
+	conn, err := p.open()
+	if err != nil {
+		p.slots <- nil
+		return nil, fmt.Errorf("failed to re-open pooled connection: %w", err)
+	}
+	p.mu.Lock()
+	p.replaced++
+	p.mu.Unlock()
+	return conn, nil
+}
+
+// Put checks a connection back in. A closed connection is replaced the next
+// time its slot is checked out.
+func (p *Pool) Put(conn *Connection) {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+
+	if closed {
+		conn.Close()
+		p.slots <- nil
+		return
+	}
+	if conn.IsClosed() {
+		conn = nil
+	}
+	p.slots <- conn
+}
+
+// Close closes the idle connections; those still checked out are closed
+// when they are checked in
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	for {
+		select {
+		case conn := <-p.slots:
+			if conn != nil {
+				conn.Close()
+			}
+		default:
+			logger.Debug("Pool", "Closed connection pool", "replaced", p.Replaced())
+			return
+		}
+	}
+}
+
+// Size returns the number of connections of the pool
+func (p *Pool) Size() int {
+	return p.size
+}
+
+// Replaced returns how many connections were re-opened after failing their
+// health check or being checked in closed
+func (p *Pool) Replaced() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.replaced
+}
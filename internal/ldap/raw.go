@@ -0,0 +1,489 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ldap-automated-actions/internal/config"
+	"ldap-automated-actions/internal/logger"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrRawBindUnsupported is the error of OpenRaw for a bind method the raw
+// client cannot authenticate with
+var ErrRawBindUnsupported = errors.New("raw connections are unsupported")
+
+// Extended operation OIDs used by the raw client
+const (
+	OIDCancel                = "1.3.6.1.1.8"            // RFC 3909 Cancel
+	OIDStartTLS              = "1.3.6.1.4.1.1466.20037" // RFC 4511 StartTLS
+	OIDNoticeOfDisconnection = "1.3.6.1.4.1.1466.20036" // RFC 4511 Notice of Disconnection
+)
+
+// RawMessage is a single LDAP response read by a RawConn
+type RawMessage struct {
+	ID   int64
+	Tag  ber.Tag // protocol op, e.g. ldap.ApplicationSearchResultEntry
+	Code uint16  // result code of result messages (SearchResultDone, ExtendedResponse, ...)
+	Err  error   // result as an *ldap.Error when Code is not success
+	DN   string  // DN of search result entries
+	OID  string  // responseName of extended responses
+}
+
+// IsUnsolicited reports whether the message is an unsolicited notification,
+// which the server sends with message ID 0 (RFC 4511 section 4.4)
+func (m *RawMessage) IsUnsolicited() bool {
+	return m.ID == 0 && m.Tag == ldap.ApplicationExtendedResponse
+}
+
+// IsResult reports whether the message is a final result rather than a search entry or reference
+func (m *RawMessage) IsResult() bool {
+	return m.Tag != ldap.ApplicationSearchResultEntry && m.Tag != ldap.ApplicationSearchResultReference
+}
+
+// RawConn is a thin message-level LDAP client. Unlike go-ldap it exposes the
+// message ID of every request, so tests can address operations in flight with
+// Abandon or Cancel and observe exactly which responses the server sends.
+type RawConn struct {
+	conn    net.Conn
+	config  *config.Config
+	host    string // server host name, verified against the certificate
+	mu      sync.Mutex
+	nextID  int64
+	timeout time.Duration
+	closed  atomic.Bool
+}
+
+// OpenRaw opens a separate raw connection to the same server, secured and
+// bound with the same configuration as c. With a bind method the raw client
+// does not implement it returns ErrRawBindUnsupported rather than bind as
+// another identity.
+func (c *Connection) OpenRaw() (*RawConn, error) {
+	if err := c.RawBindError(); err != nil {
+		return nil, err
+	}
+
+	raw, err := c.OpenSecureRaw()
+	if err != nil {
+		return nil, err
+	}
+	if c.config.BindMethod == "external" {
+		err = raw.ExternalBind()
+	} else {
+		err = raw.Bind(c.config.BindDN, c.config.BindPassword)
+	}
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return raw, nil
+}
+
+// RawBindError returns ErrRawBindUnsupported if OpenRaw cannot bind with the
+// configured bind method: a GSSAPI exchange is only implemented by go-ldap
+func (c *Connection) RawBindError() error {
+	if c.config.BindMethod == "gssapi" {
+		return fmt.Errorf("%w with bind_method %s", ErrRawBindUnsupported, c.config.BindMethod)
+	}
+	return nil
+}
+
+// OpenSecureRaw opens a separate raw connection to the same server, secured
+// with the same configuration as c, but not bound
+func (c *Connection) OpenSecureRaw() (*RawConn, error) {
+	raw, err := c.DialRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.config.StartTLS && !c.config.UseTLS {
+		msg, err := raw.RequestStartTLS()
+		if err == nil && msg.Err != nil {
+			err = fmt.Errorf("failed to start TLS: %w", msg.Err)
+		}
+		if err == nil {
+			err = raw.Handshake()
+		}
+		if err != nil {
+			raw.Close()
+			return nil, err
+		}
+	}
+	return raw, nil
+}
+
+// DialRaw opens a raw connection to the same server without StartTLS or
+// bind; with LDAPS configured the connection is TLS from the start
+func (c *Connection) DialRaw() (*RawConn, error) {
+	cfg := c.config
+	address := c.HostPort()
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	logger.Debug("RawConn", "Opening raw LDAP connection", "address", cfg.ServerAddress(c.server))
+
+	var conn net.Conn
+	var err error
+	if cfg.UseTLS {
+		tlsConfig, tlsErr := buildTLSConfig(cfg, c.server.Host)
+		if tlsErr != nil {
+			return nil, fmt.Errorf("failed to build TLS config: %w", tlsErr)
+		}
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", address, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", address, timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	openConnections.Add(1)
+	return &RawConn{conn: conn, config: cfg, host: c.server.Host, timeout: timeout}, nil
+}
+
+// AbandonTLSHandshake opens a connection, sends the TLS ClientHello (after
+// StartTLS when LDAPS is not configured) and closes the connection without
+// waiting for the server's reply
+func (c *Connection) AbandonTLSHandshake() error {
+	cfg := c.config
+	tlsConfig, err := buildTLSConfig(cfg, c.server.Host)
+	if err != nil {
+		return fmt.Errorf("failed to build TLS config: %w", err)
+	}
+
+	var conn net.Conn
+	var raw *RawConn
+	if cfg.UseTLS {
+		address := c.HostPort()
+		timeout := time.Duration(cfg.Timeout) * time.Second
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		conn, err = net.DialTimeout("tcp", address, timeout)
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+	} else {
+		raw, err = c.DialRaw()
+		if err != nil {
+			return err
+		}
+		msg, err := raw.RequestStartTLS()
+		if err == nil && msg.Err != nil {
+			err = fmt.Errorf("failed to start TLS: %w", msg.Err)
+		}
+		if err != nil {
+			raw.Close()
+			return err
+		}
+		conn = raw.conn
+	}
+
+	// The handshake fails as soon as the ClientHello is written
+	tls.Client(&closeAfterWrite{Conn: conn}, tlsConfig).Handshake()
+	if raw != nil {
+		raw.Close()
+	}
+	return nil
+}
+
+// closeAfterWrite closes the connection after the first write
+type closeAfterWrite struct {
+	net.Conn
+}
+
+func (c *closeAfterWrite) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.Conn.Close()
+	return n, err
+}
+
+// Bind performs a simple bind and waits for its result
+func (r *RawConn) Bind(dn, password string) error {
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationBindRequest, nil, "Bind Request")
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
+	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "User Name"))
+	request.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, password, "Password"))
+
+	id, err := r.Send(request)
+	if err != nil {
+		return err
+	}
+	msg, err := r.readResult(id)
+	if err != nil {
+		return err
+	}
+	if msg.Err != nil {
+		return fmt.Errorf("bind failed: %w", msg.Err)
+	}
+	return nil
+}
+
+// ExternalBind sends a SASL EXTERNAL bind, which authenticates the connection
+// as the identity of the client certificate presented in the TLS handshake
+func (r *RawConn) ExternalBind() error {
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationBindRequest, nil, "Bind Request")
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
+	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "User Name"))
+	sasl := ber.Encode(ber.ClassContext, ber.TypeConstructed, 3, nil, "SASL Credentials")
+	sasl.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "EXTERNAL", "Mechanism"))
+	request.AppendChild(sasl)
+
+	id, err := r.Send(request)
+	if err != nil {
+		return err
+	}
+	msg, err := r.readResult(id)
+	if err != nil {
+		return err
+	}
+	if msg.Err != nil {
+		return fmt.Errorf("SASL EXTERNAL bind failed: %w", msg.Err)
+	}
+	return nil
+}
+
+// SendSearch sends a search request without waiting and returns its message ID
+func (r *RawConn) SendSearch(baseDN string, scope int, filter string, attributes []string) (int64, error) {
+	filterPacket, err := ldap.CompileFilter(filter)
+	if err != nil {
+		return 0, fmt.Errorf("invalid filter: %w", err)
+	}
+	return r.SendSearchFilter(baseDN, scope, filterPacket, attributes)
+}
+
+// SendSearchFilter sends a search request with an already encoded filter,
+// which need not be valid, and returns its message ID
+func (r *RawConn) SendSearchFilter(baseDN string, scope int, filterPacket *ber.Packet, attributes []string) (int64, error) {
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchRequest, nil, "Search Request")
+	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, baseDN, "Base DN"))
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(scope), "Scope"))
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(ldap.NeverDerefAliases), "Deref Aliases"))
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 0, "Size Limit"))
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 0, "Time Limit"))
+	request.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, false, "Types Only"))
+	request.AppendChild(filterPacket)
+	attributesPacket := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for _, attribute := range attributes {
+		attributesPacket.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attribute, "Attribute"))
+	}
+	request.AppendChild(attributesPacket)
+
+	return r.Send(request)
+}
+
+// SendCancel sends an RFC 3909 Cancel extended request for the operation
+// with message ID target and returns the Cancel request's own message ID
+func (r *RawConn) SendCancel(target int64) (int64, error) {
+	value := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Cancel Request Value")
+	value.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, target, "Cancel ID"))
+
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationExtendedRequest, nil, "Extended Request")
+	request.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, OIDCancel, "Request Name"))
+	request.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 1, string(value.Bytes()), "Request Value"))
+
+	return r.Send(request)
+}
+
+// SendAbandon sends an Abandon request for the operation with message ID
+// target. Abandon has no response.
+func (r *RawConn) SendAbandon(target int64) error {
+	request := ber.NewInteger(ber.ClassApplication, ber.TypePrimitive, ldap.ApplicationAbandonRequest, target, "Abandon Request")
+	_, err := r.Send(request)
+	return err
+}
+
+// Read reads the next response, waiting at most timeout
+func (r *RawConn) Read(timeout time.Duration) (*RawMessage, error) {
+	if err := r.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	packet, err := ber.ReadPacket(r.conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(packet.Children) < 2 {
+		return nil, fmt.Errorf("malformed LDAP message")
+	}
+
+	id, ok := packet.Children[0].Value.(int64)
+	if !ok {
+		return nil, fmt.Errorf("malformed LDAP message ID")
+	}
+
+	op := packet.Children[1]
+	msg := &RawMessage{ID: id, Tag: op.Tag}
+
+	switch op.Tag {
+	case ldap.ApplicationSearchResultEntry:
+		if len(op.Children) > 0 {
+			msg.DN = ber.DecodeString(op.Children[0].Data.Bytes())
+		}
+	case ldap.ApplicationSearchResultReference:
+	default:
+		if op.Tag == ldap.ApplicationExtendedResponse {
+			for _, child := range op.Children {
+				if child.ClassType == ber.ClassContext && child.Tag == 10 {
+					msg.OID = ber.DecodeString(child.Data.Bytes())
+				}
+			}
+		}
+		if err := ldap.GetLDAPError(packet); err != nil {
+			var ldapErr *ldap.Error
+			if errors.As(err, &ldapErr) {
+				msg.Code = ldapErr.ResultCode
+			}
+			msg.Err = err
+		}
+	}
+
+	logger.Trace("RawConn", "Received message", "id", msg.ID, "op", ldap.ApplicationMap[uint8(msg.Tag)], "code", msg.Code, "oid", msg.OID)
+	return msg, nil
+}
+
+// IsTimeout reports whether a Read error is a read timeout
+func IsTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Close closes the raw connection without unbinding
+func (r *RawConn) Close() error {
+	if r.closed.CompareAndSwap(false, true) {
+		openConnections.Add(-1)
+	}
+	return r.conn.Close()
+}
+
+// RequestStartTLS sends the StartTLS extended request and waits for its
+// response, without starting the TLS handshake
+func (r *RawConn) RequestStartTLS() (*RawMessage, error) {
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationExtendedRequest, nil, "Start TLS")
+	request.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, OIDStartTLS, "TLS Extended Command"))
+
+	id, err := r.Send(request)
+	if err != nil {
+		return nil, err
+	}
+	return r.readResult(id)
+}
+
+// Handshake performs the TLS handshake after a successful StartTLS
+func (r *RawConn) Handshake() error {
+	tlsConfig, err := buildTLSConfig(r.config, r.host)
+	if err != nil {
+		return fmt.Errorf("failed to build TLS config: %w", err)
+	}
+
+	tlsConn := tls.Client(r.conn, tlsConfig)
+	if err := tlsConn.SetDeadline(time.Now().Add(r.timeout)); err != nil {
+		return err
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("failed to start TLS: %w", err)
+	}
+	r.conn = tlsConn
+	return nil
+}
+
+// TLSState returns the TLS connection state, and false when the connection
+// does not use TLS
+func (r *RawConn) TLSState() (tls.ConnectionState, bool) {
+	tlsConn, ok := r.conn.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	return tlsConn.ConnectionState(), true
+}
+
+// PeerCertificate returns the server's leaf certificate, or nil when the
+// connection does not use TLS
+func (r *RawConn) PeerCertificate() *x509.Certificate {
+	state, ok := r.TLSState()
+	if !ok {
+		return nil
+	}
+	certs := state.PeerCertificates
+	if len(certs) == 0 {
+		return nil
+	}
+	return certs[0]
+}
+
+// Ping reads the root DSE to check that the server still answers on this connection
+func (r *RawConn) Ping() error {
+	id, err := r.SendSearch("", ldap.ScopeBaseObject, "(objectClass=*)", []string{"1.1"})
+	if err != nil {
+		return err
+	}
+	msg, err := r.readResult(id)
+	if err != nil {
+		return err
+	}
+	return msg.Err
+}
+
+// Send wraps a protocol op in an LDAPMessage with the next message ID and
+// sends it without waiting for a response
+func (r *RawConn) Send(op *ber.Packet) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	id := r.nextID
+
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	packet.AppendChild(op)
+
+	if err := r.conn.SetWriteDeadline(time.Now().Add(r.timeout)); err != nil {
+		return 0, err
+	}
+	if _, err := r.conn.Write(packet.Bytes()); err != nil {
+		return 0, fmt.Errorf("failed to send message %d: %w", id, err)
+	}
+
+	logger.Trace("RawConn", "Sent message", "id", id, "op", ldap.ApplicationMap[uint8(op.Tag)])
+	return id, nil
+}
+
+// Write sends data on the connection as it is, so tests can send PDUs that
+// cannot be built as valid packets
+func (r *RawConn) Write(data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.conn.SetWriteDeadline(time.Now().Add(r.timeout)); err != nil {
+		return err
+	}
+	if _, err := r.conn.Write(data); err != nil {
+		return fmt.Errorf("failed to send %d bytes: %w", len(data), err)
+	}
+
+	logger.Trace("RawConn", "Sent raw bytes", "length", len(data))
+	return nil
+}
+
+// readResult reads responses until the result of message id arrives
+func (r *RawConn) readResult(id int64) (*RawMessage, error) {
+	for {
+		msg, err := r.Read(r.timeout)
+		if err != nil {
+			return nil, err
+		}
+		if msg.ID == id && msg.IsResult() {
+			return msg, nil
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+
+	"ldap-automated-actions/internal/ldif"
+	"ldap-automated-actions/internal/logger"
+)
+
+// ErrReadOnly is the error of a write operation refused in read-only mode
+var ErrReadOnly = errors.New("write operation refused in read-only mode")
+
+// refuseWrite returns ErrReadOnly for a write operation of a connection in
+// read-only mode, without sending it. Validation already keeps the writing
+// suites out of such a run; this catches any write that slips through.
+func (c *Connection) refuseWrite(record ldif.Record) error {
+	if !c.config.ReadOnly {
+		return nil
+	}
+	logger.Error("Connection", "Refused write operation in read-only mode", "changeType", record.ChangeType, "dn", record.DN)
+	return fmt.Errorf("%s %s: %w", record.ChangeType, record.DN, ErrReadOnly)
+}
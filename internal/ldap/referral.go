@@ -0,0 +1,203 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ldap-automated-actions/internal/config"
+	"ldap-automated-actions/internal/logger"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// maxReferralHops bounds how many referrals in a row a search follows, so
+// referrals that point at each other end
+const maxReferralHops = 5
+
+// referralURL is a parsed LDAP URL of a referral (RFC 4516). An empty host
+// stands for the server that returned the referral.
+type referralURL struct {
+	tls    bool // ldaps
+	host   string
+	port   int
+	dn     string
+	scope  int // -1 keeps the scope of the search
+	filter string
+}
+
+// parseReferralURL parses an ldap:// or ldaps:// URL of a referral or
+// continuation reference
+func parseReferralURL(raw string) (referralURL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return referralURL{}, fmt.Errorf("invalid referral URL %q: %w", raw, err)
+	}
+
+	ref := referralURL{host: u.Hostname(), dn: strings.TrimPrefix(u.Path, "/"), scope: -1}
+	switch strings.ToLower(u.Scheme) {
+	case "ldap":
+		ref.port = 389
+	case "ldaps":
+		ref.tls = true
+		ref.port = 636
+	default:
+		return referralURL{}, fmt.Errorf("unsupported referral URL %q (must be ldap:// or ldaps://)", raw)
+	}
+	if port := u.Port(); port != "" {
+		if ref.port, err = strconv.Atoi(port); err != nil {
+			return referralURL{}, fmt.Errorf("invalid port in referral URL %q", raw)
+		}
+	}
+
+	// The query is attributes?scope?filter?extensions; only the scope and
+	// filter change what is searched
+	parts := strings.Split(u.RawQuery, "?")
+	if len(parts) > 1 && parts[1] != "" {
+		switch strings.ToLower(parts[1]) {
+		case "base":
+			ref.scope = ldap.ScopeBaseObject
+		case "one":
+			ref.scope = ldap.ScopeSingleLevel
+		case "sub":
+			ref.scope = ldap.ScopeWholeSubtree
+		default:
+			return referralURL{}, fmt.Errorf("invalid scope in referral URL %q", raw)
+		}
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		if ref.filter, err = url.QueryUnescape(parts[2]); err != nil {
+			return referralURL{}, fmt.Errorf("invalid filter in referral URL %q", raw)
+		}
+	}
+	return ref, nil
+}
+
+// ReferralURLs returns the URLs of the referral field of an LDAP result
+// (RFC 4511 section 4.1.10), which go-ldap leaves in the response packet
+func ReferralURLs(err error) []string {
+	var ldapErr *ldap.Error
+	if !errors.As(err, &ldapErr) || ldapErr.Packet == nil || len(ldapErr.Packet.Children) < 2 {
+		return nil
+	}
+
+	var urls []string
+	for _, field := range ldapErr.Packet.Children[1].Children {
+		if field.ClassType != ber.ClassContext || field.Tag != 3 {
+			continue
+		}
+		for _, uri := range field.Children {
+			urls = append(urls, uri.Data.String())
+		}
+	}
+	return urls
+}
+
+// Search runs a search, following its referrals when follow_referrals is set
+func (c *Connection) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	return c.SearchWithReferrals(request, c.config.FollowReferrals)
+}
+
+// SearchWithReferrals runs a search and, if follow is set, follows its
+// referrals: a referral result is replaced by the result of the first of its
+// URLs that can be searched, and the entries found through the continuation
+// references are added to the result. A continuation reference that cannot be
+// followed stays in Referrals.
+func (c *Connection) SearchWithReferrals(request *ldap.SearchRequest, follow bool) (*ldap.SearchResult, error) {
+	result, err := c.conn.Search(request)
+	if !follow {
+		return result, err
+	}
+	return c.followReferrals(request, result, err, 1)
+}
+
+// followReferrals follows the referrals of a result, hop being the number of
+// referrals followed to get it plus one
+func (c *Connection) followReferrals(request *ldap.SearchRequest, result *ldap.SearchResult, err error, hop int) (*ldap.SearchResult, error) {
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultReferral) {
+		if hop > maxReferralHops {
+			logger.Warn("Referral", "Not following referral, too many hops", "dn", request.BaseDN, "hops", maxReferralHops)
+			return result, err
+		}
+		for _, raw := range ReferralURLs(err) {
+			chased, chaseErr := c.chaseReferral(request, raw, hop)
+			if chaseErr == nil {
+				return chased, nil
+			}
+			logger.Warn("Referral", "Failed to follow referral", "url", raw, "error", chaseErr)
+			err = fmt.Errorf("failed to follow referral %s: %w", raw, chaseErr)
+		}
+		return result, err
+	}
+
+	if err != nil || len(result.Referrals) == 0 {
+		return result, err
+	}
+	if hop > maxReferralHops {
+		logger.Warn("Referral", "Not following continuation references, too many hops", "dn", request.BaseDN, "hops", maxReferralHops)
+		return result, nil
+	}
+
+	var unresolved []string
+	for _, raw := range result.Referrals {
+		chased, chaseErr := c.chaseReferral(request, raw, hop)
+		if chaseErr != nil {
+			logger.Warn("Referral", "Failed to follow continuation reference", "url", raw, "error", chaseErr)
+			unresolved = append(unresolved, raw)
+			continue
+		}
+		result.Entries = append(result.Entries, chased.Entries...)
+		unresolved = append(unresolved, chased.Referrals...)
+	}
+	result.Referrals = unresolved
+	return result, nil
+}
+
+// chaseReferral repeats a search against the server a referral URL names, on
+// a connection of its own that binds as configured or stays anonymous, as
+// referral_credentials says. The TLS settings of the configuration apply to
+// the referred server too, and an ldap:// URL is upgraded with StartTLS if the
+// connection that received the referral was encrypted.
+func (c *Connection) chaseReferral(request *ldap.SearchRequest, raw string, hop int) (*ldap.SearchResult, error) {
+	ref, err := parseReferralURL(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	server := config.Server{Host: ref.host, Port: ref.port}
+	cfg := *c.config
+	cfg.StartTLS = !ref.tls && (c.config.UseTLS || c.config.StartTLS)
+	cfg.UseTLS = ref.tls
+	if ref.host == "" {
+		server = c.server
+		cfg = *c.config
+	}
+
+	logger.Debug("Referral", "Following referral", "url", raw, "hop", hop, "credentials", cfg.ReferralCredentials)
+	conn, err := dialServer(&cfg, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if cfg.ReferralCredentials == "reuse" {
+		if err := conn.Bind(); err != nil {
+			return nil, err
+		}
+	}
+
+	chased := *request
+	if ref.dn != "" {
+		chased.BaseDN = ref.dn
+	}
+	if ref.scope >= 0 {
+		chased.Scope = ref.scope
+	}
+	if ref.filter != "" {
+		chased.Filter = ref.filter
+	}
+	result, err := conn.conn.Search(&chased)
+	return conn.followReferrals(&chased, result, err, hop+1)
+}
@@ -0,0 +1,93 @@
+package ldap
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Vendor is the directory server product a connection talks to, as far as
+// its root DSE tells
+type Vendor string
+
+const (
+	VendorUnknown         Vendor = ""
+	VendorOpenLDAP        Vendor = "OpenLDAP"
+	VendorActiveDirectory Vendor = "Active Directory"
+	Vendor389DS           Vendor = "389 Directory Server"
+	VendorApacheDS        Vendor = "ApacheDS"
+	VendorOpenDJ          Vendor = "OpenDJ" // also ForgeRock DS, PingDS and Wren:DS
+	VendorPingDirectory   Vendor = "PingDirectory"
+	VendorEDirectory      Vendor = "eDirectory"
+)
+
+// Capabilities in supportedCapabilities that only Active Directory
+// advertises: AD itself, and AD LDS (formerly ADAM)
+const (
+	oidCapActiveDirectory    = "1.2.840.113556.1.4.800"
+	oidCapActiveDirectoryLDS = "1.2.840.113556.1.4.1851"
+)
+
+// rootDSEVendorAttributes are the root DSE attributes detectVendor looks at
+// besides vendorName and vendorVersion
+var rootDSEVendorAttributes = []string{"objectClass", "supportedCapabilities"}
+
+// vendorNames maps a substring of vendorName or vendorVersion, in lower
+// case, to the product. The first match wins, so the more specific come first.
+var vendorNames = []struct {
+	match  string
+	vendor Vendor
+}{
+	{"openldap", VendorOpenLDAP},
+	{"389 project", Vendor389DS},
+	{"fedora project", Vendor389DS},
+	{"red hat", Vendor389DS},
+	{"apache software foundation", VendorApacheDS},
+	{"apacheds", VendorApacheDS},
+	{"ping identity directory server", VendorPingDirectory},
+	{"unboundid", VendorPingDirectory},
+	{"opendj", VendorOpenDJ},
+	{"forgerock", VendorOpenDJ},
+	{"pingds", VendorOpenDJ},
+	{"wren", VendorOpenDJ},
+	{"novell", VendorEDirectory},
+	{"netiq", VendorEDirectory},
+}
+
+// detectVendor identifies the server from its root DSE. Active Directory has
+// no vendorName but advertises its capability OIDs, and OpenLDAP publishes
+// vendorName only when configured to, but always has the OpenLDAProotDSE
+// object class.
+func detectVendor(rootDSE *ldap.Entry) Vendor {
+	capabilities := rootDSE.GetAttributeValues("supportedCapabilities")
+	if slices.Contains(capabilities, oidCapActiveDirectory) || slices.Contains(capabilities, oidCapActiveDirectoryLDS) {
+		return VendorActiveDirectory
+	}
+	if slices.ContainsFunc(rootDSE.GetAttributeValues("objectClass"), func(class string) bool {
+		return strings.EqualFold(class, "OpenLDAProotDSE")
+	}) {
+		return VendorOpenLDAP
+	}
+
+	vendor := strings.ToLower(rootDSE.GetAttributeValue("vendorName") + " " + rootDSE.GetAttributeValue("vendorVersion"))
+	for _, name := range vendorNames {
+		if strings.Contains(vendor, name.match) {
+			return name.vendor
+		}
+	}
+	return VendorUnknown
+}
+
+// String returns the product name, or "unknown"
+func (v Vendor) String() string {
+	if v == VendorUnknown {
+		return "unknown"
+	}
+	return string(v)
+}
+
+// Vendor returns the server product detected by the health check
+func (c *Connection) Vendor() Vendor {
+	return c.serverInfo.Vendor
+}
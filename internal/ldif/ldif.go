@@ -0,0 +1,349 @@
+package ldif
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ChangeType represents the changetype of an LDIF record
+type ChangeType string
+
+const (
+	ChangeAdd    ChangeType = "add"
+	ChangeModify ChangeType = "modify"
+	ChangeModRDN ChangeType = "modrdn"
+	ChangeDelete ChangeType = "delete"
+)
+
+// Attribute is a named attribute with its values
+type Attribute struct {
+	Name   string
+	Values []string
+}
+
+// Modification is a single add/delete/replace step of a modify record
+type Modification struct {
+	Op        string // add, delete or replace
+	Attribute string
+	Values    []string
+}
+
+// Record represents a single LDIF record (content entry or change record)
+type Record struct {
+	DN         string
+	ChangeType ChangeType
+	Line       int // line number where the record starts
+
+	// Add / content records
+	Attributes []Attribute
+
+	// Modify records
+	Modifications []Modification
+
+	// ModRDN records
+	NewRDN       string
+	DeleteOldRDN bool
+	NewSuperior  string
+}
+
+// AttributeMap returns the record attributes as a map (for add requests and logging)
+func (r *Record) AttributeMap() map[string][]string {
+	attrs := make(map[string][]string, len(r.Attributes))
+	for _, attr := range r.Attributes {
+		attrs[attr.Name] = append(attrs[attr.Name], attr.Values...)
+	}
+	return attrs
+}
+
+// NewDN returns the DN an entry will have after a modrdn record is applied
+func (r *Record) NewDN() string {
+	parent := r.NewSuperior
+	if parent == "" {
+		parent = ParentDN(r.DN)
+	}
+	if parent == "" {
+		return r.NewRDN
+	}
+	return r.NewRDN + "," + parent
+}
+
+// ParseFile reads and parses an LDIF file
+func ParseFile(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open LDIF file: %w", err)
+	}
+	defer file.Close()
+
+	return Parse(file)
+}
+
+// line is an unfolded LDIF line with its original line number
+type line struct {
+	text   string
+	number int
+}
+
+// Parse parses LDIF content (RFC 2849) into records. Records without a
+// changetype are returned as content records with ChangeType set to add.
+func Parse(r io.Reader) ([]Record, error) {
+	blocks, err := readBlocks(r)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(blocks))
+	for i, block := range blocks {
+		// An optional version line may precede the first record
+		if i == 0 && strings.HasPrefix(strings.ToLower(block[0].text), "version:") {
+			block = block[1:]
+			if len(block) == 0 {
+				continue
+			}
+		}
+
+		record, err := parseRecord(block)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// readBlocks splits the input into blank-line separated blocks of unfolded lines
+func readBlocks(r io.Reader) ([][]line, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	blocks := make([][]line, 0)
+	current := make([]line, 0)
+	inComment := false
+	number := 0
+
+	for scanner.Scan() {
+		number++
+		text := strings.TrimRight(scanner.Text(), "\r")
+
+		// Continuation of the previous line
+		if strings.HasPrefix(text, " ") {
+			if inComment {
+				continue
+			}
+			if len(current) == 0 {
+				return nil, fmt.Errorf("line %d: continuation line without a preceding line", number)
+			}
+			current[len(current)-1].text += text[1:]
+			continue
+		}
+		inComment = false
+
+		if text == "" {
+			if len(current) > 0 {
+				blocks = append(blocks, current)
+				current = make([]line, 0)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(text, "#") {
+			inComment = true
+			continue
+		}
+
+		current = append(current, line{text: text, number: number})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read LDIF: %w", err)
+	}
+	if len(current) > 0 {
+		blocks = append(blocks, current)
+	}
+
+	return blocks, nil
+}
+
+// splitLine splits an LDIF line into attribute name and decoded value
+func splitLine(l line) (string, string, error) {
+	idx := strings.Index(l.text, ":")
+	if idx <= 0 {
+		return "", "", fmt.Errorf("line %d: missing attribute separator", l.number)
+	}
+
+	name := l.text[:idx]
+	rest := l.text[idx+1:]
+
+	switch {
+	case strings.HasPrefix(rest, ":"):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return "", "", fmt.Errorf("line %d: invalid base64 value for %s: %w", l.number, name, err)
+		}
+		return name, string(decoded), nil
+	case strings.HasPrefix(rest, "<"):
+		return "", "", fmt.Errorf("line %d: URL values are not supported (%s)", l.number, name)
+	default:
+		return name, strings.TrimLeft(rest, " "), nil
+	}
+}
+
+// parseRecord parses one block of lines into a record
+func parseRecord(block []line) (Record, error) {
+	name, value, err := splitLine(block[0])
+	if err != nil {
+		return Record{}, err
+	}
+	if !strings.EqualFold(name, "dn") {
+		return Record{}, fmt.Errorf("line %d: record must start with dn, got %s", block[0].number, name)
+	}
+
+	record := Record{
+		DN:         value,
+		ChangeType: ChangeAdd,
+		Line:       block[0].number,
+	}
+	body := block[1:]
+
+	if len(body) > 0 && strings.HasPrefix(strings.ToLower(body[0].text), "control:") {
+		return Record{}, fmt.Errorf("line %d: LDIF controls are not supported", body[0].number)
+	}
+
+	if len(body) > 0 {
+		if name, value, err := splitLine(body[0]); err == nil && strings.EqualFold(name, "changetype") {
+			switch strings.ToLower(value) {
+			case "add":
+				record.ChangeType = ChangeAdd
+			case "modify":
+				record.ChangeType = ChangeModify
+			case "modrdn", "moddn":
+				record.ChangeType = ChangeModRDN
+			case "delete":
+				record.ChangeType = ChangeDelete
+			default:
+				return Record{}, fmt.Errorf("line %d: unknown changetype: %s", body[0].number, value)
+			}
+			body = body[1:]
+		}
+	}
+
+	switch record.ChangeType {
+	case ChangeAdd:
+		err = parseAttributes(&record, body)
+	case ChangeModify:
+		err = parseModifications(&record, body)
+	case ChangeModRDN:
+		err = parseModRDN(&record, body)
+	case ChangeDelete:
+		if len(body) > 0 {
+			err = fmt.Errorf("line %d: delete record must not contain attributes", body[0].number)
+		}
+	}
+
+	return record, err
+}
+
+func parseAttributes(record *Record, body []line) error {
+	if len(body) == 0 {
+		return fmt.Errorf("line %d: add record for %s has no attributes", record.Line, record.DN)
+	}
+
+	index := make(map[string]int)
+	for _, l := range body {
+		name, value, err := splitLine(l)
+		if err != nil {
+			return err
+		}
+		key := strings.ToLower(name)
+		if i, ok := index[key]; ok {
+			record.Attributes[i].Values = append(record.Attributes[i].Values, value)
+			continue
+		}
+		index[key] = len(record.Attributes)
+		record.Attributes = append(record.Attributes, Attribute{Name: name, Values: []string{value}})
+	}
+	return nil
+}
+
+func parseModifications(record *Record, body []line) error {
+	var current *Modification
+
+	for _, l := range body {
+		if l.text == "-" {
+			if current == nil {
+				return fmt.Errorf("line %d: unexpected '-' separator", l.number)
+			}
+			record.Modifications = append(record.Modifications, *current)
+			current = nil
+			continue
+		}
+
+		name, value, err := splitLine(l)
+		if err != nil {
+			return err
+		}
+
+		if current == nil {
+			op := strings.ToLower(name)
+			if op != "add" && op != "delete" && op != "replace" {
+				return fmt.Errorf("line %d: expected add, delete or replace, got %s", l.number, name)
+			}
+			current = &Modification{Op: op, Attribute: value}
+			continue
+		}
+
+		if !strings.EqualFold(name, current.Attribute) {
+			return fmt.Errorf("line %d: attribute %s does not match modification of %s", l.number, name, current.Attribute)
+		}
+		current.Values = append(current.Values, value)
+	}
+
+	// The trailing '-' is optional after the last modification
+	if current != nil {
+		record.Modifications = append(record.Modifications, *current)
+	}
+	if len(record.Modifications) == 0 {
+		return fmt.Errorf("line %d: modify record for %s has no modifications", record.Line, record.DN)
+	}
+	return nil
+}
+
+func parseModRDN(record *Record, body []line) error {
+	for _, l := range body {
+		name, value, err := splitLine(l)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(name) {
+		case "newrdn":
+			record.NewRDN = value
+		case "deleteoldrdn":
+			record.DeleteOldRDN = value == "1"
+		case "newsuperior":
+			record.NewSuperior = value
+		default:
+			return fmt.Errorf("line %d: unexpected attribute in modrdn record: %s", l.number, name)
+		}
+	}
+	if record.NewRDN == "" {
+		return fmt.Errorf("line %d: modrdn record for %s is missing newrdn", record.Line, record.DN)
+	}
+	return nil
+}
+
+// ParentDN returns the parent of a DN, honoring escaped commas in the RDN
+func ParentDN(dn string) string {
+	for i := 0; i < len(dn); i++ {
+		switch dn[i] {
+		case '\\':
+			i++ // skip escaped character
+		case ',':
+			return strings.TrimLeft(dn[i+1:], " ")
+		}
+	}
+	return ""
+}
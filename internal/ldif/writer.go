@@ -0,0 +1,137 @@
+package ldif
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxLineLength is the column at which long LDIF lines are folded
+const maxLineLength = 76
+
+// Writer writes LDIF content and change records
+type Writer struct {
+	w       *bufio.Writer
+	records int
+}
+
+// NewWriter creates a new LDIF writer
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteVersion writes the LDIF version line
+func (w *Writer) WriteVersion() error {
+	_, err := w.w.WriteString("version: 1\n\n")
+	return err
+}
+
+// WriteComment writes a comment line
+func (w *Writer) WriteComment(text string) error {
+	_, err := fmt.Fprintf(w.w, "# %s\n", text)
+	return err
+}
+
+// WriteEntry writes a content record (an entry without changetype)
+func (w *Writer) WriteEntry(dn string, attributes []Attribute) error {
+	w.writeLine("dn", dn)
+	for _, attr := range attributes {
+		for _, value := range attr.Values {
+			w.writeLine(attr.Name, value)
+		}
+	}
+	return w.endRecord()
+}
+
+// WriteRecord writes a change record using its changetype
+func (w *Writer) WriteRecord(record Record) error {
+	w.writeLine("dn", record.DN)
+	w.writeLine("changetype", string(record.ChangeType))
+
+	switch record.ChangeType {
+	case ChangeAdd:
+		for _, attr := range record.Attributes {
+			for _, value := range attr.Values {
+				w.writeLine(attr.Name, value)
+			}
+		}
+	case ChangeModify:
+		for _, mod := range record.Modifications {
+			w.writeLine(mod.Op, mod.Attribute)
+			for _, value := range mod.Values {
+				w.writeLine(mod.Attribute, value)
+			}
+			w.w.WriteString("-\n")
+		}
+	case ChangeModRDN:
+		w.writeLine("newrdn", record.NewRDN)
+		if record.DeleteOldRDN {
+			w.writeLine("deleteoldrdn", "1")
+		} else {
+			w.writeLine("deleteoldrdn", "0")
+		}
+		if record.NewSuperior != "" {
+			w.writeLine("newsuperior", record.NewSuperior)
+		}
+	}
+
+	return w.endRecord()
+}
+
+// Records returns the number of records written so far
+func (w *Writer) Records() int {
+	return w.records
+}
+
+// Flush writes any buffered data to the underlying writer
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *Writer) endRecord() error {
+	w.records++
+	if _, err := w.w.WriteString("\n"); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+// writeLine writes an attribute line, base64-encoding unsafe values and
+// folding lines longer than maxLineLength
+func (w *Writer) writeLine(name, value string) {
+	var text string
+	if isSafeString(value) {
+		text = name + ": " + value
+	} else {
+		text = name + ":: " + base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	for len(text) > maxLineLength {
+		w.w.WriteString(text[:maxLineLength] + "\n")
+		text = " " + text[maxLineLength:]
+	}
+	w.w.WriteString(text + "\n")
+}
+
+// isSafeString reports whether a value can be written as an RFC 2849 SAFE-STRING
+func isSafeString(value string) bool {
+	if value == "" {
+		return true
+	}
+	switch value[0] {
+	case ' ', ':', '<':
+		return false
+	}
+	if strings.HasSuffix(value, " ") {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == 0 || c == '\n' || c == '\r' || c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -13,6 +13,10 @@ import (
 
 var log *logrus.Logger
 
+// output is the console and log file output set up by Initialize, which a
+// run log adds its file to
+var output io.Writer
+
 // LogLevel represents the logging level
 type LogLevel string
 
@@ -48,8 +52,8 @@ func Initialize(level string, logFile string) error {
 	}
 
 	// Create a multi-writer to write to both console and file
-	multiWriter := io.MultiWriter(os.Stdout, file)
-	log.SetOutput(multiWriter)
+	output = io.MultiWriter(os.Stdout, file)
+	log.SetOutput(output)
 
 	// Set custom formatter with timestamps and colors for console
 	log.SetFormatter(&CustomFormatter{
@@ -60,6 +64,27 @@ func Initialize(level string, logFile string) error {
 	return nil
 }
 
+// StartRunLog also writes the log to path until the returned function is
+// called, so each scheduled run has a log file of its own
+func StartRunLog(path string) (stop func(), err error) {
+	if log == nil {
+		return nil, fmt.Errorf("logger is not initialized")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create run log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run log: %w", err)
+	}
+
+	log.SetOutput(io.MultiWriter(output, file))
+	return func() {
+		log.SetOutput(output)
+		file.Close()
+	}, nil
+}
+
 // CustomFormatter is a custom logrus formatter with color support
 type CustomFormatter struct {
 	TimestampFormat string
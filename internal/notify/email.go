@@ -0,0 +1,226 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Email sends the report of a run to a distribution list over SMTP
+type Email struct {
+	Host     string
+	Port     int
+	Security string // starttls, tls (implicit TLS, usually port 465) or none
+	Username string // no authentication if empty
+	Password string
+	From     string
+	To       []string
+
+	Report     string // console report, sent as the body
+	HTMLReport []byte // HTML report attached as report.html, if set
+}
+
+func (e *Email) Name() string {
+	return "email " + net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+func (e *Email) Notify(summary Summary) error {
+	message, err := e.message(summary)
+	if err != nil {
+		return fmt.Errorf("failed to compose message: %w", err)
+	}
+	return e.send(message)
+}
+
+// subject returns e.g. "[ldap-test] FAILED: 3 of 42 tests on ldap://ldap.example.com:389"
+func subject(summary Summary) string {
+	var status string
+	switch summary.Status {
+	case "pass":
+		status = fmt.Sprintf("PASSED: %d tests", summary.Summary.Total)
+	case "fail":
+		status = fmt.Sprintf("FAILED: %d of %d tests", summary.Summary.Failed, summary.Summary.Total)
+	default:
+		status = "ERROR: run could not execute"
+	}
+	if summary.Server != "" {
+		status += " on " + summary.Server
+	}
+	return "[ldap-test] " + status
+}
+
+// message composes the mail: the summary and console report as text, with
+// the HTML report attached if there is one
+func (e *Email) message(summary Summary) ([]byte, error) {
+	var text bytes.Buffer
+	fmt.Fprintf(&text, "Status:   %s\n", strings.ToUpper(summary.Status))
+	if summary.Error != "" {
+		fmt.Fprintf(&text, "Error:    %s\n", summary.Error)
+	}
+	fmt.Fprintf(&text, "Run ID:   %s\n", summary.RunID)
+	if summary.Iteration > 0 {
+		fmt.Fprintf(&text, "Iteration: %d\n", summary.Iteration)
+	}
+	fmt.Fprintf(&text, "Hostname: %s\n", summary.Hostname)
+	text.WriteString(e.Report)
+
+	var msg bytes.Buffer
+	header := textproto.MIMEHeader{}
+	header.Set("From", e.From)
+	header.Set("To", strings.Join(e.To, ", "))
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", subject(summary)))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", "<"+uuid.NewString()+"@ldap-test>")
+	header.Set("MIME-Version", "1.0")
+
+	if e.HTMLReport == nil {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeMailHeader(&msg, header)
+		if err := writeQuotedPrintable(&msg, text.Bytes()); err != nil {
+			return nil, err
+		}
+		return msg.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&msg)
+	header.Set("Content-Type", "multipart/mixed; boundary="+parts.Boundary())
+	writeMailHeader(&msg, header)
+
+	body, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(body, text.Bytes()); err != nil {
+		return nil, err
+	}
+
+	attachment, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {`attachment; filename="report.html"`},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(e.HTMLReport)
+	for len(encoded) > 76 {
+		fmt.Fprintf(attachment, "%s\r\n", encoded[:76])
+		encoded = encoded[76:]
+	}
+	fmt.Fprintf(attachment, "%s\r\n", encoded)
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// writeMailHeader writes the header fields in the usual order, then the blank
+// line that ends the header
+func writeMailHeader(msg *bytes.Buffer, header textproto.MIMEHeader) {
+	for _, key := range []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type", "Content-Transfer-Encoding"} {
+		if value := header.Get(key); value != "" {
+			fmt.Fprintf(msg, "%s: %s\r\n", key, value)
+		}
+	}
+	msg.WriteString("\r\n")
+}
+
+// writeQuotedPrintable writes text with CRLF line endings, as SMTP requires
+func writeQuotedPrintable(w io.Writer, text []byte) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write(bytes.ReplaceAll(text, []byte("\n"), []byte("\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// send delivers the message to the recipients through the SMTP server
+func (e *Email) send(message []byte) error {
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	dialer := &net.Dialer{Timeout: timeout}
+	tlsConfig := &tls.Config{ServerName: e.Host}
+
+	var conn net.Conn
+	var err error
+	if e.Security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	// Bound the whole exchange, not just the dial
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if e.Security == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if e.Username != "" {
+		// PlainAuth refuses to send the password over an unencrypted
+		// connection to anything but localhost
+		if err := client.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(address(e.From)); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err := client.Rcpt(address(to)); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// address returns the bare address of "Name <user@example.com>"
+func address(addr string) string {
+	if parsed, err := mail.ParseAddress(addr); err == nil {
+		return parsed.Address
+	}
+	return addr
+}
@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// timeout bounds the POST of a notification, so an unreachable alerting
+// system cannot hold up the next loop iteration
+const timeout = 10 * time.Second
+
+// Summary is the outcome of a run or loop iteration as sent to the notifiers
+type Summary struct {
+	Event       string       `json:"event"` // always run_complete
+	RunID       string       `json:"run_id"`
+	Iteration   int          `json:"iteration,omitempty"`
+	Hostname    string       `json:"hostname"`
+	Server      string       `json:"server"`
+	TestSuite   string       `json:"test_suite"`
+	Status      string       `json:"status"` // pass, fail, or error if the run could not execute
+	Error       string       `json:"error,omitempty"`
+	Interrupted bool         `json:"interrupted"`
+	StartTime   time.Time    `json:"start_time"`
+	EndTime     time.Time    `json:"end_time"`
+	DurationMS  int64        `json:"duration_ms"`
+	Summary     Counts       `json:"summary"`
+	FailedTests []FailedTest `json:"failed_tests"`
+}
+
+// Counts are the test counts of a run
+type Counts struct {
+	Total       int `json:"total"`
+	Passed      int `json:"passed"`
+	Failed      int `json:"failed"`
+	Skipped     int `json:"skipped"`
+	NotExecuted int `json:"not_executed"`
+}
+
+// FailedTest is a test that failed in the run
+type FailedTest struct {
+	Name      string `json:"name"`
+	Operation string `json:"operation"`
+	Worker    int    `json:"worker,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// Failed reports whether a test failed or the run could not execute
+func (s Summary) Failed() bool {
+	return s.Status != "pass"
+}
+
+// Notifier sends the summary of a finished run to an external system
+type Notifier interface {
+	// Name identifies the notifier in logs; webhook URLs often embed a
+	// token, so it shows only their host
+	Name() string
+	Notify(summary Summary) error
+}
+
+// nameOf returns kind with the host of webhookURL
+func nameOf(kind, webhookURL string) string {
+	if u, err := url.Parse(webhookURL); err == nil && u.Host != "" {
+		return kind + " " + u.Host
+	}
+	return kind
+}
+
+// post sends body to webhookURL, failing on any status other than 2xx
+func post(webhookURL, contentType string, body []byte) error {
+	// The run context may be cancelled already, and an interrupted run is
+	// worth notifying about too
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("invalid webhook URL")
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Leave the URL out of the error, like out of the log
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Services such as Slack explain a rejected payload in the body
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		if text := strings.TrimSpace(string(reason)); text != "" {
+			return fmt.Errorf("webhook returned %s: %s", resp.Status, text)
+		}
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// slackMaxFailures is the number of failed tests listed in a message; a
+	// run with the directory down fails them all
+	slackMaxFailures = 10
+	// slackMaxText is the length Slack accepts in the text of a section block
+	slackMaxText = 3000
+	// slackMaxLine bounds a failed test with a long LDAP diagnostic message
+	slackMaxLine = 200
+)
+
+// Slack posts a formatted summary to a Slack incoming webhook
+type Slack struct {
+	WebhookURL string
+}
+
+// NewSlack returns a notifier posting to the incoming webhook webhookURL
+func NewSlack(webhookURL string) *Slack {
+	return &Slack{WebhookURL: webhookURL}
+}
+
+func (s *Slack) Name() string {
+	return nameOf("slack", s.WebhookURL)
+}
+
+func (s *Slack) Notify(summary Summary) error {
+	body, err := json.Marshal(slackMessage(summary))
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	return post(s.WebhookURL, "application/json", body)
+}
+
+// slackBlock is a Block Kit block of a message
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Fields   []slackText `json:"fields,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"` // always mrkdwn
+	Text string `json:"text"`
+}
+
+// slackPayload is the body of an incoming webhook message; text is shown in
+// notifications and by clients that cannot render the blocks
+type slackPayload struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+func mrkdwn(text string) slackText {
+	return slackText{Type: "mrkdwn", Text: text}
+}
+
+// slackMessage formats the summary as a headline, the counts, and the error
+// or the failed tests
+func slackMessage(summary Summary) slackPayload {
+	var icon, headline string
+	switch summary.Status {
+	case "pass":
+		icon, headline = ":white_check_mark:", "LDAP tests passed"
+	case "fail":
+		icon, headline = ":x:", "LDAP tests failed"
+	default:
+		icon, headline = ":warning:", "LDAP test run could not execute"
+	}
+	if summary.Interrupted {
+		headline += " (interrupted)"
+	}
+	counts := summary.Summary
+	tests := fmt.Sprintf("%d passed, %d failed, %d skipped", counts.Passed, counts.Failed, counts.Skipped)
+
+	// A run that could not connect has no server
+	text, title := headline, icon+" *"+headline+"*"
+	if summary.Server != "" {
+		text += " on " + slackEscape(summary.Server)
+		title += " on `" + slackEscape(summary.Server) + "`"
+	}
+	if summary.Error != "" {
+		text += ": " + slackEscape(truncate(summary.Error, slackMaxLine))
+	} else {
+		text += ": " + tests
+	}
+	if counts.NotExecuted > 0 {
+		tests += fmt.Sprintf(", %d not executed", counts.NotExecuted)
+	}
+	heading := mrkdwn(title)
+	blocks := []slackBlock{
+		{Type: "section", Text: &heading},
+		{Type: "section", Fields: []slackText{
+			mrkdwn("*Suite*\n" + slackEscape(summary.TestSuite)),
+			mrkdwn("*Tests*\n" + tests),
+			mrkdwn("*Duration*\n" + (time.Duration(summary.DurationMS) * time.Millisecond).String()),
+			mrkdwn("*Host*\n" + slackEscape(summary.Hostname)),
+		}},
+	}
+
+	if summary.Error != "" {
+		detail := mrkdwn("*Error*\n```" + truncate(slackEscape(summary.Error), slackMaxText-20) + "```")
+		blocks = append(blocks, slackBlock{Type: "section", Text: &detail})
+	}
+	if len(summary.FailedTests) > 0 {
+		lines := []string{"*Failed tests*"}
+		for i, test := range summary.FailedTests {
+			if i == slackMaxFailures {
+				lines = append(lines, fmt.Sprintf("…and %d more", len(summary.FailedTests)-i))
+				break
+			}
+			line := fmt.Sprintf("• %s (%s)", test.Name, test.Operation)
+			reason := test.Error
+			if reason == "" {
+				reason = test.Message
+			}
+			if reason != "" {
+				line += ": " + reason
+			}
+			lines = append(lines, slackEscape(truncate(line, slackMaxLine)))
+		}
+		failed := mrkdwn(truncate(strings.Join(lines, "\n"), slackMaxText))
+		blocks = append(blocks, slackBlock{Type: "section", Text: &failed})
+	}
+
+	context := "Run " + summary.RunID
+	if summary.Iteration > 0 {
+		context += fmt.Sprintf(" · iteration %d", summary.Iteration)
+	}
+	blocks = append(blocks, slackBlock{Type: "context", Elements: []slackText{mrkdwn(context)}})
+
+	return slackPayload{Text: text, Blocks: blocks}
+}
+
+// slackEscape escapes the characters Slack treats as markup
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// truncate shortens text to at most n runes
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "…"
+}
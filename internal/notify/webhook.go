@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Webhook POSTs the summary as a JSON document to a URL of the user's choice
+type Webhook struct {
+	URL string
+}
+
+// NewWebhook returns a notifier POSTing to url
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url}
+}
+
+func (w *Webhook) Name() string {
+	return nameOf("webhook", w.URL)
+}
+
+func (w *Webhook) Notify(summary Summary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	return post(w.URL, "application/json", body)
+}
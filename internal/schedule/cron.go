@@ -0,0 +1,198 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression with the five standard fields:
+// minute, hour, day of month, month and day of week
+type Schedule struct {
+	expr   string
+	minute uint64 // bit n set if minute n matches
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDom bool // day of month is *, so only the day of week restricts days
+	anyDow bool // day of week is *, so only the day of month restricts days
+}
+
+// field describes the range and names of one cron field
+type field struct {
+	name  string
+	min   int
+	max   int
+	names []string // names of min, min+1, ... (e.g. JAN for month 1)
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}}
+	dowField    = field{name: "day of week", min: 0, max: 7, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}}
+)
+
+// macros are the shorthands for common schedules
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression such as "*/5 * * * *". Each field is *, a
+// value, a range (1-5) or a list of them (1,3,5), optionally with a step
+// (*/15, 0-30/10); months and days of week may be given by name (JAN, MON).
+// When both the day of month and the day of week are restricted, a day
+// matching either matches, as in cron.
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, ok := macros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields (minute hour day-of-month month day-of-week), got %d", expr, len(fields))
+	}
+
+	s := &Schedule{expr: expr, anyDom: fields[2] == "*", anyDow: fields[4] == "*"}
+	targets := []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, f := range []field{minuteField, hourField, domField, monthField, dowField} {
+		bits, err := f.parse(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", expr, err)
+		}
+		*targets[i] = bits
+	}
+
+	// Sunday is both 0 and 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	if s.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid schedule %q: never matches", expr)
+	}
+	return s, nil
+}
+
+// parse returns the bits of the values a field matches
+func (f field) parse(spec string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(spec, ",") {
+		rangeSpec, stepSpec, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepSpec)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %s field: %s", f.name, part)
+			}
+			step = n
+		}
+
+		var low, high int
+		switch {
+		case rangeSpec == "*":
+			low, high = f.min, f.max
+		case strings.Contains(rangeSpec, "-"):
+			lowSpec, highSpec, _ := strings.Cut(rangeSpec, "-")
+			var err error
+			if low, err = f.value(lowSpec); err != nil {
+				return 0, err
+			}
+			if high, err = f.value(highSpec); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range in %s field: %s", f.name, part)
+			}
+		default:
+			n, err := f.value(rangeSpec)
+			if err != nil {
+				return 0, err
+			}
+			low, high = n, n
+			if hasStep {
+				high = f.max // 5/15 means from 5 on, every 15
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// value parses one number or name of a field
+func (f field) value(spec string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(spec, name) {
+			return f.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid value in %s field: %s (must be %d-%d)", f.name, spec, f.min, f.max)
+	}
+	return n, nil
+}
+
+// String returns the expression the schedule was parsed from
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the first matching minute after t, in t's location
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// A satisfiable schedule matches within a few years (29 February every
+	// 4 to 8), so give up on impossible dates such as 30 February rather
+	// than search forever
+	limit := t.AddDate(30, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchesDay reports whether the day of t matches the day of month and day
+// of week fields
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDom && s.anyDow:
+		return true
+	case s.anyDom:
+		return dow
+	case s.anyDow:
+		return dom
+	default:
+		return dom || dow
+	}
+}
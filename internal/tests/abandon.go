@@ -11,124 +11,392 @@ import (
 )
 
 // TestAbandon runs all abandon operation tests
-func TestAbandon(conn *ldap.Connection, baseDN string) []TestResult {
+func TestAbandon(conn *ldap.Connection, baseDN string, h *Harness) []TestResult {
 	logger.Info("AbandonTest", "Starting Abandon operation tests")
-	results := make([]TestResult, 0)
 
-	// Test 1: Abandon a search operation
-	results = append(results, testAbandonSearch(conn, baseDN))
+	results := h.Execute([]TestCase{
+		// Test 1: Cancel an in-flight search (RFC 3909), falling back to Abandon
+		{Name: "Cancel - Cancel In-Flight Search Test", Operation: "Abandon", Run: func() TestResult { return testCancelSearch(conn, baseDN) }},
+
+		// Test 2: Abandon an in-flight search by its message ID
+		{Name: "Abandon - Abandon In-Flight Search Test", Operation: "Abandon", Run: func() TestResult { return testAbandonSearch(conn, baseDN) }},
+	})
 
 	logger.Info("AbandonTest", "Completed Abandon operation tests", "total", len(results))
 	return results
 }
 
-func testAbandonSearch(conn *ldap.Connection, baseDN string) TestResult {
-	testName := "Abandon - Cancel Search Operation Test"
+// cancelTimeout bounds how long the cancel test waits for the server's responses
+const cancelTimeout = 10 * time.Second
+
+func testCancelSearch(conn *ldap.Connection, baseDN string) TestResult {
+	testName := "Cancel - Cancel In-Flight Search Test"
 	logger.Info("AbandonTest", "Running: "+testName)
 
-	// Create a search that might take some time (large scope)
+	result := TestResult{
+		Name:      testName,
+		Operation: "Abandon",
+	}
+
+	// go-ldap does not expose message IDs, so use a raw connection
+	raw, err := conn.OpenRaw()
+	if skipRawUnsupported(&result, "AbandonTest", err) {
+		return result
+	}
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to open raw connection: %v", err)
+		logger.Error("AbandonTest", result.Message)
+		return result
+	}
+	defer raw.Close()
+
+	// Start a long search over the whole tree
 	filter := "(objectClass=*)"
 	attributes := []string{"*"}
-
-	logger.Trace("Abandon", "Starting search to abandon")
 	logger.LogSearchOperation("Abandon", baseDN, filter, "sub", attributes)
 
-	searchRequest := ldaplib.NewSearchRequest(
-		baseDN,
-		ldaplib.ScopeWholeSubtree,
-		ldaplib.NeverDerefAliases,
-		0, 0, false,
-		filter,
-		attributes,
-		nil,
-	)
-
-	// Start a search in a goroutine
-	searchChan := make(chan error, 1)
 	start := time.Now()
+	searchID, err := raw.SendSearch(baseDN, ldaplib.ScopeWholeSubtree, filter, attributes)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to send search: %v", err)
+		logger.Error("AbandonTest", result.Message)
+		return result
+	}
+	logger.Trace("Abandon", "Search sent", "messageID", searchID)
 
-	go func() {
-		_, err := conn.GetConnection().Search(searchRequest)
-		searchChan <- err
-	}()
-
-	// Give it a moment to start
-	time.Sleep(10 * time.Millisecond)
-
-	// Now abandon it (Note: the go-ldap library doesn't expose message IDs easily,
-	// so we'll demonstrate the concept even though we can't fully test it)
-	// In a real scenario, we would need the message ID from the search
-	logger.Trace("Abandon", "Attempting to abandon operation")
-
-	// Since we can't easily get the message ID with go-ldap/v3,
-	// we'll document this limitation
-	duration := time.Since(start)
-
-	// Wait for search to complete or timeout
-	select {
-	case err := <-searchChan:
-		result := TestResult{
-			Name:      testName,
-			Operation: "Abandon",
-			Duration:  duration,
-		}
+	// Wait for the first entry so the search is known to be in flight
+	first, err := raw.Read(cancelTimeout)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("No response to search: %v", err)
+		logger.Error("AbandonTest", result.Message)
+		return result
+	}
+	if first.ID == searchID && first.IsResult() {
+		result.Duration = time.Since(start)
+		result.Skipped = true
+		result.Message = "Skipped: search completed before it could be cancelled (base DN has too few entries)"
+		logger.Warn("AbandonTest", "SKIP: "+testName, "reason", result.Message)
+		return result
+	}
 
-		// Note: go-ldap/v3 doesn't provide easy access to Abandon functionality with message IDs
-		result.Passed = true
-		result.Message = "Abandon operation test completed (Note: go-ldap/v3 has limited Abandon support)"
+	if !conn.GetServerInfo().SupportsExtension(ldap.OIDCancel) {
+		logger.Info("AbandonTest", "Server does not advertise the Cancel extended operation, falling back to Abandon")
+		return abandonFallback(raw, searchID, result, start, "Cancel not advertised by the server")
+	}
+
+	logger.Trace("Abandon", "Operation: Cancel", "cancelID", searchID)
+	cancelID, err := raw.SendCancel(searchID)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to send cancel request: %v", err)
+		logger.Error("AbandonTest", result.Message)
+		return result
+	}
+
+	// Read until both the search and the cancel request have completed
+	var searchDone, cancelDone *ldap.RawMessage
+	for searchDone == nil || cancelDone == nil {
+		msg, err := raw.Read(cancelTimeout)
 		if err != nil {
-			logger.Debug("AbandonTest", "Search completed with error", "error", err)
-		} else {
-			logger.Debug("AbandonTest", "Search completed successfully")
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Search or cancel did not complete: %v", err)
+			logger.Error("AbandonTest", result.Message)
+			return result
+		}
+		switch {
+		case msg.ID == searchID && msg.IsResult():
+			searchDone = msg
+		case msg.ID == cancelID:
+			cancelDone = msg
 		}
 
-		logger.Info("AbandonTest", "PASS: "+testName, "duration", duration)
-		logger.Warn("AbandonTest", "Note: Full Abandon testing requires lower-level LDAP protocol access")
+		// Cancel rejected while the search is still running: abandon it instead
+		if searchDone == nil && cancelDone != nil && isCancelUnsupported(cancelDone.Code) {
+			logger.Info("AbandonTest", "Server rejected the Cancel extended operation, falling back to Abandon", "code", cancelDone.Code)
+			return abandonFallback(raw, searchID, result, start, fmt.Sprintf("Cancel rejected (%s)", ldaplib.LDAPResultCodeMap[cancelDone.Code]))
+		}
+	}
+	result.Duration = time.Since(start)
+	logger.LogLDAPResult("Abandon", "Cancel", cancelDone.Code == ldaplib.LDAPResultSuccess, int(cancelDone.Code), ldaplib.LDAPResultCodeMap[cancelDone.Code], result.Duration)
 
+	switch cancelDone.Code {
+	case ldaplib.LDAPResultSuccess:
+		if searchDone.Code != ldaplib.LDAPResultCanceled {
+			result.Passed = false
+			result.Message = fmt.Sprintf("Cancel succeeded but search ended with %s, expected canceled (118)", ldaplib.LDAPResultCodeMap[searchDone.Code])
+			logger.Error("AbandonTest", result.Message)
+			return result
+		}
+		result.Passed = true
+		result.Message = fmt.Sprintf("Search (message %d) was cancelled and terminated with canceled (118)", searchID)
+		logger.Info("AbandonTest", "PASS: "+testName, "duration", result.Duration)
+
+	case ldaplib.LDAPResultTooLate, ldaplib.LDAPResultNoSuchOperation:
+		result.Skipped = true
+		result.Message = fmt.Sprintf("Skipped: search completed before the cancel was processed (%s)", ldaplib.LDAPResultCodeMap[cancelDone.Code])
+		logger.Warn("AbandonTest", "SKIP: "+testName, "reason", result.Message)
+
+	case ldaplib.LDAPResultProtocolError, ldaplib.LDAPResultUnwillingToPerform:
+		// Rejected after the search had already completed
+		result.Skipped = true
+		result.Message = fmt.Sprintf("Skipped: server rejected the Cancel extended operation (%s)", ldaplib.LDAPResultCodeMap[cancelDone.Code])
+		logger.Warn("AbandonTest", "SKIP: "+testName, "reason", result.Message)
+
+	default:
+		result.Passed = false
+		result.Error = cancelDone.Err
+		result.Message = fmt.Sprintf("Cancel failed: %v", cancelDone.Err)
+		logger.Error("AbandonTest", result.Message)
+	}
+
+	return result
+}
+
+func testAbandonSearch(conn *ldap.Connection, baseDN string) TestResult {
+	testName := "Abandon - Abandon In-Flight Search Test"
+	logger.Info("AbandonTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Abandon",
+	}
+
+	raw, err := conn.OpenRaw()
+	if skipRawUnsupported(&result, "AbandonTest", err) {
 		return result
+	}
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to open raw connection: %v", err)
+		logger.Error("AbandonTest", result.Message)
+		return result
+	}
+	defer raw.Close()
+
+	filter := "(objectClass=*)"
+	attributes := []string{"*"}
+	logger.LogSearchOperation("Abandon", baseDN, filter, "sub", attributes)
+
+	start := time.Now()
+	searchID, err := raw.SendSearch(baseDN, ldaplib.ScopeWholeSubtree, filter, attributes)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to send search: %v", err)
+		logger.Error("AbandonTest", result.Message)
+		return result
+	}
 
-	case <-time.After(5 * time.Second):
-		// Timeout
-		result := TestResult{
-			Name:      testName,
-			Operation: "Abandon",
-			Duration:  time.Since(start),
-			Passed:    true,
-			Message:   "Abandon test completed (search timed out as expected)",
+	// Wait for the first entry so the search is known to be in flight
+	first, err := raw.Read(cancelTimeout)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("No response to search: %v", err)
+		logger.Error("AbandonTest", result.Message)
+		return result
+	}
+	if first.ID == searchID && first.IsResult() {
+		result.Duration = time.Since(start)
+		result.Skipped = true
+		result.Message = "Skipped: search completed before it could be abandoned (base DN has too few entries)"
+		logger.Warn("AbandonTest", "SKIP: "+testName, "reason", result.Message)
+		return result
+	}
+
+	logger.Trace("Abandon", "Operation: Abandon", "messageID", searchID)
+	if err := raw.SendAbandon(searchID); err != nil {
+		result.Duration = time.Since(start)
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to send abandon request: %v", err)
+		logger.Error("AbandonTest", result.Message)
+		return result
+	}
+
+	entries, done, err := awaitAbandoned(raw, searchID)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Abandoned search did not stop: %v", err)
+		logger.Error("AbandonTest", result.Message)
+		return result
+	}
+	if done {
+		result.Duration = time.Since(start)
+		result.Skipped = true
+		result.Message = "Skipped: search completed before the abandon was processed"
+		logger.Warn("AbandonTest", "SKIP: "+testName, "reason", result.Message)
+		return result
+	}
+
+	// The connection must remain usable and must not deliver the abandoned search
+	verifyID, err := raw.SendSearch(baseDN, ldaplib.ScopeBaseObject, filter, []string{"1.1"})
+	if err == nil {
+		for {
+			var msg *ldap.RawMessage
+			msg, err = raw.Read(cancelTimeout)
+			if err != nil {
+				break
+			}
+			if msg.ID == searchID {
+				err = fmt.Errorf("received a %s for the abandoned search", ldaplib.ApplicationMap[uint8(msg.Tag)])
+				break
+			}
+			if msg.ID == verifyID && msg.IsResult() {
+				err = msg.Err
+				break
+			}
 		}
-		logger.Info("AbandonTest", "PASS: "+testName+" (timeout)", "duration", result.Duration)
+	}
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Connection not usable after abandon: %v", err)
+		logger.Error("AbandonTest", result.Message)
 		return result
 	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Search (message %d) was abandoned; no result followed (%d entries already in flight)", searchID, entries)
+	logger.Info("AbandonTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// isCancelUnsupported reports result codes of servers that do not implement Cancel
+func isCancelUnsupported(code uint16) bool {
+	return code == ldaplib.LDAPResultProtocolError || code == ldaplib.LDAPResultUnwillingToPerform
+}
+
+// abandonFallback abandons the in-flight search where Cancel is unsupported
+// and checks that the server stops sending results for it
+func abandonFallback(raw *ldap.RawConn, searchID int64, result TestResult, start time.Time, reason string) TestResult {
+	logger.Trace("Abandon", "Operation: Abandon", "messageID", searchID)
+	if err := raw.SendAbandon(searchID); err != nil {
+		result.Duration = time.Since(start)
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to send abandon request: %v", err)
+		logger.Error("AbandonTest", result.Message)
+		return result
+	}
+
+	entries, done, err := awaitAbandoned(raw, searchID)
+	result.Duration = time.Since(start)
+
+	switch {
+	case err != nil:
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Connection failed after abandon: %v", err)
+		logger.Error("AbandonTest", result.Message)
+	case done:
+		result.Skipped = true
+		result.Message = fmt.Sprintf("Skipped: %s, and the search completed before the abandon was processed", reason)
+		logger.Warn("AbandonTest", "SKIP: "+result.Name, "reason", result.Message)
+	default:
+		result.Passed = true
+		result.Message = fmt.Sprintf("%s; search (message %d) was abandoned instead (%d entries already in flight)", reason, searchID, entries)
+		logger.Info("AbandonTest", "PASS: "+result.Name+" (abandon fallback)", "duration", result.Duration)
+	}
+	return result
+}
+
+// abandonQuietPeriod is how long an abandoned search must stay silent
+const abandonQuietPeriod = 2 * time.Second
+
+// awaitAbandoned drains responses after an abandon until the connection has
+// been quiet for abandonQuietPeriod. It returns the number of entries still
+// received and whether the search nevertheless sent its final result.
+func awaitAbandoned(raw *ldap.RawConn, searchID int64) (entries int, done bool, err error) {
+	deadline := time.Now().Add(cancelTimeout)
+	for time.Now().Before(deadline) {
+		msg, err := raw.Read(abandonQuietPeriod)
+		if ldap.IsTimeout(err) {
+			return entries, false, nil
+		}
+		if err != nil {
+			return entries, false, err
+		}
+		if msg.ID != searchID {
+			continue
+		}
+		if msg.IsResult() {
+			return entries, true, nil
+		}
+		entries++
+	}
+	return entries, false, fmt.Errorf("search kept sending results %s after abandon", cancelTimeout)
 }
 
-// TestUnbind runs unbind operation test
-func TestUnbind(conn *ldap.Connection) []TestResult {
-	logger.Info("UnbindTest", "Starting Unbind operation test")
-	results := make([]TestResult, 0)
+// FixtureUnbound is the dedicated connection of the unbind suite once it sent
+// its unbind request
+const FixtureUnbound = "unbound connection"
+
+// TestUnbind runs the unbind operation tests on a dedicated connection opened
+// with open, so unbinding does not take a connection away from other suites
+func TestUnbind(open func() (*ldap.Connection, error), h *Harness) []TestResult {
+	logger.Info("UnbindTest", "Starting Unbind operation tests")
 
-	// Test: Unbind operation
-	results = append(results, testUnbind(conn))
+	conn, err := open()
+	if err == nil {
+		// Unbind closes the connection, but Close keeps the open connection count right
+		defer conn.Close()
+	}
 
-	logger.Info("UnbindTest", "Completed Unbind operation test", "total", len(results))
+	results := h.Execute([]TestCase{
+		// Test 1: Unbind operation
+		{Name: "Unbind Operation Test", Operation: "Unbind", Provides: FixtureUnbound, Run: func() TestResult { return testUnbind(conn, err) }},
+
+		// Test 2: The server must not answer on the connection after the unbind
+		{Name: "Unbind - Operations Fail After Unbind Test", Operation: "Unbind", Requires: []string{FixtureUnbound}, Run: func() TestResult {
+			return testOperationAfterUnbind(conn)
+		}},
+	})
+
+	logger.Info("UnbindTest", "Completed Unbind operation tests", "total", len(results))
 	return results
 }
 
-func testUnbind(conn *ldap.Connection) TestResult {
+func testUnbind(conn *ldap.Connection, openErr error) TestResult {
 	testName := "Unbind Operation Test"
 	logger.Info("UnbindTest", "Running: "+testName)
 
-	logger.Trace("Unbind", "Operation: Unbind")
-
-	start := time.Now()
-	err := conn.Unbind()
-	duration := time.Since(start)
-
 	result := TestResult{
 		Name:      testName,
 		Operation: "Unbind",
-		Duration:  duration,
 	}
 
+	if openErr != nil {
+		result.Passed = false
+		result.Error = openErr
+		result.Message = fmt.Sprintf("Failed to open dedicated connection: %v", openErr)
+		logger.Error("UnbindTest", result.Message)
+		return result
+	}
+
+	logger.Trace("Unbind", "Operation: Unbind")
+
+	start := time.Now()
+	err := conn.Unbind()
+	result.Duration = time.Since(start)
+
 	if err != nil {
 		result.Passed = false
 		result.Error = err
@@ -137,8 +405,40 @@ func testUnbind(conn *ldap.Connection) TestResult {
 	} else {
 		result.Passed = true
 		result.Message = "Successfully sent unbind request and closed connection"
-		logger.Info("UnbindTest", "PASS: "+testName, "duration", duration)
+		logger.Info("UnbindTest", "PASS: "+testName, "duration", result.Duration)
+	}
+
+	return result
+}
+
+func testOperationAfterUnbind(conn *ldap.Connection) TestResult {
+	testName := "Unbind - Operations Fail After Unbind Test"
+	logger.Info("UnbindTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Unbind",
+	}
+
+	// A base search of the root DSE needs no access rights, so only the
+	// unbind can make it fail
+	searchRequest := ldaplib.NewSearchRequest("", ldaplib.ScopeBaseObject, ldaplib.NeverDerefAliases, 1, 0, false,
+		"(objectClass=*)", []string{"1.1"}, nil)
+	logger.LogSearchOperation("Unbind", "", searchRequest.Filter, "base", searchRequest.Attributes)
+
+	start := time.Now()
+	_, err := conn.GetConnection().Search(searchRequest)
+	result.Duration = time.Since(start)
+
+	if err == nil {
+		result.Passed = false
+		result.Message = "Search succeeded on the connection after unbind, expected it to be closed"
+		logger.Error("UnbindTest", result.Message)
+		return result
 	}
 
+	result.Passed = true
+	result.Message = fmt.Sprintf("Search after unbind failed as expected: %v", err)
+	logger.Info("UnbindTest", "PASS: "+testName, "duration", result.Duration)
 	return result
 }
@@ -0,0 +1,222 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/config"
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// TestACL verifies the access matrix from the configuration by binding as
+// each identity and probing every expectation
+func TestACL(conn *ldap.Connection, matrix []config.ACLIdentity, h *Harness) []TestResult {
+	logger.Info("ACLTest", "Starting ACL expectation tests", "identities", len(matrix))
+
+	var cases []TestCase
+	for _, identity := range matrix {
+		for _, expectation := range identity.Expectations {
+			identity, expectation := identity, expectation
+			name := aclTestName(identity, expectation)
+			cases = append(cases, TestCase{Name: name, Operation: "ACL", Run: func() TestResult { return testACLExpectation(conn, identity, expectation) }})
+		}
+	}
+	if len(cases) == 0 {
+		logger.Info("ACLTest", "No access matrix configured (acl_matrix), nothing to verify")
+	}
+
+	results := h.Execute(cases)
+
+	logger.Info("ACLTest", "Completed ACL expectation tests", "total", len(results))
+	return results
+}
+
+func aclTestName(identity config.ACLIdentity, expectation config.ACLExpectation) string {
+	who := identity.Identity
+	if identity.IsAnonymous() {
+		who = "anonymous"
+	}
+	target := expectation.DN
+	if expectation.Attribute != "" {
+		target = expectation.Attribute + " of " + target
+	}
+	return fmt.Sprintf("ACL %s: %s %s", who, expectation.Access, target)
+}
+
+func testACLExpectation(conn *ldap.Connection, identity config.ACLIdentity, expectation config.ACLExpectation) TestResult {
+	testName := aclTestName(identity, expectation)
+	logger.Info("ACLTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "ACL",
+	}
+
+	start := time.Now()
+	identityConn, err := bindIdentity(conn, identity)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to bind as identity: %v", err)
+		logger.Error("ACLTest", result.Message)
+		return result
+	}
+	defer identityConn.Close()
+
+	canRead, err := probeRead(identityConn, expectation.DN, expectation.Attribute)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Read probe failed: %v", err)
+		logger.Error("ACLTest", result.Message)
+		return result
+	}
+
+	canWrite := false
+	if expectation.Attribute != "" {
+		canWrite, err = probeWrite(conn, identityConn, expectation.DN, expectation.Attribute)
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Write probe failed: %v", err)
+			logger.Error("ACLTest", result.Message)
+			return result
+		}
+	}
+	result.Duration = time.Since(start)
+
+	actual := "none"
+	switch {
+	case canWrite:
+		actual = "write"
+	case canRead:
+		actual = "read"
+	}
+	logger.Debug("ACLTest", "Probed access", "identity", identity.Identity, "dn", expectation.DN, "attribute", expectation.Attribute, "read", canRead, "write", canWrite)
+
+	if actual != expectation.Access {
+		result.Passed = false
+		result.Message = fmt.Sprintf("Expected %s access, but identity has %s access (read: %t, write: %t)", expectation.Access, actual, canRead, canWrite)
+		logger.Error("ACLTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Access is %s as expected", actual)
+	logger.Info("ACLTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// bindIdentity opens a new connection to the server of conn, bound as the identity
+func bindIdentity(conn *ldap.Connection, identity config.ACLIdentity) (*ldap.Connection, error) {
+	identityCfg := *conn.GetConfig()
+	identityCfg.BindMethod = "simple"
+	identityCfg.BindDN = identity.Identity
+	identityCfg.BindPassword = identity.Password
+
+	if identity.PasswordFile != "" {
+		password, err := os.ReadFile(identity.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password file: %w", err)
+		}
+		identityCfg.BindPassword = strings.TrimSpace(string(password))
+	}
+
+	identityConn, err := ldap.NewConnection(&identityCfg)
+	if err != nil {
+		return nil, err
+	}
+	identityConn.SetAuditLog(conn.AuditLog())
+	identityConn.SetPlan(conn.Plan())
+
+	if identity.IsAnonymous() {
+		logger.Trace("ACL", "Operation: Anonymous Bind")
+		err = identityConn.GetConnection().UnauthenticatedBind("")
+	} else {
+		err = identityConn.Bind()
+	}
+	if err != nil {
+		identityConn.Close()
+		return nil, err
+	}
+	return identityConn, nil
+}
+
+// probeRead reports whether the entry (or the attribute, when given) is visible
+func probeRead(conn *ldap.Connection, dn, attribute string) (bool, error) {
+	attributes := []string{"1.1"}
+	if attribute != "" {
+		attributes = []string{attribute}
+	}
+	logger.LogSearchOperation("ACL", dn, "(objectClass=*)", "base", attributes)
+
+	searchRequest := ldaplib.NewSearchRequest(
+		dn,
+		ldaplib.ScopeBaseObject,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		attributes,
+		nil,
+	)
+
+	start := time.Now()
+	result, err := conn.GetConnection().Search(searchRequest)
+	duration := time.Since(start)
+
+	if ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultNoSuchObject) || ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultInsufficientAccessRights) {
+		logger.LogLDAPResult("ACL", "Search", false, -1, err.Error(), duration)
+		return false, nil
+	}
+	if err != nil {
+		logger.LogLDAPResult("ACL", "Search", false, -1, err.Error(), duration)
+		return false, err
+	}
+	logger.LogSearchResult("ACL", len(result.Entries), duration)
+
+	if len(result.Entries) == 0 {
+		return false, nil
+	}
+	if attribute == "" {
+		return true, nil
+	}
+	return len(result.Entries[0].GetEqualFoldAttributeValues(attribute)) > 0, nil
+}
+
+// probeWrite reports whether the identity may modify the attribute. The
+// attribute is replaced with its current values, read by the admin
+// connection, so a permitted write leaves the data unchanged.
+func probeWrite(admin, conn *ldap.Connection, dn, attribute string) (bool, error) {
+	entry, err := readEntry(admin, dn)
+	if err != nil {
+		return false, err
+	}
+	values := entry.GetEqualFoldAttributeValues(attribute)
+
+	logger.Trace("ACL", "Operation: Modify (replace with current values)", "dn", dn, "attribute", attribute, "values", len(values))
+	modifyRequest := ldaplib.NewModifyRequest(dn, nil)
+	modifyRequest.Replace(attribute, values)
+
+	start := time.Now()
+	err = conn.Modify(modifyRequest)
+	duration := time.Since(start)
+
+	if ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultInsufficientAccessRights) {
+		logger.LogLDAPResult("ACL", "Modify", false, int(ldaplib.LDAPResultInsufficientAccessRights), err.Error(), duration)
+		return false, nil
+	}
+	if err != nil {
+		logger.LogLDAPResult("ACL", "Modify", false, -1, err.Error(), duration)
+		return false, err
+	}
+	logger.LogLDAPResult("ACL", "Modify", true, 0, "Success", duration)
+	return true, nil
+}
@@ -0,0 +1,408 @@
+package tests
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"ldap-automated-actions/internal/config"
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// Fixtures of the Active Directory suite
+const (
+	FixtureActiveDirectory = "Active Directory"      // the server was detected as AD
+	FixtureADUser          = "AD test user"          // created by the AD suite
+	FixtureADPassword      = "AD test user password" // set by the AD suite
+	FixtureADEnabled       = "enabled AD test user"  // enabled by the AD suite
+)
+
+// userAccountControl flags (MS-ADTS 2.2.16)
+const (
+	uacAccountDisable = 0x0002
+	uacNormalAccount  = 0x0200
+)
+
+// oidMatchingRuleBitAnd is LDAP_MATCHING_RULE_BIT_AND, which matches when all
+// bits of the assertion value are set in the attribute
+const oidMatchingRuleBitAnd = "1.2.840.113556.1.4.803"
+
+// adUser is the account the AD suite creates and works on
+type adUser struct {
+	dn       string
+	sam      string
+	domain   string // DNS domain of the naming context, the UPN suffix
+	password string // set by the unicodePwd test
+}
+
+// TestAD runs the Active Directory specific tests. On other servers they are
+// all skipped.
+func TestAD(conn *ldap.Connection, baseDN, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
+	logger.Info("ADTest", "Starting Active Directory tests")
+
+	if vendor := conn.Vendor(); vendor != ldap.VendorActiveDirectory {
+		h.Fail(FixtureActiveDirectory, fmt.Sprintf("server detected as %s", vendor))
+	} else {
+		h.Provide(FixtureActiveDirectory)
+	}
+
+	// sAMAccountName is unique in the whole domain and at most 20 characters
+	sam := fmt.Sprintf("ldaptest-%08x", rand.Uint32())
+	user := &adUser{
+		dn:     fmt.Sprintf("cn=%s,%s", sam, testBaseDN),
+		sam:    sam,
+		domain: dnsDomain(baseDN),
+	}
+
+	results := h.Execute([]TestCase{
+		// Test 1: Create a user with sAMAccountName and userPrincipalName
+		{Name: "AD - Create User Test", Operation: "AD", Requires: []string{FixtureActiveDirectory}, Provides: FixtureADUser, Run: func() TestResult {
+			return testADCreateUser(conn, user, trk)
+		}},
+
+		// Test 2: Set the password through unicodePwd, which needs an encrypted connection
+		{Name: "AD - Set unicodePwd Test", Operation: "AD", Requires: []string{FixtureADUser}, Provides: FixtureADPassword, Run: func() TestResult {
+			return testADSetPassword(conn, user)
+		}},
+
+		// Test 3: Enable the account in userAccountControl and bind as it
+		{Name: "AD - Enable Account Test", Operation: "AD", Requires: []string{FixtureADPassword}, Provides: FixtureADEnabled, Run: func() TestResult {
+			return testADToggleAccount(conn, user, true)
+		}},
+
+		// Test 4: Disable the account again; its bind must be rejected
+		{Name: "AD - Disable Account Test", Operation: "AD", Requires: []string{FixtureADEnabled}, Run: func() TestResult {
+			return testADToggleAccount(conn, user, false)
+		}},
+
+		// Test 5: Find the account by its disabled flag with LDAP_MATCHING_RULE_BIT_AND
+		{Name: "AD - Bitwise AND Matching Rule Search Test", Operation: "AD", Requires: []string{FixtureADUser}, Run: func() TestResult {
+			return testADBitAndSearch(conn, testBaseDN, user)
+		}},
+	})
+
+	logger.Info("ADTest", "Completed Active Directory tests", "total", len(results))
+	return results
+}
+
+func testADCreateUser(conn *ldap.Connection, user *adUser, trk *tracker.Tracker) TestResult {
+	testName := "AD - Create User Test"
+	logger.Info("ADTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "AD",
+	}
+
+	if user.domain == "" {
+		result.Passed = false
+		result.Message = "Cannot derive a userPrincipalName suffix, the base DN has no dc components"
+		logger.Error("ADTest", result.Message)
+		return result
+	}
+
+	upn := user.sam + "@" + user.domain
+	// Without a password the account is created disabled, with
+	// userAccountControl set by the server
+	attributes := map[string][]string{
+		"objectClass":       {"top", "person", "organizationalPerson", "user"},
+		"cn":                {user.sam},
+		"sn":                {"LDAP Test"},
+		"sAMAccountName":    {user.sam},
+		"userPrincipalName": {upn},
+	}
+	addRequest := ldaplib.NewAddRequest(user.dn, nil)
+	for attr, values := range attributes {
+		addRequest.Attribute(attr, values)
+	}
+
+	logger.Trace("AD", "Operation: Add", "dn", user.dn, "sAMAccountName", user.sam, "userPrincipalName", upn)
+	start := time.Now()
+	err := createEntry(conn, addRequest)
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to create user: %v", err)
+		logger.LogLDAPResult("AD", "Add", false, -1, err.Error(), result.Duration)
+		logger.Error("ADTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("AD", "Add", true, 0, "Success", result.Duration)
+	trk.Track(user.dn, tracker.TypeUser)
+
+	if err := verifyAdded(conn, user.dn, attributes); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("User created but read back differs: %v", err)
+		logger.Error("ADTest", result.Message)
+		return result
+	}
+
+	uac, err := readUserAccountControl(conn, user.dn)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("User created but userAccountControl could not be read: %v", err)
+		logger.Error("ADTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("User %s created, userAccountControl %d (%s)", upn, uac, accountState(uac))
+	logger.Info("ADTest", "PASS: "+testName, "dn", user.dn, "userAccountControl", uac, "duration", result.Duration)
+	return result
+}
+
+func testADSetPassword(conn *ldap.Connection, user *adUser) TestResult {
+	testName := "AD - Set unicodePwd Test"
+	logger.Info("ADTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "AD",
+	}
+
+	// AD refuses password changes over an unencrypted connection
+	cfg := conn.GetConfig()
+	if !cfg.UseTLS && !cfg.StartTLS {
+		logger.Warn("ADTest", "SKIP: "+testName, "reason", "unicodePwd can only be set over LDAPS or StartTLS")
+		result.Skipped = true
+		result.Message = "Skipped: unicodePwd can only be set over LDAPS or StartTLS"
+		return result
+	}
+
+	password, err := generatePassword()
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to generate password: %v", err)
+		logger.Error("ADTest", result.Message)
+		return result
+	}
+
+	modifyRequest := ldaplib.NewModifyRequest(user.dn, nil)
+	modifyRequest.Replace("unicodePwd", []string{encodeUnicodePwd(password)})
+
+	logger.Trace("AD", "Operation: Modify (unicodePwd)", "dn", user.dn)
+	start := time.Now()
+	err = conn.Modify(modifyRequest)
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to set unicodePwd: %v", err)
+		logger.LogLDAPResult("AD", "Modify (unicodePwd)", false, -1, err.Error(), result.Duration)
+		logger.Error("ADTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("AD", "Modify (unicodePwd)", true, 0, "Success", result.Duration)
+	user.password = password
+
+	result.Passed = true
+	result.Message = "Password set through unicodePwd"
+	logger.Info("ADTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// testADToggleAccount enables or disables the account through the
+// ACCOUNTDISABLE flag of userAccountControl, checks the flag on read back and
+// that a bind as the account succeeds only while it is enabled
+func testADToggleAccount(conn *ldap.Connection, user *adUser, enable bool) TestResult {
+	testName := "AD - Disable Account Test"
+	uac := uacNormalAccount | uacAccountDisable
+	if enable {
+		testName = "AD - Enable Account Test"
+		uac = uacNormalAccount
+	}
+	logger.Info("ADTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "AD",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("ADTest", result.Message)
+		return result
+	}
+
+	modifyRequest := ldaplib.NewModifyRequest(user.dn, nil)
+	modifyRequest.Replace("userAccountControl", []string{strconv.Itoa(uac)})
+
+	logger.Trace("AD", "Operation: Modify (userAccountControl)", "dn", user.dn, "userAccountControl", uac)
+	start := time.Now()
+	err := conn.Modify(modifyRequest)
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		logger.LogLDAPResult("AD", "Modify (userAccountControl)", false, -1, err.Error(), result.Duration)
+		return fail(err, fmt.Sprintf("Failed to set userAccountControl to %d: %v", uac, err))
+	}
+	logger.LogLDAPResult("AD", "Modify (userAccountControl)", true, 0, "Success", result.Duration)
+
+	got, err := readUserAccountControl(conn, user.dn)
+	if err != nil {
+		return fail(err, fmt.Sprintf("userAccountControl set but could not be read back: %v", err))
+	}
+	if disabled := got&uacAccountDisable != 0; disabled == enable {
+		return fail(nil, fmt.Sprintf("userAccountControl set to %d but reads back as %d (%s)", uac, got, accountState(got)))
+	}
+
+	userConn, err := bindIdentity(conn, config.ACLIdentity{Identity: user.dn, Password: user.password})
+	switch {
+	case enable && err != nil:
+		return fail(err, fmt.Sprintf("Account enabled but bind as it failed: %v", err))
+	case !enable && err == nil:
+		userConn.Close()
+		return fail(nil, "Account disabled but bind as it still succeeds")
+	case err == nil:
+		userConn.Close()
+	}
+
+	bind := "succeeded"
+	if !enable {
+		if bind = rejection(err); bind == "" {
+			bind = fmt.Sprintf("rejected (%v)", err)
+		}
+	}
+	result.Passed = true
+	result.Message = fmt.Sprintf("userAccountControl %d (%s), bind as the account %s", got, accountState(got), bind)
+	logger.Info("ADTest", "PASS: "+testName, "userAccountControl", got, "duration", result.Duration)
+	return result
+}
+
+// testADBitAndSearch searches for the account with a bitwise AND filter on
+// the ACCOUNTDISABLE flag and with its negation; exactly the one matching the
+// flag read back must find it, whichever state the earlier tests left it in
+func testADBitAndSearch(conn *ldap.Connection, testBaseDN string, user *adUser) TestResult {
+	testName := "AD - Bitwise AND Matching Rule Search Test"
+	logger.Info("ADTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "AD",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("ADTest", result.Message)
+		return result
+	}
+
+	uac, err := readUserAccountControl(conn, user.dn)
+	if err != nil {
+		return fail(err, fmt.Sprintf("Failed to read userAccountControl: %v", err))
+	}
+	disabled := uac&uacAccountDisable != 0
+
+	bitAnd := fmt.Sprintf("(userAccountControl:%s:=%d)", oidMatchingRuleBitAnd, uacAccountDisable)
+	for _, query := range []struct {
+		filter string
+		match  bool
+	}{
+		{filter: bitAnd, match: disabled},
+		{filter: "(!" + bitAnd + ")", match: !disabled},
+	} {
+		filter := andFilter(eqFilter("sAMAccountName", user.sam), query.filter)
+		searchRequest := ldaplib.NewSearchRequest(
+			testBaseDN,
+			ldaplib.ScopeWholeSubtree,
+			ldaplib.NeverDerefAliases,
+			0, 0, false,
+			filter,
+			[]string{"dn"},
+			nil,
+		)
+
+		logger.Trace("AD", "Operation: Search (bitwise AND)", "base", testBaseDN, "filter", filter)
+		start := time.Now()
+		sr, err := conn.GetConnection().Search(searchRequest)
+		duration := time.Since(start)
+		result.Duration += duration
+
+		if err != nil {
+			logger.LogLDAPResult("AD", "Search (bitwise AND)", false, -1, err.Error(), duration)
+			return fail(err, fmt.Sprintf("Search with %s failed: %v", filter, err))
+		}
+		logger.LogLDAPResult("AD", "Search (bitwise AND)", true, 0, "Success", duration)
+
+		if found := len(sr.Entries) == 1; found != query.match {
+			return fail(nil, fmt.Sprintf("Search with %s returned %d entries for userAccountControl %d (%s)", query.filter, len(sr.Entries), uac, accountState(uac)))
+		}
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Bitwise AND filter matches userAccountControl %d (%s), its negation does not", uac, accountState(uac))
+	if !disabled {
+		result.Message = fmt.Sprintf("Negated bitwise AND filter matches userAccountControl %d (%s), the filter does not", uac, accountState(uac))
+	}
+	logger.Info("ADTest", "PASS: "+testName, "userAccountControl", uac, "duration", result.Duration)
+	return result
+}
+
+// readUserAccountControl returns the userAccountControl of an entry
+func readUserAccountControl(conn *ldap.Connection, dn string) (int, error) {
+	entry, err := readAttributes(conn, dn, "userAccountControl")
+	if err != nil {
+		return 0, err
+	}
+	value := entry.GetEqualFoldAttributeValue("userAccountControl")
+	uac, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid userAccountControl %q of %s", value, dn)
+	}
+	return uac, nil
+}
+
+// accountState describes the ACCOUNTDISABLE flag of a userAccountControl
+func accountState(uac int) string {
+	if uac&uacAccountDisable != 0 {
+		return "disabled"
+	}
+	return "enabled"
+}
+
+// encodeUnicodePwd encodes a password as unicodePwd expects it: the password
+// in double quotes, in UTF-16LE
+func encodeUnicodePwd(password string) string {
+	units := utf16.Encode([]rune(`"` + password + `"`))
+	b := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return string(b)
+}
+
+// dnsDomain returns the DNS domain of an AD naming context, e.g. example.com
+// for dc=example,dc=com, or "" if the DN has no dc components
+func dnsDomain(baseDN string) string {
+	dn, err := ldaplib.ParseDN(baseDN)
+	if err != nil {
+		return ""
+	}
+	var labels []string
+	for _, rdn := range dn.RDNs {
+		for _, attr := range rdn.Attributes {
+			if strings.EqualFold(attr.Type, "dc") {
+				labels = append(labels, attr.Value)
+			}
+		}
+	}
+	return strings.Join(labels, ".")
+}
@@ -2,8 +2,11 @@ package tests
 
 import (
 	"fmt"
+	"math/rand"
+	"sort"
 	"time"
 
+	"ldap-automated-actions/internal/config"
 	"ldap-automated-actions/internal/ldap"
 	"ldap-automated-actions/internal/logger"
 	"ldap-automated-actions/internal/tracker"
@@ -12,24 +15,28 @@ import (
 )
 
 // TestAdd runs all add operation tests
-func TestAdd(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) []TestResult {
+func TestAdd(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
 	logger.Info("AddTest", "Starting Add operation tests")
-	results := make([]TestResult, 0)
 
-	// Test 1: Add an OU
-	results = append(results, testAddOU(conn, testBaseDN, trk))
+	results := h.Execute([]TestCase{
+		// Test 1: Add an OU
+		{Name: "Add OU Test", Operation: "Add", Run: func() TestResult { return testAddOU(conn, testBaseDN, trk) }},
 
-	// Test 2: Add a user
-	results = append(results, testAddUser(conn, testBaseDN, trk))
+		// Test 2: Add a user
+		{Name: "Add User Test", Operation: "Add", Provides: FixtureTestUser, Run: func() TestResult { return testAddUser(conn, testBaseDN, trk) }},
 
-	// Test 3: Add a group
-	results = append(results, testAddGroup(conn, testBaseDN, trk))
+		// Test 3: Add a group
+		{Name: "Add Group Test", Operation: "Add", Provides: FixtureTestGroup, Run: func() TestResult { return testAddGroup(conn, testBaseDN, trk) }},
 
-	// Test 4: Try to add duplicate entry (should fail)
-	results = append(results, testAddDuplicate(conn, testBaseDN))
+		// Test 4: Try to add duplicate entry (should fail)
+		{Name: "Add Duplicate Entry Test (Negative)", Operation: "Add", Requires: []string{FixtureTestUser}, Run: func() TestResult { return testAddDuplicate(conn, testBaseDN) }},
 
-	// Test 5: Try to add entry with missing required attributes
-	results = append(results, testAddMissingAttributes(conn, testBaseDN))
+		// Test 5: Try to add entry with missing required attributes
+		{Name: "Add Entry with Missing Required Attributes Test (Negative)", Operation: "Add", Run: func() TestResult { return testAddMissingAttributes(conn, testBaseDN) }},
+
+		// Test 6: Try to add a second entry with the value of a unique attribute (if unique_attribute is set)
+		{Name: "Add Attribute Uniqueness Test (Negative)", Operation: "Add", Run: func() TestResult { return testAddUniqueAttribute(conn, testBaseDN, trk) }},
+	})
 
 	logger.Info("AddTest", "Completed Add operation tests", "total", len(results))
 	return results
@@ -58,7 +65,7 @@ func testAddOU(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) T
 		addRequest.Attribute(attr, values)
 	}
 
-	err := conn.GetConnection().Add(addRequest)
+	err := createEntry(conn, addRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -74,13 +81,21 @@ func testAddOU(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) T
 		logger.LogLDAPResult("Add", "Add", false, -1, err.Error(), duration)
 		logger.Error("AddTest", result.Message)
 	} else {
-		result.Passed = true
-		result.Message = fmt.Sprintf("Successfully added OU: %s", dn)
 		logger.LogLDAPResult("Add", "Add", true, 0, "Success", duration)
-		logger.Info("AddTest", "PASS: "+testName, "dn", dn, "duration", duration)
 
-		// Track the created entry
+		// Track the created entry, even if it does not read back as written
 		trk.Track(dn, tracker.TypeOU)
+
+		if err := verifyAdded(conn, dn, attributes); err != nil {
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Add returned success but read-back failed: %v", err)
+			logger.Error("AddTest", result.Message)
+		} else {
+			result.Passed = true
+			result.Message = fmt.Sprintf("Successfully added OU: %s (verified by read-back)", dn)
+			logger.Info("AddTest", "PASS: "+testName, "dn", dn, "duration", duration)
+		}
 	}
 
 	return result
@@ -90,17 +105,10 @@ func testAddUser(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker)
 	testName := "Add User Test"
 	logger.Info("AddTest", "Running: "+testName)
 
-	cn := "testuser"
-	dn := fmt.Sprintf("cn=%s,%s", cn, testBaseDN)
-
-	attributes := map[string][]string{
-		"objectClass": {"inetOrgPerson"},
-		"cn":          {cn},
-		"sn":          {"User"},
-		"givenName":   {"Test"},
-		"mail":        {"testuser@example.com"},
-		"userPassword": {"TestPassword123!"},
-		"description": {"Test user created by automated tests"},
+	dn, attributes, err := testUserEntry(conn.GetConfig(), testBaseDN)
+	if err != nil {
+		logger.Error("AddTest", "Failed to apply the user entry template", "error", err)
+		return TestResult{Name: testName, Operation: "Add", Error: err, Message: fmt.Sprintf("Failed to apply the user entry template: %v", err)}
 	}
 
 	start := time.Now()
@@ -113,7 +121,7 @@ func testAddUser(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker)
 		addRequest.Attribute(attr, values)
 	}
 
-	err := conn.GetConnection().Add(addRequest)
+	err = createEntry(conn, addRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -129,13 +137,21 @@ func testAddUser(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker)
 		logger.LogLDAPResult("Add", "Add", false, -1, err.Error(), duration)
 		logger.Error("AddTest", result.Message)
 	} else {
-		result.Passed = true
-		result.Message = fmt.Sprintf("Successfully added user: %s", dn)
 		logger.LogLDAPResult("Add", "Add", true, 0, "Success", duration)
-		logger.Info("AddTest", "PASS: "+testName, "dn", dn, "duration", duration)
 
-		// Track the created entry
+		// Track the created entry, even if it does not read back as written
 		trk.Track(dn, tracker.TypeUser)
+
+		if err := verifyAdded(conn, dn, attributes); err != nil {
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Add returned success but read-back failed: %v", err)
+			logger.Error("AddTest", result.Message)
+		} else {
+			result.Passed = true
+			result.Message = fmt.Sprintf("Successfully added user: %s (verified by read-back)", dn)
+			logger.Info("AddTest", "PASS: "+testName, "dn", dn, "duration", duration)
+		}
 	}
 
 	return result
@@ -145,14 +161,10 @@ func testAddGroup(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker
 	testName := "Add Group Test"
 	logger.Info("AddTest", "Running: "+testName)
 
-	cn := "testgroup"
-	dn := fmt.Sprintf("cn=%s,%s", cn, testBaseDN)
-
-	attributes := map[string][]string{
-		"objectClass": {"groupOfNames"},
-		"cn":          {cn},
-		"description": {"Test group created by automated tests"},
-		"member":      {fmt.Sprintf("cn=testuser,%s", testBaseDN)}, // Reference the user we created
+	dn, attributes, err := testGroupEntry(conn.GetConfig(), testBaseDN)
+	if err != nil {
+		logger.Error("AddTest", "Failed to apply the group entry template", "error", err)
+		return TestResult{Name: testName, Operation: "Add", Error: err, Message: fmt.Sprintf("Failed to apply the group entry template: %v", err)}
 	}
 
 	start := time.Now()
@@ -165,7 +177,7 @@ func testAddGroup(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker
 		addRequest.Attribute(attr, values)
 	}
 
-	err := conn.GetConnection().Add(addRequest)
+	err = createEntry(conn, addRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -181,18 +193,105 @@ func testAddGroup(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker
 		logger.LogLDAPResult("Add", "Add", false, -1, err.Error(), duration)
 		logger.Error("AddTest", result.Message)
 	} else {
-		result.Passed = true
-		result.Message = fmt.Sprintf("Successfully added group: %s", dn)
 		logger.LogLDAPResult("Add", "Add", true, 0, "Success", duration)
-		logger.Info("AddTest", "PASS: "+testName, "dn", dn, "duration", duration)
 
-		// Track the created entry
+		// Track the created entry, even if it does not read back as written
 		trk.Track(dn, tracker.TypeGroup)
+
+		if err := verifyAdded(conn, dn, attributes); err != nil {
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Add returned success but read-back failed: %v", err)
+			logger.Error("AddTest", result.Message)
+		} else {
+			result.Passed = true
+			result.Message = fmt.Sprintf("Successfully added group: %s (verified by read-back)", dn)
+			logger.Info("AddTest", "PASS: "+testName, "dn", dn, "duration", duration)
+		}
 	}
 
 	return result
 }
 
+// testUserEntry returns the DN and attributes of the test user, the
+// FixtureTestUser entry, shaped by the user entry template
+func testUserEntry(cfg *config.Config, testBaseDN string) (string, map[string][]string, error) {
+	cn := "testuser"
+	attributes, err := cfg.EntryTemplate("user").Apply(map[string][]string{
+		"objectClass":  {"inetOrgPerson"},
+		"cn":           {cn},
+		"sn":           {"User"},
+		"givenName":    {"Test"},
+		"mail":         {"testuser@example.com"},
+		"userPassword": {"TestPassword123!"},
+		"description":  {"Test user created by automated tests"},
+	}, "cn", config.EntryTemplateData{
+		CN:        cn,
+		GivenName: "Test",
+		Surname:   "User",
+		Mail:      "testuser@example.com",
+		Domain:    "example.com",
+		Index:     1,
+	}, rand.New(rand.NewSource(time.Now().UnixNano())))
+	return fmt.Sprintf("cn=%s,%s", cn, testBaseDN), attributes, err
+}
+
+// testGroupEntry returns the DN and attributes of the test group, the
+// FixtureTestGroup entry, which has the test user as its member, shaped by
+// the group entry template
+func testGroupEntry(cfg *config.Config, testBaseDN string) (string, map[string][]string, error) {
+	cn := "testgroup"
+	attributes, err := cfg.EntryTemplate("group").Apply(map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {cn},
+		"description": {"Test group created by automated tests"},
+		"member":      {fmt.Sprintf("cn=testuser,%s", testBaseDN)},
+	}, "cn", config.EntryTemplateData{
+		CN:     cn,
+		Domain: "example.com",
+		Index:  1,
+	}, rand.New(rand.NewSource(time.Now().UnixNano())))
+	return fmt.Sprintf("cn=%s,%s", cn, testBaseDN), attributes, err
+}
+
+// createEntry adds a fixture entry. With a reused test OU the entry may be
+// left over from an earlier run, so it is upserted instead.
+func createEntry(conn *ldap.Connection, request *ldaplib.AddRequest) error {
+	if conn.GetConfig().ReuseTestOU != "" {
+		return conn.Upsert(request)
+	}
+	return conn.Add(request)
+}
+
+// verifyAdded reads a new entry back with a base search and checks that every
+// written value round-trips. Hashed attributes are skipped, since the server
+// stores them rewritten.
+func verifyAdded(conn *ldap.Connection, dn string, attributes map[string][]string) error {
+	entry, err := readEntry(conn, dn)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if isHashedAttribute(name) {
+			continue
+		}
+		for _, value := range attributes[name] {
+			if !hasValue(entry, name, value) {
+				return fmt.Errorf("attribute %s is missing value %q", name, value)
+			}
+		}
+	}
+	logger.Debug("AddTest", "Read-back matches the written attributes", "dn", dn)
+	return nil
+}
+
 func testAddDuplicate(conn *ldap.Connection, testBaseDN string) TestResult {
 	testName := "Add Duplicate Entry Test (Negative)"
 	logger.Info("AddTest", "Running: "+testName)
@@ -215,7 +314,7 @@ func testAddDuplicate(conn *ldap.Connection, testBaseDN string) TestResult {
 		addRequest.Attribute(attr, values)
 	}
 
-	err := conn.GetConnection().Add(addRequest)
+	err := conn.Add(addRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -250,6 +349,17 @@ func testAddMissingAttributes(conn *ldap.Connection, testBaseDN string) TestResu
 	testName := "Add Entry with Missing Required Attributes Test (Negative)"
 	logger.Info("AddTest", "Running: "+testName)
 
+	vendor := conn.Vendor()
+	if vendor == ldap.VendorActiveDirectory {
+		logger.Warn("AddTest", "SKIP: "+testName, "reason", "sn is optional in the Active Directory schema")
+		return TestResult{
+			Name:      testName,
+			Operation: "Add",
+			Skipped:   true,
+			Message:   "Skipped: Active Directory does not require sn for inetOrgPerson",
+		}
+	}
+
 	cn := "incomplete-user"
 	dn := fmt.Sprintf("cn=%s,%s", cn, testBaseDN)
 
@@ -268,7 +378,7 @@ func testAddMissingAttributes(conn *ldap.Connection, testBaseDN string) TestResu
 		addRequest.Attribute(attr, values)
 	}
 
-	err := conn.GetConnection().Add(addRequest)
+	err := conn.Add(addRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -277,8 +387,14 @@ func testAddMissingAttributes(conn *ldap.Connection, testBaseDN string) TestResu
 		Duration:  duration,
 	}
 
-	// This test SHOULD fail - we expect an error
-	if err != nil {
+	// This test SHOULD fail - we expect an error, with the code the server is known to use
+	expected, known := schemaViolationCodes[vendor]
+	if err != nil && known && !ldaplib.IsErrorAnyOf(err, expected...) {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Rejected with an unexpected result code for %s (expected %s): %v", vendor, formatResultCodes(expected), err)
+		logger.Error("AddTest", result.Message)
+	} else if err != nil {
 		result.Passed = true
 		result.Message = "Correctly rejected entry with missing required attributes"
 		logger.LogLDAPResult("Add", "Add", true, -1, "Missing required attributes", duration)
@@ -291,3 +407,78 @@ func testAddMissingAttributes(conn *ldap.Connection, testBaseDN string) TestResu
 
 	return result
 }
+
+// testAddUniqueAttribute enforces unique_attribute: adding a second entry
+// with the value of the first must be rejected with constraintViolation, as
+// the OpenLDAP unique overlay and the attribute uniqueness plugins of 389 DS
+// and OpenDJ do. The value is new for every run, so entries elsewhere in the
+// directory cannot collide with it.
+func testAddUniqueAttribute(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) TestResult {
+	testName := "Add Attribute Uniqueness Test (Negative)"
+	logger.Info("AddTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Add",
+	}
+
+	attribute := conn.GetConfig().UniqueAttribute
+	if attribute == "" {
+		logger.Warn("AddTest", "SKIP: "+testName, "reason", "unique_attribute not set")
+		result.Skipped = true
+		result.Message = "Skipped: set unique_attribute (e.g. mail) to the attribute the server keeps unique"
+		return result
+	}
+
+	value := fmt.Sprintf("unique-test-%d@%s", time.Now().UnixNano(), mailDomain(testBaseDN))
+	entry := func(cn string) *ldaplib.AddRequest {
+		addRequest := ldaplib.NewAddRequest(fmt.Sprintf("cn=%s,%s", cn, testBaseDN), nil)
+		addRequest.Attribute("objectClass", []string{"inetOrgPerson"})
+		addRequest.Attribute("cn", []string{cn})
+		addRequest.Attribute("sn", []string{"UniqueTest"})
+		addRequest.Attribute(attribute, []string{value})
+		return addRequest
+	}
+	first, second := entry("unique-attribute-a"), entry("unique-attribute-b")
+
+	if err := createEntry(conn, first); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to create the first entry with %s=%s: %v", attribute, value, err)
+		logger.Error("AddTest", result.Message)
+		return result
+	}
+	trk.Track(first.DN, tracker.TypeUser)
+
+	// A second entry left by an earlier run in a reused test OU is in the way
+	if conn.GetConfig().ReuseTestOU != "" {
+		if err := conn.Del(ldaplib.NewDelRequest(second.DN, nil)); err != nil && !ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultNoSuchObject) {
+			logger.Warn("AddTest", "Failed to delete leftover entry", "dn", second.DN, "error", err)
+		}
+	}
+
+	start := time.Now()
+	logger.Trace("Add", "Operation: Add (duplicate unique value)", "dn", second.DN, attribute, value)
+	err := conn.Add(second)
+	result.Duration = time.Since(start)
+
+	switch {
+	case err == nil:
+		trk.Track(second.DN, tracker.TypeUser)
+		result.Passed = false
+		result.Message = fmt.Sprintf("Uniqueness of %s is not enforced: a second entry with %s=%s was accepted", attribute, attribute, value)
+		logger.Error("AddTest", result.Message)
+	case ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultConstraintViolation):
+		result.Passed = true
+		result.Message = fmt.Sprintf("Uniqueness of %s enforced: duplicate value rejected with constraintViolation (19)", attribute)
+		logger.LogLDAPResult("Add", "Add", true, int(ldaplib.LDAPResultConstraintViolation), "Constraint violation", result.Duration)
+		logger.Info("AddTest", "PASS: "+testName+" (duplicate value rejected)", "duration", result.Duration)
+	default:
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Duplicate %s value rejected with an unexpected result code (expected constraintViolation (19)): %v", attribute, err)
+		logger.Error("AddTest", result.Message)
+	}
+
+	return result
+}
@@ -0,0 +1,273 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/ldif"
+	"ldap-automated-actions/internal/logger"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// ApplyLDIF applies each LDIF change record and verifies it by re-reading the
+// directory. Unless continueOnError is set, processing stops at the first
+// record that fails to apply or verify.
+func ApplyLDIF(conn *ldap.Connection, records []ldif.Record, continueOnError bool) []TestResult {
+	logger.Info("Apply", "Applying LDIF change records", "records", len(records))
+	results := make([]TestResult, 0, len(records))
+
+	for i, record := range records {
+		result := applyRecord(conn, record)
+		results = append(results, result)
+
+		if !result.Passed && !continueOnError {
+			logger.Error("Apply", "Stopping at first failed record", "record", i+1, "line", record.Line)
+			break
+		}
+	}
+
+	logger.Info("Apply", "Completed LDIF apply", "applied", len(results), "total", len(records))
+	return results
+}
+
+func applyRecord(conn *ldap.Connection, record ldif.Record) TestResult {
+	testName := fmt.Sprintf("%s %s", record.ChangeType, record.DN)
+	logger.Info("Apply", "Applying: "+testName, "line", record.Line)
+
+	start := time.Now()
+	operation, err := applyChange(conn, record)
+	duration := time.Since(start)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: operation,
+		Duration:  duration,
+	}
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to apply record at line %d: %v", record.Line, err)
+		logger.LogLDAPResult("Apply", operation, false, -1, err.Error(), duration)
+		logger.Error("Apply", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("Apply", operation, true, 0, "Success", duration)
+
+	// Verify the change by re-reading the directory
+	if err := verifyRecord(conn, record); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Applied but verification failed: %v", err)
+		logger.Error("Apply", result.Message, "dn", record.DN)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = "Applied and verified"
+	logger.Info("Apply", "VERIFIED: "+testName, "duration", duration)
+	return result
+}
+
+// applyChange sends the operation of a change record and returns its name
+func applyChange(conn *ldap.Connection, record ldif.Record) (string, error) {
+	var operation string
+	var err error
+
+	switch record.ChangeType {
+	case ldif.ChangeAdd:
+		operation = "Add"
+		attributes := record.AttributeMap()
+		logger.LogLDAPOperation("Apply", operation, record.DN, attributes)
+
+		addRequest := ldaplib.NewAddRequest(record.DN, nil)
+		for _, attr := range record.Attributes {
+			addRequest.Attribute(attr.Name, attr.Values)
+		}
+		err = conn.Add(addRequest)
+
+	case ldif.ChangeModify:
+		operation = "Modify"
+		logger.Trace("Apply", "Operation: Modify", "dn", record.DN, "modifications", len(record.Modifications))
+
+		modifyRequest := ldaplib.NewModifyRequest(record.DN, nil)
+		for _, mod := range record.Modifications {
+			switch mod.Op {
+			case "add":
+				modifyRequest.Add(mod.Attribute, mod.Values)
+			case "delete":
+				modifyRequest.Delete(mod.Attribute, mod.Values)
+			case "replace":
+				modifyRequest.Replace(mod.Attribute, mod.Values)
+			}
+		}
+		err = conn.Modify(modifyRequest)
+
+	case ldif.ChangeModRDN:
+		operation = "ModifyDN"
+		logger.Trace("Apply", "Operation: ModifyDN", "dn", record.DN, "newRDN", record.NewRDN, "newSuperior", record.NewSuperior)
+
+		modifyDNRequest := ldaplib.NewModifyDNRequest(record.DN, record.NewRDN, record.DeleteOldRDN, record.NewSuperior)
+		err = conn.ModifyDN(modifyDNRequest)
+
+	case ldif.ChangeDelete:
+		operation = "Delete"
+		logger.Trace("Apply", "Operation: Delete", "dn", record.DN)
+
+		err = conn.Del(ldaplib.NewDelRequest(record.DN, nil))
+	}
+	return operation, err
+}
+
+// verifyRecord re-reads the directory and checks that the record's change is visible
+func verifyRecord(conn *ldap.Connection, record ldif.Record) error {
+	switch record.ChangeType {
+	case ldif.ChangeAdd:
+		entry, err := readEntry(conn, record.DN)
+		if err != nil {
+			return err
+		}
+		for _, attr := range record.Attributes {
+			if isHashedAttribute(attr.Name) {
+				continue
+			}
+			for _, value := range attr.Values {
+				if !hasValue(entry, attr.Name, value) {
+					return fmt.Errorf("attribute %s is missing value %q", attr.Name, value)
+				}
+			}
+		}
+
+	case ldif.ChangeModify:
+		entry, err := readEntry(conn, record.DN)
+		if err != nil {
+			return err
+		}
+		for _, mod := range record.Modifications {
+			if isHashedAttribute(mod.Attribute) {
+				continue
+			}
+			if err := verifyModification(entry, mod); err != nil {
+				return err
+			}
+		}
+
+	case ldif.ChangeModRDN:
+		newDN := record.NewDN()
+		if _, err := readEntry(conn, newDN); err != nil {
+			return fmt.Errorf("new DN %s not found: %w", newDN, err)
+		}
+		if !strings.EqualFold(newDN, record.DN) {
+			if err := verifyAbsent(conn, record.DN); err != nil {
+				return err
+			}
+		}
+
+	case ldif.ChangeDelete:
+		return verifyAbsent(conn, record.DN)
+	}
+
+	return nil
+}
+
+func verifyModification(entry *ldaplib.Entry, mod ldif.Modification) error {
+	switch mod.Op {
+	case "add":
+		for _, value := range mod.Values {
+			if !hasValue(entry, mod.Attribute, value) {
+				return fmt.Errorf("attribute %s is missing added value %q", mod.Attribute, value)
+			}
+		}
+	case "delete":
+		if len(mod.Values) == 0 {
+			if len(entry.GetEqualFoldAttributeValues(mod.Attribute)) > 0 {
+				return fmt.Errorf("attribute %s still present after delete", mod.Attribute)
+			}
+		}
+		for _, value := range mod.Values {
+			if hasValue(entry, mod.Attribute, value) {
+				return fmt.Errorf("attribute %s still has deleted value %q", mod.Attribute, value)
+			}
+		}
+	case "replace":
+		actual := entry.GetEqualFoldAttributeValues(mod.Attribute)
+		if len(actual) != len(mod.Values) {
+			return fmt.Errorf("attribute %s has %d values after replace, expected %d", mod.Attribute, len(actual), len(mod.Values))
+		}
+		for _, value := range mod.Values {
+			if !hasValue(entry, mod.Attribute, value) {
+				return fmt.Errorf("attribute %s is missing replaced value %q", mod.Attribute, value)
+			}
+		}
+	}
+	return nil
+}
+
+// readEntry performs a base-scope search for a single entry
+func readEntry(conn *ldap.Connection, dn string) (*ldaplib.Entry, error) {
+	return readAttributes(conn, dn, "*")
+}
+
+// readAttributes reads the given attributes of a single entry, for operational
+// attributes such as memberOf that "*" does not return
+func readAttributes(conn *ldap.Connection, dn string, attributes ...string) (*ldaplib.Entry, error) {
+	searchRequest := ldaplib.NewSearchRequest(
+		dn,
+		ldaplib.ScopeBaseObject,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		attributes,
+		nil,
+	)
+
+	start := time.Now()
+	result, err := conn.GetConnection().Search(searchRequest)
+	duration := time.Since(start)
+
+	if err != nil {
+		// noSuchObject is the expected answer when verifying an absence
+		if ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultNoSuchObject) {
+			logger.Debug("Verify", "Entry does not exist", "dn", dn)
+		} else {
+			logger.LogLDAPResult("Verify", "Search", false, -1, err.Error(), duration)
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", dn, err)
+	}
+	logger.LogSearchResult("Verify", len(result.Entries), duration)
+
+	if len(result.Entries) == 0 {
+		return nil, fmt.Errorf("entry %s not returned by search", dn)
+	}
+	return result.Entries[0], nil
+}
+
+// verifyAbsent checks that a DN no longer resolves
+func verifyAbsent(conn *ldap.Connection, dn string) error {
+	_, err := readEntry(conn, dn)
+	if err == nil {
+		return fmt.Errorf("entry %s still exists", dn)
+	}
+	if !ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultNoSuchObject) {
+		return err
+	}
+	return nil
+}
+
+// hasValue checks for an attribute value using case-insensitive matching
+func hasValue(entry *ldaplib.Entry, attribute, value string) bool {
+	for _, v := range entry.GetEqualFoldAttributeValues(attribute) {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHashedAttribute reports attributes the server is expected to rewrite on write
+func isHashedAttribute(name string) bool {
+	return strings.EqualFold(name, "userPassword") || strings.EqualFold(name, "unicodePwd")
+}
@@ -0,0 +1,242 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/logger"
+)
+
+// Baseline is the latency and result code of each test of a reference run,
+// which later runs are compared with
+type Baseline struct {
+	Created     time.Time      `json:"created"`
+	RunID       string         `json:"run_id"`
+	ToolVersion string         `json:"tool_version"`
+	Server      string         `json:"server"`
+	Tests       []baselineTest `json:"tests"`
+}
+
+type baselineTest struct {
+	Name       string  `json:"name"`
+	Operation  string  `json:"operation"`
+	Status     string  `json:"status"`      // pass or fail
+	DurationMS float64 `json:"duration_ms"` // median over the workers that ran the test
+	ResultCode *int    `json:"result_code"` // nil if not known
+}
+
+// baselineKey identifies a test across runs
+type baselineKey struct {
+	operation string
+	name      string
+}
+
+// newBaseline summarizes the executed tests of results; a test run by
+// several workers gets its median latency
+func newBaseline(suite *TestSuite, results []TestResult) *Baseline {
+	baseline := &Baseline{
+		Created:     time.Now().UTC(),
+		RunID:       suite.Metadata.RunID,
+		ToolVersion: suite.Metadata.ToolVersion,
+		Server:      suite.Metadata.Server.Address,
+	}
+	for key, runs := range groupByTest(results) {
+		test := baselineTest{
+			Name:       key.name,
+			Operation:  key.operation,
+			Status:     "pass",
+			DurationMS: medianMS(runs),
+		}
+		for _, result := range runs {
+			if !result.Passed {
+				test.Status = "fail"
+			}
+		}
+		if code, err := strconv.Atoi(resultCode(runs[0])); err == nil {
+			test.ResultCode = &code
+		}
+		baseline.Tests = append(baseline.Tests, test)
+	}
+	sort.Slice(baseline.Tests, func(i, j int) bool {
+		if baseline.Tests[i].Operation != baseline.Tests[j].Operation {
+			return baseline.Tests[i].Operation < baseline.Tests[j].Operation
+		}
+		return baseline.Tests[i].Name < baseline.Tests[j].Name
+	})
+	return baseline
+}
+
+// groupByTest returns the executed results by test
+func groupByTest(results []TestResult) map[baselineKey][]TestResult {
+	tests := make(map[baselineKey][]TestResult)
+	for _, result := range results {
+		if result.Skipped {
+			continue
+		}
+		key := baselineKey{result.Operation, result.Name}
+		tests[key] = append(tests[key], result)
+	}
+	return tests
+}
+
+func medianMS(results []TestResult) float64 {
+	durations := make([]time.Duration, len(results))
+	for i, result := range results {
+		durations[i] = result.Duration
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return float64(percentile(durations, 50).Microseconds()) / 1000
+}
+
+// LoadBaseline reads the baseline at path, returning nil without an error
+// if there is none yet
+func LoadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline: %w", err)
+	}
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("invalid baseline %s: %w", path, err)
+	}
+	return &baseline, nil
+}
+
+// Save writes the baseline to path
+func (b *Baseline) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write baseline: %w", err)
+	}
+	return nil
+}
+
+// BaselineSettings are the limits of a baseline comparison
+type BaselineSettings struct {
+	Tolerance  float64 // percent a latency may grow before it counts as a regression
+	MinDeltaMS float64 // growth in ms below which a latency never counts, to ignore noise on fast tests
+	Fail       bool    // fail the run on a regression rather than only flag it
+}
+
+// CompareBaseline compares the executed tests of results with the baseline,
+// returning a result per operation. A test regressed if its latency grew by
+// more than both the tolerance and the minimum delta, or if its result code
+// or status changed. Tests missing from either side are not compared.
+func CompareBaseline(baseline *Baseline, results []TestResult, settings BaselineSettings) []TestResult {
+	reference := make(map[baselineKey]baselineTest, len(baseline.Tests))
+	for _, test := range baseline.Tests {
+		reference[baselineKey{test.Operation, test.Name}] = test
+	}
+	current := newBaseline(&TestSuite{}, results)
+
+	compared := make(map[string]int)
+	regressions := make(map[string][]string)
+	for _, test := range current.Tests {
+		base, ok := reference[baselineKey{test.Operation, test.Name}]
+		if !ok {
+			continue
+		}
+		compared[test.Operation]++
+		if regression := compareTest(base, test, settings); regression != "" {
+			regressions[test.Operation] = append(regressions[test.Operation], test.Name+" "+regression)
+		}
+	}
+
+	operations := make([]string, 0, len(compared))
+	for op := range compared {
+		operations = append(operations, op)
+	}
+	sort.Strings(operations)
+
+	checks := make([]TestResult, 0, len(operations))
+	for _, op := range operations {
+		testName := "Baseline " + op
+		result := TestResult{Name: testName, Operation: "Baseline", Passed: true}
+		regressed := regressions[op]
+		switch {
+		case len(regressed) == 0:
+			result.Message = fmt.Sprintf("%d tests within %g%% of the baseline", compared[op], settings.Tolerance)
+			logger.Info("Baseline", "PASS: "+testName, "tests", compared[op])
+		case settings.Fail:
+			result.Passed = false
+			result.Message = fmt.Sprintf("%d of %d tests regressed: %s", len(regressed), compared[op], strings.Join(regressed, "; "))
+			logger.Error("Baseline", "FAIL: "+testName, "regressed", len(regressed), "tests", compared[op])
+		default:
+			result.Message = fmt.Sprintf("Regression (not failing the run): %d of %d tests regressed: %s", len(regressed), compared[op], strings.Join(regressed, "; "))
+			logger.Warn("Baseline", "Regression: "+testName, "regressed", len(regressed), "tests", compared[op])
+		}
+		checks = append(checks, result)
+	}
+	return checks
+}
+
+// compareTest describes how test regressed from base, empty if it did not
+func compareTest(base, test baselineTest, settings BaselineSettings) string {
+	if base.ResultCode != nil && test.ResultCode != nil && *base.ResultCode != *test.ResultCode {
+		return fmt.Sprintf("result code %d -> %d", *base.ResultCode, *test.ResultCode)
+	}
+	if base.Status == "pass" && test.Status == "fail" {
+		return "passed -> failed"
+	}
+	delta := test.DurationMS - base.DurationMS
+	if delta > settings.MinDeltaMS && delta > base.DurationMS*settings.Tolerance/100 {
+		growth := "new latency"
+		if base.DurationMS > 0 {
+			growth = fmt.Sprintf("+%.0f%%", delta*100/base.DurationMS)
+		}
+		return fmt.Sprintf("%gms -> %gms (%s)", base.DurationMS, test.DurationMS, growth)
+	}
+	return ""
+}
+
+// checkBaseline compares the run with the baseline file, or records the
+// baseline if there is none yet or baseline_update is set. A baseline is
+// only recorded from a run whose tests all passed and that was not
+// interrupted.
+func (r *Runner) checkBaseline(ctx context.Context) {
+	path := r.config.Baseline
+	baseline, err := LoadBaseline(path)
+	if err != nil {
+		logger.Error("Baseline", "Cannot compare with the baseline", "error", err)
+		return
+	}
+
+	if baseline != nil && !r.config.BaselineUpdate {
+		logger.Info("TestRunner", "Comparing with the baseline", "file", path, "baselineRunID", baseline.RunID, "created", baseline.Created.Format(time.RFC3339))
+		r.events.SuiteStart("baseline")
+		checks := CompareBaseline(baseline, r.suite.Results, BaselineSettings{
+			Tolerance:  r.config.BaselineTolerance,
+			MinDeltaMS: r.config.BaselineMinDeltaMS,
+			Fail:       r.config.BaselineFail,
+		})
+		for _, check := range checks {
+			r.events.Test("baseline", check)
+		}
+		r.suite.Results = append(r.suite.Results, checks...)
+		r.events.SuiteEnd("baseline", checks)
+		return
+	}
+
+	if ctx.Err() != nil || !r.suite.AllPassed() {
+		logger.Warn("Baseline", "Not recording a baseline from a failed or interrupted run", "file", path)
+		return
+	}
+	if err := newBaseline(r.suite, r.suite.Results).Save(path); err != nil {
+		logger.Error("Baseline", "Failed to record the baseline", "error", err)
+		return
+	}
+	logger.Info("Baseline", "Recorded baseline", "file", path, "runID", r.suite.Metadata.RunID)
+}
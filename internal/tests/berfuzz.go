@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"fmt"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// berFuzzWait is how long the server may take to react to a malformed PDU
+const berFuzzWait = 5 * time.Second
+
+// berFuzzID is the message ID used in the malformed PDUs, far from the IDs
+// the raw connection assigns itself
+const berFuzzID = 100
+
+// berFuzzCase is a malformed PDU written as-is on a bound raw connection
+type berFuzzCase struct {
+	name string
+	data []byte
+	// allowOpen accepts a server that keeps waiting for more data, which is
+	// the correct reaction to an incomplete message
+	allowOpen bool
+}
+
+// TestProtocolFuzz writes malformed BER/LDAP PDUs and verifies that the
+// server rejects each one and still answers new connections afterwards
+func TestProtocolFuzz(conn *ldap.Connection, h *Harness) []TestResult {
+	logger.Info("BERFuzzTest", "Starting protocol fuzz tests")
+
+	corpus := berFuzzCorpus()
+	cases := make([]TestCase, 0, len(corpus))
+	for _, fc := range corpus {
+		fc := fc
+		cases = append(cases, TestCase{Name: "BER Fuzz: " + fc.name, Operation: "Fuzz", Run: func() TestResult { return testBERFuzzCase(conn, fc) }})
+	}
+
+	results := h.Execute(cases)
+
+	logger.Info("BERFuzzTest", "Completed protocol fuzz tests", "total", len(results))
+	return results
+}
+
+// berFuzzCorpus returns the malformed PDUs
+func berFuzzCorpus() []berFuzzCase {
+	id := tlv(0x02, []byte{berFuzzID})
+	search := rootDSESearch()
+	valid := tlv(0x30, concat(id, search))
+
+	// Scope encoded as an OCTET STRING instead of an ENUMERATED
+	badScope := tlv(0x63, concat(
+		tlv(0x04, nil),
+		tlv(0x04, []byte("base")),
+		tlv(0x0a, []byte{0}),
+		tlv(0x02, []byte{0}),
+		tlv(0x02, []byte{0}),
+		tlv(0x01, []byte{0}),
+		tlv(0x87, []byte("objectClass")),
+		tlv(0x30, tlv(0x04, []byte("1.1"))),
+	))
+
+	hugeID := make([]byte, 20)
+	for i := range hugeID {
+		hugeID[i] = 0x7f
+	}
+
+	return []berFuzzCase{
+		{name: "Truncated Message", data: valid[:len(valid)/2], allowOpen: true},
+		{name: "Absurd Message Length", data: concat([]byte{0x30, 0x84, 0x7f, 0xff, 0xff, 0xff}, id)},
+		{name: "Oversized Length Field", data: concat([]byte{0x30, 0x89, 0x01, 0, 0, 0, 0, 0, 0, 0, 0}, id)},
+		{name: "Indefinite Length", data: concat([]byte{0x30, 0x80}, id, search, []byte{0, 0})},
+		{name: "Zero-Length Message", data: []byte{0x30, 0x00}},
+		{name: "Wrong Message Tag", data: tlv(0x31, concat(id, search))},
+		{name: "Message ID Not an Integer", data: tlv(0x30, concat(tlv(0x04, []byte{berFuzzID}), search))},
+		{name: "Oversized Message ID", data: tlv(0x30, concat(tlv(0x02, hugeID), search))},
+		{name: "Missing Protocol Op", data: tlv(0x30, id)},
+		{name: "Unknown Protocol Op Tag", data: tlv(0x30, concat(id, tlv(0xdf, nil)))},
+		{name: "Inner Length Exceeds Message", data: tlv(0x30, concat(id, []byte{0x63, 0x7f}, search[2:]))},
+		{name: "Wrong Tag in Search Request", data: tlv(0x30, concat(id, badScope))},
+		{name: "Garbage Bytes", data: []byte{0xde, 0xad, 0xbe, 0xef, 0x00, 0xff, 0x13, 0x37, 0x42, 0x42}},
+	}
+}
+
+// rootDSESearch encodes a valid base-scope search of the root DSE
+func rootDSESearch() []byte {
+	return tlv(0x63, concat(
+		tlv(0x04, nil),                   // baseObject
+		tlv(0x0a, []byte{0}),             // scope: baseObject
+		tlv(0x0a, []byte{0}),             // derefAliases: never
+		tlv(0x02, []byte{0}),             // sizeLimit
+		tlv(0x02, []byte{0}),             // timeLimit
+		tlv(0x01, []byte{0}),             // typesOnly
+		tlv(0x87, []byte("objectClass")), // filter: (objectClass=*)
+		tlv(0x30, tlv(0x04, []byte("1.1"))),
+	))
+}
+
+// tlv encodes a BER element with a definite length
+func tlv(tag byte, content []byte) []byte {
+	length := len(content)
+	var header []byte
+	switch {
+	case length < 0x80:
+		header = []byte{tag, byte(length)}
+	case length <= 0xff:
+		header = []byte{tag, 0x81, byte(length)}
+	case length <= 0xffff:
+		header = []byte{tag, 0x82, byte(length >> 8), byte(length)}
+	default:
+		header = []byte{tag, 0x84, byte(length >> 24), byte(length >> 16), byte(length >> 8), byte(length)}
+	}
+	return append(header, content...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+func testBERFuzzCase(conn *ldap.Connection, fc berFuzzCase) TestResult {
+	testName := "BER Fuzz: " + fc.name
+	logger.Info("BERFuzzTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Fuzz",
+	}
+
+	raw, err := conn.OpenRaw()
+	if skipRawUnsupported(&result, "BERFuzzTest", err) {
+		return result
+	}
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to open raw connection: %v", err)
+		logger.Error("BERFuzzTest", result.Message)
+		return result
+	}
+	defer raw.Close()
+
+	start := time.Now()
+	reaction := ""
+	rejected := false
+	if err := raw.Write(fc.data); err != nil {
+		reaction = fmt.Sprintf("connection dropped while sending (%v)", err)
+		rejected = true
+	}
+
+	for reaction == "" {
+		msg, err := raw.Read(berFuzzWait)
+		if err != nil {
+			switch {
+			case ldap.IsTimeout(err):
+				reaction = fmt.Sprintf("no response within %s, connection left open", berFuzzWait)
+			case isDisconnect(err):
+				reaction = "server closed the connection"
+				rejected = true
+			default:
+				reaction = fmt.Sprintf("unreadable response (%v)", err)
+				rejected = true
+			}
+			continue
+		}
+
+		if msg.IsUnsolicited() {
+			logger.Info("BERFuzzTest", "Received unsolicited notification", "oid", msg.OID, "code", msg.Code)
+			continue
+		}
+		if !msg.IsResult() {
+			continue
+		}
+
+		if msg.Code == ldaplib.LDAPResultSuccess {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Message = fmt.Sprintf("Server accepted the malformed PDU and answered message %d with success", msg.ID)
+			logger.Error("BERFuzzTest", result.Message)
+			return result
+		}
+		reaction = fmt.Sprintf("server answered with %s (%d)", ldaplib.LDAPResultCodeMap[msg.Code], msg.Code)
+		rejected = true
+	}
+	logger.Debug("BERFuzzTest", "Server reaction", "case", fc.name, "reaction", reaction)
+
+	// Whatever happened to this session, the server must keep serving others
+	pingStart := time.Now()
+	check, err := conn.OpenRaw()
+	if err == nil {
+		err = check.Ping()
+		check.Close()
+	}
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Server unresponsive after the malformed PDU, possible crash (%s; %v)", reaction, err)
+		logger.Error("BERFuzzTest", result.Message)
+		return result
+	}
+
+	if !rejected && !fc.allowOpen {
+		result.Passed = false
+		result.Message = fmt.Sprintf("Server did not reject the malformed PDU: %s", reaction)
+		logger.Error("BERFuzzTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Handled: %s; server still responsive (%s)", reaction, time.Since(pingStart).Round(time.Millisecond))
+	logger.Info("BERFuzzTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
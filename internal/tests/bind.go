@@ -2,6 +2,7 @@ package tests
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"ldap-automated-actions/internal/ldap"
@@ -11,18 +12,28 @@ import (
 )
 
 // TestBind runs all bind operation tests
-func TestBind(conn *ldap.Connection) []TestResult {
+func TestBind(conn *ldap.Connection, h *Harness) []TestResult {
 	logger.Info("BindTest", "Starting Bind operation tests")
-	results := make([]TestResult, 0)
 
-	// Test 1: Valid bind (already done during connection, but test again)
-	results = append(results, testValidBind(conn))
+	results := h.Execute([]TestCase{
+		// Test 1: Valid bind (already done during connection, but test again)
+		{Name: "Valid Bind Test", Operation: "Bind", Run: func() TestResult { return testValidBind(conn) }},
 
-	// Test 2: Invalid credentials bind
-	results = append(results, testInvalidBind(conn))
+		// Test 2: Invalid credentials bind
+		{Name: "Invalid Bind Test", Operation: "Bind", Run: func() TestResult { return testInvalidBind(conn) }},
 
-	// Test 3: Anonymous bind (if supported)
-	results = append(results, testAnonymousBind(conn))
+		// Test 3: Anonymous bind (if supported)
+		{Name: "Anonymous Bind Test", Operation: "Bind", Run: func() TestResult { return testAnonymousBind(conn) }},
+
+		// Test 4: Cleartext bind policy (if require_encrypted_auth is set)
+		{Name: "Cleartext Bind Policy Test", Operation: "Bind", Run: func() TestResult { return testCleartextBindPolicy(conn) }},
+
+		// Test 5: SASL GSSAPI (Kerberos) bind (if bind_method is gssapi)
+		{Name: "GSSAPI Bind Test", Operation: "Bind", Needs: []Capability{CapabilityGSSAPI}, Run: func() TestResult { return testGSSAPIBind(conn) }},
+
+		// Test 6: SASL EXTERNAL bind with the client certificate (if one is configured)
+		{Name: "SASL EXTERNAL Bind Test", Operation: "Bind", Needs: []Capability{CapabilityExternal}, Run: func() TestResult { return testExternalBind(conn) }},
+	})
 
 	logger.Info("BindTest", "Completed Bind operation tests", "total", len(results))
 	return results
@@ -60,12 +71,21 @@ func testInvalidBind(conn *ldap.Connection) TestResult {
 	logger.Info("BindTest", "Running: "+testName)
 
 	cfg := conn.GetConfig()
+	if cfg.BindDN == "" {
+		logger.Warn("BindTest", "SKIP: "+testName, "reason", "bind_dn not set")
+		return TestResult{
+			Name:      testName,
+			Operation: "Bind",
+			Skipped:   true,
+			Message:   "Skipped: requires bind_dn, the account a wrong password is sent for",
+		}
+	}
 
 	// Create a new connection for this test
 	start := time.Now()
 
 	// Try to dial and bind with invalid password
-	address := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	address := conn.HostPort()
 	testConn, err := ldaplib.Dial("tcp", address)
 	if err != nil {
 		duration := time.Since(start)
@@ -119,12 +139,10 @@ func testAnonymousBind(conn *ldap.Connection) TestResult {
 	testName := "Anonymous Bind Test"
 	logger.Info("BindTest", "Running: "+testName)
 
-	cfg := conn.GetConfig()
-
 	// Create a new connection for this test
 	start := time.Now()
 
-	address := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	address := conn.HostPort()
 	testConn, err := ldaplib.Dial("tcp", address)
 	if err != nil {
 		duration := time.Since(start)
@@ -165,3 +183,174 @@ func testAnonymousBind(conn *ldap.Connection) TestResult {
 
 	return result
 }
+
+// testCleartextBindPolicy enforces require_encrypted_auth: a simple bind on an
+// unencrypted connection must be refused before credentials are checked. Only
+// a wrong password is sent, so the configured password never crosses the wire
+// in cleartext; invalidCredentials already proves the server evaluated it.
+func testCleartextBindPolicy(conn *ldap.Connection) TestResult {
+	testName := "Cleartext Bind Policy Test"
+	logger.Info("BindTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Bind",
+	}
+
+	cfg := conn.GetConfig()
+	if !cfg.RequireEncryptedAuth {
+		logger.Warn("BindTest", "SKIP: "+testName, "reason", "require_encrypted_auth not set")
+		result.Skipped = true
+		result.Message = "Skipped: requires require_encrypted_auth: true"
+		return result
+	}
+	if cfg.UseTLS {
+		logger.Warn("BindTest", "SKIP: "+testName, "reason", "configured port is LDAPS")
+		result.Skipped = true
+		result.Message = "Skipped: the configured port is LDAPS; point --port at the cleartext listener to check it"
+		return result
+	}
+
+	start := time.Now()
+	err := cleartextBind(conn)
+	result.Duration = time.Since(start)
+
+	switch {
+	case err == nil:
+		result.Passed = false
+		result.Message = "Server accepted a cleartext simple bind, even with a wrong password"
+		logger.Error("BindTest", result.Message)
+	case ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultInvalidCredentials):
+		result.Passed = false
+		result.Error = err
+		result.Message = "Server checked credentials sent over an unencrypted connection (invalidCredentials); cleartext binds violate require_encrypted_auth"
+		logger.Error("BindTest", result.Message)
+	case rejection(err) != "":
+		result.Passed = true
+		result.Message = fmt.Sprintf("Cleartext simple bind %s before credentials were checked", rejection(err))
+		logger.Info("BindTest", "PASS: "+testName, "duration", result.Duration)
+	default:
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Could not attempt a cleartext bind: %v", err)
+		logger.Error("BindTest", result.Message)
+	}
+
+	return result
+}
+
+// testGSSAPIBind opens a new connection and binds it with Kerberos, then asks
+// the server who it authenticated the connection as. Active Directory maps the
+// ticket to the account of the principal, so the identity shows which one.
+func testGSSAPIBind(conn *ldap.Connection) TestResult {
+	testName := "GSSAPI Bind Test"
+	logger.Info("BindTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Bind",
+	}
+
+	cfg := conn.GetConfig()
+	if cfg.BindMethod != "gssapi" {
+		logger.Warn("BindTest", "SKIP: "+testName, "reason", "bind_method is not gssapi")
+		result.Skipped = true
+		result.Message = "Skipped: requires bind_method: gssapi"
+		return result
+	}
+
+	start := time.Now()
+	testConn, err := ldap.NewConnection(cfg)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Error = err
+		result.Message = "Failed to connect to server for test"
+		logger.Error("BindTest", "Failed to connect for GSSAPI bind test", "error", err)
+		return result
+	}
+	defer testConn.Close()
+
+	err = testConn.GSSAPIBind()
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to bind with Kerberos: %v", err)
+		logger.Error("BindTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = "Successfully authenticated with Kerberos"
+	if whoami, err := testConn.GetConnection().WhoAmI(nil); err == nil && whoami.AuthzID != "" {
+		result.Message += " as " + whoami.AuthzID
+	}
+	logger.Info("BindTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// testExternalBind opens a new connection, which presents the client
+// certificate in its TLS handshake, binds it with SASL EXTERNAL and checks with
+// Who Am I that the server mapped the certificate to an identity, the
+// configured external_authz_id if set
+func testExternalBind(conn *ldap.Connection) TestResult {
+	testName := "SASL EXTERNAL Bind Test"
+	logger.Info("BindTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Bind",
+	}
+
+	cfg := conn.GetConfig()
+	if !cfg.HasClientCertificate() {
+		logger.Warn("BindTest", "SKIP: "+testName, "reason", "no client certificate configured")
+		result.Skipped = true
+		result.Message = "Skipped: requires a client certificate (tls_client_cert_file or key_store_path)"
+		return result
+	}
+
+	start := time.Now()
+	testConn, err := ldap.NewConnection(cfg)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Error = err
+		result.Message = "Failed to connect to server for test"
+		logger.Error("BindTest", "Failed to connect for SASL EXTERNAL bind test", "error", err)
+		return result
+	}
+	defer testConn.Close()
+
+	err = testConn.ExternalBind()
+	if err == nil {
+		var whoami *ldaplib.WhoAmIResult
+		whoami, err = testConn.GetConnection().WhoAmI(nil)
+		result.Duration = time.Since(start)
+		if err == nil {
+			return checkExternalAuthzID(result, cfg.ExternalAuthzID, whoami.AuthzID)
+		}
+		err = fmt.Errorf("who am i failed: %w", err)
+	}
+	result.Duration = time.Since(start)
+	result.Error = err
+	result.Message = fmt.Sprintf("Failed to bind with the client certificate: %v", err)
+	logger.Error("BindTest", result.Message)
+	return result
+}
+
+// checkExternalAuthzID completes the result of a SASL EXTERNAL bind from the
+// authorization identity the server reported
+func checkExternalAuthzID(result TestResult, expected, authzID string) TestResult {
+	switch {
+	case authzID == "":
+		result.Message = "SASL EXTERNAL bind succeeded, but the server reports an anonymous identity for the connection"
+		logger.Error("BindTest", result.Message)
+	case expected != "" && !strings.EqualFold(authzID, expected):
+		result.Message = fmt.Sprintf("Client certificate mapped to %s, expected %s", authzID, expected)
+		logger.Error("BindTest", result.Message)
+	default:
+		result.Passed = true
+		result.Message = "Client certificate mapped to " + authzID
+		logger.Info("BindTest", "PASS: "+result.Name, "authzId", authzID, "duration", result.Duration)
+	}
+	return result
+}
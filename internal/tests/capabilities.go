@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// capabilityKind is the root DSE attribute a capability is advertised in
+type capabilityKind string
+
+const (
+	kindControl       capabilityKind = "control"        // supportedControl
+	kindExtension     capabilityKind = "extension"      // supportedExtension
+	kindSASLMechanism capabilityKind = "SASL mechanism" // supportedSASLMechanisms
+)
+
+// Capability is a feature of the server a test needs, as advertised in the
+// root DSE
+type Capability struct {
+	kind capabilityKind
+	id   string // OID of the control or extension, name of the SASL mechanism
+	name string
+}
+
+// Capabilities tests declare in TestCase.Needs
+var (
+	CapabilityPagedResults     = Capability{kind: kindControl, id: ldaplib.ControlTypePaging, name: "Paged Results"}
+	CapabilitySync             = Capability{kind: kindControl, id: ldaplib.ControlTypeSyncRequest, name: "Content Sync"}
+	CapabilityPersistentSearch = Capability{kind: kindControl, id: controlTypePersistentSearch, name: "Persistent Search"}
+	CapabilityProxiedAuthz     = Capability{kind: kindControl, id: controlTypeProxiedAuthz, name: "Proxied Authorization"}
+	CapabilityPreRead          = Capability{kind: kindControl, id: controlTypePreRead, name: "Pre-Read"}
+	CapabilityPostRead         = Capability{kind: kindControl, id: controlTypePostRead, name: "Post-Read"}
+	CapabilityAssertion        = Capability{kind: kindControl, id: controlTypeAssertion, name: "Assertion"}
+	CapabilityManageDsaIT      = Capability{kind: kindControl, id: ldaplib.ControlTypeManageDsaIT, name: "ManageDsaIT"}
+	CapabilitySubtreeDelete    = Capability{kind: kindControl, id: ldaplib.ControlTypeSubtreeDelete, name: "Subtree Delete"}
+	CapabilityStartTLS         = Capability{kind: kindExtension, id: ldap.OIDStartTLS, name: "StartTLS"}
+	CapabilityPasswordModify   = Capability{kind: kindExtension, id: ldap.OIDPasswordModify, name: "Password Modify"}
+	CapabilityWhoAmI           = Capability{kind: kindExtension, id: ldaplib.ControlTypeWhoAmI, name: "Who am I?"}
+	CapabilityGSSAPI           = Capability{kind: kindSASLMechanism, id: "GSSAPI", name: "GSSAPI"}
+	CapabilityExternal         = Capability{kind: kindSASLMechanism, id: "EXTERNAL", name: "EXTERNAL"}
+)
+
+// String names the capability in skip reasons, e.g. "Paged Results control
+// (1.2.840.113556.1.4.319)"
+func (c Capability) String() string {
+	if c.kind == kindSASLMechanism {
+		return fmt.Sprintf("%s %s", c.kind, c.id)
+	}
+	return fmt.Sprintf("%s %s (%s)", c.name, c.kind, c.id)
+}
+
+// advertised reports whether the root DSE in info lists the capability. A
+// server that lists nothing of a kind (or whose root DSE could not be read)
+// may just not publish it, so only a list that leaves the capability out
+// counts against it.
+func (c Capability) advertised(info ldap.ServerInfo) bool {
+	var list []string
+	switch c.kind {
+	case kindControl:
+		list = info.Controls
+	case kindExtension:
+		list = info.Extensions
+	case kindSASLMechanism:
+		list = info.SASLMechanisms
+	}
+	if len(list) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(list, func(value string) bool { return strings.EqualFold(value, c.id) })
+}
+
+// skipRawUnsupported marks result as skipped and returns true if err is that
+// the configured bind method cannot bind a raw connection
+func skipRawUnsupported(result *TestResult, component string, err error) bool {
+	if !errors.Is(err, ldap.ErrRawBindUnsupported) {
+		return false
+	}
+	logger.Warn(component, "SKIP: "+result.Name, "reason", err)
+	result.Skipped = true
+	result.Error = nil
+	result.Message = fmt.Sprintf("Skipped: %v", err)
+	return true
+}
@@ -0,0 +1,353 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+const (
+	// chaosDuration is how long each chaos test disturbs the server
+	chaosDuration = 20 * time.Second
+	// chaosProbeInterval is the pause between latency probes of the healthy client
+	chaosProbeInterval = 250 * time.Millisecond
+	// chaosBaselineProbes is the number of probes taken before the disturbance
+	chaosBaselineProbes = 10
+	// chaosMaxSlowdown and chaosMinDegradation define degraded latency: the
+	// median must grow by both the factor and the absolute amount
+	chaosMaxSlowdown    = 5
+	chaosMinDegradation = 100 * time.Millisecond
+
+	// slowReadInterval is the pause between two reads of the slow client
+	slowReadInterval = 200 * time.Millisecond
+
+	// churnWorkers is the number of parallel connection churners
+	churnWorkers = 4
+)
+
+// TestChaos runs the chaos tests, which disturb the server on separate
+// connections while the main connection measures whether latency degrades
+func TestChaos(conn *ldap.Connection, baseDN string, h *Harness) []TestResult {
+	logger.Info("ChaosTest", "Starting chaos tests")
+
+	results := h.Execute([]TestCase{
+		// Test 1: A slow consumer must not degrade other clients
+		{Name: "Slow Client Test", Operation: "Chaos", Run: func() TestResult { return testSlowClient(conn, baseDN) }},
+
+		// Test 2: Connection churn must not degrade other clients
+		{Name: "Connection Churn Test", Operation: "Chaos", Run: func() TestResult { return testConnectionChurn(conn, baseDN) }},
+	})
+
+	logger.Info("ChaosTest", "Completed chaos tests", "total", len(results))
+	return results
+}
+
+// slowReadOutcome is what the slow client observed
+type slowReadOutcome struct {
+	entries  int
+	done     bool  // the search result arrived
+	dropped  error // the server closed the connection
+	duration time.Duration
+}
+
+// testSlowClient reads a large subtree search with throttled reads on one
+// connection while probing latency on the main connection. The server
+// should either keep serving other clients normally or drop the slow
+// consumer; it must not let one slow reader degrade everyone else.
+func testSlowClient(conn *ldap.Connection, baseDN string) TestResult {
+	testName := "Slow Client Test"
+	logger.Info("ChaosTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Chaos",
+	}
+
+	start := time.Now()
+	baseline, err := probeLatency(conn, baseDN, chaosBaselineProbes, 0)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Baseline latency probe failed: %v", err)
+		logger.Error("ChaosTest", result.Message)
+		return result
+	}
+
+	raw, err := conn.OpenRaw()
+	if skipRawUnsupported(&result, "ChaosTest", err) {
+		result.Duration = time.Since(start)
+		return result
+	}
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to open raw connection: %v", err)
+		logger.Error("ChaosTest", result.Message)
+		return result
+	}
+	defer raw.Close()
+
+	filter := "(objectClass=*)"
+	attributes := []string{"*"}
+	logger.LogSearchOperation("Chaos", baseDN, filter, "sub", attributes)
+	searchID, err := raw.SendSearch(baseDN, ldaplib.ScopeWholeSubtree, filter, attributes)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to send search: %v", err)
+		logger.Error("ChaosTest", result.Message)
+		return result
+	}
+
+	outcome := make(chan slowReadOutcome, 1)
+	go func() {
+		outcome <- readSlowly(raw, searchID)
+	}()
+
+	during, err := probeLatency(conn, baseDN, int(chaosDuration/chaosProbeInterval), chaosProbeInterval)
+	// Unblock the slow reader if it is still going
+	raw.Close()
+	slow := <-outcome
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Healthy client failed while a slow client was reading: %v", err)
+		logger.Error("ChaosTest", result.Message)
+		return result
+	}
+
+	var behavior string
+	switch {
+	case slow.dropped != nil:
+		behavior = fmt.Sprintf("server dropped the slow client after %s and %d entries", slow.duration.Round(time.Millisecond), slow.entries)
+	case slow.done && slow.duration < chaosDuration:
+		logger.Warn("ChaosTest", "SKIP: "+testName, "reason", "search completed before the slow client fell behind", "entries", slow.entries)
+		result.Skipped = true
+		result.Message = fmt.Sprintf("Skipped: the search under %s returned only %d entries, too few to back up a slow client", baseDN, slow.entries)
+		return result
+	default:
+		behavior = fmt.Sprintf("server kept the slow client connected (%d entries read)", slow.entries)
+	}
+
+	baselineMedian, duringMedian := median(baseline), median(during)
+	logger.Info("ChaosTest", "Latency of healthy client", "baseline", baselineMedian, "during", duringMedian, "slowClient", behavior)
+
+	if degraded(baselineMedian, duringMedian) {
+		result.Passed = false
+		result.Message = fmt.Sprintf("Latency of other clients degraded from %s to %s while %s",
+			baselineMedian.Round(time.Millisecond), duringMedian.Round(time.Millisecond), behavior)
+		logger.Error("ChaosTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Median latency %s (baseline %s); %s",
+		duringMedian.Round(time.Millisecond), baselineMedian.Round(time.Millisecond), behavior)
+	logger.Info("ChaosTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// churnAction is one way of opening and dropping a connection
+type churnAction struct {
+	name string
+	run  func() error
+}
+
+// testConnectionChurn rapidly opens and closes connections, abandons TLS
+// handshakes and drops connections right after bind from several workers,
+// while probing latency on the main connection
+func testConnectionChurn(conn *ldap.Connection, baseDN string) TestResult {
+	testName := "Connection Churn Test"
+	logger.Info("ChaosTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Chaos",
+	}
+
+	cfg := conn.GetConfig()
+	actions := []churnAction{
+		{name: "open/close", run: func() error {
+			raw, err := conn.DialRaw()
+			if err != nil {
+				return err
+			}
+			return raw.Close()
+		}},
+	}
+	if err := conn.RawBindError(); err == nil {
+		actions = append(actions, churnAction{name: "drop after bind", run: func() error {
+			raw, err := conn.OpenRaw()
+			if err != nil {
+				return err
+			}
+			return raw.Close()
+		}})
+	} else {
+		logger.Debug("ChaosTest", "Not dropping connections after bind", "reason", err)
+	}
+	if cfg.UseTLS || cfg.StartTLS {
+		actions = append(actions, churnAction{name: "abandoned TLS handshake", run: conn.AbandonTLSHandshake})
+	} else {
+		logger.Debug("ChaosTest", "TLS not configured, not abandoning TLS handshakes")
+	}
+
+	start := time.Now()
+	baseline, err := probeLatency(conn, baseDN, chaosBaselineProbes, 0)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Baseline latency probe failed: %v", err)
+		logger.Error("ChaosTest", result.Message)
+		return result
+	}
+
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	failures := make(map[string]int)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < churnWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				action := actions[i%len(actions)]
+				err := action.run()
+				mu.Lock()
+				attempts[action.name]++
+				if err != nil {
+					failures[action.name]++
+					logger.Trace("Chaos", "Churn action failed", "action", action.name, "error", err)
+				}
+				mu.Unlock()
+			}
+		}(w)
+	}
+
+	during, err := probeLatency(conn, baseDN, int(chaosDuration/chaosProbeInterval), chaosProbeInterval)
+	close(stop)
+	wg.Wait()
+	result.Duration = time.Since(start)
+
+	var summary []string
+	for _, action := range actions {
+		summary = append(summary, fmt.Sprintf("%s %d (%d failed)", action.name, attempts[action.name], failures[action.name]))
+	}
+	churn := strings.Join(summary, ", ")
+	logger.Info("ChaosTest", "Connection churn", "actions", churn)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Healthy client failed during connection churn (%s): %v", churn, err)
+		logger.Error("ChaosTest", result.Message)
+		return result
+	}
+
+	baselineMedian, duringMedian := median(baseline), median(during)
+	logger.Info("ChaosTest", "Latency of healthy client", "baseline", baselineMedian, "during", duringMedian)
+
+	if degraded(baselineMedian, duringMedian) {
+		result.Passed = false
+		result.Message = fmt.Sprintf("Latency of other clients degraded from %s to %s during connection churn (%s)",
+			baselineMedian.Round(time.Millisecond), duringMedian.Round(time.Millisecond), churn)
+		logger.Error("ChaosTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Median latency %s (baseline %s) during connection churn: %s",
+		duringMedian.Round(time.Millisecond), baselineMedian.Round(time.Millisecond), churn)
+	logger.Info("ChaosTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// readSlowly reads the responses to a search one at a time with a pause in
+// between, until the search is done, the server drops the connection or
+// chaosDuration has passed
+func readSlowly(raw *ldap.RawConn, searchID int64) slowReadOutcome {
+	start := time.Now()
+	var outcome slowReadOutcome
+
+	for time.Since(start) < chaosDuration {
+		msg, err := raw.Read(chaosDuration)
+		if err != nil {
+			// net.ErrClosed means the test closed the connection itself
+			if isDisconnect(err) && !errors.Is(err, net.ErrClosed) {
+				outcome.dropped = err
+			}
+			break
+		}
+		if msg.ID == searchID && msg.IsResult() {
+			outcome.done = true
+			break
+		}
+		outcome.entries++
+		time.Sleep(slowReadInterval)
+	}
+
+	outcome.duration = time.Since(start)
+	logger.Debug("ChaosTest", "Slow client finished", "entries", outcome.entries, "done", outcome.done, "dropped", outcome.dropped != nil)
+	return outcome
+}
+
+// probeLatency times count base searches of baseDN on conn, pausing interval
+// between them
+func probeLatency(conn *ldap.Connection, baseDN string, count int, interval time.Duration) ([]time.Duration, error) {
+	searchRequest := ldaplib.NewSearchRequest(
+		baseDN,
+		ldaplib.ScopeBaseObject,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		[]string{"1.1"},
+		nil,
+	)
+
+	latencies := make([]time.Duration, 0, count)
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		if _, err := conn.GetConnection().Search(searchRequest); err != nil {
+			return latencies, err
+		}
+		latencies = append(latencies, time.Since(start))
+		time.Sleep(interval)
+	}
+	logger.Trace("Chaos", "Latency probes", "count", len(latencies), "median", median(latencies))
+	return latencies, nil
+}
+
+// degraded reports whether latency grew by more than chaosMaxSlowdown and chaosMinDegradation
+func degraded(baseline, during time.Duration) bool {
+	return during > baseline*chaosMaxSlowdown && during-baseline > chaosMinDegradation
+}
+
+func median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
@@ -6,26 +6,33 @@ import (
 
 	"ldap-automated-actions/internal/ldap"
 	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
 
 	ldaplib "github.com/go-ldap/ldap/v3"
 )
 
 // TestCompare runs all compare operation tests
-func TestCompare(conn *ldap.Connection, testBaseDN string) []TestResult {
+func TestCompare(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
 	logger.Info("CompareTest", "Starting Compare operation tests")
-	results := make([]TestResult, 0)
 
-	// Test 1: Compare with matching value
-	results = append(results, testCompareMatch(conn, testBaseDN))
+	cases := []TestCase{
+		// Test 1: Compare with matching value
+		{Name: "Compare - Matching Value Test", Operation: "Compare", Requires: []string{FixtureTestUser}, Run: func() TestResult { return testCompareMatch(conn, testBaseDN) }},
 
-	// Test 2: Compare with non-matching value
-	results = append(results, testCompareNoMatch(conn, testBaseDN))
+		// Test 2: Compare with non-matching value
+		{Name: "Compare - Non-Matching Value Test", Operation: "Compare", Requires: []string{FixtureTestUser}, Run: func() TestResult { return testCompareNoMatch(conn, testBaseDN) }},
 
-	// Test 3: Compare on non-existent entry
-	results = append(results, testCompareNonExistent(conn, testBaseDN))
+		// Test 3: Compare on non-existent entry
+		{Name: "Compare - Non-Existent Entry Test (Negative)", Operation: "Compare", Run: func() TestResult { return testCompareNonExistent(conn, testBaseDN) }},
 
-	// Test 4: Compare on non-existent attribute
-	results = append(results, testCompareNonExistentAttribute(conn, testBaseDN))
+		// Test 4: Compare on non-existent attribute
+		{Name: "Compare - Non-Existent Attribute Test (Negative)", Operation: "Compare", Requires: []string{FixtureTestUser}, Run: func() TestResult { return testCompareNonExistentAttribute(conn, testBaseDN) }},
+	}
+
+	// Create the fixtures of the add suite if it did not run
+	teardown := setupFixtures(conn, testBaseDN, trk, h, "compare", cases)
+	defer teardown()
+	results := h.Execute(cases)
 
 	logger.Info("CompareTest", "Completed Compare operation tests", "total", len(results))
 	return results
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// csvHeader is the first row of a --csv-out file
+var csvHeader = []string{"run_id", "iteration", "timestamp", "test", "operation", "status", "duration_ms", "result_code"}
+
+// AppendCSV appends one row per result to the CSV file at path, writing the
+// header first if the file is new or empty. Rows of every run and loop
+// iteration accumulate in the same file; iteration is 0 outside loop mode.
+func AppendCSV(path string, suite *TestSuite, iteration int) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat CSV file: %w", err)
+	}
+
+	w := csv.NewWriter(file)
+	if info.Size() == 0 {
+		if err := w.Write(csvHeader); err != nil {
+			return fmt.Errorf("failed to write CSV header: %w", err)
+		}
+	}
+
+	var loopIteration string
+	if iteration > 0 {
+		loopIteration = strconv.Itoa(iteration)
+	}
+	for _, result := range suite.Results {
+		timestamp := result.Started
+		if timestamp.IsZero() {
+			timestamp = suite.StartTime
+		}
+		row := []string{
+			suite.Metadata.RunID,
+			loopIteration,
+			timestamp.Format(time.RFC3339Nano),
+			result.Name,
+			result.Operation,
+			resultStatus(result),
+			strconv.FormatInt(result.Duration.Milliseconds(), 10),
+			resultCode(result),
+		}
+		if err := w.Write(row); err != nil {
+			return fmt.Errorf("failed to write CSV row: %w", err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV file: %w", err)
+	}
+	return nil
+}
+
+// resultCode returns the LDAP result code of a result: 0 for a passed test,
+// the code of the LDAP error of a failed one, empty if it is not known
+func resultCode(result TestResult) string {
+	if result.Passed && result.Error == nil {
+		return "0"
+	}
+	var ldapErr *ldaplib.Error
+	if errors.As(result.Error, &ldapErr) {
+		return strconv.Itoa(int(ldapErr.ResultCode))
+	}
+	return ""
+}
@@ -2,6 +2,9 @@ package tests
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"ldap-automated-actions/internal/ldap"
@@ -12,18 +15,35 @@ import (
 )
 
 // TestDelete runs all delete operation tests
-func TestDelete(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) []TestResult {
+func TestDelete(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
 	logger.Info("DeleteTest", "Starting Delete operation tests")
-	results := make([]TestResult, 0)
 
-	// Test 1: Delete a leaf entry
-	results = append(results, testDeleteLeaf(conn, testBaseDN, trk))
+	cases := []TestCase{
+		// Test 1: Delete a leaf entry
+		{Name: "Delete - Leaf Entry Test", Operation: "Delete", Run: func() TestResult { return testDeleteLeaf(conn, testBaseDN, trk) }},
 
-	// Test 2: Try to delete non-leaf entry (should fail)
-	results = append(results, testDeleteNonLeaf(conn, testBaseDN))
+		// Test 2: Try to delete non-leaf entry (should fail); the test user is
+		// the child that makes the test OU a non-leaf
+		{Name: "Delete - Non-Leaf Entry Test (Negative)", Operation: "Delete", Requires: []string{FixtureTestUser}, Run: func() TestResult { return testDeleteNonLeaf(conn, testBaseDN) }},
 
-	// Test 3: Try to delete non-existent entry (should fail)
-	results = append(results, testDeleteNonExistent(conn, testBaseDN))
+		// Test 3: Try to delete non-existent entry (should fail)
+		{Name: "Delete - Non-Existent Entry Test (Negative)", Operation: "Delete", Run: func() TestResult { return testDeleteNonExistent(conn, testBaseDN) }},
+
+		// Test 4: Delete a subtree in one request, as cleanup does when it can
+		{Name: "Delete - Subtree Delete Control Test", Operation: "Delete", Needs: []Capability{CapabilitySubtreeDelete}, Run: func() TestResult {
+			return testDeleteSubtree(conn, testBaseDN, trk, true)
+		}},
+
+		// Test 5: Delete a subtree entry by entry, as cleanup does otherwise
+		{Name: "Delete - Subtree Entry by Entry Test", Operation: "Delete", Run: func() TestResult {
+			return testDeleteSubtree(conn, testBaseDN, trk, false)
+		}},
+	}
+
+	// Create the fixtures of the add suite if it did not run
+	teardown := setupFixtures(conn, testBaseDN, trk, h, "delete", cases)
+	defer teardown()
+	results := h.Execute(cases)
 
 	logger.Info("DeleteTest", "Completed Delete operation tests", "total", len(results))
 	return results
@@ -43,7 +63,7 @@ func testDeleteLeaf(conn *ldap.Connection, testBaseDN string, trk *tracker.Track
 	addRequest.Attribute("cn", []string{cn})
 	addRequest.Attribute("sn", []string{"DeleteTest"})
 
-	err := conn.GetConnection().Add(addRequest)
+	err := createEntry(conn, addRequest)
 	if err != nil {
 		logger.Error("DeleteTest", "Failed to create test entry for deletion", "error", err)
 		return TestResult{
@@ -63,7 +83,7 @@ func testDeleteLeaf(conn *ldap.Connection, testBaseDN string, trk *tracker.Track
 	delRequest := ldaplib.NewDelRequest(dn, nil)
 
 	start := time.Now()
-	err = conn.GetConnection().Del(delRequest)
+	err = conn.Del(delRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -80,9 +100,16 @@ func testDeleteLeaf(conn *ldap.Connection, testBaseDN string, trk *tracker.Track
 		logger.Error("DeleteTest", result.Message)
 		// Entry still exists, so track it for cleanup
 		trk.Track(dn, tracker.TypeUser)
+	} else if err := verifyAbsent(conn, dn); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Delete returned success but read-back failed: %v", err)
+		logger.LogLDAPResult("Delete", "Delete", true, 0, "Success", duration)
+		logger.Error("DeleteTest", result.Message)
+		trk.Track(dn, tracker.TypeUser)
 	} else {
 		result.Passed = true
-		result.Message = fmt.Sprintf("Successfully deleted entry: %s", dn)
+		result.Message = fmt.Sprintf("Successfully deleted entry: %s (verified noSuchObject)", dn)
 		logger.LogLDAPResult("Delete", "Delete", true, 0, "Success", duration)
 		logger.Info("DeleteTest", "PASS: "+testName, "dn", dn, "duration", duration)
 		// Entry was deleted, no need to track
@@ -103,7 +130,7 @@ func testDeleteNonLeaf(conn *ldap.Connection, testBaseDN string) TestResult {
 	delRequest := ldaplib.NewDelRequest(dn, nil)
 
 	start := time.Now()
-	err := conn.GetConnection().Del(delRequest)
+	err := conn.Del(delRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -145,7 +172,7 @@ func testDeleteNonExistent(conn *ldap.Connection, testBaseDN string) TestResult
 	delRequest := ldaplib.NewDelRequest(dn, nil)
 
 	start := time.Now()
-	err := conn.GetConnection().Del(delRequest)
+	err := conn.Del(delRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -176,9 +203,246 @@ func testDeleteNonExistent(conn *ldap.Connection, testBaseDN string) TestResult
 	return result
 }
 
-// PerformCleanup deletes all tracked entries in reverse order
-func PerformCleanup(conn *ldap.Connection, trk *tracker.Tracker) error {
-	entries := trk.GetEntriesReversed()
+// testDeleteSubtree creates an OU with two users and deletes it the way
+// PerformCleanup would: with the Subtree Delete control, or entry by entry
+// after checking that a plain delete of the OU is refused, the fallback for
+// servers without the control. Every entry of the subtree must be gone.
+func testDeleteSubtree(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, control bool) TestResult {
+	testName := "Delete - Subtree Entry by Entry Test"
+	ou := "subtree-fallback"
+	if control {
+		testName = "Delete - Subtree Delete Control Test"
+		ou = "subtree-delete"
+	}
+	logger.Info("DeleteTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Delete",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("DeleteTest", result.Message)
+		return result
+	}
+
+	// The subtree is tracked on its own as well, in the order cleanup would
+	// delete it, and in the run's tracker until it is gone
+	ouDN := fmt.Sprintf("ou=%s,%s", ou, testBaseDN)
+	subtree := tracker.NewTracker()
+	ouRequest := ldaplib.NewAddRequest(ouDN, nil)
+	ouRequest.Attribute("objectClass", []string{"organizationalUnit"})
+	ouRequest.Attribute("ou", []string{ou})
+	if err := createEntry(conn, ouRequest); err != nil {
+		return fail(err, fmt.Sprintf("Failed to create test OU: %v", err))
+	}
+	trk.Track(ouDN, tracker.TypeOU)
+	subtree.Track(ouDN, tracker.TypeOU)
+
+	for _, cn := range []string{"subtree-user-1", "subtree-user-2"} {
+		dn := fmt.Sprintf("cn=%s,%s", cn, ouDN)
+		addRequest := ldaplib.NewAddRequest(dn, nil)
+		addRequest.Attribute("objectClass", []string{"inetOrgPerson"})
+		addRequest.Attribute("cn", []string{cn})
+		addRequest.Attribute("sn", []string{"Subtree"})
+		if err := createEntry(conn, addRequest); err != nil {
+			return fail(err, fmt.Sprintf("Failed to create test entry: %v", err))
+		}
+		trk.Track(dn, tracker.TypeUser)
+		subtree.Track(dn, tracker.TypeUser)
+	}
+	entries := cleanupEntries(subtree, ouDN)
+
+	start := time.Now()
+	if control {
+		logger.Trace("Delete", "Operation: Delete (Subtree Delete)", "dn", ouDN)
+		if err := subtreeDelete(conn, ouDN); err != nil {
+			result.Duration = time.Since(start)
+			return fail(err, fmt.Sprintf("Subtree Delete failed: %v", err))
+		}
+	} else {
+		logger.Trace("Delete", "Operation: Delete (non-leaf)", "dn", ouDN)
+		err := conn.Del(ldaplib.NewDelRequest(ouDN, nil))
+		if err == nil {
+			result.Duration = time.Since(start)
+			return fail(nil, "Delete of the OU without the Subtree Delete control succeeded, children and all")
+		}
+		if !ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultNotAllowedOnNonLeaf) {
+			result.Duration = time.Since(start)
+			return fail(err, fmt.Sprintf("Delete of the OU failed, expected notAllowedOnNonLeaf: %v", err))
+		}
+		deleteEntries(conn, entries)
+	}
+	result.Duration = time.Since(start)
+
+	for _, entry := range entries {
+		if err := verifyAbsent(conn, entry.DN); err != nil {
+			return fail(err, fmt.Sprintf("Subtree deleted but an entry remains: %v", err))
+		}
+		trk.Remove(entry.DN)
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Deleted %s and its 2 entries entry by entry (verified noSuchObject)", ouDN)
+	if control {
+		result.Message = fmt.Sprintf("Deleted %s and its 2 entries with one Subtree Delete (verified noSuchObject)", ouDN)
+	}
+	logger.Info("DeleteTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// removeStale deletes an entry and its children left behind by an earlier run
+// in a reused test OU; without one the entry cannot exist yet
+func removeStale(conn *ldap.Connection, dn string) error {
+	if conn.GetConfig().ReuseTestOU == "" {
+		return nil
+	}
+	_, err := deleteTree(conn, dn)
+	return err
+}
+
+// deleteTree deletes an entry after its children, ignoring a missing entry,
+// and returns the number of entries deleted. ManageDsaIT, not critical, makes
+// a referral object left by the referral suite an entry like any other.
+func deleteTree(conn *ldap.Connection, dn string) (int, error) {
+	manageDsaIT := []ldaplib.Control{ldaplib.NewControlManageDsaIT(false)}
+	searchRequest := ldaplib.NewSearchRequest(
+		dn,
+		ldaplib.ScopeSingleLevel,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		[]string{"1.1"},
+		manageDsaIT,
+	)
+	result, err := conn.GetConnection().Search(searchRequest)
+	if ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultNoSuchObject) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to list children of %s: %w", dn, err)
+	}
+
+	deleted := 0
+	for _, child := range result.Entries {
+		n, err := deleteTree(conn, child.DN)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	logger.Debug("Cleanup", "Deleting stale entry", "dn", dn)
+	err = conn.Del(ldaplib.NewDelRequest(dn, manageDsaIT))
+	switch {
+	case err == nil:
+		deleted++
+	case !ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultNoSuchObject):
+		return deleted, fmt.Errorf("failed to delete %s: %w", dn, err)
+	}
+	return deleted, nil
+}
+
+// StaleTestOU is a test OU found by CleanupOlderThan
+type StaleTestOU struct {
+	DN      string
+	Created time.Time // parsed from the timestamp in the OU name
+	Deleted int       // entries removed, including the OU itself
+	Error   error
+}
+
+// testOUName matches the names the default test OU template renders for
+// prefix, {{.Prefix}}-{{.Timestamp}} followed by the rest of the name, and
+// captures the timestamp
+func testOUName(prefix string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)^` + regexp.QuoteMeta(prefix) + `-(\d{8}-\d{6})(?:-|$)`)
+}
+
+// CleanupOlderThan deletes the subtrees of test OUs under baseDN whose
+// name-embedded timestamp, in UTC, is older than olderThan. Only OUs whose
+// name starts with prefix and a timestamp are considered, and none of the run
+// holding the lock of prefix, unless the lock is older than staleAfter; in
+// dry-run mode they are only listed.
+func CleanupOlderThan(conn *ldap.Connection, baseDN, prefix string, olderThan, staleAfter time.Duration, dryRun bool) ([]StaleTestOU, error) {
+	if prefix == "" {
+		return nil, fmt.Errorf("refusing to remove old test OUs without a test prefix")
+	}
+	holder, err := lockHolder(conn, prefix, baseDN, staleAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := andFilter("(objectClass=organizationalUnit)", substringFilter("ou", prefix+"-", ""))
+	logger.LogSearchOperation("Cleanup", baseDN, filter, "one", []string{"ou"})
+	searchRequest := ldaplib.NewSearchRequest(
+		baseDN,
+		ldaplib.ScopeSingleLevel,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		filter,
+		[]string{"ou"},
+		nil,
+	)
+	result, err := conn.GetConnection().Search(searchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for test OUs under %s: %w", baseDN, err)
+	}
+
+	reused := conn.GetConfig().ReusedTestOUDN()
+	pattern := testOUName(prefix)
+	threshold := time.Now().Add(-olderThan)
+	var stale []StaleTestOU
+	for _, entry := range result.Entries {
+		name := entry.GetAttributeValue("ou")
+		match := pattern.FindStringSubmatch(name)
+		if match == nil {
+			logger.Debug("Cleanup", "OU name does not start with the test prefix and a timestamp, leaving it", "dn", entry.DN)
+			continue
+		}
+		created, err := time.ParseInLocation("20060102-150405", match[1], time.UTC)
+		if err != nil {
+			logger.Debug("Cleanup", "Test OU name has an invalid timestamp, leaving it", "dn", entry.DN, "timestamp", match[1])
+			continue
+		}
+		if !created.Before(threshold) {
+			continue
+		}
+		// The OU of a run still holding the lock is in use, however old; it
+		// is recognized by the run ID, or its first 8 characters, in its name
+		if holder != "" && strings.Contains(strings.ToLower(name), strings.ToLower(holder[:min(8, len(holder))])) {
+			logger.Info("Cleanup", "Leaving test OU of the run holding the lock", "dn", entry.DN, "run", holder)
+			continue
+		}
+		// The sandbox of --reuse-test-ou is pre-created and must survive
+		if reused != "" && strings.EqualFold(entry.DN, reused) {
+			logger.Info("Cleanup", "Leaving re-used test OU", "dn", entry.DN)
+			continue
+		}
+
+		ou := StaleTestOU{DN: entry.DN, Created: created}
+		if dryRun {
+			logger.Info("Cleanup", "DRY RUN: Would delete test OU subtree", "dn", entry.DN, "created", created)
+		} else {
+			logger.Info("Cleanup", "Deleting test OU subtree", "dn", entry.DN, "created", created)
+			ou.Deleted, ou.Error = deleteTree(conn, entry.DN)
+			if ou.Error != nil {
+				logger.Warn("Cleanup", "Failed to delete test OU subtree", "dn", entry.DN, "deleted", ou.Deleted, "error", ou.Error)
+			}
+		}
+		stale = append(stale, ou)
+	}
+	return stale, nil
+}
+
+// PerformCleanup deletes all tracked entries in reverse order, or the whole
+// test OU with the Subtree Delete control, then searches for every tracked DN
+// to confirm the directory is clean or list leftovers. Entries outside
+// namespace, the run's test OU, are never touched.
+func PerformCleanup(conn *ldap.Connection, trk *tracker.Tracker, namespace string) error {
+	entries := cleanupEntries(trk, namespace)
 
 	if len(entries) == 0 {
 		logger.Info("Cleanup", "No entries to clean up")
@@ -187,29 +451,202 @@ func PerformCleanup(conn *ldap.Connection, trk *tracker.Tracker) error {
 
 	logger.Info("Cleanup", fmt.Sprintf("Starting cleanup of %d entries", len(entries)))
 
+	// A test OU the run created goes in one Subtree Delete when the server
+	// advertises the control; a dry run plans the deletes one by one, so
+	// that the plan applies anywhere
+	subtree := false
+	if ownsNamespace(entries, namespace) && !conn.GetConfig().DryRun && conn.GetServerInfo().SupportsControl(ldaplib.ControlTypeSubtreeDelete) {
+		if err := subtreeDelete(conn, namespace); err != nil {
+			logger.Warn("Cleanup", "Subtree Delete failed, deleting the entries one by one", "dn", namespace, "error", err)
+		} else {
+			logger.Info("Cleanup", fmt.Sprintf("Cleanup complete: deleted the test OU and its entries with one Subtree Delete (%d tracked)", len(entries)), "dn", namespace)
+			subtree = true
+		}
+	}
+	if !subtree {
+		deleteEntries(conn, entries)
+	}
+
+	// A tracked DN that still resolves is a leftover, whatever Delete answered
+	var leftovers []string
+	for _, entry := range entries {
+		if err := verifyAbsent(conn, entry.DN); err != nil {
+			logger.Warn("Cleanup", "Leftover entry", "dn", entry.DN, "reason", err)
+			leftovers = append(leftovers, entry.DN)
+		}
+	}
+
+	if len(leftovers) > 0 {
+		logger.Error("Cleanup", fmt.Sprintf("Directory is not clean: %d test entries remain", len(leftovers)), "leftovers", strings.Join(leftovers, "; "))
+		return fmt.Errorf("cleanup left %d entries behind", len(leftovers))
+	}
+
+	logger.Info("Cleanup", "Directory is clean: no tracked test entry resolves any more", "verified", len(entries))
+	return nil
+}
+
+// maxSubtreeCleanupPasses bounds the passes of a subtree cleanup, for entries
+// that cannot be deleted or keep appearing under the test OU
+const maxSubtreeCleanupPasses = 3
+
+// PerformSubtreeCleanup deletes everything found under namespace, the run's
+// test OU, whether the tracker knows it or not: entries renamed into it,
+// created by a worker that crashed before tracking them, or left by a server
+// side process. Each pass searches the subtree and deletes what it finds
+// deepest first; cleanup is done when a search finds nothing. The OU itself is
+// deleted too unless keepRoot.
+func PerformSubtreeCleanup(conn *ldap.Connection, namespace string, keepRoot bool) error {
+	for pass := 1; ; pass++ {
+		dns, err := subtreeEntries(conn, namespace, keepRoot)
+		if err != nil {
+			return err
+		}
+		if len(dns) == 0 {
+			logger.Info("Cleanup", "Directory is clean: the test OU subtree holds no entries", "dn", namespace, "passes", pass-1)
+			return nil
+		}
+		if pass > maxSubtreeCleanupPasses {
+			logger.Error("Cleanup", fmt.Sprintf("Directory is not clean: %d entries remain under the test OU", len(dns)), "leftovers", strings.Join(dns, "; "))
+			return fmt.Errorf("cleanup left %d entries behind", len(dns))
+		}
+
+		logger.Info("Cleanup", fmt.Sprintf("Subtree cleanup pass %d: deleting %d entries", pass, len(dns)), "dn", namespace)
+		deleted := 0
+		for _, dn := range dns {
+			// ManageDsaIT so a referral object is deleted rather than referred
+			err := conn.Del(ldaplib.NewDelRequest(dn, []ldaplib.Control{ldaplib.NewControlManageDsaIT(false)}))
+			switch {
+			case err == nil:
+				deleted++
+			case ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultNoSuchObject):
+				logger.Debug("Cleanup", "Entry already gone", "dn", dn)
+			default:
+				logger.Warn("Cleanup", "Failed to delete entry", "dn", dn, "error", err)
+			}
+		}
+		logger.Info("Cleanup", fmt.Sprintf("Subtree cleanup pass %d complete: %d of %d deleted", pass, deleted, len(dns)))
+	}
+}
+
+// subtreeEntries returns the DNs of the entries under namespace, deepest
+// first, with namespace itself last unless keepRoot. A namespace that does
+// not exist has no entries.
+func subtreeEntries(conn *ldap.Connection, namespace string, keepRoot bool) ([]string, error) {
+	searchRequest := ldaplib.NewSearchRequest(
+		namespace,
+		ldaplib.ScopeWholeSubtree,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		[]string{"1.1"},
+		[]ldaplib.Control{ldaplib.NewControlManageDsaIT(false)},
+	)
+	result, err := conn.GetConnection().SearchWithPaging(searchRequest, 500)
+	if ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultNoSuchObject) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to search the test OU subtree %s: %w", namespace, err)
+	}
+
+	var dns []string
+	for _, entry := range result.Entries {
+		if keepRoot && sameDN(entry.DN, namespace) {
+			continue
+		}
+		dns = append(dns, entry.DN)
+	}
+	sort.SliceStable(dns, func(i, j int) bool { return dnDepth(dns[i]) > dnDepth(dns[j]) })
+	return dns, nil
+}
+
+// ownsNamespace reports whether the test OU itself is among the tracked
+// entries, that is whether the run created it rather than reusing it
+func ownsNamespace(entries []tracker.TrackedEntry, namespace string) bool {
+	for _, entry := range entries {
+		if entry.Type == tracker.TypeOU && sameDN(entry.DN, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// subtreeDelete deletes an entry and everything below it in one request,
+// with the Subtree Delete control (draft-armijo-ldap-treedelete)
+func subtreeDelete(conn *ldap.Connection, dn string) error {
+	logger.Debug("Cleanup", "Deleting subtree", "dn", dn)
+	delRequest := ldaplib.NewDelRequest(dn, []ldaplib.Control{ldaplib.NewControlSubtreeDelete()})
+
+	start := time.Now()
+	err := conn.Del(delRequest)
+	duration := time.Since(start)
+	if err != nil {
+		logger.LogLDAPResult("Cleanup", "Subtree Delete", false, -1, err.Error(), duration)
+		return err
+	}
+	logger.LogLDAPResult("Cleanup", "Subtree Delete", true, 0, "Success", duration)
+	return nil
+}
+
+// deleteEntries deletes entries one by one in the order given, logging the
+// outcome; an entry already gone counts as deleted
+func deleteEntries(conn *ldap.Connection, entries []tracker.TrackedEntry) {
 	successCount := 0
+	goneCount := 0
 	failCount := 0
 
 	for _, entry := range entries {
 		logger.Debug("Cleanup", "Deleting entry", "dn", entry.DN, "type", entry.Type)
 
 		delRequest := ldaplib.NewDelRequest(entry.DN, nil)
-		err := conn.GetConnection().Del(delRequest)
+		if entry.Type == tracker.TypeReferral {
+			// Without ManageDsaIT the delete would be referred elsewhere
+			delRequest.Controls = append(delRequest.Controls, ldaplib.NewControlManageDsaIT(true))
+		}
+		err := conn.Del(delRequest)
 
-		if err != nil {
-			logger.Warn("Cleanup", "Failed to delete entry", "dn", entry.DN, "error", err)
-			failCount++
-		} else {
+		switch {
+		case err == nil:
 			logger.Info("Cleanup", "Successfully deleted entry", "dn", entry.DN)
 			successCount++
+		case ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultNoSuchObject):
+			// Renamed or already deleted; the verification below confirms it
+			logger.Debug("Cleanup", "Entry already gone", "dn", entry.DN)
+			goneCount++
+		default:
+			logger.Warn("Cleanup", "Failed to delete entry", "dn", entry.DN, "error", err)
+			failCount++
 		}
 	}
 
-	logger.Info("Cleanup", fmt.Sprintf("Cleanup complete: %d deleted, %d failed", successCount, failCount))
+	logger.Info("Cleanup", fmt.Sprintf("Cleanup complete: %d deleted, %d already gone, %d failed", successCount, goneCount, failCount))
+}
 
-	if failCount > 0 {
-		return fmt.Errorf("cleanup completed with %d failures", failCount)
+// cleanupEntries returns the tracked entries within namespace in deletion
+// order: reverse creation order, with deeper DNs first so that an entry moved
+// under an OU created after it is still deleted before that OU
+func cleanupEntries(trk *tracker.Tracker, namespace string) []tracker.TrackedEntry {
+	var entries []tracker.TrackedEntry
+	for _, entry := range trk.GetEntriesReversed() {
+		if !inNamespace(entry.DN, namespace) {
+			logger.Warn("Cleanup", "Refusing to delete entry outside the run's test OU", "dn", entry.DN, "testBaseDN", namespace)
+			continue
+		}
+		entries = append(entries, entry)
 	}
+	sort.SliceStable(entries, func(i, j int) bool { return dnDepth(entries[i].DN) > dnDepth(entries[j].DN) })
+	return entries
+}
 
-	return nil
+// inNamespace reports whether dn is namespace itself or lies below it
+func inNamespace(dn, namespace string) bool {
+	entryDN, err := ldaplib.ParseDN(dn)
+	if err != nil {
+		return false
+	}
+	namespaceDN, err := ldaplib.ParseDN(namespace)
+	if err != nil || len(namespaceDN.RDNs) == 0 {
+		return false
+	}
+	return namespaceDN.EqualFold(entryDN) || namespaceDN.AncestorOfFold(entryDN)
 }
@@ -0,0 +1,316 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// diffMaxLatencies is the number of latency changes shown in the console,
+// largest first; the JSON diff holds them all
+const diffMaxLatencies = 20
+
+// ReportDiff is the comparison of two JSON reports
+type ReportDiff struct {
+	Before      diffRun         `json:"before"`
+	After       diffRun         `json:"after"`
+	NewFailures []statusChange  `json:"new_failures"` // failing after, passed, skipped or missing before
+	Fixed       []statusChange  `json:"fixed"`        // failed before, passing after
+	Changed     []statusChange  `json:"changed"`      // other status changes, e.g. pass to skip
+	Added       []diffTest      `json:"added"`        // only in the after report
+	Removed     []diffTest      `json:"removed"`      // only in the before report
+	Latencies   []latencyChange `json:"latencies"`    // tests executed in both, largest change first
+	Operations  []latencyChange `json:"operations"`   // average latency by operation
+}
+
+// diffRun identifies one side of the diff
+type diffRun struct {
+	File    string      `json:"file"`
+	RunID   string      `json:"run_id"`
+	Server  jsonServer  `json:"server"`
+	Status  string      `json:"status"`
+	Summary jsonSummary `json:"summary"`
+}
+
+type diffTest struct {
+	Name      string `json:"name"`
+	Operation string `json:"operation"`
+	Worker    int    `json:"worker,omitempty"`
+	Status    string `json:"status"`
+}
+
+type statusChange struct {
+	diffTest
+	Before string `json:"before"` // status before, empty if the test is new
+	Error  string `json:"error,omitempty"`
+}
+
+type latencyChange struct {
+	Name      string  `json:"name,omitempty"` // empty for an operation
+	Operation string  `json:"operation"`
+	Worker    int     `json:"worker,omitempty"`
+	BeforeMS  float64 `json:"before_ms"`
+	AfterMS   float64 `json:"after_ms"`
+	DeltaMS   float64 `json:"delta_ms"`
+	Percent   float64 `json:"delta_percent"` // 0 if before was 0
+}
+
+// diffKey identifies a test across reports; concurrent runs report each
+// test once per worker
+type diffKey struct {
+	operation string
+	name      string
+	worker    int
+}
+
+// ReadJSONReport reads a report written by --report-format json
+func ReadJSONReport(path string) (*jsonReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid JSON report %s: %w", path, err)
+	}
+	if report.RunID == "" && report.Results == nil {
+		return nil, fmt.Errorf("invalid JSON report %s: no run ID or results", path)
+	}
+	return &report, nil
+}
+
+// DiffReports compares the JSON reports at beforePath and afterPath
+func DiffReports(beforePath, afterPath string) (*ReportDiff, error) {
+	before, err := ReadJSONReport(beforePath)
+	if err != nil {
+		return nil, err
+	}
+	after, err := ReadJSONReport(afterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &ReportDiff{
+		Before:      diffRun{File: beforePath, RunID: before.RunID, Server: before.Server, Status: before.Status, Summary: before.Summary},
+		After:       diffRun{File: afterPath, RunID: after.RunID, Server: after.Server, Status: after.Status, Summary: after.Summary},
+		NewFailures: []statusChange{},
+		Fixed:       []statusChange{},
+		Changed:     []statusChange{},
+		Added:       []diffTest{},
+		Removed:     []diffTest{},
+		Latencies:   []latencyChange{},
+		Operations:  []latencyChange{},
+	}
+
+	beforeResults := make(map[diffKey]jsonResult, len(before.Results))
+	for _, result := range before.Results {
+		beforeResults[diffKey{result.Operation, result.Name, result.Worker}] = result
+	}
+
+	type opLatency struct {
+		before, after float64
+		tests         int
+	}
+	operations := make(map[string]*opLatency)
+	seen := make(map[diffKey]bool, len(after.Results))
+	for _, result := range after.Results {
+		key := diffKey{result.Operation, result.Name, result.Worker}
+		seen[key] = true
+		test := diffTest{Name: result.Name, Operation: result.Operation, Worker: result.Worker, Status: result.Status}
+
+		old, ok := beforeResults[key]
+		if !ok {
+			diff.Added = append(diff.Added, test)
+			if result.Status == "fail" {
+				diff.NewFailures = append(diff.NewFailures, statusChange{diffTest: test, Error: result.Error})
+			}
+			continue
+		}
+
+		change := statusChange{diffTest: test, Before: old.Status, Error: result.Error}
+		switch {
+		case old.Status == result.Status:
+		case result.Status == "fail":
+			diff.NewFailures = append(diff.NewFailures, change)
+		case old.Status == "fail" && result.Status == "pass":
+			diff.Fixed = append(diff.Fixed, change)
+		default:
+			diff.Changed = append(diff.Changed, change)
+		}
+
+		// Latencies compare only tests that executed in both runs
+		if old.Status == "skip" || result.Status == "skip" {
+			continue
+		}
+		diff.Latencies = append(diff.Latencies, newLatencyChange(result.Name, result.Operation, result.Worker,
+			float64(old.DurationMS), float64(result.DurationMS)))
+		op := operations[result.Operation]
+		if op == nil {
+			op = &opLatency{}
+			operations[result.Operation] = op
+		}
+		op.before += float64(old.DurationMS)
+		op.after += float64(result.DurationMS)
+		op.tests++
+	}
+	for _, result := range before.Results {
+		if !seen[diffKey{result.Operation, result.Name, result.Worker}] {
+			diff.Removed = append(diff.Removed, diffTest{Name: result.Name, Operation: result.Operation, Worker: result.Worker, Status: result.Status})
+		}
+	}
+
+	sort.SliceStable(diff.Latencies, func(i, j int) bool {
+		return math.Abs(diff.Latencies[i].DeltaMS) > math.Abs(diff.Latencies[j].DeltaMS)
+	})
+	names := make([]string, 0, len(operations))
+	for name := range operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		op := operations[name]
+		diff.Operations = append(diff.Operations, newLatencyChange("", name, 0, op.before/float64(op.tests), op.after/float64(op.tests)))
+	}
+	return diff, nil
+}
+
+func newLatencyChange(name, operation string, worker int, beforeMS, afterMS float64) latencyChange {
+	change := latencyChange{
+		Name:      name,
+		Operation: operation,
+		Worker:    worker,
+		BeforeMS:  round1(beforeMS),
+		AfterMS:   round1(afterMS),
+		DeltaMS:   round1(afterMS - beforeMS),
+	}
+	if beforeMS > 0 {
+		change.Percent = round1((afterMS - beforeMS) * 100 / beforeMS)
+	}
+	return change
+}
+
+func round1(f float64) float64 {
+	return math.Round(f*10) / 10
+}
+
+// WriteJSON writes the diff as an indented JSON document
+func (d *ReportDiff) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// WriteText writes the diff in the layout of the console report
+func (d *ReportDiff) WriteText(w io.Writer) {
+	fmt.Fprintln(w, "\n"+strings.Repeat("=", 80))
+	fmt.Fprintln(w, "REPORT DIFF")
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+	for _, side := range []struct {
+		label string
+		run   diffRun
+	}{{"Before:", d.Before}, {"After:", d.After}} {
+		server := side.run.Server.Address
+		if side.run.Server.VendorName != "" {
+			server = fmt.Sprintf("%s (%s %s)", server, side.run.Server.VendorName, side.run.Server.VendorVersion)
+		}
+		fmt.Fprintf(w, "%-16s %s, run %s\n", side.label, side.run.File, side.run.RunID)
+		fmt.Fprintf(w, "%-16s %s, %d tests: %d passed, %d failed, %d skipped\n", "", server,
+			side.run.Summary.Total, side.run.Summary.Passed, side.run.Summary.Failed, side.run.Summary.Skipped)
+	}
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+
+	writeChanges := func(title, marker string, changes []statusChange) {
+		if len(changes) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s (%d):\n", title, len(changes))
+		for _, change := range changes {
+			before := change.Before
+			if before == "" {
+				before = "new"
+			}
+			fmt.Fprintf(w, "  %s  %-58s  %s -> %s\n", marker, diffTestName(change.diffTest), before, change.Status)
+			if change.Status == "fail" && change.Error != "" {
+				fmt.Fprintf(w, "         Error: %s\n", change.Error)
+			}
+		}
+	}
+	writeChanges("New Failures", "✗", d.NewFailures)
+	writeChanges("Fixed", "✓", d.Fixed)
+	writeChanges("Other Status Changes", "-", d.Changed)
+
+	writeTests := func(title string, tests []diffTest) {
+		if len(tests) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s (%d):\n", title, len(tests))
+		for _, test := range tests {
+			fmt.Fprintf(w, "     %-58s  %s\n", diffTestName(test), test.Status)
+		}
+	}
+	writeTests("Only in After", d.Added)
+	writeTests("Only in Before", d.Removed)
+
+	if len(d.Operations) > 0 {
+		fmt.Fprintln(w, "\nAverage Latency by Operation:")
+		for _, op := range d.Operations {
+			fmt.Fprintf(w, "  %-40s %10s -> %-10s %s\n", op.Operation, formatDiffMS(op.BeforeMS), formatDiffMS(op.AfterMS), formatDelta(op))
+		}
+	}
+	var changed []latencyChange
+	for _, change := range d.Latencies {
+		if change.DeltaMS != 0 {
+			changed = append(changed, change)
+		}
+	}
+	if len(changed) > 0 {
+		shown := changed[:min(len(changed), diffMaxLatencies)]
+		fmt.Fprintf(w, "\nLargest Latency Changes (%d of %d tests changed):\n", len(shown), len(changed))
+		for _, change := range shown {
+			name := diffTestName(diffTest{Name: change.Name, Operation: change.Operation, Worker: change.Worker})
+			fmt.Fprintf(w, "  %-40s %10s -> %-10s %s\n", truncateName(name, 40), formatDiffMS(change.BeforeMS), formatDiffMS(change.AfterMS), formatDelta(change))
+		}
+	}
+
+	fmt.Fprintln(w, "\n"+strings.Repeat("=", 80))
+	switch len(d.NewFailures) {
+	case 0:
+		fmt.Fprintln(w, "✓ NO NEW FAILURES")
+	case 1:
+		fmt.Fprintln(w, "✗ 1 NEW FAILURE")
+	default:
+		fmt.Fprintf(w, "✗ %d NEW FAILURES\n", len(d.NewFailures))
+	}
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+}
+
+func diffTestName(test diffTest) string {
+	name := test.Operation + " / " + test.Name
+	if test.Worker > 0 {
+		name += fmt.Sprintf(" (worker %d)", test.Worker)
+	}
+	return name
+}
+
+func truncateName(name string, n int) string {
+	runes := []rune(name)
+	if len(runes) <= n {
+		return name
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+func formatDiffMS(ms float64) string {
+	return fmt.Sprintf("%gms", ms)
+}
+
+func formatDelta(change latencyChange) string {
+	if change.BeforeMS == 0 {
+		return fmt.Sprintf("%+gms", change.DeltaMS)
+	}
+	return fmt.Sprintf("%+gms (%+g%%)", change.DeltaMS, change.Percent)
+}
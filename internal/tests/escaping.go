@@ -0,0 +1,538 @@
+package tests
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// Fixtures of the escaping suite
+const (
+	FixtureEscapedEntries = "escaped entries" // entries with special characters in their RDN
+	FixtureFilterValues   = "filter values"   // entries with filter special characters in their description
+)
+
+// escapedNames are the cn values of the escaping suite, each with characters
+// that must be escaped in a DN (RFC 4514): a comma, a plus sign, which would
+// otherwise start a multi-valued RDN, double quotes, and leading and trailing
+// spaces
+var escapedNames = []string{
+	"Smith, John",
+	"R&D + Operations",
+	`Say "Hello"`,
+	" Padded Name ",
+}
+
+// filterValueEntries are the entries the filter tests search, in their own OU
+// so that no other entry can match, each with a description holding a
+// character that is special in a filter. filter-plain differs from filter-star
+// only where the star is, which a substring match would not tell apart.
+var filterValueEntries = []struct {
+	cn          string
+	description string
+}{
+	{cn: "filter-star", description: "5 * 3"},
+	{cn: "filter-plain", description: "5 - 3"},
+	{cn: "filter-parens", description: "(admin)"},
+	{cn: "filter-backslash", description: `C:\Users`},
+}
+
+// filterValuesOU is the OU of filterValueEntries
+func filterValuesOU(testBaseDN string) string {
+	return fmt.Sprintf("ou=filter-values,%s", testBaseDN)
+}
+
+// filterSearch is a search of the filter tests and the cn values of the
+// entries it must return. A search with rejectable set may instead be
+// refused as an invalid assertion, which matches nothing either.
+type filterSearch struct {
+	filter     string
+	want       []string
+	rejectable bool
+}
+
+// escapingState holds the current DNs of the suite's entries, by index of
+// escapedNames, as renames change them
+type escapingState struct {
+	dns []string
+}
+
+// escapedDN is the DN of the entry named cn under testBaseDN
+func escapedDN(cn, testBaseDN string) string {
+	return fmt.Sprintf("cn=%s,%s", ldaplib.EscapeDN(cn), testBaseDN)
+}
+
+// escapedRenamed is the cn an entry of the suite is renamed to
+func escapedRenamed(cn string) string {
+	return "Renamed, " + cn
+}
+
+// TestEscaping runs the escaping tests: entries whose RDN has a comma, a plus
+// sign, quotes or leading and trailing spaces are added, searched for,
+// modified, renamed and deleted by their escaped DNs, and values with a *, (,
+// ), \ or NUL are searched for with escaped filters, which must match them
+// literally
+func TestEscaping(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
+	logger.Info("EscapingTest", "Starting DN special-character escaping tests")
+
+	state := &escapingState{dns: make([]string, len(escapedNames))}
+	for i, cn := range escapedNames {
+		state.dns[i] = escapedDN(cn, testBaseDN)
+	}
+
+	results := h.Execute([]TestCase{
+		// Test 1: Add the entries and read them back by their escaped DNs
+		{Name: "Escaping - Add Entries Test", Operation: "Escaping", Provides: FixtureEscapedEntries, Run: func() TestResult {
+			return testEscapingAdd(conn, trk, state)
+		}},
+
+		// Test 2: Find each entry by its cn and compare the DN returned
+		{Name: "Escaping - Search Test", Operation: "Escaping", Requires: []string{FixtureEscapedEntries}, Run: func() TestResult {
+			return testEscapingSearch(conn, testBaseDN, state)
+		}},
+
+		// Test 3: Modify each entry through its escaped DN
+		{Name: "Escaping - Modify Test", Operation: "Escaping", Requires: []string{FixtureEscapedEntries}, Run: func() TestResult {
+			return testEscapingModify(conn, state)
+		}},
+
+		// Test 4: Rename each entry to another RDN that needs escaping
+		{Name: "Escaping - Rename Test", Operation: "Escaping", Requires: []string{FixtureEscapedEntries}, Run: func() TestResult {
+			return testEscapingRename(conn, testBaseDN, trk, state)
+		}},
+
+		// Test 5: Add the entries with filter special characters in their description
+		{Name: "Escaping - Add Filter Value Entries Test", Operation: "Escaping", Provides: FixtureFilterValues, Run: func() TestResult {
+			return testEscapingAddFilterValues(conn, testBaseDN, trk)
+		}},
+
+		// Test 6: Escaped filters match the special characters literally
+		{Name: "Escaping - Filter Literal Match Test", Operation: "Escaping", Requires: []string{FixtureFilterValues}, Run: func() TestResult {
+			return testEscapingFilters(conn, testBaseDN, []filterSearch{
+				{filter: "(description=*)", want: []string{"filter-star", "filter-plain", "filter-parens", "filter-backslash"}},
+				{filter: eqFilter("description", "5 * 3"), want: []string{"filter-star"}},
+				{filter: eqFilter("description", "(admin)"), want: []string{"filter-parens"}},
+				{filter: eqFilter("description", `C:\Users`), want: []string{"filter-backslash"}},
+				{filter: substringFilter("description", "", "*", ""), want: []string{"filter-star"}},
+				{filter: substringFilter("description", "", "(", ""), want: []string{"filter-parens"}},
+				{filter: substringFilter("description", "", `\`, ""), want: []string{"filter-backslash"}},
+				// A bare star would be a presence filter
+				{filter: eqFilter("cn", "*"), want: nil},
+				// Unescaped, the value would close the filter and add a term matching everything
+				{filter: eqFilter("description", "*)(objectClass=*"), want: nil},
+				// The NUL must not end the value, as it would a C string
+				{filter: eqFilter("description", "5 - 3\x00"), want: nil, rejectable: true},
+			})
+		}},
+
+		// Test 7: Delete the entries by their current DNs
+		{Name: "Escaping - Delete Test", Operation: "Escaping", Requires: []string{FixtureEscapedEntries}, Run: func() TestResult {
+			return testEscapingDelete(conn, trk, state)
+		}},
+	})
+
+	logger.Info("EscapingTest", "Completed DN special-character escaping tests", "total", len(results))
+	return results
+}
+
+// verifyEscapedEntry reads the entry at dn and checks that the server returns
+// it under a DN whose RDN value is cn exactly, and with cn as a value
+func verifyEscapedEntry(conn *ldap.Connection, dn, cn string) error {
+	entry, err := readAttributes(conn, dn, "cn")
+	if err != nil {
+		return err
+	}
+	parsed, err := ldaplib.ParseDN(entry.DN)
+	if err != nil {
+		return fmt.Errorf("server returned %s as %q, which does not parse: %w", dn, entry.DN, err)
+	}
+	if len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) != 1 || parsed.RDNs[0].Attributes[0].Value != cn {
+		return fmt.Errorf("server returned %s as %q, whose RDN is not cn=%q", dn, entry.DN, cn)
+	}
+	if !slices.Contains(entry.GetEqualFoldAttributeValues("cn"), cn) {
+		return fmt.Errorf("cn of %s is %q, want %q", dn, entry.GetEqualFoldAttributeValues("cn"), cn)
+	}
+	return nil
+}
+
+func testEscapingAdd(conn *ldap.Connection, trk *tracker.Tracker, state *escapingState) TestResult {
+	testName := "Escaping - Add Entries Test"
+	logger.Info("EscapingTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Escaping",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("EscapingTest", result.Message)
+		return result
+	}
+
+	start := time.Now()
+	for i, cn := range escapedNames {
+		dn := state.dns[i]
+		addRequest := ldaplib.NewAddRequest(dn, nil)
+		addRequest.Attribute("objectClass", []string{"top", "person", "organizationalPerson", "inetOrgPerson"})
+		addRequest.Attribute("cn", []string{cn})
+		addRequest.Attribute("sn", []string{"EscapingTest"})
+
+		logger.Trace("Escaping", "Operation: Add", "dn", dn)
+		addStart := time.Now()
+		if err := createEntry(conn, addRequest); err != nil {
+			logger.LogLDAPResult("Escaping", "Add", false, -1, err.Error(), time.Since(addStart))
+			result.Duration = time.Since(start)
+			return fail(err, fmt.Sprintf("Failed to add %s: %v", dn, err))
+		}
+		logger.LogLDAPResult("Escaping", "Add", true, 0, "Success", time.Since(addStart))
+		trk.Track(dn, tracker.TypeUser)
+
+		if err := verifyEscapedEntry(conn, dn, cn); err != nil {
+			result.Duration = time.Since(start)
+			return fail(err, fmt.Sprintf("Add returned success but read-back failed: %v", err))
+		}
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Added %d entries with escaped RDNs (verified by read-back)", len(escapedNames))
+	logger.Info("EscapingTest", "PASS: "+testName, "entries", len(escapedNames), "duration", result.Duration)
+	return result
+}
+
+func testEscapingSearch(conn *ldap.Connection, testBaseDN string, state *escapingState) TestResult {
+	testName := "Escaping - Search Test"
+	logger.Info("EscapingTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Escaping",
+	}
+
+	start := time.Now()
+	for i, cn := range escapedNames {
+		filter := andFilter("(objectClass=inetOrgPerson)", eqFilter("cn", cn))
+		attributes := []string{"cn"}
+		searchRequest := ldaplib.NewSearchRequest(
+			testBaseDN,
+			ldaplib.ScopeSingleLevel,
+			ldaplib.NeverDerefAliases,
+			0, 0, false,
+			filter,
+			attributes,
+			nil,
+		)
+
+		logger.LogSearchOperation("EscapingTest", testBaseDN, filter, "one", attributes)
+		searchStart := time.Now()
+		searchResult, err := conn.Search(searchRequest)
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Search %s failed: %v", filter, err)
+			logger.LogLDAPResult("Search", "Search", false, -1, err.Error(), time.Since(searchStart))
+			logger.Error("EscapingTest", result.Message)
+			return result
+		}
+		logger.LogSearchResult("EscapingTest", len(searchResult.Entries), time.Since(searchStart))
+
+		// The DN of the entry found must name the same entry, and be one the
+		// server then accepts as the base of a search
+		if len(searchResult.Entries) != 1 || !sameDN(searchResult.Entries[0].DN, state.dns[i]) {
+			found := make([]string, len(searchResult.Entries))
+			for j, entry := range searchResult.Entries {
+				found[j] = entry.DN
+			}
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Message = fmt.Sprintf("Search %s returned %q, want only %q", filter, found, state.dns[i])
+			logger.Error("EscapingTest", result.Message)
+			return result
+		}
+		if err := verifyEscapedEntry(conn, searchResult.Entries[0].DN, cn); err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Failed to read the entry at the DN the search returned: %v", err)
+			logger.Error("EscapingTest", result.Message)
+			return result
+		}
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Found all %d entries by cn, at DNs that read back", len(escapedNames))
+	logger.Info("EscapingTest", "PASS: "+testName, "entries", len(escapedNames), "duration", result.Duration)
+	return result
+}
+
+func testEscapingModify(conn *ldap.Connection, state *escapingState) TestResult {
+	testName := "Escaping - Modify Test"
+	logger.Info("EscapingTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Escaping",
+	}
+
+	start := time.Now()
+	for i, cn := range escapedNames {
+		dn := state.dns[i]
+		description := fmt.Sprintf("Modified through the escaped DN of %q", cn)
+		modifyRequest := ldaplib.NewModifyRequest(dn, nil)
+		modifyRequest.Replace("description", []string{description})
+
+		logger.Trace("Escaping", "Operation: Modify (Replace description)", "dn", dn)
+		modifyStart := time.Now()
+		err := conn.Modify(modifyRequest)
+		if err != nil {
+			logger.LogLDAPResult("Escaping", "Modify (Replace)", false, -1, err.Error(), time.Since(modifyStart))
+		} else {
+			logger.LogLDAPResult("Escaping", "Modify (Replace)", true, 0, "Success", time.Since(modifyStart))
+			err = verifyAttributeValues(conn, dn, "description", []string{description})
+		}
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Failed to modify %s: %v", dn, err)
+			logger.Error("EscapingTest", result.Message)
+			return result
+		}
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Modified all %d entries through their escaped DNs (verified by read-back)", len(escapedNames))
+	logger.Info("EscapingTest", "PASS: "+testName, "entries", len(escapedNames), "duration", result.Duration)
+	return result
+}
+
+func testEscapingRename(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, state *escapingState) TestResult {
+	testName := "Escaping - Rename Test"
+	logger.Info("EscapingTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Escaping",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("EscapingTest", result.Message)
+		return result
+	}
+
+	start := time.Now()
+	for i, cn := range escapedNames {
+		oldDN := state.dns[i]
+		newCN := escapedRenamed(cn)
+		newRDN := "cn=" + ldaplib.EscapeDN(newCN)
+		newDN := escapedDN(newCN, testBaseDN)
+
+		if err := removeStale(conn, newDN); err != nil {
+			logger.Warn("EscapingTest", "Failed to remove stale rename target", "error", err)
+		}
+		logger.Trace("Escaping", "Operation: ModifyDN", "oldDN", oldDN, "newRDN", newRDN)
+		renameStart := time.Now()
+		if err := conn.ModifyDN(ldaplib.NewModifyDNRequest(oldDN, newRDN, true, "")); err != nil {
+			logger.LogLDAPResult("Escaping", "ModifyDN", false, -1, err.Error(), time.Since(renameStart))
+			result.Duration = time.Since(start)
+			return fail(err, fmt.Sprintf("Failed to rename %s to %s: %v", oldDN, newRDN, err))
+		}
+		logger.LogLDAPResult("Escaping", "ModifyDN", true, 0, "Success", time.Since(renameStart))
+		trk.Rename(oldDN, newDN)
+		state.dns[i] = newDN
+
+		// The old RDN value is deleted with the rename
+		err := verifyAbsent(conn, oldDN)
+		if err == nil {
+			err = verifyEscapedEntry(conn, newDN, newCN)
+		}
+		if err == nil {
+			err = verifyAttributeValues(conn, newDN, "cn", []string{newCN})
+		}
+		if err != nil {
+			result.Duration = time.Since(start)
+			return fail(err, fmt.Sprintf("Rename returned success but read-back failed: %v", err))
+		}
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Renamed all %d entries to escaped RDNs (verified by read-back)", len(escapedNames))
+	logger.Info("EscapingTest", "PASS: "+testName, "entries", len(escapedNames), "duration", result.Duration)
+	return result
+}
+
+func testEscapingDelete(conn *ldap.Connection, trk *tracker.Tracker, state *escapingState) TestResult {
+	testName := "Escaping - Delete Test"
+	logger.Info("EscapingTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Escaping",
+	}
+
+	start := time.Now()
+	for _, dn := range state.dns {
+		logger.Trace("Escaping", "Operation: Delete", "dn", dn)
+		deleteStart := time.Now()
+		err := conn.Del(ldaplib.NewDelRequest(dn, nil))
+		if err != nil {
+			logger.LogLDAPResult("Escaping", "Delete", false, -1, err.Error(), time.Since(deleteStart))
+		} else {
+			logger.LogLDAPResult("Escaping", "Delete", true, 0, "Success", time.Since(deleteStart))
+			err = verifyAbsent(conn, dn)
+		}
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Failed to delete %s: %v", dn, err)
+			logger.Error("EscapingTest", result.Message)
+			return result
+		}
+		trk.Remove(dn)
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Deleted all %d entries by their escaped DNs (verified noSuchObject)", len(state.dns))
+	logger.Info("EscapingTest", "PASS: "+testName, "entries", len(state.dns), "duration", result.Duration)
+	return result
+}
+
+func testEscapingAddFilterValues(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) TestResult {
+	testName := "Escaping - Add Filter Value Entries Test"
+	logger.Info("EscapingTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Escaping",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("EscapingTest", result.Message)
+		return result
+	}
+
+	start := time.Now()
+	ouDN := filterValuesOU(testBaseDN)
+	ouRequest := ldaplib.NewAddRequest(ouDN, nil)
+	ouRequest.Attribute("objectClass", []string{"organizationalUnit"})
+	ouRequest.Attribute("ou", []string{"filter-values"})
+	if err := createEntry(conn, ouRequest); err != nil {
+		return fail(err, fmt.Sprintf("Failed to create test OU: %v", err))
+	}
+	trk.Track(ouDN, tracker.TypeOU)
+
+	for _, entry := range filterValueEntries {
+		dn := fmt.Sprintf("cn=%s,%s", entry.cn, ouDN)
+		addRequest := ldaplib.NewAddRequest(dn, nil)
+		addRequest.Attribute("objectClass", []string{"top", "person", "organizationalPerson", "inetOrgPerson"})
+		addRequest.Attribute("cn", []string{entry.cn})
+		addRequest.Attribute("sn", []string{"EscapingTest"})
+		addRequest.Attribute("description", []string{entry.description})
+
+		logger.Trace("Escaping", "Operation: Add", "dn", dn)
+		if err := createEntry(conn, addRequest); err != nil {
+			result.Duration = time.Since(start)
+			return fail(err, fmt.Sprintf("Failed to add %s: %v", dn, err))
+		}
+		trk.Track(dn, tracker.TypeUser)
+
+		if err := verifyAttributeValues(conn, dn, "description", []string{entry.description}); err != nil {
+			result.Duration = time.Since(start)
+			return fail(err, fmt.Sprintf("Add returned success but read-back failed: %v", err))
+		}
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Added %d entries with filter special characters in their description under %s (verified by read-back)", len(filterValueEntries), ouDN)
+	logger.Info("EscapingTest", "PASS: "+testName, "entries", len(filterValueEntries), "duration", result.Duration)
+	return result
+}
+
+// testEscapingFilters runs the searches one level under the OU of the filter
+// value entries and passes if each returns exactly the entries it wants
+func testEscapingFilters(conn *ldap.Connection, testBaseDN string, searches []filterSearch) TestResult {
+	testName := "Escaping - Filter Literal Match Test"
+	logger.Info("EscapingTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Escaping",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("EscapingTest", result.Message)
+		return result
+	}
+
+	ouDN := filterValuesOU(testBaseDN)
+	start := time.Now()
+	for _, search := range searches {
+		filter := andFilter("(objectClass=inetOrgPerson)", search.filter)
+		attributes := []string{"cn"}
+		searchRequest := ldaplib.NewSearchRequest(
+			ouDN,
+			ldaplib.ScopeSingleLevel,
+			ldaplib.NeverDerefAliases,
+			0, 0, false,
+			filter,
+			attributes,
+			nil,
+		)
+
+		logger.LogSearchOperation("EscapingTest", ouDN, filter, "one", attributes)
+		searchStart := time.Now()
+		searchResult, err := conn.Search(searchRequest)
+		if err != nil {
+			logger.LogLDAPResult("Search", "Search", false, -1, err.Error(), time.Since(searchStart))
+			if search.rejectable && ldaplib.IsErrorAnyOf(err, ldaplib.LDAPResultProtocolError, ldaplib.LDAPResultInappropriateMatching, ldaplib.LDAPResultInvalidAttributeSyntax) {
+				logger.Debug("EscapingTest", "Server rejected the assertion, which matches nothing", "filter", search.filter, "error", err)
+				continue
+			}
+			result.Duration = time.Since(start)
+			return fail(err, fmt.Sprintf("Search %q failed: %v", search.filter, err))
+		}
+		logger.LogSearchResult("EscapingTest", len(searchResult.Entries), time.Since(searchStart))
+
+		found := make([]string, len(searchResult.Entries))
+		for i, entry := range searchResult.Entries {
+			found[i] = entry.GetEqualFoldAttributeValue("cn")
+		}
+		slices.Sort(found)
+		want := slices.Sorted(slices.Values(search.want))
+		if !slices.Equal(found, want) {
+			result.Duration = time.Since(start)
+			return fail(nil, fmt.Sprintf("Search %q returned %q, want %q: the server did not match the escaped value literally", search.filter, found, want))
+		}
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("All %d escaped filters matched their values literally", len(searches))
+	logger.Info("EscapingTest", "PASS: "+testName, "searches", len(searches), "duration", result.Duration)
+	return result
+}
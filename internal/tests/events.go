@@ -0,0 +1,233 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"ldap-automated-actions/internal/logger"
+)
+
+// Event is a single NDJSON line of the result stream
+type Event struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	RunID     string    `json:"run_id"`
+	Iteration int       `json:"iteration,omitempty"`
+
+	// run_start
+	ToolVersion string `json:"tool_version,omitempty"`
+	Hostname    string `json:"hostname,omitempty"`
+	ConfigHash  string `json:"config_hash,omitempty"`
+	TestSuite   string `json:"test_suite,omitempty"`
+
+	// test, suite_start, suite_end
+	Suite     string `json:"suite,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Operation string `json:"operation,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Error     string `json:"error,omitempty"`
+
+	// suite_end, run_end
+	Total       *int   `json:"total,omitempty"`
+	Passed      *int   `json:"passed,omitempty"`
+	Failed      *int   `json:"failed,omitempty"`
+	Skipped     *int   `json:"skipped,omitempty"`
+	DurationMS  int64  `json:"duration_ms,omitempty"`
+	Interrupted bool   `json:"interrupted,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	NotExecuted *int   `json:"not_executed,omitempty"` // tests skipped because a time budget ran out
+
+	// test
+	BudgetExceeded bool `json:"budget_exceeded,omitempty"`
+	Worker         int  `json:"worker,omitempty"` // concurrent mode only
+	Retries        int  `json:"retries,omitempty"`
+}
+
+// EventStream emits one JSON event per line as tests complete. A nil stream
+// discards all events, so callers need not check whether streaming is enabled.
+type EventStream struct {
+	mu        sync.Mutex
+	w         io.WriteCloser
+	enc       *json.Encoder
+	meta      RunMetadata
+	iteration int
+}
+
+// OpenEventStream opens an event stream to target: "-" for stdout,
+// tcp://host:port or unix:///path for a socket
+func OpenEventStream(target string, stdout io.Writer) (*EventStream, error) {
+	var w io.WriteCloser
+	switch {
+	case target == "-":
+		w = nopCloser{stdout}
+	case strings.HasPrefix(target, "tcp://"), strings.HasPrefix(target, "unix://"):
+		network, address, _ := strings.Cut(target, "://")
+		conn, err := net.DialTimeout(network, address, 10*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect event stream to %s: %w", target, err)
+		}
+		w = conn
+	default:
+		return nil, fmt.Errorf("invalid stream target: %s", target)
+	}
+
+	logger.Info("Events", "Streaming test events", "target", target)
+	return &EventStream{w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// SetIteration records the loop iteration included in subsequent events
+func (s *EventStream) SetIteration(iteration int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.iteration = iteration
+}
+
+// RunStart emits the run_start event
+func (s *EventStream) RunStart(testSuite string) {
+	if s == nil {
+		return
+	}
+	s.emit(Event{
+		Event:       "run_start",
+		ToolVersion: s.meta.ToolVersion,
+		Hostname:    s.meta.Hostname,
+		ConfigHash:  s.meta.ConfigHash,
+		TestSuite:   testSuite,
+	})
+}
+
+// SuiteStart emits the suite_start event
+func (s *EventStream) SuiteStart(suite string) {
+	s.emit(Event{Event: "suite_start", Suite: suite})
+}
+
+// Test emits the test event for a completed test
+func (s *EventStream) Test(suite string, result TestResult) {
+	event := Event{
+		Event:      "test",
+		Suite:      suite,
+		Name:       result.Name,
+		Operation:  result.Operation,
+		Status:     resultStatus(result),
+		Message:    result.Message,
+		DurationMS: result.Duration.Milliseconds(),
+
+		BudgetExceeded: result.BudgetExceeded,
+		Worker:         result.Worker,
+		Retries:        result.Retries,
+	}
+	if result.Error != nil {
+		event.Error = result.Error.Error()
+	}
+	s.emit(event)
+}
+
+// SuiteEnd emits the suite_end event with the suite's counts
+func (s *EventStream) SuiteEnd(suite string, results []TestResult) {
+	stats := &TestSuite{Results: results}
+	total, passed, failed, skipped, _ := stats.GetStats()
+	notExecuted, _ := stats.GetBudgetExceeded()
+
+	var duration time.Duration
+	for _, result := range results {
+		duration += result.Duration
+	}
+
+	s.emit(Event{
+		Event:      "suite_end",
+		Suite:      suite,
+		Total:      &total,
+		Passed:     &passed,
+		Failed:     &failed,
+		Skipped:    &skipped,
+		DurationMS: duration.Milliseconds(),
+
+		NotExecuted: &notExecuted,
+	})
+}
+
+// RunEnd emits the run_end event with the totals of the run and the error
+// that stopped it early, if any
+func (s *EventStream) RunEnd(suite *TestSuite, err error) {
+	total, passed, failed, skipped, duration := suite.GetStats()
+	notExecuted, _ := suite.GetBudgetExceeded()
+	status := "pass"
+	if err != nil || !suite.AllPassed() {
+		status = "fail"
+	}
+	event := Event{
+		Event:       "run_end",
+		Status:      status,
+		Total:       &total,
+		Passed:      &passed,
+		Failed:      &failed,
+		Skipped:     &skipped,
+		DurationMS:  duration.Milliseconds(),
+		Interrupted: suite.Interrupted,
+		Reason:      suite.InterruptReason,
+		NotExecuted: &notExecuted,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	s.emit(event)
+}
+
+// Close closes the underlying socket
+func (s *EventStream) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Close()
+}
+
+// emit writes an event; a failed write disables the stream rather than the run
+func (s *EventStream) emit(event Event) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.enc == nil {
+		return
+	}
+
+	event.Time = time.Now()
+	event.RunID = s.meta.RunID
+	event.Iteration = s.iteration
+
+	if err := s.enc.Encode(event); err != nil {
+		logger.Warn("Events", "Failed to write event, disabling event stream", "error", err)
+		s.enc = nil
+	}
+}
+
+// resultStatus returns the pass/fail/skip status of a result
+func resultStatus(result TestResult) string {
+	switch {
+	case result.Skipped:
+		return "skip"
+	case result.Passed:
+		return "pass"
+	default:
+		return "fail"
+	}
+}
+
+// nopCloser keeps Close from closing stdout
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
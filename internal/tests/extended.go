@@ -0,0 +1,256 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/config"
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// FixturePasswordModifyUser is provided when the administrator set the
+// password of the Password Modify test user
+const FixturePasswordModifyUser = "cn=pwmodify-user"
+
+// passwordModifyUser is the entry the Password Modify tests change the
+// password of, with its current password
+type passwordModifyUser struct {
+	dn       string
+	password string
+}
+
+// TestExtended runs the extended operation tests
+func TestExtended(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
+	logger.Info("ExtendedTest", "Starting extended operation tests")
+
+	user := &passwordModifyUser{dn: fmt.Sprintf("cn=pwmodify-user,%s", testBaseDN)}
+	results := h.Execute([]TestCase{
+		// Test 1: Password Modify by the administrator, for another user
+		{Name: "Password Modify - Admin Set Test", Operation: "Extended", Needs: []Capability{CapabilityPasswordModify}, Provides: FixturePasswordModifyUser, Run: func() TestResult {
+			return testPasswordModifyAdmin(conn, user, trk)
+		}},
+
+		// Test 2: Password Modify by the user, for its own password
+		{Name: "Password Modify - Self Change Test", Operation: "Extended", Requires: []string{FixturePasswordModifyUser}, Needs: []Capability{CapabilityPasswordModify}, Run: func() TestResult {
+			return testPasswordModifySelf(conn, user)
+		}},
+
+		// Test 3: The identity the server associates with the bound connection
+		{Name: "WhoAmI Test", Operation: "Extended", Needs: []Capability{CapabilityWhoAmI}, Run: func() TestResult { return testWhoAmI(conn) }},
+	})
+
+	logger.Info("ExtendedTest", "Completed extended operation tests", "total", len(results))
+	return results
+}
+
+func testPasswordModifyAdmin(conn *ldap.Connection, user *passwordModifyUser, trk *tracker.Tracker) TestResult {
+	testName := "Password Modify - Admin Set Test"
+	logger.Info("ExtendedTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Extended",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("ExtendedTest", result.Message)
+		return result
+	}
+
+	addRequest := ldaplib.NewAddRequest(user.dn, nil)
+	addRequest.Attribute("objectClass", []string{"inetOrgPerson"})
+	addRequest.Attribute("cn", []string{"pwmodify-user"})
+	addRequest.Attribute("sn", []string{"PasswordModify"})
+	if err := createEntry(conn, addRequest); err != nil {
+		return fail(err, fmt.Sprintf("Failed to create test entry: %v", err))
+	}
+	trk.Track(user.dn, tracker.TypeUser)
+
+	password, err := generatePassword()
+	if err != nil {
+		return fail(err, fmt.Sprintf("Failed to generate password: %v", err))
+	}
+
+	// The administrator needs no old password
+	logger.Trace("Extended", "Operation: Password Modify (admin)", "user", user.dn)
+	start := time.Now()
+	_, err = conn.PasswordModify(ldaplib.NewPasswordModifyRequest(user.dn, "", password))
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		logger.LogLDAPResult("Extended", "Password Modify", false, -1, err.Error(), result.Duration)
+		return fail(err, fmt.Sprintf("Password Modify failed: %v", err))
+	}
+	logger.LogLDAPResult("Extended", "Password Modify", true, 0, "Success", result.Duration)
+
+	userConn, err := bindIdentity(conn, config.ACLIdentity{Identity: user.dn, Password: password})
+	if err != nil {
+		return fail(err, fmt.Sprintf("Password set but bind with it failed: %v", err))
+	}
+	userConn.Close()
+	user.password = password
+
+	result.Passed = true
+	result.Message = "Password set by the administrator, bind with it succeeded"
+	logger.Info("ExtendedTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+func testPasswordModifySelf(conn *ldap.Connection, user *passwordModifyUser) TestResult {
+	testName := "Password Modify - Self Change Test"
+	logger.Info("ExtendedTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Extended",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("ExtendedTest", result.Message)
+		return result
+	}
+
+	password, err := generatePassword()
+	if err != nil {
+		return fail(err, fmt.Sprintf("Failed to generate password: %v", err))
+	}
+
+	userConn, err := bindIdentity(conn, config.ACLIdentity{Identity: user.dn, Password: user.password})
+	if err != nil {
+		return fail(err, fmt.Sprintf("Bind as the user failed: %v", err))
+	}
+
+	// Without a user identity the request changes the password of the bound
+	// user, who has to prove the old one
+	logger.Trace("Extended", "Operation: Password Modify (self)", "user", user.dn)
+	start := time.Now()
+	_, err = userConn.PasswordModify(ldaplib.NewPasswordModifyRequest("", user.password, password))
+	result.Duration = time.Since(start)
+	userConn.Close()
+
+	if err != nil {
+		logger.LogLDAPResult("Extended", "Password Modify", false, -1, err.Error(), result.Duration)
+		return fail(err, fmt.Sprintf("Password Modify as the user failed: %v", err))
+	}
+	logger.LogLDAPResult("Extended", "Password Modify", true, 0, "Success", result.Duration)
+
+	oldPassword := user.password
+	userConn, err = bindIdentity(conn, config.ACLIdentity{Identity: user.dn, Password: password})
+	if err != nil {
+		return fail(err, fmt.Sprintf("Password changed but bind with the new one failed: %v", err))
+	}
+	userConn.Close()
+	user.password = password
+
+	userConn, err = bindIdentity(conn, config.ACLIdentity{Identity: user.dn, Password: oldPassword})
+	if err == nil {
+		userConn.Close()
+		return fail(nil, "Password changed but the old one still binds")
+	}
+	note := rejection(err)
+	if note == "" {
+		note = fmt.Sprintf("rejected (%v)", err)
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Password changed by the user, bind with the new one succeeded, with the old one %s", note)
+	logger.Info("ExtendedTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// testWhoAmI issues the "Who am I?" extended operation (RFC 4532) on the bound
+// connection and checks the authzId against the configured identity: the bind
+// DN of a simple bind, empty for an anonymous one, and external_authz_id, if
+// set, for SASL EXTERNAL. A GSSAPI identity is only reported.
+func testWhoAmI(conn *ldap.Connection) TestResult {
+	testName := "WhoAmI Test"
+	logger.Info("ExtendedTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Extended",
+	}
+
+	logger.Trace("Extended", "Operation: WhoAmI")
+	start := time.Now()
+	whoami, err := conn.GetConnection().WhoAmI(nil)
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("WhoAmI failed: %v", err)
+		logger.LogLDAPResult("Extended", "WhoAmI", false, -1, err.Error(), result.Duration)
+		logger.Error("ExtendedTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("Extended", "WhoAmI", true, 0, "Success", result.Duration)
+
+	cfg := conn.GetConfig()
+	authzID := whoami.AuthzID
+	switch cfg.BindMethod {
+	case "external":
+		return checkExternalAuthzID(result, cfg.ExternalAuthzID, authzID)
+	case "gssapi":
+		result.Passed = authzID != ""
+		result.Message = "Kerberos principal mapped to " + authzID
+		if !result.Passed {
+			result.Message = "GSSAPI bind succeeded, but the server reports an anonymous identity for the connection"
+		}
+	case "simple":
+		result.Passed, result.Message = checkBindDNAuthzID(cfg.BindDN, authzID)
+	}
+
+	if !result.Passed {
+		logger.Error("ExtendedTest", result.Message)
+		return result
+	}
+	logger.Info("ExtendedTest", "PASS: "+testName, "authzId", authzID, "duration", result.Duration)
+	return result
+}
+
+// checkBindDNAuthzID compares the authzId of a simple bind with the bind DN.
+// A server may report a user name instead of a DN (u:DOMAIN\user on Active
+// Directory), which cannot be compared and passes as reported.
+func checkBindDNAuthzID(bindDN, authzID string) (bool, string) {
+	if bindDN == "" {
+		if authzID != "" {
+			return false, fmt.Sprintf("Anonymous bind, but the server reports %s", authzID)
+		}
+		return true, "Anonymous identity, as bound"
+	}
+
+	dn, ok := strings.CutPrefix(authzID, "dn:")
+	if !ok {
+		if authzID == "" {
+			return false, fmt.Sprintf("Bound as %s, but the server reports an anonymous identity", bindDN)
+		}
+		return true, fmt.Sprintf("Bound as %s, server reports %s", bindDN, authzID)
+	}
+	if !sameDN(dn, bindDN) {
+		return false, fmt.Sprintf("Bound as %s, but the server reports %s", bindDN, authzID)
+	}
+	return true, "Server reports " + authzID + ", the bind DN"
+}
+
+// sameDN reports whether two DNs are equal, ignoring case and spacing, or
+// equal as strings if either does not parse
+func sameDN(a, b string) bool {
+	aDN, aErr := ldaplib.ParseDN(a)
+	bDN, bErr := ldaplib.ParseDN(b)
+	if aErr != nil || bErr != nil {
+		return strings.EqualFold(a, b)
+	}
+	return aDN.EqualFold(bDN)
+}
@@ -0,0 +1,34 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// Filters are built from these instead of by formatting values into filter
+// strings: the values are escaped as RFC 4515 requires, so a *, (, ), \ or
+// NUL in one is matched literally rather than changing the filter
+
+// eqFilter is the equality filter (attribute=value)
+func eqFilter(attribute, value string) string {
+	return fmt.Sprintf("(%s=%s)", attribute, ldaplib.EscapeFilter(value))
+}
+
+// substringFilter is the substring filter of attribute with a wildcard between
+// each of parts: substringFilter("cn", "", "smith", "") is (cn=*smith*) and
+// substringFilter("cn", "J", "") is (cn=J*). At least two parts are needed,
+// an empty first or last one leaving that end open.
+func substringFilter(attribute string, parts ...string) string {
+	escaped := make([]string, len(parts))
+	for i, part := range parts {
+		escaped[i] = ldaplib.EscapeFilter(part)
+	}
+	return fmt.Sprintf("(%s=%s)", attribute, strings.Join(escaped, "*"))
+}
+
+// andFilter is the conjunction of filters, each a complete filter
+func andFilter(filters ...string) string {
+	return "(&" + strings.Join(filters, "") + ")"
+}
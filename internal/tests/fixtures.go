@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"fmt"
+	"time"
+
+	"ldap-automated-actions/internal/config"
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// fixtureEntry is the entry a shared fixture stands for
+type fixtureEntry struct {
+	fixture   string
+	entry     func(cfg *config.Config, testBaseDN string) (string, map[string][]string, error)
+	entryType tracker.EntryType
+	needs     []string // fixtures the entry refers to
+}
+
+// fixtureEntries are the shared fixtures of the add suite a suite can create
+// for itself, in the order they are created
+var fixtureEntries = []fixtureEntry{
+	{fixture: FixtureTestUser, entry: testUserEntry, entryType: tracker.TypeUser},
+	{fixture: FixtureTestGroup, entry: testGroupEntry, entryType: tracker.TypeGroup, needs: []string{FixtureTestUser}},
+}
+
+// createdFixture is a fixture entry setupFixtures created
+type createdFixture struct {
+	fixture string
+	dn      string
+}
+
+// setupFixtures creates the fixture entries the cases of a suite require that
+// no earlier suite of the run created, so the suite can run on its own (e.g.
+// with --test-suite modify). A fixture an earlier suite failed to create is
+// left alone, so its tests are still skipped with that reason, and cases the
+// filters leave out need no fixtures. In read-only mode nothing is created and
+// the tests needing the fixtures are skipped. The returned function deletes the
+// entries created here once the suite is done.
+func setupFixtures(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness, suite string, cases []TestCase) func() {
+	if h.ctx.Err() != nil {
+		return func() {}
+	}
+
+	needed := make(map[string]bool)
+	for _, tc := range cases {
+		if h.filtered(tc.Name) {
+			continue
+		}
+		for _, fixture := range tc.Requires {
+			needed[fixture] = true
+		}
+	}
+	// Walk backwards so the fixtures an entry refers to are needed too
+	for i := len(fixtureEntries) - 1; i >= 0; i-- {
+		if f := fixtureEntries[i]; needed[f.fixture] {
+			for _, fixture := range f.needs {
+				needed[fixture] = true
+			}
+		}
+	}
+
+	var created []createdFixture
+	for _, f := range fixtureEntries {
+		fixture := f.fixture
+		if !needed[fixture] || h.Known(fixture) {
+			continue
+		}
+		if conn.GetConfig().ReadOnly {
+			h.Fail(fixture, "not created in read-only mode")
+			continue
+		}
+		dn, attributes, err := f.entry(conn.GetConfig(), testBaseDN)
+		if err != nil {
+			logger.Warn("Setup", "Failed to apply the entry template of the fixture", "suite", suite, "fixture", fixture, "error", err)
+			h.Fail(fixture, fmt.Sprintf("setup of the %s suite failed to build it: %v", suite, err))
+			continue
+		}
+		logger.Info("Setup", "Creating fixture for the suite, as no earlier test created it", "suite", suite, "fixture", fixture, "dn", dn)
+
+		addRequest := ldaplib.NewAddRequest(dn, nil)
+		for attr, values := range attributes {
+			addRequest.Attribute(attr, values)
+		}
+
+		start := time.Now()
+		err = createEntry(conn, addRequest)
+		duration := time.Since(start)
+		if err != nil {
+			logger.LogLDAPResult("Setup", "Add", false, -1, err.Error(), duration)
+			logger.Warn("Setup", "Failed to create fixture", "suite", suite, "fixture", fixture, "error", err)
+			h.Fail(fixture, fmt.Sprintf("setup of the %s suite failed to create it: %v", suite, err))
+			continue
+		}
+		logger.LogLDAPResult("Setup", "Add", true, 0, "Success", duration)
+		trk.Track(dn, f.entryType)
+		h.Provide(fixture)
+		created = append(created, createdFixture{fixture: fixture, dn: dn})
+	}
+
+	return func() { teardownFixtures(conn, trk, h, suite, created) }
+}
+
+// teardownFixtures deletes the fixture entries created by setupFixtures, the
+// last created first. An entry that cannot be deleted stays tracked, so
+// cleanup still removes it.
+func teardownFixtures(conn *ldap.Connection, trk *tracker.Tracker, h *Harness, suite string, created []createdFixture) {
+	for i := len(created) - 1; i >= 0; i-- {
+		f := created[i]
+		logger.Debug("Setup", "Deleting fixture of the suite", "suite", suite, "fixture", f.fixture, "dn", f.dn)
+		h.Fail(f.fixture, fmt.Sprintf("deleted after the %s suite", suite))
+
+		start := time.Now()
+		err := conn.Del(ldaplib.NewDelRequest(f.dn, nil))
+		duration := time.Since(start)
+		if err != nil && !ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultNoSuchObject) {
+			logger.LogLDAPResult("Setup", "Delete", false, -1, err.Error(), duration)
+			logger.Warn("Setup", "Failed to delete fixture, leaving it to cleanup", "suite", suite, "dn", f.dn, "error", err)
+			continue
+		}
+		logger.LogLDAPResult("Setup", "Delete", true, 0, "Success", duration)
+		trk.Remove(f.dn)
+	}
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// maxFlakyErrors is the number of distinct errors listed per intermittent test
+const maxFlakyErrors = 5
+
+// flakyKey identifies a test across loop iterations
+type flakyKey struct {
+	operation string
+	name      string
+}
+
+// testOutcomes counts how often a test passed and failed across iterations,
+// with the errors of its failures
+type testOutcomes struct {
+	flakyKey
+	passed int
+	failed int
+	errors map[string]int // failures by error text
+}
+
+// runs returns the number of iterations that executed the test
+func (t *testOutcomes) runs() int {
+	return t.passed + t.failed
+}
+
+// flakyTracker follows each test across the iterations of loop mode, so a
+// test that fails now and then stands out instead of being averaged into the
+// overall pass rate
+type flakyTracker struct {
+	tests map[flakyKey]*testOutcomes
+	order []flakyKey // first seen first, to break ties in a stable way
+}
+
+func newFlakyTracker() *flakyTracker {
+	return &flakyTracker{tests: make(map[flakyKey]*testOutcomes)}
+}
+
+// add records the results of an iteration; skipped tests do not count
+func (f *flakyTracker) add(results []TestResult) {
+	for _, result := range results {
+		if result.Skipped {
+			continue
+		}
+		key := flakyKey{operation: result.Operation, name: result.Name}
+		outcomes := f.tests[key]
+		if outcomes == nil {
+			outcomes = &testOutcomes{flakyKey: key, errors: make(map[string]int)}
+			f.tests[key] = outcomes
+			f.order = append(f.order, key)
+		}
+		if result.Passed {
+			outcomes.passed++
+			continue
+		}
+		outcomes.failed++
+		outcomes.errors[failureText(result)]++
+	}
+}
+
+// flaky returns the tests that both passed and failed, the least reliable first
+func (f *flakyTracker) flaky() []*testOutcomes {
+	var flaky []*testOutcomes
+	for _, key := range f.order {
+		if outcomes := f.tests[key]; outcomes.passed > 0 && outcomes.failed > 0 {
+			flaky = append(flaky, outcomes)
+		}
+	}
+	sort.SliceStable(flaky, func(i, j int) bool {
+		// Compare failure rates without dividing: failed_i/runs_i > failed_j/runs_j
+		return flaky[i].failed*flaky[j].runs() > flaky[j].failed*flaky[i].runs()
+	})
+	return flaky
+}
+
+// write prints the intermittent tests with the distribution of their errors
+func (f *flakyTracker) write(w io.Writer) {
+	flaky := f.flaky()
+	if len(flaky) == 0 {
+		fmt.Fprintln(w, "Intermittent Tests:   none")
+		return
+	}
+
+	fmt.Fprintf(w, "Intermittent Tests:   %d\n", len(flaky))
+	for _, test := range flaky {
+		fmt.Fprintf(w, "  %s / %s: passed %d/%d (%.1f%%)\n", test.operation, test.name,
+			test.passed, test.runs(), float64(test.passed)/float64(test.runs())*100)
+		for _, e := range topErrors(test.errors, maxFlakyErrors) {
+			fmt.Fprintf(w, "      %3d× %s\n", e.count, e.text)
+		}
+		if len(test.errors) > maxFlakyErrors {
+			fmt.Fprintf(w, "      ... %d more distinct errors\n", len(test.errors)-maxFlakyErrors)
+		}
+	}
+}
+
+// errorCount is an error text with the number of failures it caused
+type errorCount struct {
+	text  string
+	count int
+}
+
+// topErrors returns up to n errors, the most frequent first
+func topErrors(errors map[string]int, n int) []errorCount {
+	counts := make([]errorCount, 0, len(errors))
+	for text, count := range errors {
+		counts = append(counts, errorCount{text, count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+		return counts[i].text < counts[j].text
+	})
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// failureText is the error of a failed test on one line, or its message if
+// it failed without one
+func failureText(result TestResult) string {
+	text := result.Message
+	if result.Error != nil {
+		text = result.Error.Error()
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return "(no error)"
+	}
+	const maxLen = 120
+	if runes := []rune(text); len(runes) > maxLen {
+		text = string(runes[:maxLen-3]) + "..."
+	}
+	return text
+}
@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// fuzzTimeout bounds how long the server may take to answer a fuzz request
+const fuzzTimeout = 10 * time.Second
+
+// fuzzCase is a search request with a malformed or adversarial filter or base DN
+type fuzzCase struct {
+	name   string
+	baseDN string
+	filter *ber.Packet
+}
+
+// TestFuzz runs the filter and DN fuzz corpus. Every request is well-formed
+// BER, so the server is expected to answer each one with a result (usually
+// protocolError or invalidDNSyntax) rather than time out or disconnect.
+func TestFuzz(conn *ldap.Connection, baseDN string, h *Harness) []TestResult {
+	logger.Info("FuzzTest", "Starting filter and DN fuzz tests")
+
+	corpus := fuzzCorpus(baseDN)
+	cases := make([]TestCase, 0, len(corpus))
+	for _, fc := range corpus {
+		fc := fc
+		cases = append(cases, TestCase{Name: "Fuzz: " + fc.name, Operation: "Fuzz", Run: func() TestResult { return testFuzzCase(conn, fc) }})
+	}
+
+	results := h.Execute(cases)
+
+	failed := 0
+	for _, result := range results {
+		if !result.Passed && !result.Skipped {
+			failed++
+		}
+	}
+	if failed > 0 {
+		logger.Warn("FuzzTest", "Server timed out or disconnected on fuzz requests", "count", failed)
+	}
+
+	logger.Info("FuzzTest", "Completed filter and DN fuzz tests", "total", len(results))
+	return results
+}
+
+// fuzzCorpus returns the malformed and adversarial search requests
+func fuzzCorpus(baseDN string) []fuzzCase {
+	present := presentFilter("objectClass")
+	invalidUTF8 := "\xff\xfe\xc3\x28\xed\xa0\x80"
+
+	nested := presentFilter("objectClass")
+	for i := 0; i < 512; i++ {
+		not := ber.Encode(ber.ClassContext, ber.TypeConstructed, ldaplib.FilterNot, nil, "Not")
+		not.AppendChild(nested)
+		nested = not
+	}
+
+	missingValue := ber.Encode(ber.ClassContext, ber.TypeConstructed, ldaplib.FilterEqualityMatch, nil, "Equality Match")
+	missingValue.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "cn", "Attribute"))
+
+	noSubstrings := ber.Encode(ber.ClassContext, ber.TypeConstructed, ldaplib.FilterSubstrings, nil, "Substrings")
+	noSubstrings.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "cn", "Attribute"))
+	noSubstrings.AppendChild(ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Substrings"))
+
+	extensible := ber.Encode(ber.ClassContext, ber.TypeConstructed, ldaplib.FilterExtensibleMatch, nil, "Extensible Match")
+	extensible.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 3, "test", "Match Value"))
+
+	return []fuzzCase{
+		// Filters
+		{name: "Unbalanced Parentheses in Attribute", baseDN: baseDN, filter: presentFilter("(cn=test")},
+		{name: "Unbalanced Parentheses in Assertion", baseDN: baseDN, filter: equalityFilter("cn", "test))(|(cn=*")},
+		{name: "Empty Attribute Description", baseDN: baseDN, filter: equalityFilter("", "test")},
+		{name: "Missing Assertion Value", baseDN: baseDN, filter: missingValue},
+		{name: "Substrings Without Components", baseDN: baseDN, filter: noSubstrings},
+		{name: "Extensible Match Without Rule or Type", baseDN: baseDN, filter: extensible},
+		{name: "Unknown Filter Choice", baseDN: baseDN, filter: ber.NewString(ber.ClassContext, ber.TypePrimitive, 15, "objectClass", "Unknown Filter")},
+		{name: "Primitive AND", baseDN: baseDN, filter: ber.NewString(ber.ClassContext, ber.TypePrimitive, ldaplib.FilterAnd, "garbage", "And")},
+		{name: "Deeply Nested NOT", baseDN: baseDN, filter: nested},
+		{name: "Oversized Assertion Value", baseDN: baseDN, filter: equalityFilter("cn", strings.Repeat("A", 1<<20))},
+		{name: "Oversized Attribute Description", baseDN: baseDN, filter: presentFilter(strings.Repeat("a", 1<<16))},
+		{name: "Invalid UTF-8 in Assertion Value", baseDN: baseDN, filter: equalityFilter("cn", invalidUTF8)},
+		{name: "Invalid UTF-8 in Attribute Description", baseDN: baseDN, filter: presentFilter("cn" + invalidUTF8)},
+		{name: "NUL Byte in Assertion Value", baseDN: baseDN, filter: equalityFilter("cn", "test\x00*")},
+
+		// DNs
+		{name: "Base DN Missing Attribute Value", baseDN: "cn=," + baseDN, filter: present},
+		{name: "Base DN Missing Attribute Type", baseDN: "=test," + baseDN, filter: present},
+		{name: "Base DN With Empty RDN", baseDN: "cn=test,," + baseDN, filter: present},
+		{name: "Base DN With Dangling Escape", baseDN: "cn=test\\," + baseDN, filter: present},
+		{name: "Base DN With Unbalanced Quote", baseDN: "cn=\"test," + baseDN, filter: present},
+		{name: "Oversized Base DN", baseDN: "cn=" + strings.Repeat("A", 1<<16) + "," + baseDN, filter: present},
+		{name: "Invalid UTF-8 in Base DN", baseDN: "cn=" + invalidUTF8 + "," + baseDN, filter: present},
+	}
+}
+
+func presentFilter(attribute string) *ber.Packet {
+	return ber.NewString(ber.ClassContext, ber.TypePrimitive, ldaplib.FilterPresent, attribute, "Present")
+}
+
+func equalityFilter(attribute, value string) *ber.Packet {
+	filter := ber.Encode(ber.ClassContext, ber.TypeConstructed, ldaplib.FilterEqualityMatch, nil, "Equality Match")
+	filter.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attribute, "Attribute"))
+	filter.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Condition"))
+	return filter
+}
+
+func testFuzzCase(conn *ldap.Connection, fc fuzzCase) TestResult {
+	testName := "Fuzz: " + fc.name
+	logger.Info("FuzzTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Fuzz",
+	}
+
+	raw, err := conn.OpenRaw()
+	if skipRawUnsupported(&result, "FuzzTest", err) {
+		return result
+	}
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to open raw connection: %v", err)
+		logger.Error("FuzzTest", result.Message)
+		return result
+	}
+	defer raw.Close()
+
+	start := time.Now()
+	id, err := raw.SendSearchFilter(fc.baseDN, ldaplib.ScopeBaseObject, fc.filter, []string{"1.1"})
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Connection dropped while sending the request: %v%s", err, serverStatus(conn))
+		logger.Error("FuzzTest", result.Message)
+		return result
+	}
+
+	for {
+		msg, err := raw.Read(fuzzTimeout)
+		result.Duration = time.Since(start)
+
+		if err != nil {
+			result.Passed = false
+			result.Error = err
+			switch {
+			case ldap.IsTimeout(err):
+				result.Message = fmt.Sprintf("Server did not answer within %s%s", fuzzTimeout, serverStatus(conn))
+			case isDisconnect(err):
+				result.Message = "Server disconnected instead of returning an error" + serverStatus(conn)
+			default:
+				result.Message = fmt.Sprintf("Unexpected read error: %v", err)
+			}
+			logger.Error("FuzzTest", result.Message)
+			return result
+		}
+
+		if msg.IsUnsolicited() {
+			logger.Warn("FuzzTest", "Received unsolicited notification", "oid", msg.OID, "code", msg.Code)
+			continue
+		}
+		if msg.ID != id || !msg.IsResult() {
+			continue
+		}
+
+		logger.LogLDAPResult("Fuzz", "Search", msg.Code == ldaplib.LDAPResultSuccess, int(msg.Code), ldaplib.LDAPResultCodeMap[msg.Code], result.Duration)
+		result.Passed = true
+		result.Message = fmt.Sprintf("Server answered with %s (%d)", ldaplib.LDAPResultCodeMap[msg.Code], msg.Code)
+		logger.Info("FuzzTest", "PASS: "+testName, "duration", result.Duration, "code", msg.Code)
+		return result
+	}
+}
+
+// serverStatus checks on a new connection whether the server still answers
+// after a fuzz request, to tell a dropped session from a crashed server
+func serverStatus(conn *ldap.Connection) string {
+	raw, err := conn.OpenRaw()
+	if err == nil {
+		err = raw.Ping()
+		raw.Close()
+	}
+	if err != nil {
+		logger.Error("FuzzTest", "Server is unreachable after fuzz request, possible crash", "error", err)
+		return fmt.Sprintf("; server is unreachable afterwards, possible crash (%v)", err)
+	}
+	return "; server still answers new connections"
+}
@@ -0,0 +1,304 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ldap-automated-actions/internal/config"
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// generateBatchSize is the number of users a generator worker takes at once
+const generateBatchSize = 100
+
+// generateSeed seeds the generator, so a count always generates the same
+// entries and runs against them can be compared
+const generateSeed = 1
+
+// generateUsersPerProject is how many users there are per project group
+const generateUsersPerProject = 25
+
+var (
+	generateFirstNames  = []string{"Anna", "Ben", "Carla", "David", "Elena", "Farid", "Grace", "Hiro", "Ines", "Jonas", "Kara", "Liam", "Maya", "Noah", "Olga", "Pablo", "Quinn", "Rosa", "Samir", "Tara", "Umar", "Vera", "Wei", "Ximena", "Yusuf", "Zoe"}
+	generateLastNames   = []string{"Anderson", "Becker", "Costa", "Dubois", "Evans", "Fischer", "Garcia", "Hansen", "Ito", "Jensen", "Kowalski", "Larsen", "Morales", "Nakamura", "Olsen", "Patel", "Rossi", "Schmidt", "Tanaka", "Usman", "Varga", "Weber", "Young", "Zhang"}
+	generateDepartments = []string{"Engineering", "Sales", "Marketing", "Finance", "Human Resources", "Support", "Operations", "Legal"}
+	generateTitles      = []string{"Engineer", "Senior Engineer", "Manager", "Analyst", "Specialist", "Director", "Coordinator", "Consultant"}
+	generateProjects    = []string{"apollo", "borealis", "cascade", "delta", "emerald", "falcon", "granite", "horizon"}
+)
+
+// syntheticData is the generated directory: the OUs, parents first, the users
+// and the groups they are members of
+type syntheticData struct {
+	ous    []*ldaplib.AddRequest
+	users  []*ldaplib.AddRequest
+	groups []*ldaplib.AddRequest
+}
+
+// newSyntheticData generates n users in department OUs below generatedDN, a
+// group per department and project groups that about half of the users join.
+// The users and groups are shaped by the user and group entry templates.
+func newSyntheticData(cfg *config.Config, generatedDN string, n int) (*syntheticData, error) {
+	rng := rand.New(rand.NewSource(generateSeed))
+	domain := mailDomain(generatedDN)
+	groupsDN := "ou=groups," + generatedDN
+	data := &syntheticData{}
+
+	addOU := func(dn, name string) {
+		request := ldaplib.NewAddRequest(dn, nil)
+		request.Attribute("objectClass", []string{"organizationalUnit"})
+		request.Attribute("ou", []string{name})
+		data.ous = append(data.ous, request)
+	}
+	addGroup := func(cn, description string, members []string) error {
+		attributes, err := cfg.EntryTemplate("group").Apply(map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"cn":          {cn},
+			"description": {description},
+			"member":      members,
+		}, "cn", config.EntryTemplateData{CN: cn, Domain: domain, Index: len(data.groups) + 1}, rng)
+		if err != nil {
+			return err
+		}
+		data.groups = append(data.groups, generatedRequest(fmt.Sprintf("cn=%s,%s", cn, groupsDN), attributes))
+		return nil
+	}
+
+	projects := max(1, n/generateUsersPerProject)
+	departmentMembers := make(map[string][]string)
+	projectMembers := make([][]string, projects)
+	for i := 1; i <= n; i++ {
+		first := generateFirstNames[rng.Intn(len(generateFirstNames))]
+		last := generateLastNames[rng.Intn(len(generateLastNames))]
+		department := generateDepartments[rng.Intn(len(generateDepartments))]
+		uid := fmt.Sprintf("%s.%s.%d", strings.ToLower(first), strings.ToLower(last), i)
+		dn := fmt.Sprintf("uid=%s,ou=%s,%s", uid, department, generatedDN)
+
+		mail := uid + "@" + domain
+		attributes, err := cfg.EntryTemplate("user").Apply(map[string][]string{
+			"objectClass":     {"top", "person", "organizationalPerson", "inetOrgPerson"},
+			"uid":             {uid},
+			"cn":              {first + " " + last},
+			"givenName":       {first},
+			"sn":              {last},
+			"mail":            {mail},
+			"telephoneNumber": {fmt.Sprintf("+1 555 %03d %04d", rng.Intn(1000), rng.Intn(10000))},
+			"title":           {generateTitles[rng.Intn(len(generateTitles))]},
+			"ou":              {department},
+			"employeeNumber":  {strconv.Itoa(i)},
+		}, "uid", config.EntryTemplateData{
+			CN:         first + " " + last,
+			UID:        uid,
+			GivenName:  first,
+			Surname:    last,
+			Mail:       mail,
+			Domain:     domain,
+			Department: department,
+			Index:      i,
+		}, rng)
+		if err != nil {
+			return nil, err
+		}
+		data.users = append(data.users, generatedRequest(dn, attributes))
+
+		departmentMembers[department] = append(departmentMembers[department], dn)
+		if rng.Intn(2) == 0 {
+			project := rng.Intn(projects)
+			projectMembers[project] = append(projectMembers[project], dn)
+		}
+	}
+
+	addOU(generatedDN, "generated")
+	addOU(groupsDN, "groups")
+	for _, department := range generateDepartments {
+		members := departmentMembers[department]
+		if len(members) == 0 {
+			continue
+		}
+		addOU(fmt.Sprintf("ou=%s,%s", department, generatedDN), department)
+		if err := addGroup(strings.ToLower(strings.ReplaceAll(department, " ", "-"))+"-staff", "All staff of "+department, members); err != nil {
+			return nil, err
+		}
+	}
+	for i, members := range projectMembers {
+		// A groupOfNames needs a member
+		if len(members) == 0 {
+			members = []string{data.users[i%n].DN}
+		}
+		name := generateProjects[i%len(generateProjects)]
+		if i >= len(generateProjects) {
+			name = fmt.Sprintf("%s-%d", name, i/len(generateProjects)+1)
+		}
+		if err := addGroup("project-"+name, "Members of project "+name, members); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// generatedRequest returns the add request of a generated entry, with its
+// attributes in name order so the same data always makes the same requests
+func generatedRequest(dn string, attributes map[string][]string) *ldaplib.AddRequest {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	request := ldaplib.NewAddRequest(dn, nil)
+	for _, name := range names {
+		request.Attribute(name, attributes[name])
+	}
+	return request
+}
+
+// mailDomain returns the domain of the dc components of dn, example.com if
+// it has none
+func mailDomain(dn string) string {
+	parsed, err := ldaplib.ParseDN(dn)
+	if err != nil {
+		return "example.com"
+	}
+	var labels []string
+	for _, rdn := range parsed.RDNs {
+		for _, attr := range rdn.Attributes {
+			if strings.EqualFold(attr.Type, "dc") {
+				labels = append(labels, strings.ToLower(attr.Value))
+			}
+		}
+	}
+	if len(labels) == 0 {
+		return "example.com"
+	}
+	return strings.Join(labels, ".")
+}
+
+// GenerateData adds n synthetic users, with their department OUs and groups,
+// to ou=generated below the test OU, so the tests search through a realistic
+// volume of data. The OUs and groups are added on conn; the users are added in
+// batches by workers, each on a connection of its own opened with open. Every
+// entry is tracked for cleanup. Data left by an earlier run in a re-used or
+// resumed test OU is kept as it is.
+func GenerateData(ctx context.Context, conn *ldap.Connection, open func() (*ldap.Connection, error), testBaseDN string, trk *tracker.Tracker, n, workers int) TestResult {
+	testName := "Generate Synthetic Data"
+	generatedDN := "ou=generated," + testBaseDN
+	logger.Info("Generate", "Running: "+testName, "dn", generatedDN, "users", n, "workers", workers)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Generate",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("Generate", result.Message)
+		return result
+	}
+
+	if _, err := readEntry(conn, generatedDN); err == nil {
+		result.Passed = true
+		result.Message = fmt.Sprintf("Synthetic data already present under %s, not generated again", generatedDN)
+		logger.Info("Generate", "PASS: "+testName, "reason", "already generated")
+		return result
+	}
+
+	data, err := newSyntheticData(conn.GetConfig(), generatedDN, n)
+	if err != nil {
+		return fail(err, fmt.Sprintf("Failed to apply the entry templates: %v", err))
+	}
+	start := time.Now()
+	for _, request := range data.ous {
+		if err := createEntry(conn, request); err != nil {
+			result.Duration = time.Since(start)
+			return fail(err, fmt.Sprintf("Failed to create OU %s: %v", request.DN, err))
+		}
+		trk.Track(request.DN, tracker.TypeOU)
+	}
+
+	if err := addGeneratedUsers(ctx, open, data.users, trk, workers); err != nil {
+		result.Duration = time.Since(start)
+		return fail(err, fmt.Sprintf("Failed to generate users: %v", err))
+	}
+
+	for _, request := range data.groups {
+		if ctx.Err() != nil {
+			result.Duration = time.Since(start)
+			return fail(ctx.Err(), "Generation interrupted before the groups were added")
+		}
+		if err := createEntry(conn, request); err != nil {
+			result.Duration = time.Since(start)
+			return fail(err, fmt.Sprintf("Failed to create group %s: %v", request.DN, err))
+		}
+		trk.Track(request.DN, tracker.TypeGroup)
+	}
+	result.Duration = time.Since(start)
+
+	total := len(data.ous) + len(data.users) + len(data.groups)
+	rate := float64(total) / result.Duration.Seconds()
+	result.Passed = true
+	result.Message = fmt.Sprintf("Generated %d users, %d groups and %d OUs under %s in %s (%.1f entries/s)", len(data.users), len(data.groups), len(data.ous), generatedDN, result.Duration.Round(time.Millisecond), rate)
+	logger.Info("Generate", "PASS: "+testName, "duration", result.Duration, "rate", fmt.Sprintf("%.1f", rate))
+	return result
+}
+
+// addGeneratedUsers adds users in batches of generateBatchSize, on workers
+// connections at once. The first failure stops every worker.
+func addGeneratedUsers(ctx context.Context, open func() (*ldap.Connection, error), users []*ldaplib.AddRequest, trk *tracker.Tracker, workers int) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	batches := make(chan []*ldaplib.AddRequest)
+	go func() {
+		defer close(batches)
+		for i := 0; i < len(users); i += generateBatchSize {
+			select {
+			case batches <- users[i:min(i+generateBatchSize, len(users))]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var added atomic.Int64
+	var wg sync.WaitGroup
+	for id := 1; id <= min(workers, (len(users)+generateBatchSize-1)/generateBatchSize); id++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			c, err := open()
+			if err != nil {
+				cancel(fmt.Errorf("failed to open generator connection %d: %w", id, err))
+				return
+			}
+			defer c.Close()
+
+			for batch := range batches {
+				for _, request := range batch {
+					if ctx.Err() != nil {
+						return
+					}
+					if err := createEntry(c, request); err != nil {
+						cancel(fmt.Errorf("failed to create %s: %w", request.DN, err))
+						return
+					}
+					trk.Track(request.DN, tracker.TypeUser)
+				}
+				logger.Debug("Generate", "Added a batch of users", "worker", id, "added", added.Add(int64(len(batch))), "total", len(users))
+			}
+		}(id)
+	}
+	wg.Wait()
+	return context.Cause(ctx)
+}
@@ -0,0 +1,465 @@
+package tests
+
+import (
+	"fmt"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// TestGroup runs all group membership tests
+func TestGroup(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
+	logger.Info("GroupTest", "Starting group membership tests")
+
+	cases := []TestCase{
+		// Test 1: Add a member to the test group
+		{Name: "Group - Add Member Test", Operation: "Group", Requires: []string{FixtureTestGroup}, Provides: FixtureGroupMember, Run: func() TestResult { return testGroupAddMember(conn, testBaseDN, trk) }},
+
+		// Test 2: memberOf back-link of the new member (if maintained)
+		{Name: "Group - memberOf Back-Link Test", Operation: "Group", Requires: []string{FixtureGroupMember}, Run: func() TestResult { return testGroupMemberOf(conn, testBaseDN) }},
+
+		// Test 3: Remove the member again
+		{Name: "Group - Remove Member Test", Operation: "Group", Requires: []string{FixtureGroupMember}, Run: func() TestResult { return testGroupRemoveMember(conn, testBaseDN) }},
+
+		// Test 4: Add and remove uniqueMember values of a groupOfUniqueNames
+		{Name: "Group - uniqueMember Test", Operation: "Group", Run: func() TestResult { return testGroupUniqueMember(conn, testBaseDN, trk) }},
+
+		// Test 5: Delete a member entry and report what happens to the reference
+		{Name: "Group - Member Deletion Referential Integrity Test", Operation: "Group", Requires: []string{FixtureTestGroup}, Run: func() TestResult { return testGroupMemberDeletion(conn, testBaseDN, trk) }},
+
+		// Test 6: Referential integrity policy (if require_referential_integrity is set)
+		{Name: "Group - Referential Integrity Enforcement Test", Operation: "Group", Requires: []string{FixtureTestGroup}, Run: func() TestResult { return testGroupRefintEnforced(conn, testBaseDN, trk) }},
+	}
+
+	// Create the fixtures of the add suite if it did not run
+	teardown := setupFixtures(conn, testBaseDN, trk, h, "group", cases)
+	defer teardown()
+	results := h.Execute(cases)
+
+	logger.Info("GroupTest", "Completed group membership tests", "total", len(results))
+	return results
+}
+
+func testGroupAddMember(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) TestResult {
+	testName := "Group - Add Member Test"
+	logger.Info("GroupTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Group",
+	}
+
+	groupDN := fmt.Sprintf("cn=testgroup,%s", testBaseDN)
+	userDN := fmt.Sprintf("cn=group-member-user,%s", testBaseDN)
+	if err := createGroupTestUser(conn, userDN, trk); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = "Failed to create test entry"
+		logger.Error("GroupTest", "Failed to create member entry", "error", err)
+		return result
+	}
+
+	modifyRequest := ldaplib.NewModifyRequest(groupDN, nil)
+	modifyRequest.Add("member", []string{userDN})
+
+	logger.Trace("Group", "Operation: Modify (Add member)", "dn", groupDN, "member", userDN)
+	start := time.Now()
+	err := conn.Modify(modifyRequest)
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to add member: %v", err)
+		logger.LogLDAPResult("Group", "Modify (Add member)", false, -1, err.Error(), result.Duration)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("Group", "Modify (Add member)", true, 0, "Success", result.Duration)
+
+	if err := verifyGroupMember(conn, groupDN, "member", userDN, true); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Modify returned success but read-back failed: %v", err)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Added %s to %s (verified by read-back)", userDN, groupDN)
+	logger.Info("GroupTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+func testGroupMemberOf(conn *ldap.Connection, testBaseDN string) TestResult {
+	testName := "Group - memberOf Back-Link Test"
+	logger.Info("GroupTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Group",
+	}
+
+	groupDN := fmt.Sprintf("cn=testgroup,%s", testBaseDN)
+	userDN := fmt.Sprintf("cn=group-member-user,%s", testBaseDN)
+
+	memberOf := memberOfAttribute(conn.Vendor())
+	start := time.Now()
+	user, err := readAttributes(conn, userDN, memberOf)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to read %s: %v", memberOf, err)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+
+	if len(user.GetEqualFoldAttributeValues(memberOf)) == 0 {
+		logger.Warn("GroupTest", "SKIP: "+testName, "reason", memberOf+" not maintained")
+		result.Skipped = true
+		result.Message = fmt.Sprintf("Skipped: server does not maintain %s (no memberOf overlay or plugin)", memberOf)
+		return result
+	}
+	if !hasDNValue(user, memberOf, groupDN) {
+		result.Passed = false
+		result.Message = fmt.Sprintf("%s of %s does not list %s", memberOf, userDN, groupDN)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("%s of %s lists %s", memberOf, userDN, groupDN)
+	logger.Info("GroupTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+func testGroupRemoveMember(conn *ldap.Connection, testBaseDN string) TestResult {
+	testName := "Group - Remove Member Test"
+	logger.Info("GroupTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Group",
+	}
+
+	groupDN := fmt.Sprintf("cn=testgroup,%s", testBaseDN)
+	userDN := fmt.Sprintf("cn=group-member-user,%s", testBaseDN)
+
+	modifyRequest := ldaplib.NewModifyRequest(groupDN, nil)
+	modifyRequest.Delete("member", []string{userDN})
+
+	logger.Trace("Group", "Operation: Modify (Remove member)", "dn", groupDN, "member", userDN)
+	start := time.Now()
+	err := conn.Modify(modifyRequest)
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to remove member: %v", err)
+		logger.LogLDAPResult("Group", "Modify (Remove member)", false, -1, err.Error(), result.Duration)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("Group", "Modify (Remove member)", true, 0, "Success", result.Duration)
+
+	if err := verifyGroupMember(conn, groupDN, "member", userDN, false); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Modify returned success but read-back failed: %v", err)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+
+	// A maintained back-link must follow the removal
+	memberOf := memberOfAttribute(conn.Vendor())
+	user, err := readAttributes(conn, userDN, memberOf)
+	if err == nil && hasDNValue(user, memberOf, groupDN) {
+		result.Passed = false
+		result.Message = fmt.Sprintf("Member removed, but %s of %s still lists %s", memberOf, userDN, groupDN)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Removed %s from %s (verified by read-back)", userDN, groupDN)
+	logger.Info("GroupTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+func testGroupUniqueMember(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) TestResult {
+	testName := "Group - uniqueMember Test"
+	logger.Info("GroupTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Group",
+	}
+
+	firstDN := fmt.Sprintf("cn=unique-member-a,%s", testBaseDN)
+	secondDN := fmt.Sprintf("cn=unique-member-b,%s", testBaseDN)
+	groupDN := fmt.Sprintf("cn=unique-group,%s", testBaseDN)
+	for _, dn := range []string{firstDN, secondDN} {
+		if err := createGroupTestUser(conn, dn, trk); err != nil {
+			result.Passed = false
+			result.Error = err
+			result.Message = "Failed to create test entry"
+			logger.Error("GroupTest", "Failed to create member entry", "dn", dn, "error", err)
+			return result
+		}
+	}
+
+	addRequest := ldaplib.NewAddRequest(groupDN, nil)
+	addRequest.Attribute("objectClass", []string{"groupOfUniqueNames"})
+	addRequest.Attribute("cn", []string{"unique-group"})
+	addRequest.Attribute("uniqueMember", []string{firstDN})
+	if err := createEntry(conn, addRequest); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to create groupOfUniqueNames: %v", err)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+	trk.Track(groupDN, tracker.TypeGroup)
+
+	start := time.Now()
+
+	// Add the second member, then remove the first
+	modifyRequest := ldaplib.NewModifyRequest(groupDN, nil)
+	modifyRequest.Add("uniqueMember", []string{secondDN})
+	logger.Trace("Group", "Operation: Modify (Add uniqueMember)", "dn", groupDN, "member", secondDN)
+	err := conn.Modify(modifyRequest)
+	if err == nil {
+		err = verifyGroupMember(conn, groupDN, "uniqueMember", secondDN, true)
+	}
+	if err == nil {
+		modifyRequest = ldaplib.NewModifyRequest(groupDN, nil)
+		modifyRequest.Delete("uniqueMember", []string{firstDN})
+		logger.Trace("Group", "Operation: Modify (Remove uniqueMember)", "dn", groupDN, "member", firstDN)
+		err = conn.Modify(modifyRequest)
+	}
+	if err == nil {
+		err = verifyGroupMember(conn, groupDN, "uniqueMember", firstDN, false)
+	}
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("uniqueMember update failed: %v", err)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = "Added and removed uniqueMember values (verified by read-back)"
+	logger.Info("GroupTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+func testGroupMemberDeletion(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) TestResult {
+	testName := "Group - Member Deletion Referential Integrity Test"
+	logger.Info("GroupTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Group",
+	}
+
+	groupDN := fmt.Sprintf("cn=testgroup,%s", testBaseDN)
+	userDN := fmt.Sprintf("cn=refint-delete-user,%s", testBaseDN)
+	if err := createGroupTestUser(conn, userDN, trk); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = "Failed to create test entry"
+		logger.Error("GroupTest", "Failed to create member entry", "error", err)
+		return result
+	}
+
+	modifyRequest := ldaplib.NewModifyRequest(groupDN, nil)
+	modifyRequest.Add("member", []string{userDN})
+	if err := conn.Modify(modifyRequest); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to add member: %v", err)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+
+	logger.Trace("Group", "Operation: Delete (member entry)", "dn", userDN)
+	start := time.Now()
+	err := conn.Del(ldaplib.NewDelRequest(userDN, nil))
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to delete member entry: %v", err)
+		logger.LogLDAPResult("Group", "Delete", false, -1, err.Error(), result.Duration)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("Group", "Delete", true, 0, "Success", result.Duration)
+	trk.Remove(userDN)
+
+	group, err := readEntry(conn, groupDN)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to read group after delete: %v", err)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+
+	// Either outcome is valid; which one depends on referential integrity support
+	result.Passed = true
+	if hasDNValue(group, "member", userDN) {
+		result.Message = "Group still references the deleted member (no referential integrity)"
+
+		// Drop the dangling value so it does not outlive the run's entries
+		modifyRequest = ldaplib.NewModifyRequest(groupDN, nil)
+		modifyRequest.Delete("member", []string{userDN})
+		if err := conn.Modify(modifyRequest); err != nil {
+			logger.Warn("GroupTest", "Failed to remove dangling member reference", "error", err)
+		}
+	} else {
+		result.Message = "Deleted member was removed from the group (referential integrity enforced)"
+	}
+	logger.Info("GroupTest", "PASS: "+testName, "behavior", result.Message, "duration", result.Duration)
+	return result
+}
+
+// refintWait bounds how long the enforcement test waits for the member
+// reference to go, for servers that update the groups after the delete has
+// returned (389 Directory Server's referint-update-delay)
+const refintWait = 5 * time.Second
+
+// refintPollInterval is how often the group is read while waiting
+const refintPollInterval = 250 * time.Millisecond
+
+// testGroupRefintEnforced enforces require_referential_integrity: deleting a
+// group member must remove the member value that references it, as the
+// OpenLDAP refint overlay and the referential integrity plugins of 389 DS and
+// OpenDJ do
+func testGroupRefintEnforced(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) TestResult {
+	testName := "Group - Referential Integrity Enforcement Test"
+	logger.Info("GroupTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Group",
+	}
+
+	if !conn.GetConfig().RequireReferentialIntegrity {
+		logger.Warn("GroupTest", "SKIP: "+testName, "reason", "require_referential_integrity not set")
+		result.Skipped = true
+		result.Message = "Skipped: requires require_referential_integrity: true"
+		return result
+	}
+
+	groupDN := fmt.Sprintf("cn=testgroup,%s", testBaseDN)
+	userDN := fmt.Sprintf("cn=refint-enforced-user,%s", testBaseDN)
+	if err := createGroupTestUser(conn, userDN, trk); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = "Failed to create test entry"
+		logger.Error("GroupTest", "Failed to create member entry", "error", err)
+		return result
+	}
+
+	modifyRequest := ldaplib.NewModifyRequest(groupDN, nil)
+	modifyRequest.Add("member", []string{userDN})
+	err := conn.Modify(modifyRequest)
+	if err == nil {
+		err = verifyGroupMember(conn, groupDN, "member", userDN, true)
+	}
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to add member: %v", err)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+
+	logger.Trace("Group", "Operation: Delete (member entry)", "dn", userDN)
+	start := time.Now()
+	err = conn.Del(ldaplib.NewDelRequest(userDN, nil))
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to delete member entry: %v", err)
+		logger.LogLDAPResult("Group", "Delete", false, -1, err.Error(), result.Duration)
+		logger.Error("GroupTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("Group", "Delete", true, 0, "Success", result.Duration)
+	trk.Remove(userDN)
+
+	deadline := time.Now().Add(refintWait)
+	for {
+		err = verifyGroupMember(conn, groupDN, "member", userDN, false)
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(refintPollInterval)
+	}
+	waited := time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Group still references the deleted member %s after %s; referential integrity is not enforced", userDN, refintWait)
+		logger.Error("GroupTest", result.Message)
+
+		// Drop the dangling value so it does not outlive the run's entries
+		modifyRequest = ldaplib.NewModifyRequest(groupDN, nil)
+		modifyRequest.Delete("member", []string{userDN})
+		if err := conn.Modify(modifyRequest); err != nil {
+			logger.Warn("GroupTest", "Failed to remove dangling member reference", "error", err)
+		}
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Deleting %s removed it from %s (referential integrity enforced, verified after %s)", userDN, groupDN, waited.Round(time.Millisecond))
+	logger.Info("GroupTest", "PASS: "+testName, "duration", result.Duration, "waited", waited)
+	return result
+}
+
+// createGroupTestUser creates a minimal user to use as a group member
+func createGroupTestUser(conn *ldap.Connection, dn string, trk *tracker.Tracker) error {
+	rdn, err := ldaplib.ParseDN(dn)
+	if err != nil || len(rdn.RDNs) == 0 {
+		return fmt.Errorf("invalid DN %s", dn)
+	}
+
+	addRequest := ldaplib.NewAddRequest(dn, nil)
+	addRequest.Attribute("objectClass", []string{"inetOrgPerson"})
+	addRequest.Attribute("cn", []string{rdn.RDNs[0].Attributes[0].Value})
+	addRequest.Attribute("sn", []string{"GroupTest"})
+	if err := createEntry(conn, addRequest); err != nil {
+		return err
+	}
+	trk.Track(dn, tracker.TypeUser)
+	return nil
+}
+
+// verifyGroupMember reads the group back and checks whether attribute lists member
+func verifyGroupMember(conn *ldap.Connection, groupDN, attribute, member string, want bool) error {
+	group, err := readEntry(conn, groupDN)
+	if err != nil {
+		return err
+	}
+	if got := hasDNValue(group, attribute, member); got != want {
+		if want {
+			return fmt.Errorf("%s of %s does not list %s", attribute, groupDN, member)
+		}
+		return fmt.Errorf("%s of %s still lists %s", attribute, groupDN, member)
+	}
+	return nil
+}
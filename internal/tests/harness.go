@@ -0,0 +1,310 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+)
+
+// maxRetryBackoff caps the wait between two attempts of a retried test
+const maxRetryBackoff = 30 * time.Second
+
+// Fixtures shared between tests. A test that passes may provide a fixture and
+// tests that rely on it declare it as a requirement.
+const (
+	FixtureTestUser        = "cn=testuser"        // created by the Add suite
+	FixtureTestGroup       = "cn=testgroup"       // created by the Add suite
+	FixtureTelephoneNumber = "testuser telephone" // added by the Modify suite
+	FixtureRenamedUser     = "cn=renamed-user"    // created by the Modify DN suite
+	FixtureTargetOU        = "ou=target-ou"       // created by the Modify DN suite
+	FixtureGroupMember     = "testgroup member"   // added by the Group suite
+)
+
+// TestCase describes a single test, the fixtures it requires, the server
+// capabilities it needs and the fixture it provides when it passes
+type TestCase struct {
+	Name      string
+	Operation string
+	Requires  []string
+	Needs     []Capability
+	Provides  string
+	Run       func() TestResult
+}
+
+// fixtureState records whether a fixture is available and why not
+type fixtureState struct {
+	available bool
+	reason    string
+}
+
+// Harness executes test cases and tracks which fixtures are available, so
+// tests whose prerequisites failed are reported as SKIPPED with a reason
+// instead of generating cascade failures. Tests needing a capability the
+// server does not advertise are skipped the same way. Once ctx is cancelled, remaining
+// tests are skipped as well.
+type Harness struct {
+	ctx      context.Context
+	fixtures map[string]fixtureState
+	mu       *sync.Mutex
+	onResult func(TestResult)
+	include  *regexp.Regexp // only tests whose name matches are run, nil for all
+	exclude  *regexp.Regexp // tests whose name matches are left out
+	retry    retryPolicy
+	server   ldap.ServerInfo // capabilities advertised by the server, none known by default
+}
+
+// retryPolicy is how often and for which LDAP result codes a failed test is
+// repeated; a zero policy never retries
+type retryPolicy struct {
+	retries int
+	backoff time.Duration // wait before the first retry, doubled for each further one
+	codes   []int
+}
+
+// NewHarness creates a new test harness with no fixtures available
+func NewHarness(ctx context.Context) *Harness {
+	return &Harness{
+		ctx:      ctx,
+		fixtures: make(map[string]fixtureState),
+		mu:       &sync.Mutex{},
+	}
+}
+
+// WithContext returns a harness sharing the same fixtures but bound to ctx,
+// used to give a single suite its own time budget
+func (h *Harness) WithContext(ctx context.Context) *Harness {
+	return &Harness{
+		ctx:      ctx,
+		fixtures: h.fixtures,
+		mu:       h.mu,
+		include:  h.include,
+		exclude:  h.exclude,
+		retry:    h.retry,
+		server:   h.server,
+	}
+}
+
+// Filter restricts the tests to those whose name matches run, if not nil,
+// and does not match skip, if not nil. Filtered tests are left out of the
+// results; the fixtures they would provide are left unknown, so suites and
+// tests needing them behave as if the providing suite did not run.
+func (h *Harness) Filter(run, skip *regexp.Regexp) {
+	h.include, h.exclude = run, skip
+}
+
+// filtered reports whether the filters leave out a test
+func (h *Harness) filtered(name string) bool {
+	return (h.include != nil && !h.include.MatchString(name)) || (h.exclude != nil && h.exclude.MatchString(name))
+}
+
+// Retry repeats a test up to retries times while it fails with one of the
+// LDAP result codes, waiting backoff before the first retry and twice as long
+// before each further one. A result reports the retries it took, so a server
+// that is busy now and then can be told apart from a test that really fails.
+func (h *Harness) Retry(retries int, backoff time.Duration, codes []int) {
+	h.retry = retryPolicy{retries: retries, backoff: backoff, codes: codes}
+}
+
+// Capabilities lets the harness skip the tests that need a capability the
+// root DSE in info does not advertise
+func (h *Harness) Capabilities(info ldap.ServerInfo) {
+	h.server = info
+}
+
+// OnResult registers a function called as each test completes
+func (h *Harness) OnResult(fn func(TestResult)) {
+	h.onResult = fn
+}
+
+// Provide marks a fixture as available
+func (h *Harness) Provide(fixture string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fixtures[fixture] = fixtureState{available: true}
+	logger.Trace("Harness", "Fixture available", "fixture", fixture)
+}
+
+// Fail marks a fixture as unavailable with the reason
+func (h *Harness) Fail(fixture, reason string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fixtures[fixture] = fixtureState{available: false, reason: reason}
+	logger.Debug("Harness", "Fixture unavailable", "fixture", fixture, "reason", reason)
+}
+
+// Known reports whether a test of the run provided the fixture or failed to
+func (h *Harness) Known(fixture string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.fixtures[fixture]
+	return ok
+}
+
+// FixtureStates returns every known fixture with an empty reason if it is
+// available, or the reason it is not
+func (h *Harness) FixtureStates() map[string]string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	states := make(map[string]string, len(h.fixtures))
+	for fixture, state := range h.fixtures {
+		states[fixture] = state.reason
+	}
+	return states
+}
+
+// RestoreFixtures sets fixture states saved by FixtureStates
+func (h *Harness) RestoreFixtures(states map[string]string) {
+	for fixture, reason := range states {
+		if reason == "" {
+			h.Provide(fixture)
+		} else {
+			h.Fail(fixture, reason)
+		}
+	}
+}
+
+// Execute runs each case in order, skipping those whose requirements are not
+// met and leaving out those the filters exclude
+func (h *Harness) Execute(cases []TestCase) []TestResult {
+	results := make([]TestResult, 0, len(cases))
+	for _, tc := range cases {
+		if h.filtered(tc.Name) {
+			logger.Debug("Harness", "Test filtered out", "test", tc.Name)
+			continue
+		}
+		started := time.Now()
+		result := h.run(tc)
+		result.Started = started
+		if h.onResult != nil {
+			h.onResult(result)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (h *Harness) run(tc TestCase) TestResult {
+	if err := h.ctx.Err(); err != nil {
+		result := h.skip(tc, context.Cause(h.ctx).Error())
+		result.BudgetExceeded = h.budgetExceeded()
+		return result
+	}
+
+	if reason, ok := h.check(tc.Requires); !ok {
+		return h.skip(tc, reason)
+	}
+	for _, capability := range tc.Needs {
+		if !capability.advertised(h.server) {
+			return h.skip(tc, fmt.Sprintf("server does not advertise the %s", capability))
+		}
+	}
+
+	result := h.attempt(tc)
+
+	// A test cut short by cancellation did not really fail
+	if !result.Passed && h.ctx.Err() != nil {
+		logger.Warn("Harness", "Test interrupted by cancellation", "test", tc.Name)
+		result.Skipped = true
+		result.BudgetExceeded = h.budgetExceeded()
+		result.Message = fmt.Sprintf("Interrupted: %s", result.Message)
+	}
+
+	if tc.Provides != "" {
+		if result.Passed {
+			h.Provide(tc.Provides)
+		} else {
+			h.Fail(tc.Provides, fmt.Sprintf("%s failed", tc.Name))
+		}
+	}
+
+	return result
+}
+
+// attempt runs a test, repeating it under the retry policy while it fails
+// with a transient result code. The result is that of the last attempt, so
+// its duration does not include the earlier attempts or the waits.
+func (h *Harness) attempt(tc TestCase) TestResult {
+	result := tc.Run()
+	wait := h.retry.backoff
+	for retries := 1; retries <= h.retry.retries; retries++ {
+		code, ok := h.transient(result)
+		if !ok {
+			break
+		}
+		logger.Warn("Harness", "RETRY: "+tc.Name, "resultCode", code, "retry", retries, "maxRetries", h.retry.retries, "wait", wait)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-h.ctx.Done():
+			timer.Stop()
+			result.Retries = retries - 1
+			return result
+		case <-timer.C:
+		}
+		wait = min(2*wait, maxRetryBackoff)
+
+		result = tc.Run()
+		result.Retries = retries
+	}
+	return result
+}
+
+// transient returns the result code of a failed test if the retry policy
+// retries it
+func (h *Harness) transient(result TestResult) (int, bool) {
+	if result.Passed || result.Skipped || h.ctx.Err() != nil {
+		return 0, false
+	}
+	var ldapErr *ldaplib.Error
+	if !errors.As(result.Error, &ldapErr) || !slices.Contains(h.retry.codes, int(ldapErr.ResultCode)) {
+		return 0, false
+	}
+	return int(ldapErr.ResultCode), true
+}
+
+// skip records a SKIPPED result for a test that was not executed
+func (h *Harness) skip(tc TestCase, reason string) TestResult {
+	logger.Warn("Harness", "SKIP: "+tc.Name, "reason", reason)
+	if tc.Provides != "" {
+		h.Fail(tc.Provides, fmt.Sprintf("%s was skipped", tc.Name))
+	}
+	return TestResult{
+		Name:      tc.Name,
+		Operation: tc.Operation,
+		Skipped:   true,
+		Message:   "Skipped: " + reason,
+	}
+}
+
+// budgetExceeded reports whether ctx was cancelled by an exceeded time budget
+func (h *Harness) budgetExceeded() bool {
+	var budget *budgetExceeded
+	return errors.As(context.Cause(h.ctx), &budget)
+}
+
+// check returns a skip reason when any required fixture is unavailable
+func (h *Harness) check(required []string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, fixture := range required {
+		state, ok := h.fixtures[fixture]
+		if !ok {
+			return fmt.Sprintf("requires %s, which was not created in this run", fixture), false
+		}
+		if !state.available {
+			return fmt.Sprintf("requires %s (%s)", fixture, state.reason), false
+		}
+	}
+	return "", true
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"strconv"
+
+	"ldap-automated-actions/internal/history"
+	"ldap-automated-actions/internal/logger"
+)
+
+// recordHistory stores the finished run and its results in the history
+// database, if one is configured. A failure is logged but does not fail the
+// run. Dry runs execute no tests, so they are not recorded.
+func (r *Runner) recordHistory(runErr error) {
+	if r.config.HistoryDB == "" || r.config.DryRun {
+		return
+	}
+
+	store, err := history.Open(r.config.HistoryDB)
+	if err != nil {
+		logger.Warn("History", "Failed to record run", "file", r.config.HistoryDB, "error", err)
+		return
+	}
+	defer store.Close()
+
+	if err := store.Record(r.historyRun(runErr)); err != nil {
+		logger.Warn("History", "Failed to record run", "file", r.config.HistoryDB, "error", err)
+		return
+	}
+	logger.Debug("History", "Recorded run", "file", r.config.HistoryDB, "runID", r.suite.Metadata.RunID, "iteration", r.iteration)
+}
+
+// historyRun converts the finished run for the history database
+func (r *Runner) historyRun(runErr error) history.Run {
+	summary := r.newSummary(runErr)
+	run := history.Run{
+		RunID:       summary.RunID,
+		Iteration:   summary.Iteration,
+		Hostname:    summary.Hostname,
+		Server:      summary.Server,
+		ToolVersion: r.suite.Metadata.ToolVersion,
+		ConfigHash:  r.suite.Metadata.ConfigHash,
+		TestSuite:   summary.TestSuite,
+		Status:      summary.Status,
+		Error:       summary.Error,
+		Interrupted: summary.Interrupted,
+		StartTime:   r.suite.StartTime,
+		EndTime:     r.suite.EndTime,
+		Total:       summary.Summary.Total,
+		Passed:      summary.Summary.Passed,
+		Failed:      summary.Summary.Failed,
+		Skipped:     summary.Summary.Skipped,
+		NotExecuted: summary.Summary.NotExecuted,
+	}
+	_, _, _, _, run.Duration = r.suite.GetStats()
+
+	for _, result := range r.suite.Results {
+		entry := history.Result{
+			Name:      result.Name,
+			Operation: result.Operation,
+			Worker:    result.Worker,
+			Status:    resultStatus(result),
+			Started:   result.Started,
+			Duration:  result.Duration,
+			Message:   result.Message,
+		}
+		if result.Error != nil {
+			entry.Error = result.Error.Error()
+		}
+		if code, err := strconv.Atoi(resultCode(result)); err == nil {
+			entry.ResultCode = &code
+		}
+		run.Results = append(run.Results, entry)
+	}
+	return run
+}
@@ -0,0 +1,248 @@
+package tests
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+// htmlReport is the data of the --report-format html page
+type htmlReport struct {
+	Name        string
+	Meta        RunMetadata
+	Started     string
+	Finished    string
+	Duration    string
+	Passed      bool
+	Total       int
+	PassedCount int
+	Failed      int
+	Skipped     int
+	NotExecuted int
+	Interrupted string // reason the run was cancelled, empty if it completed
+	Security    []SecurityCheck
+	Workers     []WorkerStats
+	Operations  []htmlOperation
+}
+
+// htmlOperation is the section of one operation: a row of the summary table,
+// a bar of the average latency chart and the latency chart of its tests
+type htmlOperation struct {
+	Name       string
+	Tests      int
+	Passed     int
+	Failed     int
+	Skipped    int
+	Average    string
+	Slowest    string
+	AvgPercent float64 // average latency relative to the slowest operation's average
+	Results    []htmlResult
+}
+
+type htmlResult struct {
+	Name     string
+	Status   string // pass, fail or skip
+	Duration string
+	Percent  float64 // latency relative to the slowest test of the operation
+	Error    string
+	Message  string
+}
+
+// newHTMLReport builds the page data of a finished suite, with the
+// operations in the order they ran
+func newHTMLReport(suite *TestSuite) htmlReport {
+	total, passed, failed, skipped, duration := suite.GetStats()
+	notExecuted, _ := suite.GetBudgetExceeded()
+
+	report := htmlReport{
+		Name:        suite.Name,
+		Meta:        suite.Metadata,
+		Started:     suite.StartTime.Format(time.RFC3339),
+		Finished:    suite.EndTime.Format(time.RFC3339),
+		Duration:    duration.Round(time.Millisecond).String(),
+		Passed:      suite.AllPassed(),
+		Total:       total,
+		PassedCount: passed,
+		Failed:      failed,
+		Skipped:     skipped,
+		NotExecuted: notExecuted,
+		Security:    suite.Security,
+		Workers:     suite.Workers,
+	}
+	if suite.Interrupted {
+		report.Interrupted = suite.InterruptReason
+	}
+
+	index := make(map[string]int)
+	var durations [][]time.Duration
+	for _, result := range suite.Results {
+		i, ok := index[result.Operation]
+		if !ok {
+			i = len(report.Operations)
+			index[result.Operation] = i
+			report.Operations = append(report.Operations, htmlOperation{Name: result.Operation})
+			durations = append(durations, nil)
+		}
+
+		op := &report.Operations[i]
+		op.Tests++
+		status := resultStatus(result)
+		switch status {
+		case "skip":
+			op.Skipped++
+		case "pass":
+			op.Passed++
+		default:
+			op.Failed++
+		}
+
+		name := result.Name
+		if result.Worker > 0 {
+			name = fmt.Sprintf("%s (worker %d)", result.Name, result.Worker)
+		}
+		entry := htmlResult{
+			Name:     name,
+			Status:   status,
+			Duration: result.Duration.Round(time.Microsecond).String(),
+			Message:  result.Message,
+		}
+		if result.Error != nil {
+			entry.Error = result.Error.Error()
+		}
+		op.Results = append(op.Results, entry)
+		durations[i] = append(durations[i], result.Duration)
+	}
+
+	// Scale the bars of each chart to its longest bar
+	var averages []time.Duration
+	var slowestAverage time.Duration
+	for i := range report.Operations {
+		op := &report.Operations[i]
+		var sum, slowest time.Duration
+		for _, d := range durations[i] {
+			sum += d
+			slowest = max(slowest, d)
+		}
+		average := sum / time.Duration(len(durations[i]))
+		averages = append(averages, average)
+		slowestAverage = max(slowestAverage, average)
+
+		op.Average = average.Round(time.Microsecond).String()
+		op.Slowest = slowest.Round(time.Microsecond).String()
+		for j, d := range durations[i] {
+			op.Results[j].Percent = percentOf(d, slowest)
+		}
+	}
+	for i := range report.Operations {
+		report.Operations[i].AvgPercent = percentOf(averages[i], slowestAverage)
+	}
+	return report
+}
+
+// percentOf returns d as a percentage of total, at least 0.5 so every bar
+// stays visible
+func percentOf(d, total time.Duration) float64 {
+	if total <= 0 {
+		return 0.5
+	}
+	return max(0.5, float64(d)*100/float64(total))
+}
+
+// WriteHTMLReport writes the suite as a standalone HTML page with a summary
+// table, latency charts and collapsible test details
+func WriteHTMLReport(w io.Writer, suite *TestSuite) error {
+	if err := htmlTemplate.Execute(w, newHTMLReport(suite)); err != nil {
+		return fmt.Errorf("failed to write HTML report: %w", err)
+	}
+	return nil
+}
+
+// htmlTemplate renders the report without external resources, so the file
+// can be mailed or attached to a ticket as is
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"round": func(d time.Duration) string { return d.Round(time.Millisecond).String() },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} - {{.Meta.Server.Address}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { margin-bottom: 0.2em; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+th { background: #f3f3f3; }
+td.num { text-align: right; }
+.verdict { font-size: 1.3em; font-weight: bold; padding: 0.4em 0.8em; display: inline-block; }
+.verdict.pass { background: #dff0d8; color: #2b662b; }
+.verdict.fail { background: #f2dede; color: #a33; }
+.chart { margin: 0.5em 0 1.5em; max-width: 60em; }
+.chart .row { display: flex; align-items: center; margin: 2px 0; }
+.chart .label { width: 22em; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; font-size: 0.9em; }
+.chart .track { flex: 1; background: #f6f6f6; }
+.chart .bar { height: 1.1em; background: #4a7ebb; }
+.chart .bar.fail { background: #c9302c; }
+.chart .bar.skip { background: #aaa; }
+.chart .value { width: 7em; text-align: right; font-size: 0.85em; color: #555; }
+details { margin: 2px 0; }
+summary { cursor: pointer; }
+.status { display: inline-block; width: 3em; font-weight: bold; }
+.status.pass { color: #2b662b; }
+.status.fail { color: #a33; }
+.status.skip { color: #777; }
+pre { background: #f7f7f7; padding: 0.5em; margin: 0.3em 0 0.3em 3.5em; white-space: pre-wrap; }
+.concern { color: #a33; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{if .Passed}}<div class="verdict pass">&#10003; All tests passed</div>{{else}}<div class="verdict fail">&#10007; Some tests failed</div>{{end}}
+{{with .Interrupted}}<p class="concern">Run interrupted ({{.}}) - results are partial</p>{{end}}
+
+<h2>Summary</h2>
+<table>
+<tr><th>Server</th><td>{{.Meta.Server.Address}}{{with .Meta.Server.VendorName}} ({{.}} {{$.Meta.Server.VendorVersion}}){{end}}, security: {{.Meta.Server.Security}}</td></tr>
+<tr><th>Run ID</th><td>{{.Meta.RunID}}</td></tr>
+<tr><th>Tool Version</th><td>{{.Meta.ToolVersion}}</td></tr>
+<tr><th>Hostname</th><td>{{.Meta.Hostname}}</td></tr>
+<tr><th>Config Hash</th><td>{{.Meta.ConfigHash}}</td></tr>
+<tr><th>Started</th><td>{{.Started}}</td></tr>
+<tr><th>Finished</th><td>{{.Finished}}</td></tr>
+<tr><th>Duration</th><td>{{.Duration}}</td></tr>
+<tr><th>Tests</th><td>{{.Total}} total, {{.PassedCount}} passed, {{.Failed}} failed, {{.Skipped}} skipped{{if .NotExecuted}} ({{.NotExecuted}} not executed: time budget exceeded){{end}}</td></tr>
+</table>
+
+<table>
+<tr><th>Operation</th><th>Tests</th><th>Passed</th><th>Failed</th><th>Skipped</th><th>Average</th><th>Slowest</th></tr>
+{{range $i, $op := .Operations}}<tr><td><a href="#op-{{$i}}">{{.Name}}</a></td><td class="num">{{.Tests}}</td><td class="num">{{.Passed}}</td><td class="num">{{.Failed}}</td><td class="num">{{.Skipped}}</td><td class="num">{{.Average}}</td><td class="num">{{.Slowest}}</td></tr>
+{{end}}</table>
+
+<h2>Average Latency per Operation</h2>
+<div class="chart">
+{{range .Operations}}<div class="row"><span class="label">{{.Name}}</span><div class="track"><div class="bar{{if .Failed}} fail{{end}}" style="width: {{.AvgPercent}}%"></div></div><span class="value">{{.Average}}</span></div>
+{{end}}</div>
+
+{{with .Workers}}<h2>Workers</h2>
+<table>
+<tr><th>Worker</th><th>Tests</th><th>Passed</th><th>Failed</th><th>Skipped</th><th>Wall Time</th><th>Error</th></tr>
+{{range .}}<tr><td class="num">{{.ID}}</td><td class="num">{{.Total}}</td><td class="num">{{.Passed}}</td><td class="num">{{.Failed}}</td><td class="num">{{.Skipped}}</td><td class="num">{{round .Duration}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+{{end}}
+{{with .Security}}<h2>Security Posture</h2>
+<table>
+{{range .}}<tr><th>{{.Name}}</th><td{{if .Concern}} class="concern"{{end}}>{{.Result}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Tests</h2>
+{{range $i, $op := .Operations}}<h3 id="op-{{$i}}">{{.Name}}</h3>
+<div class="chart">
+{{range .Results}}<div class="row"><span class="label" title="{{.Name}}">{{.Name}}</span><div class="track"><div class="bar {{.Status}}" style="width: {{.Percent}}%"></div></div><span class="value">{{.Duration}}</span></div>
+{{end}}</div>
+{{range .Results}}<details{{if eq .Status "fail"}} open{{end}}><summary><span class="status {{.Status}}">{{.Status}}</span> {{.Name}} ({{.Duration}})</summary>
+{{with .Error}}<pre>Error: {{.}}</pre>{{end}}{{with .Message}}<pre>{{.}}</pre>{{end}}</details>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
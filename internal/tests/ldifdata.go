@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/ldif"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// TestLDIFData loads the add and modify records of an LDIF file into the test
+// OU and verifies each change by re-reading the directory. The records name
+// their entries under the base DN; they are moved below the test OU, and so
+// are attribute values holding DNs under the base DN, such as member. Added
+// entries are tracked for cleanup.
+func TestLDIFData(conn *ldap.Connection, path, baseDN, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
+	logger.Info("LDIFData", "Starting LDIF data tests", "file", path)
+
+	records, err := ldif.ParseFile(path)
+	if err != nil {
+		logger.Error("LDIFData", "Failed to parse LDIF file", "file", path, "error", err)
+		return []TestResult{{
+			Name:      "Parse LDIF File",
+			Operation: "LDIF Data",
+			Passed:    false,
+			Error:     err,
+			Message:   fmt.Sprintf("Failed to parse %s: %v", path, err),
+		}}
+	}
+
+	rebase := newDNRebaser(baseDN, testBaseDN)
+	provided := make(map[string]bool)
+	cases := make([]TestCase, 0, len(records))
+	for _, record := range records {
+		tc := TestCase{
+			Name:      fmt.Sprintf("LDIF %s %s", record.ChangeType, record.DN),
+			Operation: "LDIF Data",
+		}
+
+		loaded, err := rebase.record(record)
+		if err == nil && record.ChangeType != ldif.ChangeAdd && record.ChangeType != ldif.ChangeModify {
+			err = fmt.Errorf("changetype %s is not supported, only add and modify records are loaded", record.ChangeType)
+		}
+		if err != nil {
+			name, line := tc.Name, record.Line
+			tc.Run = func() TestResult {
+				logger.Error("LDIFData", "Invalid record", "line", line, "error", err)
+				return TestResult{Name: name, Operation: "LDIF Data", Error: err, Message: fmt.Sprintf("Record at line %d not loaded: %v", line, err)}
+			}
+			cases = append(cases, tc)
+			continue
+		}
+
+		// A record is skipped if the entry it depends on was in the file but failed to load
+		target := loaded.DN
+		if record.ChangeType == ldif.ChangeAdd {
+			target = ldif.ParentDN(loaded.DN)
+			tc.Provides = ldifFixture(loaded.DN)
+			provided[strings.ToLower(loaded.DN)] = true
+		}
+		if provided[strings.ToLower(target)] {
+			tc.Requires = []string{ldifFixture(target)}
+		}
+
+		name := tc.Name
+		tc.Run = func() TestResult { return loadLDIFRecord(conn, name, loaded, trk) }
+		cases = append(cases, tc)
+	}
+
+	results := h.Execute(cases)
+	logger.Info("LDIFData", "Completed LDIF data tests", "total", len(results))
+	return results
+}
+
+// ldifFixture names the fixture of an entry added from the LDIF file
+func ldifFixture(dn string) string {
+	return "ldif:" + strings.ToLower(dn)
+}
+
+// loadLDIFRecord applies one rebased record, tracking an added entry before
+// it is verified so it is cleaned up even if the verification fails
+func loadLDIFRecord(conn *ldap.Connection, testName string, record ldif.Record, trk *tracker.Tracker) TestResult {
+	logger.Info("LDIFData", "Running: "+testName, "line", record.Line, "dn", record.DN)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "LDIF Data",
+	}
+
+	start := time.Now()
+	operation, err := applyChange(conn, record)
+	result.Duration = time.Since(start)
+	if err != nil {
+		logger.LogLDAPResult("LDIFData", operation, false, -1, err.Error(), result.Duration)
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to load record at line %d: %v", record.Line, err)
+		logger.Error("LDIFData", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("LDIFData", operation, true, 0, "Success", result.Duration)
+	if record.ChangeType == ldif.ChangeAdd {
+		trk.Track(record.DN, ldifEntryType(record))
+	}
+
+	if err := verifyRecord(conn, record); err != nil {
+		result.Error = err
+		result.Message = fmt.Sprintf("Loaded but verification failed: %v", err)
+		logger.Error("LDIFData", result.Message, "dn", record.DN)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("%s loaded and verified as %s", operation, record.DN)
+	logger.Info("LDIFData", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// ldifEntryType classifies an added entry by its object classes for the tracker
+func ldifEntryType(record ldif.Record) tracker.EntryType {
+	for _, attr := range record.Attributes {
+		if !strings.EqualFold(attr.Name, "objectClass") {
+			continue
+		}
+		for _, value := range attr.Values {
+			switch strings.ToLower(value) {
+			case "organizationalunit":
+				return tracker.TypeOU
+			case "groupofnames", "groupofuniquenames", "group", "posixgroup":
+				return tracker.TypeGroup
+			case "person", "inetorgperson", "user":
+				return tracker.TypeUser
+			}
+		}
+	}
+	return tracker.TypeOther
+}
+
+// dnRebaser moves DNs under the base DN to the same position under the test OU
+type dnRebaser struct {
+	baseDN     *ldaplib.DN
+	testBaseDN string
+}
+
+func newDNRebaser(baseDN, testBaseDN string) *dnRebaser {
+	parsed, err := ldaplib.ParseDN(baseDN)
+	if err != nil {
+		parsed = &ldaplib.DN{}
+	}
+	return &dnRebaser{baseDN: parsed, testBaseDN: testBaseDN}
+}
+
+// dn returns the DN below the test OU, and false if dn is not below the base DN
+func (r *dnRebaser) dn(dn string) (string, bool) {
+	parsed, err := ldaplib.ParseDN(dn)
+	if err != nil || len(r.baseDN.RDNs) == 0 || !r.baseDN.AncestorOfFold(parsed) {
+		return dn, false
+	}
+
+	rdns := make([]string, 0, len(parsed.RDNs)-len(r.baseDN.RDNs)+1)
+	for _, rdn := range parsed.RDNs[:len(parsed.RDNs)-len(r.baseDN.RDNs)] {
+		rdns = append(rdns, rdn.String())
+	}
+	return strings.Join(append(rdns, r.testBaseDN), ","), true
+}
+
+// value rebases an attribute value if it is a DN below the base DN
+func (r *dnRebaser) value(value string) string {
+	if !strings.Contains(value, "=") {
+		return value
+	}
+	rebased, _ := r.dn(value)
+	return rebased
+}
+
+// record returns a copy of record with its DN and DN values rebased. Records
+// outside the base DN, or of the base DN itself, cannot be loaded.
+func (r *dnRebaser) record(record ldif.Record) (ldif.Record, error) {
+	dn, ok := r.dn(record.DN)
+	if !ok {
+		return record, fmt.Errorf("%s is not below the base DN", record.DN)
+	}
+	record.DN = dn
+
+	attributes := make([]ldif.Attribute, len(record.Attributes))
+	for i, attr := range record.Attributes {
+		attributes[i] = ldif.Attribute{Name: attr.Name, Values: r.values(attr.Values)}
+	}
+	record.Attributes = attributes
+
+	modifications := make([]ldif.Modification, len(record.Modifications))
+	for i, mod := range record.Modifications {
+		mod.Values = r.values(mod.Values)
+		modifications[i] = mod
+	}
+	record.Modifications = modifications
+	return record, nil
+}
+
+func (r *dnRebaser) values(values []string) []string {
+	rebased := make([]string, len(values))
+	for i, value := range values {
+		rebased[i] = r.value(value)
+	}
+	return rebased
+}
@@ -0,0 +1,300 @@
+package tests
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/config"
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// accountDisableMethod is a vendor attribute that disables an account
+type accountDisableMethod struct {
+	server    string
+	vendors   []ldap.Vendor // servers known to support the method
+	attribute string
+	value     string
+}
+
+// accountDisableMethods are the vendor attributes tried, in order, to disable
+// an account; the first one the server accepts is used
+var accountDisableMethods = []accountDisableMethod{
+	{server: "OpenLDAP ppolicy", vendors: []ldap.Vendor{ldap.VendorOpenLDAP}, attribute: "pwdAccountLockedTime", value: "000001010000Z"},
+	{server: "OpenDJ/PingDS", vendors: []ldap.Vendor{ldap.VendorOpenDJ, ldap.VendorPingDirectory}, attribute: "ds-pwp-account-disabled", value: "true"},
+	{server: "389 Directory Server", vendors: []ldap.Vendor{ldap.Vendor389DS}, attribute: "nsAccountLock", value: "true"},
+}
+
+// disableMethodsFor returns the account disable methods with those of the
+// detected vendor first, so its method is not preceded by failed attempts
+func disableMethodsFor(vendor ldap.Vendor) []accountDisableMethod {
+	methods := slices.Clone(accountDisableMethods)
+	slices.SortStableFunc(methods, func(a, b accountDisableMethod) int {
+		aMatches, bMatches := slices.Contains(a.vendors, vendor), slices.Contains(b.vendors, vendor)
+		switch {
+		case aMatches && !bMatches:
+			return -1
+		case bMatches && !aMatches:
+			return 1
+		}
+		return 0
+	})
+	return methods
+}
+
+// lifecycleStep is the outcome of one step of the account lifecycle scenario
+type lifecycleStep struct {
+	name     string
+	duration time.Duration
+	note     string // observed behavior worth reporting, e.g. the disable method
+	skipped  bool
+}
+
+// TestLifecycle runs the end-to-end account lifecycle scenario
+func TestLifecycle(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
+	logger.Info("LifecycleTest", "Starting account lifecycle scenario")
+
+	results := h.Execute([]TestCase{
+		// Test 1: Provision, use, disable and deprovision an account
+		{Name: "Account Lifecycle Scenario Test", Operation: "Lifecycle", Run: func() TestResult { return testAccountLifecycle(conn, testBaseDN, trk) }},
+	})
+
+	logger.Info("LifecycleTest", "Completed account lifecycle scenario", "total", len(results))
+	return results
+}
+
+func testAccountLifecycle(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) TestResult {
+	testName := "Account Lifecycle Scenario Test"
+	logger.Info("LifecycleTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Lifecycle",
+	}
+
+	userDN := fmt.Sprintf("cn=lifecycle-user,%s", testBaseDN)
+	groupDN := fmt.Sprintf("cn=lifecycle-group,%s", testBaseDN)
+	password, err := generatePassword()
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to generate password: %v", err)
+		logger.Error("LifecycleTest", result.Message)
+		return result
+	}
+
+	var steps []lifecycleStep
+	// step runs one scenario step, timing it; an error ends the scenario
+	step := func(name string, fn func() (string, error)) error {
+		start := time.Now()
+		note, err := fn()
+		s := lifecycleStep{name: name, duration: time.Since(start), note: note}
+		steps = append(steps, s)
+		result.Duration += s.duration
+		if err != nil {
+			logger.Error("LifecycleTest", "Lifecycle step failed", "step", name, "error", err, "duration", s.duration)
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		logger.Debug("LifecycleTest", "Lifecycle step completed", "step", name, "duration", s.duration, "note", note)
+		return nil
+	}
+	skip := func(name, reason string) {
+		steps = append(steps, lifecycleStep{name: name, note: reason, skipped: true})
+		logger.Warn("LifecycleTest", "Lifecycle step skipped", "step", name, "reason", reason)
+	}
+
+	fail := func(err error) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Lifecycle failed at %v [%s]", err, formatSteps(steps))
+		logger.Error("LifecycleTest", result.Message)
+		return result
+	}
+
+	if err := step("create user", func() (string, error) {
+		addRequest := ldaplib.NewAddRequest(userDN, nil)
+		addRequest.Attribute("objectClass", []string{"inetOrgPerson"})
+		addRequest.Attribute("cn", []string{"lifecycle-user"})
+		addRequest.Attribute("sn", []string{"Lifecycle"})
+		if err := createEntry(conn, addRequest); err != nil {
+			return "", err
+		}
+		trk.Track(userDN, tracker.TypeUser)
+		return "", nil
+	}); err != nil {
+		return fail(err)
+	}
+
+	if err := step("set password", func() (string, error) {
+		modifyRequest := ldaplib.NewModifyRequest(userDN, nil)
+		modifyRequest.Replace("userPassword", []string{password})
+		return "", conn.Modify(modifyRequest)
+	}); err != nil {
+		return fail(err)
+	}
+
+	if err := step("bind as user", func() (string, error) {
+		userConn, err := bindIdentity(conn, config.ACLIdentity{Identity: userDN, Password: password})
+		if err != nil {
+			return "", err
+		}
+		userConn.Close()
+		return "", nil
+	}); err != nil {
+		return fail(err)
+	}
+
+	if err := step("add to group", func() (string, error) {
+		// groupOfNames needs a member, so the group starts with the test OU
+		addRequest := ldaplib.NewAddRequest(groupDN, nil)
+		addRequest.Attribute("objectClass", []string{"groupOfNames"})
+		addRequest.Attribute("cn", []string{"lifecycle-group"})
+		addRequest.Attribute("member", []string{testBaseDN})
+		if err := createEntry(conn, addRequest); err != nil {
+			return "", err
+		}
+		trk.Track(groupDN, tracker.TypeGroup)
+
+		modifyRequest := ldaplib.NewModifyRequest(groupDN, nil)
+		modifyRequest.Add("member", []string{userDN})
+		return "", conn.Modify(modifyRequest)
+	}); err != nil {
+		return fail(err)
+	}
+
+	if err := step("verify membership", func() (string, error) {
+		group, err := readEntry(conn, groupDN)
+		if err != nil {
+			return "", err
+		}
+		if !hasDNValue(group, "member", userDN) {
+			return "", fmt.Errorf("group %s does not list %s as member", groupDN, userDN)
+		}
+		return verifyMemberOf(conn, userDN, groupDN)
+	}); err != nil {
+		return fail(err)
+	}
+
+	disabled := false
+	if err := step("disable account", func() (string, error) {
+		method, err := disableAccount(conn, userDN)
+		if err != nil {
+			return "", err
+		}
+		disabled = method != ""
+		if !disabled {
+			return "no supported disable attribute", nil
+		}
+		return "via " + method, nil
+	}); err != nil {
+		return fail(err)
+	}
+
+	if disabled {
+		if err := step("verify bind fails", func() (string, error) {
+			userConn, err := bindIdentity(conn, config.ACLIdentity{Identity: userDN, Password: password})
+			if err == nil {
+				userConn.Close()
+				return "", fmt.Errorf("disabled account can still bind")
+			}
+			if note := rejection(err); note != "" {
+				return note, nil
+			}
+			return fmt.Sprintf("rejected (%v)", err), nil
+		}); err != nil {
+			return fail(err)
+		}
+	} else {
+		skip("verify bind fails", "account could not be disabled")
+	}
+
+	if err := step("delete user", func() (string, error) {
+		if err := conn.Del(ldaplib.NewDelRequest(userDN, nil)); err != nil {
+			return "", err
+		}
+		trk.Remove(userDN)
+		return "", nil
+	}); err != nil {
+		return fail(err)
+	}
+
+	if err := step("verify gone", func() (string, error) {
+		return "", verifyAbsent(conn, userDN)
+	}); err != nil {
+		return fail(err)
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Account lifecycle completed [%s]", formatSteps(steps))
+	logger.Info("LifecycleTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// verifyMemberOf checks the user's memberOf (isMemberOf on some servers), if
+// the server maintains it
+func verifyMemberOf(conn *ldap.Connection, userDN, groupDN string) (string, error) {
+	memberOf := memberOfAttribute(conn.Vendor())
+	user, err := readAttributes(conn, userDN, memberOf)
+	if err != nil {
+		return "", err
+	}
+	if len(user.GetEqualFoldAttributeValues(memberOf)) == 0 {
+		return memberOf + " not maintained", nil
+	}
+	if !hasDNValue(user, memberOf, groupDN) {
+		return "", fmt.Errorf("%s of %s does not list %s", memberOf, userDN, groupDN)
+	}
+	return memberOf + " updated", nil
+}
+
+// disableAccount disables the account with the first vendor method the server
+// accepts and returns its name, or "" if none applies
+func disableAccount(conn *ldap.Connection, userDN string) (string, error) {
+	for _, method := range disableMethodsFor(conn.Vendor()) {
+		modifyRequest := ldaplib.NewModifyRequest(userDN, nil)
+		modifyRequest.Replace(method.attribute, []string{method.value})
+
+		logger.Trace("Lifecycle", "Operation: Modify (disable)", "dn", userDN, "attribute", method.attribute)
+		err := conn.Modify(modifyRequest)
+		if err == nil {
+			return fmt.Sprintf("%s (%s)", method.attribute, method.server), nil
+		}
+		if !ldaplib.IsErrorAnyOf(err, ldaplib.LDAPResultUndefinedAttributeType, ldaplib.LDAPResultObjectClassViolation, ldaplib.LDAPResultUnwillingToPerform, ldaplib.LDAPResultConstraintViolation, ldaplib.LDAPResultInvalidAttributeSyntax) {
+			return "", err
+		}
+		logger.Debug("LifecycleTest", "Disable method not supported", "attribute", method.attribute, "error", err)
+	}
+	return "", nil
+}
+
+// formatSteps renders the steps with their timing for the result message
+func formatSteps(steps []lifecycleStep) string {
+	parts := make([]string, 0, len(steps))
+	for _, s := range steps {
+		switch {
+		case s.skipped:
+			parts = append(parts, fmt.Sprintf("%s: skipped, %s", s.name, s.note))
+		case s.note != "":
+			parts = append(parts, fmt.Sprintf("%s %s (%s)", s.name, s.duration.Round(time.Millisecond), s.note))
+		default:
+			parts = append(parts, fmt.Sprintf("%s %s", s.name, s.duration.Round(time.Millisecond)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// generatePassword returns a random password meeting common complexity rules
+func generatePassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "Lc-" + hex.EncodeToString(b) + "!A1", nil
+}
@@ -0,0 +1,452 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// FixtureLoadData is provided when the load test OU and its seed entries exist
+const FixtureLoadData = "load test data"
+
+// FixtureLoadRun is provided when the load was generated, so the per-operation
+// results can be reported
+const FixtureLoadRun = "load test run"
+
+// LoadOperations are the operations the loadtest suite can mix, in report order
+var LoadOperations = []string{"bind", "search", "add", "modify"}
+
+// LoadSettings configures the loadtest suite
+type LoadSettings struct {
+	Duration     time.Duration
+	Concurrency  int            // connections sending operations at once
+	Rate         float64        // target operations per second in total, 0 for as fast as possible
+	Mix          map[string]int // relative weight of each of LoadOperations
+	MaxErrorRate float64        // error percentage above which an operation fails
+}
+
+// loadStats collects the latencies and errors of each operation
+type loadStats struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	firstErr  map[string]error
+	elapsed   time.Duration
+}
+
+func newLoadStats() *loadStats {
+	return &loadStats{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+		firstErr:  make(map[string]error),
+	}
+}
+
+// merge adds the measurements of one worker
+func (s *loadStats) merge(w *loadWorker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for op, latencies := range w.latencies {
+		s.latencies[op] = append(s.latencies[op], latencies...)
+	}
+	for op, n := range w.errors {
+		s.errors[op] += n
+		if s.firstErr[op] == nil {
+			s.firstErr[op] = w.firstErr[op]
+		}
+	}
+}
+
+// TestLoad runs the load test, which sends a weighted mix of operations on
+// several connections for a fixed duration and reports throughput, error rate
+// and latency percentiles per operation
+func TestLoad(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, settings LoadSettings, h *Harness) []TestResult {
+	logger.Info("LoadTest", "Starting load tests")
+
+	loadBaseDN := fmt.Sprintf("ou=loadtest,%s", testBaseDN)
+	stats := newLoadStats()
+
+	cases := []TestCase{
+		// Test 1: Create the OU and the entries searched and modified under load
+		{Name: "Load Test Setup", Operation: "Load Test", Provides: FixtureLoadData, Run: func() TestResult {
+			return testLoadSetup(conn, loadBaseDN, trk, settings.Concurrency)
+		}},
+
+		// Test 2: Generate the load and check the overall error rate
+		{Name: "Load Test Run", Operation: "Load Test", Requires: []string{FixtureLoadData}, Provides: FixtureLoadRun, Run: func() TestResult {
+			return testLoadRun(conn, loadBaseDN, trk, settings, stats, h.ctx)
+		}},
+	}
+
+	// Tests 3+: Throughput, error rate and latencies of each operation of the mix
+	for _, op := range LoadOperations {
+		if settings.Mix[op] <= 0 {
+			continue
+		}
+		op := op
+		cases = append(cases, TestCase{Name: "Load Test - " + loadOperationName(op), Operation: "Load Test", Requires: []string{FixtureLoadRun}, Run: func() TestResult {
+			return testLoadOperation(op, settings, stats)
+		}})
+	}
+
+	results := h.Execute(cases)
+	logger.Info("LoadTest", "Completed load tests", "total", len(results))
+	return results
+}
+
+// loadSeedDN is the entry worker id searches and modifies
+func loadSeedDN(loadBaseDN string, id int) string {
+	return fmt.Sprintf("cn=load-seed-%d,%s", id, loadBaseDN)
+}
+
+func testLoadSetup(conn *ldap.Connection, loadBaseDN string, trk *tracker.Tracker, workers int) TestResult {
+	testName := "Load Test Setup"
+	logger.Info("LoadTest", "Running: "+testName, "dn", loadBaseDN, "workers", workers)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Load Test",
+	}
+
+	start := time.Now()
+	addRequest := ldaplib.NewAddRequest(loadBaseDN, nil)
+	addRequest.Attribute("objectClass", []string{"organizationalUnit"})
+	addRequest.Attribute("ou", []string{"loadtest"})
+	if err := createEntry(conn, addRequest); err != nil {
+		result.Duration = time.Since(start)
+		result.Error = err
+		result.Message = "Failed to create the load test OU"
+		logger.Error("LoadTest", result.Message, "error", err)
+		return result
+	}
+	trk.Track(loadBaseDN, tracker.TypeOU)
+
+	for id := 1; id <= workers; id++ {
+		dn := loadSeedDN(loadBaseDN, id)
+		addRequest := ldaplib.NewAddRequest(dn, nil)
+		addRequest.Attribute("objectClass", []string{"top", "person", "organizationalPerson", "inetOrgPerson"})
+		addRequest.Attribute("cn", []string{fmt.Sprintf("load-seed-%d", id)})
+		addRequest.Attribute("sn", []string{"LoadSeed"})
+		addRequest.Attribute("description", []string{"Load test seed entry"})
+		if err := createEntry(conn, addRequest); err != nil {
+			result.Duration = time.Since(start)
+			result.Error = err
+			result.Message = fmt.Sprintf("Failed to create seed entry %s", dn)
+			logger.Error("LoadTest", result.Message, "error", err)
+			return result
+		}
+		trk.Track(dn, tracker.TypeUser)
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Created %s with %d seed entries", loadBaseDN, workers)
+	logger.Info("LoadTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+func testLoadRun(conn *ldap.Connection, loadBaseDN string, trk *tracker.Tracker, settings LoadSettings, stats *loadStats, ctx context.Context) TestResult {
+	testName := "Load Test Run"
+	logger.Info("LoadTest", "Running: "+testName, "duration", settings.Duration, "concurrency", settings.Concurrency, "rate", settings.Rate, "mix", settings.Mix)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Load Test",
+	}
+
+	start := time.Now()
+	workers := make([]*loadWorker, 0, settings.Concurrency)
+	defer func() {
+		for _, w := range workers {
+			if w.conn != nil {
+				w.conn.Close()
+			}
+		}
+	}()
+	for id := 1; id <= settings.Concurrency; id++ {
+		c, err := openLoadConn(conn)
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Error = err
+			result.Message = fmt.Sprintf("Failed to open load connection %d: %v", id, err)
+			logger.Error("LoadTest", result.Message)
+			return result
+		}
+		workers = append(workers, newLoadWorker(id, conn, c, loadBaseDN, trk, settings.Mix))
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, settings.Duration)
+	defer cancel()
+
+	// With a target rate the workers take turns from a shared ticker;
+	// without one each sends its next operation as soon as the last returned
+	var tokens <-chan time.Time
+	if settings.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / settings.Rate))
+		defer ticker.Stop()
+		tokens = ticker.C
+	}
+
+	runStart := time.Now()
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w *loadWorker) {
+			defer wg.Done()
+			w.run(runCtx, tokens)
+			stats.merge(w)
+		}(w)
+	}
+	wg.Wait()
+	stats.elapsed = time.Since(runStart)
+	result.Duration = time.Since(start)
+
+	var total, failed int
+	for _, op := range LoadOperations {
+		total += len(stats.latencies[op]) + stats.errors[op]
+		failed += stats.errors[op]
+	}
+	if total == 0 {
+		logger.Warn("LoadTest", "SKIP: "+testName, "reason", "no operation completed")
+		result.Skipped = true
+		result.Message = "Skipped: the run ended before any operation completed"
+		return result
+	}
+
+	throughput := float64(total) / stats.elapsed.Seconds()
+	errorRate := float64(failed) * 100 / float64(total)
+	summary := fmt.Sprintf("%d operations in %s on %d connections: %.1f ops/s", total, stats.elapsed.Round(time.Millisecond), settings.Concurrency, throughput)
+	if settings.Rate > 0 {
+		summary += fmt.Sprintf(" (target %.1f ops/s)", settings.Rate)
+	}
+	summary += fmt.Sprintf(", %.2f%% errors", errorRate)
+	if ctx.Err() != nil {
+		summary += " (interrupted)"
+	}
+
+	if errorRate > settings.MaxErrorRate {
+		result.Message = fmt.Sprintf("Error rate above %.2f%%: %s", settings.MaxErrorRate, summary)
+		logger.Error("LoadTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = summary
+	logger.Info("LoadTest", "PASS: "+testName, "duration", result.Duration, "throughput", fmt.Sprintf("%.1f", throughput))
+	return result
+}
+
+func testLoadOperation(op string, settings LoadSettings, stats *loadStats) TestResult {
+	testName := "Load Test - " + loadOperationName(op)
+	logger.Info("LoadTest", "Running: "+testName)
+
+	latencies := stats.latencies[op]
+	errors := stats.errors[op]
+	total := len(latencies) + errors
+	result := TestResult{
+		Name:      testName,
+		Operation: "Load Test",
+		Duration:  stats.elapsed,
+	}
+
+	if total == 0 {
+		logger.Warn("LoadTest", "SKIP: "+testName, "reason", "no operation of this kind was sent")
+		result.Skipped = true
+		result.Message = "Skipped: no operation of this kind was sent during the run"
+		return result
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	errorRate := float64(errors) * 100 / float64(total)
+	summary := fmt.Sprintf("%d operations, %.1f ops/s, %.2f%% errors; latency p50 %s, p95 %s, p99 %s, max %s",
+		total, float64(total)/stats.elapsed.Seconds(), errorRate,
+		percentile(latencies, 50), percentile(latencies, 95), percentile(latencies, 99), percentile(latencies, 100))
+
+	if errorRate > settings.MaxErrorRate {
+		result.Error = stats.firstErr[op]
+		result.Message = fmt.Sprintf("Error rate above %.2f%%: %s", settings.MaxErrorRate, summary)
+		logger.Error("LoadTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = summary
+	logger.Info("LoadTest", "PASS: "+testName, "operations", total)
+	return result
+}
+
+// percentile returns the p-th percentile of sorted latencies (nearest rank)
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(float64(len(sorted))*p/100+0.5) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank].Round(time.Microsecond)
+}
+
+// loadOperationName returns the name of an operation as shown in the report
+func loadOperationName(op string) string {
+	return strings.ToUpper(op[:1]) + op[1:]
+}
+
+// openLoadConn opens a new connection bound like conn that records its writes
+// like conn does
+func openLoadConn(conn *ldap.Connection) (*ldap.Connection, error) {
+	c, err := ldap.NewBoundConnection(conn.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	c.SetAuditLog(conn.AuditLog())
+	c.SetPlan(conn.Plan())
+	return c, nil
+}
+
+// loadWorker sends operations on one connection and records their outcome
+type loadWorker struct {
+	id         int
+	main       *ldap.Connection // connection the worker's connection is re-opened like
+	conn       *ldap.Connection
+	loadBaseDN string
+	tracker    *tracker.Tracker
+	rng        *rand.Rand
+	ops        []string // operations to pick from, each repeated by its weight
+	added      int
+
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	firstErr  map[string]error
+}
+
+func newLoadWorker(id int, main, conn *ldap.Connection, loadBaseDN string, trk *tracker.Tracker, mix map[string]int) *loadWorker {
+	w := &loadWorker{
+		id:         id,
+		main:       main,
+		conn:       conn,
+		loadBaseDN: loadBaseDN,
+		tracker:    trk,
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano() + int64(id))),
+		latencies:  make(map[string][]time.Duration),
+		errors:     make(map[string]int),
+		firstErr:   make(map[string]error),
+	}
+	for _, op := range LoadOperations {
+		for i := 0; i < mix[op]; i++ {
+			w.ops = append(w.ops, op)
+		}
+	}
+	return w
+}
+
+// run sends operations until ctx is done, one per tick of tokens if set
+func (w *loadWorker) run(ctx context.Context, tokens <-chan time.Time) {
+	for {
+		if tokens != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tokens:
+			}
+		} else if ctx.Err() != nil {
+			return
+		}
+
+		if w.conn == nil && !w.reopen() {
+			// Keep the failed reconnect from spinning while the server is down
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+			continue
+		}
+
+		op := w.ops[w.rng.Intn(len(w.ops))]
+		start := time.Now()
+		err := w.send(op)
+		latency := time.Since(start)
+		if ctx.Err() != nil && err != nil {
+			return // cut short by the end of the run, not a server error
+		}
+		w.record(op, latency, err)
+	}
+}
+
+// send performs one operation of the mix
+func (w *loadWorker) send(op string) error {
+	seedDN := loadSeedDN(w.loadBaseDN, w.id)
+	switch op {
+	case "bind":
+		return w.conn.Bind()
+	case "search":
+		searchRequest := ldaplib.NewSearchRequest(
+			w.loadBaseDN,
+			ldaplib.ScopeSingleLevel,
+			ldaplib.NeverDerefAliases,
+			1, 0, false,
+			fmt.Sprintf("(cn=load-seed-%d)", w.id),
+			[]string{"cn", "description"},
+			nil,
+		)
+		_, err := w.conn.GetConnection().Search(searchRequest)
+		return err
+	case "add":
+		w.added++
+		dn := fmt.Sprintf("cn=load-%d-%d,%s", w.id, w.added, w.loadBaseDN)
+		addRequest := ldaplib.NewAddRequest(dn, nil)
+		addRequest.Attribute("objectClass", []string{"top", "person", "organizationalPerson", "inetOrgPerson"})
+		addRequest.Attribute("cn", []string{fmt.Sprintf("load-%d-%d", w.id, w.added)})
+		addRequest.Attribute("sn", []string{"LoadTest"})
+		err := w.conn.Add(addRequest)
+		if err == nil {
+			w.tracker.Track(dn, tracker.TypeUser)
+		}
+		return err
+	default: // modify
+		modifyRequest := ldaplib.NewModifyRequest(seedDN, nil)
+		modifyRequest.Replace("description", []string{fmt.Sprintf("Load test modify %d at %s", w.rng.Int63(), time.Now().Format(time.RFC3339Nano))})
+		return w.conn.Modify(modifyRequest)
+	}
+}
+
+// record counts the outcome of an operation; a dropped connection is
+// re-opened before the next one
+func (w *loadWorker) record(op string, latency time.Duration, err error) {
+	if err == nil {
+		w.latencies[op] = append(w.latencies[op], latency)
+		return
+	}
+
+	w.errors[op]++
+	if w.firstErr[op] == nil {
+		w.firstErr[op] = err
+		logger.Warn("LoadTest", "Operation failed", "worker", w.id, "operation", op, "error", err)
+	} else {
+		logger.Debug("LoadTest", "Operation failed", "worker", w.id, "operation", op, "error", err)
+	}
+	if isDisconnect(err) || ldaplib.IsErrorWithCode(err, ldaplib.ErrorNetwork) {
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// reopen replaces a dropped connection, counting a failure as a bind error
+func (w *loadWorker) reopen() bool {
+	c, err := openLoadConn(w.main)
+	if err != nil {
+		w.record("bind", 0, err)
+		return false
+	}
+	w.conn = c
+	return true
+}
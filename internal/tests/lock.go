@@ -0,0 +1,235 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// runLock is an advisory lock entry under the base DN. Runs with the same
+// test prefix take it in turn; the holder is recorded in its description as
+// "<run-id> <hostname> <refreshed RFC 3339>", the time rewritten by the
+// holder's heartbeat so that only a lock no run refreshes goes stale.
+type runLock struct {
+	dn       string
+	runID    string
+	hostname string
+
+	mu     sync.Mutex
+	holder string // description value last written by this run
+}
+
+// errLockLost is the cause of a run interrupted because another run took its
+// lock over
+var errLockLost = errors.New("lost the run lock")
+
+// lockHolderValue is the description of a lock held by runID on hostname,
+// refreshed at now
+func lockHolderValue(runID, hostname string, now time.Time) string {
+	return fmt.Sprintf("%s %s %s", runID, hostname, now.UTC().Format(time.RFC3339))
+}
+
+// lockDN returns the DN of the lock entry shared by all runs with this prefix
+func lockDN(prefix, baseDN string) string {
+	return fmt.Sprintf("cn=%s-lock,%s", prefix, baseDN)
+}
+
+// acquireLock creates the lock entry, taking it over if its holder is older
+// than staleAfter. A lock held by another live run is an error.
+func acquireLock(conn *ldap.Connection, prefix, baseDN string, meta RunMetadata, staleAfter time.Duration) (*runLock, error) {
+	hostname := meta.Hostname
+	if hostname == "" {
+		hostname = "unknown"
+	}
+	lock := &runLock{
+		dn:       lockDN(prefix, baseDN),
+		runID:    meta.RunID,
+		hostname: hostname,
+		holder:   lockHolderValue(meta.RunID, hostname, time.Now()),
+	}
+	logger.Info("Lock", "Acquiring run lock", "dn", lock.dn)
+
+	addRequest := ldaplib.NewAddRequest(lock.dn, nil)
+	addRequest.Attribute("objectClass", []string{"applicationProcess"})
+	addRequest.Attribute("cn", []string{prefix + "-lock"})
+	addRequest.Attribute("description", []string{lock.holder})
+
+	err := conn.Add(addRequest)
+	if err == nil {
+		logger.Info("Lock", "Run lock acquired", "dn", lock.dn)
+		return lock, nil
+	}
+	if !ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultEntryAlreadyExists) {
+		return nil, fmt.Errorf("failed to create lock entry %s: %w", lock.dn, err)
+	}
+
+	entry, err := readEntry(conn, lock.dn)
+	if err != nil {
+		return nil, fmt.Errorf("lock entry %s exists but cannot be read: %w", lock.dn, err)
+	}
+	current := entry.GetEqualFoldAttributeValue("description")
+	runID, hostname, refreshed, ok := parseLockHolder(current)
+	if !ok {
+		return nil, fmt.Errorf("lock entry %s has an unrecognized holder %q; delete it if no run is active", lock.dn, current)
+	}
+	age := time.Since(refreshed)
+	if age < staleAfter {
+		return nil, fmt.Errorf("run %s on %s holds the lock %s, refreshed at %s (taken over after %s without refresh)", runID, hostname, lock.dn, refreshed.Format(time.RFC3339), staleAfter)
+	}
+
+	// Swap the holder in one modify, so only one of several runs taking over
+	// the same stale lock succeeds; the others fail with noSuchAttribute
+	logger.Warn("Lock", "Taking over stale run lock", "dn", lock.dn, "holder", runID, "host", hostname, "age", age.Round(time.Second))
+	modifyRequest := ldaplib.NewModifyRequest(lock.dn, nil)
+	modifyRequest.Delete("description", []string{current})
+	modifyRequest.Add("description", []string{lock.holder})
+	if err := conn.Modify(modifyRequest); err != nil {
+		return nil, fmt.Errorf("failed to take over stale lock %s: %w", lock.dn, err)
+	}
+	logger.Info("Lock", "Run lock acquired", "dn", lock.dn)
+	return lock, nil
+}
+
+// lockHolder returns the run ID holding the lock of prefix, or "" if there is
+// no lock or its holder has not refreshed it for staleAfter
+func lockHolder(conn *ldap.Connection, prefix, baseDN string, staleAfter time.Duration) (string, error) {
+	dn := lockDN(prefix, baseDN)
+	entry, err := readEntry(conn, dn)
+	if ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultNoSuchObject) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read lock entry %s: %w", dn, err)
+	}
+	current := entry.GetEqualFoldAttributeValue("description")
+	runID, _, refreshed, ok := parseLockHolder(current)
+	if !ok {
+		return "", fmt.Errorf("lock entry %s has an unrecognized holder %q; delete it if no run is active", dn, current)
+	}
+	if time.Since(refreshed) >= staleAfter {
+		return "", nil
+	}
+	return runID, nil
+}
+
+// refresh rewrites the time of the holder in one modify that swaps the value,
+// failing with noSuchAttribute if another run has taken the lock over
+func (l *runLock) refresh(conn *ldap.Connection) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	holder := lockHolderValue(l.runID, l.hostname, time.Now())
+	modifyRequest := ldaplib.NewModifyRequest(l.dn, nil)
+	modifyRequest.Delete("description", []string{l.holder})
+	modifyRequest.Add("description", []string{holder})
+	if err := conn.Modify(modifyRequest); err != nil {
+		return err
+	}
+	l.holder = holder
+	return nil
+}
+
+// lockLost reports whether a refresh failed because the lock entry no longer
+// names this run, rather than because the server could not be reached
+func lockLost(err error) bool {
+	return ldaplib.IsErrorAnyOf(err, ldaplib.LDAPResultNoSuchAttribute, ldaplib.LDAPResultNoSuchObject)
+}
+
+// heartbeat refreshes the lock every interval on a connection of its own,
+// opened with open, until stop is called. If the lock turns out to be lost,
+// lost is called and the heartbeat ends; a refresh that fails otherwise is
+// retried on a new connection at the next interval.
+func (l *runLock) heartbeat(open func() (*ldap.Connection, error), interval time.Duration, lost func(error)) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		var conn *ldap.Connection
+		defer func() {
+			if conn != nil {
+				conn.Close()
+			}
+		}()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			if conn == nil {
+				var err error
+				if conn, err = open(); err != nil {
+					logger.Warn("Lock", "Failed to connect to refresh the run lock", "dn", l.dn, "error", err)
+					conn = nil
+					continue
+				}
+			}
+			err := l.refresh(conn)
+			switch {
+			case err == nil:
+				logger.Debug("Lock", "Run lock refreshed", "dn", l.dn)
+			case lockLost(err):
+				logger.Error("Lock", "Run lock was taken over by another run", "dn", l.dn, "error", err)
+				lost(fmt.Errorf("%w %s: %w", errLockLost, l.dn, err))
+				return
+			default:
+				logger.Warn("Lock", "Failed to refresh the run lock", "dn", l.dn, "error", err)
+				conn.Close()
+				conn = nil
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// release deletes the lock entry if this run still holds it
+func (l *runLock) release(conn *ldap.Connection) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, err := readEntry(conn, l.dn)
+	if err != nil {
+		logger.Warn("Lock", "Failed to read run lock before release", "dn", l.dn, "error", err)
+		return
+	}
+	if current := entry.GetEqualFoldAttributeValue("description"); current != l.holder {
+		logger.Warn("Lock", "Run lock was taken over by another run, leaving it", "dn", l.dn, "holder", current)
+		return
+	}
+
+	if err := conn.Del(ldaplib.NewDelRequest(l.dn, nil)); err != nil {
+		logger.Warn("Lock", "Failed to release run lock", "dn", l.dn, "error", err)
+		return
+	}
+	logger.Info("Lock", "Run lock released", "dn", l.dn)
+}
+
+// parseLockHolder splits a lock entry description into its fields
+func parseLockHolder(description string) (runID, hostname string, refreshed time.Time, ok bool) {
+	fields := strings.Fields(description)
+	if len(fields) != 3 {
+		return "", "", time.Time{}, false
+	}
+	refreshed, err := time.Parse(time.RFC3339, fields[2])
+	if err != nil {
+		return "", "", time.Time{}, false
+	}
+	return fields[0], fields[1], refreshed, true
+}
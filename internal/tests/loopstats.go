@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"ldap-automated-actions/internal/health"
+)
+
+// loopStatsLine is the line of a --loop-stats-file for one loop iteration
+type loopStatsLine struct {
+	RunID      string           `json:"run_id"`
+	Iteration  int              `json:"iteration"`
+	Status     string           `json:"status"` // pass, fail or error
+	Error      string           `json:"error,omitempty"`
+	StartTime  time.Time        `json:"start_time"`
+	EndTime    time.Time        `json:"end_time"`
+	DurationMS int64            `json:"duration_ms"`
+	Total      int              `json:"total"`
+	Passed     int              `json:"passed"`
+	Failed     int              `json:"failed"`
+	Skipped    int              `json:"skipped"`
+	Operations []operationStats `json:"operations"`
+	Telemetry  health.Telemetry `json:"telemetry"`
+}
+
+// operationStats summarizes the latency of the executed tests of an operation
+// in one iteration, in milliseconds
+type operationStats struct {
+	Operation string  `json:"operation"`
+	Count     int     `json:"count"`
+	Failed    int     `json:"failed"`
+	MinMS     float64 `json:"min_ms"`
+	AvgMS     float64 `json:"avg_ms"`
+	P50MS     float64 `json:"p50_ms"`
+	P95MS     float64 `json:"p95_ms"`
+	P99MS     float64 `json:"p99_ms"`
+	MaxMS     float64 `json:"max_ms"`
+}
+
+// newLoopStatsLine summarizes the iteration that just finished with status
+func newLoopStatsLine(suite *TestSuite, status health.Status) loopStatsLine {
+	line := loopStatsLine{
+		RunID:      status.RunID,
+		Iteration:  status.Iteration,
+		Status:     "fail",
+		Error:      status.Error,
+		StartTime:  status.StartTime,
+		EndTime:    status.EndTime,
+		DurationMS: status.DurationMS,
+		Total:      status.Total,
+		Passed:     status.Passed,
+		Failed:     status.Failed,
+		Skipped:    status.Skipped,
+		Operations: operationLatencies(suite.Results),
+		Telemetry:  status.Telemetry,
+	}
+	switch {
+	case status.Error != "":
+		line.Status = "error"
+	case status.Healthy:
+		line.Status = "pass"
+	}
+	return line
+}
+
+// operationLatencies returns the latency summary of each operation with
+// executed tests, by operation name
+func operationLatencies(results []TestResult) []operationStats {
+	durations := make(map[string][]time.Duration)
+	failed := make(map[string]int)
+	for _, result := range results {
+		if result.Skipped {
+			continue
+		}
+		durations[result.Operation] = append(durations[result.Operation], result.Duration)
+		if !result.Passed {
+			failed[result.Operation]++
+		}
+	}
+
+	stats := make([]operationStats, 0, len(durations))
+	for operation, sorted := range durations {
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		var total time.Duration
+		for _, d := range sorted {
+			total += d
+		}
+		stats = append(stats, operationStats{
+			Operation: operation,
+			Count:     len(sorted),
+			Failed:    failed[operation],
+			MinMS:     milliseconds(sorted[0]),
+			AvgMS:     milliseconds(total / time.Duration(len(sorted))),
+			P50MS:     milliseconds(percentile(sorted, 50)),
+			P95MS:     milliseconds(percentile(sorted, 95)),
+			P99MS:     milliseconds(percentile(sorted, 99)),
+			MaxMS:     milliseconds(sorted[len(sorted)-1]),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Operation < stats[j].Operation })
+	return stats
+}
+
+// milliseconds returns d in milliseconds to the microsecond
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Round(time.Microsecond)) / float64(time.Millisecond)
+}
+
+// appendLoopStats appends line to the JSON Lines file at path. The file is
+// opened for each iteration, so the lines written so far survive a crash.
+func appendLoopStats(path string, line loopStatsLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Errorf("failed to encode loop stats: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open loop stats file: %w", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write loop stats file: %w", err)
+	}
+	return file.Close()
+}
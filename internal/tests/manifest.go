@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// manifestSuffix ends the name of the manifest of a run in the state directory
+const manifestSuffix = ".manifest.jsonl"
+
+// manifestPath returns the manifest file of a run
+func manifestPath(dir, runID string) string {
+	return filepath.Join(dir, runID+manifestSuffix)
+}
+
+// openManifest records the tracked entries of the run in its manifest as they
+// are created and returns the function that closes it at the end of the run.
+// The manifest is removed then if nothing tracked is left in the directory,
+// and kept otherwise so the entries can be deleted with cleanup
+// --from-manifest. A run killed before it ends keeps it too.
+func (r *Runner) openManifest() func() {
+	path := manifestPath(r.config.StateDir, r.suite.Metadata.RunID)
+	if err := r.tracker.OpenManifest(path); err != nil {
+		logger.Warn("TestRunner", "Failed to open the manifest of tracked entries, a killed run will leave no record of its data", "file", path, "error", err)
+		return func() {}
+	}
+
+	return func() {
+		if err := r.tracker.CloseManifest(); err != nil {
+			logger.Warn("TestRunner", "Failed to close the manifest of tracked entries", "file", path, "error", err)
+		}
+		if r.cleaned || r.tracker.Count() == 0 {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				logger.Warn("TestRunner", "Failed to remove the manifest of tracked entries", "file", path, "error", err)
+			}
+			return
+		}
+		logger.Info("TestRunner", "Tracked entries kept in the manifest, delete them with: ldap-test cleanup --from-manifest "+path)
+	}
+}
+
+// CleanupManifest deletes the entries recorded in the manifest of a run that
+// did not clean up after itself, for example because it was killed, then
+// removes the manifest and the saved progress of the run. manifest is the
+// manifest file, or the ID of a run whose manifest is in the state directory.
+func (r *Runner) CleanupManifest(manifest string) error {
+	path := manifest
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) && !strings.ContainsRune(path, filepath.Separator) {
+		path = manifestPath(r.config.StateDir, manifest)
+	}
+	m, err := tracker.ReadManifest(path)
+	if err != nil {
+		return err
+	}
+	if err := r.cleanupRecorded(path, m.TestBaseDN, m.Entries); err != nil || r.config.DryRun {
+		return err
+	}
+	return removeManifest(path)
+}
+
+// CleanupTracked deletes the entries of a file written by export_tracked, or
+// by other tooling with tracker.Tracker.Save. The file itself is kept. Such a
+// file is held to the same test OU as a manifest: its test base DN and every
+// entry are checked before anything is deleted.
+func (r *Runner) CleanupTracked(path string) error {
+	trk, err := tracker.Load(path)
+	if err != nil {
+		return err
+	}
+	return r.cleanupRecorded(path, trk.TestBaseDN(), trk.GetEntries())
+}
+
+// cleanupRecorded deletes entries recorded in file under testBaseDN, which
+// if empty is the first tracked OU that is a test OU. The test base DN must be a test OU of
+// this configuration, and entries outside it are left alone, so a damaged or
+// edited file cannot delete the base DN or anything else in the directory.
+func (r *Runner) cleanupRecorded(file, testBaseDN string, entries []tracker.TrackedEntry) error {
+	if len(entries) == 0 {
+		logger.Info("Cleanup", "No tracked entries recorded, nothing to clean up", "file", file)
+		return nil
+	}
+
+	// A run killed during setup has tracked its test OU, always first, but
+	// not yet recorded it as its test base DN. A file of other tooling may
+	// track OUs of its own before it.
+	for _, entry := range entries {
+		if testBaseDN != "" {
+			break
+		}
+		if entry.Type == tracker.TypeOU && r.checkTestOU(entry.DN) == nil {
+			testBaseDN = entry.DN
+		}
+	}
+	if testBaseDN == "" {
+		return fmt.Errorf("%s records no test base DN to clean up under", file)
+	}
+	if err := r.checkTestOU(testBaseDN); err != nil {
+		return fmt.Errorf("refusing to clean up %s: %w", file, err)
+	}
+	entries = slices.DeleteFunc(slices.Clone(entries), func(entry tracker.TrackedEntry) bool {
+		if inNamespace(entry.DN, testBaseDN) {
+			return false
+		}
+		logger.Warn("Cleanup", "Refusing to delete entry outside the run's test OU", "dn", entry.DN, "testBaseDN", testBaseDN)
+		return true
+	})
+	logger.Info("Cleanup", "Cleaning up recorded entries", "file", file, "testBaseDN", testBaseDN, "entries", len(entries))
+
+	if r.config.DryRun {
+		for _, entry := range cleanupEntries(trackerOf(entries), testBaseDN) {
+			logger.Info("Cleanup", "DRY RUN: Would delete entry", "dn", entry.DN)
+		}
+		return nil
+	}
+
+	if err := r.connect(); err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer r.cleanup()
+
+	r.tracker.Load(entries)
+	if r.config.CleanupMode == "subtree" {
+		// The test OU of the run was its own unless it was reused, and untracked
+		return PerformSubtreeCleanup(r.conn, testBaseDN, !ownsNamespace(entries, testBaseDN))
+	}
+	return PerformCleanup(r.conn, r.tracker, testBaseDN)
+}
+
+// checkTestOU returns an error unless dn is a test OU of the configuration:
+// the reuse_test_ou sandbox, or an OU directly below the base DN named after
+// test_prefix as the default test OU template names it
+func (r *Runner) checkTestOU(dn string) error {
+	if reused := r.config.ReusedTestOUDN(); reused != "" && sameDN(dn, reused) {
+		return nil
+	}
+
+	parsed, err := ldaplib.ParseDN(dn)
+	if err != nil {
+		return fmt.Errorf("invalid test base DN %q: %w", dn, err)
+	}
+	baseDN, err := ldaplib.ParseDN(r.config.BaseDN)
+	if err != nil {
+		return fmt.Errorf("invalid base DN %q: %w", r.config.BaseDN, err)
+	}
+	if len(parsed.RDNs) == 0 || !baseDN.EqualFold(&ldaplib.DN{RDNs: parsed.RDNs[1:]}) {
+		return fmt.Errorf("test base DN %s is not directly below the base DN %s", dn, r.config.BaseDN)
+	}
+	rdn := parsed.RDNs[0].Attributes
+	if len(rdn) != 1 || !strings.EqualFold(rdn[0].Type, "ou") || r.config.TestPrefix == "" || !testOUName(r.config.TestPrefix).MatchString(rdn[0].Value) {
+		return fmt.Errorf("test base DN %s is neither the reused test OU nor an OU named after the test prefix %q", dn, r.config.TestPrefix)
+	}
+	return nil
+}
+
+// trackerOf returns a tracker holding entries
+func trackerOf(entries []tracker.TrackedEntry) *tracker.Tracker {
+	trk := tracker.NewTracker()
+	trk.Load(entries)
+	return trk
+}
+
+// removeManifest deletes a manifest that is done with and, if it is in the
+// state directory, the saved progress of its run, whose data is gone
+func removeManifest(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove manifest: %w", err)
+	}
+	if runFile, ok := strings.CutSuffix(path, manifestSuffix); ok {
+		if err := os.Remove(runFile + ".json"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Warn("Cleanup", "Failed to remove the saved progress of the run", "file", runFile+".json", "error", err)
+		}
+	}
+	logger.Info("Cleanup", "Removed the manifest", "file", path)
+	return nil
+}
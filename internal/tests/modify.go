@@ -1,34 +1,84 @@
 package tests
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"fmt"
+	"math/big"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	"ldap-automated-actions/internal/ldap"
 	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
 
+	ber "github.com/go-asn1-ber/asn1-ber"
 	ldaplib "github.com/go-ldap/ldap/v3"
 )
 
 // TestModify runs all modify operation tests
-func TestModify(conn *ldap.Connection, testBaseDN string) []TestResult {
+func TestModify(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
 	logger.Info("ModifyTest", "Starting Modify operation tests")
-	results := make([]TestResult, 0)
 
-	// Test 1: Add attribute value
-	results = append(results, testModifyAddAttribute(conn, testBaseDN))
+	cases := []TestCase{
+		// Test 1: Add attribute value
+		{Name: "Modify - Add Attribute Test", Operation: "Modify", Requires: []string{FixtureTestUser}, Provides: FixtureTelephoneNumber, Run: func() TestResult { return testModifyAddAttribute(conn, testBaseDN) }},
 
-	// Test 2: Replace attribute value
-	results = append(results, testModifyReplaceAttribute(conn, testBaseDN))
+		// Test 2: Replace attribute value
+		{Name: "Modify - Replace Attribute Test", Operation: "Modify", Requires: []string{FixtureTestUser}, Run: func() TestResult { return testModifyReplaceAttribute(conn, testBaseDN) }},
 
-	// Test 3: Delete attribute value
-	results = append(results, testModifyDeleteAttribute(conn, testBaseDN))
+		// Test 3: Delete attribute value
+		{Name: "Modify - Delete Attribute Test", Operation: "Modify", Requires: []string{FixtureTelephoneNumber}, Run: func() TestResult { return testModifyDeleteAttribute(conn, testBaseDN) }},
 
-	// Test 4: Multiple modifications in one request
-	results = append(results, testModifyMultiple(conn, testBaseDN))
+		// Test 4: Multiple modifications in one request
+		{Name: "Modify - Multiple Modifications Test", Operation: "Modify", Requires: []string{FixtureTestUser}, Run: func() TestResult { return testModifyMultiple(conn, testBaseDN) }},
 
-	// Test 5: Modify non-existent entry (should fail)
-	results = append(results, testModifyNonExistent(conn, testBaseDN))
+		// Test 5: Modify non-existent entry (should fail)
+		{Name: "Modify - Non-Existent Entry Test (Negative)", Operation: "Modify", Run: func() TestResult { return testModifyNonExistent(conn, testBaseDN) }},
+
+		// Test 6: Pre-Read control returns the entry as it was before the modify
+		{Name: "Modify - Pre-Read Control Test", Operation: "Modify", Requires: []string{FixtureTestUser}, Needs: []Capability{CapabilityPreRead}, Run: func() TestResult {
+			return testModifyReadControl(conn, testBaseDN, false)
+		}},
+
+		// Test 7: Post-Read control returns the entry as it is after the modify
+		{Name: "Modify - Post-Read Control Test", Operation: "Modify", Requires: []string{FixtureTestUser}, Needs: []Capability{CapabilityPostRead}, Run: func() TestResult {
+			return testModifyReadControl(conn, testBaseDN, true)
+		}},
+
+		// Test 8: Assertion control that holds lets the modify through
+		{Name: "Modify - Assertion Control Test", Operation: "Modify", Requires: []string{FixtureTestUser}, Needs: []Capability{CapabilityAssertion}, Run: func() TestResult {
+			return testModifyAssertion(conn, testBaseDN, true)
+		}},
+
+		// Test 9: Assertion control that does not hold must stop the modify
+		{Name: "Modify - Assertion Control Failure Test (Negative)", Operation: "Modify", Requires: []string{FixtureTestUser}, Needs: []Capability{CapabilityAssertion}, Run: func() TestResult {
+			return testModifyAssertion(conn, testBaseDN, false)
+		}},
+
+		// Test 10: Operational attributes of the test user, and their update by a modify
+		{Name: "Modify - Operational Attributes Test", Operation: "Modify", Requires: []string{FixtureTestUser}, Run: func() TestResult {
+			return testModifyOperationalAttributes(conn, testBaseDN)
+		}},
+
+		// Test 11: Write a binary value of binary_attribute_size bytes and read it back
+		{Name: "Modify - Binary Attribute Round-Trip Test", Operation: "Modify", Requires: []string{FixtureTestUser}, Run: func() TestResult {
+			return testModifyBinaryAttribute(conn, testBaseDN)
+		}},
+	}
+
+	// Create the fixtures of the add suite if it did not run
+	teardown := setupFixtures(conn, testBaseDN, trk, h, "modify", cases)
+	defer teardown()
+	results := h.Execute(cases)
 
 	logger.Info("ModifyTest", "Completed Modify operation tests", "total", len(results))
 	return results
@@ -47,7 +97,7 @@ func testModifyAddAttribute(conn *ldap.Connection, testBaseDN string) TestResult
 	logger.Trace("Modify", fmt.Sprintf("Adding attribute: telephoneNumber = +1-555-0100"))
 
 	start := time.Now()
-	err := conn.GetConnection().Modify(modifyRequest)
+	err := conn.Modify(modifyRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -62,9 +112,15 @@ func testModifyAddAttribute(conn *ldap.Connection, testBaseDN string) TestResult
 		result.Message = fmt.Sprintf("Failed to add attribute: %v", err)
 		logger.LogLDAPResult("Modify", "Modify (Add)", false, -1, err.Error(), duration)
 		logger.Error("ModifyTest", result.Message)
+	} else if err := verifyAttributeValues(conn, dn, "telephoneNumber", []string{"+1-555-0100"}); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Modify returned success but read-back failed: %v", err)
+		logger.LogLDAPResult("Modify", "Modify (Add)", true, 0, "Success", duration)
+		logger.Error("ModifyTest", result.Message)
 	} else {
 		result.Passed = true
-		result.Message = "Successfully added telephoneNumber attribute"
+		result.Message = "Successfully added telephoneNumber attribute (verified by read-back)"
 		logger.LogLDAPResult("Modify", "Modify (Add)", true, 0, "Success", duration)
 		logger.Info("ModifyTest", "PASS: "+testName, "dn", dn, "duration", duration)
 	}
@@ -85,7 +141,7 @@ func testModifyReplaceAttribute(conn *ldap.Connection, testBaseDN string) TestRe
 	logger.Trace("Modify", fmt.Sprintf("Replacing attribute: mail = newemail@example.com"))
 
 	start := time.Now()
-	err := conn.GetConnection().Modify(modifyRequest)
+	err := conn.Modify(modifyRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -100,9 +156,15 @@ func testModifyReplaceAttribute(conn *ldap.Connection, testBaseDN string) TestRe
 		result.Message = fmt.Sprintf("Failed to replace attribute: %v", err)
 		logger.LogLDAPResult("Modify", "Modify (Replace)", false, -1, err.Error(), duration)
 		logger.Error("ModifyTest", result.Message)
+	} else if err := verifyAttributeValues(conn, dn, "mail", []string{"newemail@example.com"}); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Modify returned success but read-back failed: %v", err)
+		logger.LogLDAPResult("Modify", "Modify (Replace)", true, 0, "Success", duration)
+		logger.Error("ModifyTest", result.Message)
 	} else {
 		result.Passed = true
-		result.Message = "Successfully replaced mail attribute"
+		result.Message = "Successfully replaced mail attribute (verified by read-back)"
 		logger.LogLDAPResult("Modify", "Modify (Replace)", true, 0, "Success", duration)
 		logger.Info("ModifyTest", "PASS: "+testName, "dn", dn, "duration", duration)
 	}
@@ -123,7 +185,7 @@ func testModifyDeleteAttribute(conn *ldap.Connection, testBaseDN string) TestRes
 	logger.Trace("Modify", fmt.Sprintf("Deleting attribute: telephoneNumber"))
 
 	start := time.Now()
-	err := conn.GetConnection().Modify(modifyRequest)
+	err := conn.Modify(modifyRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -138,9 +200,15 @@ func testModifyDeleteAttribute(conn *ldap.Connection, testBaseDN string) TestRes
 		result.Message = fmt.Sprintf("Failed to delete attribute: %v", err)
 		logger.LogLDAPResult("Modify", "Modify (Delete)", false, -1, err.Error(), duration)
 		logger.Error("ModifyTest", result.Message)
+	} else if err := verifyAttributeValues(conn, dn, "telephoneNumber", nil); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Modify returned success but read-back failed: %v", err)
+		logger.LogLDAPResult("Modify", "Modify (Delete)", true, 0, "Success", duration)
+		logger.Error("ModifyTest", result.Message)
 	} else {
 		result.Passed = true
-		result.Message = "Successfully deleted telephoneNumber attribute"
+		result.Message = "Successfully deleted telephoneNumber attribute (verified by read-back)"
 		logger.LogLDAPResult("Modify", "Modify (Delete)", true, 0, "Success", duration)
 		logger.Info("ModifyTest", "PASS: "+testName, "dn", dn, "duration", duration)
 	}
@@ -162,7 +230,7 @@ func testModifyMultiple(conn *ldap.Connection, testBaseDN string) TestResult {
 	logger.Trace("Modify", "Modifications: Add mobile, Replace description")
 
 	start := time.Now()
-	err := conn.GetConnection().Modify(modifyRequest)
+	err := conn.Modify(modifyRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -177,9 +245,18 @@ func testModifyMultiple(conn *ldap.Connection, testBaseDN string) TestResult {
 		result.Message = fmt.Sprintf("Failed to apply multiple modifications: %v", err)
 		logger.LogLDAPResult("Modify", "Modify (Multiple)", false, -1, err.Error(), duration)
 		logger.Error("ModifyTest", result.Message)
+	} else if err := verifyModifications(conn, dn, map[string][]string{
+		"mobile":      {"+1-555-0200"},
+		"description": {"Modified test user with multiple changes"},
+	}); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Modify returned success but read-back failed: %v", err)
+		logger.LogLDAPResult("Modify", "Modify (Multiple)", true, 0, "Success", duration)
+		logger.Error("ModifyTest", result.Message)
 	} else {
 		result.Passed = true
-		result.Message = "Successfully applied multiple modifications"
+		result.Message = "Successfully applied multiple modifications (verified by read-back)"
 		logger.LogLDAPResult("Modify", "Modify (Multiple)", true, 0, "Success", duration)
 		logger.Info("ModifyTest", "PASS: "+testName, "dn", dn, "duration", duration)
 	}
@@ -187,6 +264,40 @@ func testModifyMultiple(conn *ldap.Connection, testBaseDN string) TestResult {
 	return result
 }
 
+// verifyAttributeValues reads the entry back and checks that attribute holds
+// exactly want, compared case-insensitively; an empty want means absent
+func verifyAttributeValues(conn *ldap.Connection, dn, attribute string, want []string) error {
+	return verifyModifications(conn, dn, map[string][]string{attribute: want})
+}
+
+// verifyModifications reads the entry back once and checks every attribute
+// against its expected values, so a server that reports success but drops
+// the change is caught
+func verifyModifications(conn *ldap.Connection, dn string, want map[string][]string) error {
+	entry, err := readEntry(conn, dn)
+	if err != nil {
+		return err
+	}
+
+	attributes := make([]string, 0, len(want))
+	for attribute := range want {
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+
+	for _, attribute := range attributes {
+		got := entry.GetEqualFoldAttributeValues(attribute)
+		if !slices.Equal(sortedFold(got), sortedFold(want[attribute])) {
+			if len(want[attribute]) == 0 {
+				return fmt.Errorf("%s still has %s %q", dn, attribute, got)
+			}
+			return fmt.Errorf("%s has %s %q, expected %q", dn, attribute, got, want[attribute])
+		}
+	}
+	logger.Debug("ModifyTest", "Read-back matches the intended attribute state", "dn", dn)
+	return nil
+}
+
 func testModifyNonExistent(conn *ldap.Connection, testBaseDN string) TestResult {
 	testName := "Modify - Non-Existent Entry Test (Negative)"
 	logger.Info("ModifyTest", "Running: "+testName)
@@ -199,7 +310,7 @@ func testModifyNonExistent(conn *ldap.Connection, testBaseDN string) TestResult
 	logger.Trace("Modify", "Operation: Modify (non-existent)", "dn", dn)
 
 	start := time.Now()
-	err := conn.GetConnection().Modify(modifyRequest)
+	err := conn.Modify(modifyRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -229,3 +340,508 @@ func testModifyNonExistent(conn *ldap.Connection, testBaseDN string) TestResult
 
 	return result
 }
+
+// Read entry controls (RFC 4527)
+const (
+	controlTypePreRead  = "1.3.6.1.1.13.1"
+	controlTypePostRead = "1.3.6.1.1.13.2"
+)
+
+// newReadEntryControl returns a Pre-Read or Post-Read request control for the
+// given attributes; its value is the BER of the attribute selection
+func newReadEntryControl(controlType string, attributes ...string) *ldaplib.ControlString {
+	selection := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "AttributeSelection")
+	for _, attribute := range attributes {
+		selection.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attribute, "Attribute"))
+	}
+	return ldaplib.NewControlString(controlType, true, string(selection.Bytes()))
+}
+
+// readEntryFromControls returns the entry of the Pre-Read or Post-Read
+// response control of controlType, encoded as a SearchResultEntry
+func readEntryFromControls(controls []ldaplib.Control, controlType string) (*ldaplib.Entry, error) {
+	control := ldaplib.FindControl(controls, controlType)
+	if control == nil {
+		return nil, fmt.Errorf("the response has no %s control", controlType)
+	}
+	value, ok := control.(*ldaplib.ControlString)
+	if !ok {
+		return nil, fmt.Errorf("unexpected %s control %T", controlType, control)
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(value.ControlValue))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s control value: %w", controlType, err)
+	}
+	if packet.ClassType != ber.ClassApplication || packet.Tag != ldaplib.ApplicationSearchResultEntry || len(packet.Children) != 2 {
+		return nil, fmt.Errorf("%s control value is not a search result entry", controlType)
+	}
+
+	attributes := make(map[string][]string)
+	for _, attribute := range packet.Children[1].Children {
+		if len(attribute.Children) != 2 {
+			return nil, fmt.Errorf("malformed attribute in %s control value", controlType)
+		}
+		name := attribute.Children[0].Data.String()
+		for _, v := range attribute.Children[1].Children {
+			attributes[name] = append(attributes[name], v.Data.String())
+		}
+	}
+	return ldaplib.NewEntry(packet.Children[0].Data.String(), attributes), nil
+}
+
+// testModifyReadControl replaces the title of the test user with a Pre-Read
+// or Post-Read control attached, and checks the entry snapshot of the response
+// holds the title from before or after the modify, with no read-back search.
+// The Pre-Read test first sets a known title to compare against.
+func testModifyReadControl(conn *ldap.Connection, testBaseDN string, post bool) TestResult {
+	testName, name, controlType := "Modify - Pre-Read Control Test", "Pre-Read", controlTypePreRead
+	if post {
+		testName, name, controlType = "Modify - Post-Read Control Test", "Post-Read", controlTypePostRead
+	}
+	logger.Info("ModifyTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Modify",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("ModifyTest", result.Message)
+		return result
+	}
+
+	dn := fmt.Sprintf("cn=testuser,%s", testBaseDN)
+	before := fmt.Sprintf("Read control test %08x", rand.Uint32())
+	after := fmt.Sprintf("Read control test %08x", rand.Uint32())
+
+	if !post {
+		modifyRequest := ldaplib.NewModifyRequest(dn, nil)
+		modifyRequest.Replace("title", []string{before})
+		logger.Trace("Modify", "Operation: Modify (Replace)", "dn", dn, "title", before)
+		if err := conn.Modify(modifyRequest); err != nil {
+			return fail(err, fmt.Sprintf("Failed to set the title to read back: %v", err))
+		}
+	}
+
+	modifyRequest := ldaplib.NewModifyRequest(dn, []ldaplib.Control{newReadEntryControl(controlType, "title")})
+	modifyRequest.Replace("title", []string{after})
+
+	logger.Trace("Modify", "Operation: Modify (Replace, "+name+")", "dn", dn, "title", after)
+	start := time.Now()
+	modifyResult, err := conn.ModifyWithResult(modifyRequest)
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		logger.LogLDAPResult("Modify", "Modify (read control)", false, -1, err.Error(), result.Duration)
+		return fail(err, fmt.Sprintf("Modify with %s control failed: %v", name, err))
+	}
+	logger.LogLDAPResult("Modify", "Modify (read control)", true, 0, "Success", result.Duration)
+
+	entry, err := readEntryFromControls(modifyResult.Controls, controlType)
+	if err != nil {
+		return fail(err, fmt.Sprintf("Modify succeeded but %v", err))
+	}
+	want := before
+	if post {
+		want = after
+	}
+	if got := entry.GetEqualFoldAttributeValues("title"); !slices.Equal(got, []string{want}) {
+		return fail(nil, fmt.Sprintf("%s entry has title %q, expected %q", name, got, want))
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("%s entry of %s holds the title %q", name, entry.DN, want)
+	logger.Info("ModifyTest", "PASS: "+testName, "dn", dn, "duration", result.Duration)
+	return result
+}
+
+// controlTypeAssertion is the Assertion control (RFC 4528)
+const controlTypeAssertion = "1.3.6.1.1.12"
+
+// newAssertionControl returns an Assertion control for filter; its value is
+// the BER of the filter
+func newAssertionControl(filter string) (*ldaplib.ControlString, error) {
+	packet, err := ldaplib.CompileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return ldaplib.NewControlString(controlTypeAssertion, true, string(packet.Bytes())), nil
+}
+
+// testModifyAssertion sets a known title on the test user, then replaces it
+// under an Assertion control, as an application doing optimistic concurrency
+// would. An assertion on the current title must let the modify through; an
+// assertion on another title must fail with assertionFailed and leave the
+// title as it was.
+func testModifyAssertion(conn *ldap.Connection, testBaseDN string, holds bool) TestResult {
+	testName := "Modify - Assertion Control Failure Test (Negative)"
+	if holds {
+		testName = "Modify - Assertion Control Test"
+	}
+	logger.Info("ModifyTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Modify",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("ModifyTest", result.Message)
+		return result
+	}
+
+	dn := fmt.Sprintf("cn=testuser,%s", testBaseDN)
+	current := fmt.Sprintf("Assertion test %08x", rand.Uint32())
+	modifyRequest := ldaplib.NewModifyRequest(dn, nil)
+	modifyRequest.Replace("title", []string{current})
+	logger.Trace("Modify", "Operation: Modify (Replace)", "dn", dn, "title", current)
+	if err := conn.Modify(modifyRequest); err != nil {
+		return fail(err, fmt.Sprintf("Failed to set the title to assert on: %v", err))
+	}
+
+	asserted := current
+	if !holds {
+		asserted = current + " (stale)"
+	}
+	filter := eqFilter("title", asserted)
+	control, err := newAssertionControl(filter)
+	if err != nil {
+		return fail(err, fmt.Sprintf("Failed to compile assertion filter %s: %v", filter, err))
+	}
+
+	updated := fmt.Sprintf("Assertion test %08x", rand.Uint32())
+	modifyRequest = ldaplib.NewModifyRequest(dn, []ldaplib.Control{control})
+	modifyRequest.Replace("title", []string{updated})
+
+	logger.Trace("Modify", "Operation: Modify (Replace, Assertion)", "dn", dn, "assertion", filter, "title", updated)
+	start := time.Now()
+	err = conn.Modify(modifyRequest)
+	result.Duration = time.Since(start)
+
+	if holds {
+		if err != nil {
+			logger.LogLDAPResult("Modify", "Modify (assertion)", false, -1, err.Error(), result.Duration)
+			return fail(err, fmt.Sprintf("Modify with the matching assertion %s failed: %v", filter, err))
+		}
+		logger.LogLDAPResult("Modify", "Modify (assertion)", true, 0, "Success", result.Duration)
+		if err := verifyAttributeValues(conn, dn, "title", []string{updated}); err != nil {
+			return fail(err, fmt.Sprintf("Modify with the matching assertion returned success but read-back failed: %v", err))
+		}
+		result.Passed = true
+		result.Message = fmt.Sprintf("Modify applied with the matching assertion %s (verified by read-back)", filter)
+		logger.Info("ModifyTest", "PASS: "+testName, "dn", dn, "duration", result.Duration)
+		return result
+	}
+
+	switch {
+	case err == nil:
+		logger.LogLDAPResult("Modify", "Modify (assertion)", true, 0, "Success", result.Duration)
+		return fail(nil, fmt.Sprintf("Modify with the failing assertion %s was applied", filter))
+	case !ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultAssertionFailed):
+		logger.LogLDAPResult("Modify", "Modify (assertion)", false, -1, err.Error(), result.Duration)
+		return fail(err, fmt.Sprintf("Modify with the failing assertion was rejected, but not with assertionFailed (122): %v", err))
+	}
+	logger.LogLDAPResult("Modify", "Modify (assertion)", true, int(ldaplib.LDAPResultAssertionFailed), "Assertion failed", result.Duration)
+	if err := verifyAttributeValues(conn, dn, "title", []string{current}); err != nil {
+		return fail(err, fmt.Sprintf("Modify rejected with assertionFailed, but the entry changed: %v", err))
+	}
+
+	result.Passed = true
+	result.Message = "Correctly rejected with assertionFailed (122), entry unchanged"
+	logger.Info("ModifyTest", "PASS: "+testName+" (rejected)", "duration", result.Duration)
+	return result
+}
+
+// operationalTimestampWait makes the modify of the operational attributes
+// test land in a later second than the add, as most servers record
+// timestamps to the second
+const operationalTimestampWait = 1100 * time.Millisecond
+
+// operationalSnapshot is what the operational attributes test reads of the
+// test user's metadata
+type operationalSnapshot struct {
+	created  time.Time
+	creator  string
+	modified time.Time
+	modifier string
+	idName   string // attribute of the unique ID
+	id       string // hex, as objectGUID is binary
+}
+
+// readOperationalAttributes reads the metadata of an entry with "+", or by
+// name against Active Directory, which does not support "+", and checks
+// every attribute is there and the timestamps parse
+func readOperationalAttributes(conn *ldap.Connection, dn string, names entryMetadata) (operationalSnapshot, error) {
+	attributes := []string{"+"}
+	if conn.Vendor() == ldap.VendorActiveDirectory {
+		attributes = append([]string{names.created, names.modified}, names.ids...)
+	}
+	logger.LogSearchOperation("ModifyTest", dn, "(objectClass=*)", "base", attributes)
+	entry, err := readAttributes(conn, dn, attributes...)
+	if err != nil {
+		return operationalSnapshot{}, err
+	}
+
+	var snapshot operationalSnapshot
+	timestamp := func(attribute string) (time.Time, error) {
+		value := entry.GetEqualFoldAttributeValue(attribute)
+		if value == "" {
+			return time.Time{}, fmt.Errorf("%s is missing", attribute)
+		}
+		t, err := ber.ParseGeneralizedTime([]byte(value))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s %q is not a generalized time: %w", attribute, value, err)
+		}
+		return t, nil
+	}
+	dnValue := func(attribute string) (string, error) {
+		if attribute == "" {
+			return "", nil
+		}
+		value := entry.GetEqualFoldAttributeValue(attribute)
+		if value == "" {
+			return "", fmt.Errorf("%s is missing", attribute)
+		}
+		if _, err := ldaplib.ParseDN(value); err != nil {
+			return "", fmt.Errorf("%s %q is not a DN: %w", attribute, value, err)
+		}
+		return value, nil
+	}
+
+	if snapshot.created, err = timestamp(names.created); err != nil {
+		return snapshot, err
+	}
+	if snapshot.modified, err = timestamp(names.modified); err != nil {
+		return snapshot, err
+	}
+	if snapshot.creator, err = dnValue(names.creator); err != nil {
+		return snapshot, err
+	}
+	if snapshot.modifier, err = dnValue(names.modifier); err != nil {
+		return snapshot, err
+	}
+	for _, attribute := range names.ids {
+		if values := entry.GetEqualFoldRawAttributeValues(attribute); len(values) > 0 {
+			snapshot.idName, snapshot.id = attribute, fmt.Sprintf("%x", values[0])
+			break
+		}
+	}
+	if snapshot.id == "" {
+		return snapshot, fmt.Errorf("no unique ID (%s)", strings.Join(names.ids, ", "))
+	}
+	if snapshot.modified.Before(snapshot.created) {
+		return snapshot, fmt.Errorf("%s %s is before %s %s", names.modified, snapshot.modified.Format(time.RFC3339), names.created, snapshot.created.Format(time.RFC3339))
+	}
+	return snapshot, nil
+}
+
+func testModifyOperationalAttributes(conn *ldap.Connection, testBaseDN string) TestResult {
+	testName := "Modify - Operational Attributes Test"
+	logger.Info("ModifyTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Modify",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("ModifyTest", result.Message)
+		return result
+	}
+
+	dn := fmt.Sprintf("cn=testuser,%s", testBaseDN)
+	names := entryMetadataAttributes(conn.Vendor())
+	before, err := readOperationalAttributes(conn, dn, names)
+	if err != nil {
+		return fail(err, fmt.Sprintf("Operational attributes of %s after the add: %v", dn, err))
+	}
+
+	// A value of its own, removed again below, so the other tests keep the
+	// description they expect
+	value := fmt.Sprintf("Operational attributes test %d", time.Now().UnixNano())
+	time.Sleep(operationalTimestampWait)
+
+	modifyRequest := ldaplib.NewModifyRequest(dn, nil)
+	modifyRequest.Add("description", []string{value})
+
+	logger.Trace("Modify", "Operation: Modify (Add description)", "dn", dn)
+	start := time.Now()
+	err = conn.Modify(modifyRequest)
+	result.Duration = time.Since(start)
+	if err != nil {
+		logger.LogLDAPResult("Modify", "Modify (Add)", false, -1, err.Error(), result.Duration)
+		return fail(err, fmt.Sprintf("Failed to modify %s: %v", dn, err))
+	}
+	logger.LogLDAPResult("Modify", "Modify (Add)", true, 0, "Success", result.Duration)
+	defer func() {
+		modifyRequest := ldaplib.NewModifyRequest(dn, nil)
+		modifyRequest.Delete("description", []string{value})
+		if err := conn.Modify(modifyRequest); err != nil {
+			logger.Warn("ModifyTest", "Failed to remove the description value of the test", "dn", dn, "error", err)
+		}
+	}()
+
+	after, err := readOperationalAttributes(conn, dn, names)
+	if err != nil {
+		return fail(err, fmt.Sprintf("Operational attributes of %s after the modify: %v", dn, err))
+	}
+
+	switch {
+	case !after.modified.After(before.modified):
+		return fail(nil, fmt.Sprintf("%s did not advance after the modify: %s before, %s after", names.modified, before.modified.Format(time.RFC3339), after.modified.Format(time.RFC3339)))
+	case !after.created.Equal(before.created):
+		return fail(nil, fmt.Sprintf("%s changed with the modify: %s before, %s after", names.created, before.created.Format(time.RFC3339), after.created.Format(time.RFC3339)))
+	case after.creator != before.creator:
+		return fail(nil, fmt.Sprintf("%s changed with the modify: %s before, %s after", names.creator, before.creator, after.creator))
+	case after.id != before.id:
+		return fail(nil, fmt.Sprintf("%s changed with the modify", after.idName))
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("%s, %s and %s present; %s advanced from %s to %s with the modify",
+		names.created, names.modified, after.idName, names.modified, before.modified.Format(time.RFC3339), after.modified.Format(time.RFC3339))
+	if names.creator != "" {
+		result.Message += fmt.Sprintf(", %s %s and %s %s", names.creator, after.creator, names.modifier, after.modifier)
+	}
+	logger.Info("ModifyTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// binaryPaddingOID marks the extension that pads the certificate of the binary
+// round-trip test to its size; the arc is the example enterprise number of
+// RFC 5612
+var binaryPaddingOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 32473, 1}
+
+// binaryValue returns the value the binary round-trip test writes to
+// attribute: for a certificate attribute a self-signed certificate, which
+// servers may check the syntax of, padded to about size bytes with an
+// extension of random bytes; for any other attribute size random bytes
+func binaryValue(attribute string, size int) ([]byte, error) {
+	name, _, _ := strings.Cut(attribute, ";")
+	if !strings.EqualFold(name, "userCertificate") && !strings.EqualFold(name, "cACertificate") {
+		value := make([]byte, size)
+		if _, err := cryptorand.Read(value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	certificate := func(padding int) ([]byte, error) {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: "ldap-test binary round-trip"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(24 * time.Hour),
+		}
+		if padding > 0 {
+			value := make([]byte, padding)
+			if _, err := cryptorand.Read(value); err != nil {
+				return nil, err
+			}
+			template.ExtraExtensions = []pkix.Extension{{Id: binaryPaddingOID, Value: value}}
+		}
+		return x509.CreateCertificate(cryptorand.Reader, template, template, &key.PublicKey, key)
+	}
+
+	// The unpadded certificate gives the size of what is not padding; the
+	// extension adds a few bytes of its own
+	unpadded, err := certificate(0)
+	if err != nil {
+		return nil, err
+	}
+	if size <= len(unpadded)+28 {
+		return unpadded, nil
+	}
+	return certificate(size - len(unpadded) - 28)
+}
+
+func testModifyBinaryAttribute(conn *ldap.Connection, testBaseDN string) TestResult {
+	testName := "Modify - Binary Attribute Round-Trip Test"
+	logger.Info("ModifyTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Modify",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("ModifyTest", result.Message)
+		return result
+	}
+
+	cfg := conn.GetConfig()
+	attribute := cfg.BinaryAttribute
+	value, err := binaryValue(attribute, cfg.BinaryAttributeSize)
+	if err != nil {
+		return fail(err, fmt.Sprintf("Failed to generate the %s value: %v", attribute, err))
+	}
+
+	dn := fmt.Sprintf("cn=testuser,%s", testBaseDN)
+	modifyRequest := ldaplib.NewModifyRequest(dn, nil)
+	modifyRequest.Replace(attribute, []string{string(value)})
+
+	logger.Trace("Modify", "Operation: Modify (Replace binary)", "dn", dn, "attribute", attribute, "bytes", len(value))
+	start := time.Now()
+	err = conn.Modify(modifyRequest)
+	if err != nil {
+		result.Duration = time.Since(start)
+		logger.LogLDAPResult("Modify", "Modify (Replace)", false, -1, err.Error(), result.Duration)
+		if isSchemaMissing(err) {
+			logger.Warn("ModifyTest", "SKIP: "+testName, "reason", "attribute not allowed", "attribute", attribute, "error", err)
+			result.Skipped = true
+			result.Message = fmt.Sprintf("Skipped: the schema does not allow %s on the test user: %v", attribute, err)
+			return result
+		}
+		return fail(err, fmt.Sprintf("Failed to write %d bytes of %s: %v (the server may limit the size of values or requests, e.g. nsslapd-maxbersize on 389 DS or sockbuf_max_incoming_auth on OpenLDAP)", len(value), attribute, err))
+	}
+	logger.LogLDAPResult("Modify", "Modify (Replace)", true, 0, "Success", time.Since(start))
+
+	// The test user keeps no large value the other suites would then transfer
+	defer func() {
+		modifyRequest := ldaplib.NewModifyRequest(dn, nil)
+		modifyRequest.Delete(attribute, nil)
+		if err := conn.Modify(modifyRequest); err != nil {
+			logger.Warn("ModifyTest", "Failed to remove the binary value of the test", "dn", dn, "attribute", attribute, "error", err)
+		}
+	}()
+
+	entry, err := readAttributes(conn, dn, attribute)
+	result.Duration = time.Since(start)
+	if err != nil {
+		return fail(err, fmt.Sprintf("Modify returned success but read-back failed: %v", err))
+	}
+
+	got := entry.GetEqualFoldRawAttributeValues(attribute)
+	switch {
+	case len(got) != 1:
+		return fail(nil, fmt.Sprintf("Read back %d values of %s, want 1", len(got), attribute))
+	case !bytes.Equal(got[0], value):
+		offset := 0
+		for offset < len(got[0]) && offset < len(value) && got[0][offset] == value[offset] {
+			offset++
+		}
+		return fail(nil, fmt.Sprintf("Read back %d bytes of %s, wrote %d; they differ from byte %d", len(got[0]), attribute, len(value), offset))
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Wrote and read back %d bytes of %s, byte for byte identical", len(value), attribute)
+	logger.Info("ModifyTest", "PASS: "+testName, "bytes", len(value), "duration", result.Duration)
+	return result
+}
@@ -12,21 +12,33 @@ import (
 )
 
 // TestModifyDN runs all modify DN operation tests
-func TestModifyDN(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) []TestResult {
+func TestModifyDN(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
 	logger.Info("ModifyDNTest", "Starting Modify DN operation tests")
-	results := make([]TestResult, 0)
 
-	// Test 1: Rename entry (change RDN)
-	results = append(results, testRenameEntry(conn, testBaseDN, trk))
+	cases := []TestCase{
+		// Test 1: Rename entry (change RDN)
+		{Name: "Modify DN - Rename Entry Test", Operation: "ModifyDN", Provides: FixtureRenamedUser, Run: func() TestResult { return testRenameEntry(conn, testBaseDN, trk) }},
 
-	// Test 2: Move entry to different OU
-	results = append(results, testMoveEntry(conn, testBaseDN, trk))
+		// Test 2: Move entry to different OU
+		{Name: "Modify DN - Move Entry Test", Operation: "ModifyDN", Provides: FixtureTargetOU, Run: func() TestResult { return testMoveEntry(conn, testBaseDN, trk) }},
 
-	// Test 3: Rename and move entry
-	results = append(results, testRenameAndMove(conn, testBaseDN, trk))
+		// Test 3: Rename and move entry
+		{Name: "Modify DN - Rename and Move Entry Test", Operation: "ModifyDN", Requires: []string{FixtureTargetOU}, Run: func() TestResult { return testRenameAndMove(conn, testBaseDN, trk) }},
 
-	// Test 4: Try to rename to existing DN (should fail)
-	results = append(results, testRenameToExisting(conn, testBaseDN))
+		// Test 4: Try to rename to existing DN (should fail)
+		{Name: "Modify DN - Rename to Existing DN Test (Negative)", Operation: "ModifyDN", Requires: []string{FixtureTestUser, FixtureRenamedUser}, Run: func() TestResult { return testRenameToExisting(conn, testBaseDN) }},
+
+		// Test 5: Rename an OU and check that its child moved with it
+		{Name: "Modify DN - Rename Subtree Test", Operation: "ModifyDN", Run: func() TestResult { return testRenameSubtree(conn, testBaseDN, trk) }},
+
+		// Test 6: Rename a group member and report whether the group follows
+		{Name: "Modify DN - Group Member Reference Test", Operation: "ModifyDN", Run: func() TestResult { return testRenameGroupMember(conn, testBaseDN, trk) }},
+	}
+
+	// Create the fixtures of the add suite if it did not run
+	teardown := setupFixtures(conn, testBaseDN, trk, h, "modifydn", cases)
+	defer teardown()
+	results := h.Execute(cases)
 
 	logger.Info("ModifyDNTest", "Completed Modify DN operation tests", "total", len(results))
 	return results
@@ -46,7 +58,7 @@ func testRenameEntry(conn *ldap.Connection, testBaseDN string, trk *tracker.Trac
 	addRequest.Attribute("cn", []string{oldCN})
 	addRequest.Attribute("sn", []string{"RenameTest"})
 
-	err := conn.GetConnection().Add(addRequest)
+	err := createEntry(conn, addRequest)
 	if err != nil {
 		logger.Error("ModifyDNTest", "Failed to create test entry for rename", "error", err)
 		return TestResult{
@@ -63,10 +75,13 @@ func testRenameEntry(conn *ldap.Connection, testBaseDN string, trk *tracker.Trac
 	newRDN := "cn=renamed-user"
 	logger.Trace("ModifyDN", "Operation: ModifyDN (Rename)", "oldDN", oldDN, "newRDN", newRDN)
 
+	if err := removeStale(conn, fmt.Sprintf("%s,%s", newRDN, testBaseDN)); err != nil {
+		logger.Warn("ModifyDNTest", "Failed to remove stale rename target", "error", err)
+	}
 	modifyDNRequest := ldaplib.NewModifyDNRequest(oldDN, newRDN, true, "")
 
 	start := time.Now()
-	err = conn.GetConnection().ModifyDN(modifyDNRequest)
+	err = conn.ModifyDN(modifyDNRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -83,13 +98,21 @@ func testRenameEntry(conn *ldap.Connection, testBaseDN string, trk *tracker.Trac
 		logger.Error("ModifyDNTest", result.Message)
 	} else {
 		newDN := fmt.Sprintf("cn=renamed-user,%s", testBaseDN)
-		result.Passed = true
-		result.Message = fmt.Sprintf("Successfully renamed entry from %s to %s", oldDN, newDN)
 		logger.LogLDAPResult("ModifyDN", "ModifyDN", true, 0, "Success", duration)
-		logger.Info("ModifyDNTest", "PASS: "+testName, "newDN", newDN, "duration", duration)
 
 		// Update tracker with new DN
 		trk.Track(newDN, tracker.TypeUser)
+
+		if err := verifyMoved(conn, oldDN, newDN); err != nil {
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Rename returned success but read-back failed: %v", err)
+			logger.Error("ModifyDNTest", result.Message)
+		} else {
+			result.Passed = true
+			result.Message = fmt.Sprintf("Successfully renamed entry from %s to %s (verified by read-back)", oldDN, newDN)
+			logger.Info("ModifyDNTest", "PASS: "+testName, "newDN", newDN, "duration", duration)
+		}
 	}
 
 	return result
@@ -107,7 +130,7 @@ func testMoveEntry(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracke
 	addRequest.Attribute("objectClass", []string{"organizationalUnit"})
 	addRequest.Attribute("ou", []string{targetOU})
 
-	err := conn.GetConnection().Add(addRequest)
+	err := createEntry(conn, addRequest)
 	if err != nil {
 		logger.Warn("ModifyDNTest", "Failed to create target OU (may already exist)", "error", err)
 	} else {
@@ -123,7 +146,7 @@ func testMoveEntry(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracke
 	addRequest.Attribute("cn", []string{oldCN})
 	addRequest.Attribute("sn", []string{"MoveTest"})
 
-	err = conn.GetConnection().Add(addRequest)
+	err = createEntry(conn, addRequest)
 	if err != nil {
 		logger.Error("ModifyDNTest", "Failed to create test entry for move", "error", err)
 		return TestResult{
@@ -140,10 +163,13 @@ func testMoveEntry(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracke
 	newRDN := fmt.Sprintf("cn=%s", oldCN) // Keep same RDN
 	logger.Trace("ModifyDN", "Operation: ModifyDN (Move)", "oldDN", oldDN, "newSuperior", targetOUDN)
 
+	if err := removeStale(conn, fmt.Sprintf("%s,%s", newRDN, targetOUDN)); err != nil {
+		logger.Warn("ModifyDNTest", "Failed to remove stale rename target", "error", err)
+	}
 	modifyDNRequest := ldaplib.NewModifyDNRequest(oldDN, newRDN, true, targetOUDN)
 
 	start := time.Now()
-	err = conn.GetConnection().ModifyDN(modifyDNRequest)
+	err = conn.ModifyDN(modifyDNRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -160,13 +186,21 @@ func testMoveEntry(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracke
 		logger.Error("ModifyDNTest", result.Message)
 	} else {
 		newDN := fmt.Sprintf("cn=%s,%s", oldCN, targetOUDN)
-		result.Passed = true
-		result.Message = fmt.Sprintf("Successfully moved entry from %s to %s", oldDN, newDN)
 		logger.LogLDAPResult("ModifyDN", "ModifyDN", true, 0, "Success", duration)
-		logger.Info("ModifyDNTest", "PASS: "+testName, "newDN", newDN, "duration", duration)
 
 		// Update tracker
 		trk.Track(newDN, tracker.TypeUser)
+
+		if err := verifyMoved(conn, oldDN, newDN); err != nil {
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Move returned success but read-back failed: %v", err)
+			logger.Error("ModifyDNTest", result.Message)
+		} else {
+			result.Passed = true
+			result.Message = fmt.Sprintf("Successfully moved entry from %s to %s (verified by read-back)", oldDN, newDN)
+			logger.Info("ModifyDNTest", "PASS: "+testName, "newDN", newDN, "duration", duration)
+		}
 	}
 
 	return result
@@ -189,7 +223,7 @@ func testRenameAndMove(conn *ldap.Connection, testBaseDN string, trk *tracker.Tr
 	addRequest.Attribute("cn", []string{oldCN})
 	addRequest.Attribute("sn", []string{"RenameMoveTest"})
 
-	err := conn.GetConnection().Add(addRequest)
+	err := createEntry(conn, addRequest)
 	if err != nil {
 		logger.Error("ModifyDNTest", "Failed to create test entry", "error", err)
 		return TestResult{
@@ -206,10 +240,13 @@ func testRenameAndMove(conn *ldap.Connection, testBaseDN string, trk *tracker.Tr
 	newRDN := "cn=renamed-moved-user"
 	logger.Trace("ModifyDN", "Operation: ModifyDN (Rename+Move)", "oldDN", oldDN, "newRDN", newRDN, "newSuperior", targetOUDN)
 
+	if err := removeStale(conn, fmt.Sprintf("%s,%s", newRDN, targetOUDN)); err != nil {
+		logger.Warn("ModifyDNTest", "Failed to remove stale rename target", "error", err)
+	}
 	modifyDNRequest := ldaplib.NewModifyDNRequest(oldDN, newRDN, true, targetOUDN)
 
 	start := time.Now()
-	err = conn.GetConnection().ModifyDN(modifyDNRequest)
+	err = conn.ModifyDN(modifyDNRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -226,13 +263,21 @@ func testRenameAndMove(conn *ldap.Connection, testBaseDN string, trk *tracker.Tr
 		logger.Error("ModifyDNTest", result.Message)
 	} else {
 		newDN := fmt.Sprintf("cn=renamed-moved-user,%s", targetOUDN)
-		result.Passed = true
-		result.Message = fmt.Sprintf("Successfully renamed and moved entry from %s to %s", oldDN, newDN)
 		logger.LogLDAPResult("ModifyDN", "ModifyDN", true, 0, "Success", duration)
-		logger.Info("ModifyDNTest", "PASS: "+testName, "newDN", newDN, "duration", duration)
 
 		// Update tracker
 		trk.Track(newDN, tracker.TypeUser)
+
+		if err := verifyMoved(conn, oldDN, newDN); err != nil {
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Rename and move returned success but read-back failed: %v", err)
+			logger.Error("ModifyDNTest", result.Message)
+		} else {
+			result.Passed = true
+			result.Message = fmt.Sprintf("Successfully renamed and moved entry from %s to %s (verified by read-back)", oldDN, newDN)
+			logger.Info("ModifyDNTest", "PASS: "+testName, "newDN", newDN, "duration", duration)
+		}
 	}
 
 	return result
@@ -251,7 +296,7 @@ func testRenameToExisting(conn *ldap.Connection, testBaseDN string) TestResult {
 	modifyDNRequest := ldaplib.NewModifyDNRequest(oldDN, newRDN, true, "")
 
 	start := time.Now()
-	err := conn.GetConnection().ModifyDN(modifyDNRequest)
+	err := conn.ModifyDN(modifyDNRequest)
 	duration := time.Since(start)
 
 	result := TestResult{
@@ -280,3 +325,210 @@ func testRenameToExisting(conn *ldap.Connection, testBaseDN string) TestResult {
 
 	return result
 }
+
+func testRenameSubtree(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) TestResult {
+	testName := "Modify DN - Rename Subtree Test"
+	logger.Info("ModifyDNTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "ModifyDN",
+	}
+
+	// Create an OU with one child entry
+	oldOUDN := fmt.Sprintf("ou=subtree-ou,%s", testBaseDN)
+	oldChildDN := fmt.Sprintf("cn=subtree-child,%s", oldOUDN)
+
+	addRequest := ldaplib.NewAddRequest(oldOUDN, nil)
+	addRequest.Attribute("objectClass", []string{"organizationalUnit"})
+	addRequest.Attribute("ou", []string{"subtree-ou"})
+	if err := createEntry(conn, addRequest); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = "Failed to create test OU"
+		logger.Error("ModifyDNTest", "Failed to create test OU for subtree rename", "error", err)
+		return result
+	}
+	trk.Track(oldOUDN, tracker.TypeOU)
+
+	addRequest = ldaplib.NewAddRequest(oldChildDN, nil)
+	addRequest.Attribute("objectClass", []string{"inetOrgPerson"})
+	addRequest.Attribute("cn", []string{"subtree-child"})
+	addRequest.Attribute("sn", []string{"SubtreeTest"})
+	if err := createEntry(conn, addRequest); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = "Failed to create child entry"
+		logger.Error("ModifyDNTest", "Failed to create child entry for subtree rename", "error", err)
+		return result
+	}
+	trk.Track(oldChildDN, tracker.TypeUser)
+
+	// Rename the non-leaf OU
+	newRDN := "ou=renamed-subtree-ou"
+	newOUDN := fmt.Sprintf("%s,%s", newRDN, testBaseDN)
+	newChildDN := fmt.Sprintf("cn=subtree-child,%s", newOUDN)
+	logger.Trace("ModifyDN", "Operation: ModifyDN (Subtree)", "oldDN", oldOUDN, "newRDN", newRDN)
+
+	if err := removeStale(conn, newOUDN); err != nil {
+		logger.Warn("ModifyDNTest", "Failed to remove stale rename target", "error", err)
+	}
+	start := time.Now()
+	err := conn.ModifyDN(ldaplib.NewModifyDNRequest(oldOUDN, newRDN, true, ""))
+	result.Duration = time.Since(start)
+
+	if ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultNotAllowedOnNonLeaf) {
+		logger.LogLDAPResult("ModifyDN", "ModifyDN", false, int(ldaplib.LDAPResultNotAllowedOnNonLeaf), "Not allowed on non-leaf", result.Duration)
+		logger.Warn("ModifyDNTest", "SKIP: "+testName, "reason", "server does not rename non-leaf entries")
+		result.Skipped = true
+		result.Message = "Skipped: server does not rename non-leaf entries (notAllowedOnNonLeaf)"
+		return result
+	}
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to rename OU with children: %v", err)
+		logger.LogLDAPResult("ModifyDN", "ModifyDN", false, -1, err.Error(), result.Duration)
+		logger.Error("ModifyDNTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("ModifyDN", "ModifyDN", true, 0, "Success", result.Duration)
+	trk.Rename(oldOUDN, newOUDN)
+	trk.Rename(oldChildDN, newChildDN)
+
+	if err := verifyMoved(conn, oldOUDN, newOUDN); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Rename returned success but read-back failed: %v", err)
+		logger.Error("ModifyDNTest", result.Message)
+		return result
+	}
+	if err := verifyMoved(conn, oldChildDN, newChildDN); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Child entry did not move with its parent: %v", err)
+		logger.Error("ModifyDNTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Renamed %s to %s; its child moved with it", oldOUDN, newOUDN)
+	logger.Info("ModifyDNTest", "PASS: "+testName, "newDN", newOUDN, "duration", result.Duration)
+	return result
+}
+
+func testRenameGroupMember(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) TestResult {
+	testName := "Modify DN - Group Member Reference Test"
+	logger.Info("ModifyDNTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "ModifyDN",
+	}
+
+	// Create a user and a group that references it
+	oldDN := fmt.Sprintf("cn=refint-user,%s", testBaseDN)
+	groupDN := fmt.Sprintf("cn=refint-group,%s", testBaseDN)
+
+	addRequest := ldaplib.NewAddRequest(oldDN, nil)
+	addRequest.Attribute("objectClass", []string{"inetOrgPerson"})
+	addRequest.Attribute("cn", []string{"refint-user"})
+	addRequest.Attribute("sn", []string{"RefintTest"})
+	if err := createEntry(conn, addRequest); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = "Failed to create test entry"
+		logger.Error("ModifyDNTest", "Failed to create test entry for member rename", "error", err)
+		return result
+	}
+	trk.Track(oldDN, tracker.TypeUser)
+
+	addRequest = ldaplib.NewAddRequest(groupDN, nil)
+	addRequest.Attribute("objectClass", []string{"groupOfNames"})
+	addRequest.Attribute("cn", []string{"refint-group"})
+	addRequest.Attribute("member", []string{oldDN})
+	if err := createEntry(conn, addRequest); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = "Failed to create test group"
+		logger.Error("ModifyDNTest", "Failed to create test group for member rename", "error", err)
+		return result
+	}
+	trk.Track(groupDN, tracker.TypeGroup)
+
+	// Rename the member
+	newRDN := "cn=refint-renamed-user"
+	newDN := fmt.Sprintf("%s,%s", newRDN, testBaseDN)
+	logger.Trace("ModifyDN", "Operation: ModifyDN (Member)", "oldDN", oldDN, "newRDN", newRDN)
+
+	if err := removeStale(conn, newDN); err != nil {
+		logger.Warn("ModifyDNTest", "Failed to remove stale rename target", "error", err)
+	}
+	start := time.Now()
+	err := conn.ModifyDN(ldaplib.NewModifyDNRequest(oldDN, newRDN, true, ""))
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to rename group member: %v", err)
+		logger.LogLDAPResult("ModifyDN", "ModifyDN", false, -1, err.Error(), result.Duration)
+		logger.Error("ModifyDNTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("ModifyDN", "ModifyDN", true, 0, "Success", result.Duration)
+	trk.Rename(oldDN, newDN)
+
+	if err := verifyMoved(conn, oldDN, newDN); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Rename returned success but read-back failed: %v", err)
+		logger.Error("ModifyDNTest", result.Message)
+		return result
+	}
+
+	// Either outcome is valid; which one depends on referential integrity support
+	group, err := readEntry(conn, groupDN)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to read group after rename: %v", err)
+		logger.Error("ModifyDNTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	switch {
+	case hasDNValue(group, "member", newDN):
+		result.Message = "Group member reference was updated to the new DN (referential integrity enforced)"
+	case hasDNValue(group, "member", oldDN):
+		result.Message = "Group member still references the old DN (no referential integrity)"
+	default:
+		result.Message = "Group member reference was removed instead of updated"
+	}
+	logger.Info("ModifyDNTest", "PASS: "+testName, "behavior", result.Message, "duration", result.Duration)
+	return result
+}
+
+// verifyMoved checks that a renamed or moved entry resolves at its new DN and
+// no longer at its old one
+func verifyMoved(conn *ldap.Connection, oldDN, newDN string) error {
+	if _, err := readEntry(conn, newDN); err != nil {
+		return fmt.Errorf("new DN does not resolve: %w", err)
+	}
+	return verifyAbsent(conn, oldDN)
+}
+
+// hasDNValue checks a DN-valued attribute, ignoring case and spacing differences
+func hasDNValue(entry *ldaplib.Entry, attribute, dn string) bool {
+	want, err := ldaplib.ParseDN(dn)
+	if err != nil {
+		return hasValue(entry, attribute, dn)
+	}
+	for _, value := range entry.GetEqualFoldAttributeValues(attribute) {
+		if got, err := ldaplib.ParseDN(value); err == nil && got.EqualFold(want) {
+			return true
+		}
+	}
+	return false
+}
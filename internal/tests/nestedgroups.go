@@ -0,0 +1,534 @@
+package tests
+
+import (
+	"fmt"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// FixtureNestedGroups is the group tree of the groups suite
+const FixtureNestedGroups = "nested groups"
+
+// inChainOID is LDAP_MATCHING_RULE_IN_CHAIN, Active Directory's matching rule
+// that follows member links transitively
+const inChainOID = "1.2.840.113556.1.4.1941"
+
+// nestedGroupsMaxEntries bounds the entries a nested resolution reads, in case
+// a member loops out of the test OU into a large group
+const nestedGroupsMaxEntries = 100
+
+// nestedGroups holds the DNs of the group tree of the groups suite:
+//
+//	top    member: outer
+//	outer  member: inner, user 3
+//	inner  member: user 1, user 2
+type nestedGroups struct {
+	users []string
+	inner string
+	outer string
+	top   string
+}
+
+func newNestedGroups(testBaseDN string) *nestedGroups {
+	return &nestedGroups{
+		users: []string{
+			fmt.Sprintf("cn=nested-user-1,%s", testBaseDN),
+			fmt.Sprintf("cn=nested-user-2,%s", testBaseDN),
+			fmt.Sprintf("cn=nested-user-3,%s", testBaseDN),
+		},
+		inner: fmt.Sprintf("cn=nested-inner,%s", testBaseDN),
+		outer: fmt.Sprintf("cn=nested-outer,%s", testBaseDN),
+		top:   fmt.Sprintf("cn=nested-top,%s", testBaseDN),
+	}
+}
+
+// TestNestedGroups runs the group membership semantics tests: a tree of nested
+// groups whose membership is resolved by following member values search by
+// search, by memberOf where the server maintains it and by the in-chain
+// matching rule against Active Directory, each checked against the expected
+// membership sets
+func TestNestedGroups(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
+	logger.Info("GroupsTest", "Starting nested group membership tests")
+
+	g := newNestedGroups(testBaseDN)
+	results := h.Execute([]TestCase{
+		// Test 1: Build the group tree
+		{Name: "Groups - Build Nested Groups Test", Operation: "Groups", Provides: FixtureNestedGroups, Run: func() TestResult {
+			return testNestedGroupsBuild(conn, g, trk)
+		}},
+
+		// Test 2: Add a member to a nested group and remove it again
+		{Name: "Groups - Add and Remove Member Test", Operation: "Groups", Requires: []string{FixtureNestedGroups}, Run: func() TestResult {
+			return testNestedGroupsAddRemove(conn, g)
+		}},
+
+		// Test 3: memberOf of the members (if maintained)
+		{Name: "Groups - memberOf Test", Operation: "Groups", Requires: []string{FixtureNestedGroups}, Run: func() TestResult {
+			return testNestedGroupsMemberOf(conn, g)
+		}},
+
+		// Test 4: Resolve the members of the top group by repeated searches
+		{Name: "Groups - Resolve Nested Membership Test", Operation: "Groups", Requires: []string{FixtureNestedGroups}, Run: func() TestResult {
+			return testNestedGroupsResolve(conn, "Groups - Resolve Nested Membership Test", g.top, g.users, []string{g.outer, g.inner})
+		}},
+
+		// Test 5: Resolve the same sets with the in-chain matching rule (Active Directory)
+		{Name: "Groups - Transitive Matching Rule Test", Operation: "Groups", Requires: []string{FixtureNestedGroups}, Run: func() TestResult {
+			return testNestedGroupsInChain(conn, testBaseDN, "Groups - Transitive Matching Rule Test", g.top, append([]string{g.outer, g.inner}, g.users...), g.users[0], []string{g.inner, g.outer, g.top})
+		}},
+
+		// Test 6: Remove the inner group from the outer one; its users leave the tree
+		{Name: "Groups - Remove Nested Group Test", Operation: "Groups", Requires: []string{FixtureNestedGroups}, Run: func() TestResult {
+			return testNestedGroupsRemoveNested(conn, testBaseDN, g)
+		}},
+	})
+
+	logger.Info("GroupsTest", "Completed nested group membership tests", "total", len(results))
+	return results
+}
+
+// nestedGroupClass is the object class of the suite's groups: group on
+// Active Directory, where memberOf and the in-chain rule work on security
+// groups, groupOfNames elsewhere
+func nestedGroupClass(vendor ldap.Vendor) string {
+	if vendor == ldap.VendorActiveDirectory {
+		return "group"
+	}
+	return "groupOfNames"
+}
+
+func testNestedGroupsBuild(conn *ldap.Connection, g *nestedGroups, trk *tracker.Tracker) TestResult {
+	testName := "Groups - Build Nested Groups Test"
+	logger.Info("GroupsTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Groups",
+	}
+
+	for _, dn := range g.users {
+		if err := createGroupTestUser(conn, dn, trk); err != nil {
+			result.Passed = false
+			result.Error = err
+			result.Message = "Failed to create test entry"
+			logger.Error("GroupsTest", "Failed to create member entry", "dn", dn, "error", err)
+			return result
+		}
+	}
+
+	// Inner groups first: a groupOfNames needs its members when it is added
+	class := nestedGroupClass(conn.Vendor())
+	groups := []struct {
+		cn      string
+		dn      string
+		members []string
+	}{
+		{"nested-inner", g.inner, g.users[:2]},
+		{"nested-outer", g.outer, []string{g.inner, g.users[2]}},
+		{"nested-top", g.top, []string{g.outer}},
+	}
+
+	start := time.Now()
+	for _, group := range groups {
+		addRequest := ldaplib.NewAddRequest(group.dn, nil)
+		addRequest.Attribute("objectClass", []string{class})
+		addRequest.Attribute("cn", []string{group.cn})
+		addRequest.Attribute("member", group.members)
+
+		logger.Trace("Groups", "Operation: Add (group)", "dn", group.dn, "members", len(group.members))
+		if err := createEntry(conn, addRequest); err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Failed to create %s %s: %v", class, group.dn, err)
+			logger.Error("GroupsTest", result.Message)
+			return result
+		}
+		trk.Track(group.dn, tracker.TypeGroup)
+
+		members, err := directMembers(conn, group.dn)
+		if err == nil && !sameDNSet(members, group.members) {
+			err = fmt.Errorf("member of %s is %v, want %v", group.dn, members, group.members)
+		}
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Group created but read-back failed: %v", err)
+			logger.Error("GroupsTest", result.Message)
+			return result
+		}
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Created %d users and %d nested %s groups (verified by read-back)", len(g.users), len(groups), class)
+	logger.Info("GroupsTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+func testNestedGroupsAddRemove(conn *ldap.Connection, g *nestedGroups) TestResult {
+	testName := "Groups - Add and Remove Member Test"
+	logger.Info("GroupsTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Groups",
+	}
+
+	// User 3 joins the inner group directly, on top of its nested membership
+	member := g.users[2]
+	start := time.Now()
+
+	modifyRequest := ldaplib.NewModifyRequest(g.inner, nil)
+	modifyRequest.Add("member", []string{member})
+	logger.Trace("Groups", "Operation: Modify (Add member)", "dn", g.inner, "member", member)
+	err := conn.Modify(modifyRequest)
+	if err == nil {
+		err = checkDirectMembers(conn, g.inner, []string{g.users[0], g.users[1], member})
+	}
+	if err == nil {
+		modifyRequest = ldaplib.NewModifyRequest(g.inner, nil)
+		modifyRequest.Delete("member", []string{member})
+		logger.Trace("Groups", "Operation: Modify (Remove member)", "dn", g.inner, "member", member)
+		err = conn.Modify(modifyRequest)
+	}
+	if err == nil {
+		err = checkDirectMembers(conn, g.inner, g.users[:2])
+	}
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Member update failed: %v", err)
+		logger.Error("GroupsTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Added %s to %s and removed it again (member set verified by read-back after each change)", member, g.inner)
+	logger.Info("GroupsTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+func testNestedGroupsMemberOf(conn *ldap.Connection, g *nestedGroups) TestResult {
+	testName := "Groups - memberOf Test"
+	logger.Info("GroupsTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Groups",
+	}
+
+	// Some servers list only the direct groups, others (OpenDJ's isMemberOf,
+	// for one) every group the entry is in through nesting as well
+	expected := []struct {
+		dn         string
+		direct     []string
+		transitive []string
+	}{
+		{g.users[0], []string{g.inner}, []string{g.inner, g.outer, g.top}},
+		{g.users[2], []string{g.outer}, []string{g.outer, g.top}},
+		{g.inner, []string{g.outer}, []string{g.outer, g.top}},
+	}
+
+	memberOf := memberOfAttribute(conn.Vendor())
+	start := time.Now()
+	transitive := false
+	for i, want := range expected {
+		entry, err := readAttributes(conn, want.dn, memberOf)
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Failed to read %s: %v", memberOf, err)
+			logger.Error("GroupsTest", result.Message)
+			return result
+		}
+
+		got := entry.GetEqualFoldAttributeValues(memberOf)
+		if i == 0 && len(got) == 0 {
+			logger.Warn("GroupsTest", "SKIP: "+testName, "reason", memberOf+" not maintained")
+			result.Skipped = true
+			result.Message = fmt.Sprintf("Skipped: server does not maintain %s (no memberOf overlay or plugin)", memberOf)
+			return result
+		}
+		if !containsDNs(got, want.direct) || !containsDNs(want.transitive, got) {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Message = fmt.Sprintf("%s of %s is %v, want %v or %v", memberOf, want.dn, got, want.direct, want.transitive)
+			logger.Error("GroupsTest", result.Message)
+			return result
+		}
+		transitive = transitive || len(got) > len(want.direct)
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	if transitive {
+		result.Message = fmt.Sprintf("%s lists the direct and the nested groups of users and groups", memberOf)
+	} else {
+		result.Message = fmt.Sprintf("%s lists the direct groups of users and groups", memberOf)
+	}
+	logger.Info("GroupsTest", "PASS: "+testName, "transitive", transitive, "duration", result.Duration)
+	return result
+}
+
+func testNestedGroupsResolve(conn *ldap.Connection, testName, groupDN string, wantUsers, wantGroups []string) TestResult {
+	logger.Info("GroupsTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Groups",
+	}
+
+	start := time.Now()
+	users, groups, searches, err := resolveNestedMembers(conn, groupDN)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to resolve the members of %s: %v", groupDN, err)
+		logger.Error("GroupsTest", result.Message)
+		return result
+	}
+
+	if !sameDNSet(users, wantUsers) || !sameDNSet(groups, wantGroups) {
+		result.Passed = false
+		result.Message = fmt.Sprintf("%s resolves to users %v and groups %v, want users %v and groups %v", groupDN, users, groups, wantUsers, wantGroups)
+		logger.Error("GroupsTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("%s resolves to %d users through %d nested groups (%d searches)", groupDN, len(users), len(groups), searches)
+	logger.Info("GroupsTest", "PASS: "+testName, "searches", searches, "duration", result.Duration)
+	return result
+}
+
+func testNestedGroupsInChain(conn *ldap.Connection, testBaseDN, testName, groupDN string, wantMembers []string, memberDN string, wantGroups []string) TestResult {
+	logger.Info("GroupsTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Groups",
+	}
+
+	if conn.Vendor() != ldap.VendorActiveDirectory {
+		logger.Warn("GroupsTest", "SKIP: "+testName, "reason", "not Active Directory", "vendor", conn.Vendor())
+		result.Skipped = true
+		result.Message = fmt.Sprintf("Skipped: the in-chain matching rule is specific to Active Directory (vendor: %s)", conn.Vendor())
+		return result
+	}
+
+	// Every entry in the group, then every group the member is in
+	searches := []struct {
+		filter string
+		want   []string
+	}{
+		{fmt.Sprintf("(memberOf:%s:=%s)", inChainOID, ldaplib.EscapeFilter(groupDN)), wantMembers},
+		{fmt.Sprintf("(member:%s:=%s)", inChainOID, ldaplib.EscapeFilter(memberDN)), wantGroups},
+	}
+
+	start := time.Now()
+	for _, search := range searches {
+		searchRequest := ldaplib.NewSearchRequest(
+			testBaseDN,
+			ldaplib.ScopeWholeSubtree,
+			ldaplib.NeverDerefAliases,
+			0, 0, false,
+			search.filter,
+			[]string{"1.1"},
+			nil,
+		)
+
+		logger.LogSearchOperation("GroupsTest", testBaseDN, search.filter, "sub", []string{"1.1"})
+		searchStart := time.Now()
+		searchResult, err := conn.Search(searchRequest)
+		if err != nil {
+			result.Duration = time.Since(start)
+			logger.LogLDAPResult("Search", "Search", false, -1, err.Error(), time.Since(searchStart))
+			if ldaplib.IsErrorAnyOf(err, ldaplib.LDAPResultInappropriateMatching, ldaplib.LDAPResultUnavailableCriticalExtension) {
+				logger.Warn("GroupsTest", "SKIP: "+testName, "reason", "matching rule not supported", "error", err)
+				result.Skipped = true
+				result.Message = fmt.Sprintf("Skipped: server does not support the in-chain matching rule: %v", err)
+				return result
+			}
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Search %s failed: %v", search.filter, err)
+			logger.Error("GroupsTest", result.Message)
+			return result
+		}
+		logger.LogSearchResult("GroupsTest", len(searchResult.Entries), time.Since(searchStart))
+
+		found := make([]string, len(searchResult.Entries))
+		for i, entry := range searchResult.Entries {
+			found[i] = entry.DN
+		}
+		if !sameDNSet(found, search.want) {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Message = fmt.Sprintf("Search %s returned %v, want %v", search.filter, found, search.want)
+			logger.Error("GroupsTest", result.Message)
+			return result
+		}
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("In-chain searches returned the %d transitive members of %s and the %d groups of %s", len(wantMembers), groupDN, len(wantGroups), memberDN)
+	logger.Info("GroupsTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+func testNestedGroupsRemoveNested(conn *ldap.Connection, testBaseDN string, g *nestedGroups) TestResult {
+	testName := "Groups - Remove Nested Group Test"
+	logger.Info("GroupsTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Groups",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("GroupsTest", result.Message)
+		return result
+	}
+
+	modifyRequest := ldaplib.NewModifyRequest(g.outer, nil)
+	modifyRequest.Delete("member", []string{g.inner})
+
+	logger.Trace("Groups", "Operation: Modify (Remove nested group)", "dn", g.outer, "member", g.inner)
+	start := time.Now()
+	err := conn.Modify(modifyRequest)
+	result.Duration = time.Since(start)
+	if err != nil {
+		logger.LogLDAPResult("Groups", "Modify (Remove member)", false, -1, err.Error(), result.Duration)
+		return fail(err, fmt.Sprintf("Failed to remove %s from %s: %v", g.inner, g.outer, err))
+	}
+	logger.LogLDAPResult("Groups", "Modify (Remove member)", true, 0, "Success", result.Duration)
+
+	// Only user 3 is left below the top group
+	users, groups, _, err := resolveNestedMembers(conn, g.top)
+	if err != nil {
+		return fail(err, fmt.Sprintf("Failed to resolve the members of %s: %v", g.top, err))
+	}
+	if !sameDNSet(users, g.users[2:]) || !sameDNSet(groups, []string{g.outer}) {
+		return fail(nil, fmt.Sprintf("After the removal %s resolves to users %v and groups %v, want users %v and groups %v", g.top, users, groups, g.users[2:], []string{g.outer}))
+	}
+
+	// A maintained back-link must drop the outer group, and with it the top one
+	memberOf := memberOfAttribute(conn.Vendor())
+	if entry, err := readAttributes(conn, g.inner, memberOf); err == nil {
+		for _, dn := range []string{g.outer, g.top} {
+			if hasDNValue(entry, memberOf, dn) {
+				return fail(nil, fmt.Sprintf("Nested group removed, but %s of %s still lists %s", memberOf, g.inner, dn))
+			}
+		}
+	}
+
+	if conn.Vendor() == ldap.VendorActiveDirectory {
+		check := testNestedGroupsInChain(conn, testBaseDN, testName, g.top, []string{g.outer, g.users[2]}, g.users[0], []string{g.inner})
+		if !check.Passed && !check.Skipped {
+			return fail(check.Error, "After the removal: "+check.Message)
+		}
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Removed %s from %s; %s now resolves to %v only", g.inner, g.outer, g.top, users)
+	logger.Info("GroupsTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// resolveNestedMembers follows the member values of groupDN breadth first,
+// one base search per entry, and returns the users and the nested groups
+// below it with the number of searches sent. Each entry is read once, so
+// membership cycles end.
+func resolveNestedMembers(conn *ldap.Connection, groupDN string) (users, groups []string, searches int, err error) {
+	seen := []string{groupDN}
+	queue := []string{groupDN}
+	for len(queue) > 0 {
+		dn := queue[0]
+		queue = queue[1:]
+
+		entry, err := readAttributes(conn, dn, "objectClass", "member")
+		searches++
+		if err != nil {
+			return nil, nil, searches, err
+		}
+		if dn != groupDN {
+			if !isGroupEntry(entry) {
+				users = append(users, dn)
+				continue
+			}
+			groups = append(groups, dn)
+		}
+
+		for _, member := range entry.GetEqualFoldAttributeValues("member") {
+			if containsDNs(seen, []string{member}) {
+				continue
+			}
+			if len(seen) >= nestedGroupsMaxEntries {
+				return nil, nil, searches, fmt.Errorf("more than %d entries below %s", nestedGroupsMaxEntries, groupDN)
+			}
+			seen = append(seen, member)
+			queue = append(queue, member)
+		}
+	}
+	return users, groups, searches, nil
+}
+
+// isGroupEntry reports whether entry is a group whose members are in member
+func isGroupEntry(entry *ldaplib.Entry) bool {
+	return hasValue(entry, "objectClass", "groupOfNames") || hasValue(entry, "objectClass", "group")
+}
+
+// directMembers reads the member values of a group
+func directMembers(conn *ldap.Connection, groupDN string) ([]string, error) {
+	group, err := readAttributes(conn, groupDN, "member")
+	if err != nil {
+		return nil, err
+	}
+	return group.GetEqualFoldAttributeValues("member"), nil
+}
+
+// checkDirectMembers reads the group back and checks its member values are want
+func checkDirectMembers(conn *ldap.Connection, groupDN string, want []string) error {
+	members, err := directMembers(conn, groupDN)
+	if err != nil {
+		return err
+	}
+	if !sameDNSet(members, want) {
+		return fmt.Errorf("member of %s is %v, want %v", groupDN, members, want)
+	}
+	return nil
+}
+
+// containsDNs reports whether every DN of want is in dns
+func containsDNs(dns, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, dn := range dns {
+			found = found || sameDN(dn, w)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// sameDNSet reports whether two lists hold the same DNs, in any order
+func sameDNSet(a, b []string) bool {
+	return len(a) == len(b) && containsDNs(a, b) && containsDNs(b, a)
+}
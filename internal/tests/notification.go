@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// notificationTimeout bounds how long the server may take to drop the session
+const notificationTimeout = 10 * time.Second
+
+// TestNotification runs all unsolicited notification tests
+func TestNotification(conn *ldap.Connection, h *Harness) []TestResult {
+	logger.Info("NotificationTest", "Starting unsolicited notification tests")
+
+	results := h.Execute([]TestCase{
+		// Test 1: Protocol error forces a Notice of Disconnection
+		{Name: "Notice of Disconnection on Protocol Error Test", Operation: "Notification", Run: func() TestResult { return testNoticeOfDisconnection(conn) }},
+	})
+
+	logger.Info("NotificationTest", "Completed unsolicited notification tests", "total", len(results))
+	return results
+}
+
+// testNoticeOfDisconnection sends a request with an unknown protocol op. Per
+// RFC 4511 section 4.1.1 the server SHOULD answer with a Notice of
+// Disconnection (protocolError) and MUST terminate the session.
+func testNoticeOfDisconnection(conn *ldap.Connection) TestResult {
+	testName := "Notice of Disconnection on Protocol Error Test"
+	logger.Info("NotificationTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Notification",
+	}
+
+	raw, err := conn.OpenRaw()
+	if skipRawUnsupported(&result, "NotificationTest", err) {
+		return result
+	}
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to open raw connection: %v", err)
+		logger.Error("NotificationTest", result.Message)
+		return result
+	}
+	defer raw.Close()
+
+	// [APPLICATION 30] is not an LDAP request
+	logger.Trace("Notification", "Sending request with unrecognized protocol op")
+	start := time.Now()
+	if _, err := raw.Send(ber.Encode(ber.ClassApplication, ber.TypePrimitive, 30, nil, "Unknown Request")); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to send request: %v", err)
+		logger.Error("NotificationTest", result.Message)
+		return result
+	}
+
+	var notice *ldap.RawMessage
+	for {
+		msg, err := raw.Read(notificationTimeout)
+		result.Duration = time.Since(start)
+
+		if err != nil {
+			if ldap.IsTimeout(err) {
+				result.Passed = false
+				result.Error = err
+				result.Message = fmt.Sprintf("Server did not terminate the session within %s after a protocol error", notificationTimeout)
+				logger.Error("NotificationTest", result.Message)
+				return result
+			}
+			if !isDisconnect(err) {
+				result.Passed = false
+				result.Error = err
+				result.Message = fmt.Sprintf("Unexpected read error: %v", err)
+				logger.Error("NotificationTest", result.Message)
+				return result
+			}
+			break
+		}
+
+		if !msg.IsUnsolicited() {
+			result.Passed = false
+			result.Message = fmt.Sprintf("Server answered message %d with %s instead of terminating the session",
+				msg.ID, ldaplib.ApplicationMap[uint8(msg.Tag)])
+			logger.Error("NotificationTest", result.Message)
+			return result
+		}
+
+		logger.Info("NotificationTest", "Received unsolicited notification", "oid", msg.OID, "code", msg.Code)
+		notice = msg
+	}
+
+	switch {
+	case notice == nil:
+		result.Passed = true
+		result.Message = "Server terminated the session, but without a Notice of Disconnection (RFC 4511 4.1.1 SHOULD)"
+		logger.Warn("NotificationTest", result.Message)
+	case notice.OID != ldap.OIDNoticeOfDisconnection:
+		result.Passed = true
+		result.Message = fmt.Sprintf("Server sent unsolicited notification %s (%s) and terminated the session",
+			notice.OID, ldaplib.LDAPResultCodeMap[notice.Code])
+		logger.Info("NotificationTest", "PASS: "+testName, "duration", result.Duration)
+	case notice.Code != ldaplib.LDAPResultProtocolError:
+		result.Passed = false
+		result.Message = fmt.Sprintf("Notice of Disconnection carried %s, expected protocolError (2)", ldaplib.LDAPResultCodeMap[notice.Code])
+		logger.Error("NotificationTest", result.Message)
+	default:
+		result.Passed = true
+		result.Message = "Server sent a Notice of Disconnection (protocolError) and terminated the session"
+		logger.Info("NotificationTest", "PASS: "+testName, "duration", result.Duration)
+	}
+
+	return result
+}
+
+// isDisconnect reports whether a read error means the server closed the connection
+func isDisconnect(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) || errors.Is(err, syscall.ECONNRESET)
+}
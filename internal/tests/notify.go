@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"bytes"
+
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/notify"
+)
+
+// newSummary summarizes the finished run for the notifiers; runErr is the
+// error that kept it from executing, if any
+func (r *Runner) newSummary(runErr error) notify.Summary {
+	total, passed, failed, skipped, duration := r.suite.GetStats()
+	notExecuted, _ := r.suite.GetBudgetExceeded()
+
+	summary := notify.Summary{
+		Event:       "run_complete",
+		RunID:       r.suite.Metadata.RunID,
+		Iteration:   r.iteration,
+		Hostname:    r.suite.Metadata.Hostname,
+		Server:      r.suite.Metadata.Server.Address,
+		TestSuite:   r.testSuite,
+		Status:      "pass",
+		Interrupted: r.suite.Interrupted,
+		StartTime:   r.suite.StartTime,
+		EndTime:     r.suite.EndTime,
+		DurationMS:  duration.Milliseconds(),
+		Summary: notify.Counts{
+			Total:       total,
+			Passed:      passed,
+			Failed:      failed,
+			Skipped:     skipped,
+			NotExecuted: notExecuted,
+		},
+		FailedTests: []notify.FailedTest{},
+	}
+	switch {
+	case runErr != nil:
+		summary.Status = "error"
+		summary.Error = runErr.Error()
+	case !r.suite.AllPassed():
+		summary.Status = "fail"
+	}
+
+	for _, result := range r.suite.Results {
+		if result.Passed || result.Skipped {
+			continue
+		}
+		entry := notify.FailedTest{
+			Name:      result.Name,
+			Operation: result.Operation,
+			Worker:    result.Worker,
+			Message:   result.Message,
+		}
+		if result.Error != nil {
+			entry.Error = result.Error.Error()
+		}
+		summary.FailedTests = append(summary.FailedTests, entry)
+	}
+	return summary
+}
+
+// notifiers returns the configured notifiers the summary goes to: the
+// webhook always, and the notify section's notifiers unless their on
+// setting limits them to failed runs
+func (r *Runner) notifiers(summary notify.Summary) []notify.Notifier {
+	var notifiers []notify.Notifier
+	if r.config.WebhookURL != "" {
+		notifiers = append(notifiers, notify.NewWebhook(r.config.WebhookURL))
+	}
+	if r.config.Notify.Slack.Webhook != "" && (r.config.GetNotifyOn() == "always" || summary.Failed()) {
+		notifiers = append(notifiers, notify.NewSlack(r.config.Notify.Slack.Webhook))
+	}
+	if r.config.Notify.Email.SMTPHost != "" && (r.config.GetEmailOn() == "always" || summary.Failed()) {
+		notifiers = append(notifiers, r.emailNotifier())
+	}
+	return notifiers
+}
+
+// emailNotifier returns the email notifier with the reports of the finished run
+func (r *Runner) emailNotifier() *notify.Email {
+	cfg := r.config.Notify.Email
+	email := &notify.Email{
+		Host:     cfg.SMTPHost,
+		Port:     r.config.GetSMTPPort(),
+		Security: r.config.GetSMTPSecurity(),
+		Username: cfg.Username,
+		Password: cfg.Password,
+		From:     cfg.From,
+		To:       cfg.To,
+	}
+
+	var report bytes.Buffer
+	r.writeConsoleReport(&report)
+	email.Report = report.String()
+
+	if cfg.Attach == "html" {
+		var html bytes.Buffer
+		if err := WriteHTMLReport(&html, r.suite); err != nil {
+			logger.Warn("Notify", "Failed to render the HTML report, emailing without it", "error", err)
+		} else {
+			email.HTMLReport = html.Bytes()
+		}
+	}
+	return email
+}
+
+// notify sends the summary of the finished run to the configured notifiers.
+// A failed notification is logged but does not fail the run. Dry runs execute
+// no tests, so they are not notified.
+func (r *Runner) notify(runErr error) {
+	if r.config.DryRun {
+		return
+	}
+
+	summary := r.newSummary(runErr)
+	for _, notifier := range r.notifiers(summary) {
+		if err := notifier.Notify(summary); err != nil {
+			logger.Warn("Notify", "Failed to send run notification", "notifier", notifier.Name(), "error", err)
+			continue
+		}
+		logger.Info("Notify", "Sent run notification", "notifier", notifier.Name())
+	}
+}
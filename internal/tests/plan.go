@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+)
+
+// openPlan starts the LDIF of the write operations a dry run would perform,
+// in the dry_run_ldif file or on the report output for "-"
+func (r *Runner) openPlan() error {
+	out := r.reportOutput()
+	if r.config.DryRunLDIF != "-" {
+		if dir := filepath.Dir(r.config.DryRunLDIF); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create dry run LDIF directory: %w", err)
+			}
+		}
+		file, err := os.Create(r.config.DryRunLDIF)
+		if err != nil {
+			return fmt.Errorf("failed to create dry run LDIF file: %w", err)
+		}
+		r.planFile = file
+		out = file
+	}
+
+	r.plan = ldap.NewPlan(out)
+	r.plan.Comment(fmt.Sprintf("Operations planned by run %s against %s at %s", r.suite.Metadata.RunID, r.config.GetAddress(), time.Now().Format(time.RFC3339)))
+	r.plan.Comment("Nothing below was sent to the server; apply with e.g. ldapmodify -f <file>")
+	return nil
+}
+
+// closePlan writes out the planned operations and closes their file
+func (r *Runner) closePlan() {
+	if r.plan == nil {
+		return
+	}
+	err := r.plan.Flush()
+	if r.planFile != nil {
+		if closeErr := r.planFile.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to write dry run LDIF file: %w", closeErr)
+		}
+	}
+	if err != nil {
+		logger.Error("TestRunner", "Failed to write the planned operations", "error", err)
+	} else {
+		logger.Info("TestRunner", "DRY RUN: Wrote the planned operations", "operations", r.plan.Records(), "ldif", r.config.DryRunLDIF)
+		fmt.Printf("\nDRY RUN: %d planned operations written to %s\n", r.plan.Records(), planTarget(r.config.DryRunLDIF))
+	}
+	r.plan = nil
+	r.planFile = nil
+}
+
+// planTarget names where the planned operations went
+func planTarget(path string) string {
+	if path == "-" {
+		return "stdout"
+	}
+	return path
+}
@@ -0,0 +1,415 @@
+package tests
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// Fixtures of the posix suite
+const (
+	FixturePosixIDs      = "posix IDs"      // uidNumber and gidNumber allocated
+	FixturePosixGroup    = "posix group"    // posixGroup created
+	FixturePosixAccounts = "posix accounts" // posixAccounts created
+	FixturePosixMembers  = "posix members"  // memberUid values added
+)
+
+// posixIDFloor is the lowest ID allocated, above the system and the usual
+// local user ranges
+const posixIDFloor = 10000
+
+// posixAccountCount is the number of accounts the suite creates, all in its group
+const posixAccountCount = 2
+
+// posixState holds the IDs allocated for the suite's entries
+type posixState struct {
+	uidNumber int // of the first account, the others follow
+	gidNumber int
+}
+
+// posixGroupDN is the posixGroup of the suite
+func posixGroupDN(testBaseDN string) string {
+	return fmt.Sprintf("cn=posix-group,%s", testBaseDN)
+}
+
+// posixUID is the uid of account i, counting from 0
+func posixUID(i int) string {
+	return fmt.Sprintf("posix-user-%d", i+1)
+}
+
+// posixAccountDN is the DN of account i
+func posixAccountDN(testBaseDN string, i int) string {
+	return fmt.Sprintf("uid=%s,%s", posixUID(i), testBaseDN)
+}
+
+// TestPosix runs the RFC 2307 tests: posixAccount and posixGroup entries with
+// allocated uidNumber and gidNumber values, group membership through
+// memberUid, and the searches NSS and PAM modules such as nslcd and SSSD send
+// to resolve users and groups
+func TestPosix(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
+	logger.Info("PosixTest", "Starting POSIX account and group tests")
+
+	state := &posixState{}
+	results := h.Execute([]TestCase{
+		// Test 1: Allocate a uidNumber and a gidNumber above those in use
+		{Name: "POSIX - Allocate IDs Test", Operation: "POSIX", Provides: FixturePosixIDs, Run: func() TestResult {
+			return testPosixAllocate(conn, state)
+		}},
+
+		// Test 2: Add a posixGroup with the allocated gidNumber
+		{Name: "POSIX - Add posixGroup Test", Operation: "POSIX", Requires: []string{FixturePosixIDs}, Provides: FixturePosixGroup, Run: func() TestResult {
+			return testPosixAddGroup(conn, testBaseDN, trk, state)
+		}},
+
+		// Test 3: Add posixAccounts whose primary group is the posixGroup
+		{Name: "POSIX - Add posixAccount Test", Operation: "POSIX", Requires: []string{FixturePosixIDs}, Provides: FixturePosixAccounts, Run: func() TestResult {
+			return testPosixAddAccounts(conn, testBaseDN, trk, state)
+		}},
+
+		// Test 4: Add the accounts to the group as memberUid values
+		{Name: "POSIX - Add memberUid Test", Operation: "POSIX", Requires: []string{FixturePosixGroup, FixturePosixAccounts}, Provides: FixturePosixMembers, Run: func() TestResult {
+			return testPosixAddMembers(conn, testBaseDN)
+		}},
+
+		// Test 5: Look up an account by uidNumber, as getpwuid does
+		{Name: "POSIX - Search by uidNumber Test", Operation: "POSIX", Requires: []string{FixturePosixAccounts}, Run: func() TestResult {
+			filter := fmt.Sprintf("(&(objectClass=posixAccount)(uidNumber=%d))", state.uidNumber)
+			return testPosixSearch(conn, testBaseDN, "POSIX - Search by uidNumber Test", filter, []string{"uid", "uidNumber", "gidNumber", "homeDirectory", "loginShell"}, posixAccountDN(testBaseDN, 0))
+		}},
+
+		// Test 6: Look up the group by gidNumber, as getgrgid does
+		{Name: "POSIX - Search by gidNumber Test", Operation: "POSIX", Requires: []string{FixturePosixGroup}, Run: func() TestResult {
+			filter := fmt.Sprintf("(&(objectClass=posixGroup)(gidNumber=%d))", state.gidNumber)
+			return testPosixSearch(conn, testBaseDN, "POSIX - Search by gidNumber Test", filter, []string{"cn", "gidNumber", "memberUid"}, posixGroupDN(testBaseDN))
+		}},
+
+		// Test 7: Look up the groups of an account by memberUid, as initgroups does
+		{Name: "POSIX - Search Groups by memberUid Test", Operation: "POSIX", Requires: []string{FixturePosixMembers}, Run: func() TestResult {
+			filter := andFilter("(objectClass=posixGroup)", eqFilter("memberUid", posixUID(0)))
+			return testPosixSearch(conn, testBaseDN, "POSIX - Search Groups by memberUid Test", filter, []string{"cn", "gidNumber"}, posixGroupDN(testBaseDN))
+		}},
+
+		// Test 8: Remove a memberUid value again
+		{Name: "POSIX - Remove memberUid Test", Operation: "POSIX", Requires: []string{FixturePosixMembers}, Run: func() TestResult {
+			return testPosixRemoveMember(conn, testBaseDN)
+		}},
+	})
+
+	logger.Info("PosixTest", "Completed POSIX account and group tests", "total", len(results))
+	return results
+}
+
+// isSchemaMissing reports whether an add failed because the server's schema
+// lacks the object classes or attributes of the entry (no nis or rfc2307bis schema)
+func isSchemaMissing(err error) bool {
+	return ldaplib.IsErrorAnyOf(err, ldaplib.LDAPResultUndefinedAttributeType, ldaplib.LDAPResultObjectClassViolation, ldaplib.LDAPResultInvalidAttributeSyntax)
+}
+
+// testPosixAllocate allocates the IDs the way a provisioning tool without an
+// ID pool entry does: one above the highest uidNumber and gidNumber under the
+// base DN, and no lower than posixIDFloor
+func testPosixAllocate(conn *ldap.Connection, state *posixState) TestResult {
+	testName := "POSIX - Allocate IDs Test"
+	logger.Info("PosixTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "POSIX",
+	}
+
+	baseDN := conn.GetConfig().BaseDN
+	filter := "(|(uidNumber=*)(gidNumber=*))"
+	attributes := []string{"uidNumber", "gidNumber"}
+	searchRequest := ldaplib.NewSearchRequest(
+		baseDN,
+		ldaplib.ScopeWholeSubtree,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		filter,
+		attributes,
+		nil,
+	)
+
+	logger.LogSearchOperation("PosixTest", baseDN, filter, "sub", attributes)
+	start := time.Now()
+	searchResult, err := conn.GetConnection().SearchWithPaging(searchRequest, 500)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to search the IDs in use: %v", err)
+		logger.LogLDAPResult("Search", "Search", false, -1, err.Error(), result.Duration)
+		logger.Error("PosixTest", result.Message)
+		return result
+	}
+	logger.LogSearchResult("PosixTest", len(searchResult.Entries), result.Duration)
+
+	maxUID, maxGID := posixIDFloor-1, posixIDFloor-1
+	for _, entry := range searchResult.Entries {
+		if n, err := strconv.Atoi(entry.GetEqualFoldAttributeValue("uidNumber")); err == nil {
+			maxUID = max(maxUID, n)
+		}
+		if n, err := strconv.Atoi(entry.GetEqualFoldAttributeValue("gidNumber")); err == nil {
+			maxGID = max(maxGID, n)
+		}
+	}
+	state.uidNumber = maxUID + 1
+	state.gidNumber = maxGID + 1
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Allocated uidNumber %d-%d and gidNumber %d above the %d entries with IDs", state.uidNumber, state.uidNumber+posixAccountCount-1, state.gidNumber, len(searchResult.Entries))
+	logger.Info("PosixTest", "PASS: "+testName, "uidNumber", state.uidNumber, "gidNumber", state.gidNumber, "duration", result.Duration)
+	return result
+}
+
+func testPosixAddGroup(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, state *posixState) TestResult {
+	testName := "POSIX - Add posixGroup Test"
+	logger.Info("PosixTest", "Running: "+testName)
+
+	dn := posixGroupDN(testBaseDN)
+	attributes := map[string][]string{
+		"objectClass": {"top", "posixGroup"},
+		"cn":          {"posix-group"},
+		"gidNumber":   {strconv.Itoa(state.gidNumber)},
+		"description": {"POSIX group created by automated tests"},
+	}
+	return addPosixEntry(conn, testName, dn, attributes, tracker.TypeGroup, trk)
+}
+
+func testPosixAddAccounts(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, state *posixState) TestResult {
+	testName := "POSIX - Add posixAccount Test"
+	logger.Info("PosixTest", "Running: "+testName)
+
+	var result TestResult
+	var duration time.Duration
+	for i := 0; i < posixAccountCount; i++ {
+		uid := posixUID(i)
+		attributes := map[string][]string{
+			"objectClass":   {"top", "person", "organizationalPerson", "inetOrgPerson", "posixAccount"},
+			"cn":            {fmt.Sprintf("POSIX User %d", i+1)},
+			"sn":            {"User"},
+			"uid":           {uid},
+			"uidNumber":     {strconv.Itoa(state.uidNumber + i)},
+			"gidNumber":     {strconv.Itoa(state.gidNumber)},
+			"homeDirectory": {"/home/" + uid},
+			"loginShell":    {"/bin/bash"},
+			"gecos":         {fmt.Sprintf("POSIX User %d", i+1)},
+		}
+		result = addPosixEntry(conn, testName, posixAccountDN(testBaseDN, i), attributes, tracker.TypeUser, trk)
+		duration += result.Duration
+		if !result.Passed {
+			return result
+		}
+	}
+
+	result.Duration = duration
+	result.Message = fmt.Sprintf("Added %d posixAccounts with uidNumber %d-%d in gidNumber %d (verified by read-back)", posixAccountCount, state.uidNumber, state.uidNumber+posixAccountCount-1, state.gidNumber)
+	return result
+}
+
+// addPosixEntry adds an entry and verifies it by read-back. A schema without
+// the RFC 2307 object classes skips the test.
+func addPosixEntry(conn *ldap.Connection, testName, dn string, attributes map[string][]string, entryType tracker.EntryType, trk *tracker.Tracker) TestResult {
+	result := TestResult{
+		Name:      testName,
+		Operation: "POSIX",
+	}
+
+	addRequest := ldaplib.NewAddRequest(dn, nil)
+	for attr, values := range attributes {
+		addRequest.Attribute(attr, values)
+	}
+
+	logger.Trace("Posix", "Operation: Add", "dn", dn)
+	start := time.Now()
+	err := createEntry(conn, addRequest)
+	result.Duration = time.Since(start)
+
+	if isSchemaMissing(err) {
+		logger.LogLDAPResult("Posix", "Add", false, -1, err.Error(), result.Duration)
+		logger.Warn("PosixTest", "SKIP: "+testName, "reason", "no RFC 2307 schema", "error", err)
+		result.Skipped = true
+		result.Message = fmt.Sprintf("Skipped: the server schema does not allow %v (no nis or rfc2307bis schema?): %v", attributes["objectClass"], err)
+		return result
+	}
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to add %s: %v", dn, err)
+		logger.LogLDAPResult("Posix", "Add", false, -1, err.Error(), result.Duration)
+		logger.Error("PosixTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("Posix", "Add", true, 0, "Success", result.Duration)
+
+	// Track the created entry, even if it does not read back as written
+	trk.Track(dn, entryType)
+
+	if err := verifyAdded(conn, dn, attributes); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Add returned success but read-back failed: %v", err)
+		logger.Error("PosixTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Added %s (verified by read-back)", dn)
+	logger.Info("PosixTest", "PASS: "+testName, "dn", dn, "duration", result.Duration)
+	return result
+}
+
+func testPosixAddMembers(conn *ldap.Connection, testBaseDN string) TestResult {
+	testName := "POSIX - Add memberUid Test"
+	logger.Info("PosixTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "POSIX",
+	}
+
+	groupDN := posixGroupDN(testBaseDN)
+	uids := make([]string, posixAccountCount)
+	for i := range uids {
+		uids[i] = posixUID(i)
+	}
+
+	modifyRequest := ldaplib.NewModifyRequest(groupDN, nil)
+	modifyRequest.Add("memberUid", uids)
+
+	logger.Trace("Posix", "Operation: Modify (Add memberUid)", "dn", groupDN, "memberUid", uids)
+	start := time.Now()
+	err := conn.Modify(modifyRequest)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to add memberUid values: %v", err)
+		logger.LogLDAPResult("Posix", "Modify (Add memberUid)", false, -1, err.Error(), result.Duration)
+		logger.Error("PosixTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("Posix", "Modify (Add memberUid)", true, 0, "Success", result.Duration)
+
+	for _, uid := range uids {
+		if err := verifyGroupMember(conn, groupDN, "memberUid", uid, true); err != nil {
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Modify returned success but read-back failed: %v", err)
+			logger.Error("PosixTest", result.Message)
+			return result
+		}
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Added memberUid %v to %s (verified by read-back)", uids, groupDN)
+	logger.Info("PosixTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// testPosixSearch searches the test OU with filter and passes if the only
+// entry found is want
+func testPosixSearch(conn *ldap.Connection, testBaseDN, testName, filter string, attributes []string, want string) TestResult {
+	logger.Info("PosixTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "POSIX",
+	}
+
+	searchRequest := ldaplib.NewSearchRequest(
+		testBaseDN,
+		ldaplib.ScopeWholeSubtree,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		filter,
+		attributes,
+		nil,
+	)
+
+	logger.LogSearchOperation("PosixTest", testBaseDN, filter, "sub", attributes)
+	start := time.Now()
+	searchResult, err := conn.Search(searchRequest)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Search %s failed: %v", filter, err)
+		logger.LogLDAPResult("Search", "Search", false, -1, err.Error(), result.Duration)
+		logger.Error("PosixTest", result.Message)
+		return result
+	}
+	logger.LogSearchResult("PosixTest", len(searchResult.Entries), result.Duration)
+
+	if len(searchResult.Entries) != 1 || !sameDN(searchResult.Entries[0].DN, want) {
+		found := make([]string, len(searchResult.Entries))
+		for i, entry := range searchResult.Entries {
+			found[i] = entry.DN
+		}
+		result.Passed = false
+		result.Message = fmt.Sprintf("Search %s returned %v, want only %s", filter, found, want)
+		logger.Error("PosixTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Search %s returned %s", filter, want)
+	logger.Info("PosixTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+func testPosixRemoveMember(conn *ldap.Connection, testBaseDN string) TestResult {
+	testName := "POSIX - Remove memberUid Test"
+	logger.Info("PosixTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "POSIX",
+	}
+
+	groupDN := posixGroupDN(testBaseDN)
+	uid := posixUID(posixAccountCount - 1)
+
+	modifyRequest := ldaplib.NewModifyRequest(groupDN, nil)
+	modifyRequest.Delete("memberUid", []string{uid})
+
+	logger.Trace("Posix", "Operation: Modify (Delete memberUid)", "dn", groupDN, "memberUid", uid)
+	start := time.Now()
+	err := conn.Modify(modifyRequest)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to remove memberUid %s: %v", uid, err)
+		logger.LogLDAPResult("Posix", "Modify (Delete memberUid)", false, -1, err.Error(), result.Duration)
+		logger.Error("PosixTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("Posix", "Modify (Delete memberUid)", true, 0, "Success", result.Duration)
+
+	if err := verifyGroupMember(conn, groupDN, "memberUid", uid, false); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Modify returned success but read-back failed: %v", err)
+		logger.Error("PosixTest", result.Message)
+		return result
+	}
+	if err := verifyGroupMember(conn, groupDN, "memberUid", posixUID(0), true); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Removing memberUid %s also changed the other members: %v", uid, err)
+		logger.Error("PosixTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Removed memberUid %s from %s (verified by read-back)", uid, groupDN)
+	logger.Info("PosixTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// postureProbePassword is sent by the cleartext bind probe. The server's answer
+// to a wrong password tells whether it would accept the real one in cleartext,
+// without ever sending the real one unencrypted.
+const postureProbePassword = "posture-probe-invalid-password"
+
+// postureProbeRDN names the entry the cleartext bind probe binds as, below the
+// base DN where it does not exist, so no real account collects a failed bind
+// towards its lockout
+const postureProbeRDN = "cn=ldap-test-posture-probe"
+
+// SecurityCheck is one finding of the security posture assessment
+type SecurityCheck struct {
+	Name    string
+	Result  string
+	Concern bool // the finding weakens security or breaks a common policy
+}
+
+// AssessSecurity probes the server for the security posture summary of the
+// report. Every probe uses its own connection, so the main connection stays
+// bound as configured.
+func AssessSecurity(conn *ldap.Connection, baseDN string) []SecurityCheck {
+	logger.Info("Security", "Assessing security posture")
+	cfg := conn.GetConfig()
+	info := conn.GetServerInfo()
+
+	checks := []SecurityCheck{probeBind(conn, "Anonymous bind", "")}
+	if cfg.BindDN != "" {
+		checks = append(checks, probeBind(conn, "Unauthenticated bind (DN, no password)", cfg.BindDN))
+	}
+
+	cleartext, required := probeCleartextBind(conn)
+	checks = append(checks, cleartext)
+
+	switch {
+	case info.SupportsExtension(ldap.OIDStartTLS):
+		checks = append(checks, SecurityCheck{Name: "StartTLS offered", Result: "yes"})
+	case cfg.UseTLS:
+		checks = append(checks, SecurityCheck{Name: "StartTLS offered", Result: "no (LDAPS in use)"})
+	default:
+		checks = append(checks, SecurityCheck{Name: "StartTLS offered", Result: "no", Concern: true})
+	}
+	checks = append(checks, required)
+
+	checks = append(checks, probeTLS(conn), probePasswordReadable(conn, baseDN))
+
+	mechanisms := "none advertised"
+	if len(info.SASLMechanisms) > 0 {
+		mechanisms = strings.Join(info.SASLMechanisms, ", ")
+	}
+	checks = append(checks, SecurityCheck{Name: "SASL mechanisms", Result: mechanisms})
+
+	for _, check := range checks {
+		logger.Info("Security", check.Name, "result", check.Result, "concern", check.Concern)
+	}
+	return checks
+}
+
+// probeBind attempts an unauthenticated bind as dn ("" for anonymous)
+func probeBind(conn *ldap.Connection, name, dn string) SecurityCheck {
+	check := SecurityCheck{Name: name}
+
+	probe, err := ldap.NewConnection(conn.GetConfig())
+	if err != nil {
+		check.Result = fmt.Sprintf("unknown (%v)", err)
+		return check
+	}
+	defer probe.Close()
+
+	logger.Trace("Security", "Operation: Unauthenticated Bind", "dn", dn)
+	err = probe.GetConnection().UnauthenticatedBind(dn)
+	switch {
+	case err == nil:
+		check.Result = "allowed"
+		check.Concern = true
+	case rejection(err) != "":
+		check.Result = rejection(err)
+	default:
+		check.Result = fmt.Sprintf("unknown (%v)", err)
+	}
+	return check
+}
+
+// probeCleartextBind sends a simple bind with a wrong password on an
+// unencrypted connection and returns the cleartext and StartTLS-required findings
+func probeCleartextBind(conn *ldap.Connection) (cleartext, required SecurityCheck) {
+	cleartext = SecurityCheck{Name: "Cleartext simple bind"}
+	required = SecurityCheck{Name: "StartTLS required"}
+
+	if conn.GetConfig().UseTLS {
+		cleartext.Result = "not tested (LDAPS port)"
+		required.Result = "n/a (LDAPS in use)"
+		return
+	}
+
+	err := cleartextBind(conn)
+	switch {
+	case err == nil:
+		cleartext.Result = "accepted, even with a wrong password"
+		cleartext.Concern = true
+		required.Result = "no"
+		required.Concern = true
+	case ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultConfidentialityRequired):
+		cleartext.Result = "rejected (confidentialityRequired)"
+		required.Result = "yes"
+	case ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultInvalidCredentials):
+		cleartext.Result = "accepted (credentials are checked without TLS)"
+		cleartext.Concern = true
+		required.Result = "no"
+		required.Concern = true
+	case rejection(err) != "":
+		cleartext.Result = rejection(err)
+		required.Result = "unknown"
+	default:
+		cleartext.Result = fmt.Sprintf("unknown (%v)", err)
+		required.Result = "unknown"
+	}
+	return
+}
+
+// cleartextBind sends a simple bind with a wrong password on a new unencrypted
+// connection, as an entry that does not exist rather than the bind DN, and
+// returns the bind result
+func cleartextBind(conn *ldap.Connection) error {
+	raw, err := conn.DialRaw()
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer raw.Close()
+
+	dn := postureProbeRDN + "," + conn.GetConfig().BaseDN
+	logger.Trace("Security", "Operation: Simple Bind without TLS (wrong password)", "dn", dn)
+	return raw.Bind(dn, postureProbePassword)
+}
+
+// probeTLS reports the negotiated TLS protocol and cipher suite
+func probeTLS(conn *ldap.Connection) SecurityCheck {
+	check := SecurityCheck{Name: "TLS protocol / cipher"}
+
+	cfg := conn.GetConfig()
+	if !cfg.UseTLS && !cfg.StartTLS {
+		check.Result = "not used"
+		check.Concern = true
+		return check
+	}
+
+	raw, err := conn.OpenSecureRaw()
+	if err != nil {
+		check.Result = fmt.Sprintf("unknown (%v)", err)
+		return check
+	}
+	defer raw.Close()
+
+	state, ok := raw.TLSState()
+	if !ok {
+		check.Result = "unknown"
+		return check
+	}
+	check.Result = fmt.Sprintf("%s, %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	check.Concern = state.Version < tls.VersionTLS12
+	return check
+}
+
+// probePasswordReadable checks whether userPassword values are returned to
+// the configured bind DN
+func probePasswordReadable(conn *ldap.Connection, baseDN string) SecurityCheck {
+	check := SecurityCheck{Name: "Password returned over LDAP"}
+
+	logger.LogSearchOperation("Security", baseDN, "(userPassword=*)", "sub", []string{"userPassword"})
+	searchRequest := ldaplib.NewSearchRequest(
+		baseDN,
+		ldaplib.ScopeWholeSubtree,
+		ldaplib.NeverDerefAliases,
+		1, 0, false,
+		"(userPassword=*)",
+		[]string{"userPassword"},
+		nil,
+	)
+
+	result, err := conn.GetConnection().Search(searchRequest)
+	if err != nil && !ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultSizeLimitExceeded) {
+		check.Result = fmt.Sprintf("unknown (%v)", err)
+		return check
+	}
+
+	var values []string
+	if result != nil && len(result.Entries) > 0 {
+		values = result.Entries[0].GetEqualFoldAttributeValues("userPassword")
+	}
+	switch {
+	case len(values) == 0:
+		check.Result = "no"
+	case isHashedPassword(values[0]):
+		check.Result = "yes (hashed)"
+		check.Concern = true
+	default:
+		check.Result = "yes (cleartext)"
+		check.Concern = true
+	}
+	return check
+}
+
+// isHashedPassword reports whether a userPassword value carries a {SCHEME} prefix
+func isHashedPassword(value string) bool {
+	return strings.HasPrefix(value, "{") && strings.Contains(value, "}")
+}
+
+// rejection names the LDAP result code of err, or "" if err is not an LDAP result
+func rejection(err error) string {
+	var ldapErr *ldaplib.Error
+	if !errors.As(err, &ldapErr) {
+		return ""
+	}
+	return fmt.Sprintf("rejected (%s)", ldaplib.LDAPResultCodeMap[ldapErr.ResultCode])
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+)
+
+// Progress is the persisted state of a run, saved after setup and after each
+// suite so a crashed or cancelled run can be resumed with --resume <run-id>
+type Progress struct {
+	RunID           string                 `json:"run_id"`
+	ConfigHash      string                 `json:"config_hash"`
+	TestBaseDN      string                 `json:"test_base_dn"`
+	CompletedSuites []string               `json:"completed_suites"`
+	Fixtures        map[string]string      `json:"fixtures"` // fixture -> "" if available, else why not
+	Entries         []tracker.TrackedEntry `json:"entries"`
+	Results         []savedResult          `json:"results"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
+// savedResult is a TestResult in a JSON-serializable form
+type savedResult struct {
+	Name      string        `json:"name"`
+	Operation string        `json:"operation"`
+	Passed    bool          `json:"passed"`
+	Skipped   bool          `json:"skipped"`
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"`
+	Message   string        `json:"message"`
+
+	BudgetExceeded bool `json:"budget_exceeded,omitempty"`
+	Retries        int  `json:"retries,omitempty"`
+}
+
+// progressPath returns the state file of a run
+func progressPath(dir, runID string) string {
+	return filepath.Join(dir, runID+".json")
+}
+
+// LoadProgress reads the persisted state of a run
+func LoadProgress(dir, runID string) (*Progress, error) {
+	data, err := os.ReadFile(progressPath(dir, runID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no saved progress for run %s in %s", runID, dir)
+		}
+		return nil, fmt.Errorf("failed to read run progress: %w", err)
+	}
+
+	var p Progress
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse run progress: %w", err)
+	}
+	return &p, nil
+}
+
+// Save writes the progress atomically, so a crash mid-write keeps the previous state
+func (p *Progress) Save(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	p.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run progress: %w", err)
+	}
+
+	path := progressPath(dir, p.RunID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write run progress: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write run progress: %w", err)
+	}
+
+	logger.Debug("Progress", "Saved run progress", "runID", p.RunID, "completedSuites", len(p.CompletedSuites))
+	return nil
+}
+
+// Remove deletes the state file of a finished run
+func (p *Progress) Remove(dir string) error {
+	err := os.Remove(progressPath(dir, p.RunID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove run progress: %w", err)
+	}
+	return nil
+}
+
+// IsCompleted reports whether a suite finished in an earlier attempt
+func (p *Progress) IsCompleted(suite string) bool {
+	for _, completed := range p.CompletedSuites {
+		if completed == suite {
+			return true
+		}
+	}
+	return false
+}
+
+// SetResults stores the results of the completed suites
+func (p *Progress) SetResults(results []TestResult) {
+	p.Results = make([]savedResult, len(results))
+	for i, result := range results {
+		p.Results[i] = savedResult{
+			Name:      result.Name,
+			Operation: result.Operation,
+			Passed:    result.Passed,
+			Skipped:   result.Skipped,
+			Duration:  result.Duration,
+			Message:   result.Message,
+
+			BudgetExceeded: result.BudgetExceeded,
+			Retries:        result.Retries,
+		}
+		if result.Error != nil {
+			p.Results[i].Error = result.Error.Error()
+		}
+	}
+}
+
+// TestResults returns the stored results of the completed suites
+func (p *Progress) TestResults() []TestResult {
+	results := make([]TestResult, len(p.Results))
+	for i, saved := range p.Results {
+		results[i] = TestResult{
+			Name:      saved.Name,
+			Operation: saved.Operation,
+			Passed:    saved.Passed,
+			Skipped:   saved.Skipped,
+			Duration:  saved.Duration,
+			Message:   saved.Message,
+
+			BudgetExceeded: saved.BudgetExceeded,
+			Retries:        saved.Retries,
+		}
+		if saved.Error != "" {
+			results[i].Error = errors.New(saved.Error)
+		}
+	}
+	return results
+}
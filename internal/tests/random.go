@@ -0,0 +1,400 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// FixtureRandomOps is provided when the random operation sequence completed
+const FixtureRandomOps = "random operations"
+
+// randomContainers are the OUs the random entries are added to and moved between
+var randomContainers = []string{"random-a", "random-b"}
+
+// randomWords is the vocabulary of the generated attribute values
+var randomWords = []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel", "india", "juliett"}
+
+// randomAttributes are the attributes compared by the consistency check
+var randomAttributes = []string{"cn", "sn", "description", "telephoneNumber"}
+
+// randomEntry is the expected state of an entry created by the random suite
+type randomEntry struct {
+	dn         string
+	container  int
+	attributes map[string][]string
+}
+
+// randomModel is the expected state of the random containers. Entries are
+// kept in a slice so that the seed alone determines every choice.
+type randomModel struct {
+	rng     *rand.Rand
+	bases   []string
+	entries []*randomEntry
+	nextID  int
+	counts  map[string]int
+}
+
+// TestRandomOps generates a seed-reproducible sequence of valid adds,
+// modifies, renames, moves and deletes within the test OU for duration,
+// then verifies that the directory matches the expected state
+func TestRandomOps(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, seed int64, duration time.Duration, h *Harness) []TestResult {
+	logger.Info("RandomTest", "Starting random operation tests")
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	logger.Info("RandomTest", "Random operation sequence", "seed", seed, "duration", duration)
+
+	model := &randomModel{
+		rng:    rand.New(rand.NewSource(seed)),
+		counts: make(map[string]int),
+	}
+
+	results := h.Execute([]TestCase{
+		// Test 1: Apply the random operation sequence
+		{Name: "Random Operations Test", Operation: "Random", Provides: FixtureRandomOps, Run: func() TestResult {
+			return testRandomSequence(conn, testBaseDN, trk, model, seed, duration, h)
+		}},
+
+		// Test 2: Compare the directory with the expected state
+		{Name: "Random Operations Consistency Test", Operation: "Random", Requires: []string{FixtureRandomOps}, Run: func() TestResult {
+			return testRandomConsistency(conn, model, seed)
+		}},
+	})
+
+	logger.Info("RandomTest", "Completed random operation tests", "total", len(results))
+	return results
+}
+
+func testRandomSequence(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, model *randomModel, seed int64, duration time.Duration, h *Harness) TestResult {
+	testName := "Random Operations Test"
+	logger.Info("RandomTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Random",
+	}
+
+	start := time.Now()
+	for _, container := range randomContainers {
+		dn := fmt.Sprintf("ou=%s,%s", container, testBaseDN)
+		// The model starts empty, so containers left in a reused test OU go first
+		if err := removeStale(conn, dn); err != nil {
+			logger.Warn("RandomTest", "Failed to remove stale container", "dn", dn, "error", err)
+		}
+		addRequest := ldaplib.NewAddRequest(dn, nil)
+		addRequest.Attribute("objectClass", []string{"organizationalUnit"})
+		addRequest.Attribute("ou", []string{container})
+
+		if err := conn.Add(addRequest); err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Failed to create container %s: %v", dn, err)
+			logger.Error("RandomTest", result.Message)
+			return result
+		}
+		trk.Track(dn, tracker.TypeOU)
+		model.bases = append(model.bases, dn)
+	}
+
+	operations := 0
+	for time.Since(start) < duration && h.ctx.Err() == nil {
+		operations++
+		description, err := model.step(conn, trk)
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Operation %d (%s) failed (seed %d): %v", operations, description, seed, err)
+			logger.Error("RandomTest", result.Message)
+			return result
+		}
+		logger.Debug("RandomTest", "Applied random operation", "n", operations, "operation", description)
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Applied %d operations with seed %d (%d adds, %d modifies, %d renames, %d moves, %d deletes); %d entries remain",
+		operations, seed, model.counts["add"], model.counts["modify"], model.counts["rename"], model.counts["move"], model.counts["delete"], len(model.entries))
+	logger.Info("RandomTest", "PASS: "+testName, "duration", result.Duration, "operations", operations)
+	return result
+}
+
+// step applies the next operation of the sequence and updates the model
+func (m *randomModel) step(conn *ldap.Connection, trk *tracker.Tracker) (string, error) {
+	choice := m.rng.Intn(100)
+	switch {
+	case len(m.entries) == 0 || choice < 30:
+		return m.add(conn, trk)
+	case choice < 65:
+		return m.modify(conn)
+	case choice < 85:
+		return m.rename(conn, trk)
+	default:
+		return m.delete(conn, trk)
+	}
+}
+
+func (m *randomModel) word() string {
+	return randomWords[m.rng.Intn(len(randomWords))]
+}
+
+func (m *randomModel) phone() string {
+	return fmt.Sprintf("+1 555 %04d", m.rng.Intn(10000))
+}
+
+func (m *randomModel) newCN() string {
+	m.nextID++
+	return fmt.Sprintf("random-%d", m.nextID)
+}
+
+func (m *randomModel) add(conn *ldap.Connection, trk *tracker.Tracker) (string, error) {
+	cn := m.newCN()
+	container := m.rng.Intn(len(m.bases))
+	entry := &randomEntry{
+		dn:        fmt.Sprintf("cn=%s,%s", cn, m.bases[container]),
+		container: container,
+		attributes: map[string][]string{
+			"cn":          {cn},
+			"sn":          {m.word()},
+			"description": {m.word() + " " + m.word()},
+		},
+	}
+	for i := m.rng.Intn(3); i > 0; i-- {
+		entry.attributes["telephoneNumber"] = appendUnique(entry.attributes["telephoneNumber"], m.phone())
+	}
+	description := "add " + entry.dn
+
+	addRequest := ldaplib.NewAddRequest(entry.dn, nil)
+	addRequest.Attribute("objectClass", []string{"inetOrgPerson"})
+	for _, attribute := range randomAttributes {
+		if values := entry.attributes[attribute]; len(values) > 0 {
+			addRequest.Attribute(attribute, values)
+		}
+	}
+	if err := conn.Add(addRequest); err != nil {
+		return description, err
+	}
+
+	trk.Track(entry.dn, tracker.TypeUser)
+	m.entries = append(m.entries, entry)
+	m.counts["add"]++
+	return description, nil
+}
+
+func (m *randomModel) modify(conn *ldap.Connection) (string, error) {
+	entry := m.entries[m.rng.Intn(len(m.entries))]
+	modifyRequest := ldaplib.NewModifyRequest(entry.dn, nil)
+	phones := entry.attributes["telephoneNumber"]
+
+	var description string
+	var apply func()
+	switch choice := m.rng.Intn(4); {
+	case choice == 0:
+		value := m.word()
+		description = "replace sn of " + entry.dn
+		modifyRequest.Replace("sn", []string{value})
+		apply = func() { entry.attributes["sn"] = []string{value} }
+	case choice == 1:
+		value := m.word() + " " + m.word()
+		description = "replace description of " + entry.dn
+		modifyRequest.Replace("description", []string{value})
+		apply = func() { entry.attributes["description"] = []string{value} }
+	case choice == 2 || len(phones) == 0:
+		value := m.phone()
+		for containsFold(phones, value) {
+			value = m.phone()
+		}
+		description = "add telephoneNumber to " + entry.dn
+		modifyRequest.Add("telephoneNumber", []string{value})
+		apply = func() { entry.attributes["telephoneNumber"] = append(phones, value) }
+	default:
+		value := phones[m.rng.Intn(len(phones))]
+		description = "delete telephoneNumber from " + entry.dn
+		modifyRequest.Delete("telephoneNumber", []string{value})
+		apply = func() { entry.attributes["telephoneNumber"] = removeValue(phones, value) }
+	}
+
+	if err := conn.Modify(modifyRequest); err != nil {
+		return description, err
+	}
+	apply()
+	m.counts["modify"]++
+	return description, nil
+}
+
+// rename gives an entry a new RDN and, half of the time, moves it to the other container
+func (m *randomModel) rename(conn *ldap.Connection, trk *tracker.Tracker) (string, error) {
+	entry := m.entries[m.rng.Intn(len(m.entries))]
+	cn := m.newCN()
+	container := entry.container
+	newSuperior := ""
+	if m.rng.Intn(2) == 0 {
+		container = (container + 1) % len(m.bases)
+		newSuperior = m.bases[container]
+	}
+	newDN := fmt.Sprintf("cn=%s,%s", cn, m.bases[container])
+	description := fmt.Sprintf("rename %s to %s", entry.dn, newDN)
+
+	modifyDNRequest := ldaplib.NewModifyDNRequest(entry.dn, "cn="+cn, true, newSuperior)
+	if err := conn.ModifyDN(modifyDNRequest); err != nil {
+		return description, err
+	}
+
+	trk.Rename(entry.dn, newDN)
+	entry.dn = newDN
+	entry.container = container
+	entry.attributes["cn"] = []string{cn}
+	if newSuperior != "" {
+		m.counts["move"]++
+	} else {
+		m.counts["rename"]++
+	}
+	return description, nil
+}
+
+func (m *randomModel) delete(conn *ldap.Connection, trk *tracker.Tracker) (string, error) {
+	i := m.rng.Intn(len(m.entries))
+	entry := m.entries[i]
+	description := "delete " + entry.dn
+
+	if err := conn.Del(ldaplib.NewDelRequest(entry.dn, nil)); err != nil {
+		return description, err
+	}
+
+	trk.Remove(entry.dn)
+	m.entries = append(m.entries[:i], m.entries[i+1:]...)
+	m.counts["delete"]++
+	return description, nil
+}
+
+func testRandomConsistency(conn *ldap.Connection, model *randomModel, seed int64) TestResult {
+	testName := "Random Operations Consistency Test"
+	logger.Info("RandomTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Random",
+	}
+
+	expected := make(map[string]*randomEntry, len(model.entries))
+	for _, entry := range model.entries {
+		expected[strings.ToLower(entry.dn)] = entry
+	}
+
+	start := time.Now()
+	var problems []string
+	found := 0
+	for _, base := range model.bases {
+		logger.LogSearchOperation("Random", base, "(objectClass=*)", "one", randomAttributes)
+		searchRequest := ldaplib.NewSearchRequest(
+			base,
+			ldaplib.ScopeSingleLevel,
+			ldaplib.NeverDerefAliases,
+			0, 0, false,
+			"(objectClass=*)",
+			randomAttributes,
+			nil,
+		)
+
+		searchStart := time.Now()
+		sr, err := conn.GetConnection().SearchWithPaging(searchRequest, 500)
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Failed to read %s: %v", base, err)
+			logger.Error("RandomTest", result.Message)
+			return result
+		}
+		logger.LogSearchResult("Random", len(sr.Entries), time.Since(searchStart))
+
+		for _, actual := range sr.Entries {
+			entry, ok := expected[strings.ToLower(actual.DN)]
+			if !ok {
+				problems = append(problems, "unexpected entry "+actual.DN)
+				continue
+			}
+			found++
+			delete(expected, strings.ToLower(actual.DN))
+			for _, attribute := range randomAttributes {
+				want := sortedFold(entry.attributes[attribute])
+				got := sortedFold(actual.GetEqualFoldAttributeValues(attribute))
+				if strings.Join(want, "\x00") != strings.Join(got, "\x00") {
+					problems = append(problems, fmt.Sprintf("%s: %s is %q, expected %q", actual.DN, attribute, got, want))
+				}
+			}
+		}
+	}
+	for _, entry := range model.entries {
+		if _, missing := expected[strings.ToLower(entry.dn)]; missing {
+			problems = append(problems, "missing entry "+entry.dn)
+		}
+	}
+	result.Duration = time.Since(start)
+
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			logger.Error("RandomTest", "Inconsistency", "problem", problem)
+		}
+		shown := problems
+		if len(shown) > 5 {
+			shown = shown[:5]
+		}
+		result.Passed = false
+		result.Message = fmt.Sprintf("Directory differs from the expected state in %d places (seed %d): %s",
+			len(problems), seed, strings.Join(shown, "; "))
+		logger.Error("RandomTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("All %d entries match the expected state", found)
+	logger.Info("RandomTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+func appendUnique(values []string, value string) []string {
+	if containsFold(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeValue(values []string, value string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func sortedFold(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ToLower(v)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,390 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// FixtureReferral is provided when the referral object exists
+const FixtureReferral = "ou=ref-ou"
+
+// referralObject is the referral entry the tests create under the test OU,
+// and the URL it refers to: an entry beside it on the same server, so the
+// referral can be followed without a second server and without a loop
+type referralObject struct {
+	dn     string
+	target string
+	url    string
+}
+
+// TestReferral runs the referral object tests: a referral entry (RFC 3296) is
+// written and removed with the ManageDsaIT control, searches without it must
+// return the referral instead of the entry, and a search that follows the
+// referral must return the entry referred to
+func TestReferral(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
+	logger.Info("ReferralTest", "Starting referral object tests")
+
+	scheme := "ldap"
+	if conn.GetConfig().UseTLS {
+		scheme = "ldaps"
+	}
+	ref := referralObject{
+		dn:     fmt.Sprintf("ou=ref-ou,%s", testBaseDN),
+		target: fmt.Sprintf("cn=referral-target,%s", testBaseDN),
+	}
+	ref.url = fmt.Sprintf("%s://%s/%s", scheme, conn.HostPort(), ref.target)
+	results := h.Execute([]TestCase{
+		// Test 1: Add the referral object with ManageDsaIT
+		{Name: "Create Referral Object Test", Operation: "Referral", Needs: []Capability{CapabilityManageDsaIT}, Provides: FixtureReferral, Run: func() TestResult {
+			return testCreateReferral(conn, ref, trk)
+		}},
+
+		// Test 2: A subtree search over the referral object
+		{Name: "Search Continuation Reference Test", Operation: "Referral", Requires: []string{FixtureReferral}, Run: func() TestResult {
+			return testSearchContinuation(conn, testBaseDN, ref)
+		}},
+
+		// Test 3: A base search of the referral object
+		{Name: "Referral Result Test", Operation: "Referral", Requires: []string{FixtureReferral}, Run: func() TestResult {
+			return testReferralResult(conn, ref)
+		}},
+
+		// Test 4: Searches that follow the referral
+		{Name: "Search Following Referrals Test", Operation: "Referral", Requires: []string{FixtureReferral}, Run: func() TestResult {
+			return testSearchFollowingReferrals(conn, testBaseDN, ref)
+		}},
+
+		// Test 5: Delete the referral object with ManageDsaIT
+		{Name: "Delete Referral Object Test", Operation: "Referral", Requires: []string{FixtureReferral}, Needs: []Capability{CapabilityManageDsaIT}, Run: func() TestResult {
+			return testDeleteReferral(conn, ref)
+		}},
+	})
+
+	logger.Info("ReferralTest", "Completed referral object tests", "total", len(results))
+	return results
+}
+
+func testCreateReferral(conn *ldap.Connection, ref referralObject, trk *tracker.Tracker) TestResult {
+	testName := "Create Referral Object Test"
+	logger.Info("ReferralTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Referral",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("ReferralTest", result.Message)
+		return result
+	}
+
+	targetRequest := ldaplib.NewAddRequest(ref.target, nil)
+	targetRequest.Attribute("objectClass", []string{"inetOrgPerson"})
+	targetRequest.Attribute("cn", []string{"referral-target"})
+	targetRequest.Attribute("sn", []string{"Referral"})
+	if err := createEntry(conn, targetRequest); err != nil {
+		return fail(err, fmt.Sprintf("Failed to create referral target entry: %v", err))
+	}
+	trk.Track(ref.target, tracker.TypeUser)
+
+	// Without ManageDsaIT a server may refer the add itself to the new entry
+	addRequest := ldaplib.NewAddRequest(ref.dn, []ldaplib.Control{ldaplib.NewControlManageDsaIT(true)})
+	addRequest.Attribute("objectClass", []string{"referral", "extensibleObject"})
+	addRequest.Attribute("ou", []string{"ref-ou"})
+	addRequest.Attribute("ref", []string{ref.url})
+
+	logger.Trace("Referral", "Operation: Add (ManageDsaIT)", "dn", ref.dn, "ref", ref.url)
+	start := time.Now()
+	err := createEntry(conn, addRequest)
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		logger.LogLDAPResult("Referral", "Add", false, -1, err.Error(), result.Duration)
+		return fail(err, fmt.Sprintf("Failed to create referral object: %v", err))
+	}
+	logger.LogLDAPResult("Referral", "Add", true, 0, "Success", result.Duration)
+	trk.Track(ref.dn, tracker.TypeReferral)
+
+	entry, err := readReferralObject(conn, ref.dn)
+	if err != nil {
+		return fail(err, fmt.Sprintf("Referral object created but reading it with ManageDsaIT failed: %v", err))
+	}
+	if !hasValue(entry, "ref", ref.url) {
+		return fail(nil, fmt.Sprintf("Referral object created but its ref is %v, expected %s", entry.GetAttributeValues("ref"), ref.url))
+	}
+
+	result.Passed = true
+	result.Message = "Referral object created with ManageDsaIT, refers to " + ref.url
+	logger.Info("ReferralTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// testSearchContinuation searches the test OU without ManageDsaIT; the server
+// must return a continuation reference for the referral object, not the entry
+func testSearchContinuation(conn *ldap.Connection, testBaseDN string, ref referralObject) TestResult {
+	testName := "Search Continuation Reference Test"
+	logger.Info("ReferralTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Referral",
+	}
+
+	searchRequest := ldaplib.NewSearchRequest(
+		testBaseDN,
+		ldaplib.ScopeWholeSubtree,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		[]string{"1.1"},
+		nil,
+	)
+
+	logger.LogSearchOperation("Referral", testBaseDN, "(objectClass=*)", "sub", []string{"1.1"})
+	start := time.Now()
+	searchResult, err := conn.SearchWithReferrals(searchRequest, false)
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Search failed: %v", err)
+		logger.LogLDAPResult("Referral", "Search", false, -1, err.Error(), result.Duration)
+		logger.Error("ReferralTest", result.Message)
+		return result
+	}
+	logger.LogSearchResult("Referral", len(searchResult.Entries), result.Duration)
+
+	for _, entry := range searchResult.Entries {
+		if sameDN(entry.DN, ref.dn) {
+			result.Passed = false
+			result.Message = "Search without ManageDsaIT returned the referral object as an entry"
+			logger.Error("ReferralTest", result.Message)
+			return result
+		}
+	}
+	if !hasReferral(searchResult.Referrals, ref.url) {
+		result.Passed = false
+		result.Message = fmt.Sprintf("Search returned no continuation reference to %s (references: %v)", ref.url, searchResult.Referrals)
+		logger.Error("ReferralTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Search returned %d entries and a continuation reference to %s", len(searchResult.Entries), ref.url)
+	logger.Info("ReferralTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// testReferralResult reads the referral object without ManageDsaIT; the
+// server must answer with the referral result code and the URL
+func testReferralResult(conn *ldap.Connection, ref referralObject) TestResult {
+	testName := "Referral Result Test"
+	logger.Info("ReferralTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Referral",
+	}
+
+	searchRequest := ldaplib.NewSearchRequest(
+		ref.dn,
+		ldaplib.ScopeBaseObject,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		[]string{"1.1"},
+		nil,
+	)
+
+	logger.LogSearchOperation("Referral", ref.dn, "(objectClass=*)", "base", []string{"1.1"})
+	start := time.Now()
+	searchResult, err := conn.SearchWithReferrals(searchRequest, false)
+	result.Duration = time.Since(start)
+
+	if err == nil {
+		logger.LogSearchResult("Referral", len(searchResult.Entries), result.Duration)
+		result.Passed = false
+		result.Message = "Base search without ManageDsaIT succeeded instead of returning a referral"
+		logger.Error("ReferralTest", result.Message)
+		return result
+	}
+	if !ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultReferral) {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Base search failed, expected a referral: %v", err)
+		logger.LogLDAPResult("Referral", "Search", false, -1, err.Error(), result.Duration)
+		logger.Error("ReferralTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("Referral", "Search", true, ldaplib.LDAPResultReferral, "Referral", result.Duration)
+
+	urls := ldap.ReferralURLs(err)
+	if !hasReferral(urls, ref.url) {
+		result.Passed = false
+		result.Message = fmt.Sprintf("Base search returned a referral, but not to %s (referral: %v)", ref.url, urls)
+		logger.Error("ReferralTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = "Base search returned a referral to " + ref.url
+	logger.Info("ReferralTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// testSearchFollowingReferrals repeats both searches following the referrals,
+// with the bind referral_credentials asks for: the base search must return
+// the entry referred to instead of the referral, and the subtree search must
+// leave no continuation reference unresolved
+func testSearchFollowingReferrals(conn *ldap.Connection, testBaseDN string, ref referralObject) TestResult {
+	testName := "Search Following Referrals Test"
+	logger.Info("ReferralTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Referral",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("ReferralTest", result.Message)
+		return result
+	}
+
+	credentials := conn.GetConfig().ReferralCredentials
+	if credentials == "" {
+		credentials = "anonymous"
+	}
+
+	baseRequest := ldaplib.NewSearchRequest(
+		ref.dn,
+		ldaplib.ScopeBaseObject,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		[]string{"1.1"},
+		nil,
+	)
+
+	logger.LogSearchOperation("Referral", ref.dn, "(objectClass=*)", "base (following referrals)", []string{"1.1"})
+	start := time.Now()
+	searchResult, err := conn.SearchWithReferrals(baseRequest, true)
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		logger.LogLDAPResult("Referral", "Search", false, -1, err.Error(), result.Duration)
+		return fail(err, fmt.Sprintf("Base search following the referral failed (referral_credentials: %s): %v", credentials, err))
+	}
+	logger.LogSearchResult("Referral", len(searchResult.Entries), result.Duration)
+	if len(searchResult.Entries) != 1 || !sameDN(searchResult.Entries[0].DN, ref.target) {
+		return fail(nil, fmt.Sprintf("Base search following the referral returned %d entries, expected %s (referral_credentials: %s)", len(searchResult.Entries), ref.target, credentials))
+	}
+
+	subtreeRequest := ldaplib.NewSearchRequest(
+		testBaseDN,
+		ldaplib.ScopeWholeSubtree,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		[]string{"1.1"},
+		nil,
+	)
+
+	logger.LogSearchOperation("Referral", testBaseDN, "(objectClass=*)", "sub (following referrals)", []string{"1.1"})
+	searchResult, err = conn.SearchWithReferrals(subtreeRequest, true)
+	if err != nil {
+		return fail(err, fmt.Sprintf("Subtree search following the referrals failed: %v", err))
+	}
+	if len(searchResult.Referrals) > 0 {
+		return fail(nil, fmt.Sprintf("Subtree search following the referrals left %d unresolved: %v", len(searchResult.Referrals), searchResult.Referrals))
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Referral followed to %s with %s credentials, no continuation reference left unresolved", ref.target, credentials)
+	logger.Info("ReferralTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+func testDeleteReferral(conn *ldap.Connection, ref referralObject) TestResult {
+	testName := "Delete Referral Object Test"
+	logger.Info("ReferralTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Referral",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("ReferralTest", result.Message)
+		return result
+	}
+
+	logger.Trace("Referral", "Operation: Delete (ManageDsaIT)", "dn", ref.dn)
+	start := time.Now()
+	err := conn.Del(ldaplib.NewDelRequest(ref.dn, []ldaplib.Control{ldaplib.NewControlManageDsaIT(true)}))
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		logger.LogLDAPResult("Referral", "Delete", false, -1, err.Error(), result.Duration)
+		return fail(err, fmt.Sprintf("Failed to delete referral object: %v", err))
+	}
+	logger.LogLDAPResult("Referral", "Delete", true, 0, "Success", result.Duration)
+
+	// A referral object still in place answers the read with a referral
+	if err := verifyAbsent(conn, ref.dn); err != nil {
+		return fail(err, fmt.Sprintf("Delete with ManageDsaIT succeeded but the referral object remains: %v", err))
+	}
+
+	result.Passed = true
+	result.Message = "Referral object deleted with ManageDsaIT"
+	logger.Info("ReferralTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// readReferralObject reads a referral object itself rather than the referral
+func readReferralObject(conn *ldap.Connection, dn string) (*ldaplib.Entry, error) {
+	searchRequest := ldaplib.NewSearchRequest(
+		dn,
+		ldaplib.ScopeBaseObject,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		[]string{"*"},
+		[]ldaplib.Control{ldaplib.NewControlManageDsaIT(true)},
+	)
+	result, err := conn.GetConnection().Search(searchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dn, err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, fmt.Errorf("expected 1 entry for %s, got %d", dn, len(result.Entries))
+	}
+	return result.Entries[0], nil
+}
+
+// hasReferral reports whether one of urls refers to url. A server may append
+// the scope or filter of the search to the URL of a continuation reference.
+func hasReferral(urls []string, url string) bool {
+	for _, u := range urls {
+		if len(u) >= len(url) && strings.EqualFold(u[:len(url)], url) {
+			return true
+		}
+	}
+	return false
+}
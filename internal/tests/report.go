@@ -0,0 +1,351 @@
+package tests
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/logger"
+)
+
+// jsonReport is the --report-format json document of a run
+type jsonReport struct {
+	Name        string         `json:"name"`
+	RunID       string         `json:"run_id"`
+	ToolVersion string         `json:"tool_version"`
+	Hostname    string         `json:"hostname"`
+	ConfigHash  string         `json:"config_hash"`
+	Server      jsonServer     `json:"server"`
+	AuditLog    string         `json:"audit_log,omitempty"`
+	CleanupLDIF string         `json:"cleanup_ldif,omitempty"` // delete records of the preserved test data
+	StartTime   time.Time      `json:"start_time"`
+	EndTime     time.Time      `json:"end_time"`
+	DurationMS  int64          `json:"duration_ms"`
+	Status      string         `json:"status"` // pass or fail
+	Summary     jsonSummary    `json:"summary"`
+	Interrupted bool           `json:"interrupted"`
+	Reason      string         `json:"interrupt_reason,omitempty"`
+	Security    []jsonSecurity `json:"security,omitempty"`
+	Workers     []jsonWorker   `json:"workers,omitempty"`
+	Results     []jsonResult   `json:"results"`
+}
+
+type jsonServer struct {
+	Address       string `json:"address"`
+	Security      string `json:"security"`
+	VendorName    string `json:"vendor_name,omitempty"`
+	VendorVersion string `json:"vendor_version,omitempty"`
+	Vendor        string `json:"vendor,omitempty"` // product detected from the root DSE
+}
+
+type jsonSummary struct {
+	Total       int `json:"total"`
+	Passed      int `json:"passed"`
+	Failed      int `json:"failed"`
+	Skipped     int `json:"skipped"`
+	NotExecuted int `json:"not_executed"` // skipped because a time budget ran out
+}
+
+type jsonSecurity struct {
+	Name    string `json:"name"`
+	Result  string `json:"result"`
+	Concern bool   `json:"concern"`
+}
+
+type jsonWorker struct {
+	ID         int    `json:"id"`
+	Total      int    `json:"total"`
+	Passed     int    `json:"passed"`
+	Failed     int    `json:"failed"`
+	Skipped    int    `json:"skipped"`
+	DurationMS int64  `json:"duration_ms"`
+	TestTimeMS int64  `json:"test_time_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+type jsonResult struct {
+	Name           string `json:"name"`
+	Operation      string `json:"operation"`
+	Status         string `json:"status"` // pass, fail or skip
+	Passed         bool   `json:"passed"`
+	Skipped        bool   `json:"skipped"`
+	DurationMS     int64  `json:"duration_ms"`
+	Error          string `json:"error,omitempty"`
+	Message        string `json:"message,omitempty"`
+	BudgetExceeded bool   `json:"budget_exceeded,omitempty"`
+	Worker         int    `json:"worker,omitempty"`
+	Retries        int    `json:"retries,omitempty"`
+}
+
+// newJSONReport builds the JSON document of a finished suite
+func newJSONReport(suite *TestSuite, cleanupLDIF string) jsonReport {
+	total, passed, failed, skipped, duration := suite.GetStats()
+	notExecuted, _ := suite.GetBudgetExceeded()
+	meta := suite.Metadata
+
+	report := jsonReport{
+		Name:        suite.Name,
+		RunID:       meta.RunID,
+		ToolVersion: meta.ToolVersion,
+		Hostname:    meta.Hostname,
+		ConfigHash:  meta.ConfigHash,
+		Server: jsonServer{
+			Address:       meta.Server.Address,
+			Security:      meta.Server.Security,
+			VendorName:    meta.Server.VendorName,
+			VendorVersion: meta.Server.VendorVersion,
+			Vendor:        string(meta.Server.Vendor),
+		},
+		AuditLog:    meta.AuditLog,
+		CleanupLDIF: cleanupLDIF,
+		StartTime:   suite.StartTime,
+		EndTime:     suite.EndTime,
+		DurationMS:  duration.Milliseconds(),
+		Status:      "pass",
+		Summary: jsonSummary{
+			Total:       total,
+			Passed:      passed,
+			Failed:      failed,
+			Skipped:     skipped,
+			NotExecuted: notExecuted,
+		},
+		Interrupted: suite.Interrupted,
+		Reason:      suite.InterruptReason,
+		Results:     make([]jsonResult, 0, len(suite.Results)),
+	}
+	if !suite.AllPassed() {
+		report.Status = "fail"
+	}
+
+	for _, check := range suite.Security {
+		report.Security = append(report.Security, jsonSecurity{Name: check.Name, Result: check.Result, Concern: check.Concern})
+	}
+	for _, w := range suite.Workers {
+		report.Workers = append(report.Workers, jsonWorker{
+			ID:         w.ID,
+			Total:      w.Total,
+			Passed:     w.Passed,
+			Failed:     w.Failed,
+			Skipped:    w.Skipped,
+			DurationMS: w.Duration.Milliseconds(),
+			TestTimeMS: w.TestTime.Milliseconds(),
+			Error:      w.Error,
+		})
+	}
+	for _, result := range suite.Results {
+		entry := jsonResult{
+			Name:           result.Name,
+			Operation:      result.Operation,
+			Status:         resultStatus(result),
+			Passed:         result.Passed,
+			Skipped:        result.Skipped,
+			DurationMS:     result.Duration.Milliseconds(),
+			Message:        result.Message,
+			BudgetExceeded: result.BudgetExceeded,
+			Worker:         result.Worker,
+			Retries:        result.Retries,
+		}
+		if result.Error != nil {
+			entry.Error = result.Error.Error()
+		}
+		report.Results = append(report.Results, entry)
+	}
+	return report
+}
+
+// WriteJSONReport writes the suite as an indented JSON document
+func WriteJSONReport(w io.Writer, suite *TestSuite, cleanupLDIF string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(newJSONReport(suite, cleanupLDIF)); err != nil {
+		return fmt.Errorf("failed to write JSON report: %w", err)
+	}
+	return nil
+}
+
+// writeReport writes the report of the configured format to the report file,
+// or to the report output (stdout) if no file is configured
+func (r *Runner) writeReport() error {
+	var write func(w io.Writer) error
+	switch r.config.ReportFormat {
+	case "json":
+		write = func(w io.Writer) error { return WriteJSONReport(w, r.suite, r.cleanupLDIF) }
+	case "html":
+		write = func(w io.Writer) error { return WriteHTMLReport(w, r.suite) }
+	default:
+		write = func(w io.Writer) error { return WriteJUnitReport(w, r.suite) }
+	}
+
+	if r.config.ReportFile == "" {
+		return write(r.reportOutput())
+	}
+
+	file, err := os.OpenFile(r.config.ReportFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create report file: %w", err)
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write report file: %w", err)
+	}
+
+	logger.Info("TestRunner", "Wrote report", "format", r.config.ReportFormat, "file", r.config.ReportFile)
+	return nil
+}
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the tests of one operation (and worker, when run concurrently)
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Hostname   string          `xml:"hostname,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// newJUnitReport builds the JUnit document of a finished suite, with a
+// testsuite element per operation in the order the operations ran
+func newJUnitReport(suite *TestSuite) junitTestSuites {
+	total, _, failed, skipped, duration := suite.GetStats()
+	meta := suite.Metadata
+	properties := []junitProperty{
+		{Name: "run_id", Value: meta.RunID},
+		{Name: "tool_version", Value: meta.ToolVersion},
+		{Name: "config_hash", Value: meta.ConfigHash},
+		{Name: "server", Value: meta.Server.Address},
+		{Name: "security", Value: meta.Server.Security},
+	}
+	if suite.Interrupted {
+		properties = append(properties, junitProperty{Name: "interrupted", Value: suite.InterruptReason})
+	}
+
+	report := junitTestSuites{
+		Name:     suite.Name,
+		Tests:    total,
+		Failures: failed,
+		Skipped:  skipped,
+		Time:     junitSeconds(duration),
+	}
+
+	index := make(map[string]int)
+	var durations []time.Duration
+	for _, result := range suite.Results {
+		name := result.Operation
+		if result.Worker > 0 {
+			name = fmt.Sprintf("%s (worker %d)", result.Operation, result.Worker)
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(report.Suites)
+			index[name] = i
+			report.Suites = append(report.Suites, junitTestSuite{
+				Name:       name,
+				Timestamp:  suite.StartTime.Format("2006-01-02T15:04:05"),
+				Hostname:   meta.Hostname,
+				Properties: properties,
+			})
+			durations = append(durations, 0)
+		}
+		durations[i] += result.Duration
+
+		ts := &report.Suites[i]
+		tc := junitTestCase{
+			Name:      result.Name,
+			Classname: "ldap." + strings.ReplaceAll(result.Operation, " ", ""),
+			Time:      junitSeconds(result.Duration),
+			SystemOut: result.Message,
+		}
+		switch {
+		case result.Skipped:
+			tc.Skipped = &junitMessage{Message: result.Message}
+			tc.SystemOut = ""
+			ts.Skipped++
+		case !result.Passed:
+			failure := &junitMessage{Message: "test failed"}
+			if result.Error != nil {
+				failure.Message = result.Error.Error()
+				failure.Text = result.Error.Error()
+			}
+			tc.Failure = failure
+			ts.Failures++
+		}
+		ts.Tests++
+		ts.Cases = append(ts.Cases, tc)
+	}
+	for i := range report.Suites {
+		report.Suites[i].Time = junitSeconds(durations[i])
+	}
+	return report
+}
+
+// junitSeconds formats a duration as the seconds JUnit expects
+func junitSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// WriteJUnitReport writes the suite as a JUnit XML document, which CI
+// servers such as Jenkins and GitLab render natively
+func WriteJUnitReport(w io.Writer, suite *TestSuite) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(newJUnitReport(suite)); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	return nil
+}
+
+// reportOutput returns where reports written to stdout go
+func (r *Runner) reportOutput() io.Writer {
+	if r.reportOut == nil {
+		return os.Stdout
+	}
+	return r.reportOut
+}
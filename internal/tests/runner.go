@@ -1,19 +1,28 @@
 package tests
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
-	"syscall"
 	"time"
 
 	"ldap-automated-actions/internal/config"
+	"ldap-automated-actions/internal/health"
 	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/ldif"
 	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/schedule"
 	"ldap-automated-actions/internal/tracker"
+	"ldap-automated-actions/internal/version"
 
 	ldaplib "github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
 )
 
 // LoopStats tracks statistics across multiple test runs
@@ -24,47 +33,283 @@ type LoopStats struct {
 	TotalTests     int
 	TotalPassed    int
 	TotalFailed    int
+	TotalSkipped   int
 	TotalDuration  time.Duration
 	StartTime      time.Time
+	FirstTelemetry health.Telemetry // tool telemetry after the first iteration, the baseline for leak checks
+	LastTelemetry  health.Telemetry
+	Tests          *flakyTracker // pass/fail of each test across the iterations
 }
 
 // Runner orchestrates the execution of all LDAP tests
 type Runner struct {
-	config  *config.Config
-	conn    *ldap.Connection
-	tracker *tracker.Tracker
-	suite   *TestSuite
-	loopStats *LoopStats
+	config      *config.Config
+	conn        *ldap.Connection
+	tracker     *tracker.Tracker
+	suite       *TestSuite
+	loopStats   *LoopStats
+	events      *EventStream
+	health      *health.Server
+	metrics     *health.Metrics // Prometheus metrics of serve mode, nil otherwise
+	runs        *health.Runs    // runs of the runs API in serve mode, nil otherwise
+	testSuite   string          // suite of the current run: test_suite, or the one requested through the runs API
+	progress    *Progress       // persisted run state, nil when not saved (loop and dry-run modes)
+	audit       *ldap.AuditLog  // audit trail of write operations, nil if disabled
+	testBaseDN  string          // test OU of the current run; cleanup never leaves it
+	cleanupLDIF string          // LDIF of delete records for the preserved test data, if written
+	cancelCause error           // why the run context was cancelled, if it was
+	reportOut   io.Writer       // stdout of the JSON report, os.Stdout if not set
+	iteration   int             // current loop iteration, 0 outside loop mode
+	pool        *ldap.Pool      // connections the suites borrow while tests execute
+	plan        *ldap.Plan      // write operations of a dry run with dry_run_ldif, nil otherwise
+	planFile    *os.File        // file of the plan, nil when it is written to stdout
+	cleaned     bool            // whether the last run removed its test data
+	security    []SecurityCheck // security posture findings, assessed once per invocation
 }
 
 // NewRunner creates a new test runner
 func NewRunner(cfg *config.Config) *Runner {
-	return &Runner{
-		config:  cfg,
-		tracker: tracker.NewTracker(),
-		suite: &TestSuite{
-			Name:    "LDAP Operations Test Suite",
-			Results: make([]TestResult, 0),
-		},
+	hostname, _ := os.Hostname()
+
+	r := &Runner{
+		config:    cfg,
+		testSuite: string(cfg.TestSuite),
+		tracker:   tracker.NewTracker(),
 		loopStats: &LoopStats{
 			StartTime: time.Now(),
+			Tests:     newFlakyTracker(),
+		},
+	}
+	r.suite = &TestSuite{
+		Name:    "LDAP Operations Test Suite",
+		Results: make([]TestResult, 0),
+		Metadata: RunMetadata{
+			RunID:       uuid.NewString(),
+			ToolVersion: version.Version,
+			Hostname:    hostname,
+			ConfigHash:  cfg.Hash(),
 		},
 	}
+	return r
 }
 
-// Run executes the complete test suite
-func (r *Runner) Run() error {
+// Resume continues the run with the given ID from its saved progress instead
+// of starting over, re-using its test OU and skipping completed suites
+func (r *Runner) Resume(runID string) error {
+	progress, err := LoadProgress(r.config.StateDir, runID)
+	if err != nil {
+		return err
+	}
+
+	if progress.ConfigHash != r.suite.Metadata.ConfigHash {
+		logger.Warn("TestRunner", "Configuration changed since the run was started", "runID", runID)
+	}
+	logger.Info("TestRunner", "Resuming run", "runID", runID, "testBaseDN", progress.TestBaseDN, "completedSuites", progress.CompletedSuites)
+
+	// The manifest also has the entries tracked after the progress was last saved
+	if m, err := tracker.ReadManifest(manifestPath(r.config.StateDir, runID)); err == nil && m.TestBaseDN == progress.TestBaseDN {
+		progress.Entries = m.Entries
+	}
+
+	r.progress = progress
+	r.suite.Metadata.RunID = runID
+	return nil
+}
+
+// SetEventStream streams an event for each completed test to stream
+func (r *Runner) SetEventStream(stream *EventStream) {
+	stream.meta = r.suite.Metadata
+	r.events = stream
+}
+
+// SetReportOutput sets where a JSON report without a report file is written,
+// for when os.Stdout has been redirected to keep human-readable output apart
+func (r *Runner) SetReportOutput(w io.Writer) {
+	r.reportOut = w
+}
+
+// Run executes the complete test suite. Cancelling ctx aborts the in-flight
+// LDAP operation, skips the remaining tests, runs cleanup and reports partial results.
+func (r *Runner) Run(ctx context.Context) error {
+	// Enforce the run time budget across all iterations
+	if budget := r.config.GetMaxRunDuration(); budget > 0 {
+		logger.Info("TestRunner", "Run time budget", "maxRunDuration", budget)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, budget, &budgetExceeded{scope: "run", budget: budget})
+		defer cancel()
+	}
+
+	// Record the tracked entries on disk so a killed run can be cleaned up
+	if !r.config.DryRun && !r.config.ReadOnly {
+		defer r.openManifest()()
+	}
+
 	// Check if loop mode is enabled
 	if r.config.Loop {
-		return r.RunLoop()
+		return r.RunLoop(ctx)
+	}
+
+	// Persist progress so an interrupted run can be resumed; concurrent
+	// workers complete suites out of order, so their runs are not saved
+	if r.progress == nil && !r.config.DryRun && r.config.Concurrent <= 1 {
+		r.progress = &Progress{
+			RunID:      r.suite.Metadata.RunID,
+			ConfigHash: r.suite.Metadata.ConfigHash,
+		}
 	}
 
 	// Single run mode
-	return r.runOnce()
+	err := r.runOnce(ctx)
+	r.recordHistory(err)
+	r.notify(err)
+	return err
+}
+
+// Apply applies an LDIF changelog against the directory and verifies each change
+func (r *Runner) Apply(path string) error {
+	logger.Info("TestRunner", "Starting LDIF apply-and-verify", "file", path)
+	r.suite.Name = "LDIF Apply and Verify"
+	r.suite.StartTime = time.Now()
+
+	records, err := ldif.ParseFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to parse LDIF: %w", err)
+	}
+	logger.Info("TestRunner", "Parsed LDIF change records", "records", len(records))
+
+	if r.config.DryRun {
+		for _, record := range records {
+			logger.Info("Apply", "DRY RUN: Would apply record", "changetype", record.ChangeType, "dn", record.DN, "line", record.Line)
+		}
+		return nil
+	}
+
+	if err := r.connect(); err != nil {
+		r.suite.EndTime = time.Now()
+		r.events.RunEnd(r.suite, err)
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer r.cleanup()
+
+	r.suite.Results = ApplyLDIF(r.conn, records, r.config.ApplyContinueOnError)
+	r.suite.EndTime = time.Now()
+	r.reportResults()
+
+	return nil
+}
+
+// Snapshot exports the subtree under baseDN to an LDIF file
+func (r *Runner) Snapshot(baseDN, path string) error {
+	logger.Info("TestRunner", "Starting subtree snapshot", "baseDN", baseDN, "file", path)
+
+	if err := r.connect(); err != nil {
+		r.suite.EndTime = time.Now()
+		r.events.RunEnd(r.suite, err)
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer r.cleanup()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer file.Close()
+
+	count, err := SnapshotSubtree(r.conn, baseDN, ldif.NewWriter(file), r.config.SnapshotExcludeAttributes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nSnapshot of %s written to %s (%d entries)\n", baseDN, path, count)
+	return nil
+}
+
+// CleanupOlderThan deletes the test OUs under the base DN older than the
+// configured age and reports what was removed
+func (r *Runner) CleanupOlderThan() error {
+	olderThan := r.config.GetCleanupOlderThan()
+	logger.Info("TestRunner", "Starting cleanup of old test data", "olderThan", r.config.CleanupOlderThan)
+
+	if err := r.connect(); err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer r.cleanup()
+
+	stale, err := CleanupOlderThan(r.conn, r.config.BaseDN, r.config.TestPrefix, olderThan, r.config.GetLockStaleAfter(), r.config.DryRun)
+	if err != nil {
+		return err
+	}
+
+	if len(stale) == 0 {
+		fmt.Printf("\nNo test OUs older than %s under %s\n", r.config.CleanupOlderThan, r.config.BaseDN)
+		return nil
+	}
+
+	fmt.Printf("\nTest OUs older than %s under %s:\n", r.config.CleanupOlderThan, r.config.BaseDN)
+	deleted, failed := 0, 0
+	for _, ou := range stale {
+		age := time.Since(ou.Created).Round(time.Minute)
+		switch {
+		case r.config.DryRun:
+			fmt.Printf("  - %s (created %s, %s ago): would be deleted\n", ou.DN, ou.Created.Format(time.DateTime), age)
+		case ou.Error != nil:
+			failed++
+			fmt.Printf("  ✗ %s (created %s, %s ago): %d entries deleted, then failed: %v\n", ou.DN, ou.Created.Format(time.DateTime), age, ou.Deleted, ou.Error)
+		default:
+			fmt.Printf("  ✓ %s (created %s, %s ago): %d entries deleted\n", ou.DN, ou.Created.Format(time.DateTime), age, ou.Deleted)
+		}
+		deleted += ou.Deleted
+	}
+
+	if r.config.DryRun {
+		fmt.Printf("\nDRY RUN: %d test OUs would be deleted\n", len(stale))
+		return nil
+	}
+	fmt.Printf("\nRemoved %d entries in %d test OUs\n", deleted, len(stale)-failed)
+	logger.Info("Cleanup", "Cleanup of old test data complete", "testOUs", len(stale), "failed", failed, "entriesDeleted", deleted)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d test OUs could not be deleted completely", failed, len(stale))
+	}
+	return nil
+}
+
+// Restore re-creates the entries of an LDIF snapshot
+func (r *Runner) Restore(path string) error {
+	logger.Info("TestRunner", "Starting snapshot restore", "file", path)
+	r.suite.Name = "Snapshot Restore"
+	r.suite.StartTime = time.Now()
+
+	records, err := ldif.ParseFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+
+	if r.config.DryRun {
+		for _, record := range records {
+			logger.Info("Restore", "DRY RUN: Would restore entry", "dn", record.DN)
+		}
+		return nil
+	}
+
+	if err := r.connect(); err != nil {
+		r.suite.EndTime = time.Now()
+		r.events.RunEnd(r.suite, err)
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer r.cleanup()
+
+	r.suite.Results = RestoreSnapshot(r.conn, records)
+	r.suite.EndTime = time.Now()
+	r.reportResults()
+
+	return nil
 }
 
 // RunLoop executes tests continuously with statistics tracking
-func (r *Runner) RunLoop() error {
+func (r *Runner) RunLoop(ctx context.Context) error {
 	logger.Info("TestRunner", "Starting LDAP operations test suite in LOOP mode")
 
 	if r.config.LoopCount > 0 {
@@ -73,32 +318,50 @@ func (r *Runner) RunLoop() error {
 		logger.Info("TestRunner", "Running indefinitely (Ctrl+C to stop)")
 	}
 
-	if r.config.LoopDelay > 0 {
-		logger.Info("TestRunner", "Delay between iterations", "seconds", r.config.LoopDelay)
+	if r.config.LoopDelay > 0 || r.config.LoopJitter > 0 {
+		logger.Info("TestRunner", "Delay between iterations", "seconds", r.config.LoopDelay, "jitterSeconds", r.config.LoopJitter)
 	}
 
-	// Setup signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	stopChan := make(chan bool)
+	// A schedule replaces the loop delay: each iteration waits for the next match
+	var sched *schedule.Schedule
+	var rolling *rollingStats
+	if r.config.Schedule != "" {
+		var err error
+		if sched, err = schedule.Parse(r.config.Schedule); err != nil {
+			return err
+		}
+		rolling = &rollingStats{window: r.config.GetStatsWindow()}
+		logger.Info("TestRunner", "Running on a schedule", "schedule", sched.String(), "statsWindow", rolling.window)
+	}
 
-	go func() {
-		<-sigChan
-		logger.Info("TestRunner", "Received interrupt signal, stopping after current iteration...")
-		stopChan <- true
-	}()
+	if r.config.HealthAddr != "" {
+		server, err := health.Start(r.config.HealthAddr, nil, nil)
+		if err != nil {
+			return fmt.Errorf("failed to start health endpoint: %w", err)
+		}
+		defer server.Close()
+		r.health = server
+	}
+	if r.config.Serve != "" {
+		r.metrics = health.NewMetrics()
+		r.runs = health.NewRuns(runSuiteValidator(*r.config))
+		server, err := health.Start(r.config.Serve, r.metrics, r.runs)
+		if err != nil {
+			return fmt.Errorf("failed to start metrics endpoint: %w", err)
+		}
+		defer server.Close()
+		r.health = server
+	}
 
 	iteration := 0
 	for {
 		iteration++
 
 		// Check if we should stop
-		select {
-		case <-stopChan:
+		if ctx.Err() != nil {
 			logger.Info("TestRunner", "Stopping loop mode")
 			r.reportLoopStats()
 			return nil
-		default:
 		}
 
 		// Check iteration limit
@@ -108,10 +371,32 @@ func (r *Runner) RunLoop() error {
 			return nil
 		}
 
+		if sched != nil && !waitForSchedule(ctx, sched, r.runs.Triggered()) {
+			continue
+		}
+
+		// A run requested through the runs API goes first, with its own suite
+		runID, testSuite, requested := r.runs.Next()
+		if !requested {
+			trigger := "loop"
+			if sched != nil {
+				trigger = "schedule"
+			}
+			runID, testSuite = r.runs.Begin(trigger, string(r.config.TestSuite)), string(r.config.TestSuite)
+		}
+		if testSuite == "" {
+			testSuite = string(r.config.TestSuite)
+		}
+		r.testSuite = testSuite
+		r.runs.Start(runID, testSuite, iteration)
+		stopRunLog := r.startRunLog(iteration)
+
 		logger.Info("TestRunner", fmt.Sprintf("=== Starting iteration %d ===", iteration))
 
 		// Run single test iteration
-		err := r.runOnce()
+		r.iteration = iteration
+		r.events.SetIteration(iteration)
+		err := r.runOnce(ctx)
 
 		// Update statistics
 		r.loopStats.TotalRuns++
@@ -123,64 +408,253 @@ func (r *Runner) RunLoop() error {
 		}
 
 		// Aggregate test statistics
-		total, passed, failed, duration := r.suite.GetStats()
+		total, passed, failed, skipped, duration := r.suite.GetStats()
 		r.loopStats.TotalTests += total
 		r.loopStats.TotalPassed += passed
 		r.loopStats.TotalFailed += failed
+		r.loopStats.TotalSkipped += skipped
 		r.loopStats.TotalDuration += duration
+		r.loopStats.Tests.add(r.suite.Results)
+
+		// Sample the tool's own resource usage once the iteration has closed its connections
+		telemetry := health.ReadTelemetry(ldap.OpenConnections())
+		if iteration == 1 {
+			r.loopStats.FirstTelemetry = telemetry
+		}
+		r.loopStats.LastTelemetry = telemetry
+		logger.Info("TestRunner", "Tool telemetry", "heapAlloc", telemetry.HeapAllocBytes, "sys", telemetry.SysBytes,
+			"goroutines", telemetry.Goroutines, "openConnections", telemetry.OpenConnections, "gcCycles", telemetry.GCCycles, "gcPauseTotalMS", telemetry.GCPauseTotalMS)
+
+		status := health.Status{
+			RunID:      r.suite.Metadata.RunID,
+			Iteration:  iteration,
+			Healthy:    err == nil && r.suite.AllPassed(),
+			StartTime:  r.suite.StartTime,
+			EndTime:    r.suite.EndTime,
+			DurationMS: duration.Milliseconds(),
+			Total:      total,
+			Passed:     passed,
+			Failed:     failed,
+			Skipped:    skipped,
+			Telemetry:  telemetry,
+		}
+		if err != nil {
+			status.Error = err.Error()
+		}
+		r.health.Update(status)
+		for _, result := range r.suite.Results {
+			r.metrics.ObserveTest(result.Operation, resultStatus(result), result.Duration)
+		}
+		r.metrics.ObserveRun(status, ldap.ConnectionErrors())
+		if r.config.LoopStatsFile != "" {
+			if err := appendLoopStats(r.config.LoopStatsFile, newLoopStatsLine(r.suite, status)); err != nil {
+				logger.Warn("TestRunner", "Failed to append loop statistics", "file", r.config.LoopStatsFile, "error", err)
+			}
+		}
+		if r.runs != nil {
+			var report bytes.Buffer
+			if err := WriteJSONReport(&report, r.suite, r.cleanupLDIF); err != nil {
+				logger.Warn("TestRunner", "Failed to build the report of the run", "error", err)
+			}
+			r.runs.Finish(runID, status, report.Bytes())
+		}
+		r.recordHistory(err)
+		r.notify(err)
 
 		// Print iteration summary
-		fmt.Printf("\n[Iteration %d] Tests: %d passed, %d failed (%.2fs)\n",
-			iteration, passed, failed, duration.Seconds())
+		fmt.Printf("\n[Iteration %d] Tests: %d passed, %d failed, %d skipped (%.2fs)\n",
+			iteration, passed, failed, skipped, duration.Seconds())
 
 		// Print cumulative statistics
-		fmt.Printf("[Cumulative] Runs: %d, Success: %d, Failed: %d, Total Tests: %d/%d (%.1f%% pass rate)\n\n",
+		fmt.Printf("[Cumulative] Runs: %d, Success: %d, Failed: %d, Total Tests: %d/%d (%.1f%% pass rate)\n",
 			r.loopStats.TotalRuns,
 			r.loopStats.SuccessfulRuns,
 			r.loopStats.FailedRuns,
 			r.loopStats.TotalPassed,
 			r.loopStats.TotalTests,
 			float64(r.loopStats.TotalPassed)/float64(r.loopStats.TotalTests)*100)
+		fmt.Printf("[Telemetry] %s\n", formatTelemetry(telemetry, r.loopStats.FirstTelemetry))
+		if rolling != nil {
+			rolling.add(scheduledRun{end: time.Now(), passed: status.Healthy, duration: duration, tests: total, failed: failed})
+			fmt.Printf("[Rolling] %s\n", rolling)
+			logger.Info("TestRunner", "Rolling statistics", "summary", rolling.String())
+		}
+		fmt.Println()
+		stopRunLog()
 
 		// Reset suite for next iteration
 		r.suite = &TestSuite{
-			Name:    "LDAP Operations Test Suite",
-			Results: make([]TestResult, 0),
+			Name:     "LDAP Operations Test Suite",
+			Results:  make([]TestResult, 0),
+			Metadata: r.suite.Metadata,
 		}
 		r.tracker.Clear()
 
 		// Delay before next iteration
-		if r.config.LoopDelay > 0 {
-			logger.Debug("TestRunner", "Waiting before next iteration", "seconds", r.config.LoopDelay)
-			time.Sleep(time.Duration(r.config.LoopDelay) * time.Second)
+		if delay := loopDelay(r.config.LoopDelay, r.config.LoopJitter); delay > 0 {
+			logger.Debug("TestRunner", "Waiting before next iteration", "delay", delay)
+			select {
+			case <-ctx.Done():
+			case <-r.runs.Triggered():
+				// A requested run starts right away; the trigger is consumed with it
+			case <-time.After(delay):
+			}
+		}
+	}
+}
+
+// runSuiteValidator returns the check of the suite of a run requested through
+// the runs API: the configuration must still be valid with it. It validates a
+// copy of cfg, so requests need not wait for the loop.
+func runSuiteValidator(cfg config.Config) func(testSuite string) error {
+	return func(testSuite string) error {
+		if testSuite == "" {
+			return nil
 		}
+		c := cfg
+		c.TestSuite = config.SuiteList(testSuite)
+		return c.Validate()
 	}
 }
 
 // runOnce executes a single test run
-func (r *Runner) runOnce() error {
+func (r *Runner) runOnce(ctx context.Context) error {
 	logger.Info("TestRunner", "Starting LDAP operations test suite")
 	r.suite.StartTime = time.Now()
+	r.events.RunStart(r.testSuite)
+
+	// A dry run with dry_run_ldif records the writes it would send instead of skipping them
+	if r.config.DryRun && r.config.DryRunLDIF != "" {
+		if err := r.openPlan(); err != nil {
+			r.suite.EndTime = time.Now()
+			r.events.RunEnd(r.suite, err)
+			return err
+		}
+		defer r.closePlan()
+	}
 
 	// Phase 1: Connection and Health Check
 	if err := r.connect(); err != nil {
+		r.suite.EndTime = time.Now()
+		r.events.RunEnd(r.suite, err)
 		return fmt.Errorf("connection failed: %w", err)
 	}
 	defer r.cleanup()
 
-	// Phase 2: Setup (create test structure)
-	testBaseDN, err := r.setup()
+	// Keep concurrent runs of the same prefix apart while this one works
+	if r.config.Lock && !r.config.DryRun {
+		lock, err := acquireLock(r.conn, r.config.TestPrefix, r.config.BaseDN, r.suite.Metadata, r.config.GetLockStaleAfter())
+		if err != nil {
+			r.suite.EndTime = time.Now()
+			r.events.RunEnd(r.suite, err)
+			return fmt.Errorf("lock failed: %w", err)
+		}
+		// Released through r.conn, which is replaced if the run is interrupted
+		defer func() { lock.release(r.conn) }()
+
+		// The heartbeat keeps the lock fresh for as long as the run works, and
+		// interrupts the run if another one has taken the lock over meanwhile
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		stopHeartbeat := lock.heartbeat(r.openConnection, lockHeartbeatInterval(r.config.GetLockStaleAfter()), cancel)
+		defer stopHeartbeat()
+	}
+
+	// Cancellation closes the connection to abort the in-flight operation
+	stopWatch := r.conn.AbortOnCancel(ctx)
+
+	// Phase 2: Setup (create test structure, or re-use the one of a resumed run)
+	var testBaseDN string
+	var err error
+	if r.progress != nil && r.progress.TestBaseDN != "" {
+		testBaseDN, err = r.resumeSetup()
+	} else {
+		testBaseDN, err = r.setup()
+		if err == nil && r.progress != nil {
+			r.progress.TestBaseDN = testBaseDN
+			r.saveProgress(nil)
+		}
+	}
+	stopWatch()
 	if err != nil {
+		r.suite.EndTime = time.Now()
+		r.events.RunEnd(r.suite, err)
 		return fmt.Errorf("setup failed: %w", err)
 	}
+	r.testBaseDN = testBaseDN
+	r.tracker.Begin(testBaseDN)
+
+	// Catch entries the server schema would reject before the first add
+	if r.config.ValidateSchema {
+		r.validateSchema(testBaseDN)
+	}
+
+	// Give the tests a realistic volume of data to search through
+	if r.config.Generate > 0 {
+		r.generateData(ctx, testBaseDN)
+	}
 
 	// Phase 3: Execute tests based on test suite selection
-	r.executeTests(testBaseDN)
+	r.executeTests(ctx, testBaseDN)
+
+	// The security posture probes only bind and read, so they also run in
+	// dry-run mode. They belong to the bind tests and run once, not in every
+	// loop iteration, whose reports carry the findings of the first.
+	selection := config.SuiteList(r.testSuite)
+	if r.security == nil && ctx.Err() == nil && (selection.Has("all") || selection.Has("bind")) {
+		r.security = AssessSecurity(r.conn, r.config.BaseDN)
+	}
+	r.suite.Security = r.security
+
+	// The baseline flags the tests that regressed since a reference run
+	if r.config.Baseline != "" && !r.config.DryRun {
+		r.checkBaseline(ctx)
+	}
+
+	// The latency thresholds gate the run on the tests it executed
+	if len(r.config.Thresholds) > 0 && !r.config.DryRun {
+		r.checkThresholds()
+	}
+
+	if ctx.Err() != nil {
+		r.cancelCause = context.Cause(ctx)
+		r.suite.Interrupted = true
+		r.suite.InterruptReason = r.cancelCause.Error()
+		logger.Warn("TestRunner", "Run interrupted, running cleanup and writing partial report", "reason", r.cancelCause)
+
+		// The aborted connection cannot be reused for cleanup
+		r.conn.Close()
+		if err := r.connect(); err != nil {
+			logger.Error("TestRunner", "Failed to reconnect for cleanup", "error", err)
+		}
+	}
 
 	// Phase 4: Cleanup (if requested)
-	r.performCleanup()
+	cleaned := r.performCleanup()
+	r.cleaned = cleaned
+	if !cleaned && !r.config.DryRun {
+		r.writeCleanupLDIF()
+		r.exportTracked()
+	}
+
+	// Keep the saved progress only while the run can still be resumed
+	if r.progress != nil {
+		if r.suite.Interrupted && !cleaned {
+			logger.Info("TestRunner", "Run progress saved, resume with --resume "+r.progress.RunID, "stateDir", r.config.StateDir)
+		} else if err := r.progress.Remove(r.config.StateDir); err != nil {
+			logger.Warn("TestRunner", "Failed to remove run progress", "error", err)
+		}
+	}
 
 	r.suite.EndTime = time.Now()
+	r.events.RunEnd(r.suite, nil)
+
+	if r.config.CSVOut != "" {
+		if err := AppendCSV(r.config.CSVOut, r.suite, r.iteration); err != nil {
+			logger.Warn("TestRunner", "Failed to append test timings to CSV file", "file", r.config.CSVOut, "error", err)
+		}
+	}
 
 	// Phase 5: Report results (only if not in loop mode)
 	if !r.config.Loop {
@@ -190,43 +664,87 @@ func (r *Runner) runOnce() error {
 	return nil
 }
 
+// lockHeartbeatInterval refreshes a lock four times within its stale age, so
+// that a few failed refreshes in a row do not let another run take it over
+func lockHeartbeatInterval(staleAfter time.Duration) time.Duration {
+	return max(staleAfter/4, time.Second)
+}
+
 // connect establishes connection to LDAP server
 func (r *Runner) connect() error {
 	logger.Info("TestRunner", "Connecting to LDAP server", "address", r.config.GetAddress())
 
-	conn, err := ldap.NewConnection(r.config)
+	conn, err := r.openConnection()
 	if err != nil {
-		logger.Error("TestRunner", "Failed to connect", "error", err)
 		return err
 	}
 	r.conn = conn
 
-	// Perform bind
-	if err := r.conn.Bind(); err != nil {
-		logger.Error("TestRunner", "Authentication failed", "error", err)
-		return err
-	}
-
 	// Health check
 	if err := r.conn.HealthCheck(); err != nil {
 		logger.Warn("TestRunner", "Health check failed", "error", err)
 	}
+	r.suite.Metadata.Server = r.conn.GetServerInfo()
 
 	return nil
 }
 
+// openConnection opens a bound connection, to the first server of the host
+// list that accepts it, that records its write operations in the run's audit trail
+func (r *Runner) openConnection() (*ldap.Connection, error) {
+	conn, err := ldap.NewBoundConnection(r.config)
+	if err != nil {
+		logger.Error("TestRunner", "Failed to connect and authenticate", "error", err)
+		return nil, err
+	}
+
+	// Record every write operation of the run in its audit trail
+	if r.config.AuditDir != "" && !r.config.DryRun {
+		if r.audit == nil {
+			audit, err := ldap.OpenAuditLog(r.config.AuditDir, r.suite.Metadata.RunID)
+			if err != nil {
+				conn.Close()
+				logger.Error("TestRunner", "Failed to open audit log", "error", err)
+				return nil, err
+			}
+			r.audit = audit
+			r.suite.Metadata.AuditLog = audit.Path()
+		}
+		conn.SetAuditLog(r.audit)
+	}
+	if r.plan != nil {
+		conn.SetPlan(r.plan)
+	}
+	return conn, nil
+}
+
 // setup creates the test organizational structure
 func (r *Runner) setup() (string, error) {
+	if r.config.ReadOnly {
+		return r.readOnlySetup()
+	}
+	if r.config.ReuseTestOU != "" {
+		return r.reuseSetup()
+	}
+
 	logger.Info("Setup", "Creating test organizational structure")
 
-	// Create timestamped test base DN
-	timestamp := time.Now().Format("20060102-150405")
-	testOUName := fmt.Sprintf("%s-%s", r.config.TestPrefix, timestamp)
+	// Name the test base DN after the configured template
+	runID := r.suite.Metadata.RunID
+	testOUName, err := r.config.TestOUName(config.TestOUNameData{
+		RunID:      runID,
+		ShortRunID: runID[:min(8, len(runID))],
+		Hostname:   r.suite.Metadata.Hostname,
+		Timestamp:  time.Now().UTC().Format("20060102-150405"),
+	})
+	if err != nil {
+		return "", err
+	}
 	testBaseDN := fmt.Sprintf("ou=%s,%s", testOUName, r.config.BaseDN)
 
 	logger.Info("Setup", "Creating test base OU", "dn", testBaseDN)
 
-	if r.config.DryRun {
+	if r.config.DryRun && r.plan == nil {
 		logger.Info("Setup", "DRY RUN: Would create test base OU", "dn", testBaseDN)
 		return testBaseDN, nil
 	}
@@ -240,7 +758,7 @@ func (r *Runner) setup() (string, error) {
 	addRequest.Attribute("description", []string{fmt.Sprintf("Test OU created by LDAP test suite at %s", time.Now().Format(time.RFC3339))})
 
 	start := time.Now()
-	err := r.conn.GetConnection().Add(addRequest)
+	err = r.conn.Add(addRequest)
 	duration := time.Since(start)
 
 	if err != nil {
@@ -257,82 +775,505 @@ func (r *Runner) setup() (string, error) {
 	return testBaseDN, nil
 }
 
+// reuseSetup uses the pre-created sandbox OU set by --reuse-test-ou. The OU is
+// never tracked, so cleanup removes only the entries created inside it.
+func (r *Runner) reuseSetup() (string, error) {
+	testBaseDN := r.config.ReusedTestOUDN()
+	logger.Info("Setup", "Reusing test base OU", "dn", testBaseDN)
+	if !r.config.Lock {
+		logger.Warn("Setup", "Concurrent runs share a reused test OU; enable --lock to keep them apart")
+	}
+
+	if r.config.DryRun {
+		logger.Info("Setup", "DRY RUN: Would reuse test base OU", "dn", testBaseDN)
+		return testBaseDN, nil
+	}
+
+	if _, err := readEntry(r.conn, testBaseDN); err != nil {
+		return "", fmt.Errorf("reused test OU is not usable (it must be created beforehand): %w", err)
+	}
+	return testBaseDN, nil
+}
+
+// readOnlySetup returns the base the tests of a read-only run work in: the
+// reused test OU if set, the base DN otherwise. Nothing is created, so the
+// tests that need the entries of the add suite are skipped.
+func (r *Runner) readOnlySetup() (string, error) {
+	testBaseDN := r.config.BaseDN
+	if r.config.ReuseTestOU != "" {
+		testBaseDN = r.config.ReusedTestOUDN()
+	}
+	logger.Info("Setup", "Read-only mode: running against existing entries, nothing is created", "dn", testBaseDN)
+
+	if _, err := readEntry(r.conn, testBaseDN); err != nil {
+		return "", fmt.Errorf("read-only tests cannot read their base entry: %w", err)
+	}
+	return testBaseDN, nil
+}
+
+// suiteFunc runs one suite on conn, creating its entries within testBaseDN
+type suiteFunc func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult
+
+// namedSuite is a suite selectable with test_suite
+type namedSuite struct {
+	name  string
+	inAll bool // part of "all"; the fuzz, chaos, random, soak and loadtest suites are opt-in
+	run   suiteFunc
+}
+
+// selectedSuites returns the suites selected by test_suite in execution order,
+// whatever the order they were listed in
+func (r *Runner) selectedSuites() []namedSuite {
+	cfg := r.config
+	suites := []namedSuite{
+		{name: "bind", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult { return TestBind(conn, h) }},
+		{name: "schema", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult { return TestSchema(conn, h) }},
+		{name: "add", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestAdd(conn, testBaseDN, r.tracker, h)
+		}},
+		{name: "ldif", inAll: cfg.LDIFFile != "", run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestLDIFData(conn, cfg.LDIFFile, cfg.BaseDN, testBaseDN, r.tracker, h)
+		}},
+		{name: "search", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestSearch(conn, testBaseDN, r.tracker, h)
+		}},
+		{name: "compare", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestCompare(conn, testBaseDN, r.tracker, h)
+		}},
+		{name: "modify", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestModify(conn, testBaseDN, r.tracker, h)
+		}},
+		{name: "modifydn", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestModifyDN(conn, testBaseDN, r.tracker, h)
+		}},
+		{name: "group", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestGroup(conn, testBaseDN, r.tracker, h)
+		}},
+		{name: "groups", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestNestedGroups(conn, testBaseDN, r.tracker, h)
+		}},
+		{name: "posix", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestPosix(conn, testBaseDN, r.tracker, h)
+		}},
+		{name: "unicode", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestUnicode(conn, testBaseDN, r.tracker, h)
+		}},
+		{name: "escaping", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestEscaping(conn, testBaseDN, r.tracker, h)
+		}},
+		{name: "delete", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestDelete(conn, testBaseDN, r.tracker, h)
+		}},
+		{name: "lifecycle", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestLifecycle(conn, testBaseDN, r.tracker, h)
+		}},
+		{name: "abandon", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestAbandon(conn, cfg.BaseDN, h)
+		}},
+		{name: "tls", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult { return TestTLS(conn, h) }},
+		{name: "starttls", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult { return TestStartTLS(conn, h) }},
+		{name: "notification", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestNotification(conn, h)
+		}},
+		{name: "extended", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestExtended(conn, testBaseDN, r.tracker, h)
+		}},
+		// The ad suite is part of all only when the server is Active Directory
+		{name: "ad", inAll: r.suite.Metadata.Server.Vendor == ldap.VendorActiveDirectory, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestAD(conn, cfg.BaseDN, testBaseDN, r.tracker, h)
+		}},
+		{name: "sync", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestSync(conn, r.openPooledConnection, testBaseDN, r.tracker, h)
+		}},
+		{name: "referral", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestReferral(conn, testBaseDN, r.tracker, h)
+		}},
+		{name: "acl", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestACL(conn, cfg.ACLMatrix, h)
+		}},
+		// Unbind closes its connection, so it runs last on one of its own
+		{name: "unbind", inAll: true, run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestUnbind(r.openPooledConnection, h)
+		}},
+
+		{name: "fuzz", run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestFuzz(conn, cfg.BaseDN, h)
+		}},
+		{name: "berfuzz", run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestProtocolFuzz(conn, h)
+		}},
+		{name: "chaos", run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestChaos(conn, cfg.BaseDN, h)
+		}},
+		{name: "random", run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestRandomOps(conn, testBaseDN, r.tracker, cfg.RandomSeed, cfg.GetRandomDuration(), h)
+		}},
+		{name: "soak", run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestSoak(conn, cfg.BaseDN, cfg.SoakConnections, cfg.GetSoakDuration(), cfg.GetSoakInterval(), h)
+		}},
+		{name: "loadtest", run: func(conn *ldap.Connection, testBaseDN string, h *Harness) []TestResult {
+			return TestLoad(conn, testBaseDN, r.tracker, LoadSettings{
+				Duration:     cfg.GetLoadDuration(),
+				Concurrency:  cfg.LoadConcurrency,
+				Rate:         cfg.LoadRate,
+				Mix:          cfg.GetLoadMix(),
+				MaxErrorRate: cfg.LoadMaxErrorRate,
+			}, h)
+		}},
+	}
+
+	selection := config.SuiteList(r.testSuite)
+	all := selection.Has("all")
+	var selected []namedSuite
+	for _, suite := range suites {
+		// A writing suite cannot be selected in read-only mode, and all leaves them out
+		if selection.Has(suite.name) || (all && suite.inAll && !(cfg.ReadOnly && config.WritesToDirectory(suite.name))) {
+			selected = append(selected, suite)
+		}
+	}
+	return selected
+}
+
 // executeTests runs the selected test suites
-func (r *Runner) executeTests(testBaseDN string) {
-	logger.Info("TestRunner", "Executing test operations", "suite", r.config.TestSuite)
+func (r *Runner) executeTests(ctx context.Context, testBaseDN string) {
+	logger.Info("TestRunner", "Executing test operations", "suite", r.testSuite)
+
+	if r.config.DryRun {
+		if r.plan == nil {
+			logger.Info("TestRunner", "DRY RUN: Skipping test execution")
+			return
+		}
+		// The tests run against entries that were never created, so their
+		// results say nothing about the server and are left out of the report
+		logger.Info("TestRunner", "DRY RUN: Recording the write operations of the suites")
+		defer func() { r.suite.Results = nil }()
+	}
+
+	// The suites borrow their connections from a pool, one per worker
+	pool, err := ldap.NewPool(r.config.Concurrent, r.openPooledConnection)
+	if err != nil {
+		logger.Error("TestRunner", "Failed to open connection pool", "error", err)
+		r.suite.Results = append(r.suite.Results, TestResult{
+			Name:      "Open Connection Pool",
+			Operation: "Connection",
+			Error:     err,
+		})
+		return
+	}
+	r.pool = pool
+	defer func() {
+		r.pool.Close()
+		r.pool = nil
+	}()
+
+	if run, skip := r.config.GetTestFilters(); run != nil || skip != nil {
+		defer func() {
+			if len(r.suite.Results) == 0 {
+				logger.Warn("TestRunner", "No test matched the filters", "run", r.config.RunFilter, "skip", r.config.SkipFilter)
+			}
+		}()
+	}
+
+	suites := r.selectedSuites()
+	if r.config.Concurrent > 1 {
+		r.executeConcurrent(ctx, testBaseDN, suites)
+		return
+	}
+
+	h := NewHarness(ctx)
+	h.Filter(r.config.GetTestFilters())
+	h.Retry(r.config.GetRetryPolicy())
+	h.Capabilities(r.suite.Metadata.Server)
+	if r.progress != nil {
+		h.RestoreFixtures(r.progress.Fixtures)
+	}
+
+	for _, suite := range suites {
+		if r.plan != nil {
+			r.plan.Comment("Suite: " + suite.name)
+		}
+		r.runSuite(ctx, h, suite.name, func(conn *ldap.Connection, h *Harness) []TestResult { return suite.run(conn, testBaseDN, h) })
+	}
+}
+
+// runSuite executes one suite on a connection borrowed from the pool, within
+// its time budget. When the budget or the run is cancelled, the in-flight
+// operation is aborted and the remaining tests are skipped; the pool replaces
+// the aborted connection.
+func (r *Runner) runSuite(ctx context.Context, h *Harness, name string, suite func(conn *ldap.Connection, h *Harness) []TestResult) {
+	if r.progress != nil && r.progress.IsCompleted(name) {
+		logger.Info("TestRunner", "Suite completed before the run was resumed, skipping", "suite", name)
+		return
+	}
+
+	suiteCtx, cancel := r.suiteContext(ctx, name)
+	defer cancel()
 
+	r.events.SuiteStart(name)
+	suiteHarness := h.WithContext(suiteCtx)
+	suiteHarness.OnResult(func(result TestResult) { r.events.Test(name, result) })
+
+	var results []TestResult
+	conn, err := r.borrowConnection(suiteCtx)
+	if err != nil {
+		results = suiteNotStarted(suiteCtx, name, err)
+		r.events.Test(name, results[0])
+	} else {
+		stopWatch := conn.AbortOnCancel(suiteCtx)
+		results = suite(conn, suiteHarness)
+		if !stopWatch() && ctx.Err() == nil {
+			logger.Warn("TestRunner", "Suite time budget exceeded, replacing its connection for remaining suites", "suite", name)
+		}
+		r.pool.Put(conn)
+	}
+
+	r.suite.Results = append(r.suite.Results, results...)
+	r.events.SuiteEnd(name, results)
+	if notExecuted, _ := (&TestSuite{Results: results}).GetBudgetExceeded(); notExecuted > 0 {
+		logger.Warn("TestRunner", "Tests not executed within the time budget", "suite", name, "notExecuted", notExecuted, "reason", context.Cause(suiteCtx))
+	}
+
+	// A suite cut short by cancellation or that got no connection runs again
+	// when the run is resumed
+	if r.progress != nil && ctx.Err() == nil && err == nil {
+		r.progress.CompletedSuites = append(r.progress.CompletedSuites, name)
+		r.saveProgress(h)
+	}
+}
+
+// generateData adds the synthetic users of generate under the test OU and
+// reports their generation as a test
+func (r *Runner) generateData(ctx context.Context, testBaseDN string) {
 	if r.config.DryRun {
-		logger.Info("TestRunner", "DRY RUN: Skipping test execution")
+		logger.Info("TestRunner", "DRY RUN: Would generate synthetic data", "users", r.config.Generate)
 		return
 	}
+	if r.progress != nil && r.progress.IsCompleted("generate") {
+		logger.Info("TestRunner", "Synthetic data generated before the run was resumed, skipping")
+		return
+	}
+
+	r.events.SuiteStart("generate")
+	result := GenerateData(ctx, r.conn, r.openPooledConnection, testBaseDN, r.tracker, r.config.Generate, r.config.GenerateWorkers)
+	r.events.Test("generate", result)
+	r.suite.Results = append(r.suite.Results, result)
+	r.events.SuiteEnd("generate", []TestResult{result})
 
-	testSuite := r.config.TestSuite
+	if r.progress != nil && result.Passed {
+		r.progress.CompletedSuites = append(r.progress.CompletedSuites, "generate")
+		r.saveProgress(nil)
+	}
+}
 
-	// Run tests based on suite selection
-	if testSuite == "all" || testSuite == "bind" {
-		results := TestBind(r.conn)
-		r.suite.Results = append(r.suite.Results, results...)
+// validateSchema adds a result per kind of entry the tests and the generator
+// create, checked against the server schema. It only reads, so a dry run
+// validates too.
+func (r *Runner) validateSchema(testBaseDN string) {
+	r.events.SuiteStart("schema-validation")
+	results := ValidateEntries(r.conn, testBaseDN)
+	for _, result := range results {
+		r.events.Test("schema-validation", result)
 	}
+	r.suite.Results = append(r.suite.Results, results...)
+	r.events.SuiteEnd("schema-validation", results)
+}
 
-	if testSuite == "all" || testSuite == "add" {
-		results := TestAdd(r.conn, testBaseDN, r.tracker)
-		r.suite.Results = append(r.suite.Results, results...)
+// checkThresholds adds a result per latency threshold, failing the run if
+// any is breached
+func (r *Runner) checkThresholds() {
+	logger.Info("TestRunner", "Checking latency thresholds", "thresholds", len(r.config.Thresholds))
+
+	r.events.SuiteStart("thresholds")
+	checks := CheckThresholds(r.suite.Results, r.config.Thresholds)
+	for _, check := range checks {
+		r.events.Test("thresholds", check)
 	}
+	r.suite.Results = append(r.suite.Results, checks...)
+	r.events.SuiteEnd("thresholds", checks)
+}
 
-	if testSuite == "all" || testSuite == "search" {
-		results := TestSearch(r.conn, testBaseDN)
-		r.suite.Results = append(r.suite.Results, results...)
+// borrowConnection checks out a connection of the pool for a suite. The main
+// connection is never lent instead: cancelling the suite would close it under
+// the security assessment, cleanup and lock release that still need it.
+func (r *Runner) borrowConnection(ctx context.Context) (*ldap.Connection, error) {
+	conn, err := r.pool.Get(ctx)
+	if err != nil && ctx.Err() == nil {
+		logger.Error("TestRunner", "Failed to check out a pooled connection", "error", err)
 	}
+	return conn, err
+}
 
-	if testSuite == "all" || testSuite == "compare" {
-		results := TestCompare(r.conn, testBaseDN)
-		r.suite.Results = append(r.suite.Results, results...)
+// suiteNotStarted reports a suite that got no connection as one result:
+// skipped if the run or the suite's budget was cancelled, failed otherwise
+func suiteNotStarted(ctx context.Context, name string, err error) []TestResult {
+	result := TestResult{
+		Name:      "Suite Connection - " + name,
+		Operation: "Connection",
+		Error:     err,
 	}
+	if ctx.Err() != nil {
+		result.Skipped = true
+		result.Message = fmt.Sprintf("Skipped: the %s suite was cancelled before it got a connection: %v", name, context.Cause(ctx))
+		logger.Warn("TestRunner", "SKIP: "+result.Name, "reason", context.Cause(ctx))
+		return []TestResult{result}
+	}
+	result.Passed = false
+	result.Message = fmt.Sprintf("Failed to check out a connection for the %s suite: %v", name, err)
+	logger.Error("TestRunner", result.Message)
+	return []TestResult{result}
+}
 
-	if testSuite == "all" || testSuite == "modify" {
-		results := TestModify(r.conn, testBaseDN)
-		r.suite.Results = append(r.suite.Results, results...)
+// openPooledConnection opens a connection of the pool, which shares what the
+// health check of the main connection found out about the server
+func (r *Runner) openPooledConnection() (*ldap.Connection, error) {
+	conn, err := r.openConnection()
+	if err != nil {
+		return nil, err
 	}
+	conn.SetServerInfo(r.suite.Metadata.Server)
+	return conn, nil
+}
 
-	if testSuite == "all" || testSuite == "modifydn" {
-		results := TestModifyDN(r.conn, testBaseDN, r.tracker)
-		r.suite.Results = append(r.suite.Results, results...)
+// suiteContext returns the context of one suite, bound by its time budget if set
+func (r *Runner) suiteContext(ctx context.Context, name string) (context.Context, context.CancelFunc) {
+	if budget := r.config.GetSuiteTimeout(name); budget > 0 {
+		return context.WithTimeoutCause(ctx, budget, &budgetExceeded{scope: name, budget: budget})
 	}
+	return ctx, func() {}
+}
+
+// resumeSetup re-uses the test OU of a resumed run and restores its tracked
+// entries and the results of the suites that already completed
+func (r *Runner) resumeSetup() (string, error) {
+	testBaseDN := r.progress.TestBaseDN
+	logger.Info("Setup", "Re-using test base OU of resumed run", "dn", testBaseDN)
 
-	if testSuite == "all" || testSuite == "delete" {
-		results := TestDelete(r.conn, testBaseDN, r.tracker)
-		r.suite.Results = append(r.suite.Results, results...)
+	if _, err := readEntry(r.conn, testBaseDN); err != nil {
+		return "", fmt.Errorf("test base OU of run %s is no longer available: %w", r.progress.RunID, err)
 	}
 
-	if testSuite == "all" || testSuite == "abandon" {
-		results := TestAbandon(r.conn, r.config.BaseDN)
-		r.suite.Results = append(r.suite.Results, results...)
+	r.tracker.Load(r.progress.Entries)
+	r.suite.Results = append(r.suite.Results, r.progress.TestResults()...)
+	return testBaseDN, nil
+}
+
+// saveProgress records the run state, including the fixture states of h once
+// tests have started
+func (r *Runner) saveProgress(h *Harness) {
+	if h != nil {
+		r.progress.Fixtures = h.FixtureStates()
 	}
+	r.progress.Entries = r.tracker.GetEntries()
+	r.progress.SetResults(r.suite.Results)
 
-	// Note: Unbind test is run separately at the end if requested
+	if err := r.progress.Save(r.config.StateDir); err != nil {
+		logger.Warn("TestRunner", "Failed to save run progress", "error", err)
+	}
 }
 
-// performCleanup removes test data if cleanup is enabled
-func (r *Runner) performCleanup() {
+// performCleanup removes test data if cleanup is enabled and reports whether
+// it was removed
+func (r *Runner) performCleanup() bool {
 	shouldCleanup := r.config.Cleanup || (r.config.CleanupOnSuccess && r.suite.AllPassed())
 
 	if !shouldCleanup {
 		logger.Info("Cleanup", "Cleanup not requested, preserving test data")
-		return
+		return false
 	}
 
-	if r.config.DryRun {
+	if r.config.DryRun && r.plan == nil {
 		logger.Info("Cleanup", "DRY RUN: Would cleanup test data")
-		return
+		return false
 	}
 
 	logger.Info("Cleanup", "Starting cleanup of test data")
+	if r.plan != nil {
+		r.plan.Comment("Cleanup")
+	}
 
-	if err := PerformCleanup(r.conn, r.tracker); err != nil {
-		logger.Warn("Cleanup", "Cleanup completed with errors", "error", err)
+	var err error
+	if r.config.CleanupMode == "subtree" && !r.config.DryRun {
+		// A reused OU stays for the next run; a dry run plans the tracked deletes
+		err = PerformSubtreeCleanup(r.conn, r.testBaseDN, r.config.ReuseTestOU != "")
 	} else {
-		logger.Info("Cleanup", "Cleanup completed successfully")
+		err = PerformCleanup(r.conn, r.tracker, r.testBaseDN)
 	}
+	if err != nil {
+		logger.Warn("Cleanup", "Cleanup completed with errors", "error", err)
+		return false
+	}
+	logger.Info("Cleanup", "Cleanup completed successfully")
+	return true
+}
+
+// writeCleanupLDIF writes the tracked entries of the run as LDIF delete
+// records in deletion order, so preserved test data can be removed later
+// with standard tooling such as ldapmodify
+func (r *Runner) writeCleanupLDIF() {
+	r.cleanupLDIF = ""
+	if r.config.CleanupLDIFDir == "" || r.testBaseDN == "" {
+		return
+	}
+	entries := cleanupEntries(r.tracker, r.testBaseDN)
+	if len(entries) == 0 {
+		return
+	}
+
+	// The test OU name is unique per run and iteration, and a re-used or
+	// resumed OU rewrites its own file with the entries now tracked
+	name := r.testBaseDN
+	if dn, err := ldaplib.ParseDN(r.testBaseDN); err == nil && len(dn.RDNs) > 0 {
+		name = dn.RDNs[0].Attributes[0].Value
+	}
+	if err := os.MkdirAll(r.config.CleanupLDIFDir, 0755); err != nil {
+		logger.Warn("Cleanup", "Failed to create cleanup LDIF directory", "error", err)
+		return
+	}
+	path := filepath.Join(r.config.CleanupLDIFDir, fmt.Sprintf("cleanup-%s.ldif", name))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		logger.Warn("Cleanup", "Failed to create cleanup LDIF", "error", err)
+		return
+	}
+	defer file.Close()
+
+	writer := ldif.NewWriter(file)
+	writer.WriteVersion()
+	writer.WriteComment(fmt.Sprintf("Test data of run %s under %s, written %s", r.suite.Metadata.RunID, r.testBaseDN, time.Now().Format(time.RFC3339)))
+	startTLS := ""
+	if r.config.StartTLS && !r.config.UseTLS {
+		startTLS = " -ZZ"
+	}
+	writer.WriteComment(fmt.Sprintf("Remove with: ldapmodify -c%s -H %s -D <bind-dn> -W -f %s", startTLS, r.config.GetAddress(), path))
+	for _, entry := range entries {
+		if err := writer.WriteRecord(ldif.Record{DN: entry.DN, ChangeType: ldif.ChangeDelete}); err != nil {
+			logger.Warn("Cleanup", "Failed to write cleanup LDIF", "file", path, "error", err)
+			return
+		}
+	}
+
+	r.cleanupLDIF = path
+	logger.Info("Cleanup", "Wrote delete records for the preserved test data", "file", path, "entries", len(entries))
+}
+
+// exportTracked writes the tracked entries of preserved test data to
+// export_tracked. In loop mode the iteration is added to the file name, as
+// each iteration preserves the data of its own test OU.
+func (r *Runner) exportTracked() {
+	if r.config.ExportTracked == "" || r.tracker.Count() == 0 {
+		return
+	}
+
+	path := r.config.ExportTracked
+	if r.config.Loop {
+		ext := filepath.Ext(path)
+		path = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, ext), r.iteration, ext)
+	}
+	if err := r.tracker.Save(path); err != nil {
+		logger.Warn("Cleanup", "Failed to export tracked entries", "file", path, "error", err)
+		return
+	}
+	logger.Info("Cleanup", "Exported the tracked entries of the preserved test data, delete them with: ldap-test cleanup --from-tracked "+path, "entries", r.tracker.Count())
 }
 
 // cleanup closes connections and performs final operations
@@ -341,75 +1282,233 @@ func (r *Runner) cleanup() {
 		logger.Debug("TestRunner", "Closing LDAP connection")
 		r.conn.Close()
 	}
+
+	// The next loop iteration opens the audit file again, appending to it
+	if err := r.audit.Close(); err != nil {
+		logger.Warn("TestRunner", "Failed to close audit log", "file", r.audit.Path(), "error", err)
+	}
+	r.audit = nil
 }
 
 // reportResults prints the test results
 func (r *Runner) reportResults() {
-	total, passed, failed, duration := r.suite.GetStats()
+	if r.config.ReportFormat == "console" {
+		r.printResults()
+		return
+	}
+	if err := r.writeReport(); err != nil {
+		logger.Error("TestRunner", "Failed to write report", "format", r.config.ReportFormat, "error", err)
+		r.printResults()
+	}
+}
 
-	fmt.Println("\n" + strings.Repeat("=", 80))
-	fmt.Println("LDAP OPERATIONS TEST SUITE RESULTS")
-	fmt.Println(strings.Repeat("=", 80))
-	fmt.Printf("Total Tests:     %d\n", total)
-	fmt.Printf("Passed:          %d\n", passed)
-	fmt.Printf("Failed:          %d\n", failed)
-	fmt.Printf("Duration:        %s\n", duration)
-	fmt.Println(strings.Repeat("=", 80))
+// printResults prints the console report
+func (r *Runner) printResults() {
+	r.writeConsoleReport(os.Stdout)
+	if r.suite.AllPassed() {
+		logger.Info("TestRunner", "All tests passed")
+	} else {
+		total, _, failed, _, _ := r.suite.GetStats()
+		logger.Warn("TestRunner", "Some tests failed", "failed", failed, "total", total)
+	}
+}
+
+// writeConsoleReport writes the console report to w
+func (r *Runner) writeConsoleReport(w io.Writer) {
+	total, passed, failed, skipped, duration := r.suite.GetStats()
+
+	fmt.Fprintln(w, "\n"+strings.Repeat("=", 80))
+	fmt.Fprintln(w, strings.ToUpper(r.suite.Name)+" RESULTS")
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+	fmt.Fprintf(w, "Total Tests:     %d\n", total)
+	fmt.Fprintf(w, "Passed:          %d\n", passed)
+	fmt.Fprintf(w, "Failed:          %d\n", failed)
+	fmt.Fprintf(w, "Skipped:         %d\n", skipped)
+	if budgetSkipped, byOperation := r.suite.GetBudgetExceeded(); budgetSkipped > 0 {
+		fmt.Fprintf(w, "Not Executed:    %d (time budget exceeded: %s)\n", budgetSkipped, formatCounts(byOperation))
+	}
+	if retried, recovered, retries := r.suite.GetRetries(); retried > 0 {
+		fmt.Fprintf(w, "Retried:         %d (%d passed on retry, %d retries)\n", retried, recovered, retries)
+	}
+	fmt.Fprintf(w, "Duration:        %s\n", duration)
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+	r.printMetadata(w)
+	r.printWorkers(w)
+	r.printSecurity(w)
 
 	// Print individual test results
 	if len(r.suite.Results) > 0 {
-		fmt.Println("\nDetailed Results:")
-		fmt.Println(strings.Repeat("-", 80))
+		fmt.Fprintln(w, "\nDetailed Results:")
+		fmt.Fprintln(w, strings.Repeat("-", 80))
 
-		currentOp := ""
+		currentOp, currentWorker := "", 0
 		for _, result := range r.suite.Results {
-			if result.Operation != currentOp {
-				fmt.Printf("\n%s Tests:\n", result.Operation)
-				currentOp = result.Operation
+			if result.Operation != currentOp || result.Worker != currentWorker {
+				if result.Worker > 0 {
+					fmt.Fprintf(w, "\n%s Tests (worker %d):\n", result.Operation, result.Worker)
+				} else {
+					fmt.Fprintf(w, "\n%s Tests:\n", result.Operation)
+				}
+				currentOp, currentWorker = result.Operation, result.Worker
 			}
 
 			status := "✓ PASS"
-			if !result.Passed {
+			if result.Skipped {
+				status = "- SKIP"
+			} else if !result.Passed {
 				status = "✗ FAIL"
 			}
 
-			fmt.Printf("  %s  %-50s  %6dms\n", status, result.Name, result.Duration.Milliseconds())
+			fmt.Fprintf(w, "  %s  %-50s  %6dms\n", status, result.Name, result.Duration.Milliseconds())
 
 			if !result.Passed && result.Error != nil {
-				fmt.Printf("         Error: %v\n", result.Error)
+				fmt.Fprintf(w, "         Error: %v\n", result.Error)
+			}
+			if result.Retries > 0 {
+				fmt.Fprintf(w, "         Retried %d time(s) after transient errors\n", result.Retries)
 			}
 			if result.Message != "" {
-				fmt.Printf("         %s\n", result.Message)
+				fmt.Fprintf(w, "         %s\n", result.Message)
 			}
 		}
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 
 	// Print tracked entries summary if data was preserved
 	if !r.config.Cleanup && !r.config.CleanupOnSuccess {
-		r.tracker.PrintSummary()
+		r.tracker.WriteSummary(w)
+	}
+	if r.cleanupLDIF != "" {
+		fmt.Fprintf(w, "Delete records for the preserved test data: %s (run with ldapmodify -c -f)\n\n", r.cleanupLDIF)
 	}
 
 	// Overall result
-	fmt.Println(strings.Repeat("=", 80))
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+	if r.suite.Interrupted {
+		fmt.Fprintf(w, "⚠ RUN INTERRUPTED (%s) - results are partial\n", r.suite.InterruptReason)
+	}
 	if r.suite.AllPassed() {
-		fmt.Println("✓ ALL TESTS PASSED")
-		logger.Info("TestRunner", "All tests passed")
+		fmt.Fprintln(w, "✓ ALL TESTS PASSED")
 	} else {
-		fmt.Println("✗ SOME TESTS FAILED")
-		logger.Warn("TestRunner", "Some tests failed", "failed", failed, "total", total)
+		fmt.Fprintln(w, "✗ SOME TESTS FAILED")
 	}
-	fmt.Println(strings.Repeat("=", 80))
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+}
+
+// printMetadata prints the run information block of the console report
+func (r *Runner) printMetadata(w io.Writer) {
+	meta := r.suite.Metadata
+	server := meta.Server.Address
+	switch {
+	case meta.Server.VendorName != "":
+		server = fmt.Sprintf("%s (%s %s)", server, meta.Server.VendorName, meta.Server.VendorVersion)
+	case meta.Server.Vendor != ldap.VendorUnknown:
+		server = fmt.Sprintf("%s (%s)", server, meta.Server.Vendor)
+	}
+
+	fmt.Fprintf(w, "Run ID:          %s\n", meta.RunID)
+	fmt.Fprintf(w, "Tool Version:    %s\n", meta.ToolVersion)
+	fmt.Fprintf(w, "Hostname:        %s\n", meta.Hostname)
+	fmt.Fprintf(w, "Config Hash:     %s\n", meta.ConfigHash)
+	fmt.Fprintf(w, "Server:          %s, security: %s\n", server, meta.Server.Security)
+	if meta.AuditLog != "" {
+		fmt.Fprintf(w, "Audit Log:       %s\n", meta.AuditLog)
+	}
+	if r.config.ReadOnly {
+		fmt.Fprintln(w, "Mode:            read-only")
+	}
+	fmt.Fprintf(w, "Started:         %s\n", r.suite.StartTime.Format(time.RFC3339))
+	fmt.Fprintf(w, "Finished:        %s\n", r.suite.EndTime.Format(time.RFC3339))
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+}
+
+// printWorkers prints the per-worker statistics of a concurrent run
+func (r *Runner) printWorkers(w io.Writer) {
+	if len(r.suite.Workers) == 0 {
+		return
+	}
+
+	var fastest, slowest, sum time.Duration
+	for i, worker := range r.suite.Workers {
+		if i == 0 || worker.Duration < fastest {
+			fastest = worker.Duration
+		}
+		slowest = max(slowest, worker.Duration)
+		sum += worker.Duration
+	}
+	average := sum / time.Duration(len(r.suite.Workers))
+
+	fmt.Fprintf(w, "Workers:         %d (wall time min %s, avg %s, max %s)\n", len(r.suite.Workers),
+		fastest.Round(time.Millisecond), average.Round(time.Millisecond), slowest.Round(time.Millisecond))
+	for _, worker := range r.suite.Workers {
+		if worker.Error != "" {
+			fmt.Fprintf(w, "  Worker %-3d     did not run: %s\n", worker.ID, worker.Error)
+			continue
+		}
+		fmt.Fprintf(w, "  Worker %-3d     %d tests, %d passed, %d failed, %d skipped in %s (%s in tests)\n", worker.ID,
+			worker.Total, worker.Passed, worker.Failed, worker.Skipped, worker.Duration.Round(time.Millisecond), worker.TestTime.Round(time.Millisecond))
+	}
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+}
+
+// printSecurity prints the security posture summary, flagging concerns
+func (r *Runner) printSecurity(w io.Writer) {
+	if len(r.suite.Security) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "SECURITY POSTURE")
+	fmt.Fprintln(w, strings.Repeat("-", 80))
+	for _, check := range r.suite.Security {
+		marker := " "
+		if check.Concern {
+			marker = "⚠"
+		}
+		fmt.Fprintf(w, "%s %-40s %s\n", marker, check.Name+":", check.Result)
+	}
+	fmt.Fprintln(w, strings.Repeat("=", 80))
 }
 
 // GetExitCode returns the appropriate exit code based on test results
 func (r *Runner) GetExitCode() int {
+	if r.suite.Interrupted && errors.Is(r.cancelCause, context.Canceled) && !r.config.Loop {
+		return 130
+	}
+	// Another run may have worked on the same entries
+	if errors.Is(r.cancelCause, errLockLost) {
+		return 1
+	}
 	if r.suite.AllPassed() {
 		return 0
 	}
 	return 1
 }
 
+// formatCounts renders counts by name as "A 2, B 1", sorted by name
+func formatCounts(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %d", name, counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatTelemetry renders the tool telemetry with the change in memory and
+// goroutines since first, the sample after the first iteration
+func formatTelemetry(t, first health.Telemetry) string {
+	const mib = 1 << 20
+	return fmt.Sprintf("Heap: %.1f MiB (%+.1f MiB), Sys: %.1f MiB, Goroutines: %d (%+d), LDAP Connections: %d, GC: %d cycles, %.1fms total pause",
+		float64(t.HeapAllocBytes)/mib, (float64(t.HeapAllocBytes)-float64(first.HeapAllocBytes))/mib,
+		float64(t.SysBytes)/mib, t.Goroutines, t.Goroutines-first.Goroutines,
+		t.OpenConnections, t.GCCycles, t.GCPauseTotalMS)
+}
+
 // reportLoopStats prints cumulative statistics from loop mode
 func (r *Runner) reportLoopStats() {
 	fmt.Println("\n" + strings.Repeat("=", 80))
@@ -417,6 +1516,13 @@ func (r *Runner) reportLoopStats() {
 	fmt.Println(strings.Repeat("=", 80))
 
 	elapsed := time.Since(r.loopStats.StartTime)
+	if r.loopStats.TotalRuns == 0 {
+		// Stopped before the first scheduled run
+		fmt.Printf("Total Runtime:        %s\n", elapsed.Round(time.Second))
+		fmt.Println("No iteration ran")
+		fmt.Println(strings.Repeat("=", 80))
+		return
+	}
 
 	fmt.Printf("Total Runtime:        %s\n", elapsed.Round(time.Second))
 	fmt.Printf("Total Iterations:     %d\n", r.loopStats.TotalRuns)
@@ -434,6 +1540,9 @@ func (r *Runner) reportLoopStats() {
 	fmt.Printf("Tests Failed:         %d (%.1f%%)\n",
 		r.loopStats.TotalFailed,
 		float64(r.loopStats.TotalFailed)/float64(r.loopStats.TotalTests)*100)
+	fmt.Printf("Tests Skipped:        %d (%.1f%%)\n",
+		r.loopStats.TotalSkipped,
+		float64(r.loopStats.TotalSkipped)/float64(r.loopStats.TotalTests)*100)
 	fmt.Println(strings.Repeat("-", 80))
 	fmt.Printf("Total Test Time:      %s\n", r.loopStats.TotalDuration.Round(time.Millisecond))
 	fmt.Printf("Average Per Run:      %s\n", time.Duration(r.loopStats.TotalDuration.Nanoseconds()/int64(r.loopStats.TotalRuns)).Round(time.Millisecond))
@@ -443,6 +1552,16 @@ func (r *Runner) reportLoopStats() {
 		fmt.Printf("Average Per Test:     %s\n", avgTestTime.Round(time.Millisecond))
 	}
 
+	fmt.Println(strings.Repeat("-", 80))
+	fmt.Printf("Tool Telemetry:       %s\n", formatTelemetry(r.loopStats.LastTelemetry, r.loopStats.FirstTelemetry))
+
+	fmt.Println(strings.Repeat("-", 80))
+	r.loopStats.Tests.write(os.Stdout)
+	for _, test := range r.loopStats.Tests.flaky() {
+		logger.Warn("TestRunner", "Intermittent test", "operation", test.operation, "test", test.name,
+			"passed", test.passed, "runs", test.runs(), "distinctErrors", len(test.errors))
+	}
+
 	fmt.Println(strings.Repeat("=", 80))
 
 	if r.loopStats.FailedRuns == 0 {
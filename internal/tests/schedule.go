@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/schedule"
+)
+
+// waitForSchedule sleeps until the next time the schedule matches or a run is
+// requested on trigger, returning false if ctx is done first. A run that
+// overran one or more matches starts at the next match after it finished
+// rather than catching up.
+func waitForSchedule(ctx context.Context, sched *schedule.Schedule, trigger <-chan struct{}) bool {
+	next := sched.Next(time.Now())
+	logger.Info("TestRunner", "Waiting for the next scheduled run", "schedule", sched.String(), "at", next.Format(time.RFC3339))
+
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-trigger:
+		return true
+	case <-timer.C:
+		return true
+	}
+}
+
+// loopDelay returns the wait before the next loop iteration: delay seconds,
+// moved by a random amount of up to jitter seconds either way so the
+// iterations do not line up with periodic jobs of the server. The wait never
+// drops below zero, so a jitter larger than the delay favors short waits.
+func loopDelay(delay, jitter int) time.Duration {
+	d := time.Duration(delay) * time.Second
+	if jitter > 0 {
+		span := 2 * time.Duration(jitter) * time.Second
+		d += time.Duration(rand.Int63n(int64(span)+1)) - span/2
+	}
+	return max(d, 0)
+}
+
+// startRunLog writes the log of a loop iteration to a file of its own in
+// run_log_dir as well, returning the function that stops it. Without a run
+// log directory, or if the file cannot be opened, it does nothing.
+func (r *Runner) startRunLog(iteration int) func() {
+	if r.config.RunLogDir == "" {
+		return func() {}
+	}
+
+	path := filepath.Join(r.config.RunLogDir, fmt.Sprintf("ldap-test-%s-%d.log", time.Now().Format("2006-01-02-15-04-05"), iteration))
+	stop, err := logger.StartRunLog(path)
+	if err != nil {
+		logger.Warn("TestRunner", "Failed to open run log, logging to the main log only", "file", path, "error", err)
+		return func() {}
+	}
+	logger.Info("TestRunner", "Writing run log", "iteration", iteration, "file", path)
+	return stop
+}
+
+// scheduledRun is the outcome of one scheduled run, kept for the rolling
+// statistics
+type scheduledRun struct {
+	end      time.Time
+	passed   bool
+	duration time.Duration
+	tests    int
+	failed   int
+}
+
+// rollingStats summarizes the scheduled runs that finished within a window,
+// so a daemon running for months reports on recent runs rather than its
+// whole lifetime
+type rollingStats struct {
+	window time.Duration
+	runs   []scheduledRun
+}
+
+// add records a run and forgets those that finished before the window
+func (s *rollingStats) add(run scheduledRun) {
+	s.runs = append(s.runs, run)
+	cutoff := run.end.Add(-s.window)
+	for len(s.runs) > 0 && s.runs[0].end.Before(cutoff) {
+		s.runs = s.runs[1:]
+	}
+}
+
+// String renders the statistics of the runs in the window
+func (s *rollingStats) String() string {
+	window := strings.TrimSuffix(strings.TrimSuffix(s.window.String(), "0s"), "0m") // 24h rather than 24h0m0s
+	if len(s.runs) == 0 {
+		return fmt.Sprintf("No runs in the last %s", window)
+	}
+
+	var passed, tests, failed int
+	var total, slowest time.Duration
+	for _, run := range s.runs {
+		if run.passed {
+			passed++
+		}
+		tests += run.tests
+		failed += run.failed
+		total += run.duration
+		slowest = max(slowest, run.duration)
+	}
+	return fmt.Sprintf("Last %s: Runs: %d, Passed: %d (%.1f%%), Failed: %d, Failed Tests: %d/%d, Average: %s, Slowest: %s",
+		window, len(s.runs), passed, float64(passed)*100/float64(len(s.runs)), len(s.runs)-passed, failed, tests,
+		(total / time.Duration(len(s.runs))).Round(time.Millisecond), slowest.Round(time.Millisecond))
+}
@@ -0,0 +1,420 @@
+package tests
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// Fixtures of the schema suite
+const (
+	FixtureSubschema = "subschema" // subschemaSubentry DN discovered
+	FixtureSchema    = "schema"    // objectClasses and attributeTypes parsed
+)
+
+// schemaDefinition is an object class or attribute type of the subschema
+// (RFC 4512 section 4.1), reduced to the fields the tests check entries against
+type schemaDefinition struct {
+	OID         string
+	Names       []string
+	Kind        string   // STRUCTURAL, AUXILIARY or ABSTRACT for object classes, empty if not given
+	Sup         []string // superior object classes, or the superior attribute type
+	Must        []string
+	May         []string
+	SingleValue bool
+}
+
+// serverSchema is the parsed subschema of the server
+type serverSchema struct {
+	objectClasses  []schemaDefinition
+	attributeTypes []schemaDefinition
+	syntaxes       int
+	matchingRules  int
+	invalid        []string // definitions that did not parse, with the reason
+}
+
+// schemaState holds the subschema the suite discovered and parsed
+type schemaState struct {
+	dn     string
+	schema *serverSchema
+}
+
+// TestSchema runs the schema discovery tests: the subschemaSubentry is read
+// from the root DSE and its objectClasses and attributeTypes are parsed, then
+// checked for the object classes and attributes of the entries the tests
+// create, as shaped by the configured entry templates
+func TestSchema(conn *ldap.Connection, h *Harness) []TestResult {
+	logger.Info("SchemaTest", "Starting schema discovery tests")
+
+	state := &schemaState{}
+	results := h.Execute([]TestCase{
+		// Test 1: Find the subschema subentry in the root DSE
+		{Name: "Schema - Discover Subschema Subentry Test", Operation: "Schema", Provides: FixtureSubschema, Run: func() TestResult {
+			return testSchemaDiscover(conn, state)
+		}},
+
+		// Test 2: Read and parse the object classes and attribute types
+		{Name: "Schema - Parse Definitions Test", Operation: "Schema", Requires: []string{FixtureSubschema}, Provides: FixtureSchema, Run: func() TestResult {
+			return testSchemaParse(conn, state)
+		}},
+
+		// Test 3: Check the schema has what the test entries need
+		{Name: "Schema - Entry Template Classes Test", Operation: "Schema", Requires: []string{FixtureSchema}, Run: func() TestResult {
+			return testSchemaEntryTemplates(conn, state)
+		}},
+	})
+
+	logger.Info("SchemaTest", "Completed schema discovery tests", "total", len(results))
+	return results
+}
+
+func testSchemaDiscover(conn *ldap.Connection, state *schemaState) TestResult {
+	testName := "Schema - Discover Subschema Subentry Test"
+	logger.Info("SchemaTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Schema",
+	}
+
+	start := time.Now()
+	dn, source, err := findSubschema(conn)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Subschema not found: %v", err)
+		logger.Error("SchemaTest", result.Message)
+		return result
+	}
+	state.dn = dn
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("subschemaSubentry of %s is %s", source, dn)
+	logger.Info("SchemaTest", "PASS: "+testName, "subschemaSubentry", dn, "duration", result.Duration)
+	return result
+}
+
+// findSubschema returns the subschemaSubentry DN and where it was found. RFC
+// 4512 publishes it in the root DSE; some servers only name it on the entries
+// it governs, so the base DN is asked next.
+func findSubschema(conn *ldap.Connection) (dn, source string, err error) {
+	var lastErr error
+	for _, base := range []string{"", conn.GetConfig().BaseDN} {
+		entry, err := readAttributes(conn, base, "subschemaSubentry")
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if subschema := entry.GetEqualFoldAttributeValue("subschemaSubentry"); subschema != "" {
+			if base == "" {
+				return subschema, "the root DSE", nil
+			}
+			return subschema, base, nil
+		}
+	}
+	if lastErr != nil {
+		return "", "", fmt.Errorf("neither the root DSE nor the base DN names a subschemaSubentry: %w", lastErr)
+	}
+	return "", "", fmt.Errorf("neither the root DSE nor the base DN names a subschemaSubentry")
+}
+
+func testSchemaParse(conn *ldap.Connection, state *schemaState) TestResult {
+	testName := "Schema - Parse Definitions Test"
+	logger.Info("SchemaTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Schema",
+	}
+
+	start := time.Now()
+	schema, err := readSubschema(conn, state.dn)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Subschema unavailable: %v", err)
+		logger.Error("SchemaTest", result.Message)
+		return result
+	}
+	state.schema = schema
+
+	kinds := make(map[string]int)
+	for _, class := range schema.objectClasses {
+		// Object classes are structural unless the description says otherwise
+		if class.Kind == "" {
+			class.Kind = "STRUCTURAL"
+		}
+		kinds[class.Kind]++
+	}
+	logger.Debug("SchemaTest", "Schema parsed", "objectClasses", len(schema.objectClasses), "structural", kinds["STRUCTURAL"], "auxiliary", kinds["AUXILIARY"], "abstract", kinds["ABSTRACT"], "attributeTypes", len(schema.attributeTypes), "ldapSyntaxes", schema.syntaxes, "matchingRules", schema.matchingRules)
+
+	switch {
+	case len(schema.invalid) > 0:
+		result.Passed = false
+		result.Message = fmt.Sprintf("%d schema definitions could not be parsed, the first: %s", len(schema.invalid), schema.invalid[0])
+		logger.Error("SchemaTest", result.Message)
+		return result
+	case len(schema.objectClasses) == 0 || len(schema.attributeTypes) == 0:
+		result.Passed = false
+		result.Message = fmt.Sprintf("The subschema %s lists %d object classes and %d attribute types; read access to it may be denied", state.dn, len(schema.objectClasses), len(schema.attributeTypes))
+		logger.Error("SchemaTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Parsed %d object classes (%d structural, %d auxiliary, %d abstract) and %d attribute types; %d syntaxes, %d matching rules",
+		len(schema.objectClasses), kinds["STRUCTURAL"], kinds["AUXILIARY"], kinds["ABSTRACT"], len(schema.attributeTypes), schema.syntaxes, schema.matchingRules)
+	logger.Info("SchemaTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// readSubschema reads the subschema entry dn and parses its object classes
+// and attribute types, collecting the definitions that do not parse
+func readSubschema(conn *ldap.Connection, dn string) (*serverSchema, error) {
+	filter := "(objectClass=subschema)"
+	attributes := []string{"objectClasses", "attributeTypes", "ldapSyntaxes", "matchingRules"}
+	searchRequest := ldaplib.NewSearchRequest(
+		dn,
+		ldaplib.ScopeBaseObject,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		filter,
+		attributes,
+		nil,
+	)
+
+	logger.LogSearchOperation("SchemaTest", dn, filter, "base", attributes)
+	start := time.Now()
+	searchResult, err := conn.GetConnection().Search(searchRequest)
+	duration := time.Since(start)
+	if err != nil {
+		logger.LogLDAPResult("Search", "Search", false, -1, err.Error(), duration)
+		return nil, fmt.Errorf("failed to read the subschema %s: %w", dn, err)
+	}
+	logger.LogSearchResult("SchemaTest", len(searchResult.Entries), duration)
+	if len(searchResult.Entries) == 0 {
+		return nil, fmt.Errorf("the subschema %s returned no entry", dn)
+	}
+	entry := searchResult.Entries[0]
+
+	schema := &serverSchema{
+		syntaxes:      len(entry.GetEqualFoldAttributeValues("ldapSyntaxes")),
+		matchingRules: len(entry.GetEqualFoldAttributeValues("matchingRules")),
+	}
+	parse := func(attribute string) []schemaDefinition {
+		var definitions []schemaDefinition
+		for _, value := range entry.GetEqualFoldAttributeValues(attribute) {
+			definition, err := parseSchemaDefinition(value)
+			if err != nil {
+				schema.invalid = append(schema.invalid, fmt.Sprintf("%s %q: %v", attribute, value, err))
+				continue
+			}
+			definitions = append(definitions, definition)
+		}
+		return definitions
+	}
+	schema.objectClasses = parse("objectClasses")
+	schema.attributeTypes = parse("attributeTypes")
+	return schema, nil
+}
+
+func testSchemaEntryTemplates(conn *ldap.Connection, state *schemaState) TestResult {
+	testName := "Schema - Entry Template Classes Test"
+	logger.Info("SchemaTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Schema",
+	}
+
+	// The test user and group as the entry templates shape them; the DNs only
+	// matter for member values, so any base does
+	cfg := conn.GetConfig()
+	_, user, err := testUserEntry(cfg, cfg.BaseDN)
+	if err == nil {
+		var group map[string][]string
+		_, group, err = testGroupEntry(cfg, cfg.BaseDN)
+		for name, values := range group {
+			user[name] = append(user[name], values...)
+		}
+	}
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to apply the entry templates: %v", err)
+		logger.Error("SchemaTest", result.Message)
+		return result
+	}
+
+	classes := []string{"organizationalUnit"}
+	var attributes []string
+	for name, values := range user {
+		if strings.EqualFold(name, "objectClass") {
+			classes = append(classes, values...)
+			continue
+		}
+		attributes = append(attributes, name)
+	}
+	classes = uniqueFold(classes)
+	attributes = uniqueFold(append(attributes, "ou"))
+
+	missingClasses := missingDefinitions(state.schema.objectClasses, classes)
+	missingAttributes := missingDefinitions(state.schema.attributeTypes, attributes)
+	if len(missingClasses) > 0 || len(missingAttributes) > 0 {
+		result.Passed = false
+		result.Message = fmt.Sprintf("The schema lacks object classes %v and attribute types %v the test entries use", missingClasses, missingAttributes)
+		logger.Error("SchemaTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("All %d object classes (%s) and %d attribute types of the test entries are defined", len(classes), strings.Join(classes, ", "), len(attributes))
+	logger.Info("SchemaTest", "PASS: "+testName)
+	return result
+}
+
+// missingDefinitions returns the names of want that no definition has as a
+// name or OID
+func missingDefinitions(definitions []schemaDefinition, want []string) []string {
+	defined := make(map[string]bool)
+	for _, definition := range definitions {
+		defined[strings.ToLower(definition.OID)] = true
+		for _, name := range definition.Names {
+			defined[strings.ToLower(name)] = true
+		}
+	}
+
+	var missing []string
+	for _, name := range want {
+		if !defined[strings.ToLower(name)] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// uniqueFold returns names sorted, without the duplicates that differ only in case
+func uniqueFold(names []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, name := range names {
+		if !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			unique = append(unique, name)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// parseSchemaDefinition parses an object class or attribute type description:
+// a numeric OID and the NAME, SUP, MUST and MAY fields and the kind and
+// SINGLE-VALUE keywords of RFC 4512, in parentheses. The other fields and
+// extensions are read past.
+func parseSchemaDefinition(value string) (schemaDefinition, error) {
+	tokens, err := schemaTokens(value)
+	if err != nil {
+		return schemaDefinition{}, err
+	}
+	if len(tokens) < 3 || tokens[0] != "(" || tokens[len(tokens)-1] != ")" {
+		return schemaDefinition{}, fmt.Errorf("not a parenthesized description")
+	}
+	tokens = tokens[1 : len(tokens)-1]
+
+	definition := schemaDefinition{OID: tokens[0]}
+	if definition.OID == "(" || strings.HasPrefix(definition.OID, "'") || strings.EqualFold(definition.OID, "NAME") {
+		return schemaDefinition{}, fmt.Errorf("missing OID")
+	}
+
+	// list reads one value or a parenthesized list of them, separated by $
+	list := func(i int) ([]string, int, error) {
+		if i >= len(tokens) {
+			return nil, i, fmt.Errorf("missing value")
+		}
+		if tokens[i] != "(" {
+			return []string{strings.Trim(tokens[i], "'")}, i + 1, nil
+		}
+		var values []string
+		for i++; i < len(tokens); i++ {
+			switch tokens[i] {
+			case ")":
+				return values, i + 1, nil
+			case "$":
+			default:
+				values = append(values, strings.Trim(tokens[i], "'"))
+			}
+		}
+		return nil, i, fmt.Errorf("unterminated list")
+	}
+
+	for i := 1; i < len(tokens); {
+		keyword := strings.ToUpper(tokens[i])
+		i++
+		var values []string
+		switch keyword {
+		case "STRUCTURAL", "AUXILIARY", "ABSTRACT":
+			definition.Kind = keyword
+			continue
+		case "SINGLE-VALUE":
+			definition.SingleValue = true
+			continue
+		case "OBSOLETE", "COLLECTIVE", "NO-USER-MODIFICATION":
+			continue
+		default:
+			// NAME, SUP, MUST, MAY, and DESC, SYNTAX, X- extensions and the like
+			values, i, err = list(i)
+		}
+		if err != nil {
+			return schemaDefinition{}, fmt.Errorf("%s: %w", keyword, err)
+		}
+		switch keyword {
+		case "NAME":
+			definition.Names = values
+		case "SUP":
+			definition.Sup = values
+		case "MUST":
+			definition.Must = values
+		case "MAY":
+			definition.May = values
+		}
+	}
+	return definition, nil
+}
+
+// schemaTokens splits a schema description into parentheses, $ separators,
+// quoted strings (kept with their quotes) and bare words
+func schemaTokens(value string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(value); {
+		switch c := value[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '$':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '\'':
+			end := strings.IndexByte(value[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted string")
+			}
+			tokens = append(tokens, value[i:i+end+2])
+			i += end + 2
+		default:
+			end := strings.IndexAny(value[i:], " \t\n\r()$'")
+			if end < 0 {
+				end = len(value) - i
+			}
+			tokens = append(tokens, value[i:i+end])
+			i += end
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,270 @@
+package tests
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// schemaViolationsShown is the number of violations a validation result lists
+const schemaViolationsShown = 5
+
+// schemaIndex looks up the definitions of a serverSchema by any of their
+// names or their OID, ignoring case
+type schemaIndex struct {
+	classes    map[string]*schemaDefinition
+	attributes map[string]*schemaDefinition
+}
+
+func newSchemaIndex(schema *serverSchema) *schemaIndex {
+	index := func(definitions []schemaDefinition) map[string]*schemaDefinition {
+		byName := make(map[string]*schemaDefinition)
+		for i := range definitions {
+			definition := &definitions[i]
+			byName[strings.ToLower(definition.OID)] = definition
+			for _, name := range definition.Names {
+				byName[strings.ToLower(name)] = definition
+			}
+		}
+		return byName
+	}
+	return &schemaIndex{
+		classes:    index(schema.objectClasses),
+		attributes: index(schema.attributeTypes),
+	}
+}
+
+// validateEntry checks the attributes of an add request against the schema:
+// the object classes and attribute types must be defined, single-valued
+// attributes must have one value and, if rules is set, there must be a
+// structural class, every required attribute, and no attribute that the
+// object classes do not allow
+func (s *schemaIndex) validateEntry(attributes map[string][]string, rules bool) []string {
+	var violations []string
+
+	// The object classes, with the classes they inherit from
+	var classes []*schemaDefinition
+	seen := make(map[*schemaDefinition]bool)
+	var inherit func(name string, listed bool)
+	inherit = func(name string, listed bool) {
+		class, ok := s.classes[strings.ToLower(name)]
+		if !ok {
+			if listed {
+				violations = append(violations, fmt.Sprintf("unknown object class %s", name))
+			}
+			return
+		}
+		if seen[class] {
+			return
+		}
+		seen[class] = true
+		classes = append(classes, class)
+		for _, sup := range class.Sup {
+			inherit(sup, false)
+		}
+	}
+	var objectClasses []string
+	for name, values := range attributes {
+		if strings.EqualFold(name, "objectClass") {
+			objectClasses = values
+		}
+	}
+	for _, name := range objectClasses {
+		inherit(name, true)
+	}
+
+	present := make(map[*schemaDefinition]bool)
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attribute, ok := s.attributes[strings.ToLower(name)]
+		if !ok {
+			violations = append(violations, fmt.Sprintf("unknown attribute type %s", name))
+			continue
+		}
+		present[attribute] = true
+		if attribute.SingleValue && len(attributes[name]) > 1 {
+			violations = append(violations, fmt.Sprintf("%s is single-valued, but has %d values", name, len(attributes[name])))
+		}
+	}
+	if !rules {
+		return violations
+	}
+
+	structural := false
+	for _, name := range objectClasses {
+		if class, ok := s.classes[strings.ToLower(name)]; ok && (class.Kind == "" || class.Kind == "STRUCTURAL") {
+			structural = true
+		}
+	}
+	if !structural && len(objectClasses) > 0 {
+		violations = append(violations, "no structural object class")
+	}
+
+	allowed := make(map[*schemaDefinition]bool)
+	extensible := false
+	for _, class := range classes {
+		extensible = extensible || class.hasName("extensibleObject")
+		for _, name := range class.Must {
+			attribute, ok := s.attributes[strings.ToLower(name)]
+			if !ok {
+				continue
+			}
+			allowed[attribute] = true
+			if !present[attribute] {
+				violations = append(violations, fmt.Sprintf("missing %s, required by %s", name, class.name()))
+			}
+		}
+		for _, name := range class.May {
+			if attribute, ok := s.attributes[strings.ToLower(name)]; ok {
+				allowed[attribute] = true
+			}
+		}
+	}
+	if !extensible {
+		for _, name := range names {
+			if attribute, ok := s.attributes[strings.ToLower(name)]; ok && !allowed[attribute] {
+				violations = append(violations, fmt.Sprintf("%s is not allowed by the object classes %s", name, strings.Join(objectClasses, ", ")))
+			}
+		}
+	}
+	return violations
+}
+
+// name returns the first name of a definition, its OID if it has none
+func (d *schemaDefinition) name() string {
+	if len(d.Names) > 0 {
+		return d.Names[0]
+	}
+	return d.OID
+}
+
+// hasName reports whether name is one of the names of a definition
+func (d *schemaDefinition) hasName(name string) bool {
+	for _, n := range d.Names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateEntries checks the entries the tests and the generator create
+// against the server's schema before any of them is added: the test user and
+// group, and the generated users and groups if generate is set, all as the
+// entry templates shape them. Each kind of entry is reported as a result of
+// its own, failing with the violations found.
+func ValidateEntries(conn *ldap.Connection, testBaseDN string) []TestResult {
+	logger.Info("SchemaValidation", "Validating the entries to add against the server schema")
+
+	failed := func(kind string, err error) TestResult {
+		result := TestResult{
+			Name:      "Schema Validation - " + kind,
+			Operation: "Schema",
+			Passed:    false,
+			Error:     err,
+			Message:   fmt.Sprintf("Cannot validate the entries to add: %v", err),
+		}
+		logger.Error("SchemaValidation", result.Message)
+		return result
+	}
+
+	dn, _, err := findSubschema(conn)
+	if err != nil {
+		return []TestResult{failed("Read Schema", err)}
+	}
+	schema, err := readSubschema(conn, dn)
+	if err != nil {
+		return []TestResult{failed("Read Schema", err)}
+	}
+	if len(schema.objectClasses) == 0 || len(schema.attributeTypes) == 0 {
+		return []TestResult{failed("Read Schema", fmt.Errorf("the subschema %s lists no object classes or attribute types", dn))}
+	}
+	index := newSchemaIndex(schema)
+
+	// Active Directory lists the attributes the server fills in as required
+	// and leaves out the auxiliary classes of its classes, so only the
+	// definitions and single values are checked
+	rules := conn.Vendor() != ldap.VendorActiveDirectory
+
+	cfg := conn.GetConfig()
+	var results []TestResult
+	validate := func(kind string, requests []*ldaplib.AddRequest) {
+		results = append(results, validateRequests(index, rules, kind, requests))
+	}
+
+	if userDN, user, err := testUserEntry(cfg, testBaseDN); err != nil {
+		results = append(results, failed("Test User", err))
+	} else {
+		validate("Test User", []*ldaplib.AddRequest{generatedRequest(userDN, user)})
+	}
+	if groupDN, group, err := testGroupEntry(cfg, testBaseDN); err != nil {
+		results = append(results, failed("Test Group", err))
+	} else {
+		validate("Test Group", []*ldaplib.AddRequest{generatedRequest(groupDN, group)})
+	}
+	if cfg.Generate > 0 {
+		if data, err := newSyntheticData(cfg, "ou=generated,"+testBaseDN, cfg.Generate); err != nil {
+			results = append(results, failed("Generated Entries", err))
+		} else {
+			validate("Generated OUs", data.ous)
+			validate("Generated Users", data.users)
+			validate("Generated Groups", data.groups)
+		}
+	}
+	return results
+}
+
+// validateRequests validates add requests of one kind, reporting the
+// violations of the first entries that have any
+func validateRequests(index *schemaIndex, rules bool, kind string, requests []*ldaplib.AddRequest) TestResult {
+	testName := "Schema Validation - " + kind
+	logger.Info("SchemaValidation", "Running: "+testName, "entries", len(requests))
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Schema",
+	}
+
+	start := time.Now()
+	var violations []string
+	invalid := 0
+	for _, request := range requests {
+		attributes := make(map[string][]string, len(request.Attributes))
+		for _, attribute := range request.Attributes {
+			attributes[attribute.Type] = append(attributes[attribute.Type], attribute.Vals...)
+		}
+		found := index.validateEntry(attributes, rules)
+		if len(found) == 0 {
+			continue
+		}
+		invalid++
+		for _, violation := range found {
+			if len(violations) < schemaViolationsShown {
+				violations = append(violations, request.DN+": "+violation)
+			}
+		}
+	}
+	result.Duration = time.Since(start)
+
+	if invalid > 0 {
+		result.Passed = false
+		result.Message = fmt.Sprintf("%d of %d entries violate the server schema: %s", invalid, len(requests), strings.Join(violations, "; "))
+		logger.Error("SchemaValidation", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("All %d entries conform to the server schema", len(requests))
+	logger.Info("SchemaValidation", "PASS: "+testName, "entries", len(requests), "duration", result.Duration)
+	return result
+}
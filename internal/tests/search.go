@@ -2,36 +2,47 @@ package tests
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"ldap-automated-actions/internal/ldap"
 	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
 
 	ldaplib "github.com/go-ldap/ldap/v3"
 )
 
 // TestSearch runs all search operation tests
-func TestSearch(conn *ldap.Connection, testBaseDN string) []TestResult {
+func TestSearch(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
 	logger.Info("SearchTest", "Starting Search operation tests")
-	results := make([]TestResult, 0)
 
-	// Test 1: Search with base scope
-	results = append(results, testSearchBase(conn, testBaseDN))
+	cases := []TestCase{
+		// Test 1: Search with base scope
+		{Name: "Search with Base Scope Test", Operation: "Search", Run: func() TestResult { return testSearchBase(conn, testBaseDN) }},
 
-	// Test 2: Search with one level scope
-	results = append(results, testSearchOneLevel(conn, testBaseDN))
+		// Test 2: Search with one level scope
+		{Name: "Search with One Level Scope Test", Operation: "Search", Run: func() TestResult { return testSearchOneLevel(conn, testBaseDN) }},
 
-	// Test 3: Search with subtree scope
-	results = append(results, testSearchSubtree(conn, testBaseDN))
+		// Test 3: Search with subtree scope
+		{Name: "Search with Subtree Scope Test", Operation: "Search", Run: func() TestResult { return testSearchSubtree(conn, testBaseDN) }},
 
-	// Test 4: Search with filter
-	results = append(results, testSearchWithFilter(conn, testBaseDN))
+		// Test 4: Search with filter
+		{Name: "Search with Filter Test", Operation: "Search", Run: func() TestResult { return testSearchWithFilter(conn, testBaseDN) }},
 
-	// Test 5: Search with attribute selection
-	results = append(results, testSearchWithAttributes(conn, testBaseDN))
+		// Test 5: Search with attribute selection
+		{Name: "Search with Attribute Selection Test", Operation: "Search", Requires: []string{FixtureTestUser}, Run: func() TestResult { return testSearchWithAttributes(conn, testBaseDN) }},
 
-	// Test 6: Search with paging (if many results)
-	results = append(results, testSearchWithPaging(conn, conn.GetConfig().BaseDN))
+		// Test 6: Search with paging (if many results)
+		{Name: "Search with Paging Test", Operation: "Search", Needs: []Capability{CapabilityPagedResults}, Run: func() TestResult { return testSearchWithPaging(conn, conn.GetConfig().BaseDN) }},
+
+		// Test 7: Search as another identity with the Proxied Authorization control
+		{Name: "Search with Proxied Authorization Test", Operation: "Search", Needs: []Capability{CapabilityProxiedAuthz}, Run: func() TestResult { return testSearchProxiedAuthz(conn) }},
+	}
+
+	// Create the fixtures of the add suite if it did not run
+	teardown := setupFixtures(conn, testBaseDN, trk, h, "search", cases)
+	defer teardown()
+	results := h.Execute(cases)
 
 	logger.Info("SearchTest", "Completed Search operation tests", "total", len(results))
 	return results
@@ -57,7 +68,7 @@ func testSearchBase(conn *ldap.Connection, testBaseDN string) TestResult {
 	)
 
 	start := time.Now()
-	result, err := conn.GetConnection().Search(searchRequest)
+	result, err := conn.Search(searchRequest)
 	duration := time.Since(start)
 
 	testResult := TestResult{
@@ -102,7 +113,7 @@ func testSearchOneLevel(conn *ldap.Connection, testBaseDN string) TestResult {
 	)
 
 	start := time.Now()
-	result, err := conn.GetConnection().Search(searchRequest)
+	result, err := conn.Search(searchRequest)
 	duration := time.Since(start)
 
 	testResult := TestResult{
@@ -147,7 +158,7 @@ func testSearchSubtree(conn *ldap.Connection, testBaseDN string) TestResult {
 	)
 
 	start := time.Now()
-	result, err := conn.GetConnection().Search(searchRequest)
+	result, err := conn.Search(searchRequest)
 	duration := time.Since(start)
 
 	testResult := TestResult{
@@ -204,7 +215,7 @@ func testSearchWithFilter(conn *ldap.Connection, testBaseDN string) TestResult {
 	)
 
 	start := time.Now()
-	result, err := conn.GetConnection().Search(searchRequest)
+	result, err := conn.Search(searchRequest)
 	duration := time.Since(start)
 
 	testResult := TestResult{
@@ -255,7 +266,7 @@ func testSearchWithAttributes(conn *ldap.Connection, testBaseDN string) TestResu
 	)
 
 	start := time.Now()
-	result, err := conn.GetConnection().Search(searchRequest)
+	result, err := conn.Search(searchRequest)
 	duration := time.Since(start)
 
 	testResult := TestResult{
@@ -388,3 +399,101 @@ func testSearchWithPaging(conn *ldap.Connection, baseDN string) TestResult {
 
 	return testResult
 }
+
+// controlTypeProxiedAuthz is the Proxied Authorization control (RFC 4370);
+// its value is the authzId itself rather than BER
+const controlTypeProxiedAuthz = "2.16.840.1.113730.3.4.18"
+
+// testSearchProxiedAuthz searches the base DN as proxy_authz_id. The server
+// must honor the control, running the search as that identity, or refuse it
+// with authorizationDenied; proxy_authz_expect narrows this to one outcome.
+func testSearchProxiedAuthz(conn *ldap.Connection) TestResult {
+	testName := "Search with Proxied Authorization Test"
+	logger.Info("SearchTest", "Running: "+testName)
+
+	testResult := TestResult{
+		Name:      testName,
+		Operation: "Search",
+	}
+
+	cfg := conn.GetConfig()
+	if cfg.ProxyAuthzID == "" {
+		logger.Warn("SearchTest", "SKIP: "+testName, "reason", "no proxy_authz_id configured")
+		testResult.Skipped = true
+		testResult.Message = "Skipped: no proxy_authz_id configured"
+		return testResult
+	}
+
+	fail := func(err error, message string) TestResult {
+		testResult.Passed = false
+		testResult.Error = err
+		testResult.Message = message
+		logger.Error("SearchTest", testResult.Message)
+		return testResult
+	}
+
+	control := ldaplib.NewControlString(controlTypeProxiedAuthz, true, cfg.ProxyAuthzID)
+	searchRequest := ldaplib.NewSearchRequest(
+		cfg.BaseDN,
+		ldaplib.ScopeBaseObject,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		[]string{"1.1"},
+		[]ldaplib.Control{control},
+	)
+
+	logger.LogSearchOperation("Search", cfg.BaseDN, "(objectClass=*)", "base", []string{"1.1"})
+	logger.Trace("Search", "Proxied authorization", "authzId", cfg.ProxyAuthzID)
+	start := time.Now()
+	_, err := conn.GetConnection().Search(searchRequest)
+	testResult.Duration = time.Since(start)
+
+	if ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultAuthorizationDenied) {
+		logger.LogLDAPResult("Search", "Search (proxied)", false, ldaplib.LDAPResultAuthorizationDenied, err.Error(), testResult.Duration)
+		if cfg.ProxyAuthzExpect == "allow" {
+			return fail(err, fmt.Sprintf("Proxied authorization as %s rejected, but proxy_authz_expect is allow: %v", cfg.ProxyAuthzID, err))
+		}
+		testResult.Passed = true
+		testResult.Message = fmt.Sprintf("Proxied authorization as %s rejected with authorizationDenied (123)", cfg.ProxyAuthzID)
+		logger.Info("SearchTest", "PASS: "+testName, "outcome", "denied", "duration", testResult.Duration)
+		return testResult
+	}
+	if err != nil {
+		logger.LogLDAPResult("Search", "Search (proxied)", false, -1, err.Error(), testResult.Duration)
+		return fail(err, fmt.Sprintf("Search as %s failed other than with authorizationDenied: %v", cfg.ProxyAuthzID, err))
+	}
+	logger.LogLDAPResult("Search", "Search (proxied)", true, 0, "Success", testResult.Duration)
+
+	if cfg.ProxyAuthzExpect == "deny" {
+		return fail(nil, fmt.Sprintf("Proxied authorization as %s honored, but proxy_authz_expect is deny", cfg.ProxyAuthzID))
+	}
+
+	// The server should report the proxied identity for a request with the control
+	identity := "identity not verified, WhoAmI failed"
+	whoami, err := conn.GetConnection().WhoAmI([]ldaplib.Control{control})
+	if err == nil {
+		if !sameAuthzID(whoami.AuthzID, cfg.ProxyAuthzID) {
+			return fail(nil, fmt.Sprintf("Proxied authorization as %s honored, but WhoAmI reports %q", cfg.ProxyAuthzID, whoami.AuthzID))
+		}
+		identity = "WhoAmI confirms the identity"
+	} else {
+		logger.Debug("SearchTest", "WhoAmI with proxied authorization failed", "error", err)
+	}
+
+	testResult.Passed = true
+	testResult.Message = fmt.Sprintf("Proxied authorization as %s honored, %s", cfg.ProxyAuthzID, identity)
+	logger.Info("SearchTest", "PASS: "+testName, "outcome", "honored", "duration", testResult.Duration)
+	return testResult
+}
+
+// sameAuthzID reports whether two authzIds name the same identity: dn: forms
+// are compared as DNs, u: forms ignoring case
+func sameAuthzID(a, b string) bool {
+	aDN, aIsDN := strings.CutPrefix(a, "dn:")
+	bDN, bIsDN := strings.CutPrefix(b, "dn:")
+	if aIsDN && bIsDN {
+		return sameDN(aDN, bDN)
+	}
+	return strings.EqualFold(a, b)
+}
@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/ldif"
+	"ldap-automated-actions/internal/logger"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// operationalAttributes are server-maintained attributes that cannot be
+// written back on restore and are therefore excluded from snapshots
+var operationalAttributes = []string{
+	"createTimestamp",
+	"creatorsName",
+	"modifyTimestamp",
+	"modifiersName",
+	"entryUUID",
+	"entryCSN",
+	"entryDN",
+	"entryID",
+	"structuralObjectClass",
+	"subschemaSubentry",
+	"hasSubordinates",
+	"numSubordinates",
+	"contextCSN",
+	"pwdChangedTime",
+	"pwdFailureTime",
+	"pwdAccountLockedTime",
+	"ds-sync-hist",
+	"ds-sync-state",
+	"etag",
+	"isMemberOf",
+	"memberOf",
+	"nsUniqueId",
+	"objectGUID",
+	"whenCreated",
+	"whenChanged",
+	"uSNCreated",
+	"uSNChanged",
+}
+
+// SnapshotSubtree exports every entry under baseDN to LDIF content records,
+// excluding operational attributes, and returns the number of entries written
+func SnapshotSubtree(conn *ldap.Connection, baseDN string, w *ldif.Writer, exclude []string) (int, error) {
+	logger.Info("Snapshot", "Exporting subtree", "baseDN", baseDN)
+
+	excluded := make(map[string]bool)
+	for _, name := range append(operationalAttributes, exclude...) {
+		excluded[strings.ToLower(name)] = true
+	}
+
+	filter := "(objectClass=*)"
+	attributes := []string{"*"}
+	logger.LogSearchOperation("Snapshot", baseDN, filter, "sub (paged)", attributes)
+
+	searchRequest := ldaplib.NewSearchRequest(
+		baseDN,
+		ldaplib.ScopeWholeSubtree,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		filter,
+		attributes,
+		nil,
+	)
+
+	start := time.Now()
+	result, err := conn.GetConnection().SearchWithPaging(searchRequest, 500)
+	duration := time.Since(start)
+
+	if err != nil {
+		logger.LogLDAPResult("Snapshot", "Search", false, -1, err.Error(), duration)
+		return 0, fmt.Errorf("failed to search subtree: %w", err)
+	}
+	logger.LogSearchResult("Snapshot", len(result.Entries), duration)
+
+	// Write parents before children so the file can be restored in order
+	entries := result.Entries
+	sort.SliceStable(entries, func(i, j int) bool {
+		return dnDepth(entries[i].DN) < dnDepth(entries[j].DN)
+	})
+
+	if err := w.WriteComment(fmt.Sprintf("Snapshot of %s taken %s", baseDN, time.Now().Format(time.RFC3339))); err != nil {
+		return 0, err
+	}
+	if err := w.WriteVersion(); err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		attrs := make([]ldif.Attribute, 0, len(entry.Attributes))
+		for _, attr := range entry.Attributes {
+			if excluded[strings.ToLower(attr.Name)] {
+				continue
+			}
+			values := make([]string, len(attr.ByteValues))
+			for i, value := range attr.ByteValues {
+				values[i] = string(value)
+			}
+			attrs = append(attrs, ldif.Attribute{Name: attr.Name, Values: values})
+		}
+
+		if err := w.WriteEntry(entry.DN, attrs); err != nil {
+			return w.Records(), fmt.Errorf("failed to write entry %s: %w", entry.DN, err)
+		}
+		logger.Trace("Snapshot", "Exported entry", "dn", entry.DN, "attributes", len(attrs))
+	}
+
+	logger.Info("Snapshot", "Subtree exported", "entries", w.Records())
+	return w.Records(), nil
+}
+
+// RestoreSnapshot re-creates the entries of a snapshot, parents first. Entries
+// that already exist have their snapshot attributes replaced instead.
+func RestoreSnapshot(conn *ldap.Connection, records []ldif.Record) []TestResult {
+	logger.Info("Restore", "Restoring snapshot", "entries", len(records))
+	results := make([]TestResult, 0, len(records))
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return dnDepth(records[i].DN) < dnDepth(records[j].DN)
+	})
+
+	for _, record := range records {
+		if record.ChangeType != ldif.ChangeAdd {
+			results = append(results, TestResult{
+				Name:      fmt.Sprintf("Restore %s", record.DN),
+				Operation: "Restore",
+				Passed:    false,
+				Message:   fmt.Sprintf("Snapshot contains a %s change record at line %d; only entries can be restored", record.ChangeType, record.Line),
+			})
+			continue
+		}
+		results = append(results, restoreEntry(conn, record))
+	}
+
+	logger.Info("Restore", "Completed snapshot restore", "total", len(results))
+	return results
+}
+
+func restoreEntry(conn *ldap.Connection, record ldif.Record) TestResult {
+	testName := fmt.Sprintf("Restore %s", record.DN)
+	logger.Debug("Restore", "Restoring entry", "dn", record.DN)
+	logger.LogLDAPOperation("Restore", "Add", record.DN, record.AttributeMap())
+
+	addRequest := ldaplib.NewAddRequest(record.DN, nil)
+	for _, attr := range record.Attributes {
+		addRequest.Attribute(attr.Name, attr.Values)
+	}
+
+	start := time.Now()
+	err := conn.Add(addRequest)
+	message := "Entry re-created"
+
+	if ldaplib.IsErrorWithCode(err, ldaplib.LDAPResultEntryAlreadyExists) {
+		logger.Debug("Restore", "Entry exists, replacing snapshot attributes", "dn", record.DN)
+
+		modifyRequest := ldaplib.NewModifyRequest(record.DN, nil)
+		for _, attr := range record.Attributes {
+			if strings.EqualFold(attr.Name, "objectClass") {
+				continue
+			}
+			modifyRequest.Replace(attr.Name, attr.Values)
+		}
+		err = conn.Modify(modifyRequest)
+		message = "Existing entry updated to snapshot values"
+	}
+	duration := time.Since(start)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Restore",
+		Duration:  duration,
+	}
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to restore entry: %v", err)
+		logger.LogLDAPResult("Restore", "Add", false, -1, err.Error(), duration)
+		logger.Error("Restore", result.Message, "dn", record.DN)
+	} else {
+		result.Passed = true
+		result.Message = message
+		logger.LogLDAPResult("Restore", "Add", true, 0, "Success", duration)
+	}
+
+	return result
+}
+
+// dnDepth returns the number of RDN components in a DN
+func dnDepth(dn string) int {
+	depth := 0
+	for dn != "" {
+		depth++
+		dn = ldif.ParentDN(dn)
+	}
+	return depth
+}
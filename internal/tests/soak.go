@@ -0,0 +1,240 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// soakDriftWindow is the number of heartbeat rounds whose median latency is
+// compared between the start and the end of the soak
+const soakDriftWindow = 5
+
+// soakConn is one of the long-lived connections kept bound by the soak test
+type soakConn struct {
+	id          int
+	conn        *ldap.Connection
+	since       time.Time // when the current connection was established
+	disconnects int
+	rebinds     int
+	failures    int
+	longestUp   time.Duration // longest time a connection survived before dropping
+}
+
+// TestSoak runs the soak test, which keeps connections bound for duration and
+// sends a heartbeat on each of them every interval
+func TestSoak(conn *ldap.Connection, baseDN string, connections int, duration, interval time.Duration, h *Harness) []TestResult {
+	logger.Info("SoakTest", "Starting soak tests")
+
+	results := h.Execute([]TestCase{
+		// Test 1: Long-lived idle connections must stay usable
+		{Name: "Connection Soak Test", Operation: "Soak", Run: func() TestResult {
+			return testConnectionSoak(conn, baseDN, connections, duration, interval, h)
+		}},
+	})
+
+	logger.Info("SoakTest", "Completed soak tests", "total", len(results))
+	return results
+}
+
+// testConnectionSoak keeps connections bound and idle between heartbeats.
+// Idle connections are what a firewall or load balancer expires from its
+// state table, which the client typically only notices as a reset or a
+// silently vanished session on its next request.
+func testConnectionSoak(conn *ldap.Connection, baseDN string, connections int, duration, interval time.Duration, h *Harness) TestResult {
+	testName := "Connection Soak Test"
+	logger.Info("SoakTest", "Running: "+testName, "connections", connections, "duration", duration, "interval", interval)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Soak",
+	}
+
+	start := time.Now()
+	pool := make([]*soakConn, 0, connections)
+	defer func() {
+		for _, sc := range pool {
+			if sc.conn != nil {
+				sc.conn.Close()
+			}
+		}
+	}()
+	for i := 0; i < connections; i++ {
+		c, err := openSoakConn(conn)
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Failed to open soak connection %d: %v", i+1, err)
+			logger.Error("SoakTest", result.Message)
+			return result
+		}
+		pool = append(pool, &soakConn{id: i + 1, conn: c, since: time.Now()})
+	}
+
+	var rounds [][]time.Duration
+	for time.Since(start) < duration {
+		select {
+		case <-h.ctx.Done():
+		case <-time.After(min(interval, duration-time.Since(start))):
+		}
+		if h.ctx.Err() != nil {
+			break
+		}
+
+		var latencies []time.Duration
+		for _, sc := range pool {
+			if latency, ok := heartbeat(conn, sc, baseDN); ok {
+				latencies = append(latencies, latency)
+			}
+		}
+		rounds = append(rounds, latencies)
+		logger.Info("SoakTest", "Heartbeat round", "round", len(rounds), "elapsed", time.Since(start).Round(time.Second), "ok", len(latencies), "median", median(latencies))
+	}
+	result.Duration = time.Since(start)
+
+	if len(rounds) == 0 {
+		logger.Warn("SoakTest", "SKIP: "+testName, "reason", "run ended before the first heartbeat")
+		result.Skipped = true
+		result.Message = fmt.Sprintf("Skipped: the run ended before the first heartbeat (interval %s)", interval)
+		return result
+	}
+
+	var disconnects, rebinds, failures int
+	var longestUp time.Duration
+	for _, sc := range pool {
+		disconnects += sc.disconnects
+		rebinds += sc.rebinds
+		failures += sc.failures
+		longestUp = max(longestUp, sc.longestUp)
+	}
+
+	window := min(soakDriftWindow, (len(rounds)+1)/2)
+	first, last := median(flatten(rounds[:window])), median(flatten(rounds[len(rounds)-window:]))
+	summary := fmt.Sprintf("%d connections for %s, %d heartbeat rounds every %s; median latency %s at start, %s at end",
+		connections, result.Duration.Round(time.Second), len(rounds), interval, first.Round(time.Millisecond), last.Round(time.Millisecond))
+
+	var problems []string
+	if disconnects > 0 {
+		problems = append(problems, fmt.Sprintf("%d disconnects (longest-lived connection dropped after %s)", disconnects, longestUp.Round(time.Second)))
+	}
+	if rebinds > 0 {
+		problems = append(problems, fmt.Sprintf("%d sessions had to re-bind", rebinds))
+	}
+	if failures > 0 {
+		problems = append(problems, fmt.Sprintf("%d heartbeats failed", failures))
+	}
+	if degraded(first, last) {
+		problems = append(problems, "latency drifted")
+	}
+	if len(problems) > 0 {
+		result.Passed = false
+		result.Message = fmt.Sprintf("%s: %s", strings.Join(problems, ", "), summary)
+		logger.Error("SoakTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = "No disconnects or re-binds: " + summary
+	logger.Info("SoakTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
+
+// heartbeat sends a base search on the soak connection and returns its
+// latency. A dropped connection is re-opened, and a session that stopped
+// answering is re-bound; both are counted and the heartbeat reports !ok.
+func heartbeat(conn *ldap.Connection, sc *soakConn, baseDN string) (time.Duration, bool) {
+	if sc.conn == nil {
+		if !reopenSoakConn(conn, sc) {
+			return 0, false
+		}
+	}
+
+	start := time.Now()
+	err := heartbeatSearch(sc.conn, baseDN)
+	latency := time.Since(start)
+	if err == nil {
+		logger.Debug("SoakTest", "Heartbeat", "connection", sc.id, "latency", latency)
+		return latency, true
+	}
+
+	if isDisconnect(err) || ldaplib.IsErrorWithCode(err, ldaplib.ErrorNetwork) {
+		up := time.Since(sc.since)
+		sc.disconnects++
+		sc.longestUp = max(sc.longestUp, up)
+		logger.Warn("SoakTest", "Soak connection dropped", "connection", sc.id, "up", up.Round(time.Second), "error", err)
+		sc.conn.Close()
+		reopenSoakConn(conn, sc)
+		return 0, false
+	}
+
+	// The connection is up but the session no longer works as bound, e.g. a
+	// proxy reverted it to anonymous; a fresh bind tells whether that is it
+	logger.Warn("SoakTest", "Heartbeat failed, re-binding", "connection", sc.id, "error", err)
+	if bindErr := sc.conn.Bind(); bindErr == nil && heartbeatSearch(sc.conn, baseDN) == nil {
+		sc.rebinds++
+		logger.Warn("SoakTest", "Soak session required a re-bind", "connection", sc.id, "up", time.Since(sc.since).Round(time.Second))
+		return 0, false
+	}
+	sc.failures++
+	logger.Error("SoakTest", "Heartbeat failed after re-bind", "connection", sc.id, "error", err)
+	return 0, false
+}
+
+// heartbeatSearch is the light request sent on every heartbeat
+func heartbeatSearch(c *ldap.Connection, baseDN string) error {
+	searchRequest := ldaplib.NewSearchRequest(
+		baseDN,
+		ldaplib.ScopeBaseObject,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		[]string{"1.1"},
+		nil,
+	)
+	logger.Trace("Soak", "Operation: Search (heartbeat)", "base", baseDN)
+	_, err := c.GetConnection().Search(searchRequest)
+	return err
+}
+
+// openSoakConn opens a new connection bound like conn
+func openSoakConn(conn *ldap.Connection) (*ldap.Connection, error) {
+	c, err := ldap.NewConnection(conn.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Bind(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// reopenSoakConn replaces a dropped soak connection; on failure the next
+// heartbeat tries again
+func reopenSoakConn(conn *ldap.Connection, sc *soakConn) bool {
+	c, err := openSoakConn(conn)
+	if err != nil {
+		sc.conn = nil
+		sc.failures++
+		logger.Error("SoakTest", "Failed to re-open soak connection", "connection", sc.id, "error", err)
+		return false
+	}
+	sc.conn = c
+	sc.since = time.Now()
+	return true
+}
+
+// flatten joins the latencies of several heartbeat rounds
+func flatten(rounds [][]time.Duration) []time.Duration {
+	var all []time.Duration
+	for _, round := range rounds {
+		all = append(all, round...)
+	}
+	return all
+}
@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"fmt"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// TestStartTLS runs all StartTLS misuse tests
+func TestStartTLS(conn *ldap.Connection, h *Harness) []TestResult {
+	logger.Info("StartTLSTest", "Starting StartTLS misuse tests")
+
+	results := h.Execute([]TestCase{
+		// Test 1: StartTLS on an LDAPS session (negative)
+		{Name: "StartTLS on LDAPS Session Test (Negative)", Operation: "StartTLS", Run: func() TestResult { return testStartTLSOnLDAPS(conn) }},
+
+		// Test 2: StartTLS twice (negative)
+		{Name: "StartTLS Twice Test (Negative)", Operation: "StartTLS", Needs: []Capability{CapabilityStartTLS}, Run: func() TestResult { return testStartTLSTwice(conn) }},
+	})
+
+	logger.Info("StartTLSTest", "Completed StartTLS misuse tests", "total", len(results))
+	return results
+}
+
+func testStartTLSOnLDAPS(conn *ldap.Connection) TestResult {
+	testName := "StartTLS on LDAPS Session Test (Negative)"
+	logger.Info("StartTLSTest", "Running: "+testName)
+
+	if !conn.GetConfig().UseTLS {
+		logger.Warn("StartTLSTest", "SKIP: "+testName, "reason", "requires an LDAPS session")
+		return TestResult{
+			Name:      testName,
+			Operation: "StartTLS",
+			Skipped:   true,
+			Message:   "Skipped: requires an LDAPS session (--use-tls)",
+		}
+	}
+
+	raw, err := conn.DialRaw()
+	if err != nil {
+		return TestResult{
+			Name:      testName,
+			Operation: "StartTLS",
+			Passed:    false,
+			Error:     err,
+			Message:   fmt.Sprintf("Failed to open raw connection: %v", err),
+		}
+	}
+	defer raw.Close()
+
+	return expectStartTLSRejected(raw, testName, time.Now())
+}
+
+func testStartTLSTwice(conn *ldap.Connection) TestResult {
+	testName := "StartTLS Twice Test (Negative)"
+	logger.Info("StartTLSTest", "Running: "+testName)
+
+	if conn.GetConfig().UseTLS {
+		logger.Warn("StartTLSTest", "SKIP: "+testName, "reason", "requires a plain LDAP port")
+		return TestResult{
+			Name:      testName,
+			Operation: "StartTLS",
+			Skipped:   true,
+			Message:   "Skipped: requires a plain LDAP port (not --use-tls)",
+		}
+	}
+
+	raw, err := conn.DialRaw()
+	if err != nil {
+		return TestResult{
+			Name:      testName,
+			Operation: "StartTLS",
+			Passed:    false,
+			Error:     err,
+			Message:   fmt.Sprintf("Failed to open raw connection: %v", err),
+		}
+	}
+	defer raw.Close()
+
+	// The first StartTLS must succeed
+	logger.Trace("StartTLS", "Operation: StartTLS (first)")
+	start := time.Now()
+	msg, err := raw.RequestStartTLS()
+	if err == nil && msg.Err != nil {
+		logger.Warn("StartTLSTest", "SKIP: "+testName, "reason", msg.Err)
+		return TestResult{
+			Name:      testName,
+			Operation: "StartTLS",
+			Duration:  time.Since(start),
+			Skipped:   true,
+			Message:   fmt.Sprintf("Skipped: server does not support StartTLS (%v)", msg.Err),
+		}
+	}
+	if err == nil {
+		err = raw.Handshake()
+	}
+	if err != nil {
+		result := TestResult{
+			Name:      testName,
+			Operation: "StartTLS",
+			Duration:  time.Since(start),
+			Passed:    false,
+			Error:     err,
+			Message:   fmt.Sprintf("First StartTLS failed: %v", err),
+		}
+		logger.Error("StartTLSTest", result.Message)
+		return result
+	}
+
+	return expectStartTLSRejected(raw, testName, start)
+}
+
+// expectStartTLSRejected sends StartTLS on a session that already uses TLS and
+// checks that the server answers operationsError and stays usable
+func expectStartTLSRejected(raw *ldap.RawConn, testName string, start time.Time) TestResult {
+	result := TestResult{
+		Name:      testName,
+		Operation: "StartTLS",
+	}
+
+	logger.Trace("StartTLS", "Operation: StartTLS on TLS session")
+	msg, err := raw.RequestStartTLS()
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Connection wedged or dropped instead of returning operationsError: %v", err)
+		logger.Error("StartTLSTest", result.Message)
+		return result
+	}
+	logger.LogLDAPResult("StartTLS", "StartTLS", msg.Code == ldaplib.LDAPResultSuccess, int(msg.Code), ldaplib.LDAPResultCodeMap[msg.Code], result.Duration)
+
+	if msg.Code != ldaplib.LDAPResultOperationsError {
+		result.Passed = false
+		result.Message = fmt.Sprintf("Expected operationsError (1), got %s (%d)", ldaplib.LDAPResultCodeMap[msg.Code], msg.Code)
+		logger.Error("StartTLSTest", result.Message)
+		return result
+	}
+
+	// The rejected request must leave the session usable
+	if err := raw.Ping(); err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Server returned operationsError but the connection is no longer usable: %v", err)
+		logger.Error("StartTLSTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = "Correctly rejected with operationsError; connection remains usable"
+	logger.Info("StartTLSTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
@@ -0,0 +1,222 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// syncTimeout bounds how long a change notification test watches its entry,
+// for the initial results of the search and the notification of the change
+const syncTimeout = 10 * time.Second
+
+// controlTypePersistentSearch is the Persistent Search control
+// (draft-ietf-ldapext-psearch-03)
+const controlTypePersistentSearch = "2.16.840.1.113730.3.4.3"
+
+// persistentSearchControl asks for every change to the entries in scope,
+// after the entries as they are, with an Entry Change Notification control
+type persistentSearchControl struct{}
+
+func (persistentSearchControl) GetControlType() string {
+	return controlTypePersistentSearch
+}
+
+func (persistentSearchControl) Encode() *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, controlTypePersistentSearch, "Control Type (Persistent Search)"))
+	packet.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, true, "Criticality"))
+
+	value := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "PersistentSearch")
+	value.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 15, "changeTypes: add, delete, modify, modDN"))
+	value.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, false, "changesOnly"))
+	value.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, true, "returnECs"))
+
+	octets := ber.Encode(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, nil, "Control Value (Persistent Search)")
+	octets.AppendChild(value)
+	packet.AppendChild(octets)
+	return packet
+}
+
+func (persistentSearchControl) String() string {
+	return fmt.Sprintf("Control Type: Persistent Search (%q)  Criticality: true", controlTypePersistentSearch)
+}
+
+// changeWatch is a search that keeps reporting the changes of its entries
+type changeWatch struct {
+	name  string // e.g. "content sync", for messages
+	start func(ctx context.Context, conn *ldaplib.Conn, request *ldaplib.SearchRequest) ldaplib.Response
+	ready func(response ldaplib.Response) bool // whether the response ends the initial results
+}
+
+// contentSync is an RFC 4533 refreshAndPersist search; the refresh phase
+// ends with a Sync Info message whose refreshDone is set
+var contentSync = changeWatch{
+	name: "content sync",
+	start: func(ctx context.Context, conn *ldaplib.Conn, request *ldaplib.SearchRequest) ldaplib.Response {
+		return conn.Syncrepl(ctx, request, 16, ldaplib.SyncRequestModeRefreshAndPersist, nil, false)
+	},
+	ready: func(response ldaplib.Response) bool {
+		for _, control := range response.Controls() {
+			if info, ok := control.(*ldaplib.ControlSyncInfo); ok {
+				switch {
+				case info.RefreshDelete != nil:
+					return info.RefreshDelete.RefreshDone
+				case info.RefreshPresent != nil:
+					return info.RefreshPresent.RefreshDone
+				}
+			}
+		}
+		return false
+	},
+}
+
+// persistentSearch returns the entry itself first, so the search is known to
+// be registered before the change is made
+var persistentSearch = changeWatch{
+	name: "persistent search",
+	start: func(ctx context.Context, conn *ldaplib.Conn, request *ldaplib.SearchRequest) ldaplib.Response {
+		request.Controls = append(request.Controls, persistentSearchControl{})
+		return conn.SearchAsync(ctx, request, 16)
+	},
+	ready: func(response ldaplib.Response) bool {
+		return response.Entry() != nil
+	},
+}
+
+// TestSync runs the change notification tests: a search on a connection of
+// its own, opened with open, must report a change made on conn
+func TestSync(conn *ldap.Connection, open func() (*ldap.Connection, error), testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
+	logger.Info("SyncTest", "Starting change notification tests")
+
+	results := h.Execute([]TestCase{
+		// Test 1: RFC 4533 content synchronization in refreshAndPersist mode
+		{Name: "Content Sync Change Notification Test", Operation: "Sync", Needs: []Capability{CapabilitySync}, Run: func() TestResult {
+			return testChangeNotification(conn, open, testBaseDN, trk, "Content Sync Change Notification Test", "sync-user", contentSync)
+		}},
+
+		// Test 2: Persistent search, as in 389 Directory Server, OpenDJ and eDirectory
+		{Name: "Persistent Search Change Notification Test", Operation: "Sync", Needs: []Capability{CapabilityPersistentSearch}, Run: func() TestResult {
+			return testChangeNotification(conn, open, testBaseDN, trk, "Persistent Search Change Notification Test", "psearch-user", persistentSearch)
+		}},
+	})
+
+	logger.Info("SyncTest", "Completed change notification tests", "total", len(results))
+	return results
+}
+
+// testChangeNotification creates an entry, watches it from a second connection
+// and modifies it once the initial results are in; the watch must report the
+// modified entry before syncTimeout ends the search. The duration is the time
+// from the modify to the notification.
+func testChangeNotification(conn *ldap.Connection, open func() (*ldap.Connection, error), testBaseDN string, trk *tracker.Tracker, testName, cn string, watch changeWatch) TestResult {
+	logger.Info("SyncTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Sync",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("SyncTest", result.Message)
+		return result
+	}
+
+	dn := fmt.Sprintf("cn=%s,%s", cn, testBaseDN)
+	addRequest := ldaplib.NewAddRequest(dn, nil)
+	addRequest.Attribute("objectClass", []string{"inetOrgPerson"})
+	addRequest.Attribute("cn", []string{cn})
+	addRequest.Attribute("sn", []string{"Sync"})
+	addRequest.Attribute("description", []string{"before change"})
+	if err := createEntry(conn, addRequest); err != nil {
+		return fail(err, fmt.Sprintf("Failed to create test entry: %v", err))
+	}
+	trk.Track(dn, tracker.TypeUser)
+
+	watcher, err := open()
+	if err != nil {
+		return fail(err, fmt.Sprintf("Failed to open the %s connection: %v", watch.name, err))
+	}
+	defer watcher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	searchRequest := ldaplib.NewSearchRequest(
+		dn,
+		ldaplib.ScopeBaseObject,
+		ldaplib.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		[]string{"description"},
+		nil,
+	)
+	logger.Trace("Sync", "Operation: Search ("+watch.name+")", "dn", dn)
+	response := watch.start(ctx, watcher.GetConnection(), searchRequest)
+	defer func() {
+		// Stop the search and let its reader finish
+		cancel()
+		for response.Next() {
+		}
+	}()
+
+	ready := false
+	for !ready && response.Next() {
+		ready = watch.ready(response)
+	}
+	if !ready {
+		switch {
+		case response.Err() != nil:
+			return fail(response.Err(), fmt.Sprintf("The %s failed: %v", watch.name, response.Err()))
+		case ctx.Err() != nil:
+			return fail(ctx.Err(), fmt.Sprintf("The %s returned no initial results within %s", watch.name, syncTimeout))
+		default:
+			return fail(nil, fmt.Sprintf("The %s ended before any change was made; the server does not keep it open", watch.name))
+		}
+	}
+	logger.Debug("SyncTest", "Initial results received, modifying the entry", "search", watch.name, "dn", dn)
+
+	token := fmt.Sprintf("changed %08x", rand.Uint32())
+	modifyRequest := ldaplib.NewModifyRequest(dn, nil)
+	modifyRequest.Replace("description", []string{token})
+
+	logger.Trace("Sync", "Operation: Modify", "dn", dn, "description", token)
+	start := time.Now()
+	if err := conn.Modify(modifyRequest); err != nil {
+		logger.LogLDAPResult("Sync", "Modify", false, -1, err.Error(), time.Since(start))
+		return fail(err, fmt.Sprintf("Failed to modify the watched entry: %v", err))
+	}
+	logger.LogLDAPResult("Sync", "Modify", true, 0, "Success", time.Since(start))
+
+	notified := false
+	for !notified && response.Next() {
+		entry := response.Entry()
+		notified = entry != nil && hasValue(entry, "description", token)
+	}
+	result.Duration = time.Since(start)
+
+	if !notified {
+		switch {
+		case response.Err() != nil:
+			return fail(response.Err(), fmt.Sprintf("The %s failed after the modify: %v", watch.name, response.Err()))
+		case ctx.Err() != nil:
+			return fail(ctx.Err(), fmt.Sprintf("No change notification before the %s timed out after %s", watch.name, syncTimeout))
+		default:
+			return fail(nil, fmt.Sprintf("The %s ended without reporting the modify", watch.name))
+		}
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("The %s reported the modify after %s", watch.name, result.Duration.Round(time.Millisecond))
+	logger.Info("SyncTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
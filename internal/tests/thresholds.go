@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/config"
+	"ldap-automated-actions/internal/logger"
+)
+
+// thresholdOperation returns the name an operation has in threshold keys:
+// lower case with spaces replaced by underscores (e.g. load_test)
+func thresholdOperation(operation string) string {
+	return strings.ReplaceAll(strings.ToLower(operation), " ", "_")
+}
+
+// CheckThresholds compares the latencies of the executed tests of each
+// operation with the thresholds, returning a result per threshold. A
+// threshold whose operation ran no test is skipped rather than failed, so a
+// config shared by runs of different suites stays usable.
+func CheckThresholds(results []TestResult, thresholds map[string]float64) []TestResult {
+	latencies := make(map[string][]time.Duration)
+	operations := make(map[string]string)
+	for _, result := range results {
+		if result.Skipped {
+			continue
+		}
+		op := thresholdOperation(result.Operation)
+		latencies[op] = append(latencies[op], result.Duration)
+		operations[op] = result.Operation
+	}
+	for _, durations := range latencies {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	}
+
+	keys := make([]string, 0, len(thresholds))
+	for key := range thresholds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	checks := make([]TestResult, 0, len(keys))
+	for _, key := range keys {
+		checks = append(checks, checkThreshold(key, thresholds[key], latencies, operations))
+	}
+	return checks
+}
+
+func checkThreshold(key string, limitMS float64, latencies map[string][]time.Duration, operations map[string]string) TestResult {
+	testName := "Threshold " + key
+	result := TestResult{
+		Name:      testName,
+		Operation: "Latency Threshold",
+	}
+
+	op, statistic, err := config.ParseThreshold(key)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	durations := latencies[op]
+	if len(durations) == 0 {
+		logger.Warn("Thresholds", "SKIP: "+testName, "reason", "no executed test of operation "+op)
+		result.Skipped = true
+		result.Message = fmt.Sprintf("Skipped: no test of operation %s was executed", op)
+		return result
+	}
+
+	measured := latencyStatistic(durations, statistic)
+	limit := time.Duration(limitMS * float64(time.Millisecond))
+	summary := fmt.Sprintf("%s %s %s over %d tests (threshold %s)", operations[op], statistic, measured, len(durations), limit)
+	if measured > limit {
+		result.Message = "Threshold breached: " + summary
+		logger.Error("Thresholds", "FAIL: "+testName, "measured", measured, "threshold", limit)
+		return result
+	}
+
+	result.Passed = true
+	result.Message = summary
+	logger.Info("Thresholds", "PASS: "+testName, "measured", measured, "threshold", limit)
+	return result
+}
+
+// latencyStatistic returns one of config.ThresholdStatistics of sorted
+// latencies
+func latencyStatistic(sorted []time.Duration, statistic string) time.Duration {
+	switch statistic {
+	case "avg":
+		var sum time.Duration
+		for _, d := range sorted {
+			sum += d
+		}
+		return (sum / time.Duration(len(sorted))).Round(time.Microsecond)
+	case "p50":
+		return percentile(sorted, 50)
+	case "p90":
+		return percentile(sorted, 90)
+	case "p95":
+		return percentile(sorted, 95)
+	case "p99":
+		return percentile(sorted, 99)
+	default: // max
+		return percentile(sorted, 100)
+	}
+}
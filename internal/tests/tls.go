@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"fmt"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+)
+
+// TestTLS runs all TLS tests
+func TestTLS(conn *ldap.Connection, h *Harness) []TestResult {
+	logger.Info("TLSTest", "Starting TLS tests")
+
+	results := h.Execute([]TestCase{
+		// Test 1: Report whether the server certificate matches the pin
+		{Name: "TLS Certificate Pin Test", Operation: "TLS", Run: func() TestResult { return testCertificatePin(conn) }},
+	})
+
+	logger.Info("TLSTest", "Completed TLS tests", "total", len(results))
+	return results
+}
+
+func testCertificatePin(conn *ldap.Connection) TestResult {
+	testName := "TLS Certificate Pin Test"
+	logger.Info("TLSTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "TLS",
+	}
+
+	cfg := conn.GetConfig()
+	if !cfg.UseTLS && !cfg.StartTLS {
+		logger.Warn("TLSTest", "SKIP: "+testName, "reason", "TLS not configured")
+		result.Skipped = true
+		result.Message = "Skipped: requires --use-tls or --start-tls"
+		return result
+	}
+
+	// The pin is enforced during the handshake, so a mismatch fails here
+	start := time.Now()
+	raw, err := conn.OpenSecureRaw()
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Passed = false
+		result.Error = err
+		result.Message = fmt.Sprintf("Failed to open TLS connection: %v", err)
+		logger.Error("TLSTest", result.Message)
+		return result
+	}
+	defer raw.Close()
+
+	cert := raw.PeerCertificate()
+	if cert == nil {
+		result.Passed = false
+		result.Message = "Server presented no certificate"
+		logger.Error("TLSTest", result.Message)
+		return result
+	}
+	certHash, spkiHash := ldap.CertificateFingerprints(cert)
+	logger.Info("TLSTest", "Server certificate", "subject", cert.Subject.String(), "notAfter", cert.NotAfter, "certSHA256", certHash, "spkiSHA256", spkiHash)
+
+	pin := cfg.PinnedCertSHA256()
+	if pin == "" {
+		logger.Warn("TLSTest", "SKIP: "+testName, "reason", "no certificate pin configured")
+		result.Skipped = true
+		result.Message = fmt.Sprintf("Skipped: no certificate pin configured (tls_pinned_cert_sha256); certificate SHA-256 %s, SPKI SHA-256 %s", certHash, spkiHash)
+		return result
+	}
+
+	matched := ldap.MatchPin(cert, pin)
+	if matched == "" {
+		result.Passed = false
+		result.Message = fmt.Sprintf("Server certificate does not match the pin (certificate SHA-256 %s, SPKI SHA-256 %s)", certHash, spkiHash)
+		logger.Error("TLSTest", result.Message)
+		return result
+	}
+
+	result.Passed = true
+	if matched == "spki" {
+		result.Message = fmt.Sprintf("Server public key matches the pinned SPKI SHA-256 (certificate for %s, expires %s)", cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+	} else {
+		result.Message = fmt.Sprintf("Server certificate matches the pinned SHA-256 (certificate for %s, expires %s)", cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+	}
+	logger.Info("TLSTest", "PASS: "+testName, "duration", result.Duration)
+	return result
+}
@@ -1,32 +1,76 @@
 package tests
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+)
 
 // TestResult represents the result of a single test
 type TestResult struct {
 	Name      string
 	Operation string
 	Passed    bool
+	Skipped   bool // prerequisites were not met, so the test was not executed
 	Duration  time.Duration
 	Error     error
 	Message   string
+	Started   time.Time // when the harness started the test, zero for results restored by --resume
+
+	BudgetExceeded bool // skipped (or cut short) because a time budget ran out
+	Worker         int  // worker that ran the test in concurrent mode, 0 when sequential
+	Retries        int  // times the test was repeated after failing with a transient result code
+}
+
+// budgetExceeded is the cancellation cause of an exceeded time budget, so
+// the tests it skips can be told apart from those skipped for other reasons
+type budgetExceeded struct {
+	scope  string // "run", or the name of the suite
+	budget time.Duration
+}
+
+func (e *budgetExceeded) Error() string {
+	if e.scope == "run" {
+		return fmt.Sprintf("run time budget of %s exceeded", e.budget)
+	}
+	return fmt.Sprintf("%s suite time budget of %s exceeded", e.scope, e.budget)
+}
+
+// RunMetadata describes the run that produced a report, so archived results
+// are self-describing and reproducible
+type RunMetadata struct {
+	RunID       string
+	ToolVersion string
+	Hostname    string
+	ConfigHash  string
+	Server      ldap.ServerInfo
+	AuditLog    string // LDIF audit trail of the write operations, empty if disabled
 }
 
 // TestSuite represents a collection of test results
 type TestSuite struct {
-	Name      string
-	Results   []TestResult
-	StartTime time.Time
-	EndTime   time.Time
+	Metadata        RunMetadata
+	Name            string
+	Results         []TestResult
+	StartTime       time.Time
+	EndTime         time.Time
+	Interrupted     bool            // the run was cancelled before all tests executed
+	InterruptReason string          // signal or budget that cancelled the run
+	Security        []SecurityCheck // security posture findings, empty if not assessed
+	Workers         []WorkerStats   // per-worker statistics, empty unless run concurrently
 }
 
 // GetStats returns statistics about the test suite
-func (ts *TestSuite) GetStats() (total, passed, failed int, duration time.Duration) {
+func (ts *TestSuite) GetStats() (total, passed, failed, skipped int, duration time.Duration) {
 	total = len(ts.Results)
 	for _, result := range ts.Results {
-		if result.Passed {
+		switch {
+		case result.Skipped:
+			skipped++
+		case result.Passed:
 			passed++
-		} else {
+		default:
 			failed++
 		}
 	}
@@ -34,10 +78,38 @@ func (ts *TestSuite) GetStats() (total, passed, failed int, duration time.Durati
 	return
 }
 
-// AllPassed returns true if all tests passed
+// GetBudgetExceeded returns the number of tests, by operation, that were not
+// executed because a time budget ran out
+func (ts *TestSuite) GetBudgetExceeded() (total int, byOperation map[string]int) {
+	byOperation = make(map[string]int)
+	for _, result := range ts.Results {
+		if result.BudgetExceeded {
+			total++
+			byOperation[result.Operation]++
+		}
+	}
+	return
+}
+
+// GetRetries returns the number of tests that were retried after a
+// transient error, how many of them passed in the end and the total retries
+func (ts *TestSuite) GetRetries() (tests, recovered, retries int) {
+	for _, result := range ts.Results {
+		if result.Retries > 0 {
+			tests++
+			retries += result.Retries
+			if result.Passed {
+				recovered++
+			}
+		}
+	}
+	return
+}
+
+// AllPassed returns true if no executed test failed (skipped tests do not count as failures)
 func (ts *TestSuite) AllPassed() bool {
 	for _, result := range ts.Results {
-		if !result.Passed {
+		if !result.Passed && !result.Skipped {
 			return false
 		}
 	}
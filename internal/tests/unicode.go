@@ -0,0 +1,280 @@
+package tests
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"ldap-automated-actions/internal/ldap"
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// FixtureUnicodeEntries is the entries with non-ASCII values of the unicode suite
+const FixtureUnicodeEntries = "unicode entries"
+
+// unicodeEntry is an entry of the unicode suite, named by a non-ASCII cn
+type unicodeEntry struct {
+	cn           string
+	sn           string
+	descriptions []string
+}
+
+// unicodeEntries covers Latin with diacritics, CJK, a right-to-left script and
+// characters outside the Basic Multilingual Plane, which take four bytes in
+// UTF-8 and a surrogate pair in UTF-16
+var unicodeEntries = []unicodeEntry{
+	{cn: "Zoë Ångström", sn: "Ångström", descriptions: []string{"Ελληνικά: δοκιμή, naïve café", "日本語の説明"}},
+	{cn: "王小明", sn: "王", descriptions: []string{"中文描述：统一码测试"}},
+	{cn: "محمد الأحمد", sn: "الأحمد", descriptions: []string{"وصف باللغة العربية"}},
+	{cn: "Emoji 🚀 Test", sn: "Emoji", descriptions: []string{"Rocket 🚀 and party 🎉", "混合 العربية 🚀"}},
+}
+
+// unicodeEntryDN is the DN of entry i of unicodeEntries
+func unicodeEntryDN(testBaseDN string, i int) string {
+	return fmt.Sprintf("cn=%s,%s", ldaplib.EscapeDN(unicodeEntries[i].cn), testBaseDN)
+}
+
+// hexEscapedDN is the DN of entry i of unicodeEntries with every non-ASCII
+// byte of its cn written as a hex pair, a form servers must parse to the same DN
+func hexEscapedDN(testBaseDN string, i int) string {
+	var cn strings.Builder
+	for _, b := range []byte(ldaplib.EscapeDN(unicodeEntries[i].cn)) {
+		if b < 0x80 {
+			cn.WriteByte(b)
+		} else {
+			fmt.Fprintf(&cn, "\\%02X", b)
+		}
+	}
+	return fmt.Sprintf("cn=%s,%s", cn.String(), testBaseDN)
+}
+
+// unicodeSearch is a search of the unicode suite and the entries of
+// unicodeEntries it must return, by index
+type unicodeSearch struct {
+	filter string
+	want   []int
+}
+
+// TestUnicode runs the internationalization tests: entries with non-ASCII
+// names and descriptions in several scripts are added, read back byte for
+// byte, also by hex-escaped DNs, and searched for with equality and substring
+// filters, to verify UTF-8 handling end-to-end
+func TestUnicode(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker, h *Harness) []TestResult {
+	logger.Info("UnicodeTest", "Starting Unicode and internationalization tests")
+
+	exact := make([]unicodeSearch, len(unicodeEntries))
+	for i, entry := range unicodeEntries {
+		exact[i] = unicodeSearch{filter: eqFilter("cn", entry.cn), want: []int{i}}
+	}
+
+	results := h.Execute([]TestCase{
+		// Test 1: Add the entries and read them back
+		{Name: "Unicode - Add Entries Test", Operation: "Unicode", Provides: FixtureUnicodeEntries, Run: func() TestResult {
+			return testUnicodeAdd(conn, testBaseDN, trk)
+		}},
+
+		// Test 2: Find each entry by an equality filter on its cn
+		{Name: "Unicode - Exact Match Search Test", Operation: "Unicode", Requires: []string{FixtureUnicodeEntries}, Run: func() TestResult {
+			return testUnicodeSearch(conn, testBaseDN, "Unicode - Exact Match Search Test", exact)
+		}},
+
+		// Test 3: Find the entries by substrings in each script
+		{Name: "Unicode - Substring Search Test", Operation: "Unicode", Requires: []string{FixtureUnicodeEntries}, Run: func() TestResult {
+			return testUnicodeSearch(conn, testBaseDN, "Unicode - Substring Search Test", []unicodeSearch{
+				{filter: substringFilter("cn", "", "ström"), want: []int{0}},
+				{filter: substringFilter("cn", "王", ""), want: []int{1}},
+				{filter: substringFilter("sn", "", "الأحمد", ""), want: []int{2}},
+				{filter: substringFilter("description", "", "日本語", ""), want: []int{0}},
+				{filter: substringFilter("description", "", "统一码", ""), want: []int{1}},
+				{filter: substringFilter("description", "", "العربية", ""), want: []int{2, 3}},
+				{filter: substringFilter("description", "", "🚀", ""), want: []int{3}},
+			})
+		}},
+
+		// Test 4: Read each entry by its DN with the UTF-8 bytes hex-escaped (RFC 4514)
+		{Name: "Unicode - Hex-Escaped DN Test", Operation: "Unicode", Requires: []string{FixtureUnicodeEntries}, Run: func() TestResult {
+			return testUnicodeEscapedDN(conn, testBaseDN)
+		}},
+
+		// Test 5: caseIgnoreMatch folds the case of non-ASCII letters too
+		{Name: "Unicode - Case-Insensitive Match Test", Operation: "Unicode", Requires: []string{FixtureUnicodeEntries}, Run: func() TestResult {
+			return testUnicodeSearch(conn, testBaseDN, "Unicode - Case-Insensitive Match Test", []unicodeSearch{
+				{filter: eqFilter("cn", strings.ToUpper(unicodeEntries[0].cn)), want: []int{0}},
+				{filter: eqFilter("cn", strings.ToLower(unicodeEntries[0].cn)), want: []int{0}},
+				{filter: substringFilter("description", "", "ΕΛΛΗΝΙΚΆ", ""), want: []int{0}},
+			})
+		}},
+	})
+
+	logger.Info("UnicodeTest", "Completed Unicode and internationalization tests", "total", len(results))
+	return results
+}
+
+func testUnicodeAdd(conn *ldap.Connection, testBaseDN string, trk *tracker.Tracker) TestResult {
+	testName := "Unicode - Add Entries Test"
+	logger.Info("UnicodeTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Unicode",
+	}
+
+	fail := func(err error, message string) TestResult {
+		result.Passed = false
+		result.Error = err
+		result.Message = message
+		logger.Error("UnicodeTest", result.Message)
+		return result
+	}
+
+	start := time.Now()
+	for i, entry := range unicodeEntries {
+		dn := unicodeEntryDN(testBaseDN, i)
+		attributes := map[string][]string{
+			"cn":          {entry.cn},
+			"sn":          {entry.sn},
+			"description": entry.descriptions,
+		}
+
+		addRequest := ldaplib.NewAddRequest(dn, nil)
+		addRequest.Attribute("objectClass", []string{"top", "person", "organizationalPerson", "inetOrgPerson"})
+		for _, name := range []string{"cn", "sn", "description"} {
+			addRequest.Attribute(name, attributes[name])
+		}
+
+		logger.Trace("Unicode", "Operation: Add", "dn", dn)
+		addStart := time.Now()
+		if err := createEntry(conn, addRequest); err != nil {
+			logger.LogLDAPResult("Unicode", "Add", false, -1, err.Error(), time.Since(addStart))
+			result.Duration = time.Since(start)
+			return fail(err, fmt.Sprintf("Failed to add %s: %v", dn, err))
+		}
+		logger.LogLDAPResult("Unicode", "Add", true, 0, "Success", time.Since(addStart))
+		trk.Track(dn, tracker.TypeUser)
+
+		// The values must come back as the bytes written, not case-folded,
+		// normalized or re-encoded, under the DN they were added with
+		read, err := readAttributes(conn, dn, "cn", "sn", "description")
+		if err != nil {
+			result.Duration = time.Since(start)
+			return fail(err, fmt.Sprintf("Add returned success but read-back failed: %v", err))
+		}
+		if !sameDN(read.DN, dn) {
+			result.Duration = time.Since(start)
+			return fail(nil, fmt.Sprintf("Read back %s as %q", dn, read.DN))
+		}
+		for _, name := range []string{"cn", "sn", "description"} {
+			for _, value := range attributes[name] {
+				if !slices.Contains(read.GetEqualFoldAttributeValues(name), value) {
+					result.Duration = time.Since(start)
+					return fail(nil, fmt.Sprintf("Read back %s of %s as %q, want %q", name, dn, read.GetEqualFoldAttributeValues(name), value))
+				}
+			}
+		}
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Added %d entries with non-ASCII names and descriptions (verified byte for byte by read-back)", len(unicodeEntries))
+	logger.Info("UnicodeTest", "PASS: "+testName, "entries", len(unicodeEntries), "duration", result.Duration)
+	return result
+}
+
+func testUnicodeEscapedDN(conn *ldap.Connection, testBaseDN string) TestResult {
+	testName := "Unicode - Hex-Escaped DN Test"
+	logger.Info("UnicodeTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Unicode",
+	}
+
+	start := time.Now()
+	for i, entry := range unicodeEntries {
+		dn := hexEscapedDN(testBaseDN, i)
+		read, err := readAttributes(conn, dn, "cn")
+		if err == nil && (!sameDN(read.DN, unicodeEntryDN(testBaseDN, i)) || !slices.Contains(read.GetEqualFoldAttributeValues("cn"), entry.cn)) {
+			err = fmt.Errorf("%s read back as %q with cn %q", dn, read.DN, read.GetEqualFoldAttributeValues("cn"))
+		}
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Failed to read %s by its hex-escaped DN: %v", unicodeEntryDN(testBaseDN, i), err)
+			logger.Error("UnicodeTest", result.Message)
+			return result
+		}
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Read all %d entries by their hex-escaped DNs", len(unicodeEntries))
+	logger.Info("UnicodeTest", "PASS: "+testName, "entries", len(unicodeEntries), "duration", result.Duration)
+	return result
+}
+
+// testUnicodeSearch runs searches of the test OU and passes if each returns
+// exactly the entries it wants
+func testUnicodeSearch(conn *ldap.Connection, testBaseDN, testName string, searches []unicodeSearch) TestResult {
+	logger.Info("UnicodeTest", "Running: "+testName)
+
+	result := TestResult{
+		Name:      testName,
+		Operation: "Unicode",
+	}
+
+	start := time.Now()
+	for _, search := range searches {
+		filter := andFilter("(objectClass=inetOrgPerson)", search.filter)
+		attributes := []string{"cn"}
+		searchRequest := ldaplib.NewSearchRequest(
+			testBaseDN,
+			ldaplib.ScopeWholeSubtree,
+			ldaplib.NeverDerefAliases,
+			0, 0, false,
+			filter,
+			attributes,
+			nil,
+		)
+
+		logger.LogSearchOperation("UnicodeTest", testBaseDN, filter, "sub", attributes)
+		searchStart := time.Now()
+		searchResult, err := conn.Search(searchRequest)
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Error = err
+			result.Message = fmt.Sprintf("Search %s failed: %v", search.filter, err)
+			logger.LogLDAPResult("Search", "Search", false, -1, err.Error(), time.Since(searchStart))
+			logger.Error("UnicodeTest", result.Message)
+			return result
+		}
+		logger.LogSearchResult("UnicodeTest", len(searchResult.Entries), time.Since(searchStart))
+
+		found := make([]string, len(searchResult.Entries))
+		for i, entry := range searchResult.Entries {
+			found[i] = entry.DN
+		}
+		want := make([]string, len(search.want))
+		for i, index := range search.want {
+			want[i] = unicodeEntryDN(testBaseDN, index)
+		}
+		if !sameDNSet(found, want) {
+			result.Duration = time.Since(start)
+			result.Passed = false
+			result.Message = fmt.Sprintf("Search %s returned %q, want %q", search.filter, found, want)
+			logger.Error("UnicodeTest", result.Message)
+			return result
+		}
+	}
+	result.Duration = time.Since(start)
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("All %d searches returned the expected entries", len(searches))
+	logger.Info("UnicodeTest", "PASS: "+testName, "searches", len(searches), "duration", result.Duration)
+	return result
+}
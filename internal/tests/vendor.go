@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+
+	"ldap-automated-actions/internal/ldap"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// schemaViolationCodes are the result codes each server answers an add
+// lacking a required attribute with. Negative tests against a server not
+// listed accept any rejection, as result codes for schema errors vary.
+var schemaViolationCodes = map[ldap.Vendor][]uint16{
+	ldap.VendorOpenLDAP:      {ldaplib.LDAPResultObjectClassViolation},
+	ldap.Vendor389DS:         {ldaplib.LDAPResultObjectClassViolation},
+	ldap.VendorApacheDS:      {ldaplib.LDAPResultObjectClassViolation},
+	ldap.VendorOpenDJ:        {ldaplib.LDAPResultObjectClassViolation},
+	ldap.VendorPingDirectory: {ldaplib.LDAPResultObjectClassViolation},
+	ldap.VendorEDirectory:    {ldaplib.LDAPResultObjectClassViolation, ldaplib.LDAPResultConstraintViolation},
+}
+
+// memberOfAttribute returns the attribute in which the server lists the
+// groups of an entry: the OpenDJ and PingDirectory families maintain the
+// virtual isMemberOf, the others memberOf (if at all)
+func memberOfAttribute(vendor ldap.Vendor) string {
+	switch vendor {
+	case ldap.VendorOpenDJ, ldap.VendorPingDirectory:
+		return "isMemberOf"
+	default:
+		return "memberOf"
+	}
+}
+
+// entryMetadata names the operational attributes in which a server records
+// when and by whom an entry was created and last modified, and its unique ID
+type entryMetadata struct {
+	created  string
+	creator  string // empty if the server does not record it
+	modified string
+	modifier string // empty if the server does not record it
+	ids      []string
+}
+
+// entryMetadataAttributes returns the metadata attributes of the server:
+// those of RFC 4512 and RFC 4530 on most, with the unique ID 389 DS and
+// eDirectory use before entryUUID; Active Directory keeps its own, and no
+// creator or modifier
+func entryMetadataAttributes(vendor ldap.Vendor) entryMetadata {
+	if vendor == ldap.VendorActiveDirectory {
+		return entryMetadata{created: "whenCreated", modified: "whenChanged", ids: []string{"objectGUID"}}
+	}
+	return entryMetadata{
+		created:  "createTimestamp",
+		creator:  "creatorsName",
+		modified: "modifyTimestamp",
+		modifier: "modifiersName",
+		ids:      []string{"entryUUID", "nsUniqueId", "GUID"},
+	}
+}
+
+// formatResultCodes renders result codes for messages, e.g. "Object Class
+// Violation (65) or Constraint Violation (19)"
+func formatResultCodes(codes []uint16) string {
+	names := make([]string, len(codes))
+	for i, code := range codes {
+		names[i] = fmt.Sprintf("%s (%d)", ldaplib.LDAPResultCodeMap[code], code)
+	}
+	return strings.Join(names, " or ")
+}
@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"ldap-automated-actions/internal/logger"
+	"ldap-automated-actions/internal/tracker"
+
+	ldaplib "github.com/go-ldap/ldap/v3"
+)
+
+// WorkerStats summarizes the tests run by one worker in concurrent mode
+type WorkerStats struct {
+	ID       int
+	Total    int
+	Passed   int
+	Failed   int
+	Skipped  int
+	Duration time.Duration // wall time of the worker
+	TestTime time.Duration // sum of the durations of its tests
+	Error    string        // why the worker could not run, if it could not
+}
+
+// resultCollector gathers the results of concurrent workers. Results are kept
+// per worker, so the report lists them grouped by worker in execution order
+// however the workers interleave.
+type resultCollector struct {
+	mu      sync.Mutex
+	results map[int][]TestResult
+}
+
+func newResultCollector() *resultCollector {
+	return &resultCollector{results: make(map[int][]TestResult)}
+}
+
+// add records the results of a suite run by worker
+func (c *resultCollector) add(worker int, results []TestResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[worker] = append(c.results[worker], results...)
+}
+
+// all returns the results of workers 1 to n in order
+func (c *resultCollector) all(n int) []TestResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var results []TestResult
+	for id := 1; id <= n; id++ {
+		results = append(results, c.results[id]...)
+	}
+	return results
+}
+
+// worker runs a copy of the selected suites within its own OU below the
+// run's test OU
+type worker struct {
+	id         int
+	testBaseDN string
+}
+
+// executeConcurrent runs the selected suites in r.config.Concurrent workers at
+// once. Each worker borrows a pooled connection per suite and has its own OU
+// (ou=worker-<n> below the test OU) and fixtures, so the copies cannot see
+// each other's entries.
+func (r *Runner) executeConcurrent(ctx context.Context, testBaseDN string, suites []namedSuite) {
+	workers := r.config.Concurrent
+	logger.Info("TestRunner", "Running suites in concurrent workers", "workers", workers)
+
+	collector := newResultCollector()
+	stats := make([]WorkerStats, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			stats[id-1] = r.runWorker(ctx, id, testBaseDN, suites, collector)
+		}(i + 1)
+	}
+	wg.Wait()
+
+	r.suite.Results = append(r.suite.Results, collector.all(workers)...)
+	r.suite.Workers = stats
+}
+
+// runWorker creates the OU of one worker and runs the suites in it,
+// returning the worker's statistics
+func (r *Runner) runWorker(ctx context.Context, id int, testBaseDN string, suites []namedSuite, collector *resultCollector) (stats WorkerStats) {
+	stats.ID = id
+	start := time.Now()
+	defer func() { stats.Duration = time.Since(start) }()
+
+	conn, err := r.pool.Get(ctx)
+	if err != nil {
+		logger.Error("TestRunner", "Worker could not check out a connection", "worker", id, "error", err)
+		return workerFailed(stats, collector, fmt.Errorf("failed to connect: %w", err))
+	}
+	w := &worker{id: id, testBaseDN: fmt.Sprintf("ou=worker-%d,%s", id, testBaseDN)}
+
+	addRequest := ldaplib.NewAddRequest(w.testBaseDN, nil)
+	addRequest.Attribute("objectClass", []string{"organizationalUnit"})
+	addRequest.Attribute("ou", []string{fmt.Sprintf("worker-%d", id)})
+	err = createEntry(conn, addRequest)
+	r.pool.Put(conn)
+	if err != nil {
+		logger.Error("TestRunner", "Worker could not create its OU", "worker", id, "dn", w.testBaseDN, "error", err)
+		return workerFailed(stats, collector, fmt.Errorf("failed to create worker OU: %w", err))
+	}
+	r.tracker.Track(w.testBaseDN, tracker.TypeOU)
+	logger.Info("TestRunner", "Worker started", "worker", id, "testBaseDN", w.testBaseDN)
+
+	h := NewHarness(ctx)
+	h.Filter(r.config.GetTestFilters())
+	h.Retry(r.config.GetRetryPolicy())
+	h.Capabilities(r.suite.Metadata.Server)
+	for _, suite := range suites {
+		results := r.runWorkerSuite(ctx, w, h, suite)
+		collector.add(id, results)
+
+		for _, result := range results {
+			stats.Total++
+			stats.TestTime += result.Duration
+			switch {
+			case result.Skipped:
+				stats.Skipped++
+			case result.Passed:
+				stats.Passed++
+			default:
+				stats.Failed++
+			}
+		}
+	}
+
+	logger.Info("TestRunner", "Worker finished", "worker", id, "tests", stats.Total, "failed", stats.Failed, "duration", time.Since(start))
+	return stats
+}
+
+// workerFailed records a worker that could not start as a failed test, so the
+// run does not pass with part of its workers missing
+func workerFailed(stats WorkerStats, collector *resultCollector, err error) WorkerStats {
+	collector.add(stats.ID, []TestResult{{
+		Name:      "Worker Setup",
+		Operation: "Worker",
+		Passed:    false,
+		Error:     err,
+		Worker:    stats.ID,
+	}})
+	stats.Total, stats.Failed = 1, 1
+	stats.Error = err.Error()
+	return stats
+}
+
+// runWorkerSuite executes one suite on a worker within its time budget, like
+// runSuite does for the sequential run
+func (r *Runner) runWorkerSuite(ctx context.Context, w *worker, h *Harness, suite namedSuite) []TestResult {
+	suiteCtx, cancel := r.suiteContext(ctx, suite.name)
+	defer cancel()
+
+	suiteHarness := h.WithContext(suiteCtx)
+	suiteHarness.OnResult(func(result TestResult) {
+		result.Worker = w.id
+		r.events.Test(suite.name, result)
+	})
+
+	conn, err := r.borrowConnection(suiteCtx)
+	if err != nil {
+		results := suiteNotStarted(suiteCtx, suite.name, err)
+		results[0].Worker = w.id
+		r.events.Test(suite.name, results[0])
+		return results
+	}
+	stopWatch := conn.AbortOnCancel(suiteCtx)
+	results := suite.run(conn, w.testBaseDN, suiteHarness)
+	if !stopWatch() && ctx.Err() == nil {
+		logger.Warn("TestRunner", "Suite time budget exceeded, replacing the worker's connection", "worker", w.id, "suite", suite.name)
+	}
+	r.pool.Put(conn)
+
+	for i := range results {
+		results[i].Worker = w.id
+	}
+	return results
+}
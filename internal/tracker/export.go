@@ -0,0 +1,71 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// export is the JSON document Save writes and Load reads, for a later
+// cleanup or external tooling
+type export struct {
+	TestBaseDN string         `json:"test_base_dn,omitempty"`
+	Entries    []TrackedEntry `json:"entries"`
+}
+
+// TestBaseDN returns the test base DN passed to Begin, or the one of the
+// loaded file, empty if unknown
+func (t *Tracker) TestBaseDN() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.testBaseDN
+}
+
+// Save writes the test base DN and the tracked entries, in creation order, to
+// a JSON file. The file is replaced at once, so a reader never sees it half
+// written.
+func (t *Tracker) Save(path string) error {
+	t.mu.Lock()
+	data, err := json.MarshalIndent(export{TestBaseDN: t.testBaseDN, Entries: t.entries}, "", "  ")
+	t.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode tracked entries: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create tracked entries directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write tracked entries: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write tracked entries: %w", err)
+	}
+	return nil
+}
+
+// Load reads a tracker from a file written by Save
+func Load(path string) (*Tracker, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tracked entries: %w", err)
+	}
+
+	var e export
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("failed to parse tracked entries %s: %w", path, err)
+	}
+	for i, entry := range e.Entries {
+		if entry.DN == "" {
+			return nil, fmt.Errorf("invalid tracked entries %s: entry %d has no DN", path, i+1)
+		}
+	}
+
+	t := NewTracker()
+	t.Load(e.Entries)
+	t.testBaseDN = e.TestBaseDN
+	return t, nil
+}
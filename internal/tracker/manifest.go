@@ -0,0 +1,142 @@
+package tracker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ldap-automated-actions/internal/logger"
+)
+
+// manifestRecord is a line of a manifest: one change to the tracked entries
+type manifestRecord struct {
+	Op        string     `json:"op"` // begin, track, rename, remove or clear
+	DN        string     `json:"dn,omitempty"`
+	NewDN     string     `json:"new_dn,omitempty"`
+	Type      EntryType  `json:"type,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// trackRecord is the record of a tracked entry
+func trackRecord(entry TrackedEntry) manifestRecord {
+	return manifestRecord{Op: "track", DN: entry.DN, Type: entry.Type, CreatedAt: &entry.CreatedAt}
+}
+
+// Manifest is what a manifest file records: the test base DN of the run and
+// the entries tracked in it, in creation order
+type Manifest struct {
+	TestBaseDN string
+	Entries    []TrackedEntry
+}
+
+// OpenManifest appends every later change to the tracked entries to the JSON
+// Lines file at path, as it happens, so a run that is killed before it can
+// clean up leaves a record of what it created. The file is created if needed
+// and the entries tracked so far are written first.
+func (t *Tracker) OpenManifest(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open manifest: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.manifest = file
+	t.record(manifestRecord{Op: "clear"})
+	for _, entry := range t.entries {
+		t.record(trackRecord(entry))
+	}
+	logger.Debug("Tracker", "Recording tracked entries in manifest", "file", path)
+	return nil
+}
+
+// CloseManifest stops recording and closes the manifest file
+func (t *Tracker) CloseManifest() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.manifest == nil {
+		return nil
+	}
+	err := t.manifest.Close()
+	t.manifest = nil
+	return err
+}
+
+// Begin records the test base DN the entries tracked from now on belong to
+func (t *Tracker) Begin(testBaseDN string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.testBaseDN = testBaseDN
+	t.record(manifestRecord{Op: "begin", DN: testBaseDN})
+}
+
+// record appends a change to the manifest, if one is open. The caller holds
+// the lock. Each record is a single write, so a killed run leaves at most a
+// truncated last line.
+func (t *Tracker) record(record manifestRecord) {
+	if t.manifest == nil {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err == nil {
+		_, err = t.manifest.Write(append(data, '\n'))
+	}
+	if err != nil {
+		logger.Warn("Tracker", "Failed to write manifest, it no longer records the tracked entries", "file", t.manifest.Name(), "error", err)
+		t.manifest.Close()
+		t.manifest = nil
+	}
+}
+
+// ReadManifest replays a manifest file into the entries that were tracked
+// when it was last written. A truncated last line, as a killed run may
+// leave, is ignored.
+func ReadManifest(path string) (*Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer file.Close()
+
+	t := NewTracker()
+	m := &Manifest{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var record manifestRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			logger.Warn("Tracker", "Ignoring unreadable manifest line", "file", path, "line", line, "error", err)
+			continue
+		}
+		switch record.Op {
+		case "begin":
+			m.TestBaseDN = record.DN
+		case "track":
+			entry := TrackedEntry{DN: record.DN, Type: record.Type}
+			if record.CreatedAt != nil {
+				entry.CreatedAt = *record.CreatedAt
+			}
+			t.entries = append(t.entries, entry)
+		case "rename":
+			t.Rename(record.DN, record.NewDN)
+		case "remove":
+			t.Remove(record.DN)
+		case "clear":
+			m.TestBaseDN = ""
+			t.entries = t.entries[:0]
+		default:
+			return nil, fmt.Errorf("invalid manifest %s: unknown operation %q on line %d", path, record.Op, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	m.Entries = t.GetEntries()
+	return m, nil
+}
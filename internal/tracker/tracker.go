@@ -2,6 +2,8 @@ package tracker
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"sync"
 	"time"
 
@@ -12,23 +14,26 @@ import (
 type EntryType string
 
 const (
-	TypeOU    EntryType = "OU"
-	TypeUser  EntryType = "User"
-	TypeGroup EntryType = "Group"
-	TypeOther EntryType = "Other"
+	TypeOU       EntryType = "OU"
+	TypeUser     EntryType = "User"
+	TypeGroup    EntryType = "Group"
+	TypeReferral EntryType = "Referral"
+	TypeOther    EntryType = "Other"
 )
 
 // TrackedEntry represents a tracked LDAP entry
 type TrackedEntry struct {
-	DN        string
-	Type      EntryType
-	CreatedAt time.Time
+	DN        string    `json:"dn"`
+	Type      EntryType `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // Tracker keeps track of all created LDAP entries for cleanup
 type Tracker struct {
-	entries []TrackedEntry
-	mu      sync.Mutex
+	entries    []TrackedEntry
+	testBaseDN string // test OU the entries belong to, if known
+	mu         sync.Mutex
+	manifest   *os.File // records each change as it happens, nil if not open
 }
 
 // NewTracker creates a new entry tracker
@@ -50,9 +55,54 @@ func (t *Tracker) Track(dn string, entryType EntryType) {
 	}
 
 	t.entries = append(t.entries, entry)
+	t.record(trackRecord(entry))
 	logger.Debug("Tracker", "Tracking new entry", "dn", dn, "type", entryType)
 }
 
+// Load replaces the tracked entries, e.g. with those of a resumed run
+func (t *Tracker) Load(entries []TrackedEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.entries = make([]TrackedEntry, len(entries))
+	copy(t.entries, entries)
+	t.record(manifestRecord{Op: "clear"})
+	for _, entry := range entries {
+		t.record(trackRecord(entry))
+	}
+	logger.Debug("Tracker", "Loaded tracked entries", "count", len(entries))
+}
+
+// Rename updates the DN of a tracked entry after a Modify DN
+func (t *Tracker) Rename(oldDN, newDN string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.entries {
+		if t.entries[i].DN == oldDN {
+			t.entries[i].DN = newDN
+			t.record(manifestRecord{Op: "rename", DN: oldDN, NewDN: newDN})
+			logger.Debug("Tracker", "Renamed tracked entry", "oldDN", oldDN, "newDN", newDN)
+			return
+		}
+	}
+}
+
+// Remove stops tracking an entry that has been deleted
+func (t *Tracker) Remove(dn string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.entries {
+		if t.entries[i].DN == dn {
+			t.entries = append(t.entries[:i], t.entries[i+1:]...)
+			t.record(manifestRecord{Op: "remove", DN: dn})
+			logger.Debug("Tracker", "Removed tracked entry", "dn", dn)
+			return
+		}
+	}
+}
+
 // GetEntries returns all tracked entries
 func (t *Tracker) GetEntries() []TrackedEntry {
 	t.mu.Lock()
@@ -88,20 +138,22 @@ func (t *Tracker) Clear() {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	t.entries = make([]TrackedEntry, 0)
+	t.testBaseDN = ""
+	t.record(manifestRecord{Op: "clear"})
 	logger.Debug("Tracker", "Cleared all tracked entries")
 }
 
-// PrintSummary prints a summary of all tracked entries
-func (t *Tracker) PrintSummary() {
+// WriteSummary writes a summary of all tracked entries to w
+func (t *Tracker) WriteSummary(w io.Writer) {
 	entries := t.GetEntries()
 
 	if len(entries) == 0 {
-		fmt.Println("\nNo test data was created.")
+		fmt.Fprintln(w, "\nNo test data was created.")
 		return
 	}
 
-	fmt.Printf("\n=== Created Test Data Summary ===\n")
-	fmt.Printf("Total entries created: %d\n\n", len(entries))
+	fmt.Fprintf(w, "\n=== Created Test Data Summary ===\n")
+	fmt.Fprintf(w, "Total entries created: %d\n\n", len(entries))
 
 	// Group by type
 	byType := make(map[EntryType][]string)
@@ -110,17 +162,17 @@ func (t *Tracker) PrintSummary() {
 	}
 
 	// Print by type
-	for _, entryType := range []EntryType{TypeOU, TypeUser, TypeGroup, TypeOther} {
+	for _, entryType := range []EntryType{TypeOU, TypeUser, TypeGroup, TypeReferral, TypeOther} {
 		if dns, ok := byType[entryType]; ok {
-			fmt.Printf("%s entries (%d):\n", entryType, len(dns))
+			fmt.Fprintf(w, "%s entries (%d):\n", entryType, len(dns))
 			for _, dn := range dns {
-				fmt.Printf("  - %s\n", dn)
+				fmt.Fprintf(w, "  - %s\n", dn)
 			}
-			fmt.Println()
+			fmt.Fprintln(w)
 		}
 	}
 
-	fmt.Println("Note: Test data has been preserved. Use --cleanup flag to remove it automatically.")
+	fmt.Fprintln(w, "Note: Test data has been preserved. Use --cleanup flag to remove it automatically.")
 }
 
 // GetOldEntries returns entries older than the specified duration
@@ -0,0 +1,4 @@
+package version
+
+// Version is the tool version, reported by --version and included in run reports
+var Version = "1.0.0"